@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	sortpkg "sort"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const accessTokenHookEvent = "access_token"
+
+// reservedHookClaims are the claims the access token hook can't set, as
+// they're what the token is checked against.
+var reservedHookClaims = []string{
+	"sub", "aud", "exp", "iat", "nbf", "iss", "jti",
+	"email", "phone", "app_metadata", "user_metadata",
+	"client_id", "scope", "cnf", "act", "gty", "session_id",
+	"is_anonymous", "shadow_banned", "claims_ref",
+}
+
+// AccessTokenHookInput is sent to the access token hook.
+type AccessTokenHookInput struct {
+	Event     string        `json:"event"`
+	User      *models.User  `json:"user"`
+	GrantType string        `json:"grant_type,omitempty"`
+	SessionID string        `json:"session_id,omitempty"`
+	Claims    *GoTrueClaims `json:"claims"`
+}
+
+// AccessTokenHookOutput is what the access token hook returns: the claims
+// to add to the token or override in it.
+type AccessTokenHookOutput struct {
+	Claims map[string]interface{} `json:"claims"`
+}
+
+// generateHookedAccessToken generates an access token like
+// generateBoundAccessToken, with the claims of the access token hook, if one
+// is configured, and returns it along with its expiry in seconds.
+func (a *API) generateHookedAccessToken(ctx context.Context, tx *storage.Connection, user *models.User, jkt, grantType, sessionID string) (string, int, error) {
+	config := a.getConfig(ctx)
+	claims := accessTokenClaims(user, 0, &config.JWT, jkt, grantType, sessionID)
+
+	if config.AccessTokenHook.Enabled() {
+		hookClaims, err := a.runAccessTokenHook(ctx, tx, config, &AccessTokenHookInput{
+			Event:     accessTokenHookEvent,
+			User:      user,
+			GrantType: grantType,
+			SessionID: sessionID,
+			Claims:    claims,
+		})
+		if err == nil {
+			err = applyHookClaims(claims, hookClaims)
+		}
+		if err != nil {
+			if !config.AccessTokenHook.FailOpen {
+				return "", 0, err
+			}
+			logrus.WithFields(logrus.Fields{
+				"component":   "access_token_hook",
+				"request_id":  getRequestID(ctx),
+				"instance_id": getInstanceID(ctx),
+				"user_id":     user.ID,
+			}).WithError(err).Warn("Access token hook failed, issuing the token without its claims")
+		}
+	}
+
+	// the expiry depends on the roles the hook may have changed
+	exp := config.JWT.ExpFor(claims.Audience, claimsRoles(claims))
+	claims.ExpiresAt = clock.Now().Add(time.Second * time.Duration(exp)).Unix()
+	token, err := signAccessToken(claims, &config.JWT)
+	return token, exp, err
+}
+
+// claimsRoles returns the role and roles of claims.
+func claimsRoles(claims *GoTrueClaims) []string {
+	roles := []string{}
+	if claims.Role != "" {
+		roles = append(roles, claims.Role)
+	}
+	return append(roles, claims.Roles...)
+}
+
+// runAccessTokenHook calls the access token hook and returns the claims it
+// returned.
+func (a *API) runAccessTokenHook(ctx context.Context, tx *storage.Connection, config *conf.Configuration, input *AccessTokenHookInput) (map[string]interface{}, error) {
+	hookConfig := config.AccessTokenHook
+	if hookConfig.Function != "" {
+		output, err := models.CallClaimsFunction(tx, hookConfig.Function, input)
+		if err != nil {
+			return nil, err
+		}
+		return hookOutputClaims(output)
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	sha, err := checksum(data)
+	if err != nil {
+		return nil, err
+	}
+	instanceID := getInstanceID(ctx)
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{URL: hookConfig.URL, Retries: 1, TimeoutSec: hookConfig.TimeoutSec},
+		jwtSecret:     hookConfig.Secret,
+		instanceID:    instanceID,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  instanceID.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: data,
+		headers: requestIDHeaders(getRequestID(ctx)),
+	}
+	body, err := w.trigger()
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, nil
+	}
+	defer body.Close()
+
+	output := &AccessTokenHookOutput{}
+	if err := json.NewDecoder(body).Decode(output); err != nil {
+		return nil, fmt.Errorf("error reading access token hook response: %v", err)
+	}
+	return output.Claims, nil
+}
+
+// hookOutputClaims returns the claims of the output of a hook function.
+func hookOutputClaims(output map[string]interface{}) (map[string]interface{}, error) {
+	claims, ok := output["claims"]
+	if !ok || claims == nil {
+		return nil, nil
+	}
+	claimsMap, ok := claims.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("access token hook returned claims that aren't an object")
+	}
+	return claimsMap, nil
+}
+
+// applyHookClaims sets the claims returned by the access token hook: role
+// and roles replace the user's, and the other claims are added to the token,
+// overriding the custom claims of the same name. Nothing is set if any of
+// the claims is invalid.
+func applyHookClaims(claims *GoTrueClaims, hookClaims map[string]interface{}) error {
+	keys := make([]string, 0, len(hookClaims))
+	for key := range hookClaims {
+		keys = append(keys, key)
+	}
+	sortpkg.Strings(keys)
+
+	role := claims.Role
+	roles := claims.Roles
+	custom := map[string]interface{}{}
+	for _, key := range keys {
+		value := hookClaims[key]
+		switch {
+		case isStringInSlice(key, reservedHookClaims):
+			return fmt.Errorf("access token hook can't set the %s claim", key)
+		case key == "role":
+			r, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("access token hook returned a role that isn't a string")
+			}
+			role = r
+		case key == "roles":
+			list, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("access token hook returned roles that aren't a list")
+			}
+			roles = make([]string, 0, len(list))
+			for _, item := range list {
+				r, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("access token hook returned roles that aren't strings")
+				}
+				roles = append(roles, r)
+			}
+		default:
+			custom[key] = value
+		}
+	}
+
+	claims.Role = role
+	claims.Roles = roles
+	if len(custom) > 0 {
+		if claims.CustomClaims == nil {
+			claims.CustomClaims = map[string]interface{}{}
+		}
+		for key, value := range custom {
+			claims.CustomClaims[key] = value
+		}
+	}
+	return nil
+}
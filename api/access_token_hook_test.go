@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestApplyHookClaims(t *testing.T) {
+	claims := &GoTrueClaims{
+		Role:         "authenticated",
+		Roles:        []string{"authenticated"},
+		CustomClaims: map[string]interface{}{"https://example.com/plan": "free"},
+	}
+	require.NoError(t, applyHookClaims(claims, map[string]interface{}{
+		"role":                     "admin",
+		"roles":                    []interface{}{"admin", "billing"},
+		"tenant_id":                "acme",
+		"https://example.com/plan": "pro",
+	}))
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, []string{"admin", "billing"}, claims.Roles)
+	assert.Equal(t, "acme", claims.CustomClaims["tenant_id"])
+	assert.Equal(t, "pro", claims.CustomClaims["https://example.com/plan"])
+
+	claims = &GoTrueClaims{Role: "authenticated"}
+	assert.Error(t, applyHookClaims(claims, map[string]interface{}{"tenant_id": "acme", "sub": "someone-else"}))
+	assert.Error(t, applyHookClaims(claims, map[string]interface{}{"role": 1}))
+	assert.Error(t, applyHookClaims(claims, map[string]interface{}{"roles": []interface{}{"admin", 1}}))
+	assert.Equal(t, "authenticated", claims.Role)
+	assert.Nil(t, claims.CustomClaims)
+}
+
+type AccessTokenHookTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestAccessTokenHook(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &AccessTokenHookTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *AccessTokenHookTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	ts.Config.AccessTokenHook = conf.AccessTokenHookConfiguration{}
+
+	u, err := models.NewUser(ts.instanceID, "", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.EmailConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+}
+
+func (ts *AccessTokenHookTestSuite) signIn() (*httptest.ResponseRecorder, jwt.MapClaims) {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "password",
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return w, nil
+	}
+
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	return w, claims
+}
+
+func (ts *AccessTokenHookTestSuite) TestHookAddsClaims() {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input := map[string]interface{}{}
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&input))
+		assert.Equal(ts.T(), accessTokenHookEvent, input["event"])
+		assert.Equal(ts.T(), passwordGrant, input["grant_type"])
+		assert.NotEmpty(ts.T(), r.Header.Get(headerHookSignature))
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(ts.T(), json.NewEncoder(w).Encode(map[string]interface{}{
+			"claims": map[string]interface{}{"tenant_id": "acme", "role": "owner"},
+		}))
+	}))
+	defer svr.Close()
+	ts.Config.AccessTokenHook.URL = svr.URL
+	ts.Config.AccessTokenHook.Secret = "secret"
+
+	w, claims := ts.signIn()
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	assert.Equal(ts.T(), "acme", claims["tenant_id"])
+	assert.Equal(ts.T(), "owner", claims["role"])
+}
+
+func (ts *AccessTokenHookTestSuite) TestHookFailure() {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer svr.Close()
+	ts.Config.AccessTokenHook.URL = svr.URL
+
+	w, _ := ts.signIn()
+	assert.Equal(ts.T(), http.StatusInternalServerError, w.Code)
+
+	ts.Config.AccessTokenHook.FailOpen = true
+	w, claims := ts.signIn()
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	assert.NotContains(ts.T(), claims, "tenant_id")
+}
@@ -10,9 +10,12 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
 	"github.com/sethvargo/go-password/password"
 )
 
@@ -27,6 +30,14 @@ type adminUserParams struct {
 	UserMetaData map[string]interface{} `json:"user_metadata"`
 	AppMetaData  map[string]interface{} `json:"app_metadata"`
 	BanDuration  string                 `json:"ban_duration"`
+	ExternalID   *string                `json:"external_id"`
+	LegalHold    *bool                  `json:"legal_hold"`
+	ShadowBanned *bool                  `json:"shadow_banned"`
+
+	// PasswordHash is a password already hashed by another auth provider,
+	// with the optional PasswordHashAlgorithm it has to use.
+	PasswordHash          *string `json:"password_hash"`
+	PasswordHashAlgorithm string  `json:"password_hash_algorithm"`
 }
 
 func (a *API) loadUser(w http.ResponseWriter, r *http.Request) (context.Context, error) {
@@ -38,7 +49,7 @@ func (a *API) loadUser(w http.ResponseWriter, r *http.Request) (context.Context,
 	logger.LogEntrySetField(r, "user_id", userID)
 	instanceID := getInstanceID(r.Context())
 
-	u, err := models.FindUserByInstanceIDAndID(a.db, instanceID, userID)
+	u, err := models.FindUserByInstanceIDAndID(a.getDB(r.Context()), instanceID, userID)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			return nil, notFoundError("User not found")
@@ -49,6 +60,22 @@ func (a *API) loadUser(w http.ResponseWriter, r *http.Request) (context.Context,
 	return withUser(r.Context(), u), nil
 }
 
+// validateExternalID checks that no other user of the instance has the external id
+func (a *API) validateExternalID(ctx context.Context, instanceID uuid.UUID, externalID string, userID uuid.UUID) error {
+	if externalID == "" {
+		return nil
+	}
+	if len(externalID) > 255 {
+		return unprocessableEntityError("external_id must be at most 255 characters")
+	}
+	if exists, err := models.IsDuplicatedExternalID(a.getDB(ctx), instanceID, externalID, userID); err != nil {
+		return internalServerError("Database error checking external_id").WithInternalError(err)
+	} else if exists {
+		return unprocessableEntityError("external_id already assigned to another user")
+	}
+	return nil
+}
+
 func (a *API) getAdminParams(r *http.Request) (*adminUserParams, error) {
 	params := adminUserParams{}
 	err := json.NewDecoder(r.Body).Decode(&params)
@@ -58,6 +85,24 @@ func (a *API) getAdminParams(r *http.Request) (*adminUserParams, error) {
 	return &params, nil
 }
 
+// validatePasswordHash checks the password hash of an imported user, which
+// replaces the password.
+func validatePasswordHash(params *adminUserParams) error {
+	if params.PasswordHash == nil {
+		if params.PasswordHashAlgorithm != "" {
+			return badRequestError("password_hash_algorithm requires a password_hash")
+		}
+		return nil
+	}
+	if params.Password != nil {
+		return badRequestError("Only one of password and password_hash can be set")
+	}
+	if _, err := models.ParsePasswordHash(*params.PasswordHash, params.PasswordHashAlgorithm); err != nil {
+		return unprocessableEntityError(err.Error())
+	}
+	return nil
+}
+
 // adminUsers responds with a list of all users in a given audience
 func (a *API) adminUsers(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -75,13 +120,76 @@ func (a *API) adminUsers(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	filter := r.URL.Query().Get("filter")
-
-	users, err := models.FindUsersInAudience(a.db, instanceID, aud, pageParams, sortParams, filter)
+	status := r.URL.Query().Get("status")
+
+	var users []*models.User
+	if status == "" {
+		users, err = models.FindUsersInAudience(a.getDB(ctx), instanceID, aud, pageParams, sortParams, filter)
+	} else if models.IsUserStatus(status) {
+		users, err = models.FindUsersWithStatusInAudience(a.getDB(ctx), instanceID, aud, status, clock.Now(), a.getConfig(ctx).Security.OtpMaxAttempts, pageParams, sortParams, filter)
+	} else {
+		return badRequestError("status must be one of banned, locked or unconfirmed")
+	}
 	if err != nil {
 		return internalServerError("Database error finding users").WithInternalError(err)
 	}
+	if err := a.auditAdminRead(r, models.UsersListedAction, map[string]interface{}{
+		"aud":      aud,
+		"filter":   filter,
+		"status":   status,
+		"page":     pageParams.Page,
+		"per_page": pageParams.PerPage,
+		"count":    len(users),
+	}); err != nil {
+		return err
+	}
 	addPaginationHeaders(w, r, pageParams)
 
+	if a.maskUsers(ctx) {
+		for i, user := range users {
+			users[i] = user.Masked()
+		}
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"users": users,
+		"aud":   aud,
+	})
+}
+
+// adminBannedUsers responds with the users of an audience that are banned,
+// along with the reason and when the ban ends
+func (a *API) adminBannedUsers(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	aud := a.requestAud(ctx, r)
+
+	pageParams, err := paginate(r)
+	if err != nil {
+		return badRequestError("Bad Pagination Parameters: %v", err)
+	}
+
+	users, err := models.FindBannedUsers(a.getDB(ctx), instanceID, aud, clock.Now(), pageParams)
+	if err != nil {
+		return internalServerError("Database error finding banned users").WithInternalError(err)
+	}
+	if err := a.auditAdminRead(r, models.UsersListedAction, map[string]interface{}{
+		"aud":      aud,
+		"banned":   true,
+		"page":     pageParams.Page,
+		"per_page": pageParams.PerPage,
+		"count":    len(users),
+	}); err != nil {
+		return err
+	}
+	addPaginationHeaders(w, r, pageParams)
+
+	if a.maskUsers(ctx) {
+		for i, user := range users {
+			users[i] = user.Masked()
+		}
+	}
+
 	return sendJSON(w, http.StatusOK, map[string]interface{}{
 		"users": users,
 		"aud":   aud,
@@ -92,9 +200,68 @@ func (a *API) adminUsers(w http.ResponseWriter, r *http.Request) error {
 func (a *API) adminUserGet(w http.ResponseWriter, r *http.Request) error {
 	user := getUser(r.Context())
 
+	if err := a.auditAdminRead(r, models.UserViewedAction, map[string]interface{}{
+		"user_id": user.ID,
+	}); err != nil {
+		return err
+	}
+	if a.maskUsers(r.Context()) {
+		user = user.Masked()
+	}
 	return sendJSON(w, http.StatusOK, user)
 }
 
+// maskUsers returns whether the admin may only see users with their personal
+// data masked.
+func (a *API) maskUsers(ctx context.Context) bool {
+	adminUser := getAdminUser(ctx)
+	return adminUser != nil && isStringInSlice(adminUser.Role, a.getConfig(ctx).JWT.AdminMaskedRoles)
+}
+
+// adminUserTimeline returns the signups, logins, token refreshes, emails,
+// admin actions and security events of a single user, newest first
+func (a *API) adminUserTimeline(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r.Context())
+
+	pageParams, err := paginate(r)
+	if err != nil {
+		return badRequestError("Bad Pagination Parameters: %v", err)
+	}
+
+	events, err := models.FindUserTimeline(a.getDB(r.Context()), user, pageParams)
+	if err != nil {
+		return internalServerError("Database error loading user timeline").WithInternalError(err)
+	}
+	if err := a.auditAdminRead(r, models.UserViewedAction, map[string]interface{}{
+		"user_id":  user.ID,
+		"view":     "timeline",
+		"page":     pageParams.Page,
+		"per_page": pageParams.PerPage,
+	}); err != nil {
+		return err
+	}
+	addPaginationHeaders(w, r, pageParams)
+
+	return sendJSON(w, http.StatusOK, events)
+}
+
+// auditAdminRead records an admin viewing users when AUDIT_ADMIN_READS is on.
+// The read fails if it can't be recorded, so no view goes unrecorded.
+func (a *API) auditAdminRead(r *http.Request, action models.AuditAction, traits map[string]interface{}) error {
+	ctx := r.Context()
+	if !a.getConfig(ctx).Audit.AdminReads {
+		return nil
+	}
+	// the admin user only has a role, the sub claim tells admins apart
+	if claims := getClaims(ctx); claims != nil && claims.Subject != "" {
+		traits["admin_id"] = claims.Subject
+	}
+	if err := models.NewAuditLogEntry(r, a.getDB(ctx), getInstanceID(ctx), getAdminUser(ctx), action, utilities.GetIPAddress(r), traits); err != nil {
+		return internalServerError("Error recording audit log entry").WithInternalError(err)
+	}
+	return nil
+}
+
 // adminUserUpdate updates a single user object
 func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -107,7 +274,29 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	if params.ExternalID != nil {
+		if err := a.validateExternalID(ctx, instanceID, *params.ExternalID, user.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := validatePasswordHash(params); err != nil {
+		return err
+	}
+
+	if params.Password != nil {
+		if len(*params.Password) < config.PasswordMinLength {
+			return invalidPasswordLengthError(config)
+		}
+		if err := checkPasswordPolicy(config, *params.Password); err != nil {
+			return err
+		}
+		if err := a.checkLeakedPassword(r, config, *params.Password)(); err != nil {
+			return err
+		}
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if params.Role != "" {
 			if terr := user.SetRole(tx, params.Role); terr != nil {
 				return terr
@@ -127,11 +316,13 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		if params.Password != nil {
-			if len(*params.Password) < config.PasswordMinLength {
-				return invalidPasswordLengthError(config)
+			if terr := user.UpdatePassword(tx, *params.Password); terr != nil {
+				return terr
 			}
+		}
 
-			if terr := user.UpdatePassword(tx, *params.Password); terr != nil {
+		if params.PasswordHash != nil {
+			if terr := user.SetPasswordHash(tx, *params.PasswordHash); terr != nil {
 				return terr
 			}
 		}
@@ -148,6 +339,12 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 			}
 		}
 
+		if params.ExternalID != nil {
+			if terr := user.SetExternalID(tx, *params.ExternalID); terr != nil {
+				return terr
+			}
+		}
+
 		if params.AppMetaData != nil {
 			if terr := user.UpdateAppMetaData(tx, params.AppMetaData); terr != nil {
 				return terr
@@ -163,19 +360,51 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		if params.BanDuration != "" {
 			if params.BanDuration == "none" {
 				user.BannedUntil = nil
+				user.BanReason = ""
 			} else {
 				duration, terr := time.ParseDuration(params.BanDuration)
 				if terr != nil {
 					return badRequestError("Invalid format for ban_duration: %v", terr)
 				}
-				t := time.Now().Add(duration)
+				t := clock.Now().Add(duration)
 				user.BannedUntil = &t
+				user.BanReason = models.BanReasonAdmin
 			}
 			if terr := user.UpdateBannedUntil(tx); terr != nil {
 				return terr
 			}
 		}
 
+		if params.LegalHold != nil && *params.LegalHold != user.IsOnLegalHold() {
+			if terr := user.SetLegalHold(tx, *params.LegalHold); terr != nil {
+				return terr
+			}
+			action := models.UserLegalHoldReleasedAction
+			if *params.LegalHold {
+				action = models.UserLegalHoldPlacedAction
+			}
+			if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, action, "", map[string]interface{}{
+				"user_id": user.ID,
+			}); terr != nil {
+				return terr
+			}
+		}
+
+		if params.ShadowBanned != nil && *params.ShadowBanned != user.IsShadowBanned() {
+			if terr := user.SetShadowBanned(tx, *params.ShadowBanned); terr != nil {
+				return terr
+			}
+			action := models.UserShadowBanLiftedAction
+			if *params.ShadowBanned {
+				action = models.UserShadowBannedAction
+			}
+			if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, action, "", map[string]interface{}{
+				"user_id": user.ID,
+			}); terr != nil {
+				return terr
+			}
+		}
+
 		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserModifiedAction, "", map[string]interface{}{
 			"user_id":    user.ID,
 			"user_email": user.Email,
@@ -195,6 +424,7 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		}
 		return internalServerError("Error updating user").WithInternalError(err)
 	}
+	a.emitLifecycleEvent(ctx, UserUpdatedEvent, user)
 
 	return sendJSON(w, http.StatusOK, user)
 }
@@ -216,42 +446,66 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 		aud = params.Aud
 	}
 
+	if err := validatePasswordHash(params); err != nil {
+		return err
+	}
+
+	errs := fieldErrors{}
 	if params.Email == "" && params.Phone == "" {
-		return unprocessableEntityError("Cannot create a user without either an email or phone")
+		errs.add("email", "Cannot create a user without either an email or phone")
 	}
 
 	if params.Email != "" {
 		if err := a.validateEmail(ctx, params.Email); err != nil {
-			return err
-		}
-		if exists, err := models.IsDuplicatedEmail(a.db, instanceID, params.Email, aud); err != nil {
+			errs.addError("email", err)
+		} else if exists, err := models.IsDuplicatedEmail(a.getDB(ctx), instanceID, params.Email, aud); err != nil {
 			return internalServerError("Database error checking email").WithInternalError(err)
 		} else if exists {
-			return unprocessableEntityError("Email address already registered by another user")
+			errs.add("email", "Email address already registered by another user")
 		}
 	}
 
 	if params.Phone != "" {
-		params.Phone, err = a.validatePhone(params.Phone)
-		if err != nil {
-			return err
-		}
-		if exists, err := models.IsDuplicatedPhone(a.db, instanceID, params.Phone, aud); err != nil {
+		if params.Phone, err = a.validatePhone(params.Phone); err != nil {
+			errs.addError("phone", err)
+		} else if exists, err := models.IsDuplicatedPhone(a.getDB(ctx), instanceID, params.Phone, aud); err != nil {
 			return internalServerError("Database error checking phone").WithInternalError(err)
 		} else if exists {
-			return unprocessableEntityError("Phone number already registered by another user")
+			errs.add("phone", "Phone number already registered by another user")
 		}
 	}
 
-	if params.Password == nil || *params.Password == "" {
-		password, err := password.Generate(64, 10, 0, false, true)
-		if err != nil {
-			return internalServerError("Error generating password").WithInternalError(err)
+	if params.ExternalID != nil {
+		if err := a.validateExternalID(ctx, instanceID, *params.ExternalID, uuid.Nil); err != nil {
+			if httpErr, ok := err.(*HTTPError); !ok || httpErr.Code == http.StatusInternalServerError {
+				return err
+			}
+			errs.addError("external_id", err)
 		}
-		params.Password = &password
+	}
+	if err := errs.toError(); err != nil {
+		return err
 	}
 
-	user, err := models.NewUser(instanceID, params.Phone, params.Email, *params.Password, aud, params.UserMetaData)
+	if params.Password != nil {
+		if err := a.checkLeakedPassword(r, config, *params.Password)(); err != nil {
+			return err
+		}
+	}
+
+	var user *models.User
+	if params.PasswordHash != nil {
+		user, err = models.NewUserWithPasswordHash(instanceID, params.Phone, params.Email, *params.PasswordHash, aud, params.UserMetaData)
+	} else {
+		if params.Password == nil || *params.Password == "" {
+			password, err := password.Generate(64, 10, 0, false, true)
+			if err != nil {
+				return internalServerError("Error generating password").WithInternalError(err)
+			}
+			params.Password = &password
+		}
+		user, err = models.NewUser(instanceID, params.Phone, params.Email, *params.Password, aud, params.UserMetaData)
+	}
 	if err != nil {
 		return internalServerError("Error creating user").WithInternalError(err)
 	}
@@ -260,17 +514,21 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 	}
 	user.AppMetaData["provider"] = "email"
 	user.AppMetaData["providers"] = []string{"email"}
+	if params.ExternalID != nil {
+		user.ExternalID = storage.NullString(*params.ExternalID)
+	}
 
 	if params.BanDuration != "" {
 		duration, terr := time.ParseDuration(params.BanDuration)
 		if terr != nil {
 			return badRequestError("Invalid format for ban_duration: %v", terr)
 		}
-		t := time.Now().Add(duration)
+		t := clock.Now().Add(duration)
 		user.BannedUntil = &t
+		user.BanReason = models.BanReasonAdmin
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserSignedUpAction, "", map[string]interface{}{
 			"user_id":    user.ID,
 			"user_email": user.Email,
@@ -312,6 +570,10 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 		}
 		return internalServerError("Database error creating new user").WithInternalError(err)
 	}
+	a.emitLifecycleEvent(ctx, UserCreatedEvent, user)
+	if user.IsConfirmed() || user.IsPhoneConfirmed() {
+		a.emitLifecycleEvent(ctx, UserConfirmedEvent, user)
+	}
 
 	return sendJSON(w, http.StatusOK, user)
 }
@@ -320,22 +582,156 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 func (a *API) adminUserDelete(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	user := getUser(ctx)
+	config := a.getConfig(ctx)
+
+	if user.IsOnLegalHold() {
+		return legalHoldError(user)
+	}
+	if config.Security.AdminApprovals.Enabled {
+		return a.requestAdminApproval(w, r, models.AdminActionUserDelete, user.ID, nil)
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		return a.deleteUser(r, tx, user)
+	})
+	if err != nil {
+		return err
+	}
+	a.emitLifecycleEvent(ctx, UserDeletedEvent, user)
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (a *API) deleteUser(r *http.Request, tx *storage.Connection, user *models.User) error {
+	ctx := r.Context()
 	instanceID := getInstanceID(ctx)
 	adminUser := getAdminUser(ctx)
 
-	err := a.db.Transaction(func(tx *storage.Connection) error {
-		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserDeletedAction, "", map[string]interface{}{
-			"user_id":    user.ID,
-			"user_email": user.Email,
-			"user_phone": user.Phone,
-		}); terr != nil {
-			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+	// the hold may have been placed while the deletion awaited approval
+	if user.IsOnLegalHold() {
+		return legalHoldError(user)
+	}
+	if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserDeletedAction, "", map[string]interface{}{
+		"user_id":    user.ID,
+		"user_email": user.Email,
+		"user_phone": user.Phone,
+	}); terr != nil {
+		return internalServerError("Error recording audit log entry").WithInternalError(terr)
+	}
+
+	if terr := tx.Destroy(user); terr != nil {
+		return internalServerError("Database error deleting user").WithInternalError(terr)
+	}
+	return nil
+}
+
+// adminUserAnonymize removes a user's personal data and signs them out
+func (a *API) adminUserAnonymize(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	config := a.getConfig(ctx)
+
+	if user.IsOnLegalHold() {
+		return legalHoldError(user)
+	}
+	if config.Security.AdminApprovals.Enabled {
+		return a.requestAdminApproval(w, r, models.AdminActionUserAnonymize, user.ID, nil)
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		return a.anonymizeUser(r, tx, user)
+	})
+	if err != nil {
+		return err
+	}
+	a.emitLifecycleEvent(ctx, UserUpdatedEvent, user)
+
+	return sendJSON(w, http.StatusOK, user)
+}
+
+func (a *API) anonymizeUser(r *http.Request, tx *storage.Connection, user *models.User) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	if user.IsOnLegalHold() {
+		return legalHoldError(user)
+	}
+	if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserAnonymizedAction, "", map[string]interface{}{
+		"user_id": user.ID,
+	}); terr != nil {
+		return internalServerError("Error recording audit log entry").WithInternalError(terr)
+	}
+
+	if terr := models.Logout(tx, instanceID, user.ID, models.SignOutReasonAdmin); terr != nil {
+		return internalServerError("Database error signing user out").WithInternalError(terr)
+	}
+	if terr := user.Anonymize(tx); terr != nil {
+		return internalServerError("Database error anonymizing user").WithInternalError(terr)
+	}
+	return nil
+}
+
+type adminUserRecoverParams struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// adminUserRecover sends a user a password recovery email that redirects to redirect_to
+func (a *API) adminUserRecover(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	user := getUser(ctx)
+
+	params := &adminUserRecoverParams{}
+	if r.Body != nil && r.Body != http.NoBody {
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			return badRequestError("Could not read params: %v", err)
 		}
+	}
 
-		if terr := tx.Destroy(user); terr != nil {
-			return internalServerError("Database error deleting user").WithInternalError(terr)
+	redirectTo := config.SiteURL
+	if params.RedirectTo != "" {
+		if !isRedirectURLValid(config, params.RedirectTo) {
+			return unprocessableEntityError("redirect_to is not allowed, it has to match the site URL or an entry of the URI allow list")
 		}
-		return nil
+		redirectTo = params.RedirectTo
+	}
+	if user.GetEmail() == "" {
+		return unprocessableEntityError("Password recovery requires the user to have an email")
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserRecoveryRequestedAction, "", map[string]interface{}{
+			"user_id":     user.ID,
+			"user_email":  user.Email,
+			"redirect_to": redirectTo,
+		}); terr != nil {
+			return terr
+		}
+		return a.sendPasswordRecovery(tx, user, a.Mailer(ctx), config.SMTP.MaxFrequencyFor(conf.RecoveryEmail), redirectTo, config.Mailer.OtpLength)
+	})
+	if err != nil {
+		if errors.Is(err, MaxFrequencyLimitError) {
+			return frequencyLimitedError(w, err)
+		}
+		return internalServerError("Error sending recovery email").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]string{})
+}
+
+// adminLogoutAll signs out every user of the instance by revoking all refresh tokens
+func (a *API) adminLogoutAll(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+
+	if config.Security.AdminApprovals.Enabled {
+		return a.requestAdminApproval(w, r, models.AdminActionLogoutAll, uuid.Nil, nil)
+	}
+
+	err := a.getDB(r.Context()).Transaction(func(tx *storage.Connection) error {
+		return a.logoutAllUsers(r, tx)
 	})
 	if err != nil {
 		return err
@@ -343,3 +739,18 @@ func (a *API) adminUserDelete(w http.ResponseWriter, r *http.Request) error {
 
 	return sendJSON(w, http.StatusOK, map[string]interface{}{})
 }
+
+func (a *API) logoutAllUsers(r *http.Request, tx *storage.Connection) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.AllUsersSignedOutAction, "", nil); terr != nil {
+		return internalServerError("Error recording audit log entry").WithInternalError(terr)
+	}
+
+	if terr := models.LogoutAll(tx, instanceID, models.SignOutReasonAdmin); terr != nil {
+		return internalServerError("Database error signing users out").WithInternalError(terr)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// adminIdentity returns the subject of the admin token, used to tell the requesting and approving admins apart.
+// Shared keys like the service_role key have no subject, so approvals need a token per admin.
+func adminIdentity(ctx context.Context) (string, error) {
+	claims := getClaims(ctx)
+	if claims == nil || claims.Subject == "" {
+		return "", forbiddenError("Admin approvals require a personal admin token with a sub claim, shared keys like the service_role key cannot request or approve actions")
+	}
+	return claims.Subject, nil
+}
+
+// requestAdminApproval records a pending admin action instead of performing it right away.
+func (a *API) requestAdminApproval(w http.ResponseWriter, r *http.Request, actionType models.AdminActionType, targetID uuid.UUID, params map[string]interface{}) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	requestedBy, err := adminIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	action, err := models.NewAdminAction(instanceID, actionType, targetID, params, requestedBy, config.Security.AdminApprovals.TTL)
+	if err != nil {
+		return internalServerError("Error creating admin action").WithInternalError(err)
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.AdminActionRequestedAction, "", map[string]interface{}{
+			"admin_action_id": action.ID,
+			"action":          action.Action,
+			"target_id":       action.TargetID,
+			"params":          action.Params,
+			"requested_by":    action.RequestedBy,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Create(action)
+	})
+	if err != nil {
+		return internalServerError("Database error creating admin action").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusAccepted, action)
+}
+
+func (a *API) loadAdminAction(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	actionID, err := uuid.FromString(chi.URLParam(r, "action_id"))
+	if err != nil {
+		return nil, badRequestError("action_id must be an UUID")
+	}
+
+	logger.LogEntrySetField(r, "admin_action_id", actionID)
+	instanceID := getInstanceID(r.Context())
+
+	action, err := models.FindAdminAction(a.getDB(r.Context()), instanceID, actionID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Admin action not found")
+		}
+		return nil, internalServerError("Database error loading admin action").WithInternalError(err)
+	}
+
+	return withAdminAction(r.Context(), action), nil
+}
+
+// adminActions responds with the admin actions awaiting approval
+func (a *API) adminActions(w http.ResponseWriter, r *http.Request) error {
+	instanceID := getInstanceID(r.Context())
+
+	actions, err := models.FindPendingAdminActions(a.getDB(r.Context()), instanceID)
+	if err != nil {
+		return internalServerError("Database error finding admin actions").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"actions": actions,
+	})
+}
+
+// adminActionApprove performs a pending admin action once a different admin approves it
+func (a *API) adminActionApprove(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	action := getAdminAction(ctx)
+
+	approvedBy, err := adminIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !action.IsPending() {
+		return unprocessableEntityError("Admin action has already been approved or has expired")
+	}
+	if action.RequestedBy == approvedBy {
+		return forbiddenError("Admin action must be approved by a different admin")
+	}
+
+	var target *models.User
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		approved, terr := action.Approve(tx, approvedBy)
+		if terr != nil {
+			return internalServerError("Database error approving admin action").WithInternalError(terr)
+		}
+		if !approved {
+			return unprocessableEntityError("Admin action has already been approved or has expired")
+		}
+
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.AdminActionApprovedAction, "", map[string]interface{}{
+			"admin_action_id": action.ID,
+			"action":          action.Action,
+			"target_id":       action.TargetID,
+			"requested_by":    action.RequestedBy,
+			"approved_by":     approvedBy,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+
+		target, terr = a.performAdminAction(r, tx, action)
+		return terr
+	})
+	if err != nil {
+		return err
+	}
+	switch action.Action {
+	case models.AdminActionUserDelete:
+		a.emitLifecycleEvent(ctx, UserDeletedEvent, target)
+	case models.AdminActionUserAnonymize:
+		a.emitLifecycleEvent(ctx, UserUpdatedEvent, target)
+	}
+
+	return sendJSON(w, http.StatusOK, action)
+}
+
+// performAdminAction carries out an approved admin action and returns the
+// user it targeted, if any
+func (a *API) performAdminAction(r *http.Request, tx *storage.Connection, action *models.AdminAction) (*models.User, error) {
+	if action.Action == models.AdminActionLogoutAll {
+		return nil, a.logoutAllUsers(r, tx)
+	}
+
+	user, err := models.FindUserByInstanceIDAndID(tx, getInstanceID(r.Context()), action.TargetID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("User not found")
+		}
+		return nil, internalServerError("Database error loading user").WithInternalError(err)
+	}
+
+	switch action.Action {
+	case models.AdminActionUserDelete:
+		return user, a.deleteUser(r, tx, user)
+	case models.AdminActionUserAnonymize:
+		return user, a.anonymizeUser(r, tx, user)
+	case models.AdminActionUserMerge:
+		params := &adminUserMergeParams{}
+		if err := params.fromAdminAction(action); err != nil {
+			return nil, internalServerError("Invalid params for admin action").WithInternalError(err)
+		}
+		return user, a.mergeUsers(r, tx, user, params)
+	default:
+		return nil, internalServerError("Unsupported admin action %q", action.Action)
+	}
+}
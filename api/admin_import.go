@@ -0,0 +1,258 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const (
+	defaultImportBatchSize = 500
+	maxImportBatchSize     = 5000
+)
+
+// adminImportUser is a user migrated from another auth provider.
+type adminImportUser struct {
+	Email          string                 `json:"email"`
+	Phone          string                 `json:"phone"`
+	PasswordHash   string                 `json:"password_hash"`
+	EmailConfirmed bool                   `json:"email_confirmed"`
+	PhoneConfirmed bool                   `json:"phone_confirmed"`
+	Role           string                 `json:"role"`
+	UserMetaData   map[string]interface{} `json:"user_metadata"`
+	AppMetaData    map[string]interface{} `json:"app_metadata"`
+}
+
+type adminImportParams struct {
+	Users []adminImportUser `json:"users"`
+}
+
+// adminImportFailure is a user that wasn't imported, by its row in the payload.
+type adminImportFailure struct {
+	Row   int    `json:"row"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	Error string `json:"error"`
+}
+
+type adminImportResponse struct {
+	Imported int                  `json:"imported"`
+	Failed   []adminImportFailure `json:"failed"`
+}
+
+// adminUserImport creates users in bulk from a JSON or CSV payload, keeping
+// their bcrypt, argon2 or scrypt password hashes. The users are created in
+// batches, each in a single transaction. Users that are invalid or already
+// registered are skipped and reported, the others are imported.
+func (a *API) adminUserImport(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	aud := a.requestAud(ctx, r)
+
+	batchSize := defaultImportBatchSize
+	if value := r.URL.Query().Get("batch_size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 || size > maxImportBatchSize {
+			return badRequestError("batch_size must be a number between 1 and %d", maxImportBatchSize)
+		}
+		batchSize = size
+	}
+
+	users, err := readImportUsers(r)
+	if err != nil {
+		return err
+	}
+
+	rsp := &adminImportResponse{Failed: []adminImportFailure{}}
+	seen := map[string]bool{}
+	for start := 0; start < len(users); start += batchSize {
+		end := start + batchSize
+		if end > len(users) {
+			end = len(users)
+		}
+
+		imported := 0
+		err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+			imported = 0
+			for i := start; i < end; i++ {
+				user, failure, terr := a.importUser(tx, r, &users[i], aud, seen)
+				if terr != nil {
+					return terr
+				}
+				if failure != "" {
+					rsp.Failed = append(rsp.Failed, adminImportFailure{Row: i + 1, Email: users[i].Email, Phone: users[i].Phone, Error: failure})
+					continue
+				}
+				if terr := tx.Create(user); terr != nil {
+					return terr
+				}
+				imported++
+			}
+			return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UsersImportedAction, "", map[string]interface{}{
+				"count": imported,
+			})
+		})
+		if err != nil {
+			return internalServerError("Database error importing users %d to %d, %d were imported before", start+1, end, rsp.Imported).WithInternalError(err)
+		}
+		rsp.Imported += imported
+	}
+
+	return sendJSON(w, http.StatusOK, rsp)
+}
+
+// importUser validates an imported user, returning why it can't be imported
+// when it's invalid or already registered.
+func (a *API) importUser(tx *storage.Connection, r *http.Request, params *adminImportUser, aud string, seen map[string]bool) (*models.User, string, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if params.Email == "" && params.Phone == "" {
+		return nil, "Cannot import a user without either an email or phone", nil
+	}
+	if params.Email != "" {
+		if err := a.validateEmail(ctx, params.Email); err != nil {
+			return nil, err.(*HTTPError).Message, nil
+		}
+		key := "email:" + strings.ToLower(params.Email)
+		if seen[key] {
+			return nil, "Email address is imported twice", nil
+		}
+		seen[key] = true
+		if exists, err := models.IsDuplicatedEmail(tx, instanceID, params.Email, aud); err != nil {
+			return nil, "", err
+		} else if exists {
+			return nil, "Email address already registered by another user", nil
+		}
+	}
+	if params.Phone != "" {
+		phone, err := a.validatePhone(params.Phone)
+		if err != nil {
+			return nil, err.(*HTTPError).Message, nil
+		}
+		params.Phone = phone
+		key := "phone:" + phone
+		if seen[key] {
+			return nil, "Phone number is imported twice", nil
+		}
+		seen[key] = true
+		if exists, err := models.IsDuplicatedPhone(tx, instanceID, phone, aud); err != nil {
+			return nil, "", err
+		} else if exists {
+			return nil, "Phone number already registered by another user", nil
+		}
+	}
+
+	user, err := models.NewUserWithPasswordHash(instanceID, params.Phone, params.Email, params.PasswordHash, aud, params.UserMetaData)
+	if err != nil {
+		return nil, err.Error(), nil
+	}
+	user.AppMetaData = params.AppMetaData
+	if user.AppMetaData == nil {
+		user.AppMetaData = make(map[string]interface{})
+	}
+	user.AppMetaData["provider"] = "email"
+	user.AppMetaData["providers"] = []string{"email"}
+
+	user.Role = config.JWT.DefaultGroupName
+	if params.Role != "" {
+		user.Role = params.Role
+	}
+	now := time.Now()
+	if params.EmailConfirmed && params.Email != "" {
+		user.EmailConfirmedAt = &now
+	}
+	if params.PhoneConfirmed && params.Phone != "" {
+		user.PhoneConfirmedAt = &now
+	}
+	return user, "", nil
+}
+
+// readImportUsers reads the users of a JSON payload, or of a CSV payload
+// with a header naming the columns.
+func readImportUsers(r *http.Request) ([]adminImportUser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		params := &adminImportParams{}
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			return nil, badRequestError("Could not read users to import: %v", err)
+		}
+		return params.Users, nil
+	}
+
+	reader := csv.NewReader(r.Body)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, badRequestError("Could not read the CSV header: %v", err)
+	}
+	users := []adminImportUser{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return users, nil
+		}
+		if err != nil {
+			return nil, badRequestError("Could not read CSV row %d: %v", row, err)
+		}
+		user := adminImportUser{}
+		for i, column := range header {
+			if err := setImportColumn(&user, column, record[i]); err != nil {
+				return nil, badRequestError("Invalid CSV row %d: %v", row, err)
+			}
+		}
+		users = append(users, user)
+	}
+}
+
+func setImportColumn(user *adminImportUser, column, value string) error {
+	var err error
+	switch column {
+	case "email":
+		user.Email = value
+	case "phone":
+		user.Phone = value
+	case "password_hash":
+		user.PasswordHash = value
+	case "role":
+		user.Role = value
+	case "email_confirmed":
+		user.EmailConfirmed, err = parseImportBool(value)
+	case "phone_confirmed":
+		user.PhoneConfirmed, err = parseImportBool(value)
+	case "user_metadata":
+		err = parseImportMetadata(value, &user.UserMetaData)
+	case "app_metadata":
+		err = parseImportMetadata(value, &user.AppMetaData)
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", column, err)
+	}
+	return nil
+}
+
+func parseImportBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func parseImportMetadata(value string, metadata *map[string]interface{}) error {
+	if value == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value), metadata)
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/netlify/gotrue/storage"
+)
+
+type adminMigrationsResponse struct {
+	*storage.MigrationStatus
+	UpToDate bool   `json:"up_to_date"`
+	Version  string `json:"version"`
+}
+
+// adminMigrations reports the applied and pending migrations, to check that
+// a deploy runs against the schema it was released with.
+func (a *API) adminMigrations(w http.ResponseWriter, r *http.Request) error {
+	status, err := storage.GetMigrationStatus(a.getDB(r.Context()), a.config.DB.MigrationsPath)
+	if err != nil {
+		return internalServerError("Error reading migration status").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, &adminMigrationsResponse{
+		MigrationStatus: status,
+		UpToDate:        status.UpToDate(),
+		Version:         a.version,
+	})
+}
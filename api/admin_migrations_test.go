@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *AdminTestSuite) TestAdminMigrations() {
+	migrationsPath := ts.API.config.DB.MigrationsPath
+	ts.API.config.DB.MigrationsPath = "../migrations"
+	defer func() { ts.API.config.DB.MigrationsPath = migrationsPath }()
+
+	files, err := ioutil.ReadDir("../migrations")
+	require.NoError(ts.T(), err)
+	latest := strings.SplitN(files[len(files)-1].Name(), "_", 2)[0]
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/migrations", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	status := adminMigrationsResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&status))
+	assert.True(ts.T(), status.UpToDate)
+	assert.Empty(ts.T(), status.Pending)
+	assert.Equal(ts.T(), latest, status.LatestVersion)
+	assert.Equal(ts.T(), latest, status.DatabaseVersion)
+}
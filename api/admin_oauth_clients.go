@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+type adminOAuthClientParams struct {
+	Name                    string                 `json:"name"`
+	RedirectURIs            []string               `json:"redirect_uris"`
+	Scopes                  []string               `json:"scopes"`
+	Public                  bool                   `json:"public"`
+	TokenEndpointAuthMethod string                 `json:"token_endpoint_auth_method"`
+	JWKS                    map[string]interface{} `json:"jwks"`
+	TLSClientAuthSubjectDN  string                 `json:"tls_client_auth_subject_dn"`
+	RegenerateSecret        bool                   `json:"regenerate_secret"`
+}
+
+// adminOAuthClientResponse includes the client secret, which is only returned when it is generated
+type adminOAuthClientResponse struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (a *API) loadOAuthClient(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	clientID, err := uuid.FromString(chi.URLParam(r, "client_id"))
+	if err != nil {
+		return nil, badRequestError("client_id must be an UUID")
+	}
+
+	logger.LogEntrySetField(r, "oauth_client_id", clientID)
+	instanceID := getInstanceID(r.Context())
+
+	client, err := models.FindOAuthClient(a.getDB(r.Context()), instanceID, clientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("OAuth client not found")
+		}
+		return nil, internalServerError("Database error loading OAuth client").WithInternalError(err)
+	}
+
+	return withOAuthClient(r.Context(), client), nil
+}
+
+func (a *API) getAdminOAuthClientParams(r *http.Request) (*adminOAuthClientParams, error) {
+	params := adminOAuthClientParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return nil, badRequestError("Could not decode OAuth client params: %v", err)
+	}
+	return &params, nil
+}
+
+// validateRedirectURIs checks that redirect URIs are absolute and carry no fragment, as required by RFC 6749 section 3.1.2.
+func validateRedirectURIs(uris []string) error {
+	if len(uris) == 0 {
+		return unprocessableEntityError("At least one redirect URI is required")
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" || u.Fragment != "" {
+			return unprocessableEntityError("Invalid redirect URI %q", uri)
+		}
+	}
+	return nil
+}
+
+func validateOAuthScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !isStringInSlice(scope, oauthSupportedScopes) {
+			return unprocessableEntityError("Unsupported scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// adminOAuthClients responds with the OAuth clients of the instance
+func (a *API) adminOAuthClients(w http.ResponseWriter, r *http.Request) error {
+	instanceID := getInstanceID(r.Context())
+
+	clients, err := models.FindOAuthClients(a.getDB(r.Context()), instanceID)
+	if err != nil {
+		return internalServerError("Database error finding OAuth clients").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"clients": clients,
+	})
+}
+
+// adminOAuthClientCreate registers a new OAuth client
+func (a *API) adminOAuthClientCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params, err := a.getAdminOAuthClientParams(r)
+	if err != nil {
+		return err
+	}
+	if params.Name == "" {
+		return unprocessableEntityError("OAuth clients require a name")
+	}
+	if err := validateRedirectURIs(params.RedirectURIs); err != nil {
+		return err
+	}
+	if len(params.Scopes) == 0 {
+		params.Scopes = []string{"openid", "email"}
+	}
+	if err := validateOAuthScopes(params.Scopes); err != nil {
+		return err
+	}
+
+	authMethod := params.TokenEndpointAuthMethod
+	if authMethod == "" {
+		authMethod = models.TokenEndpointAuthClientSecretBasic
+		if params.Public {
+			authMethod = models.TokenEndpointAuthNone
+		}
+	}
+	if err := validateClientAuthMethod(config, authMethod, params.JWKS, params.TLSClientAuthSubjectDN); err != nil {
+		return unprocessableEntityError(err.Error())
+	}
+
+	client, secret, err := models.NewOAuthClient(instanceID, params.Name, params.RedirectURIs, params.Scopes, authMethod)
+	if err != nil {
+		return internalServerError("Error creating OAuth client").WithInternalError(err)
+	}
+	client.JWKS = params.JWKS
+	client.TLSClientAuthSubjectDN = storage.NullString(params.TLSClientAuthSubjectDN)
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.OAuthClientCreatedAction, "", map[string]interface{}{
+			"client_id": client.ID,
+			"name":      client.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Create(client)
+	})
+	if err != nil {
+		return internalServerError("Database error creating OAuth client").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &adminOAuthClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+// adminOAuthClientGet returns a single OAuth client
+func (a *API) adminOAuthClientGet(w http.ResponseWriter, r *http.Request) error {
+	return sendJSON(w, http.StatusOK, getOAuthClient(r.Context()))
+}
+
+// adminOAuthClientUpdate updates the name, redirect URIs, scopes or keys of an OAuth client, and optionally rotates its secret
+func (a *API) adminOAuthClientUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	client := getOAuthClient(ctx)
+
+	params, err := a.getAdminOAuthClientParams(r)
+	if err != nil {
+		return err
+	}
+
+	if params.Name != "" {
+		client.Name = params.Name
+	}
+	if params.RedirectURIs != nil {
+		if err := validateRedirectURIs(params.RedirectURIs); err != nil {
+			return err
+		}
+		client.RedirectURIs = params.RedirectURIs
+	}
+	if params.Scopes != nil {
+		if err := validateOAuthScopes(params.Scopes); err != nil {
+			return err
+		}
+		client.Scopes = params.Scopes
+	}
+	if params.JWKS != nil {
+		client.JWKS = params.JWKS
+	}
+	if params.TLSClientAuthSubjectDN != "" {
+		client.TLSClientAuthSubjectDN = storage.NullString(params.TLSClientAuthSubjectDN)
+	}
+	if params.JWKS != nil || params.TLSClientAuthSubjectDN != "" {
+		if err := validateClientAuthMethod(config, client.AuthMethod(), client.JWKS, string(client.TLSClientAuthSubjectDN)); err != nil {
+			return unprocessableEntityError(err.Error())
+		}
+	}
+	if params.RegenerateSecret && !client.UsesSecret() {
+		return unprocessableEntityError("Only clients authenticating with a client secret have one")
+	}
+
+	var secret string
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := tx.UpdateOnly(client, "name", "redirect_uris", "scopes", "jwks", "tls_client_auth_subject_dn", "updated_at"); terr != nil {
+			return terr
+		}
+		if params.RegenerateSecret {
+			var terr error
+			if secret, terr = client.RegenerateSecret(tx); terr != nil {
+				return terr
+			}
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.OAuthClientUpdatedAction, "", map[string]interface{}{
+			"client_id":          client.ID,
+			"secret_regenerated": params.RegenerateSecret,
+		})
+	})
+	if err != nil {
+		return internalServerError("Database error updating OAuth client").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &adminOAuthClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+// adminOAuthClientDelete removes an OAuth client along with its pending authorizations
+func (a *API) adminOAuthClientDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	client := getOAuthClient(ctx)
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.OAuthClientDeletedAction, "", map[string]interface{}{
+			"client_id": client.ID,
+			"name":      client.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Destroy(client)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting OAuth client").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+)
+
+// refreshTokenFamilyMember describes a refresh token of a family without the
+// token itself.
+type refreshTokenFamilyMember struct {
+	ID        int64      `json:"id"`
+	ParentID  *int64     `json:"parent_id"`
+	Revoked   bool       `json:"revoked"`
+	ReusedAt  *time.Time `json:"reused_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RefreshTokenFamily is the rotation chain of a refresh token, to investigate
+// sign-outs after a reuse was detected.
+type RefreshTokenFamily struct {
+	UserID        uuid.UUID                   `json:"user_id"`
+	SessionID     *uuid.UUID                  `json:"session_id"`
+	Session       *models.Session             `json:"session"`
+	ReusedTokenID *int64                      `json:"reused_token_id"`
+	Tokens        []*refreshTokenFamilyMember `json:"tokens"`
+}
+
+// adminRefreshTokenFamily responds with the family of a refresh token: the
+// tokens swapped for each other since the sign-in, which of them was reused
+// and the session they belong to, if it wasn't revoked.
+func (a *API) adminRefreshTokenFamily(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "token_id"), 10, 64)
+	if err != nil {
+		return badRequestError("token_id must be a number")
+	}
+	token, err := models.FindRefreshTokenByID(a.getDB(ctx), instanceID, tokenID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("Refresh token not found")
+		}
+		return internalServerError("Database error finding refresh token").WithInternalError(err)
+	}
+
+	tokens, err := models.FindRefreshTokenFamily(a.getDB(ctx), token)
+	if err != nil {
+		return internalServerError("Database error finding refresh token family").WithInternalError(err)
+	}
+
+	family := &RefreshTokenFamily{UserID: token.UserID, Tokens: []*refreshTokenFamilyMember{}}
+	if token.SessionID.Valid {
+		family.SessionID = &token.SessionID.UUID
+		session, err := models.FindSessionByID(a.getDB(ctx), instanceID, token.UserID, token.SessionID.UUID)
+		if err != nil && !models.IsNotFoundError(err) {
+			return internalServerError("Database error finding session").WithInternalError(err)
+		}
+		family.Session = session
+	}
+
+	ids := map[string]int64{}
+	for _, t := range tokens {
+		ids[t.Token] = t.ID
+		member := &refreshTokenFamilyMember{
+			ID:        t.ID,
+			Revoked:   t.Revoked,
+			ReusedAt:  t.ReusedAt,
+			CreatedAt: t.CreatedAt,
+			UpdatedAt: t.UpdatedAt,
+		}
+		if parentID, ok := ids[string(t.Parent)]; ok {
+			member.ParentID = &parentID
+		}
+		if t.ReusedAt != nil && family.ReusedTokenID == nil {
+			family.ReusedTokenID = &member.ID
+		}
+		family.Tokens = append(family.Tokens, member)
+	}
+
+	return sendJSON(w, http.StatusOK, family)
+}
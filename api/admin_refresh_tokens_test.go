@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *AdminTestSuite) TestAdminRefreshTokenFamily() {
+	u, err := models.NewUser(ts.instanceID, "", "family@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	first, err := models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
+	require.NoError(ts.T(), err)
+	second, err := models.GrantRefreshTokenSwap(&http.Request{}, ts.API.db, u, first)
+	require.NoError(ts.T(), err)
+	third, err := models.GrantRefreshTokenSwap(&http.Request{}, ts.API.db, u, second)
+	require.NoError(ts.T(), err)
+
+	// reusing the first token revokes the family
+	ts.Config.Security.RefreshTokenRotationEnabled = true
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"refresh_token": first.Token,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/token?grant_type=refresh_token", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/refresh_tokens/%d/family", third.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(ts.T(), w.Body.String(), third.Token)
+
+	family := RefreshTokenFamily{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&family))
+	assert.Equal(ts.T(), u.ID, family.UserID)
+	assert.Equal(ts.T(), first.SessionID.UUID, *family.SessionID)
+	require.NotNil(ts.T(), family.ReusedTokenID)
+	assert.Equal(ts.T(), first.ID, *family.ReusedTokenID)
+	require.Len(ts.T(), family.Tokens, 3)
+	assert.Nil(ts.T(), family.Tokens[0].ParentID)
+	assert.Equal(ts.T(), second.ID, *family.Tokens[2].ParentID)
+	for _, token := range family.Tokens {
+		assert.True(ts.T(), token.Revoked)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/refresh_tokens/0/family", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+type adminUserRolesParams struct {
+	Roles []string `json:"roles"`
+}
+
+// validateRoles checks the role names, which end up in the roles claim of
+// the user's access tokens.
+func validateRoles(roles []string) error {
+	if len(roles) == 0 {
+		return unprocessableEntityError("At least one role is required")
+	}
+	for _, role := range roles {
+		if role == "" || strings.TrimSpace(role) != role || len(role) > 255 {
+			return unprocessableEntityError("Invalid role %q", role)
+		}
+	}
+	return nil
+}
+
+// adminUserRolesGrant grants roles to a user on top of the user's role.
+func (a *API) adminUserRolesGrant(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	adminUser := getAdminUser(ctx)
+	instanceID := getInstanceID(ctx)
+
+	params := &adminUserRolesParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read roles: %v", err)
+	}
+	if err := validateRoles(params.Roles); err != nil {
+		return err
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := user.GrantRoles(tx, params.Roles); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserRolesGrantedAction, "", map[string]interface{}{
+			"user_id":    user.ID,
+			"user_email": user.Email,
+			"roles":      params.Roles,
+		})
+	})
+	if err != nil {
+		return internalServerError("Error granting roles").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, user)
+}
+
+// adminUserRoleRevoke revokes a role granted to a user. The user's role
+// itself can only be replaced, with the user update.
+func (a *API) adminUserRoleRevoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	adminUser := getAdminUser(ctx)
+	instanceID := getInstanceID(ctx)
+
+	role := chi.URLParam(r, "role")
+	if err := validateRoles([]string{role}); err != nil {
+		return err
+	}
+	if role == user.Role {
+		return unprocessableEntityError("Cannot revoke the user's role %q, set another role instead", role)
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := user.RevokeRoles(tx, []string{role}); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserRolesRevokedAction, "", map[string]interface{}{
+			"user_id":    user.ID,
+			"user_email": user.Email,
+			"roles":      []string{role},
+		})
+	})
+	if err != nil {
+		return internalServerError("Error revoking role").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, user)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// adminUserSessions lists the active sessions of a user, most recently used
+// first.
+func (a *API) adminUserSessions(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r.Context())
+
+	sessions, err := models.FindActiveSessions(a.getDB(r.Context()), user)
+	if err != nil {
+		return internalServerError("Database error finding sessions").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// adminUserSessionsRevoke signs a user out of all their sessions, so a
+// compromised account is locked out right away.
+func (a *API) adminUserSessionsRevoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	user := getUser(ctx)
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UserSignedOutAction, "", map[string]interface{}{
+			"user_id":    user.ID,
+			"user_email": user.Email,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		if terr := models.Logout(tx, instanceID, user.ID, models.SignOutReasonAdmin); terr != nil {
+			return internalServerError("Database error signing user out").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// adminUserSessionRevoke signs a user out of one of their sessions.
+func (a *API) adminUserSessionRevoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	user := getUser(ctx)
+
+	sessionID, err := uuid.FromString(chi.URLParam(r, "session_id"))
+	if err != nil {
+		return badRequestError("session_id must be a UUID")
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		session, terr := models.FindSessionByID(tx, instanceID, user.ID, sessionID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return notFoundError(terr.Error())
+			}
+			return internalServerError("Database error finding session").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.SessionRevokedAction, "", map[string]interface{}{
+			"user_id":    user.ID,
+			"user_email": user.Email,
+			"session_id": session.ID,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		if terr := session.Revoke(tx, models.SignOutReasonAdmin); terr != nil {
+			return internalServerError("Database error revoking session").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+)
+
+// FullSettings is the effective configuration, with secrets redacted and the
+// source of every setting.
+type FullSettings struct {
+	Env               string         `json:"env"`
+	MultiInstanceMode bool           `json:"multi_instance_mode"`
+	Global            []conf.Setting `json:"global,omitempty"`
+	Instance          []conf.Setting `json:"instance"`
+}
+
+// adminSettingsFull responds with the effective configuration of the
+// instance. The global configuration is left out in multi-instance mode,
+// where it is the operator's.
+func (a *API) adminSettingsFull(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	settings := &FullSettings{
+		Env:               a.config.Env,
+		MultiInstanceMode: a.config.MultiInstanceMode,
+	}
+	if a.config.MultiInstanceMode {
+		instance, err := models.GetInstance(a.getDB(ctx), getInstanceID(ctx))
+		if err != nil {
+			return internalServerError("Database error loading instance").WithInternalError(err)
+		}
+		settings.Instance = conf.DescribeInstance(config, instance.BaseConfig, a.config.Env)
+	} else {
+		settings.Global = conf.DescribeGlobal(a.config)
+		settings.Instance = conf.DescribeInstance(config, nil, a.config.Env)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return sendJSON(w, http.StatusOK, settings)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminSettingsFull(t *testing.T) {
+	config := &conf.Configuration{SiteURL: "https://example.com"}
+	config.Mailer.Autoconfirm = true
+	config.SMTP.Pass = "password"
+	api := &API{config: &conf.GlobalConfiguration{Env: conf.EnvDevelopment, OperatorToken: "token"}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/admin/settings/full", nil)
+	req = req.WithContext(withConfig(req.Context(), config))
+	w := httptest.NewRecorder()
+	require.NoError(t, api.adminSettingsFull(w, req))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	settings := FullSettings{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&settings))
+	assert.Equal(t, conf.EnvDevelopment, settings.Env)
+
+	values := map[string]conf.Setting{}
+	for _, s := range append(settings.Global, settings.Instance...) {
+		values[s.Key] = s
+	}
+	assert.Equal(t, conf.Redacted, values["GOTRUE_OPERATOR_TOKEN"].Value)
+	assert.Equal(t, conf.Redacted, values["GOTRUE_SMTP_PASS"].Value)
+	assert.Equal(t, true, values["GOTRUE_MAILER_AUTOCONFIRM"].Value)
+	assert.Equal(t, conf.SourceProfile, values["GOTRUE_MAILER_AUTOCONFIRM"].Source)
+}
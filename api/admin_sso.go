@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+type adminSSOProviderParams struct {
+	Type             string                 `json:"type"`
+	Name             string                 `json:"name"`
+	MetadataXML      string                 `json:"metadata_xml"`
+	MetadataURL      string                 `json:"metadata_url"`
+	Issuer           string                 `json:"issuer"`
+	ClientID         string                 `json:"client_id"`
+	ClientSecret     string                 `json:"client_secret"`
+	AttributeMapping map[string]interface{} `json:"attribute_mapping"`
+	Domains          []string               `json:"domains"`
+}
+
+func (a *API) loadSSOProvider(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	providerID, err := uuid.FromString(chi.URLParam(r, "sso_provider_id"))
+	if err != nil {
+		return nil, badRequestError("sso_provider_id must be an UUID")
+	}
+
+	logger.LogEntrySetField(r, "sso_provider_id", providerID)
+	instanceID := getInstanceID(r.Context())
+
+	p, err := models.FindSSOProvider(a.getDB(r.Context()), instanceID, providerID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("SSO provider not found")
+		}
+		return nil, internalServerError("Database error loading SSO provider").WithInternalError(err)
+	}
+
+	return withSSOProvider(r.Context(), p), nil
+}
+
+func (a *API) getAdminSSOProviderParams(r *http.Request) (*adminSSOProviderParams, error) {
+	params := adminSSOProviderParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return nil, badRequestError("Could not decode SSO provider params: %v", err)
+	}
+	return &params, nil
+}
+
+// applySSOProviderParams sets the fields of p that are set in params and
+// checks that the identity provider can be signed in with.
+func applySSOProviderParams(p *models.SSOProvider, params *adminSSOProviderParams) error {
+	if params.Name != "" {
+		p.Name = params.Name
+	}
+	if params.AttributeMapping != nil {
+		for claim, attribute := range params.AttributeMapping {
+			if _, ok := attribute.(string); !ok {
+				return unprocessableEntityError("Attribute mapping of %s must be the name of an attribute", claim)
+			}
+		}
+		p.AttributeMapping = models.JSONMap(params.AttributeMapping)
+	}
+
+	switch p.Type {
+	case models.SSOProviderTypeSAML:
+		if params.Issuer != "" || params.ClientID != "" || params.ClientSecret != "" {
+			return unprocessableEntityError("SAML providers are configured with metadata_xml or metadata_url")
+		}
+		if params.MetadataXML != "" && params.MetadataURL != "" {
+			return unprocessableEntityError("Only one of metadata_xml and metadata_url can be set")
+		}
+		if params.MetadataXML != "" {
+			meta, err := provider.ParseSamlMetadata([]byte(params.MetadataXML))
+			if err != nil {
+				return unprocessableEntityError("Invalid SAML metadata: %v", err)
+			}
+			p.MetadataXML = params.MetadataXML
+			p.MetadataURL = ""
+			p.EntityID = meta.EntityID
+		} else if params.MetadataURL != "" {
+			if u, err := url.ParseRequestURI(params.MetadataURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return unprocessableEntityError("metadata_url must be an HTTP(S) URL")
+			}
+			meta, err := provider.FetchSamlMetadata(params.MetadataURL)
+			if err != nil {
+				return unprocessableEntityError("Fetching SAML metadata failed: %v", err)
+			}
+			p.MetadataXML = ""
+			p.MetadataURL = params.MetadataURL
+			p.EntityID = meta.EntityID
+		}
+		if p.MetadataXML == "" && p.MetadataURL == "" {
+			return unprocessableEntityError("SAML providers require metadata_xml or metadata_url")
+		}
+	case models.SSOProviderTypeOIDC:
+		if params.MetadataXML != "" || params.MetadataURL != "" {
+			return unprocessableEntityError("OIDC providers are configured with issuer, client_id and client_secret")
+		}
+		if params.ClientID != "" {
+			p.ClientID = params.ClientID
+		}
+		if params.ClientSecret != "" {
+			p.ClientSecret = params.ClientSecret
+		}
+		if params.Issuer != "" {
+			if _, err := provider.OIDCProvider(params.Issuer); err != nil {
+				return unprocessableEntityError("Discovering OIDC provider failed: %v", err)
+			}
+			p.Issuer = params.Issuer
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return unprocessableEntityError("OIDC providers require issuer and client_id")
+		}
+	default:
+		return unprocessableEntityError("SSO provider type must be %q or %q", models.SSOProviderTypeSAML, models.SSOProviderTypeOIDC)
+	}
+
+	if p.Name == "" {
+		return unprocessableEntityError("SSO providers require a name")
+	}
+	return nil
+}
+
+// normalizeSSODomains lowercases the email domains and checks that they are
+// host names.
+func normalizeSSODomains(domains []string) ([]string, error) {
+	normalized := make([]string, 0, len(domains))
+	seen := map[string]bool{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@/: ") {
+			return nil, unprocessableEntityError("%q is not a valid email domain", domain)
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized, nil
+}
+
+// setSSODomains maps the domains to p, unless they are mapped to another
+// provider already.
+func setSSODomains(tx *storage.Connection, p *models.SSOProvider, domains []string) error {
+	for _, domain := range domains {
+		other, err := models.FindSSOProviderByDomain(tx, p.InstanceID, domain)
+		if err != nil && !models.IsNotFoundError(err) {
+			return internalServerError("Database error finding SSO domain").WithInternalError(err)
+		}
+		if other != nil && other.ID != p.ID {
+			return unprocessableEntityError("Domain %s is already mapped to another SSO provider", domain)
+		}
+	}
+	if err := p.SetDomains(tx, domains); err != nil {
+		return internalServerError("Database error mapping SSO domains").WithInternalError(err)
+	}
+	return nil
+}
+
+// adminSSOProviders responds with the SSO providers of the instance
+func (a *API) adminSSOProviders(w http.ResponseWriter, r *http.Request) error {
+	instanceID := getInstanceID(r.Context())
+
+	providers, err := models.FindSSOProviders(a.getDB(r.Context()), instanceID)
+	if err != nil {
+		return internalServerError("Database error finding SSO providers").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"providers": providers,
+	})
+}
+
+// adminSSOProviderCreate adds a SAML or OIDC provider
+func (a *API) adminSSOProviderCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params, err := a.getAdminSSOProviderParams(r)
+	if err != nil {
+		return err
+	}
+	domains, err := normalizeSSODomains(params.Domains)
+	if err != nil {
+		return err
+	}
+
+	p, err := models.NewSSOProvider(instanceID, params.Type, params.Name)
+	if err != nil {
+		return internalServerError("Error creating SSO provider").WithInternalError(err)
+	}
+	if err := applySSOProviderParams(p, params); err != nil {
+		return err
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(p); terr != nil {
+			return internalServerError("Database error creating SSO provider").WithInternalError(terr)
+		}
+		if terr := setSSODomains(tx, p, domains); terr != nil {
+			return terr
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.SSOProviderCreatedAction, "", map[string]interface{}{
+			"sso_provider_id": p.ID,
+			"type":            p.Type,
+			"name":            p.Name,
+			"domains":         p.DomainNames(),
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusCreated, p)
+}
+
+// adminSSOProviderGet returns a single SSO provider
+func (a *API) adminSSOProviderGet(w http.ResponseWriter, r *http.Request) error {
+	return sendJSON(w, http.StatusOK, getSSOProvider(r.Context()))
+}
+
+// adminSSOProviderUpdate updates an SSO provider. Fields that are not set are
+// left as is, domains replace the domains mapped to the provider.
+func (a *API) adminSSOProviderUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	p := getSSOProvider(ctx)
+
+	params, err := a.getAdminSSOProviderParams(r)
+	if err != nil {
+		return err
+	}
+	if params.Type != "" && params.Type != p.Type {
+		return unprocessableEntityError("The type of an SSO provider can not be changed")
+	}
+	var domains []string
+	if params.Domains != nil {
+		if domains, err = normalizeSSODomains(params.Domains); err != nil {
+			return err
+		}
+	}
+	if err := applySSOProviderParams(p, params); err != nil {
+		return err
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := tx.UpdateOnly(p, "name", "metadata_xml", "metadata_url", "entity_id", "issuer", "client_id", "client_secret", "attribute_mapping", "updated_at"); terr != nil {
+			return internalServerError("Database error updating SSO provider").WithInternalError(terr)
+		}
+		if params.Domains != nil {
+			if terr := setSSODomains(tx, p, domains); terr != nil {
+				return terr
+			}
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.SSOProviderUpdatedAction, "", map[string]interface{}{
+			"sso_provider_id": p.ID,
+			"name":            p.Name,
+			"domains":         p.DomainNames(),
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, p)
+}
+
+// adminSSOProviderDelete removes an SSO provider and its domains. Users who
+// signed in with it keep their accounts.
+func (a *API) adminSSOProviderDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	p := getSSOProvider(ctx)
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.SSOProviderDeletedAction, "", map[string]interface{}{
+			"sso_provider_id": p.ID,
+			"name":            p.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Destroy(p)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting SSO provider").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSamlMetadata = `<?xml version="1.0"?>
+<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com/metadata">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`
+
+func TestSSOProviderParams(t *testing.T) {
+	p, err := models.NewSSOProvider(uuid.Nil, models.SSOProviderTypeSAML, "Acme")
+	require.NoError(t, err)
+
+	err = applySSOProviderParams(p, &adminSSOProviderParams{})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, err.(*HTTPError).Code)
+
+	err = applySSOProviderParams(p, &adminSSOProviderParams{MetadataXML: "<EntityDescriptor/>"})
+	require.Error(t, err)
+
+	err = applySSOProviderParams(p, &adminSSOProviderParams{
+		MetadataXML:      testSamlMetadata,
+		AttributeMapping: map[string]interface{}{"email": "mail"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com/metadata", p.EntityID)
+
+	err = applySSOProviderParams(p, &adminSSOProviderParams{AttributeMapping: map[string]interface{}{"email": 1}})
+	require.Error(t, err)
+	err = applySSOProviderParams(p, &adminSSOProviderParams{ClientID: "client"})
+	require.Error(t, err)
+
+	p.Type = "ldap"
+	require.Error(t, applySSOProviderParams(p, &adminSSOProviderParams{}))
+
+	domains, err := normalizeSSODomains([]string{"Acme.com", " acme.io", "acme.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme.com", "acme.io"}, domains)
+	for _, domain := range []string{"", "acme", "jane@acme.com", "https://acme.com"} {
+		_, err := normalizeSSODomains([]string{domain})
+		assert.Error(t, err, domain)
+	}
+}
+
+func TestSSOSamlUserData(t *testing.T) {
+	p := &models.SSOProvider{
+		EntityID:         "https://idp.example.com/metadata",
+		AttributeMapping: models.JSONMap{"email": "mail", "name": "displayName"},
+	}
+
+	data, err := ssoSamlUserData(p, "jane", map[string]interface{}{
+		"mail":        "jane@acme.com",
+		"displayName": "Jane Doe",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "jane@acme.com", data.Emails[0].Email)
+	assert.Equal(t, "Jane Doe", data.Metadata.Name)
+	assert.Equal(t, "jane", data.Metadata.Subject)
+	assert.Equal(t, p.EntityID, data.Metadata.Issuer)
+
+	data, err = ssoSamlUserData(p, "john@acme.com", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, "john@acme.com", data.Emails[0].Email)
+}
+
+func (ts *AdminTestSuite) TestAdminSSOProviders() {
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		if body != nil {
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodPost, "/admin/sso/providers", map[string]interface{}{
+		"type":              "saml",
+		"name":              "Acme",
+		"metadata_xml":      testSamlMetadata,
+		"attribute_mapping": map[string]interface{}{"email": "mail"},
+		"domains":           []string{"Acme.com"},
+	})
+	require.Equal(ts.T(), http.StatusCreated, w.Code, w.Body.String())
+	p := models.SSOProvider{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(ts.T(), "https://idp.example.com/metadata", p.EntityID)
+	assert.Equal(ts.T(), []string{"acme.com"}, p.DomainNames())
+
+	// a domain maps to a single provider
+	w = request(http.MethodPost, "/admin/sso/providers", map[string]interface{}{
+		"type":         "saml",
+		"name":         "Other",
+		"metadata_xml": testSamlMetadata,
+		"domains":      []string{"acme.com"},
+	})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = request(http.MethodPut, "/admin/sso/providers/"+p.ID.String(), map[string]interface{}{
+		"name":    "Acme Corp",
+		"domains": []string{"acme.com", "acme.io"},
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	found, err := models.FindSSOProviderByDomain(ts.API.db, ts.instanceID, "ACME.io")
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "Acme Corp", found.Name)
+	assert.Equal(ts.T(), "mail", found.AttributeMapping["email"])
+
+	w = request(http.MethodGet, "/admin/sso/providers", nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := struct {
+		Providers []models.SSOProvider `json:"providers"`
+	}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Providers, 1)
+	assert.Len(ts.T(), data.Providers[0].Domains, 2)
+
+	// signing in with provider=sso redirects to the provider of the domain
+	ts.Config.External.Saml.APIBase = "http://localhost"
+	defer func() { ts.Config.External.Saml.APIBase = "" }()
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/authorize?provider=sso&domain=jane@acme.com", nil)
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusFound, w.Code, w.Body.String())
+	u, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "idp.example.com", u.Host)
+
+	w = request(http.MethodDelete, "/admin/sso/providers/"+p.ID.String(), nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	w = request(http.MethodGet, "/admin/sso/providers/"+p.ID.String(), nil)
+	assert.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -16,6 +17,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type AdminTestSuite struct {
@@ -256,6 +259,56 @@ func (ts *AdminTestSuite) TestAdminUsers_FilterName() {
 	assert.Equal(ts.T(), "test1@example.com", data.Users[0].GetEmail())
 }
 
+// TestAdminUserExternalID tests that external ids are unique per instance and can be used to filter users
+func (ts *AdminTestSuite) TestAdminUserExternalID() {
+	createUser := func(email string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":       email,
+			"external_id": "cus_123",
+		}))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/users", &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := createUser("test-external@example.com")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	u := models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&u))
+	assert.Equal(ts.T(), "cus_123", string(u.ExternalID))
+
+	w = createUser("test-external2@example.com")
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/users?filter=cus_123", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := struct {
+		Users []*models.User `json:"users"`
+	}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Users, 1)
+	assert.Equal(ts.T(), u.ID, data.Users[0].ID)
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"external_id": "",
+	}))
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, fmt.Sprintf("/admin/users/%s", u.ID), &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	w = createUser("test-external2@example.com")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
 // TestAdminUserCreate tests API /admin/user route (POST)
 func (ts *AdminTestSuite) TestAdminUserCreate() {
 	cases := []struct {
@@ -352,6 +405,175 @@ func (ts *AdminTestSuite) TestAdminUserCreate() {
 	}
 }
 
+// TestAdminUserCreateWithPasswordHash tests creating a user with a password
+// hashed by another auth provider, which is rehashed on sign in
+func (ts *AdminTestSuite) TestAdminUserCreateWithPasswordHash() {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("secret"), salt, 1, 1024, 1, 32)
+	hash := fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=1$%s$%s", base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	create := func(params map[string]interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(params))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/users", &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := create(map[string]interface{}{"email": "hashed@example.com", "password": "secret", "password_hash": hash})
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	w = create(map[string]interface{}{"email": "hashed@example.com", "password_hash": hash, "password_hash_algorithm": "scrypt"})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+	w = create(map[string]interface{}{"email": "hashed@example.com", "password_hash": "$argon2id$v=19$m=4294967295,t=4294967295,p=1$c2FsdA$aGFzaA"})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = create(map[string]interface{}{"email": "hashed@example.com", "password_hash": hash, "password_hash_algorithm": "argon2", "email_confirm": true})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "hashed@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), hash, u.EncryptedPassword)
+
+	ts.Config.Security.UpgradePasswordHashes = true
+	defer func() { ts.Config.Security.UpgradePasswordHashes = false }()
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "hashed@example.com",
+		"password": "secret",
+	}))
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	u, err = models.FindUserByID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), u.PasswordNeedsRehash())
+	assert.True(ts.T(), u.Authenticate("secret"))
+}
+
+// TestAdminUserImport tests API /admin/users/import route (POST)
+func (ts *AdminTestSuite) TestAdminUserImport() {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(ts.T(), err)
+	existing, err := models.NewUser(ts.instanceID, "", "existing@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(existing))
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"users": []map[string]interface{}{
+			{"email": "imported1@example.com", "password_hash": string(hash), "email_confirmed": true, "user_metadata": map[string]interface{}{"full_name": "Imported"}},
+			{"email": "imported2@example.com", "password_hash": string(hash)},
+			{"email": "existing@example.com", "password_hash": string(hash)},
+			{"email": "imported3@example.com", "password_hash": "not a hash"},
+			{"email": "IMPORTED1@example.com"},
+		},
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import?batch_size=2", &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := adminImportResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), 2, data.Imported)
+	require.Len(ts.T(), data.Failed, 3)
+	assert.Equal(ts.T(), 3, data.Failed[0].Row)
+	assert.Equal(ts.T(), 4, data.Failed[1].Row)
+	assert.Equal(ts.T(), 5, data.Failed[2].Row)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "imported1@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), u.Authenticate("secret"))
+	assert.True(ts.T(), u.IsConfirmed())
+	assert.Equal(ts.T(), "Imported", u.UserMetaData["full_name"])
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "imported2@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), u.IsConfirmed())
+}
+
+func (ts *AdminTestSuite) TestAdminUserImportCSV() {
+	body := "email,phone,password_hash,phone_confirmed,user_metadata\n" +
+		"csv@example.com,,,,\"{\"\"plan\"\"\":\"\"pro\"\"}\"\n" +
+		",12345678901,,true,\n"
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	req.Header.Set("Content-Type", "text/csv")
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := adminImportResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), 2, data.Imported)
+	assert.Empty(ts.T(), data.Failed)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "csv@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "pro", u.UserMetaData["plan"])
+
+	u, err = models.FindUserByPhoneAndAudience(ts.API.db, ts.instanceID, "12345678901", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.NotNil(ts.T(), u.PhoneConfirmedAt)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/admin/users/import", bytes.NewBufferString("email,password\nx@example.com,secret\n"))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	req.Header.Set("Content-Type", "text/csv")
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+// TestAdminGenerateLink tests API /admin/generate_link route (POST)
+func (ts *AdminTestSuite) TestAdminGenerateLink() {
+	u, err := models.NewUser(ts.instanceID, "", "test@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	cases := []struct {
+		linkType string
+		exp      uint
+	}{
+		{recoveryVerification, ts.Config.Mailer.OtpExp},
+		{magicLinkVerification, ts.Config.Mailer.MagicLinkExp},
+	}
+	for _, c := range cases {
+		ts.Run(c.linkType, func() {
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+				"type":        c.linkType,
+				"email":       "test@example.com",
+				"redirect_to": ts.Config.SiteURL,
+			}))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/admin/generate_link", &buffer)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), http.StatusOK, w.Code)
+
+			data := map[string]interface{}{}
+			require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+			assert.Contains(ts.T(), data["action_link"], "type="+c.linkType)
+			assert.Equal(ts.T(), ts.Config.SiteURL, data["redirect_to"])
+			assert.Equal(ts.T(), float64(c.exp), data["expires_in"])
+
+			expiresAt, err := time.Parse(time.RFC3339, data["expires_at"].(string))
+			require.NoError(ts.T(), err)
+			assert.WithinDuration(ts.T(), time.Now().Add(time.Duration(c.exp)*time.Second), expiresAt, 5*time.Second)
+		})
+	}
+}
+
 // TestAdminUserGet tests API /admin/user route (GET)
 func (ts *AdminTestSuite) TestAdminUserGet() {
 	u, err := models.NewUser(ts.instanceID, "12345678", "test1@example.com", "test", ts.Config.JWT.Aud, map[string]interface{}{"full_name": "Test Get User"})
@@ -378,6 +600,78 @@ func (ts *AdminTestSuite) TestAdminUserGet() {
 	assert.Equal(ts.T(), "Test Get User", md["full_name"])
 }
 
+// TestAdminUserReadsAudited tests that admins viewing users are recorded when AUDIT_ADMIN_READS is on
+func (ts *AdminTestSuite) TestAdminUserReadsAudited() {
+	ts.Config.Audit.AdminReads = true
+	defer func() {
+		ts.Config.Audit.AdminReads = false
+	}()
+
+	u, err := models.NewUser(ts.instanceID, "", "test-read@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	for _, path := range []string{"/admin/users?filter=test-read", fmt.Sprintf("/admin/users/%s", u.ID)} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusOK, w.Code)
+	}
+
+	entries, err := models.FindAuditLogEntries(ts.API.db, ts.instanceID, nil, "", nil)
+	require.NoError(ts.T(), err)
+	actions := map[string]map[string]interface{}{}
+	for _, entry := range entries {
+		traits, _ := entry.Payload["traits"].(map[string]interface{})
+		actions[entry.Payload["action"].(string)] = traits
+	}
+	require.Contains(ts.T(), actions, string(models.UsersListedAction))
+	assert.Equal(ts.T(), "test-read", actions[string(models.UsersListedAction)]["filter"])
+	require.Contains(ts.T(), actions, string(models.UserViewedAction))
+	assert.Equal(ts.T(), u.ID.String(), actions[string(models.UserViewedAction)]["user_id"])
+}
+
+// TestAdminUserMaskedRole tests that admins with a masked role only see masked emails and phone numbers
+func (ts *AdminTestSuite) TestAdminUserMaskedRole() {
+	adminRoles := ts.Config.JWT.AdminRoles
+	ts.Config.JWT.AdminRoles = append([]string{"support"}, adminRoles...)
+	ts.Config.JWT.AdminMaskedRoles = []string{"support"}
+	defer func() {
+		ts.Config.JWT.AdminRoles = adminRoles
+		ts.Config.JWT.AdminMaskedRoles = nil
+	}()
+
+	u, err := models.NewUser(ts.instanceID, "15551234567", "test-masked@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	support := models.NewSystemUser(uuid.Nil, ts.Config.JWT.Aud)
+	support.Role = "support"
+	token, err := generateAccessToken(support, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/users/%s", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), "t***@example.com", data.GetEmail())
+	assert.Equal(ts.T(), "155******67", data.GetPhone())
+
+	// other admin roles see the full values
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/users/%s", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), "test-masked@example.com", data.GetEmail())
+}
+
 // TestAdminUserUpdate tests API /admin/user route (UPDATE)
 func (ts *AdminTestSuite) TestAdminUserUpdate() {
 	u, err := models.NewUser(ts.instanceID, "12345678", "test1@example.com", "test", ts.Config.JWT.Aud, nil)
@@ -527,6 +821,312 @@ func (ts *AdminTestSuite) TestAdminUserDelete() {
 	require.Equal(ts.T(), http.StatusOK, w.Code)
 }
 
+// TestAdminUserDeleteRequiresApproval tests that deleting a user needs a second admin when approvals are enabled
+func (ts *AdminTestSuite) TestAdminUserDeleteRequiresApproval() {
+	ts.Config.Security.AdminApprovals.Enabled = true
+	ts.Config.Security.AdminApprovals.TTL = time.Hour
+	defer func() {
+		ts.Config.Security.AdminApprovals.Enabled = false
+	}()
+
+	u, err := models.NewUser(ts.instanceID, "123456789", "test-delete@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/admin/users/%s", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusAccepted, w.Code)
+
+	action := models.AdminAction{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&action))
+	assert.Equal(ts.T(), models.AdminActionUserDelete, action.Action)
+	assert.Equal(ts.T(), u.ID, action.TargetID)
+
+	_, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err, "User should not be deleted before approval")
+
+	// the requesting admin cannot approve their own action
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/actions/%s/approve", action.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/actions/%s/approve", action.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.makeSuperAdmin("")))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	_, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.True(ts.T(), models.IsNotFoundError(err), "User should be deleted after approval")
+}
+
+// TestAdminUserRecover tests that admins can send a recovery email that redirects to an allowed URL only
+func (ts *AdminTestSuite) TestAdminUserRecover() {
+	u, err := models.NewUser(ts.instanceID, "", "test-recover@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	recover := func(redirectTo string) int {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"redirect_to": redirectTo,
+		}))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/%s/recover", u.ID), &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, recover("https://evil.example.org/reset"))
+	assert.Equal(ts.T(), http.StatusOK, recover(ts.Config.SiteURL+"/account/reset"))
+
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	require.NotNil(ts.T(), u.RecoverySentAt)
+	assert.WithinDuration(ts.T(), time.Now(), *u.RecoverySentAt, time.Second)
+}
+
+// TestAdminUserTimeline tests that the timeline of a user combines audit log entries, security events and admin actions
+func (ts *AdminTestSuite) TestAdminUserTimeline() {
+	u, err := models.NewUser(ts.instanceID, "", "test-timeline@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, u, models.LoginAction, "127.0.0.1", nil))
+	event, err := models.NewSecurityEvent(u, models.SignInSecurityEvent, "127.0.0.1", "NL", nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(event))
+	action, err := models.NewAdminAction(ts.instanceID, models.AdminActionUserDelete, u.ID, nil, "admin@example.com", time.Hour)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(action))
+
+	other, err := models.NewUser(ts.instanceID, "", "test-timeline-other@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(other))
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, other, models.LoginAction, "", nil))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/users/%s/timeline?per_page=2", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	assert.Equal(ts.T(), "3", w.Header().Get("X-Total-Count"))
+
+	events := []*models.TimelineEvent{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&events))
+	require.Len(ts.T(), events, 2)
+	assert.Equal(ts.T(), models.AdminActionTimelineSource, events[0].Source)
+	assert.Equal(ts.T(), string(models.AdminActionUserDelete), events[0].Action)
+	assert.Equal(ts.T(), models.SecurityEventTimelineSource, events[1].Source)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/users/%s/timeline?per_page=2&page=2", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&events))
+	require.Len(ts.T(), events, 1)
+	assert.Equal(ts.T(), models.AuditLogTimelineSource, events[0].Source)
+	assert.Equal(ts.T(), string(models.LoginAction), events[0].Action)
+}
+
+// TestAdminUserAnonymize tests that anonymizing a user removes their personal data and sessions
+func (ts *AdminTestSuite) TestAdminUserAnonymize() {
+	u, err := models.NewUser(ts.instanceID, "123456789", "test-anonymize@example.com", "test", ts.Config.JWT.Aud, map[string]interface{}{"full_name": "Test User"})
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+	_, err = models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
+	require.NoError(ts.T(), err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/%s/anonymize", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), u.GetEmail())
+	assert.Empty(ts.T(), u.GetPhone())
+	assert.Empty(ts.T(), u.UserMetaData)
+	assert.False(ts.T(), u.Authenticate("test"))
+
+	count, err := ts.API.db.Q().Where("user_id = ?", u.ID).Count(&models.RefreshToken{})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 0, count)
+}
+
+// TestAdminUserLegalHold tests that a user on legal hold can't be deleted or anonymized until the hold is released
+func (ts *AdminTestSuite) TestAdminUserLegalHold() {
+	u, err := models.NewUser(ts.instanceID, "123456789", "test-hold@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	setHold := func(hold bool) {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"legal_hold": hold,
+		}))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/admin/users/%s", u.ID), &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusOK, w.Code)
+	}
+	setHold(true)
+
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), u.IsOnLegalHold())
+
+	for _, path := range []string{"", "/anonymize"} {
+		method := http.MethodDelete
+		if path != "" {
+			method = http.MethodPost
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, fmt.Sprintf("/admin/users/%s%s", u.ID, path), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusConflict, w.Code)
+
+		e := &HTTPError{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(e))
+		assert.Equal(ts.T(), "legal_hold", e.Details["reason"])
+	}
+
+	setHold(false)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/admin/users/%s", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+// TestAdminUserShadowBan tests that a shadow banned user can sign in, gets marked tokens and is reported to the webhooks
+func (ts *AdminTestSuite) TestAdminUserShadowBan() {
+	u, err := models.NewUser(ts.instanceID, "", "test-shadow@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+	require.NoError(ts.T(), u.Confirm(ts.API.db))
+
+	events := make(chan string, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{}
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&data))
+		events <- data["event"].(string)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+	ts.Config.Webhook = conf.WebhookConfig{URL: svr.URL, Secret: "webhook-secret", Events: []string{ShadowBannedEvent}}
+	defer func() { ts.Config.Webhook = conf.WebhookConfig{} }()
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"shadow_banned": true,
+	}))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/admin/users/%s", u.ID), &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	buffer.Reset()
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test-shadow@example.com",
+		"password": "password",
+	}))
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(ts.T(), ShadowBannedEvent, <-events)
+
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	claims := &GoTrueClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(token.Token, claims)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), claims.ShadowBanned)
+}
+
+// TestAdminUserMerge tests that a duplicate user's identities, sessions and metadata move onto the target user
+func (ts *AdminTestSuite) TestAdminUserMerge() {
+	target, err := models.NewUser(ts.instanceID, "", "test-merge@example.com", "test", ts.Config.JWT.Aud, map[string]interface{}{"full_name": "Test User"})
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(target), "Error creating user")
+
+	source, err := models.NewUser(ts.instanceID, "", "test-merge-github@example.com", "", ts.Config.JWT.Aud, map[string]interface{}{"full_name": "Someone Else", "avatar_url": "https://example.com/avatar.png"})
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(source), "Error creating user")
+	identity, err := models.NewIdentity(source, "github", map[string]interface{}{"sub": "123456"})
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(identity))
+	_, err = models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, source)
+	require.NoError(ts.T(), err)
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"source_user_id": target.ID,
+	}))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/%s/merge", target.ID), &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"source_user_id": source.ID,
+	}))
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/%s/merge", target.ID), &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	merged := models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&merged))
+	assert.Equal(ts.T(), "Test User", merged.UserMetaData["full_name"])
+	assert.Equal(ts.T(), "https://example.com/avatar.png", merged.UserMetaData["avatar_url"])
+	require.Len(ts.T(), merged.Identities, 1)
+	assert.Equal(ts.T(), "github", merged.Identities[0].Provider)
+
+	_, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, source.ID)
+	assert.True(ts.T(), models.IsNotFoundError(err))
+
+	count, err := ts.API.db.Q().Where("user_id = ?", target.ID).Count(&models.RefreshToken{})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 1, count)
+}
+
+// TestAdminLogoutAll tests that all refresh tokens of the instance are revoked
+func (ts *AdminTestSuite) TestAdminLogoutAll() {
+	u, err := models.NewUser(ts.instanceID, "", "test-logout@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+	_, err = models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
+	require.NoError(ts.T(), err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/logout", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	count, err := ts.API.db.Q().Where("instance_id = ?", ts.instanceID).Count(&models.RefreshToken{})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 0, count)
+}
+
 func (ts *AdminTestSuite) TestAdminUserCreateWithDisabledLogin() {
 	var cases = []struct {
 		desc         string
@@ -597,3 +1197,224 @@ func (ts *AdminTestSuite) TestAdminUserCreateWithDisabledLogin() {
 		})
 	}
 }
+
+func (ts *AdminTestSuite) TestAdminServiceAccounts() {
+	ts.Config.ServiceAccounts.Enabled = true
+	defer func() {
+		ts.Config.ServiceAccounts.Enabled = false
+	}()
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"name": "billing",
+		"role": "service_role",
+	}))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/service_accounts", &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	account := adminServiceAccountResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&account))
+	require.NotEmpty(ts.T(), account.Secret)
+
+	grant := func(secret string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=client_credentials", nil)
+		req.SetBasicAuth(account.ID.String(), secret)
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(ts.T(), http.StatusBadRequest, grant("wrong").Code)
+
+	w = grant(account.Secret)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := map[string]interface{}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	accessToken, ok := data["access_token"].(string)
+	require.True(ts.T(), ok)
+
+	// a service_role account can call the admin API with its token
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/admin/service_accounts/"+account.ID.String(), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	assert.Equal(ts.T(), http.StatusBadRequest, grant(account.Secret).Code)
+}
+
+func (ts *AdminTestSuite) TestDelegatedAppMetadataUpdate() {
+	defer func(c conf.AppMetadataConfiguration) { ts.Config.AppMetadata = c }(ts.Config.AppMetadata)
+	ts.Config.AppMetadata.DelegatedRoles = []string{"billing"}
+	ts.Config.AppMetadata.DelegatedKeys = []string{"tier"}
+
+	u, err := models.NewUser(ts.instanceID, "", "customer@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	u.AppMetaData = map[string]interface{}{"provider": "email"}
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	makeToken := func(role string) string {
+		service := models.NewSystemUser(uuid.Nil, ts.Config.JWT.Aud)
+		service.Role = role
+		token, err := generateAccessToken(service, time.Hour, ts.Config.JWT.Secret)
+		require.NoError(ts.T(), err)
+		return token
+	}
+	update := func(token string, body map[string]interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+		req := httptest.NewRequest(http.MethodPut, "/users/"+u.ID.String()+"/app_metadata", &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update(makeToken("billing"), map[string]interface{}{"tier": "pro"})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "pro", u.AppMetaData["tier"])
+	assert.Equal(ts.T(), "email", u.AppMetaData["provider"])
+
+	// keys that aren't delegated stay admin only
+	w = update(makeToken("billing"), map[string]interface{}{"tier": "free", "roles": []string{"admin"}})
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	w = update(makeToken("authenticated"), map[string]interface{}{"tier": "free"})
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "pro", u.AppMetaData["tier"])
+	assert.Nil(ts.T(), u.AppMetaData["roles"])
+}
+
+func (ts *AdminTestSuite) TestAdminUserRoles() {
+	u, err := models.NewUser(ts.instanceID, "", "roles@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	u.Role = "authenticated"
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+		req := httptest.NewRequest(method, "/admin/users/"+u.ID.String()+path, &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// concurrent grants don't overwrite each other
+	done := make(chan int, 2)
+	for _, role := range []string{"billing", "support"} {
+		go func(role string) {
+			done <- request(http.MethodPost, "/roles", map[string]interface{}{"roles": []string{role}}).Code
+		}(role)
+	}
+	assert.Equal(ts.T(), http.StatusOK, <-done)
+	assert.Equal(ts.T(), http.StatusOK, <-done)
+
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.ElementsMatch(ts.T(), []string{"billing", "support"}, u.Roles)
+	assert.True(ts.T(), u.HasRole("support"))
+
+	// replacing the role keeps the granted roles
+	w := request(http.MethodPut, "", map[string]interface{}{"role": "staff"})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "staff", u.Role)
+	assert.Equal(ts.T(), "staff", u.AllRoles()[0])
+	assert.ElementsMatch(ts.T(), []string{"staff", "billing", "support"}, u.AllRoles())
+
+	token, err := generateAccessToken(u, time.Minute, ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+	claims := &GoTrueClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "staff", claims.Role)
+	assert.ElementsMatch(ts.T(), []string{"staff", "billing", "support"}, claims.Roles)
+
+	w = request(http.MethodDelete, "/roles/support", nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	w = request(http.MethodDelete, "/roles/staff", nil)
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+	w = request(http.MethodPost, "/roles", map[string]interface{}{"roles": []string{" padded"}})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), models.StringList{"billing"}, u.Roles)
+}
+
+func (ts *AdminTestSuite) TestAdminUserSessions() {
+	u, err := models.NewUser(ts.instanceID, "", "sessions@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	signIn := func(userAgent string) string {
+		r := httptest.NewRequest(http.MethodPost, "/token", nil)
+		r.Header.Set("User-Agent", userAgent)
+		refreshToken, err := models.GrantAuthenticatedUser(r, ts.API.db, u)
+		require.NoError(ts.T(), err)
+		token, err := generateBoundAccessToken(u, time.Minute, &ts.Config.JWT, "", passwordGrant, sessionClaim(refreshToken))
+		require.NoError(ts.T(), err)
+		return token
+	}
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+	sessionsPath := "/admin/users/" + u.ID.String() + "/sessions"
+
+	laptop := signIn("laptop")
+	phone := signIn("phone")
+	assert.Equal(ts.T(), http.StatusOK, request(http.MethodGet, "/user", phone).Code)
+
+	w := request(http.MethodGet, sessionsPath, ts.token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := struct {
+		Sessions []models.Session `json:"sessions"`
+	}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Sessions, 2)
+
+	var phoneSession string
+	for _, session := range data.Sessions {
+		if session.UserAgent == "phone" {
+			phoneSession = session.ID.String()
+		}
+	}
+	require.NotEmpty(ts.T(), phoneSession)
+
+	// the access tokens of a revoked session are rejected right away
+	assert.Equal(ts.T(), http.StatusNoContent, request(http.MethodDelete, sessionsPath+"/"+phoneSession, ts.token).Code)
+	assert.Equal(ts.T(), http.StatusUnauthorized, request(http.MethodGet, "/user", phone).Code)
+	assert.Equal(ts.T(), http.StatusOK, request(http.MethodGet, "/user", laptop).Code)
+	assert.Equal(ts.T(), http.StatusNotFound, request(http.MethodDelete, sessionsPath+"/"+phoneSession, ts.token).Code)
+
+	assert.Equal(ts.T(), http.StatusNoContent, request(http.MethodDelete, sessionsPath, ts.token).Code)
+	assert.Equal(ts.T(), http.StatusUnauthorized, request(http.MethodGet, "/user", laptop).Code)
+
+	w = request(http.MethodGet, sessionsPath, ts.token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Empty(ts.T(), data.Sessions)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// adminUserMergeParams are the parameters of a merge of the source user onto
+// the user in the path. MetadataStrategy decides what happens to the source's
+// user_metadata: merge fills in keys the target doesn't have, replace takes
+// the source's metadata and keep leaves the target's alone.
+type adminUserMergeParams struct {
+	SourceUserID     uuid.UUID `json:"source_user_id"`
+	MetadataStrategy string    `json:"metadata_strategy"`
+}
+
+func (p *adminUserMergeParams) validate(target *models.User) error {
+	if p.SourceUserID == uuid.Nil {
+		return unprocessableEntityError("source_user_id is required")
+	}
+	if p.SourceUserID == target.ID {
+		return unprocessableEntityError("A user cannot be merged with itself")
+	}
+	switch p.MetadataStrategy {
+	case "":
+		p.MetadataStrategy = conf.DuplicateSignupMergeMetadata
+	case conf.DuplicateSignupMergeMetadata, conf.DuplicateSignupReplaceMetadata, conf.DuplicateSignupKeepMetadata:
+	default:
+		return unprocessableEntityError("metadata_strategy must be merge, replace or keep")
+	}
+	return nil
+}
+
+// adminActionParams returns the params as stored with a pending admin action.
+func (p *adminUserMergeParams) adminActionParams() map[string]interface{} {
+	return map[string]interface{}{
+		"source_user_id":    p.SourceUserID.String(),
+		"metadata_strategy": p.MetadataStrategy,
+	}
+}
+
+func (p *adminUserMergeParams) fromAdminAction(action *models.AdminAction) error {
+	data, err := json.Marshal(action.Params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, p)
+}
+
+// adminUserMerge merges a duplicate account onto the user in the path
+func (a *API) adminUserMerge(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	params := &adminUserMergeParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read params: %v", err)
+	}
+	if err := params.validate(user); err != nil {
+		return err
+	}
+
+	if config.Security.AdminApprovals.Enabled {
+		return a.requestAdminApproval(w, r, models.AdminActionUserMerge, user.ID, params.adminActionParams())
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		return a.mergeUsers(r, tx, user, params)
+	})
+	if err != nil {
+		return err
+	}
+
+	user, err = models.FindUserByInstanceIDAndID(a.getDB(ctx), instanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error loading user").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, user)
+}
+
+// mergeUsers moves the identities, sessions and metadata of the source user
+// onto user and deletes the source.
+func (a *API) mergeUsers(r *http.Request, tx *storage.Connection, user *models.User, params *adminUserMergeParams) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	source, err := models.FindUserByInstanceIDAndID(tx, instanceID, params.SourceUserID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("Source user not found")
+		}
+		return internalServerError("Database error loading source user").WithInternalError(err)
+	}
+	// merging deletes the source
+	if source.IsOnLegalHold() {
+		return legalHoldError(source)
+	}
+	if source.Aud != user.Aud {
+		return unprocessableEntityError("Users of different audiences cannot be merged")
+	}
+
+	identities, err := models.TransferIdentities(tx, source, user)
+	if err != nil {
+		return internalServerError("Database error moving identities").WithInternalError(err)
+	}
+	refreshTokens, err := models.TransferRefreshTokens(tx, instanceID, source.ID, user.ID)
+	if err != nil {
+		return internalServerError("Database error moving sessions").WithInternalError(err)
+	}
+	if err := mergeUserMetaData(tx, user, source, params.MetadataStrategy); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	if err := user.UpdateAppMetaDataProviders(tx); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+
+	if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.UsersMergedAction, "", map[string]interface{}{
+		"user_id":              user.ID,
+		"source_user_id":       source.ID,
+		"source_user_email":    source.Email,
+		"source_user_phone":    source.Phone,
+		"source_user_metadata": source.UserMetaData,
+		"metadata_strategy":    params.MetadataStrategy,
+		"identities_moved":     identities,
+		"refresh_tokens_moved": refreshTokens,
+	}); terr != nil {
+		return internalServerError("Error recording audit log entry").WithInternalError(terr)
+	}
+
+	if terr := tx.Destroy(source); terr != nil {
+		return internalServerError("Database error deleting source user").WithInternalError(terr)
+	}
+	return nil
+}
+
+func mergeUserMetaData(tx *storage.Connection, user, source *models.User, strategy string) error {
+	switch strategy {
+	case conf.DuplicateSignupKeepMetadata:
+		return nil
+	case conf.DuplicateSignupReplaceMetadata:
+		user.UserMetaData = source.UserMetaData
+		return tx.UpdateOnly(user, "raw_user_meta_data")
+	default:
+		missing := map[string]interface{}{}
+		for key, value := range source.UserMetaData {
+			if _, ok := user.UserMetaData[key]; !ok {
+				missing[key] = value
+			}
+		}
+		return user.UpdateUserMetaData(tx, missing)
+	}
+}
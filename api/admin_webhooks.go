@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWebhookTestBody caps the response body of the receiver returned by the
+// webhook test.
+const maxWebhookTestBody = 64 * 1024
+
+// AdminWebhookTestParams are the parameters of the webhook test.
+type AdminWebhookTestParams struct {
+	Event HookEvent `json:"event"`
+}
+
+// WebhookTestResult is what the receiver of a webhook test answered, or the
+// error of the request if it didn't.
+type WebhookTestResult struct {
+	Event      HookEvent   `json:"event"`
+	URL        string      `json:"url"`
+	Subscribed bool        `json:"subscribed"`
+	Status     int         `json:"status,omitempty"`
+	LatencyMS  int64       `json:"latency_ms"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// adminWebhookTest sends a signed sample event to the configured webhook, so
+// integrators can check their receiver without signing up real users.
+func (a *API) adminWebhookTest(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	params := &AdminWebhookTestParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read webhook test params: %v", err)
+	}
+	switch params.Event {
+	case ValidateEvent, SignupEvent, EmailChangeEvent, LoginEvent, ShadowBannedEvent:
+	default:
+		return unprocessableEntityError("event must be one of %s, %s, %s, %s or %s", ValidateEvent, SignupEvent, EmailChangeEvent, LoginEvent, ShadowBannedEvent)
+	}
+	if config.Webhook.URL == "" {
+		return unprocessableEntityError("No webhook URL is configured")
+	}
+
+	result, err := testWebhook(ctx, params.Event, getInstanceID(ctx), config)
+	if err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, result)
+}
+
+// testWebhook sends a sample event to the configured webhook once. Unlike
+// real events it isn't retried and doesn't go through the circuit breaker, so
+// failing tests don't pause the webhook.
+func testWebhook(ctx context.Context, event HookEvent, instanceID uuid.UUID, config *conf.Configuration) (*WebhookTestResult, error) {
+	hookURL, err := url.Parse(config.Webhook.URL)
+	if err != nil {
+		return nil, unprocessableEntityError("Failed to parse Webhook URL")
+	}
+	user, err := sampleWebhookUser(instanceID, config)
+	if err != nil {
+		return nil, internalServerError("Failed to build the sample user").WithInternalError(err)
+	}
+	hook, err := newWebhook(ctx, hookURL, config.Webhook.Secret, event, user, instanceID, config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WebhookTestResult{
+		Event:      event,
+		URL:        hook.URL,
+		Subscribed: config.Webhook.HasEvent(string(event)),
+	}
+	timeout := defaultTimeout
+	if hook.TimeoutSec > 0 {
+		timeout = time.Duration(hook.TimeoutSec) * time.Second
+	}
+	client := http.Client{
+		Timeout: timeout,
+		Transport: SafeRoundtripper(nil, logrus.WithFields(logrus.Fields{
+			"component": "webhook_test",
+			"url":       hook.URL,
+		})),
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewBuffer(hook.payload))
+	if err != nil {
+		return nil, internalServerError("Failed to make request object").WithInternalError(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.headers {
+		req.Header.Set(name, value)
+	}
+	if hook.jwtSecret != "" {
+		signature, err := hook.generateSignature()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(headerHookSignature, signature)
+	}
+
+	start := time.Now()
+	rsp, err := client.Do(req)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	defer rsp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxWebhookTestBody))
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Status = rsp.StatusCode
+	result.Headers = rsp.Header
+	result.Body = string(body)
+	return result, nil
+}
+
+// sampleWebhookUser returns the made up user sent with webhook tests. It isn't
+// saved.
+func sampleWebhookUser(instanceID uuid.UUID, config *conf.Configuration) (*models.User, error) {
+	user, err := models.NewUserWithPasswordHash(instanceID, "", "user@example.com", "", config.JWT.Aud, map[string]interface{}{
+		"full_name": "Example User",
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user.Role = config.JWT.DefaultGroupName
+	user.AppMetaData = map[string]interface{}{
+		"provider":  "email",
+		"providers": []string{"email"},
+	}
+	user.EmailConfirmedAt = &now
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return user, nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookTest(t *testing.T) {
+	iid := uuid.Must(uuid.NewV4())
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer squash(r.Body.Close)
+		raw, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		claims := webhookClaims{}
+		p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+		_, err = p.ParseWithClaims(r.Header.Get(headerHookSignature), &claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte("webhook-secret"), nil
+		})
+		require.NoError(t, err)
+		sha, err := checksum(raw)
+		require.NoError(t, err)
+		assert.Equal(t, sha, claims.SHA256)
+
+		data := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(raw, &data))
+		assert.Equal(t, LoginEvent, data["event"])
+		assert.Equal(t, "user@example.com", data["user"].(map[string]interface{})["email"])
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer svr.Close()
+
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	config := &conf.Configuration{
+		Webhook: conf.WebhookConfig{
+			URL:    svr.URL,
+			Secret: "webhook-secret",
+			Events: []string{SignupEvent},
+		},
+	}
+	result, err := testWebhook(context.Background(), LoginEvent, iid, config)
+	require.NoError(t, err)
+	assert.Equal(t, svr.URL, result.URL)
+	assert.False(t, result.Subscribed)
+	assert.Equal(t, http.StatusAccepted, result.Status)
+	assert.Equal(t, `{"ok":true}`, result.Body)
+	assert.Equal(t, "application/json", result.Headers.Get("Content-Type"))
+	assert.Empty(t, result.Error)
+
+	// receivers that can't be reached are reported rather than failing
+	svr.Close()
+	result, err = testWebhook(context.Background(), SignupEvent, iid, config)
+	require.NoError(t, err)
+	assert.True(t, result.Subscribed)
+	assert.Zero(t, result.Status)
+	assert.NotEmpty(t, result.Error)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/breaker"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/mailer"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/sirupsen/logrus"
+)
+
+type SuspiciousActivity string
+
+const (
+	SuspiciousActivityEvent = "suspicious_activity"
+
+	FailedLoginSpikeActivity  SuspiciousActivity = "failed_login_spike"
+	MassSignupActivity        SuspiciousActivity = "mass_signup"
+	RefreshTokenReuseActivity SuspiciousActivity = "refresh_token_reuse"
+	SmsLimitReachedActivity   SuspiciousActivity = "sms_limit_reached"
+
+	// maxAlertSamples is how many individual occurrences are included in an alert
+	maxAlertSamples = 10
+)
+
+const suspiciousActivityMail = `<h2>Suspicious activity detected</h2>
+
+<p>{{ .Count }} occurrences of <strong>{{ .Activity }}</strong>{{ if .Key }} from {{ .Key }}{{ end }} were detected within {{ .Window }} on {{ .SiteURL }}.</p>`
+
+// SuspiciousActivityAlert is sent to the configured admin destinations once a threshold is exceeded.
+type SuspiciousActivityAlert struct {
+	Event      string                   `json:"event"`
+	InstanceID uuid.UUID                `json:"instance_id,omitempty"`
+	Activity   SuspiciousActivity       `json:"activity"`
+	Key        string                   `json:"key,omitempty"`
+	Count      int                      `json:"count"`
+	Threshold  int                      `json:"threshold"`
+	Window     string                   `json:"window"`
+	Samples    []map[string]interface{} `json:"samples"`
+	DetectedAt time.Time                `json:"detected_at"`
+}
+
+type activityCounter struct {
+	events     []time.Time
+	samples    []map[string]interface{}
+	notifiedAt time.Time
+}
+
+// activityMonitor aggregates suspicious activity per instance, activity and key
+// so that admins get a single alert per window instead of one per occurrence.
+type activityMonitor struct {
+	mu        sync.Mutex
+	counters  map[string]*activityCounter
+	lastSweep time.Time
+}
+
+func newActivityMonitor() *activityMonitor {
+	return &activityMonitor{counters: make(map[string]*activityCounter), lastSweep: time.Now()}
+}
+
+// record adds an occurrence and returns an alert if the threshold was reached
+// and no alert was sent for this key within the window.
+func (m *activityMonitor) record(instanceID uuid.UUID, activity SuspiciousActivity, key string, threshold int, window time.Duration, details map[string]interface{}) *SuspiciousActivityAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+	id := fmt.Sprintf("%s/%s/%s", instanceID, activity, key)
+
+	c, ok := m.counters[id]
+	if !ok {
+		c = &activityCounter{}
+		m.counters[id] = c
+	}
+
+	kept := c.events[:0]
+	for _, t := range c.events {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	c.events = append(kept, now)
+	if len(c.samples) < maxAlertSamples {
+		c.samples = append(c.samples, details)
+	}
+
+	// periodically drop idle counters so per-IP keys don't accumulate
+	if m.lastSweep.Before(cutoff) {
+		for k, other := range m.counters {
+			if other.events[len(other.events)-1].Before(cutoff) && other.notifiedAt.Before(cutoff) {
+				delete(m.counters, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if len(c.events) < threshold || c.notifiedAt.After(cutoff) {
+		return nil
+	}
+
+	alert := &SuspiciousActivityAlert{
+		Event:      SuspiciousActivityEvent,
+		InstanceID: instanceID,
+		Activity:   activity,
+		Key:        key,
+		Count:      len(c.events),
+		Threshold:  threshold,
+		Window:     window.String(),
+		Samples:    c.samples,
+		DetectedAt: now,
+	}
+	c.notifiedAt = now
+	c.samples = nil
+	return alert
+}
+
+func alertThreshold(config *conf.Configuration, activity SuspiciousActivity) int {
+	switch activity {
+	case FailedLoginSpikeActivity:
+		return config.Security.Alerts.FailedLoginThreshold
+	case MassSignupActivity:
+		return config.Security.Alerts.SignupThreshold
+	case RefreshTokenReuseActivity:
+		return config.Security.Alerts.RefreshTokenReuseThreshold
+	case SmsLimitReachedActivity:
+		// every blocked SMS costs a user their code
+		return 1
+	}
+	return 0
+}
+
+// reportSuspiciousActivity records an occurrence of suspicious activity and
+// notifies the configured admin destinations once its threshold is exceeded.
+func (a *API) reportSuspiciousActivity(ctx context.Context, activity SuspiciousActivity, key string, details map[string]interface{}) {
+	config := a.getConfig(ctx)
+	alertsConfig := config.Security.Alerts
+	if alertsConfig.Email == "" && alertsConfig.WebhookURL == "" && alertsConfig.SlackURL == "" {
+		return
+	}
+
+	threshold := alertThreshold(config, activity)
+	if threshold <= 0 {
+		return
+	}
+
+	alert := a.activity.record(getInstanceID(ctx), activity, key, threshold, alertsConfig.Window, details)
+	if alert == nil {
+		return
+	}
+
+	// notifying must not hold up the request that triggered the alert, nor be
+	// cancelled with it, so it only keeps the request ID
+	go a.sendSuspiciousActivityAlert(getRequestID(ctx), config, alert)
+}
+
+func (a *API) sendSuspiciousActivityAlert(requestID string, config *conf.Configuration, alert *SuspiciousActivityAlert) {
+	alertsConfig := config.Security.Alerts
+	alertLog := logrus.WithFields(logrus.Fields{
+		"component":   "alerts",
+		"request_id":  requestID,
+		"activity":    alert.Activity,
+		"instance_id": alert.InstanceID,
+		"count":       alert.Count,
+	})
+	alertLog.Warn("Suspicious activity detected")
+
+	if alertsConfig.Email != "" {
+		recipient := &models.User{Email: storage.NullString(alertsConfig.Email)}
+		subject := fmt.Sprintf("Suspicious activity detected: %s", alert.Activity)
+		if err := mailer.NewMailerWithLogger(config, alertLog).Send(recipient, subject, suspiciousActivityMail, map[string]interface{}{
+			"SiteURL":  config.SiteURL,
+			"Activity": alert.Activity,
+			"Key":      alert.Key,
+			"Count":    alert.Count,
+			"Window":   alert.Window,
+		}); err != nil {
+			alertLog.WithError(err).Error("Failed to send suspicious activity email")
+		}
+	}
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		alertLog.WithError(err).Error("Failed to serialize suspicious activity alert")
+		return
+	}
+
+	if alertsConfig.WebhookURL != "" {
+		sha, err := checksum(data)
+		if err != nil {
+			alertLog.WithError(err).Error("Failed to checksum suspicious activity alert")
+			return
+		}
+		w := Webhook{
+			WebhookConfig: &conf.WebhookConfig{URL: alertsConfig.WebhookURL},
+			jwtSecret:     alertsConfig.WebhookSecret,
+			instanceID:    alert.InstanceID,
+			claims: webhookClaims{
+				StandardClaims: jwt.StandardClaims{
+					IssuedAt: time.Now().Unix(),
+					Subject:  alert.InstanceID.String(),
+					Issuer:   gotrueIssuer,
+				},
+				SHA256: sha,
+			},
+			payload: data,
+			headers: requestIDHeaders(requestID),
+		}
+		body, err := w.trigger()
+		if body != nil {
+			body.Close()
+		}
+		if err != nil {
+			alertLog.WithError(err).Error("Failed to send suspicious activity webhook")
+		}
+	}
+
+	if alertsConfig.SlackURL != "" {
+		if err := postSlackAlert(alertsConfig.SlackURL, config.SiteURL, alert, alertLog); err != nil {
+			alertLog.WithError(err).Error("Failed to send suspicious activity Slack message")
+		}
+	}
+}
+
+func postSlackAlert(slackURL, siteURL string, alert *SuspiciousActivityAlert, log logrus.FieldLogger) error {
+	text := fmt.Sprintf("Suspicious activity on %s: %d occurrences of `%s`", siteURL, alert.Count, alert.Activity)
+	if alert.Key != "" {
+		text += fmt.Sprintf(" from %s", alert.Key)
+	}
+	text += fmt.Sprintf(" within %s", alert.Window)
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	client := SafeHTTPClient(&http.Client{Timeout: defaultTimeout}, log)
+	client.Transport = &breaker.Transport{Prefix: "webhook ", Inner: client.Transport}
+	rsp, err := client.Post(slackURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+	}
+	return nil
+}
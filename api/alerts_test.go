@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityMonitorAggregatesAlerts(t *testing.T) {
+	m := newActivityMonitor()
+	instanceID := uuid.Must(uuid.NewV4())
+
+	for i := 0; i < 2; i++ {
+		alert := m.record(instanceID, MassSignupActivity, "192.0.2.1", 3, time.Minute, map[string]interface{}{"n": i})
+		assert.Nil(t, alert)
+	}
+
+	// a different key is counted separately
+	assert.Nil(t, m.record(instanceID, MassSignupActivity, "192.0.2.2", 3, time.Minute, nil))
+
+	alert := m.record(instanceID, MassSignupActivity, "192.0.2.1", 3, time.Minute, map[string]interface{}{"n": 2})
+	require.NotNil(t, alert)
+	assert.Equal(t, 3, alert.Count)
+	assert.Equal(t, "192.0.2.1", alert.Key)
+	assert.Len(t, alert.Samples, 3)
+
+	// only one alert is sent per window
+	assert.Nil(t, m.record(instanceID, MassSignupActivity, "192.0.2.1", 3, time.Minute, nil))
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
+)
+
+// anonymousProvider is the provider of users who signed in without credentials.
+const anonymousProvider = "anonymous"
+
+// signupAnonymous creates a user without credentials and signs it in, so apps
+// can let guests in before they sign up. The user keeps its id when it later
+// adds an email address, phone number or identity.
+func (a *API) signupAnonymous(w http.ResponseWriter, r *http.Request, params *SignupParams) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.External.AnonymousUsers.Enabled {
+		return badRequestError("Anonymous sign-ins are disabled")
+	}
+	if params.Email != "" || params.Phone != "" || params.Password != "" {
+		return badRequestError("Anonymous sign-ins don't take an email, phone or password")
+	}
+	if params.Data == nil {
+		params.Data = make(map[string]interface{})
+	}
+	if rejected := restrictUserMetaData(config, params.Data); len(rejected) > 0 {
+		return unprocessableEntityError("User metadata keys are not allowed: %s", strings.Join(rejected, ", "))
+	}
+	params.Provider = anonymousProvider
+
+	var user *models.User
+	var token *AccessTokenResponse
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if user, terr = a.signupNewUser(ctx, tx, params); terr != nil {
+			return terr
+		}
+		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.UserSignedUpAction, "", map[string]interface{}{
+			"provider": params.Provider,
+		}); terr != nil {
+			return terr
+		}
+		if terr = triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); terr != nil {
+			return terr
+		}
+
+		if token, terr = a.issueRefreshToken(ctx, r, tx, user, anonymousGrant); terr != nil {
+			return terr
+		}
+		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
+			return internalServerError("Failed to set JWT cookie. %s", terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.recordAuthEvent(ctx, user.Aud, signupAuthEvent)
+	a.emitLifecycleEvent(ctx, UserCreatedEvent, user)
+	ipAddress := utilities.GetIPAddress(r)
+	a.reportSuspiciousActivity(ctx, MassSignupActivity, ipAddress, map[string]interface{}{
+		"user_id":    user.ID,
+		"ip_address": ipAddress,
+	})
+	metering.RecordLogin(anonymousProvider, user.ID, instanceID)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, anonymousGrant))
+	a.recordSignIn(r, user)
+	return sendToken(w, r, token)
+}
+
+// upgradeAnonymousUser turns an anonymous user into a regular user once it
+// confirmed an email address or phone number, or linked an identity of
+// providerType. Users who aren't anonymous are left alone.
+func (a *API) upgradeAnonymousUser(r *http.Request, tx *storage.Connection, user *models.User, providerType string) error {
+	if !user.IsAnonymous {
+		return nil
+	}
+
+	if providerType == "email" || providerType == "phone" {
+		if _, err := a.createNewIdentity(tx, user, providerType, map[string]interface{}{"sub": user.ID.String()}); err != nil {
+			return err
+		}
+	}
+	if err := user.UpgradeAnonymous(tx); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	if err := user.UpdateAppMetaData(tx, map[string]interface{}{
+		"provider": providerType,
+	}); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	if err := user.UpdateAppMetaDataProviders(tx); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return models.NewAuditLogEntry(r, tx, getInstanceID(r.Context()), user, models.UserUpgradedAction, "", map[string]interface{}{
+		"provider": providerType,
+	})
+}
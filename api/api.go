@@ -9,14 +9,14 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/didip/tollbooth/v5"
-	"github.com/didip/tollbooth/v5/limiter"
 	"github.com/go-chi/chi"
 	"github.com/gofrs/uuid"
 	"github.com/imdario/mergo"
+	"github.com/netlify/gotrue/api/provider"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/mailer"
+	"github.com/netlify/gotrue/security"
 	"github.com/netlify/gotrue/storage"
 	"github.com/rs/cors"
 	"github.com/sebest/xff"
@@ -30,12 +30,24 @@ const (
 
 var bearerRegexp = regexp.MustCompile(`^(?:B|b)earer (\S+$)`)
 
+// accessTokenRegexp also accepts the DPoP scheme used for DPoP-bound access tokens.
+var accessTokenRegexp = regexp.MustCompile(`^((?:B|b)earer|DPoP) (\S+$)`)
+
 // API is the main REST API
 type API struct {
-	handler http.Handler
-	db      *storage.Connection
-	config  *conf.GlobalConfiguration
-	version string
+	handler      http.Handler
+	db           *storage.Connection
+	config       *conf.GlobalConfiguration
+	version      string
+	riskVelocity *security.VelocityTracker
+	activity     *activityMonitor
+	authEvents   *authEventCounters
+
+	tokenEventDeliveries     chan struct{}
+	lifecycleEventDeliveries chan struct{}
+
+	// baseContext holds the instance config in single instance mode, for work done outside of requests
+	baseContext context.Context
 }
 
 // ListenAndServe starts the REST API
@@ -48,6 +60,7 @@ func (a *API) ListenAndServe(hostAndPort string) {
 
 	done := make(chan struct{})
 	defer close(done)
+	go a.runBackgroundJobs(done)
 	go func() {
 		waitForTermination(log, done)
 		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
@@ -79,7 +92,9 @@ func NewAPI(globalConfig *conf.GlobalConfiguration, db *storage.Connection) *API
 
 // NewAPIWithVersion creates a new REST API using the specified version
 func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfiguration, db *storage.Connection, version string) *API {
-	api := &API{config: globalConfig, db: db, version: version}
+	api := &API{config: globalConfig, db: db, version: version, riskVelocity: security.NewVelocityTracker(), activity: newActivityMonitor(), authEvents: newAuthEventCounters(), tokenEventDeliveries: make(chan struct{}, maxTokenEventDeliveries), lifecycleEventDeliveries: make(chan struct{}, maxLifecycleEventDeliveries), baseContext: ctx}
+
+	provider.SetKeyCacheTTL(globalConfig.JWKSCacheTTL)
 
 	xffmw, _ := xff.Default()
 	logger := logger.NewStructuredLogger(logrus.StandardLogger())
@@ -94,22 +109,29 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 
 	r.Route("/callback", func(r *router) {
 		r.UseBypass(logger)
+		r.Use(api.blockAutomatedClients)
+		r.Use(noCache)
 		r.Use(api.loadOAuthState)
 
 		if globalConfig.MultiInstanceMode {
 			r.Use(api.loadInstanceConfig)
 		}
+		r.Use(api.setSecurityHeaders)
 		r.Get("/", api.ExternalProviderCallback)
 		r.Post("/", api.ExternalProviderCallback)
 	})
 
 	r.Route("/", func(r *router) {
 		r.UseBypass(logger)
+		r.Use(api.loadAPIVersion)
+		r.Use(api.blockAutomatedClients)
 
 		if globalConfig.MultiInstanceMode {
 			r.Use(api.loadJWSSignatureHeader)
 			r.Use(api.loadInstanceConfig)
 		}
+		r.Use(api.loadClientFingerprint)
+		r.Use(api.setSecurityHeaders)
 
 		r.Get("/settings", api.Settings)
 
@@ -117,29 +139,39 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 
 		sharedLimiter := api.limitEmailSentHandler()
 		r.With(sharedLimiter).With(api.requireAdminCredentials).Post("/invite", api.Invite)
-		r.With(sharedLimiter).With(api.verifyCaptcha).Post("/signup", api.Signup)
-		r.With(sharedLimiter).With(api.verifyCaptcha).With(api.requireEmailProvider).Post("/recover", api.Recover)
-		r.With(sharedLimiter).With(api.verifyCaptcha).Post("/magiclink", api.MagicLink)
+		r.With(sharedLimiter).With(api.verifyCaptcha(conf.CaptchaEndpointSignup)).With(api.assessRisk).With(noCache).Post("/signup", api.Signup)
+		r.With(sharedLimiter).With(api.verifyCaptcha(conf.CaptchaEndpointRecover)).With(api.requireEmailProvider).Post("/recover", api.Recover)
+		r.With(sharedLimiter).With(api.verifyCaptcha(conf.CaptchaEndpointMagicLink)).With(api.assessRisk).Post("/magiclink", api.MagicLink)
 
-		r.With(sharedLimiter).With(api.verifyCaptcha).Post("/otp", api.Otp)
+		r.With(sharedLimiter).With(api.verifyCaptcha(conf.CaptchaEndpointOtp)).With(api.assessRisk).Post("/otp", api.Otp)
 
 		r.With(api.limitHandler(
 			// Allow requests at the specified rate per 5 minutes.
-			tollbooth.NewLimiter(api.config.RateLimitTokenRefresh/(60*5), &limiter.ExpirableOptions{
-				DefaultExpirationTTL: time.Hour,
-			}).SetBurst(30),
-		)).With(api.verifyCaptcha).Post("/token", api.Token)
+			newRateLimiter(api.config.RateLimitTokenRefresh/(60*5), 30, time.Hour),
+		)).With(api.padAuthFailures).With(api.verifyCaptcha(conf.CaptchaEndpointToken)).With(api.assessRisk).With(noCache).With(api.loadDPoPProof).Post("/token", api.Token)
 
 		r.With(api.limitHandler(
 			// Allow requests at the specified rate per 5 minutes.
-			tollbooth.NewLimiter(api.config.RateLimitVerify/(60*5), &limiter.ExpirableOptions{
-				DefaultExpirationTTL: time.Hour,
-			}).SetBurst(30),
+			newRateLimiter(api.config.RateLimitVerify/(60*5), 30, time.Hour),
 		)).Route("/verify", func(r *router) {
+			r.Use(api.padAuthFailures)
+			r.Use(noCache)
 			r.Get("/", api.Verify)
-			r.With(api.verifyCaptcha).Post("/", api.Verify)
+			r.With(api.verifyCaptcha(conf.CaptchaEndpointVerify)).Post("/", api.Verify)
 		})
 
+		r.With(api.limitHandler(
+			// Allow requests at the specified rate per 5 minutes.
+			newRateLimiter(api.config.RateLimitTokenRefresh/(60*5), 30, time.Hour),
+		)).With(api.requireKerberos).With(noCache).Get("/sso/kerberos", api.KerberosSignIn)
+
+		r.With(api.padAuthFailures).With(noCache).Post("/introspect", api.Introspect)
+
+		r.With(api.limitHandler(
+			// Allow requests at the specified rate per 5 minutes.
+			newRateLimiter(api.config.RateLimitTokenRefresh/(60*5), 30, time.Hour),
+		)).With(noCache).Post("/revoke", api.Revoke)
+
 		r.With(api.requireAuthentication).Post("/logout", api.Logout)
 
 		r.Route("/reauthenticate", func(r *router) {
@@ -151,6 +183,35 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 			r.Use(api.requireAuthentication)
 			r.Get("/", api.UserGet)
 			r.With(sharedLimiter).Put("/", api.UserUpdate)
+			r.Get("/identities", api.UserIdentities)
+			r.Post("/identities", api.UserIdentityLink)
+			r.Delete("/identities/{identity_id}", api.UserIdentityUnlink)
+			r.Post("/erasure", api.UserErasureRequest)
+			r.Get("/erasure", api.UserErasureGet)
+			r.Delete("/erasure", api.UserErasureCancel)
+			r.Get("/profile", api.UserProfileGet)
+			r.With(sharedLimiter).Put("/profile", api.UserProfileUpdate)
+		})
+
+		r.With(api.requireAuthentication).Get("/userinfo", api.UserInfo)
+
+		r.Route("/sessions", func(r *router) {
+			r.Use(api.requireAuthentication)
+			r.Get("/", api.UserSessions)
+			r.Delete("/{session_id}", api.UserSessionRevoke)
+		})
+
+		r.Route("/users/{user_id}/app_metadata", func(r *router) {
+			r.Use(api.requireAuthentication)
+			r.Use(api.requireDelegatedRole)
+			r.Use(api.loadUser)
+			r.Put("/", api.delegatedAppMetadataUpdate)
+		})
+
+		r.Route("/pages", func(r *router) {
+			r.Get("/"+landingPage, api.hostedPage(landingPage))
+			r.Get("/"+expiredLinkPage, api.hostedPage(expiredLinkPage))
+			r.Get("/"+resetPasswordPage, api.hostedPage(resetPasswordPage))
 		})
 
 		r.Route("/admin", func(r *router) {
@@ -163,21 +224,126 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 			r.Route("/users", func(r *router) {
 				r.Get("/", api.adminUsers)
 				r.Post("/", api.adminUserCreate)
+				r.Post("/import", api.adminUserImport)
+				r.Get("/banned", api.adminBannedUsers)
 
 				r.Route("/{user_id}", func(r *router) {
 					r.Use(api.loadUser)
 
 					r.Get("/", api.adminUserGet)
+					r.Get("/timeline", api.adminUserTimeline)
+					r.Get("/audit", api.adminUserAuditLog)
 					r.Put("/", api.adminUserUpdate)
 					r.Delete("/", api.adminUserDelete)
+					r.Post("/anonymize", api.adminUserAnonymize)
+					r.Post("/merge", api.adminUserMerge)
+					r.With(sharedLimiter).Post("/recover", api.adminUserRecover)
+					r.Post("/roles", api.adminUserRolesGrant)
+					r.Delete("/roles/{role}", api.adminUserRoleRevoke)
+					r.Get("/sessions", api.adminUserSessions)
+					r.Delete("/sessions", api.adminUserSessionsRevoke)
+					r.Delete("/sessions/{session_id}", api.adminUserSessionRevoke)
 				})
 			})
 
+			r.Post("/logout", api.adminLogoutAll)
+			r.Post("/sessions/migrate", api.adminSessionMigrate)
+			r.Get("/migrations", api.adminMigrations)
+			r.Get("/refresh_tokens/{token_id}/family", api.adminRefreshTokenFamily)
+
+			r.Get("/erasures", api.adminErasureRequests)
+
+			r.Get("/sms_usage", api.adminSmsUsage)
+			r.Get("/auth_events", api.adminAuthEvents)
+			r.Post("/webhooks/test", api.adminWebhookTest)
+			r.Get("/sandbox/messages", api.adminSandboxMessages)
+
+			r.Route("/test/clock", func(r *router) {
+				r.Get("/", api.adminTestClock)
+				r.Put("/", api.adminTestClockUpdate)
+				r.Delete("/", api.adminTestClockReset)
+			})
+
 			r.Post("/generate_link", api.GenerateLink)
+
+			r.Route("/actions", func(r *router) {
+				r.Get("/", api.adminActions)
+
+				r.Route("/{action_id}", func(r *router) {
+					r.Use(api.loadAdminAction)
+					r.Post("/approve", api.adminActionApprove)
+				})
+			})
+
+			r.Route("/service_accounts", func(r *router) {
+				r.Get("/", api.adminServiceAccounts)
+				r.Post("/", api.adminServiceAccountCreate)
+
+				r.Route("/{service_account_id}", func(r *router) {
+					r.Use(api.loadServiceAccount)
+
+					r.Get("/", api.adminServiceAccountGet)
+					r.Put("/", api.adminServiceAccountUpdate)
+					r.Delete("/", api.adminServiceAccountDelete)
+				})
+			})
+
+			r.Get("/settings/full", api.adminSettingsFull)
+
+			r.Route("/sso/providers", func(r *router) {
+				r.Get("/", api.adminSSOProviders)
+				r.Post("/", api.adminSSOProviderCreate)
+
+				r.Route("/{sso_provider_id}", func(r *router) {
+					r.Use(api.loadSSOProvider)
+
+					r.Get("/", api.adminSSOProviderGet)
+					r.Put("/", api.adminSSOProviderUpdate)
+					r.Delete("/", api.adminSSOProviderDelete)
+				})
+			})
+
+			r.Post("/oauth/initial_access_tokens", api.adminOAuthInitialAccessToken)
+			r.Delete("/oauth/initial_access_tokens/{token_id}", api.adminOAuthInitialAccessTokenRevoke)
+
+			r.Route("/oauth/clients", func(r *router) {
+				r.Get("/", api.adminOAuthClients)
+				r.Post("/", api.adminOAuthClientCreate)
+
+				r.Route("/{client_id}", func(r *router) {
+					r.Use(api.loadOAuthClient)
+
+					r.Get("/", api.adminOAuthClientGet)
+					r.Put("/", api.adminOAuthClientUpdate)
+					r.Delete("/", api.adminOAuthClientDelete)
+				})
+			})
 		})
 
+		r.Route("/oauth", func(r *router) {
+			r.Use(api.requireOAuthServer)
+
+			r.Get("/authorize", api.OAuthAuthorize)
+			r.Post("/register", api.OAuthRegister)
+			r.With(noCache).Post("/token", api.OAuthToken)
+			r.With(api.requireOAuthAccessToken).Get("/userinfo", api.OAuthUserInfo)
+			r.Get("/jwks", api.OAuthJWKS)
+
+			r.Route("/authorizations/{authorization_id}", func(r *router) {
+				r.Use(api.requireAuthentication)
+				r.Use(api.loadOAuthAuthorization)
+
+				r.Get("/", api.OAuthAuthorizationGet)
+				r.Post("/consent", api.OAuthConsent)
+			})
+		})
+
+		r.With(api.requireOAuthServer).Get("/.well-known/openid-configuration", api.OAuthDiscovery)
+		r.Get("/.well-known/jwks.json", api.JWKS)
+
 		r.Route("/saml", func(r *router) {
 			r.Route("/acs", func(r *router) {
+				r.Use(noCache)
 				r.Use(api.loadSAMLState)
 				r.Post("/", api.ExternalProviderCallback)
 			})
@@ -193,20 +359,24 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 			r.UseBypass(logger)
 
 			r.Post("/", api.CreateInstance)
+			r.Post("/validate", api.ValidateInstance)
 			r.Route("/{instance_id}", func(r *router) {
 				r.Use(api.loadInstance)
 
 				r.Get("/", api.GetInstance)
 				r.Put("/", api.UpdateInstance)
 				r.Delete("/", api.DeleteInstance)
+				r.Post("/validate", api.ValidateInstance)
 			})
 		})
 	}
 
 	corsHandler := cors.New(cors.Options{
 		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", audHeaderName, useCookieHeader},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", audHeaderName, useCookieHeader, dpopHeader, deviceIDHeader, APIVersionHeader},
+		ExposedHeaders:   []string{requestIDHeader, rateLimitLimitHeader, rateLimitRemainingHeader, rateLimitResetHeader, "Retry-After", APIVersionHeader},
 		AllowCredentials: true,
+		MaxAge:           globalConfig.API.CORSMaxAge,
 	})
 
 	api.handler = corsHandler.Handler(chi.ServerBaseContext(ctx, r))
@@ -257,7 +427,13 @@ func WithInstanceConfig(ctx context.Context, config *conf.Configuration, instanc
 // Mailer returns NewMailer with the current tenant config
 func (a *API) Mailer(ctx context.Context) mailer.Mailer {
 	config := a.getConfig(ctx)
-	return mailer.NewMailer(config)
+	return mailer.NewMailerWithContext(ctx, config, logrus.WithField("request_id", getRequestID(ctx)))
+}
+
+// getDB returns the connection to run the queries of the request of ctx on,
+// which traces them as part of the request's span.
+func (a *API) getDB(ctx context.Context) *storage.Connection {
+	return a.db.WithContext(ctx)
 }
 
 func (a *API) getConfig(ctx context.Context) *conf.Configuration {
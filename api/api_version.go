@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/models"
+)
+
+// APIVersionHeader selects the shape of responses. Breaking changes to
+// response shapes ship behind a new version, so clients that don't send the
+// header keep the shape they were written against.
+const APIVersionHeader = "X-API-Version"
+
+const (
+	// apiVersion1 is the original response shape.
+	apiVersion1 = 1
+	// apiVersion2 adds error codes to errors and nests the tokens of token
+	// responses in a session object.
+	apiVersion2 = 2
+
+	latestAPIVersion = apiVersion2
+)
+
+// httpErrorCodes are the error codes of errors in version 2, by status.
+var httpErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "validation_failed",
+	http.StatusTooManyRequests:     "over_rate_limit",
+	http.StatusInternalServerError: "unexpected_failure",
+}
+
+// loadAPIVersion reads the API version requested by the client and echoes it
+// in the response.
+func (a *API) loadAPIVersion(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	header := strings.TrimSpace(r.Header.Get(APIVersionHeader))
+	if header == "" {
+		return ctx, nil
+	}
+	version, err := strconv.Atoi(header)
+	if err != nil || version < apiVersion1 || version > latestAPIVersion {
+		return nil, badRequestError("Unsupported %s %q, expected 1 to %d", APIVersionHeader, header, latestAPIVersion)
+	}
+	w.Header().Set(APIVersionHeader, strconv.Itoa(version))
+	return withAPIVersion(ctx, version), nil
+}
+
+// sessionResponse is the session object of token responses in version 2.
+type sessionResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	ExpiresAt    int64  `json:"expires_at"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type sessionTokenResponse struct {
+	Session       *sessionResponse `json:"session"`
+	User          *models.User     `json:"user"`
+	MissingFields []string         `json:"missing_fields,omitempty"`
+}
+
+// sendToken sends a token response in the shape of the requested API version.
+func sendToken(w http.ResponseWriter, r *http.Request, token *AccessTokenResponse) error {
+	if config := getConfig(r.Context()); config != nil {
+		token.MissingFields = missingProfileFields(config, token.User)
+	}
+	if getAPIVersion(r.Context()) < apiVersion2 {
+		return sendJSON(w, http.StatusOK, token)
+	}
+	return sendJSON(w, http.StatusOK, &sessionTokenResponse{
+		Session: &sessionResponse{
+			AccessToken:  token.Token,
+			TokenType:    token.TokenType,
+			ExpiresIn:    token.ExpiresIn,
+			ExpiresAt:    clock.Now().Add(time.Duration(token.ExpiresIn) * time.Second).Unix(),
+			RefreshToken: token.RefreshToken,
+		},
+		User:          token.User,
+		MissingFields: token.MissingFields,
+	})
+}
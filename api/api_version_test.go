@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAPIVersion(t *testing.T) {
+	api := &API{}
+	cases := map[string]int{
+		"":  apiVersion1,
+		"1": apiVersion1,
+		"2": apiVersion2,
+	}
+	for header, expected := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		req.Header.Set(APIVersionHeader, header)
+		ctx, err := api.loadAPIVersion(httptest.NewRecorder(), req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, getAPIVersion(ctx), header)
+	}
+
+	for _, header := range []string{"0", "3", "v2"} {
+		req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		req.Header.Set(APIVersionHeader, header)
+		_, err := api.loadAPIVersion(httptest.NewRecorder(), req)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestSendTokenVersions(t *testing.T) {
+	token := &AccessTokenResponse{Token: "access", TokenType: "bearer", ExpiresIn: 3600, RefreshToken: "refresh", User: &models.User{}}
+
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, sendToken(w, req, token))
+	body := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, "access", body["access_token"])
+	assert.Nil(t, body["session"])
+
+	req = req.WithContext(withAPIVersion(req.Context(), apiVersion2))
+	w = httptest.NewRecorder()
+	require.NoError(t, sendToken(w, req, token))
+	body = map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Nil(t, body["access_token"])
+	session, ok := body["session"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "access", session["access_token"])
+	assert.Equal(t, "refresh", session["refresh_token"])
+	assert.NotZero(t, session["expires_at"])
+	assert.NotNil(t, body["user"])
+}
+
+func TestErrorCodeVersions(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	w := httptest.NewRecorder()
+	handleError(notFoundError("User not found"), w, req)
+	assert.NotContains(t, w.Body.String(), "error_code")
+
+	req = req.WithContext(withAPIVersion(req.Context(), apiVersion2))
+	w = httptest.NewRecorder()
+	handleError(notFoundError("User not found"), w, req)
+	e := &HTTPError{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(e))
+	assert.Equal(t, "not_found", e.ErrorCode)
+	assert.Equal(t, "User not found", e.Message)
+}
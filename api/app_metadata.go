@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	sortpkg "sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// requireDelegatedRole lets through the tokens of the roles the app_metadata
+// updates are delegated to.
+func (a *API) requireDelegatedRole(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	claims := getClaims(ctx)
+	if claims == nil {
+		return nil, unauthorizedError("Invalid token")
+	}
+	if !a.getConfig(ctx).AppMetadata.IsDelegatedRole(claims.Role) {
+		return nil, forbiddenError("This token is not allowed to update app_metadata")
+	}
+	return ctx, nil
+}
+
+// delegatedAppMetadataUpdate updates the delegated app_metadata keys of a
+// user. Only admins may update the other keys, with the admin API. A null
+// value removes the key.
+func (a *API) delegatedAppMetadataUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	claims := getClaims(ctx)
+	user := getUser(ctx)
+
+	updates := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		return badRequestError("Could not read app_metadata: %v", err)
+	}
+	if len(updates) == 0 {
+		return unprocessableEntityError("No app_metadata keys to update")
+	}
+
+	keys := make([]string, 0, len(updates))
+	rejected := []string{}
+	for key := range updates {
+		keys = append(keys, key)
+		if !config.AppMetadata.IsDelegatedKey(key) {
+			rejected = append(rejected, key)
+		}
+	}
+	sortpkg.Strings(keys)
+	sortpkg.Strings(rejected)
+	if len(rejected) > 0 {
+		return forbiddenError("app_metadata keys are not delegated: %s", strings.Join(rejected, ", ")).WithDetails(map[string]interface{}{
+			"reason": "app_metadata_key_not_delegated",
+			"keys":   rejected,
+		})
+	}
+
+	// the token of a service account has its id as the subject
+	actor := &models.User{InstanceID: instanceID, Role: claims.Role, Email: storage.NullString(claims.Role)}
+	if id, err := uuid.FromString(claims.Subject); err == nil {
+		actor.ID = id
+	}
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := user.UpdateAppMetaData(tx, updates); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, actor, models.UserModifiedAction, "", map[string]interface{}{
+			"user_id":           user.ID,
+			"user_email":        user.Email,
+			"app_metadata_keys": keys,
+		})
+	})
+	if err != nil {
+		return internalServerError("Error updating user").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, user)
+}
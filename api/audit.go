@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/netlify/gotrue/models"
 )
@@ -35,7 +36,7 @@ func (a *API) adminAuditLog(w http.ResponseWriter, r *http.Request) error {
 		qval = qparts[1]
 	}
 
-	logs, err := models.FindAuditLogEntries(a.db, instanceID, col, qval, pageParams)
+	logs, err := models.FindAuditLogEntries(a.getDB(ctx), instanceID, col, qval, pageParams)
 	if err != nil {
 		return internalServerError("Error searching for audit logs").WithInternalError(err)
 	}
@@ -44,3 +45,47 @@ func (a *API) adminAuditLog(w http.ResponseWriter, r *http.Request) error {
 
 	return sendJSON(w, http.StatusOK, logs)
 }
+
+// adminUserAuditLog responds with the audit log entries of a single user, so
+// support can look into an account without searching the whole audit log.
+func (a *API) adminUserAuditLog(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r.Context())
+	query := r.URL.Query()
+
+	pageParams, err := paginate(r)
+	if err != nil {
+		return badRequestError("Bad Pagination Parameters: %v", err)
+	}
+
+	filter := models.AuditLogFilter{
+		Action:  query.Get("action"),
+		LogType: query.Get("type"),
+	}
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			return badRequestError("since must be an RFC 3339 timestamp")
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			return badRequestError("until must be an RFC 3339 timestamp")
+		}
+	}
+
+	logs, err := models.FindUserAuditLogEntries(a.getDB(r.Context()), user, filter, pageParams)
+	if err != nil {
+		return internalServerError("Error searching for audit logs").WithInternalError(err)
+	}
+	if err := a.auditAdminRead(r, models.UserViewedAction, map[string]interface{}{
+		"user_id":  user.ID,
+		"view":     "audit",
+		"page":     pageParams.Page,
+		"per_page": pageParams.PerPage,
+	}); err != nil {
+		return err
+	}
+
+	addPaginationHeaders(w, r, pageParams)
+
+	return sendJSON(w, http.StatusOK, logs)
+}
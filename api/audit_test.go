@@ -133,3 +133,45 @@ func (ts *AuditTestSuite) prepareDeleteEvent() {
 	ts.API.handler.ServeHTTP(w, req)
 	require.Equal(ts.T(), http.StatusOK, w.Code)
 }
+
+func (ts *AuditTestSuite) TestUserAuditLog() {
+	u, err := models.NewUser(ts.instanceID, "", "test-audit@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	other, err := models.NewUser(ts.instanceID, "", "test-other@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(other))
+
+	admin := &models.User{ID: uuid.Nil, Role: "supabase_admin", Email: "supabase_admin"}
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, u, models.LoginAction, "", nil))
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, admin, models.UserModifiedAction, "", map[string]interface{}{
+		"user_id": u.ID,
+	}))
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, other, models.LoginAction, "", nil))
+
+	get := func(query string) []models.AuditLogEntry {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/users/%s/audit%s", u.ID, query), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+		logs := []models.AuditLogEntry{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&logs))
+		return logs
+	}
+
+	assert.Len(ts.T(), get(""), 2)
+
+	logs := get("?action=" + string(models.UserModifiedAction))
+	require.Len(ts.T(), logs, 1)
+	assert.Equal(ts.T(), "supabase_admin", logs[0].Payload["actor_username"])
+
+	assert.Len(ts.T(), get("?type=account"), 1)
+	assert.Len(ts.T(), get("?since="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)), 0)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/users/%s/audit?since=yesterday", u.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
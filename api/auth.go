@@ -6,21 +6,54 @@ import (
 	"net/http"
 	"time"
 
-	jwt "github.com/golang-jwt/jwt"
+	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
 )
 
 // requireAuthentication checks incoming requests for tokens presented using the Authorization header
 func (a *API) requireAuthentication(w http.ResponseWriter, r *http.Request) (context.Context, error) {
-	token, err := a.extractBearerToken(w, r)
+	scheme, token, err := a.extractAccessToken(r)
 	config := getConfig(r.Context())
 	if err != nil {
 		a.clearCookieTokens(config, w)
 		return nil, err
 	}
 
-	return a.parseJWTClaims(token, r, w)
+	ctx, err := a.parseJWTClaims(token, r, w)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkDPoPBinding(r, scheme, token, getClaims(ctx)); err != nil {
+		a.clearCookieTokens(config, w)
+		return nil, err
+	}
+	if err := a.checkSession(ctx); err != nil {
+		a.clearCookieTokens(config, w)
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// checkSession rejects the access tokens of revoked sessions, so signing a
+// user out of a session takes effect before its tokens expire.
+func (a *API) checkSession(ctx context.Context) error {
+	claims := getClaims(ctx)
+	if claims.SessionID == "" {
+		return nil
+	}
+	sessionID, err := uuid.FromString(claims.SessionID)
+	if err != nil {
+		return unauthorizedError("Invalid token: invalid session")
+	}
+	exists, err := models.SessionExists(a.getDB(ctx), getInstanceID(ctx), sessionID)
+	if err != nil {
+		return internalServerError("Database error finding session").WithInternalError(err)
+	}
+	if !exists {
+		return unauthorizedError("Invalid token: session was revoked")
+	}
+	return nil
 }
 
 func (a *API) requireAdmin(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, error) {
@@ -56,18 +89,39 @@ func (a *API) extractBearerToken(w http.ResponseWriter, r *http.Request) (string
 	return matches[1], nil
 }
 
+// extractAccessToken returns the access token and the scheme it was presented
+// with, which is either Bearer or, for DPoP-bound tokens, DPoP.
+func (a *API) extractAccessToken(r *http.Request) (string, string, error) {
+	matches := accessTokenRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+	if len(matches) != 3 {
+		return "", "", unauthorizedError("This endpoint requires a Bearer token")
+	}
+	return matches[1], matches[2], nil
+}
+
 func (a *API) parseJWTClaims(bearer string, r *http.Request, w http.ResponseWriter) (context.Context, error) {
 	ctx := r.Context()
 	config := a.getConfig(ctx)
 
-	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
-	token, err := p.ParseWithClaims(bearer, &GoTrueClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWT.Secret), nil
-	})
+	token, err := parseAccessToken(&config.JWT, bearer, &GoTrueClaims{})
 	if err != nil {
 		a.clearCookieTokens(config, w)
 		return nil, unauthorizedError("Invalid token: %v", err)
 	}
+	if !a.isFirstPartyToken(token.Claims.(*GoTrueClaims)) {
+		a.clearCookieTokens(config, w)
+		return nil, unauthorizedError("Invalid token: not issued for this API")
+	}
 
 	return withToken(ctx, token), nil
 }
+
+// isFirstPartyToken returns false for tokens GoTrue issues to third parties,
+// such as OAuth clients, partners registering a client or services a token
+// was delegated to, in case one of them was signed with the JWT secret.
+func (a *API) isFirstPartyToken(claims *GoTrueClaims) bool {
+	if claims.ClientID != "" || claims.Actor != nil || claims.Issuer == a.oauthIssuer() {
+		return false
+	}
+	return !claims.VerifyAudience(oauthRegistrationAudience, true) && !claims.VerifyAudience(sessionMigrationAudience, true)
+}
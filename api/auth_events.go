@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/metering"
+)
+
+// Auth events counted per audience.
+const (
+	signupAuthEvent      = "signup"
+	loginAuthEvent       = "login"
+	loginFailedAuthEvent = "login_failed"
+	otpSentAuthEvent     = "otp_sent"
+)
+
+const (
+	// authEventsMaxWindow is how long auth events are counted for
+	authEventsMaxWindow = 24 * time.Hour
+	// authEventsBucket is the resolution of the counters
+	authEventsBucket = time.Minute
+	// maxAuthEventAudiences bounds the audiences counted per instance, as
+	// clients choose the audience of their requests. Events of further
+	// audiences are counted under otherAuthEventAudience.
+	maxAuthEventAudiences  = 100
+	otherAuthEventAudience = "other"
+)
+
+type authEventBucket struct {
+	start time.Time
+	count int
+}
+
+// authEventCounters counts auth events per instance, audience and event in
+// buckets of a minute, so a single audience's abuse stands out. The counts are
+// kept in memory and only cover the requests served by this process.
+type authEventCounters struct {
+	mu        sync.Mutex
+	counters  map[uuid.UUID]map[string]map[string][]authEventBucket
+	lastSweep time.Time
+}
+
+func newAuthEventCounters() *authEventCounters {
+	return &authEventCounters{counters: make(map[uuid.UUID]map[string]map[string][]authEventBucket), lastSweep: time.Now()}
+}
+
+func (c *authEventCounters) record(instanceID uuid.UUID, aud, event string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	audiences, ok := c.counters[instanceID]
+	if !ok {
+		audiences = make(map[string]map[string][]authEventBucket)
+		c.counters[instanceID] = audiences
+	}
+	events, ok := audiences[aud]
+	if !ok {
+		if len(audiences) >= maxAuthEventAudiences {
+			aud = otherAuthEventAudience
+			events = audiences[aud]
+		}
+		if events == nil {
+			events = make(map[string][]authEventBucket)
+			audiences[aud] = events
+		}
+	}
+
+	start := now.Truncate(authEventsBucket)
+	buckets := events[event]
+	if n := len(buckets); n > 0 && buckets[n-1].start.Equal(start) {
+		buckets[n-1].count++
+	} else {
+		buckets = append(pruneAuthEventBuckets(buckets, now.Add(-authEventsMaxWindow)), authEventBucket{start: start, count: 1})
+	}
+	events[event] = buckets
+
+	// periodically drop the counters of idle audiences
+	cutoff := now.Add(-authEventsMaxWindow)
+	if c.lastSweep.Before(cutoff) {
+		for id, audiences := range c.counters {
+			for aud, events := range audiences {
+				for event, buckets := range events {
+					if buckets = pruneAuthEventBuckets(buckets, cutoff); len(buckets) == 0 {
+						delete(events, event)
+					} else {
+						events[event] = buckets
+					}
+				}
+				if len(events) == 0 {
+					delete(audiences, aud)
+				}
+			}
+			if len(audiences) == 0 {
+				delete(c.counters, id)
+			}
+		}
+		c.lastSweep = now
+	}
+}
+
+// counts returns the events of every audience of the instance within window.
+func (c *authEventCounters) counts(instanceID uuid.UUID, window time.Duration, now time.Time) map[string]map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := now.Add(-window).Truncate(authEventsBucket)
+	counts := make(map[string]map[string]int)
+	for aud, events := range c.counters[instanceID] {
+		audCounts := map[string]int{
+			signupAuthEvent:      0,
+			loginAuthEvent:       0,
+			loginFailedAuthEvent: 0,
+			otpSentAuthEvent:     0,
+		}
+		total := 0
+		for event, buckets := range events {
+			for _, b := range buckets {
+				if !b.start.Before(cutoff) {
+					audCounts[event] += b.count
+					total += b.count
+				}
+			}
+		}
+		if total > 0 {
+			counts[aud] = audCounts
+		}
+	}
+	return counts
+}
+
+func pruneAuthEventBuckets(buckets []authEventBucket, cutoff time.Time) []authEventBucket {
+	for i, b := range buckets {
+		if b.start.After(cutoff) {
+			return buckets[i:]
+		}
+	}
+	return buckets[:0]
+}
+
+// recordAuthEvent counts an auth event of the audience and meters it.
+func (a *API) recordAuthEvent(ctx context.Context, aud, event string) {
+	instanceID := getInstanceID(ctx)
+	a.authEvents.record(instanceID, aud, event, time.Now())
+	metering.RecordAuthEvent(event, aud, instanceID)
+}
+
+// adminAuthEvents returns the auth events per audience over the last window
+// (1h by default, at most 24h).
+func (a *API) adminAuthEvents(w http.ResponseWriter, r *http.Request) error {
+	instanceID := getInstanceID(r.Context())
+
+	window := time.Hour
+	if value := r.URL.Query().Get("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < authEventsBucket || d > authEventsMaxWindow {
+			return badRequestError("window must be a duration between %s and %s", authEventsBucket, authEventsMaxWindow)
+		}
+		window = d
+	}
+
+	counts := a.authEvents.counts(instanceID, window, time.Now())
+	if aud := r.URL.Query().Get("aud"); aud != "" {
+		filtered := make(map[string]map[string]int)
+		if audCounts, ok := counts[aud]; ok {
+			filtered[aud] = audCounts
+		}
+		counts = filtered
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"window":    window.String(),
+		"audiences": counts,
+	})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthEventCounters(t *testing.T) {
+	c := newAuthEventCounters()
+	instanceID := uuid.Must(uuid.NewV4())
+	now := time.Now()
+
+	c.record(instanceID, "app", signupAuthEvent, now.Add(-2*time.Hour))
+	c.record(instanceID, "app", loginAuthEvent, now.Add(-10*time.Minute))
+	c.record(instanceID, "app", loginAuthEvent, now)
+	c.record(instanceID, "partner", loginFailedAuthEvent, now)
+	c.record(instanceID, "partner", otpSentAuthEvent, now)
+	c.record(uuid.Must(uuid.NewV4()), "app", loginAuthEvent, now)
+
+	counts := c.counts(instanceID, time.Hour, now)
+	assert.Equal(t, map[string]map[string]int{
+		"app":     {signupAuthEvent: 0, loginAuthEvent: 2, loginFailedAuthEvent: 0, otpSentAuthEvent: 0},
+		"partner": {signupAuthEvent: 0, loginAuthEvent: 0, loginFailedAuthEvent: 1, otpSentAuthEvent: 1},
+	}, counts)
+
+	counts = c.counts(instanceID, 5*time.Minute, now)
+	assert.Equal(t, 1, counts["app"][loginAuthEvent])
+	assert.Equal(t, 1, c.counts(instanceID, authEventsMaxWindow, now)["app"][signupAuthEvent])
+
+	// events older than the longest window are dropped
+	c.record(instanceID, "app", loginAuthEvent, now.Add(authEventsMaxWindow))
+	counts = c.counts(instanceID, authEventsMaxWindow, now.Add(authEventsMaxWindow))
+	assert.Equal(t, 0, counts["app"][signupAuthEvent])
+	assert.Equal(t, 1, counts["app"][loginAuthEvent])
+
+	// the audiences clients pick can't grow the counters without bounds
+	flooded := uuid.Must(uuid.NewV4())
+	for i := 0; i < maxAuthEventAudiences+10; i++ {
+		c.record(flooded, fmt.Sprintf("aud-%d", i), loginFailedAuthEvent, now)
+	}
+	counts = c.counts(flooded, time.Hour, now)
+	assert.Len(t, counts, maxAuthEventAudiences+1)
+	assert.Equal(t, 10, counts[otherAuthEventAudience][loginFailedAuthEvent])
+}
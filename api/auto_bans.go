@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/security"
+	"github.com/netlify/gotrue/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// recordPolicyViolation counts a violation of a policy by user and bans the
+// user once SECURITY_AUTO_BANS_VIOLATIONS were counted within the window, for
+// longer with every automatic ban. Violations are counted from the last ban
+// on, so a user isn't banned again right after a ban ends. The request that
+// violated the policy fails anyway, so errors are only logged.
+func (a *API) recordPolicyViolation(ctx context.Context, config *conf.Configuration, user *models.User, reason, ipAddress string) {
+	autoBans := config.Security.AutoBans
+	if !autoBans.Enabled || user == nil {
+		return
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"component":   "auto_bans",
+		"request_id":  getRequestID(ctx),
+		"instance_id": user.InstanceID,
+		"user_id":     user.ID,
+		"reason":      reason,
+	})
+
+	event, err := models.NewSecurityEvent(user, models.PolicyViolationSecurityEvent, ipAddress, "", map[string]interface{}{
+		"reason": reason,
+	})
+	if err == nil {
+		err = a.getDB(ctx).Create(event)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to record policy violation")
+		return
+	}
+	if user.IsBanned() {
+		return
+	}
+
+	now := time.Now()
+	bans, err := models.FindSecurityEventsSince(a.getDB(ctx), user, models.AutoBanSecurityEvent, time.Time{})
+	if err != nil {
+		log.WithError(err).Error("Failed to load automatic bans")
+		return
+	}
+	since := now.Add(-autoBans.Window)
+	if len(bans) > 0 && bans[0].CreatedAt.After(since) {
+		since = bans[0].CreatedAt
+	}
+	violations, err := models.FindSecurityEventsSince(a.getDB(ctx), user, models.PolicyViolationSecurityEvent, since)
+	if err != nil {
+		log.WithError(err).Error("Failed to load policy violations")
+		return
+	}
+	if len(violations) < autoBans.Violations {
+		return
+	}
+
+	duration := autoBans.Duration(len(bans))
+	bannedUntil := clock.Now().Add(duration)
+	user.BannedUntil = &bannedUntil
+	user.BanReason = storage.NullString(reason)
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := user.UpdateBannedUntil(tx); terr != nil {
+			return terr
+		}
+		ban, terr := models.NewSecurityEvent(user, models.AutoBanSecurityEvent, ipAddress, "", map[string]interface{}{
+			"reason":   reason,
+			"duration": duration.String(),
+		})
+		if terr != nil {
+			return terr
+		}
+		if terr := tx.Create(ban); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(nil, tx, user.InstanceID, models.NewSystemUser(user.InstanceID, user.Aud), models.UserAutoBannedAction, ipAddress, map[string]interface{}{
+			"user_id":      user.ID,
+			"reason":       reason,
+			"violations":   len(violations),
+			"duration":     duration.String(),
+			"banned_until": bannedUntil,
+		})
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to ban user")
+		return
+	}
+	log.WithField("duration", duration.String()).Info("Banned user after policy violations")
+}
+
+// userFromRiskSignals finds the user the email or phone of a request belongs
+// to, if any. Requests failing before the handler only name the user.
+func (a *API) userFromRiskSignals(ctx context.Context, config *conf.Configuration, signals security.RiskSignals) *models.User {
+	instanceID := getInstanceID(ctx)
+	var user *models.User
+	var err error
+	if signals.Email != "" {
+		user, err = models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, signals.Email, config.JWT.Aud)
+	} else if signals.Phone != "" {
+		user, err = models.FindUserByPhoneAndAudience(a.getDB(ctx), instanceID, a.formatPhoneNumber(signals.Phone), config.JWT.Aud)
+	} else {
+		return nil
+	}
+	if err != nil {
+		if !models.IsNotFoundError(err) {
+			logrus.WithError(err).WithField("request_id", getRequestID(ctx)).Error("Failed to find user of policy violation")
+		}
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *AdminTestSuite) TestAutoBans() {
+	ts.Config.Security.AutoBans.Enabled = true
+	ts.Config.Security.AutoBans.Violations = 2
+	ts.Config.Security.AutoBans.Durations = []time.Duration{time.Hour, 24 * time.Hour}
+	defer func() {
+		ts.Config.Security.AutoBans.Enabled = false
+	}()
+
+	u, err := models.NewUser(ts.instanceID, "", "test-ban@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	ctx := context.Background()
+	ts.API.recordPolicyViolation(ctx, ts.Config, u, models.BanReasonOtpBruteForce, "127.0.0.1")
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), u.IsBanned())
+
+	ts.API.recordPolicyViolation(ctx, ts.Config, u, models.BanReasonCaptchaFailures, "127.0.0.1")
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), u.IsBanned())
+	assert.Equal(ts.T(), models.BanReasonCaptchaFailures, string(u.BanReason))
+	assert.WithinDuration(ts.T(), time.Now().Add(time.Hour), *u.BannedUntil, time.Minute)
+
+	// the next ban escalates once the user violates the policies again
+	past := time.Now().Add(-time.Minute)
+	u.BannedUntil = &past
+	require.NoError(ts.T(), u.UpdateBannedUntil(ts.API.db))
+	ts.API.recordPolicyViolation(ctx, ts.Config, u, models.BanReasonRiskScore, "127.0.0.1")
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), u.IsBanned(), "violations before the last ban don't count")
+	ts.API.recordPolicyViolation(ctx, ts.Config, u, models.BanReasonRiskScore, "127.0.0.1")
+	u, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), u.IsBanned())
+	assert.WithinDuration(ts.T(), time.Now().Add(24*time.Hour), *u.BannedUntil, time.Minute)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/users/banned", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := struct {
+		Users []*models.User `json:"users"`
+	}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Users, 1)
+	assert.Equal(ts.T(), u.ID, data.Users[0].ID)
+	assert.Equal(ts.T(), models.BanReasonRiskScore, string(data.Users[0].BanReason))
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	sortpkg "sort"
+	"strings"
+
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/utilities"
+)
+
+// headerFingerprint identifies the kind of client that sent r by the set of
+// headers it sent, which scripted clients rarely bother to vary. It is logged
+// with every request while header fingerprints are blocked, so operators can
+// find the fingerprints of unwanted traffic.
+func headerFingerprint(r *http.Request) string {
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sortpkg.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// blockAutomatedClients rejects requests from blocked user agents and header
+// fingerprints. It runs before the instance config is loaded, so obvious
+// scraping and bot traffic is shed before any database lookup, SMS or email.
+func (a *API) blockAutomatedClients(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	blocklist := &a.config.Blocklist
+	if len(blocklist.UserAgentGlobs) == 0 && len(blocklist.HeaderFingerprints) == 0 {
+		return r.Context(), nil
+	}
+
+	reason := ""
+	if blocklist.BlocksUserAgent(r.UserAgent()) {
+		reason = "user_agent"
+	} else if len(blocklist.HeaderFingerprints) > 0 {
+		fingerprint := headerFingerprint(r)
+		logger.LogEntrySetField(r, "header_fingerprint", fingerprint)
+		if isStringInSlice(fingerprint, blocklist.HeaderFingerprints) {
+			reason = "header_fingerprint"
+		}
+	}
+	if reason == "" {
+		return r.Context(), nil
+	}
+
+	metering.RecordBlockedRequest(reason, r.URL.Path, utilities.GetIPAddress(r))
+	return nil, forbiddenError("Request blocked")
+}
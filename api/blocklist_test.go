@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockAutomatedClients(t *testing.T) {
+	newRequest := func(userAgent string, headers ...string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/otp", nil)
+		req.Header.Set("User-Agent", userAgent)
+		for _, name := range headers {
+			req.Header.Set(name, "x")
+		}
+		return req
+	}
+
+	scripted := newRequest("curl/7.79.1", "Accept")
+	browser := newRequest("Mozilla/5.0", "Accept", "Accept-Language")
+	assert.Equal(t, headerFingerprint(scripted), headerFingerprint(newRequest("curl/8.0", "accept")))
+	assert.NotEqual(t, headerFingerprint(scripted), headerFingerprint(browser))
+
+	config := &conf.GlobalConfiguration{}
+	config.Blocklist.UserAgents = []string{"*Scrapy*"}
+	config.Blocklist.HeaderFingerprints = []string{headerFingerprint(scripted)}
+	require.NoError(t, config.Blocklist.Compile())
+	a := &API{config: config}
+
+	_, err := a.blockAutomatedClients(httptest.NewRecorder(), newRequest("scrapy/2.6 (+https://scrapy.org)"))
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, err.(*HTTPError).Code)
+
+	_, err = a.blockAutomatedClients(httptest.NewRecorder(), scripted)
+	assert.Error(t, err)
+
+	_, err = a.blockAutomatedClients(httptest.NewRecorder(), browser)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
+)
+
+// deviceIDHeader carries an id the client generates once per device and keeps
+// next to its refresh token.
+const deviceIDHeader = "X-Device-Id"
+
+// clientFingerprint hashes the device id and user agent of r, or returns an
+// empty string if the client didn't send a device id.
+func clientFingerprint(r *http.Request) string {
+	deviceID := r.Header.Get(deviceIDHeader)
+	if deviceID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(deviceID + "\n" + r.UserAgent()))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadClientFingerprint adds the fingerprint of the client to the context, so
+// refresh tokens issued to it are bound to it.
+func (a *API) loadClientFingerprint(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if !a.getConfig(ctx).Security.ClientBinding.Enabled {
+		return ctx, nil
+	}
+	if fingerprint := clientFingerprint(r); fingerprint != "" {
+		return withClientFingerprint(ctx, fingerprint), nil
+	}
+	return ctx, nil
+}
+
+// checkClientBinding makes sure a refresh token bound to a client is used by
+// that client, so a token copied out of the client's storage is useless
+// elsewhere. With SECURITY_CLIENT_BINDING_REPORT_ONLY mismatches are only
+// logged, which helps when clients change their user agent.
+func (a *API) checkClientBinding(r *http.Request, token *models.RefreshToken) error {
+	ctx := r.Context()
+	binding := a.getConfig(ctx).Security.ClientBinding
+	if !binding.Enabled || token.ClientFingerprint == "" {
+		return nil
+	}
+	if string(token.ClientFingerprint) == getClientFingerprint(ctx) {
+		return nil
+	}
+
+	logger.LogEntrySetField(r, "client_binding_mismatch", true)
+	if binding.ReportOnly {
+		logger.GetLogEntry(r).WithField("user_id", token.UserID).Warn("Refresh token used by a different client")
+		return nil
+	}
+	return oauthError("invalid_grant", "Refresh token is bound to a different client")
+}
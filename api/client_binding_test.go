@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientBinding(t *testing.T) {
+	a := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{}
+	config.Security.ClientBinding.Enabled = true
+
+	newRequest := func(deviceID, userAgent string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/token?grant_type=refresh_token", nil)
+		req.Header.Set(deviceIDHeader, deviceID)
+		req.Header.Set("User-Agent", userAgent)
+		req = req.WithContext(withConfig(req.Context(), config))
+		ctx, err := a.loadClientFingerprint(httptest.NewRecorder(), req)
+		require.NoError(t, err)
+		return req.WithContext(ctx)
+	}
+
+	signIn := newRequest("device-1", "Mozilla/5.0")
+	fingerprint := getClientFingerprint(signIn.Context())
+	require.NotEmpty(t, fingerprint)
+	token := &models.RefreshToken{ClientFingerprint: storage.NullString(fingerprint)}
+
+	assert.NoError(t, a.checkClientBinding(newRequest("device-1", "Mozilla/5.0"), token))
+	assert.Error(t, a.checkClientBinding(newRequest("device-2", "Mozilla/5.0"), token))
+	assert.Error(t, a.checkClientBinding(newRequest("device-1", "curl/7.79.1"), token))
+	assert.Error(t, a.checkClientBinding(newRequest("", "Mozilla/5.0"), token))
+
+	// unbound tokens keep working for clients that don't send a device id
+	assert.NoError(t, a.checkClientBinding(newRequest("", "Mozilla/5.0"), &models.RefreshToken{}))
+
+	config.Security.ClientBinding.ReportOnly = true
+	assert.NoError(t, a.checkClientBinding(newRequest("device-2", "Mozilla/5.0"), token))
+}
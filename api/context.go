@@ -2,10 +2,12 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt"
 	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/models"
 )
 
@@ -17,7 +19,8 @@ func (c contextKey) String() string {
 
 const (
 	tokenKey                = contextKey("jwt")
-	requestIDKey            = contextKey("request_id")
+	requestIDKey            = logger.RequestIDKey
+	traceIDKey              = logger.TraceIDKey
 	configKey               = contextKey("config")
 	inviteTokenKey          = contextKey("invite_token")
 	instanceIDKey           = contextKey("instance_id")
@@ -31,6 +34,17 @@ const (
 	adminUserKey            = contextKey("admin_user")
 	oauthTokenKey           = contextKey("oauth_token") // for OAuth1.0, also known as request token
 	oauthVerifierKey        = contextKey("oauth_verifier")
+	adminActionKey          = contextKey("admin_action")
+	oauthClientKey          = contextKey("oauth_client")
+	oauthAuthorizationKey   = contextKey("oauth_authorization")
+	dpopThumbprintKey       = contextKey("dpop_thumbprint")
+	clientFingerprintKey    = contextKey("client_fingerprint")
+	serviceAccountKey       = contextKey("service_account")
+	apiVersionKey           = contextKey("api_version")
+	authFailureDeadlineKey  = contextKey("auth_failure_deadline")
+	flowStateIDKey          = contextKey("flow_state_id")
+	linkingTargetIDKey      = contextKey("linking_target_id")
+	ssoProviderKey          = contextKey("sso_provider")
 )
 
 // withToken adds the JWT token to the context.
@@ -61,6 +75,21 @@ func withRequestID(ctx context.Context, id string) context.Context {
 	return context.WithValue(ctx, requestIDKey, id)
 }
 
+// withTraceID adds the W3C trace ID of the request to the context.
+func withTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+// getTraceID reads the W3C trace ID of the request from the context.
+func getTraceID(ctx context.Context) string {
+	obj := ctx.Value(traceIDKey)
+	if obj == nil {
+		return ""
+	}
+
+	return obj.(string)
+}
+
 // getRequestID reads the request ID from the context.
 func getRequestID(ctx context.Context) string {
 	obj := ctx.Value(requestIDKey)
@@ -197,6 +226,37 @@ func getExternalReferrer(ctx context.Context) string {
 	return obj.(string)
 }
 
+// withFlowStateID adds the id of the PKCE sign-in of the external provider flow to the context.
+func withFlowStateID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, flowStateIDKey, id)
+}
+
+// getFlowStateID reads the id of the PKCE sign-in from the context.
+func getFlowStateID(ctx context.Context) string {
+	obj := ctx.Value(flowStateIDKey)
+	if obj == nil {
+		return ""
+	}
+
+	return obj.(string)
+}
+
+// withLinkingTargetID adds the id of the user the identity of the external
+// provider flow is linked to to the context.
+func withLinkingTargetID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, linkingTargetIDKey, id)
+}
+
+// getLinkingTargetID reads the id of the user the identity is linked to from the context.
+func getLinkingTargetID(ctx context.Context) string {
+	obj := ctx.Value(linkingTargetIDKey)
+	if obj == nil {
+		return ""
+	}
+
+	return obj.(string)
+}
+
 // withFunctionHooks adds the provided function hooks to the context.
 func withFunctionHooks(ctx context.Context, hooks map[string][]string) context.Context {
 	return context.WithValue(ctx, functionHooksKey, hooks)
@@ -250,3 +310,132 @@ func getOAuthVerifier(ctx context.Context) string {
 	}
 	return obj.(string)
 }
+
+// withAdminAction adds the admin action to the context.
+func withAdminAction(ctx context.Context, action *models.AdminAction) context.Context {
+	return context.WithValue(ctx, adminActionKey, action)
+}
+
+// getAdminAction reads the admin action from the context.
+func getAdminAction(ctx context.Context) *models.AdminAction {
+	obj := ctx.Value(adminActionKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.AdminAction)
+}
+
+// withOAuthClient adds the OAuth client to the context.
+func withOAuthClient(ctx context.Context, client *models.OAuthClient) context.Context {
+	return context.WithValue(ctx, oauthClientKey, client)
+}
+
+// getOAuthClient reads the OAuth client from the context.
+func getOAuthClient(ctx context.Context) *models.OAuthClient {
+	obj := ctx.Value(oauthClientKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.OAuthClient)
+}
+
+// withOAuthAuthorization adds the OAuth authorization request to the context.
+func withOAuthAuthorization(ctx context.Context, authorization *models.OAuthAuthorization) context.Context {
+	return context.WithValue(ctx, oauthAuthorizationKey, authorization)
+}
+
+// getOAuthAuthorization reads the OAuth authorization request from the context.
+func getOAuthAuthorization(ctx context.Context) *models.OAuthAuthorization {
+	obj := ctx.Value(oauthAuthorizationKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.OAuthAuthorization)
+}
+
+// withDPoPThumbprint adds the thumbprint of the key the request's DPoP proof was signed with to the context.
+func withDPoPThumbprint(ctx context.Context, jkt string) context.Context {
+	return context.WithValue(ctx, dpopThumbprintKey, jkt)
+}
+
+// getDPoPThumbprint reads the DPoP key thumbprint from the context.
+func getDPoPThumbprint(ctx context.Context) string {
+	obj := ctx.Value(dpopThumbprintKey)
+	if obj == nil {
+		return ""
+	}
+	return obj.(string)
+}
+
+// withClientFingerprint adds the fingerprint of the client sending the request to the context.
+func withClientFingerprint(ctx context.Context, fingerprint string) context.Context {
+	return context.WithValue(ctx, clientFingerprintKey, fingerprint)
+}
+
+// getClientFingerprint reads the client fingerprint from the context.
+func getClientFingerprint(ctx context.Context) string {
+	obj := ctx.Value(clientFingerprintKey)
+	if obj == nil {
+		return ""
+	}
+	return obj.(string)
+}
+
+// withServiceAccount adds the service account to the context.
+func withServiceAccount(ctx context.Context, account *models.ServiceAccount) context.Context {
+	return context.WithValue(ctx, serviceAccountKey, account)
+}
+
+// getServiceAccount reads the service account from the context.
+func getServiceAccount(ctx context.Context) *models.ServiceAccount {
+	obj := ctx.Value(serviceAccountKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.ServiceAccount)
+}
+
+// withSSOProvider adds the SSO provider to the context.
+func withSSOProvider(ctx context.Context, p *models.SSOProvider) context.Context {
+	return context.WithValue(ctx, ssoProviderKey, p)
+}
+
+// getSSOProvider reads the SSO provider from the context.
+func getSSOProvider(ctx context.Context) *models.SSOProvider {
+	obj := ctx.Value(ssoProviderKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.SSOProvider)
+}
+
+// withAPIVersion adds the API version requested by the client to the context.
+func withAPIVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, apiVersionKey, version)
+}
+
+// getAPIVersion reads the requested API version from the context, which is
+// version 1 unless the client asked for another.
+func getAPIVersion(ctx context.Context) int {
+	obj := ctx.Value(apiVersionKey)
+	if obj == nil {
+		return apiVersion1
+	}
+	return obj.(int)
+}
+
+// withAuthFailureDeadline adds the earliest time a failed response may be
+// sent to the context.
+func withAuthFailureDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, authFailureDeadlineKey, deadline)
+}
+
+// getAuthFailureDeadline reads the earliest time a failed response may be
+// sent from the context.
+func getAuthFailureDeadline(ctx context.Context) (time.Time, bool) {
+	obj := ctx.Value(authFailureDeadlineKey)
+	if obj == nil {
+		return time.Time{}, false
+	}
+	return obj.(time.Time), true
+}
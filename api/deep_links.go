@@ -0,0 +1,70 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/netlify/gotrue/conf"
+)
+
+var deepLinkInterstitial = template.Must(template.New("deep_link").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<title>Opening the app</title>
+</head>
+<body>
+<p><a id="open" href="{{.URL}}">Open the app</a></p>
+<p>Don't have the app installed? <a href="{{.FallbackURL}}">Continue in the browser</a></p>
+<script>window.location.replace(document.getElementById("open").href);</script>
+</body>
+</html>
+`))
+
+// isDeepLink tells if redirectURL opens a mobile app, either through a custom
+// scheme or an app link.
+func isDeepLink(config *conf.Configuration, redirectURL string) bool {
+	u, err := parseURL(redirectURL)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return true
+	}
+	u.Fragment = ""
+	matchURL := u.String()
+	for _, g := range config.DeepLinks.AppLinkGlobs {
+		if g.Match(matchURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirect sends the user to rurl. Deep links are opened from an
+// interstitial page when enabled, which links to DEEP_LINKS_FALLBACK_URL for
+// users who don't have the app installed. Browsers often don't hand redirects
+// to apps, but do open them when the user follows a link.
+func (a *API) redirect(w http.ResponseWriter, r *http.Request, rurl string) {
+	config := a.getConfig(r.Context())
+	if !config.DeepLinks.Interstitial || !isDeepLink(config, rurl) {
+		http.Redirect(w, r, rurl, http.StatusSeeOther)
+		return
+	}
+
+	fallbackURL := config.DeepLinks.FallbackURL
+	if fallbackURL == "" {
+		fallbackURL = config.SiteURL
+	}
+	// the page contains the tokens of the user
+	setHTMLHeaders(w, config)
+	w.WriteHeader(http.StatusOK)
+	// rurl is an allowed redirect destination, so it's trusted here even
+	// though it isn't an http(s) URL
+	_ = deepLinkInterstitial.Execute(w, map[string]interface{}{
+		"URL":         template.URL(rurl),
+		"FallbackURL": template.URL(fallbackURL),
+	})
+}
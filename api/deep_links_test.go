@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepLinkRedirectURLs(t *testing.T) {
+	config := &conf.Configuration{
+		SiteURL:      "https://example.com",
+		URIAllowList: []string{"myapp://auth/*"},
+	}
+	config.DeepLinks.AppLinks = []string{"https://links.example.org/auth/*"}
+	require.NoError(t, config.ApplyDefaults())
+
+	assert.True(t, isRedirectURLValid(config, "myapp://auth/callback"))
+	assert.False(t, isRedirectURLValid(config, "myapp://auth/callback/other"))
+	assert.False(t, isRedirectURLValid(config, "otherapp://auth/callback"))
+	assert.True(t, isRedirectURLValid(config, "https://links.example.org/auth/callback"))
+	assert.False(t, isRedirectURLValid(config, "https://links.example.org/other"))
+
+	assert.True(t, isDeepLink(config, "myapp://auth/callback#access_token=a"))
+	assert.True(t, isDeepLink(config, "https://links.example.org/auth/callback#access_token=a"))
+	assert.False(t, isDeepLink(config, "https://example.com/welcome#access_token=a"))
+}
+
+func TestDeepLinkInterstitial(t *testing.T) {
+	config := &conf.Configuration{
+		SiteURL:      "https://example.com",
+		URIAllowList: []string{"myapp://auth/*"},
+	}
+	config.DeepLinks.FallbackURL = "https://example.com/get-the-app"
+	require.NoError(t, config.ApplyDefaults())
+
+	api := &API{config: &conf.GlobalConfiguration{}}
+	redirect := func(rurl string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/verify", nil)
+		req = req.WithContext(withConfig(req.Context(), config))
+		w := httptest.NewRecorder()
+		api.redirect(w, req, rurl)
+		return w
+	}
+
+	w := redirect("myapp://auth/callback#access_token=a")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "myapp://auth/callback#access_token=a", w.Header().Get("Location"))
+
+	config.DeepLinks.Interstitial = true
+	w = redirect("myapp://auth/callback#access_token=a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), `href="myapp://auth/callback#access_token=a"`)
+	assert.Contains(t, w.Body.String(), `href="https://example.com/get-the-app"`)
+
+	w = redirect("https://example.com/welcome#access_token=a")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+}
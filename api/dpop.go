@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/pkg/errors"
+)
+
+const (
+	dpopHeader    = "DPoP"
+	dpopProofType = "dpop+jwt"
+	dpopTokenType = "DPoP"
+
+	// dpopProofClockSkew is how far ahead of the server's clock the iat of a
+	// proof can be.
+	dpopProofClockSkew = 60 * time.Second
+)
+
+// dpopProofClaims are the claims of a DPoP proof, see RFC 9449 section 4.2.
+type dpopProofClaims struct {
+	jwt.StandardClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+}
+
+// dpopProof is a verified DPoP proof.
+type dpopProof struct {
+	JKT       string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// tokenConfirmation is the cnf claim binding an access token to a DPoP key (RFC 9449 section 6).
+type tokenConfirmation struct {
+	JKT string `json:"jkt"`
+}
+
+// dpopTargetURI is the htu a proof for r has to carry: the external URL of
+// the endpoint without query and fragment.
+func (a *API) dpopTargetURI(r *http.Request) string {
+	return strings.TrimSuffix(a.config.API.ExternalURL, "/") + r.URL.Path
+}
+
+// parseDPoPProof verifies the signature and claims of a DPoP proof for r. When
+// accessToken is set, the proof has to be bound to it with the ath claim.
+func (a *API) parseDPoPProof(config *conf.Configuration, r *http.Request, proof, accessToken string) (*dpopProof, error) {
+	var key jwk.Key
+	claims := dpopProofClaims{}
+	// the time claims are checked below, allowing for clock skew
+	p := jwt.Parser{ValidMethods: clientAssertionSigningMethods, SkipClaimsValidation: true}
+	_, err := p.ParseWithClaims(proof, &claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		data, err := json.Marshal(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		set, err := jwk.ParseBytes(data)
+		if err != nil || len(set.Keys) != 1 {
+			return nil, errors.New("jwk header must contain a single public key")
+		}
+		switch set.Keys[0].(type) {
+		case *jwk.RSAPublicKey, *jwk.ECDSAPublicKey:
+		default:
+			return nil, errors.New("jwk header must contain a single public key")
+		}
+		key = set.Keys[0]
+		return key.Materialize()
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DPoP proof")
+	}
+
+	if claims.Id == "" || claims.IssuedAt == 0 {
+		return nil, errors.New("DPoP proof requires jti and iat claims")
+	}
+	now := clock.Now()
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	if now.Sub(issuedAt) > config.Security.DPoP.ProofLifetime || !claims.VerifyExpiresAt(now.Unix(), false) {
+		return nil, errors.New("DPoP proof has expired")
+	}
+	// proofs issued in the future could be generated ahead and used later
+	if issuedAt.Sub(now) > dpopProofClockSkew || !claims.VerifyNotBefore(now.Add(dpopProofClockSkew).Unix(), false) {
+		return nil, errors.New("DPoP proof is not valid yet")
+	}
+	if claims.HTM != r.Method || claims.HTU != a.dpopTargetURI(r) {
+		return nil, errors.New("DPoP proof was not issued for this request")
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(hash[:]) {
+			return nil, errors.New("DPoP proof was not issued for this access token")
+		}
+	}
+
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DPoP key")
+	}
+	return &dpopProof{
+		JKT:       base64.RawURLEncoding.EncodeToString(thumbprint),
+		ID:        claims.Id,
+		ExpiresAt: issuedAt.Add(config.Security.DPoP.ProofLifetime),
+	}, nil
+}
+
+// verifyDPoPProof verifies the DPoP proof sent with r and makes sure it is
+// only used once. It returns nil if the request carries no proof.
+func (a *API) verifyDPoPProof(r *http.Request, accessToken string) (*dpopProof, error) {
+	headers := r.Header.Values(dpopHeader)
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if len(headers) > 1 {
+		return nil, errors.New("only one DPoP proof is allowed")
+	}
+
+	ctx := r.Context()
+	proof, err := a.parseDPoPProof(a.getConfig(ctx), r, headers[0], accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// proofs are remembered in the database, so a replayed proof is rejected by every instance
+	ok, err := models.UseNonce(a.getDB(ctx), getInstanceID(ctx), models.NonceDPoPProof, proof.JKT+":"+proof.ID, proof.ExpiresAt)
+	if err != nil {
+		return nil, internalServerError("Database error checking DPoP proof").WithInternalError(err)
+	}
+	if !ok {
+		return nil, errors.New("DPoP proof has already been used")
+	}
+	return proof, nil
+}
+
+// loadDPoPProof verifies the DPoP proof sent to the token endpoint, so the
+// issued tokens can be bound to the client's key.
+func (a *API) loadDPoPProof(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	if !config.Security.DPoP.Enabled {
+		return ctx, nil
+	}
+
+	proof, err := a.verifyDPoPProof(r, "")
+	if err != nil {
+		if httpErr, ok := err.(*HTTPError); ok {
+			return nil, httpErr
+		}
+		return nil, oauthError("invalid_dpop_proof", err.Error())
+	}
+	if proof == nil {
+		if config.Security.DPoP.Required {
+			return nil, oauthError("invalid_dpop_proof", "A DPoP proof is required")
+		}
+		return ctx, nil
+	}
+	return withDPoPThumbprint(ctx, proof.JKT), nil
+}
+
+// checkDPoPBinding makes sure a DPoP-bound access token is presented with the
+// DPoP scheme and a proof signed by the key it is bound to, so a stolen token
+// is useless without the private key.
+func (a *API) checkDPoPBinding(r *http.Request, scheme, accessToken string, claims *GoTrueClaims) error {
+	if claims.Confirmation == nil || claims.Confirmation.JKT == "" {
+		return nil
+	}
+	if !strings.EqualFold(scheme, dpopTokenType) {
+		return unauthorizedError("This token must be presented with a DPoP proof")
+	}
+	proof, err := a.verifyDPoPProof(r, accessToken)
+	if err != nil {
+		if httpErr, ok := err.(*HTTPError); ok {
+			return httpErr
+		}
+		return unauthorizedError("Invalid DPoP proof: %v", err)
+	}
+	if proof == nil || proof.JKT != claims.Confirmation.JKT {
+		return unauthorizedError("Invalid DPoP proof: not signed with the key the token is bound to")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDPoPProof creates a DPoP proof signed with key, see RFC 9449 section 4.2.
+func testDPoPProof(t *testing.T, key *ecdsa.PrivateKey, jwkKey interface{}, method, uri, accessToken string, issuedAt time.Time) string {
+	k, err := jwk.New(jwkKey)
+	require.NoError(t, err)
+	data, err := json.Marshal(k)
+	require.NoError(t, err)
+	header := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &header))
+
+	claims := dpopProofClaims{
+		StandardClaims: jwt.StandardClaims{Id: time.Now().Format(time.RFC3339Nano), IssuedAt: issuedAt.Unix()},
+		HTM:            method,
+		HTU:            uri,
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		claims.ATH = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = header
+	proof, err := token.SignedString(key)
+	require.NoError(t, err)
+	return proof
+}
+
+func TestParseDPoPProof(t *testing.T) {
+	globalConfig := &conf.GlobalConfiguration{}
+	globalConfig.API.ExternalURL = "https://auth.example.com/"
+	a := &API{config: globalConfig}
+	config := &conf.Configuration{}
+	config.Security.DPoP.ProofLifetime = time.Minute
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", nil)
+	uri := "https://auth.example.com/token"
+
+	proof, err := a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "", time.Now()), "")
+	require.NoError(t, err)
+	thumbprint, err := jwk.New(&key.PublicKey)
+	require.NoError(t, err)
+	expected, err := thumbprint.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(expected), proof.JKT)
+
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodGet, uri, "", time.Now()), "")
+	assert.Error(t, err, "wrong method")
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, "https://evil.com/token", "", time.Now()), "")
+	assert.Error(t, err, "wrong URI")
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "", time.Now().Add(-2*time.Minute)), "")
+	assert.Error(t, err, "expired")
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "", time.Now().Add(30*time.Second)), "")
+	assert.NoError(t, err, "issued within the clock skew")
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "", time.Now().Add(2*time.Minute)), "")
+	assert.Error(t, err, "issued in the future")
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "", time.Now().Add(24*time.Hour)), "")
+	assert.Error(t, err, "issued far in the future")
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, key, http.MethodPost, uri, "", time.Now()), "")
+	assert.Error(t, err, "private key in header")
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &other.PublicKey, http.MethodPost, uri, "", time.Now()), "")
+	assert.Error(t, err, "signed with another key")
+
+	// proofs sent with an access token have to be bound to it
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "", time.Now()), "access-token")
+	assert.Error(t, err)
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "other-token", time.Now()), "access-token")
+	assert.Error(t, err)
+	_, err = a.parseDPoPProof(config, req, testDPoPProof(t, key, &key.PublicKey, http.MethodPost, uri, "access-token", time.Now()), "access-token")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const UserErasureEvent = "user_erasure"
+
+// UserErasure is sent to the erasure webhook right before a user is erased,
+// so downstream systems can erase their copy of the user's data.
+type UserErasure struct {
+	Event            string    `json:"event"`
+	InstanceID       uuid.UUID `json:"instance_id,omitempty"`
+	UserID           uuid.UUID `json:"user_id"`
+	ErasureRequestID uuid.UUID `json:"erasure_request_id"`
+	Email            string    `json:"email,omitempty"`
+	Phone            string    `json:"phone,omitempty"`
+	Action           string    `json:"action"`
+	ScheduledFor     time.Time `json:"scheduled_for"`
+}
+
+// UserErasureParams are the parameters of an erasure request. The nonce is
+// the one sent by GET /reauthenticate.
+type UserErasureParams struct {
+	Nonce string `json:"nonce"`
+}
+
+func (a *API) erasureUser(ctx context.Context) (*models.User, error) {
+	claims := getClaims(ctx)
+	userID, err := uuid.FromString(claims.Subject)
+	if err != nil {
+		return nil, badRequestError("Could not read User ID claim")
+	}
+	user, err := models.FindUserByID(a.getDB(ctx), userID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError(err.Error())
+		}
+		return nil, internalServerError("Database error finding user").WithInternalError(err)
+	}
+	return user, nil
+}
+
+// UserErasureRequest schedules the erasure of the user after the erasure
+// waiting period. It requires a reauthentication nonce.
+func (a *API) UserErasureRequest(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	if !config.Erasure.Enabled {
+		return notFoundError("Account erasure is disabled")
+	}
+
+	params := &UserErasureParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read params: %v", err)
+	}
+
+	user, err := a.erasureUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	request, err := models.FindScheduledErasureRequest(a.getDB(ctx), user)
+	if err == nil {
+		return sendJSON(w, http.StatusOK, request)
+	}
+	if !models.IsNotFoundError(err) {
+		return internalServerError("Database error finding erasure request").WithInternalError(err)
+	}
+
+	if params.Nonce == "" {
+		return unauthorizedError("Account erasure requires reauthentication.")
+	}
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := a.verifyReauthentication(ctx, params.Nonce, tx, config, user); terr != nil {
+			return terr
+		}
+		var terr error
+		request, terr = models.NewErasureRequest(user, config.Erasure.WaitingPeriod)
+		if terr != nil {
+			return internalServerError("Error creating erasure request").WithInternalError(terr)
+		}
+		if terr := tx.Create(request); terr != nil {
+			return internalServerError("Database error saving erasure request").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserErasureRequestedAction, "", map[string]interface{}{
+			"erasure_request_id": request.ID,
+			"scheduled_for":      request.ScheduledFor,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusCreated, request)
+}
+
+// UserErasureGet returns the scheduled erasure request of the user.
+func (a *API) UserErasureGet(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	if !a.getConfig(ctx).Erasure.Enabled {
+		return notFoundError("Account erasure is disabled")
+	}
+
+	user, err := a.erasureUser(ctx)
+	if err != nil {
+		return err
+	}
+	request, err := models.FindScheduledErasureRequest(a.getDB(ctx), user)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError(err.Error())
+		}
+		return internalServerError("Database error finding erasure request").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, request)
+}
+
+// UserErasureCancel cancels the scheduled erasure request of the user.
+func (a *API) UserErasureCancel(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	if !a.getConfig(ctx).Erasure.Enabled {
+		return notFoundError("Account erasure is disabled")
+	}
+
+	user, err := a.erasureUser(ctx)
+	if err != nil {
+		return err
+	}
+	request, err := models.FindScheduledErasureRequest(a.getDB(ctx), user)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError(err.Error())
+		}
+		return internalServerError("Database error finding erasure request").WithInternalError(err)
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		cancelled, terr := request.Cancel(tx)
+		if terr != nil {
+			return internalServerError("Database error cancelling erasure request").WithInternalError(terr)
+		}
+		if !cancelled {
+			return unprocessableEntityError("Erasure request has already been carried out or cancelled")
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserErasureCancelledAction, "", map[string]interface{}{
+			"erasure_request_id": request.ID,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, request)
+}
+
+// adminErasureRequests lists the erasure requests of the instance, optionally
+// filtered by user_id and status.
+func (a *API) adminErasureRequests(w http.ResponseWriter, r *http.Request) error {
+	instanceID := getInstanceID(r.Context())
+
+	pageParams, err := paginate(r)
+	if err != nil {
+		return badRequestError("Bad Pagination Parameters: %v", err)
+	}
+
+	userID := uuid.Nil
+	if id := r.URL.Query().Get("user_id"); id != "" {
+		userID, err = uuid.FromString(id)
+		if err != nil {
+			return badRequestError("user_id must be an UUID")
+		}
+	}
+	status := models.ErasureStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.ErasureScheduled, models.ErasureCompleted, models.ErasureCancelled:
+	default:
+		return badRequestError("status must be scheduled, completed or cancelled")
+	}
+
+	requests, err := models.FindErasureRequests(a.getDB(r.Context()), instanceID, userID, status, pageParams)
+	if err != nil {
+		return internalServerError("Database error finding erasure requests").WithInternalError(err)
+	}
+	addPaginationHeaders(w, r, pageParams)
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"erasure_requests": requests,
+	})
+}
+
+// processErasureRequests erases the users whose erasure waiting period is
+// over. The erasure webhook is called first, and a request whose webhook
+// fails is retried on the next run.
+func (a *API) processErasureRequests(ctx context.Context) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	log := logrus.WithFields(logrus.Fields{
+		"component":   "erasure",
+		"instance_id": instanceID,
+	})
+
+	for {
+		requests, err := models.FindDueErasureRequests(a.db, instanceID, jobBatchSize)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, request := range requests {
+			if err := a.eraseUser(ctx, config, request); err != nil {
+				log.WithField("erasure_request_id", request.ID).WithError(err).Error("Failed to erase user")
+				failed++
+			}
+		}
+		// requests that failed are still due, so stop rather than load them again
+		if len(requests) < jobBatchSize || failed > 0 {
+			return nil
+		}
+	}
+}
+
+func (a *API) eraseUser(ctx context.Context, config *conf.Configuration, request *models.ErasureRequest) error {
+	action := config.Erasure.Action
+	user, err := models.FindUserByInstanceIDAndID(a.db, request.InstanceID, request.UserID)
+	if err != nil && !models.IsNotFoundError(err) {
+		return err
+	}
+	// the hold may have been placed after the request was loaded
+	if user != nil && user.IsOnLegalHold() {
+		return nil
+	}
+	if user != nil && config.Erasure.WebhookURL != "" {
+		if err := a.sendUserErasure(config, &UserErasure{
+			Event:            UserErasureEvent,
+			InstanceID:       request.InstanceID,
+			UserID:           user.ID,
+			ErasureRequestID: request.ID,
+			Email:            user.GetEmail(),
+			Phone:            user.GetPhone(),
+			Action:           action,
+			ScheduledFor:     request.ScheduledFor,
+		}); err != nil {
+			return err
+		}
+	}
+
+	erased := false
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		claimed, terr := request.Complete(tx, action)
+		if terr != nil || !claimed || user == nil {
+			return terr
+		}
+		erased = true
+		// the entry outlives the user, so it only keeps the user's ID
+		if terr := models.NewAuditLogEntry(nil, tx, request.InstanceID, &models.User{ID: user.ID}, models.UserErasedAction, "", map[string]interface{}{
+			"user_id":            user.ID,
+			"erasure_request_id": request.ID,
+			"action":             action,
+		}); terr != nil {
+			return terr
+		}
+		if action == conf.ErasureDelete {
+			return tx.Destroy(user)
+		}
+		if terr := models.Logout(tx, request.InstanceID, user.ID, models.SignOutReasonAdmin); terr != nil {
+			return terr
+		}
+		return user.Anonymize(tx)
+	})
+	if err != nil || !erased {
+		return err
+	}
+	if action == conf.ErasureDelete {
+		a.emitLifecycleEvent(ctx, UserDeletedEvent, user)
+	} else {
+		a.emitLifecycleEvent(ctx, UserUpdatedEvent, user)
+	}
+	return nil
+}
+
+func (a *API) sendUserErasure(config *conf.Configuration, erasure *UserErasure) error {
+	data, err := json.Marshal(erasure)
+	if err != nil {
+		return err
+	}
+	sha, err := checksum(data)
+	if err != nil {
+		return err
+	}
+
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{URL: config.Erasure.WebhookURL, Retries: 1},
+		jwtSecret:     config.Erasure.WebhookSecret,
+		instanceID:    erasure.InstanceID,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  erasure.InstanceID.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: data,
+	}
+	body, err := w.trigger()
+	if body != nil {
+		body.Close()
+	}
+	return errors.Wrap(err, "error sending erasure webhook")
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErasureTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestErasure(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &ErasureTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *ErasureTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	ts.Config.Erasure = conf.ErasureConfiguration{
+		Enabled:       true,
+		WaitingPeriod: 24 * time.Hour,
+		Action:        conf.ErasureAnonymize,
+	}
+}
+
+func (ts *ErasureTestSuite) TearDownTest() {
+	ts.Config.Erasure = conf.ErasureConfiguration{}
+}
+
+// createUser creates a confirmed user with a pending reauthentication nonce
+// of 123456 and returns it with an access token.
+func (ts *ErasureTestSuite) createUser() (*models.User, string) {
+	u, err := models.NewUser(ts.instanceID, "", "test@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.EmailConfirmedAt = &now
+	u.ReauthenticationToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+"123456")))
+	u.ReauthenticationSentAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	token, err := generateAccessToken(u, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+	return u, token
+}
+
+func (ts *ErasureTestSuite) request(method, token string, body map[string]interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	if body != nil {
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+	}
+	req := httptest.NewRequest(method, "http://localhost/user/erasure", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *ErasureTestSuite) TestRequestAndCancelErasure() {
+	_, token := ts.createUser()
+
+	w := ts.request(http.MethodPost, token, map[string]interface{}{"nonce": "654321"})
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = ts.request(http.MethodPost, token, map[string]interface{}{"nonce": "123456"})
+	require.Equal(ts.T(), http.StatusCreated, w.Code, w.Body.String())
+	request := models.ErasureRequest{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&request))
+	assert.Equal(ts.T(), models.ErasureScheduled, request.Status)
+	assert.WithinDuration(ts.T(), time.Now().Add(24*time.Hour), request.ScheduledFor, time.Minute)
+
+	// requesting again returns the scheduled request without a new nonce
+	w = ts.request(http.MethodPost, token, map[string]interface{}{})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	w = ts.request(http.MethodGet, token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	w = ts.request(http.MethodDelete, token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&request))
+	assert.Equal(ts.T(), models.ErasureCancelled, request.Status)
+
+	w = ts.request(http.MethodGet, token, nil)
+	require.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
+
+func (ts *ErasureTestSuite) TestErasureDisabled() {
+	ts.Config.Erasure.Enabled = false
+	_, token := ts.createUser()
+
+	w := ts.request(http.MethodPost, token, map[string]interface{}{"nonce": "123456"})
+	require.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
+
+func (ts *ErasureTestSuite) TestProcessErasureRequests() {
+	var received UserErasure
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+	ts.Config.Erasure.WebhookURL = svr.URL
+
+	u, _ := ts.createUser()
+	request, err := models.NewErasureRequest(u, -time.Minute)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(request))
+
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.processErasureRequests(ctx))
+
+	assert.Equal(ts.T(), UserErasureEvent, received.Event)
+	assert.Equal(ts.T(), u.ID, received.UserID)
+	assert.Equal(ts.T(), "test@example.com", received.Email)
+
+	u, err = models.FindUserByID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), u.GetEmail())
+
+	requests, err := models.FindErasureRequests(ts.API.db, ts.instanceID, u.ID, models.ErasureCompleted, nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), requests, 1)
+	assert.Equal(ts.T(), conf.ErasureAnonymize, string(requests[0].Action))
+}
+
+func (ts *ErasureTestSuite) TestErasureWebhookFailureRetries() {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer svr.Close()
+	ts.Config.Erasure.WebhookURL = svr.URL
+	ts.Config.Erasure.Action = conf.ErasureDelete
+
+	u, _ := ts.createUser()
+	request, err := models.NewErasureRequest(u, -time.Minute)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(request))
+
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.processErasureRequests(ctx))
+
+	// the user is kept and the request stays due
+	_, err = models.FindUserByID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	requests, err := models.FindDueErasureRequests(ts.API.db, ts.instanceID, 10)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), requests, 1)
+}
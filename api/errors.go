@@ -6,9 +6,11 @@ import (
 	"net/http"
 	"os"
 	"runtime/debug"
+	"time"
 
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/utilities"
 	"github.com/pkg/errors"
 )
@@ -30,10 +32,11 @@ var oauthErrorMap = map[int]string{
 
 // OAuthError is the JSON handler for OAuth2 error responses
 type OAuthError struct {
-	Err             string `json:"error"`
-	Description     string `json:"error_description,omitempty"`
-	InternalError   error  `json:"-"`
-	InternalMessage string `json:"-"`
+	Err             string                 `json:"error"`
+	Description     string                 `json:"error_description,omitempty"`
+	Details         map[string]interface{} `json:"details,omitempty"`
+	InternalError   error                  `json:"-"`
+	InternalMessage string                 `json:"-"`
 }
 
 func (e *OAuthError) Error() string {
@@ -49,6 +52,12 @@ func (e *OAuthError) WithInternalError(err error) *OAuthError {
 	return e
 }
 
+// WithDetails adds details clients can act on to the error
+func (e *OAuthError) WithDetails(details map[string]interface{}) *OAuthError {
+	e.Details = details
+	return e
+}
+
 // WithInternalMessage adds internal message information to the error
 func (e *OAuthError) WithInternalMessage(fmtString string, args ...interface{}) *OAuthError {
 	e.InternalMessage = fmt.Sprintf(fmtString, args...)
@@ -82,6 +91,31 @@ func invalidSignupError(config *conf.Configuration) *HTTPError {
 	return unprocessableEntityError(msg)
 }
 
+// legalHoldError is returned when deleting or anonymizing a user on legal hold.
+func legalHoldError(user *models.User) *HTTPError {
+	return httpError(http.StatusConflict, "User is on legal hold").WithDetails(map[string]interface{}{
+		"reason":        "legal_hold",
+		"user_id":       user.ID,
+		"legal_hold_at": user.LegalHoldAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// Reasons a refresh token is refused for, besides the sign out reasons
+// recorded when sessions end.
+const (
+	refreshTokenNotFoundReason = "refresh_token_not_found"
+	refreshTokenReusedReason   = "refresh_token_reused"
+	userBannedReason           = "user_banned"
+)
+
+// invalidRefreshTokenError is returned when a refresh token is refused, with
+// the reason so clients can tell the user why they were signed out.
+func invalidRefreshTokenError(reason string) *OAuthError {
+	return oauthError("invalid_grant", "Invalid Refresh Token").WithDetails(map[string]interface{}{
+		"reason": reason,
+	})
+}
+
 func oauthError(err string, description string) *OAuthError {
 	return &OAuthError{Err: err, Description: description}
 }
@@ -124,11 +158,14 @@ func tooManyRequestsError(fmtString string, args ...interface{}) *HTTPError {
 
 // HTTPError is an error with a message and an HTTP status code.
 type HTTPError struct {
-	Code            int    `json:"code"`
-	Message         string `json:"msg"`
-	InternalError   error  `json:"-"`
-	InternalMessage string `json:"-"`
-	ErrorID         string `json:"error_id,omitempty"`
+	Code            int                    `json:"code"`
+	ErrorCode       string                 `json:"error_code,omitempty"`
+	Message         string                 `json:"msg"`
+	Details         map[string]interface{} `json:"details,omitempty"`
+	Errors          []FieldError           `json:"errors,omitempty"`
+	InternalError   error                  `json:"-"`
+	InternalMessage string                 `json:"-"`
+	ErrorID         string                 `json:"error_id,omitempty"`
 }
 
 func (e *HTTPError) Error() string {
@@ -156,12 +193,53 @@ func (e *HTTPError) WithInternalError(err error) *HTTPError {
 	return e
 }
 
+// WithDetails adds details clients can act on to the error
+func (e *HTTPError) WithDetails(details map[string]interface{}) *HTTPError {
+	e.Details = details
+	return e
+}
+
 // WithInternalMessage adds internal message information to the error
 func (e *HTTPError) WithInternalMessage(fmtString string, args ...interface{}) *HTTPError {
 	e.InternalMessage = fmt.Sprintf(fmtString, args...)
 	return e
 }
 
+// FieldError is why a single field of a request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"msg"`
+}
+
+// fieldErrors collects everything that is wrong with a request, so clients
+// can show all of it at once instead of one problem per attempt.
+type fieldErrors []FieldError
+
+func (f *fieldErrors) add(field string, fmtString string, args ...interface{}) {
+	*f = append(*f, FieldError{Field: field, Message: fmt.Sprintf(fmtString, args...)})
+}
+
+// addError adds the message of err, which is usually an *HTTPError returned
+// by a validation helper.
+func (f *fieldErrors) addError(field string, err error) {
+	message := err.Error()
+	if httpErr, ok := err.(*HTTPError); ok {
+		message = httpErr.Message
+	}
+	*f = append(*f, FieldError{Field: field, Message: message})
+}
+
+// toError returns the collected errors as a 422 whose message is the first
+// error, for clients that only read msg, or nil when there are none.
+func (f fieldErrors) toError() error {
+	if len(f) == 0 {
+		return nil
+	}
+	e := unprocessableEntityError(f[0].Message)
+	e.Errors = f
+	return e
+}
+
 func httpError(code int, fmtString string, args ...interface{}) *HTTPError {
 	return &HTTPError{
 		Code:    code,
@@ -240,6 +318,7 @@ type ErrorCause interface {
 }
 
 func handleError(err error, w http.ResponseWriter, r *http.Request) {
+	padAuthFailure(r.Context())
 	log := logger.GetLogEntry(r)
 	errorID := getRequestID(r.Context())
 	switch e := err.(type) {
@@ -252,6 +331,10 @@ func handleError(err error, w http.ResponseWriter, r *http.Request) {
 			log.WithError(e.Cause()).Info(e.Error())
 		}
 
+		if getAPIVersion(r.Context()) >= apiVersion2 && e.ErrorCode == "" {
+			e.ErrorCode = httpErrorCodes[e.Code]
+		}
+
 		// Provide better error messages for certain user-triggered Postgres errors.
 		if pgErr := utilities.NewPostgresError(e.InternalError); pgErr != nil {
 			if jsonErr := sendJSON(w, pgErr.HttpStatusCode, pgErr); jsonErr != nil {
@@ -13,6 +13,7 @@ import (
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt"
 	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/clock"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/models"
@@ -27,6 +28,9 @@ type ExternalProviderClaims struct {
 	Provider    string `json:"provider"`
 	InviteToken string `json:"invite_token,omitempty"`
 	Referrer    string `json:"referrer,omitempty"`
+	FlowStateID string `json:"flow_state_id,omitempty"`
+	// LinkingTargetID is the user the identity is linked to
+	LinkingTargetID string `json:"linking_target_id,omitempty"`
 }
 
 // ExternalSignupParams are the parameters the Signup endpoint accepts
@@ -37,49 +41,97 @@ type ExternalSignupParams struct {
 
 // ExternalProviderRedirect redirects the request to the corresponding oauth provider
 func (a *API) ExternalProviderRedirect(w http.ResponseWriter, r *http.Request) error {
+	authURL, err := a.externalProviderAuthURL(w, r, r.URL.Query(), "")
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+	return nil
+}
+
+// externalProviderAuthURL returns the URL of the oauth provider the external
+// provider flow continues at. The identity is linked to the user with
+// linkingTargetID if set.
+func (a *API) externalProviderAuthURL(w http.ResponseWriter, r *http.Request, query url.Values, linkingTargetID string) (string, error) {
 	ctx := r.Context()
 	config := a.getConfig(ctx)
 
-	query := r.URL.Query()
 	providerType := query.Get("provider")
 	scopes := query.Get("scopes")
+	if providerType == "sso" {
+		var err error
+		if providerType, err = a.resolveSSOProviderType(ctx, query); err != nil {
+			return "", err
+		}
+	}
 
 	p, err := a.Provider(ctx, providerType, scopes, &query)
 	if err != nil {
-		return badRequestError("Unsupported provider: %+v", err).WithInternalError(err)
+		return "", badRequestError("Unsupported provider: %+v", err).WithInternalError(err)
 	}
 
 	inviteToken := query.Get("invite_token")
 	if inviteToken != "" {
-		_, userErr := models.FindUserByConfirmationToken(a.db, inviteToken)
+		_, userErr := models.FindUserByConfirmationToken(a.getDB(ctx), inviteToken)
 		if userErr != nil {
 			if models.IsNotFoundError(userErr) {
-				return notFoundError(userErr.Error())
+				return "", notFoundError(userErr.Error())
 			}
-			return internalServerError("Database error finding user").WithInternalError(userErr)
+			return "", internalServerError("Database error finding user").WithInternalError(userErr)
 		}
 	}
 
+	pkce := &PKCEParams{
+		FlowType:            query.Get("flow_type"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+	isPKCE, err := pkce.isPKCE(config)
+	if err != nil {
+		return "", err
+	}
+
 	redirectURL := a.getRedirectURLOrReferrer(r, query.Get("redirect_to"))
 	log := logger.GetLogEntry(r)
 	log.WithField("provider", providerType).Info("Redirecting to external provider")
 
+	stateLifetime := 5 * time.Minute
+	stateClaims := jwt.StandardClaims{}
+	if config.Security.OAuthStrict.Enabled {
+		stateClaims.Id = uuid.Must(uuid.NewV4()).String()
+		stateLifetime = config.Security.OAuthStrict.CodeLifetime
+	}
+	stateClaims.ExpiresAt = clock.Now().Add(stateLifetime).Unix()
+
+	flowStateID := ""
+	if isPKCE {
+		flowState, err := models.NewFlowState(getInstanceID(ctx), nil, providerType, externalGrant, pkce.CodeChallenge, pkce.CodeChallengeMethod, stateLifetime)
+		if err != nil {
+			return "", internalServerError("Error creating flow state").WithInternalError(err)
+		}
+		if err := a.getDB(ctx).Create(flowState); err != nil {
+			return "", internalServerError("Database error creating flow state").WithInternalError(err)
+		}
+		flowStateID = flowState.ID.String()
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, ExternalProviderClaims{
 		NetlifyMicroserviceClaims: NetlifyMicroserviceClaims{
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
-			},
-			SiteURL:    config.SiteURL,
-			InstanceID: getInstanceID(ctx).String(),
-			NetlifyID:  getNetlifyID(ctx),
+			StandardClaims: stateClaims,
+			SiteURL:        config.SiteURL,
+			InstanceID:     getInstanceID(ctx).String(),
+			NetlifyID:      getNetlifyID(ctx),
 		},
-		Provider:    providerType,
-		InviteToken: inviteToken,
-		Referrer:    redirectURL,
+		Provider:        providerType,
+		InviteToken:     inviteToken,
+		Referrer:        redirectURL,
+		FlowStateID:     flowStateID,
+		LinkingTargetID: linkingTargetID,
 	})
 	tokenString, err := token.SignedString([]byte(config.JWT.Secret))
 	if err != nil {
-		return internalServerError("Error creating state").WithInternalError(err)
+		return "", internalServerError("Error creating state").WithInternalError(err)
 	}
 
 	var authURL string
@@ -88,14 +140,12 @@ func (a *API) ExternalProviderRedirect(w http.ResponseWriter, r *http.Request) e
 		authURL = externalProvider.AuthCodeURL(tokenString)
 		err := storage.StoreInSession(providerType, externalProvider.Marshal(), r, w)
 		if err != nil {
-			return internalServerError("Error storing request token in session").WithInternalError(err)
+			return "", internalServerError("Error storing request token in session").WithInternalError(err)
 		}
 	default:
 		authURL = p.AuthCodeURL(tokenString)
 	}
-
-	http.Redirect(w, r, authURL, http.StatusFound)
-	return nil
+	return authURL, nil
 }
 
 // ExternalProviderCallback handles the callback endpoint in the external oauth provider flow
@@ -112,8 +162,8 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 	providerType := getExternalProviderType(ctx)
 	var userData *provider.UserProvidedData
 	var providerToken string
-	if providerType == "saml" {
-		samlUserData, err := a.samlCallback(ctx, r)
+	if providerType == "saml" || a.isSSOSamlProviderType(ctx, providerType) {
+		samlUserData, err := a.samlCallback(ctx, r, providerType)
 		if err != nil {
 			return err
 		}
@@ -137,13 +187,20 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 
 	var user *models.User
 	var token *AccessTokenResponse
-	err := a.db.Transaction(func(tx *storage.Connection) error {
+	var authCode string
+	var isNewUser, confirmed bool
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		inviteToken := getInviteToken(ctx)
 		if inviteToken != "" {
 			if user, terr = a.processInvite(r, ctx, tx, userData, instanceID, inviteToken, providerType); terr != nil {
 				return terr
 			}
+			confirmed = true
+		} else if linkingTargetID := getLinkingTargetID(ctx); linkingTargetID != "" {
+			if user, terr = a.linkUserIdentity(r, tx, userData, linkingTargetID, providerType); terr != nil {
+				return terr
+			}
 		} else {
 			aud := a.requestAud(ctx, r)
 			var emailData provider.Email
@@ -195,6 +252,7 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 						if terr != nil {
 							return terr
 						}
+						isNewUser = true
 
 						if identity, terr = a.createNewIdentity(tx, user, providerType, identityData); terr != nil {
 							return terr
@@ -246,9 +304,9 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 				if !emailData.Verified && !config.Mailer.Autoconfirm {
 					mailer := a.Mailer(ctx)
 					referrer := a.getReferrer(r)
-					if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequency, referrer, config.Mailer.OtpLength); terr != nil {
+					if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.ConfirmationEmail), referrer, config.Mailer.OtpLength); terr != nil {
 						if errors.Is(terr, MaxFrequencyLimitError) {
-							return tooManyRequestsError("For security purposes, you can only request this once every minute")
+							return frequencyLimitedError(w, terr)
 						}
 						return internalServerError("Error sending confirmation mail").WithInternalError(terr)
 					}
@@ -269,6 +327,7 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 				if terr = user.Confirm(tx); terr != nil {
 					return internalServerError("Error updating user").WithInternalError(terr)
 				}
+				confirmed = true
 			} else {
 				if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
 					"provider": providerType,
@@ -281,7 +340,12 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 			}
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		if getFlowStateID(ctx) != "" {
+			authCode, terr = a.issueExternalAuthCode(ctx, tx, user, providerType)
+			return terr
+		}
+
+		token, terr = a.issueRefreshToken(ctx, r, tx, user, externalGrant)
 		if terr != nil {
 			return oauthError("server_error", terr.Error())
 		}
@@ -290,9 +354,18 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 	if err != nil {
 		return err
 	}
+	if isNewUser {
+		a.emitLifecycleEvent(ctx, UserCreatedEvent, user)
+	}
+	if confirmed {
+		a.emitLifecycleEvent(ctx, UserConfirmedEvent, user)
+	}
 
 	rurl := a.getExternalRedirectURL(r)
-	if token != nil {
+	if authCode != "" {
+		// the client exchanges the code with its code verifier for tokens
+		rurl = pkceRedirectURL(rurl, authCode)
+	} else if token != nil {
 		q := url.Values{}
 		q.Set("provider_token", providerToken)
 		q.Set("access_token", token.Token)
@@ -304,6 +377,8 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 		if err := a.setCookieTokens(config, token, false, w); err != nil {
 			return internalServerError("Failed to set JWT cookie. %s", err)
 		}
+		a.recordTokenIssued(ctx, userTokenIssuance(user, externalGrant))
+		a.recordSignIn(r, user)
 	} else {
 		rurl = a.prepErrorRedirectURL(unauthorizedError("Unverified email with %v", providerType), r, rurl)
 	}
@@ -384,12 +459,30 @@ func (a *API) loadExternalState(ctx context.Context, state string) (context.Cont
 	if err != nil || claims.Provider == "" {
 		return nil, badRequestError("OAuth state is invalid: %v", err)
 	}
+	if config.Security.OAuthStrict.Enabled {
+		if claims.Id == "" {
+			return nil, badRequestError("OAuth state is invalid: missing state id")
+		}
+		firstUse, err := models.UseNonce(a.getDB(ctx), getInstanceID(ctx), models.NonceOAuthState, claims.Id, time.Unix(claims.ExpiresAt, 0))
+		if err != nil {
+			return nil, internalServerError("Database error using OAuth state").WithInternalError(err)
+		}
+		if !firstUse {
+			return nil, badRequestError("OAuth state has already been used")
+		}
+	}
 	if claims.InviteToken != "" {
 		ctx = withInviteToken(ctx, claims.InviteToken)
 	}
 	if claims.Referrer != "" {
 		ctx = withExternalReferrer(ctx, claims.Referrer)
 	}
+	if claims.FlowStateID != "" {
+		ctx = withFlowStateID(ctx, claims.FlowStateID)
+	}
+	if claims.LinkingTargetID != "" {
+		ctx = withLinkingTargetID(ctx, claims.LinkingTargetID)
+	}
 
 	ctx = withExternalProviderType(ctx, claims.Provider)
 	return withSignature(ctx, state), nil
@@ -399,6 +492,9 @@ func (a *API) loadExternalState(ctx context.Context, state string) (context.Cont
 func (a *API) Provider(ctx context.Context, name string, scopes string, query *url.Values) (provider.Provider, error) {
 	config := a.getConfig(ctx)
 	name = strings.ToLower(name)
+	if isSSOProviderType(name) {
+		return a.ssoProvider(ctx, name, scopes)
+	}
 
 	switch name {
 	case "apple":
@@ -434,7 +530,7 @@ func (a *API) Provider(ctx context.Context, name string, scopes string, query *u
 	case "workos":
 		return provider.NewWorkOSProvider(config.External.WorkOS, query)
 	case "saml":
-		return provider.NewSamlProvider(config.External.Saml, a.db, getInstanceID(ctx))
+		return provider.NewSamlProvider(config.External.Saml, a.getDB(ctx), getInstanceID(ctx))
 	case "zoom":
 		return provider.NewZoomProvider(config.External.Zoom)
 	default:
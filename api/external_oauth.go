@@ -2,16 +2,31 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/url"
 
 	"github.com/mrjones/oauth"
 	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/breaker"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/storage"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
 )
 
+// isOAuthProviderFailure tells apart provider outages from codes the provider
+// rejected, which don't count against its circuit breaker.
+func isOAuthProviderFailure(err error) bool {
+	var rerr *oauth2.RetrieveError
+	if errors.As(err, &rerr) && rerr.Response != nil {
+		return rerr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
 // OAuthProviderData contains the userData and token returned by the oauth provider
 type OAuthProviderData struct {
 	userData *provider.UserProvidedData
@@ -73,12 +88,23 @@ func (a *API) oAuthCallback(ctx context.Context, r *http.Request, providerType s
 		"code":     oauthCode,
 	}).Debug("Exchanging oauth code")
 
-	token, err := oAuthProvider.GetOAuthToken(oauthCode)
+	var token *oauth2.Token
+	span, _ := opentracing.StartSpanFromContext(ctx, "oauth.exchange", ext.SpanKindRPCClient)
+	span.SetTag("oauth.provider", providerType)
+	err = breaker.Get("oauth "+providerType).Do(func() error {
+		var terr error
+		token, terr = oAuthProvider.GetOAuthToken(oauthCode)
+		return terr
+	}, isOAuthProviderFailure)
+	finishSpan(span, err)
 	if err != nil {
 		return nil, internalServerError("Unable to exchange external code: %s", oauthCode).WithInternalError(err)
 	}
 
-	userData, err := oAuthProvider.GetUserData(ctx, token)
+	span, spanCtx := opentracing.StartSpanFromContext(ctx, "oauth.user_data", ext.SpanKindRPCClient)
+	span.SetTag("oauth.provider", providerType)
+	userData, err := oAuthProvider.GetUserData(spanCtx, token)
+	finishSpan(span, err)
 	if err != nil {
 		return nil, internalServerError("Error getting user email from external provider").WithInternalError(err)
 	}
@@ -119,7 +145,7 @@ func (a *API) oAuth1Callback(ctx context.Context, r *http.Request, providerType
 		if err != nil {
 			return &OAuthProviderData{}, err
 		}
-		if requestToken.Token != oauthToken {
+		if !secureCompare(requestToken.Token, oauthToken) {
 			return nil, internalServerError("Request token doesn't match token in callback")
 		}
 		twitterProvider.OauthVerifier = oauthVerifier
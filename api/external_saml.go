@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/models"
 )
 
 func (a *API) loadSAMLState(w http.ResponseWriter, r *http.Request) (context.Context, error) {
@@ -18,10 +19,19 @@ func (a *API) loadSAMLState(w http.ResponseWriter, r *http.Request) (context.Con
 	return a.loadExternalState(ctx, state)
 }
 
-func (a *API) samlCallback(ctx context.Context, r *http.Request) (*provider.UserProvidedData, error) {
+func (a *API) samlCallback(ctx context.Context, r *http.Request, providerType string) (*provider.UserProvidedData, error) {
 	config := a.getConfig(ctx)
 
-	samlProvider, err := provider.NewSamlProvider(config.External.Saml, a.db, getInstanceID(ctx))
+	var samlProvider *provider.SamlProvider
+	var ssoProvider *models.SSOProvider
+	var err error
+	if isSSOProviderType(providerType) {
+		if ssoProvider, err = a.findSSOProvider(ctx, providerType); err == nil {
+			samlProvider, err = a.ssoSamlProvider(ctx, ssoProvider)
+		}
+	} else {
+		samlProvider, err = provider.NewSamlProvider(config.External.Saml, a.getDB(ctx), getInstanceID(ctx))
+	}
 	if err != nil {
 		return nil, badRequestError("Could not initialize SAML provider: %+v", err).WithInternalError(err)
 	}
@@ -47,6 +57,9 @@ func (a *API) samlCallback(ctx context.Context, r *http.Request) (*provider.User
 	if assertionInfo == nil {
 		return nil, internalServerError("SAML Assertion is missing")
 	}
+	if ssoProvider != nil {
+		return ssoSamlUserData(ssoProvider, assertionInfo.NameID, samlAttributes(assertionInfo.Values))
+	}
 	userData := &provider.UserProvidedData{
 		Emails: []provider.Email{{
 			Email:    assertionInfo.NameID,
@@ -59,12 +72,36 @@ func (a *API) samlCallback(ctx context.Context, r *http.Request) (*provider.User
 	return userData, nil
 }
 
+// ssoSamlUserData maps the attributes of a SAML assertion of an SSO provider
+// to the user. The email defaults to the NameID.
+func ssoSamlUserData(p *models.SSOProvider, nameID string, attributes map[string]interface{}) (*provider.UserProvidedData, error) {
+	claims, err := provider.MapAttributes(p.AttributeMapping, attributes)
+	if err != nil {
+		return nil, badRequestError("Could not map SAML attributes: %v", err).WithInternalError(err)
+	}
+	claims.Issuer = p.EntityID
+	claims.Subject = nameID
+	if claims.Email == "" {
+		claims.Email = nameID
+	}
+	claims.EmailVerified = true
+
+	return &provider.UserProvidedData{
+		Emails: []provider.Email{{
+			Email:    claims.Email,
+			Verified: true,
+			Primary:  true,
+		}},
+		Metadata: claims,
+	}, nil
+}
+
 // SAMLMetadata returns metadata information about the SAML provider
 func (a *API) SAMLMetadata(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	config := getConfig(ctx)
 
-	samlProvider, err := provider.NewSamlProvider(config.External.Saml, a.db, getInstanceID(ctx))
+	samlProvider, err := provider.NewSamlProvider(config.External.Saml, a.getDB(ctx), getInstanceID(ctx))
 	if err != nil {
 		return internalServerError("Could not create SAML Provider: %+v", err).WithInternalError(err)
 	}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/models"
+	"github.com/russellhaering/gosaml2/types"
+)
+
+// ssoProviderPrefix prefixes the id of an SSO provider in the provider type of
+// the external provider flow, e.g. "sso:<sso_provider_id>".
+const ssoProviderPrefix = "sso:"
+
+func isSSOProviderType(providerType string) bool {
+	return strings.HasPrefix(providerType, ssoProviderPrefix)
+}
+
+// resolveSSOProviderType returns the provider type of the SSO provider a
+// sign-in with provider=sso is for, chosen by sso_provider_id or by the domain
+// of the user's email.
+func (a *API) resolveSSOProviderType(ctx context.Context, query url.Values) (string, error) {
+	instanceID := getInstanceID(ctx)
+
+	var p *models.SSOProvider
+	var err error
+	if id := query.Get("sso_provider_id"); id != "" {
+		providerID, perr := uuid.FromString(id)
+		if perr != nil {
+			return "", badRequestError("sso_provider_id must be an UUID")
+		}
+		p, err = models.FindSSOProvider(a.getDB(ctx), instanceID, providerID)
+	} else if domain := query.Get("domain"); domain != "" {
+		if i := strings.LastIndex(domain, "@"); i >= 0 {
+			domain = domain[i+1:]
+		}
+		p, err = models.FindSSOProviderByDomain(a.getDB(ctx), instanceID, domain)
+	} else {
+		return "", badRequestError("Signing in with SSO requires sso_provider_id or domain")
+	}
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return "", notFoundError("No SSO provider found")
+		}
+		return "", internalServerError("Database error finding SSO provider").WithInternalError(err)
+	}
+
+	return ssoProviderPrefix + p.ID.String(), nil
+}
+
+// isSSOSamlProviderType tells whether the provider type is of a SAML provider
+// added with the admin API.
+func (a *API) isSSOSamlProviderType(ctx context.Context, providerType string) bool {
+	if !isSSOProviderType(providerType) {
+		return false
+	}
+	p, err := a.findSSOProvider(ctx, providerType)
+	return err == nil && p.Type == models.SSOProviderTypeSAML
+}
+
+// findSSOProvider loads the SSO provider of a provider type returned by
+// resolveSSOProviderType.
+func (a *API) findSSOProvider(ctx context.Context, providerType string) (*models.SSOProvider, error) {
+	providerID, err := uuid.FromString(strings.TrimPrefix(providerType, ssoProviderPrefix))
+	if err != nil {
+		return nil, err
+	}
+	return models.FindSSOProvider(a.getDB(ctx), getInstanceID(ctx), providerID)
+}
+
+// ssoProvider returns the account provider of an SSO provider.
+func (a *API) ssoProvider(ctx context.Context, providerType, scopes string) (provider.Provider, error) {
+	p, err := a.findSSOProvider(ctx, providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case models.SSOProviderTypeSAML:
+		return a.ssoSamlProvider(ctx, p)
+	case models.SSOProviderTypeOIDC:
+		if a.config.API.ExternalURL == "" {
+			return nil, fmt.Errorf("API_EXTERNAL_URL is required to sign in with OIDC providers")
+		}
+		redirectURI := strings.TrimSuffix(a.config.API.ExternalURL, "/") + "/callback"
+		return provider.NewOIDCSSOProvider(p.Issuer, p.ClientID, p.ClientSecret, redirectURI, scopes, p.AttributeMapping)
+	default:
+		return nil, fmt.Errorf("SSO provider type %s is not supported", p.Type)
+	}
+}
+
+// ssoSamlProvider returns the SAML provider of an SSO provider. The service
+// provider settings are shared with the SAML provider of the configuration.
+func (a *API) ssoSamlProvider(ctx context.Context, p *models.SSOProvider) (*provider.SamlProvider, error) {
+	config := a.getConfig(ctx)
+
+	var meta *types.EntityDescriptor
+	var err error
+	if p.MetadataXML != "" {
+		meta, err = provider.ParseSamlMetadata([]byte(p.MetadataXML))
+	} else {
+		meta, err = provider.FetchSamlMetadata(p.MetadataURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Loading metadata failed: %+v", err)
+	}
+
+	return provider.NewSamlProviderWithMetadata(config.External.Saml, meta, a.getDB(ctx), getInstanceID(ctx))
+}
+
+// samlAttributes returns the first value of each attribute of an assertion.
+func samlAttributes(values map[string]types.Attribute) map[string]interface{} {
+	attributes := make(map[string]interface{}, len(values))
+	for name, attribute := range values {
+		if len(attribute.Values) > 0 {
+			attributes[name] = attribute.Values[0].Value
+		}
+	}
+	return attributes
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -18,6 +19,25 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	requestIDHeader    = "X-Request-Id"
+	maxRequestIDLength = 128
+)
+
+// validRequestID returns true if an incoming request ID is safe to copy into
+// responses, logs, audit log entries and webhook headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
 func addRequestID(globalConfig *conf.GlobalConfiguration) middlewareHandler {
 	return func(w http.ResponseWriter, r *http.Request) (context.Context, error) {
 		id := ""
@@ -25,6 +45,9 @@ func addRequestID(globalConfig *conf.GlobalConfiguration) middlewareHandler {
 			id = r.Header.Get(globalConfig.API.RequestIDHeader)
 		}
 		if id == "" {
+			id = r.Header.Get(requestIDHeader)
+		}
+		if !validRequestID(id) {
 			uid, err := uuid.NewV4()
 			if err != nil {
 				return nil, err
@@ -32,12 +55,30 @@ func addRequestID(globalConfig *conf.GlobalConfiguration) middlewareHandler {
 			id = uid.String()
 		}
 
+		w.Header().Set(requestIDHeader, id)
+
 		ctx := r.Context()
 		ctx = withRequestID(ctx, id)
+		if traceID := traceIDFromTraceparent(r.Header.Get("traceparent")); traceID != "" {
+			ctx = withTraceID(ctx, traceID)
+		}
 		return ctx, nil
 	}
 }
 
+// traceIDFromTraceparent extracts the trace ID from a W3C traceparent header
+// (version-traceid-parentid-flags), so upstream traces can be followed.
+func traceIDFromTraceparent(header string) string {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+	return parts[1]
+}
+
 func sendJSON(w http.ResponseWriter, status int, obj interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	b, err := json.Marshal(obj)
@@ -139,6 +180,28 @@ func isRedirectURLValid(config *conf.Configuration, redirectURL string) bool {
 		return false
 	}
 
+	if config.URIAllowLocalhost && isLocalhostURL(redirectURL) {
+		return true
+	}
+
+	// Strict mode only accepts redirect URLs that exactly match a registered one
+	if config.Security.OAuthStrict.Enabled {
+		if redirectURL == config.SiteURL {
+			return true
+		}
+		for _, uri := range config.URIAllowList {
+			if redirectURL == uri {
+				return true
+			}
+		}
+		for _, uri := range config.DeepLinks.AppLinks {
+			if redirectURL == uri {
+				return true
+			}
+		}
+		return false
+	}
+
 	base, berr := parseURL(config.SiteURL)
 	refurl, rerr := parseURL(redirectURL)
 
@@ -151,13 +214,18 @@ func isRedirectURLValid(config *conf.Configuration, redirectURL string) bool {
 
 	// For case when user came from mobile app or other permitted resource - redirect back
 	for uri, g := range config.URIAllowListMap {
-		// Only allow wildcard matching if url scheme is http(s)
 		if strings.HasPrefix(uri, "http") || strings.HasPrefix(uri, "https") {
 			if g.Match(matchURL) {
 				return true
 			}
-		} else if redirectURL == uri {
-			// checking the raw URL as this is no longer a http(s) URL
+		} else if redirectURL == uri || g.Match(redirectURL) {
+			// checking the raw URL as this is no longer a http(s) URL, the
+			// scheme of custom scheme entries can't have wildcards
+			return true
+		}
+	}
+	for _, g := range config.DeepLinks.AppLinkGlobs {
+		if g.Match(matchURL) {
 			return true
 		}
 	}
@@ -165,6 +233,20 @@ func isRedirectURLValid(config *conf.Configuration, redirectURL string) bool {
 	return false
 }
 
+// isLocalhostURL reports whether the URL points at the machine the browser
+// runs on.
+func isLocalhostURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
 func (a *API) getReferrer(r *http.Request) string {
 	ctx := r.Context()
 	config := a.getConfig(ctx)
@@ -197,6 +279,67 @@ func (a *API) getRedirectURLOrReferrer(r *http.Request, reqref string) string {
 	return a.getReferrer(r)
 }
 
+// withRedirectParams adds the REDIRECT_PASSTHROUGH_PARAMS of the request to
+// redirectURL, so they survive the email round trip.
+func withRedirectParams(config *conf.Configuration, r *http.Request, redirectURL string) string {
+	passthrough := url.Values{}
+	query := r.URL.Query()
+	for _, key := range config.RedirectPassthroughParams {
+		if value := query.Get(key); value != "" {
+			passthrough.Set(key, value)
+		}
+	}
+	return appendRedirectParams(redirectURL, passthrough)
+}
+
+// splitRedirectParams removes the REDIRECT_PASSTHROUGH_PARAMS from
+// redirectURL, so it can be checked against the allow list, and returns them
+// along with the ones in the request. Mail templates don't escape the
+// redirect URL, so all but its first query parameter end up in the query of
+// the verification link itself.
+func splitRedirectParams(config *conf.Configuration, r *http.Request, redirectURL string) (string, url.Values) {
+	passthrough := url.Values{}
+	if len(config.RedirectPassthroughParams) == 0 {
+		return redirectURL, passthrough
+	}
+
+	query := r.URL.Query()
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return redirectURL, passthrough
+	}
+	redirectQuery := u.Query()
+	for _, key := range config.RedirectPassthroughParams {
+		if value := redirectQuery.Get(key); value != "" {
+			passthrough.Set(key, value)
+		} else if value := query.Get(key); value != "" {
+			passthrough.Set(key, value)
+		}
+		redirectQuery.Del(key)
+	}
+	if len(passthrough) == 0 {
+		return redirectURL, passthrough
+	}
+	u.RawQuery = redirectQuery.Encode()
+	return u.String(), passthrough
+}
+
+func appendRedirectParams(redirectURL string, params url.Values) string {
+	if len(params) == 0 {
+		return redirectURL
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return redirectURL
+	}
+	query := u.Query()
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
 var privateIPBlocks []*net.IPNet
 
 func init() {
@@ -250,6 +393,16 @@ type noLocalTransport struct {
 }
 
 func (no noLocalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// through a proxy only the proxy is connected to, so the destination is
+	// checked up front instead
+	if proxyURL(no.inner, req) != nil {
+		if err := checkPublicHost(req.Context(), req.URL.Hostname()); err != nil {
+			no.errlog.WithError(err).Warn("Blocked request through proxy")
+			return nil, err
+		}
+		return no.inner.RoundTrip(req)
+	}
+
 	ctx, cancel := context.WithCancel(req.Context())
 
 	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
@@ -294,6 +447,40 @@ func SafeRoundtripper(trans http.RoundTripper, log logrus.FieldLogger) http.Roun
 	return ret
 }
 
+// proxyURL returns the proxy the transport sends the request through, if any.
+func proxyURL(trans http.RoundTripper, req *http.Request) *url.URL {
+	t, ok := trans.(*http.Transport)
+	if !ok || t.Proxy == nil {
+		return nil
+	}
+	u, err := t.Proxy(req)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// checkPublicHost fails when the host resolves to a private address.
+func checkPublicHost(ctx context.Context, host string) error {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return err
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			return fmt.Errorf("%s resolves to the private address %s", host, ip)
+		}
+	}
+	return nil
+}
+
 func SafeHTTPClient(client *http.Client, log logrus.FieldLogger) *http.Client {
 	client.Transport = SafeRoundtripper(client.Transport, log)
 
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sync"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage/test"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -196,3 +198,28 @@ func TestHookNoServer(t *testing.T) {
 }
 
 func squash(f func() error) { _ = f }
+
+func TestSafeRoundtripperThroughProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	// the proxy runs on localhost, which is only allowed as the proxy
+	client := SafeHTTPClient(&http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}, logrus.New())
+
+	rsp, err := client.Get("http://93.184.216.34/hook")
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, []string{"http://93.184.216.34/hook"}, proxied)
+
+	_, err = client.Get("http://10.0.0.1/hook")
+	require.Error(t, err)
+	assert.Len(t, proxied, 1)
+}
@@ -15,10 +15,12 @@ import (
 
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/breaker"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
 )
@@ -33,6 +35,7 @@ const (
 	SignupEvent         = "signup"
 	EmailChangeEvent    = "email_change"
 	LoginEvent          = "login"
+	ShadowBannedEvent   = "shadow_banned"
 )
 
 var defaultTimeout = time.Second * 5
@@ -76,7 +79,7 @@ func (w *Webhook) trigger() (io.ReadCloser, error) {
 	client := http.Client{
 		Timeout: timeout,
 	}
-	client.Transport = SafeRoundtripper(client.Transport, hooklog)
+	client.Transport = &breaker.Transport{Prefix: "webhook ", Inner: SafeRoundtripper(client.Transport, hooklog)}
 
 	for i := 0; i < w.Retries; i++ {
 		hooklog = hooklog.WithField("attempt", i+1)
@@ -87,6 +90,9 @@ func (w *Webhook) trigger() (io.ReadCloser, error) {
 			return nil, internalServerError("Failed to make request object").WithInternalError(err)
 		}
 		req.Header.Set("Content-Type", "application/json")
+		for name, value := range w.headers {
+			req.Header.Set(name, value)
+		}
 		watcher, req := watchForConnection(req)
 
 		if w.jwtSecret != "" {
@@ -100,6 +106,9 @@ func (w *Webhook) trigger() (io.ReadCloser, error) {
 		start := time.Now()
 		rsp, err := client.Do(req)
 		if err != nil {
+			if errors.Is(err, breaker.ErrOpen) {
+				return nil, httpError(http.StatusServiceUnavailable, "Webhook %s keeps failing and is paused", w.URL)
+			}
 			if terr, ok := err.(net.Error); ok && terr.Timeout() {
 				// timed out - try again?
 				if i == w.Retries-1 {
@@ -183,34 +192,85 @@ func triggerEventHooks(ctx context.Context, conn *storage.Connection, event Hook
 	return nil
 }
 
+// notifyShadowBannedSignIn sends the shadow_banned event of a shadow banned
+// user that signed in to the webhooks. The sign-in goes on if it can't be
+// sent, so the user isn't tipped off.
+func (a *API) notifyShadowBannedSignIn(ctx context.Context, r *http.Request, conn *storage.Connection, user *models.User) {
+	if err := triggerEventHooks(ctx, conn, ShadowBannedEvent, user, getInstanceID(ctx), a.getConfig(ctx)); err != nil {
+		logger.GetLogEntry(r).WithError(err).Warn("Failed to send shadow_banned event")
+	}
+}
+
 func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *storage.Connection, event HookEvent, user *models.User, instanceID uuid.UUID, config *conf.Configuration) error {
+	w, err := newWebhook(ctx, hookURL, secret, event, user, instanceID, config)
+	if err != nil {
+		return err
+	}
+
+	body, err := w.trigger()
+	defer func() {
+		if body != nil {
+			body.Close()
+		}
+	}()
+	if err == nil && body != nil {
+		webhookRsp := &WebhookResponse{}
+		decoder := json.NewDecoder(body)
+		if err = decoder.Decode(webhookRsp); err != nil {
+			return internalServerError("Webhook returned malformed JSON: %v", err).WithInternalError(err)
+		}
+		return conn.Transaction(func(tx *storage.Connection) error {
+			if webhookRsp.UserMetaData != nil {
+				user.UserMetaData = nil
+				if terr := user.UpdateUserMetaData(tx, webhookRsp.UserMetaData); terr != nil {
+					return terr
+				}
+			}
+			if webhookRsp.AppMetaData != nil {
+				user.AppMetaData = nil
+				if terr := user.UpdateAppMetaData(tx, webhookRsp.AppMetaData); terr != nil {
+					return terr
+				}
+			}
+			return nil
+		})
+	}
+	return err
+}
+
+// newWebhook builds the signed request of event for user to hookURL, which is
+// relative to the site URL unless absolute.
+func newWebhook(ctx context.Context, hookURL *url.URL, secret string, event HookEvent, user *models.User, instanceID uuid.UUID, config *conf.Configuration) (*Webhook, error) {
 	if !hookURL.IsAbs() {
 		siteURL, err := url.Parse(config.SiteURL)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to parse Site URL")
+			return nil, errors.Wrapf(err, "Failed to parse Site URL")
 		}
 		hookURL.Scheme = siteURL.Scheme
 		hookURL.Host = siteURL.Host
 		hookURL.User = siteURL.User
 	}
 
+	requestID := getRequestID(ctx)
 	payload := struct {
 		Event      HookEvent    `json:"event"`
 		InstanceID uuid.UUID    `json:"instance_id,omitempty"`
+		RequestID  string       `json:"request_id,omitempty"`
 		User       *models.User `json:"user"`
 	}{
 		Event:      event,
 		InstanceID: instanceID,
+		RequestID:  requestID,
 		User:       user,
 	}
 	data, err := json.Marshal(&payload)
 	if err != nil {
-		return internalServerError("Failed to serialize the data for signup webhook").WithInternalError(err)
+		return nil, internalServerError("Failed to serialize the data for signup webhook").WithInternalError(err)
 	}
 
 	sha, err := checksum(data)
 	if err != nil {
-		return internalServerError("Failed to checksum the data for signup webhook").WithInternalError(err)
+		return nil, internalServerError("Failed to checksum the data for signup webhook").WithInternalError(err)
 	}
 
 	claims := webhookClaims{
@@ -222,45 +282,24 @@ func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *sto
 		SHA256: sha,
 	}
 
-	w := Webhook{
-		WebhookConfig: &config.Webhook,
+	webhookConfig := config.Webhook
+	webhookConfig.URL = hookURL.String()
+	return &Webhook{
+		WebhookConfig: &webhookConfig,
 		jwtSecret:     secret,
 		instanceID:    instanceID,
 		claims:        claims,
 		payload:       data,
-	}
-
-	w.URL = hookURL.String()
+		headers:       requestIDHeaders(requestID),
+	}, nil
+}
 
-	body, err := w.trigger()
-	defer func() {
-		if body != nil {
-			body.Close()
-		}
-	}()
-	if err == nil && body != nil {
-		webhookRsp := &WebhookResponse{}
-		decoder := json.NewDecoder(body)
-		if err = decoder.Decode(webhookRsp); err != nil {
-			return internalServerError("Webhook returned malformed JSON: %v", err).WithInternalError(err)
-		}
-		return conn.Transaction(func(tx *storage.Connection) error {
-			if webhookRsp.UserMetaData != nil {
-				user.UserMetaData = nil
-				if terr := user.UpdateUserMetaData(tx, webhookRsp.UserMetaData); terr != nil {
-					return terr
-				}
-			}
-			if webhookRsp.AppMetaData != nil {
-				user.AppMetaData = nil
-				if terr := user.UpdateAppMetaData(tx, webhookRsp.AppMetaData); terr != nil {
-					return terr
-				}
-			}
-			return nil
-		})
+// requestIDHeaders forwards the request ID to outgoing calls so they can be correlated.
+func requestIDHeaders(requestID string) map[string]string {
+	if requestID == "" {
+		return nil
 	}
-	return err
+	return map[string]string{requestIDHeader: requestID}
 }
 
 func watchForConnection(req *http.Request) (*connectionWatcher, *http.Request) {
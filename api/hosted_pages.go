@@ -0,0 +1,184 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/netlify/gotrue/conf"
+)
+
+const (
+	landingPage       = "landing"
+	expiredLinkPage   = "expired"
+	resetPasswordPage = "reset-password"
+)
+
+var hostedPages = template.Must(template.New("layout").Parse(`{{define "layout"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<title>{{if .ProductName}}{{.ProductName}}{{else}}Account{{end}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; background: #f6f8fa; color: #24292f; margin: 0; }
+main { max-width: 360px; margin: 10vh auto; background: #fff; border-radius: 8px; padding: 32px; box-shadow: 0 1px 3px rgba(0, 0, 0, 0.12); }
+img { max-height: 48px; margin-bottom: 16px; }
+input { box-sizing: border-box; width: 100%; padding: 8px; margin: 4px 0 12px; border: 1px solid #d0d7de; border-radius: 6px; }
+button, .button { display: inline-block; border: 0; border-radius: 6px; padding: 8px 16px; color: #fff; background: {{.PrimaryColor}}; text-decoration: none; cursor: pointer; }
+a { color: {{.PrimaryColor}}; }
+.error { color: #cf222e; }
+[hidden] { display: none; }
+</style>
+</head>
+<body>
+<main>
+{{if .LogoURL}}<img src="{{.LogoURL}}" alt="{{.ProductName}}">{{end}}
+{{template "content" .}}
+</main>
+<script>
+var fragment = new URLSearchParams(window.location.hash.substring(1));
+// the tokens in the fragment shouldn't stay in the history
+history.replaceState(null, "", window.location.pathname);
+</script>
+{{template "script" .}}
+</body>
+</html>
+{{end}}
+{{define "script"}}{{end}}`))
+
+var hostedPageTemplates = map[string]*template.Template{
+	landingPage: template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}
+<h1 id="title">You're all set</h1>
+<p id="message">Your email address has been confirmed.</p>
+<p><a class="button" href="{{.SiteURL}}">Continue to {{if .ProductName}}{{.ProductName}}{{else}}the site{{end}}</a></p>
+{{end}}
+{{define "script"}}<script>
+if (fragment.get("message")) {
+  document.getElementById("message").textContent = fragment.get("message");
+} else if (fragment.get("type") === "magiclink") {
+  document.getElementById("message").textContent = "You're signed in.";
+}
+</script>{{end}}`)),
+	expiredLinkPage: template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}
+<h1>This link can't be used</h1>
+<p id="message" class="error">The link is invalid or has expired.</p>
+<p>Please request a new link from {{if .ProductName}}{{.ProductName}}{{else}}the site{{end}}.</p>
+<p id="resend" hidden>A new link can be requested in <span id="resend-in"></span> seconds.</p>
+<p><a class="button" href="{{.SiteURL}}">Back to {{if .ProductName}}{{.ProductName}}{{else}}the site{{end}}</a></p>
+{{end}}
+{{define "script"}}<script>
+if (fragment.get("error_description")) {
+  document.getElementById("message").textContent = fragment.get("error_description");
+}
+if (Number(fragment.get("resend_in")) > 0) {
+  document.getElementById("resend-in").textContent = fragment.get("resend_in");
+  document.getElementById("resend").hidden = false;
+}
+</script>{{end}}`)),
+	resetPasswordPage: template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}
+<h1>Choose a new password</h1>
+<p id="error" class="error" hidden></p>
+<form id="form">
+<label for="password">New password</label>
+<input id="password" type="password" autocomplete="new-password" minlength="{{.PasswordMinLength}}" required>
+<label for="confirm">Confirm the new password</label>
+<input id="confirm" type="password" autocomplete="new-password" minlength="{{.PasswordMinLength}}" required>
+<button type="submit">Update password</button>
+</form>
+<div id="done" hidden>
+<p>Your password has been updated.</p>
+<p><a class="button" href="{{.SiteURL}}">Continue to {{if .ProductName}}{{.ProductName}}{{else}}the site{{end}}</a></p>
+</div>
+{{end}}
+{{define "script"}}<script>
+var accessToken = fragment.get("access_token");
+var form = document.getElementById("form");
+var error = document.getElementById("error");
+function showError(message) {
+  error.textContent = message;
+  error.hidden = false;
+}
+if (!accessToken) {
+  form.hidden = true;
+  showError("The link is invalid or has expired.");
+}
+form.addEventListener("submit", function (event) {
+  event.preventDefault();
+  var password = document.getElementById("password").value;
+  if (password !== document.getElementById("confirm").value) {
+    showError("The passwords don't match.");
+    return;
+  }
+  fetch("{{.UserURL}}", {
+    method: "PUT",
+    headers: { "Authorization": "Bearer " + accessToken, "Content-Type": "application/json" },
+    body: JSON.stringify({ password: password })
+  }).then(function (response) {
+    if (response.ok) {
+      form.hidden = true;
+      document.getElementById("done").hidden = false;
+      return;
+    }
+    return response.json().then(function (body) {
+      showError(body.msg || "The password could not be updated.");
+    });
+  }).catch(function () {
+    showError("The password could not be updated.");
+  });
+});
+</script>{{end}}`)),
+}
+
+// hostedPageURL is the URL of a hosted page, which is relative to the API
+// when API_EXTERNAL_URL is not set.
+func (a *API) hostedPageURL(page string) string {
+	return strings.TrimSuffix(a.config.API.ExternalURL, "/") + "/pages/" + page
+}
+
+// useHostedPages tells if a verification redirecting to redirectURL should
+// land on the hosted pages instead. Only redirects to SITE_URL do, so apps
+// can still pass their own redirect_to.
+func useHostedPages(config *conf.Configuration, redirectURL string) bool {
+	if !config.HostedPages.Enabled {
+		return false
+	}
+	u, err := parseURL(redirectURL)
+	site, serr := parseURL(config.SiteURL)
+	if err != nil || serr != nil {
+		return false
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String() == site.String()
+}
+
+// hostedPage serves one of the hosted pages, when they are enabled for the
+// instance.
+func (a *API) hostedPage(page string) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		config := a.getConfig(r.Context())
+		if !config.HostedPages.Enabled {
+			return notFoundError("Hosted pages are disabled")
+		}
+
+		userURL, err := url.Parse(a.hostedPageURL(page))
+		if err != nil {
+			return internalServerError("Invalid hosted page URL").WithInternalError(err)
+		}
+		userURL = userURL.ResolveReference(&url.URL{Path: "../user"})
+
+		setHTMLHeaders(w, config)
+		w.WriteHeader(http.StatusOK)
+		return hostedPageTemplates[page].ExecuteTemplate(w, "layout", map[string]interface{}{
+			"ProductName":       config.HostedPages.ProductName,
+			"LogoURL":           config.HostedPages.LogoURL,
+			"PrimaryColor":      template.CSS(config.HostedPages.PrimaryColor),
+			"SiteURL":           config.SiteURL,
+			"PasswordMinLength": config.PasswordMinLength,
+			"UserURL":           userURL.String(),
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseHostedPages(t *testing.T) {
+	config := &conf.Configuration{SiteURL: "https://example.com"}
+	require.NoError(t, config.ApplyDefaults())
+	assert.False(t, useHostedPages(config, "https://example.com"))
+
+	config.HostedPages.Enabled = true
+	assert.True(t, useHostedPages(config, "https://example.com"))
+	assert.True(t, useHostedPages(config, "https://example.com/?utm_source=news"))
+	assert.False(t, useHostedPages(config, "https://example.com/welcome"))
+	assert.False(t, useHostedPages(config, "myapp://auth/callback"))
+}
+
+func TestHostedPage(t *testing.T) {
+	config := &conf.Configuration{SiteURL: "https://example.com", PasswordMinLength: 8}
+	config.HostedPages.ProductName = "Example <App>"
+	require.NoError(t, config.ApplyDefaults())
+
+	globalConfig := &conf.GlobalConfiguration{}
+	globalConfig.API.ExternalURL = "https://example.com/auth/v1/"
+	api := &API{config: globalConfig}
+	render := func(page string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/pages/"+page, nil)
+		req = req.WithContext(withConfig(req.Context(), config))
+		w := httptest.NewRecorder()
+		if err := api.hostedPage(page)(w, req); err != nil {
+			handleError(err, w, req)
+		}
+		return w
+	}
+
+	w := render(resetPasswordPage)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.HostedPages.Enabled = true
+	for _, page := range []string{landingPage, expiredLinkPage, resetPasswordPage} {
+		w = render(page)
+		assert.Equal(t, http.StatusOK, w.Code, page)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.NotEmpty(t, w.Header().Get("Content-Security-Policy"))
+		assert.Contains(t, w.Body.String(), "Example &lt;App&gt;")
+		assert.Contains(t, w.Body.String(), "#1a73e8")
+	}
+	assert.Contains(t, w.Body.String(), `"https:\/\/example.com\/auth\/v1\/user"`)
+	assert.Contains(t, w.Body.String(), `minlength="8"`)
+}
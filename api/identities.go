@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// UserIdentityLinkParams are the parameters of the external provider flow
+// that links an identity to the user.
+type UserIdentityLinkParams struct {
+	Provider            string `json:"provider"`
+	Scopes              string `json:"scopes"`
+	RedirectTo          string `json:"redirect_to"`
+	FlowType            string `json:"flow_type"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// UserIdentities lists the identities the user signs in with.
+func (a *API) UserIdentities(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	identities, err := models.FindIdentitiesByUser(a.getDB(ctx), user)
+	if err != nil {
+		return internalServerError("Database error finding identities").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"identities": identities,
+	})
+}
+
+// UserIdentityLink starts the external provider flow that links an identity
+// to the user. It returns the URL of the provider rather than redirecting to
+// it, as the request carries the user's access token.
+func (a *API) UserIdentityLink(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	params := &UserIdentityLinkParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read identity link params: %v", err)
+	}
+	if params.Provider == "" {
+		return unprocessableEntityError("A provider is required")
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"provider":              params.Provider,
+		"scopes":                params.Scopes,
+		"redirect_to":           params.RedirectTo,
+		"flow_type":             params.FlowType,
+		"code_challenge":        params.CodeChallenge,
+		"code_challenge_method": params.CodeChallengeMethod,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	authURL, err := a.externalProviderAuthURL(w, r, query, user.ID.String())
+	if err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, map[string]string{"url": authURL})
+}
+
+// UserIdentityUnlink removes an identity of the user. The user's last
+// identity can't be removed, so it can always sign in.
+func (a *API) UserIdentityUnlink(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+	providerType := r.URL.Query().Get("provider")
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		identities, terr := models.FindUserIdentitiesByID(tx, user, chi.URLParam(r, "identity_id"))
+		if terr != nil {
+			return internalServerError("Database error finding identity").WithInternalError(terr)
+		}
+		var identity *models.Identity
+		for _, i := range identities {
+			if providerType != "" && i.Provider != providerType {
+				continue
+			}
+			if identity != nil {
+				return badRequestError("The identity is ambiguous, the provider is required")
+			}
+			identity = i
+		}
+		if identity == nil {
+			return notFoundError(models.IdentityNotFoundError{}.Error())
+		}
+
+		if terr := user.UnlinkIdentity(tx, identity); terr != nil {
+			if _, ok := terr.(models.LastIdentityError); ok {
+				return unprocessableEntityError(terr.Error())
+			}
+			return internalServerError("Database error unlinking identity").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.IdentityUnlinkedAction, "", map[string]interface{}{
+			"identity_id": identity.ID,
+			"provider":    identity.Provider,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// linkUserIdentity links the identity of the external provider flow to the
+// user with linkingTargetID. Users without an email take the verified email
+// of the identity, unless another user has it, and anonymous users become
+// regular users.
+func (a *API) linkUserIdentity(r *http.Request, tx *storage.Connection, userData *provider.UserProvidedData, linkingTargetID, providerType string) (*models.User, error) {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+
+	userID, err := uuid.FromString(linkingTargetID)
+	if err != nil {
+		return nil, badRequestError("OAuth state is invalid: invalid linking target")
+	}
+	user, err := models.FindUserByID(tx, userID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError(err.Error())
+		}
+		return nil, internalServerError("Database error finding user").WithInternalError(err)
+	}
+	if user.IsBanned() {
+		return nil, unauthorizedError("User is unauthorized")
+	}
+
+	if _, err := models.FindIdentityByIdAndProvider(tx, userData.Metadata.Subject, providerType); err == nil {
+		return nil, unprocessableEntityError("Identity is already linked to a user")
+	} else if !models.IsNotFoundError(err) {
+		return nil, internalServerError("Database error finding identity").WithInternalError(err)
+	}
+
+	identityData, err := userData.Metadata.ToMap()
+	if err != nil {
+		return nil, internalServerError("Error serialising user metadata").WithInternalError(err)
+	}
+	identity, err := a.createNewIdentity(tx, user, providerType, identityData)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.UpdateUserMetaData(tx, identityData); err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+
+	var email string
+	for _, e := range userData.Emails {
+		if e.Verified && (email == "" || e.Primary) {
+			email = e.Email
+		}
+	}
+	if email != "" && user.GetEmail() == "" {
+		exists, err := models.IsDuplicatedEmail(tx, instanceID, email, user.Aud)
+		if err != nil {
+			return nil, internalServerError("Database error checking email").WithInternalError(err)
+		}
+		if !exists {
+			if err := user.SetEmail(tx, email); err != nil {
+				return nil, internalServerError("Database error updating user").WithInternalError(err)
+			}
+			if err := user.Confirm(tx); err != nil {
+				return nil, internalServerError("Database error updating user").WithInternalError(err)
+			}
+		}
+	}
+
+	if err := models.NewAuditLogEntry(r, tx, instanceID, user, models.IdentityLinkedAction, "", map[string]interface{}{
+		"identity_id": identity.ID,
+		"provider":    providerType,
+	}); err != nil {
+		return nil, internalServerError("Error recording audit log entry").WithInternalError(err)
+	}
+	if user.IsAnonymous {
+		if err := a.upgradeAnonymousUser(r, tx, user, providerType); err != nil {
+			return nil, err
+		}
+	} else if err := user.UpdateAppMetaDataProviders(tx); err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return user, nil
+}
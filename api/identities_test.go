@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *UserTestSuite) createIdentity(u *models.User, provider, subject string) *models.Identity {
+	identity, err := models.NewIdentity(u, provider, map[string]interface{}{"sub": subject})
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(identity))
+	return identity
+}
+
+func (ts *UserTestSuite) TestUserIdentities() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), u.Confirm(ts.API.db))
+	email := ts.createIdentity(u, "email", u.ID.String())
+	github := ts.createIdentity(u, "github", "123")
+	token, err := generateAccessToken(u, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/user/identities", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := struct {
+		Identities []models.Identity `json:"identities"`
+	}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Len(ts.T(), data.Identities, 2)
+
+	// the email identity is removed along with the email address
+	req = httptest.NewRequest(http.MethodDelete, "http://localhost/user/identities/"+email.ID+"?provider=email", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	u, err = models.FindUserByID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), u.GetEmail())
+	assert.Nil(ts.T(), u.EmailConfirmedAt)
+	assert.Empty(ts.T(), u.EncryptedPassword)
+	assert.Equal(ts.T(), []interface{}{"github"}, u.AppMetaData["providers"])
+
+	// the last identity is kept
+	req = httptest.NewRequest(http.MethodDelete, "http://localhost/user/identities/"+github.ID, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+	_, err = models.FindIdentityByIdAndProvider(ts.API.db, "123", "github")
+	assert.NoError(ts.T(), err)
+
+	req = httptest.NewRequest(http.MethodDelete, "http://localhost/user/identities/456", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
+
+func (ts *UserTestSuite) TestUserIdentityLink() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	token, err := generateAccessToken(u, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/user/identities", &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"provider": "github",
+	}))
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/user/identities", &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := map[string]string{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Contains(ts.T(), data["url"], "state=")
+}
@@ -20,7 +20,7 @@ func (a *API) loadInstance(w http.ResponseWriter, r *http.Request) (context.Cont
 	}
 	logger.LogEntrySetField(r, "instance_id", instanceID)
 
-	i, err := models.GetInstance(a.db, instanceID)
+	i, err := models.GetInstance(a.getDB(r.Context()), instanceID)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			return nil, notFoundError("Instance not found")
@@ -57,7 +57,7 @@ func (a *API) CreateInstance(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Error decoding params: %v", err)
 	}
 
-	_, err := models.GetInstanceByUUID(a.db, params.UUID)
+	_, err := models.GetInstanceByUUID(a.getDB(r.Context()), params.UUID)
 	if err != nil {
 		if !models.IsNotFoundError(err) {
 			return internalServerError("Database error looking up instance").WithInternalError(err)
@@ -76,7 +76,7 @@ func (a *API) CreateInstance(w http.ResponseWriter, r *http.Request) error {
 		UUID:       params.UUID,
 		BaseConfig: params.BaseConfig,
 	}
-	if err = a.db.Create(&i); err != nil {
+	if err = a.getDB(r.Context()).Create(&i); err != nil {
 		return internalServerError("Database error creating instance").WithInternalError(err)
 	}
 
@@ -109,7 +109,7 @@ func (a *API) UpdateInstance(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Error decoding params: %v", err)
 	}
 
-	if err := i.UpdateConfig(a.db, params.BaseConfig); err != nil {
+	if err := i.UpdateConfig(a.getDB(r.Context()), params.BaseConfig); err != nil {
 		return internalServerError("Database error updating instance").WithInternalError(err)
 	}
 
@@ -122,7 +122,7 @@ func (a *API) UpdateInstance(w http.ResponseWriter, r *http.Request) error {
 
 func (a *API) DeleteInstance(w http.ResponseWriter, r *http.Request) error {
 	i := getInstance(r.Context())
-	if err := models.DeleteInstance(a.db, i); err != nil {
+	if err := models.DeleteInstance(a.getDB(r.Context()), i); err != nil {
 		return internalServerError("Database error deleting instance").WithInternalError(err)
 	}
 
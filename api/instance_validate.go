@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netlify/gotrue/api/sms_provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/logger"
+	"gopkg.in/gomail.v2"
+)
+
+// templateFetchTimeout bounds fetching a mail template while validating a
+// configuration.
+const templateFetchTimeout = 10 * time.Second
+
+// SettingValidation is the result of checking a single setting.
+type SettingValidation struct {
+	Setting string `json:"setting"`
+	Valid   bool   `json:"valid"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ValidationReport lists the checked settings of an instance configuration.
+// Valid is only true if every setting is.
+type ValidationReport struct {
+	Valid    bool                `json:"valid"`
+	Settings []SettingValidation `json:"settings"`
+}
+
+func (v *ValidationReport) add(setting string, err error) {
+	result := SettingValidation{Setting: setting, Valid: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	v.Settings = append(v.Settings, result)
+}
+
+func (v *ValidationReport) valid() bool {
+	for _, s := range v.Settings {
+		if !s.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateInstance checks an instance configuration without applying it. For
+// an existing instance, the posted configuration is applied on top of the
+// stored one as UpdateInstance does.
+func (a *API) ValidateInstance(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	params := InstanceRequestParams{}
+	if i := getInstance(ctx); i != nil {
+		params.BaseConfig = i.BaseConfig
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return badRequestError("Error decoding params: %v", err)
+	}
+	if params.BaseConfig == nil {
+		return badRequestError("A configuration is required")
+	}
+
+	report := a.validateInstanceConfig(r, params.BaseConfig)
+	return sendJSON(w, http.StatusOK, report)
+}
+
+// validateInstanceConfig reports the settings that would only fail at
+// runtime: the redirect allow list, the external and SMS providers, the SMTP
+// server and the mail templates. Providers and SMTP are merged with the
+// global configuration like they are when serving requests.
+func (a *API) validateInstanceConfig(r *http.Request, config *conf.Configuration) *ValidationReport {
+	report := &ValidationReport{Settings: []SettingValidation{}}
+
+	allowListValid := true
+	for _, uri := range config.URIAllowList {
+		err := conf.ValidateRedirectURI(strings.TrimSuffix(uri, "/"))
+		allowListValid = allowListValid && err == nil
+		report.add("uri_allow_list."+uri, err)
+	}
+	// the allow list is validated again when applying defaults
+	if err := config.ApplyDefaults(); err != nil && allowListValid {
+		report.add("config", err)
+	}
+
+	ctx := withConfig(r.Context(), config)
+	config = a.getConfig(ctx)
+
+	for _, p := range enabledExternalProviders(config) {
+		_, err := a.Provider(ctx, p, "", &url.Values{})
+		report.add("external."+p, err)
+	}
+
+	if config.External.Phone.Enabled || config.Sms.Provider != "" {
+		_, err := sms_provider.GetSmsProvider(*config)
+		report.add("sms.provider", err)
+	}
+
+	if config.SMTP.Host != "" {
+		report.add("smtp", checkSMTP(config.SMTP))
+	}
+
+	client := SafeHTTPClient(&http.Client{Timeout: templateFetchTimeout}, logger.GetLogEntry(r))
+	templates := map[string]string{
+		"invite":           config.Mailer.Templates.Invite,
+		"confirmation":     config.Mailer.Templates.Confirmation,
+		"recovery":         config.Mailer.Templates.Recovery,
+		"email_change":     config.Mailer.Templates.EmailChange,
+		"magic_link":       config.Mailer.Templates.MagicLink,
+		"reauthentication": config.Mailer.Templates.Reauthentication,
+	}
+	for _, name := range []string{"invite", "confirmation", "recovery", "email_change", "magic_link", "reauthentication"} {
+		if templateURL := templates[name]; templateURL != "" {
+			report.add("mailer.templates."+name, checkMailTemplate(client, config.SiteURL, templateURL))
+		}
+	}
+
+	report.Valid = report.valid()
+	return report
+}
+
+// enabledExternalProviders lists the enabled providers Provider can create.
+func enabledExternalProviders(config *conf.Configuration) []string {
+	ext := config.External
+	providers := []struct {
+		name    string
+		enabled bool
+	}{
+		{"apple", ext.Apple.Enabled},
+		{"azure", ext.Azure.Enabled},
+		{"bitbucket", ext.Bitbucket.Enabled},
+		{"discord", ext.Discord.Enabled},
+		{"facebook", ext.Facebook.Enabled},
+		{"github", ext.Github.Enabled},
+		{"gitlab", ext.Gitlab.Enabled},
+		{"google", ext.Google.Enabled},
+		{"keycloak", ext.Keycloak.Enabled},
+		{"linkedin", ext.Linkedin.Enabled},
+		{"notion", ext.Notion.Enabled},
+		{"saml", ext.Saml.Enabled},
+		{"slack", ext.Slack.Enabled},
+		{"spotify", ext.Spotify.Enabled},
+		{"twitch", ext.Twitch.Enabled},
+		{"twitter", ext.Twitter.Enabled},
+		{"workos", ext.WorkOS.Enabled},
+		{"zoom", ext.Zoom.Enabled},
+	}
+
+	names := []string{}
+	for _, p := range providers {
+		if p.enabled {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// checkSMTP connects and authenticates to the SMTP server the way sending
+// mail does, without sending any.
+func checkSMTP(config conf.SMTPConfiguration) error {
+	closer, err := gomail.NewDialer(config.Host, config.Port, config.User, config.Pass).Dial()
+	if err != nil {
+		return err
+	}
+	return closer.Close()
+}
+
+// checkMailTemplate fetches a mail template, which is relative to the site
+// URL unless it is absolute, and parses it.
+func checkMailTemplate(client *http.Client, siteURL, templateURL string) error {
+	if !strings.HasPrefix(templateURL, "http") {
+		templateURL = siteURL + templateURL
+	}
+	resp, err := client.Get(templateURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Fetching %s returned status %d", templateURL, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	_, err = template.New(templateURL).Parse(string(body))
+	return err
+}
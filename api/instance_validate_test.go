@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateInstanceConfig(t *testing.T) {
+	api := &API{config: &conf.GlobalConfiguration{}}
+
+	config := &conf.Configuration{SiteURL: "http://127.0.0.1:1"}
+	config.URIAllowList = []string{"https://*.example.com/", "javascript:*"}
+	config.External.Github = conf.OAuthProviderConfiguration{Enabled: true, ClientID: "client", RedirectURI: "https://example.com/callback"}
+	config.Sms.Provider = "twilio"
+	config.Mailer.Templates.Invite = "/invite.html"
+
+	report := api.validateInstanceConfig(httptest.NewRequest("POST", "/instances/validate", nil), config)
+	assert.False(t, report.Valid)
+
+	results := map[string]SettingValidation{}
+	for _, s := range report.Settings {
+		results[s.Setting] = s
+	}
+	assert.True(t, results["uri_allow_list.https://*.example.com/"].Valid)
+	assert.False(t, results["uri_allow_list.javascript:*"].Valid)
+	_, ok := results["config"]
+	assert.False(t, ok, "the allow list error is only reported once")
+	assert.Equal(t, "Missing Oauth secret", results["external.github"].Error)
+	assert.False(t, results["sms.provider"].Valid)
+	require.Contains(t, results, "mailer.templates.invite")
+	assert.False(t, results["mailer.templates.invite"].Valid)
+	assert.NotContains(t, results, "smtp")
+
+	config = &conf.Configuration{SiteURL: "https://example.com"}
+	config.URIAllowList = []string{"https://example.com/**"}
+	report = api.validateInstanceConfig(httptest.NewRequest("POST", "/instances/validate", nil), config)
+	assert.True(t, report.Valid, "%+v", report.Settings)
+}
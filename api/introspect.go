@@ -0,0 +1,237 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/models"
+)
+
+// The reasons an introspected token is not active.
+const (
+	introspectionInvalid = "invalid"
+	introspectionExpired = "expired"
+	introspectionRevoked = "revoked"
+	introspectionBanned  = "banned"
+)
+
+// IntrospectionResponse describes a token as in RFC 7662. Reason is only set
+// for tokens that are not active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Reason    string `json:"reason,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	AAL       string `json:"aal,omitempty"`
+}
+
+func inactiveToken(reason string) *IntrospectionResponse {
+	return &IntrospectionResponse{Reason: reason}
+}
+
+// Introspect tells a resource server whether an access or refresh token is
+// active. Unlike validating the JWT, it sees revoked sessions and banned users.
+func (a *API) Introspect(w http.ResponseWriter, r *http.Request) error {
+	if err := a.authenticateIntrospectionClient(r); err != nil {
+		return err
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		return oauthError("invalid_request", "token required")
+	}
+
+	var resp *IntrospectionResponse
+	var err error
+	hint := r.PostFormValue("token_type_hint")
+	if hint == "refresh_token" || (hint != "access_token" && strings.Count(token, ".") != 2) {
+		resp, err = a.introspectRefreshToken(r, token)
+	} else {
+		resp, err = a.introspectAccessToken(r, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, resp)
+}
+
+// authenticateIntrospectionClient authenticates the resource server calling
+// the introspection endpoint, which is a service account or a confidential
+// OAuth client.
+func (a *API) authenticateIntrospectionClient(r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	if config.ServiceAccounts.Enabled {
+		if accountID, err := uuid.FromString(clientID); err == nil {
+			account, err := models.FindServiceAccount(a.getDB(ctx), getInstanceID(ctx), accountID)
+			if err == nil {
+				if !account.Authenticate(secret) {
+					return oauthError("invalid_client", "Client authentication failed")
+				}
+				return nil
+			}
+			if !models.IsNotFoundError(err) {
+				return internalServerError("Database error finding service account").WithInternalError(err)
+			}
+		}
+	}
+
+	if config.OAuthServer.Enabled {
+		client, err := a.authenticateOAuthClient(r)
+		if err != nil {
+			return err
+		}
+		if client.AuthMethod() == models.TokenEndpointAuthNone {
+			return oauthError("invalid_client", "Public clients can not introspect tokens")
+		}
+		return nil
+	}
+
+	return oauthError("invalid_client", "Client authentication failed")
+}
+
+func (a *API) introspectAccessToken(r *http.Request, bearer string) (*IntrospectionResponse, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	unverified := &GoTrueClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(bearer, unverified); err != nil {
+		return inactiveToken(introspectionInvalid), nil
+	}
+
+	claims := &GoTrueClaims{}
+	var err error
+	if config.OAuthServer.Enabled && unverified.Issuer == a.oauthIssuer() {
+		key, _, kerr := oauthSigningKey(config)
+		if kerr != nil {
+			return nil, internalServerError("OAuth server signing key is not configured").WithInternalError(kerr)
+		}
+		p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Name}}
+		_, err = p.ParseWithClaims(bearer, claims, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+	} else {
+		_, err = parseAccessToken(&config.JWT, bearer, claims)
+	}
+	if err != nil {
+		if verr, ok := err.(*jwt.ValidationError); ok && verr.Errors == jwt.ValidationErrorExpired {
+			return inactiveToken(introspectionExpired), nil
+		}
+		return inactiveToken(introspectionInvalid), nil
+	}
+
+	if claims.SessionID != "" {
+		sessionID, err := uuid.FromString(claims.SessionID)
+		if err != nil {
+			return inactiveToken(introspectionInvalid), nil
+		}
+		exists, err := models.SessionExists(a.getDB(ctx), instanceID, sessionID)
+		if err != nil {
+			return nil, internalServerError("Database error finding session").WithInternalError(err)
+		}
+		if !exists {
+			return inactiveToken(introspectionRevoked), nil
+		}
+	}
+
+	// service accounts are not users, their tokens can't be revoked before they expire
+	if claims.GrantType != clientCredentialsGrant {
+		userID, err := uuid.FromString(claims.Subject)
+		if err != nil {
+			return inactiveToken(introspectionInvalid), nil
+		}
+		user, err := models.FindUserByInstanceIDAndID(a.getDB(ctx), instanceID, userID)
+		if err != nil {
+			if models.IsNotFoundError(err) {
+				return inactiveToken(introspectionRevoked), nil
+			}
+			return nil, internalServerError("Database error finding user").WithInternalError(err)
+		}
+		if user.IsBanned() {
+			return inactiveToken(introspectionBanned), nil
+		}
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		TokenType: "access_token",
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Email,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		TokenID:   claims.Id,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+		AAL:       aal1,
+	}, nil
+}
+
+func (a *API) introspectRefreshToken(r *http.Request, token string) (*IntrospectionResponse, error) {
+	instanceID := getInstanceID(r.Context())
+
+	user, refreshToken, err := models.FindUserWithRefreshToken(a.getDB(r.Context()), token)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return inactiveToken(introspectionInvalid), nil
+		}
+		return nil, internalServerError("Database error finding refresh token").WithInternalError(err)
+	}
+	if refreshToken.InstanceID != instanceID {
+		return inactiveToken(introspectionInvalid), nil
+	}
+	if refreshToken.Revoked {
+		return inactiveToken(introspectionRevoked), nil
+	}
+	if refreshToken.SessionID.Valid {
+		exists, err := models.SessionExists(a.getDB(r.Context()), instanceID, refreshToken.SessionID.UUID)
+		if err != nil {
+			return nil, internalServerError("Database error finding session").WithInternalError(err)
+		}
+		if !exists {
+			return inactiveToken(introspectionRevoked), nil
+		}
+	}
+	if user.IsBanned() {
+		return inactiveToken(introspectionBanned), nil
+	}
+
+	resp := &IntrospectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Username:  user.GetEmail(),
+		Subject:   user.ID.String(),
+		Audience:  user.Aud,
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		Role:      user.Role,
+		AAL:       aal1,
+	}
+	if refreshToken.SessionID.Valid {
+		resp.SessionID = refreshToken.SessionID.UUID.String()
+	}
+	return resp, nil
+}
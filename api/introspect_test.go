@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *TokenTestSuite) TestIntrospect() {
+	ts.Config.ServiceAccounts.Enabled = true
+	defer func() {
+		ts.Config.ServiceAccounts.Enabled = false
+	}()
+
+	account, secret, err := models.NewServiceAccount(ts.instanceID, "api", "service_role")
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(account))
+
+	introspect := func(token, clientSecret string) (*httptest.ResponseRecorder, *IntrospectionResponse) {
+		form := url.Values{"token": {token}}
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(account.ID.String(), clientSecret)
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		resp := &IntrospectionResponse{}
+		if w.Code == http.StatusOK {
+			require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(resp))
+		}
+		return w, resp
+	}
+
+	w, _ := introspect(ts.RefreshToken.Token, "wrong")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	_, resp := introspect(ts.RefreshToken.Token, secret)
+	assert.True(ts.T(), resp.Active)
+	assert.Equal(ts.T(), "refresh_token", resp.TokenType)
+	assert.Equal(ts.T(), ts.RefreshToken.UserID.String(), resp.Subject)
+	assert.Equal(ts.T(), "aal1", resp.AAL)
+
+	user, err := models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, ts.RefreshToken.UserID)
+	require.NoError(ts.T(), err)
+	sessionID := ts.RefreshToken.SessionID.UUID.String()
+	accessToken, err := generateBoundAccessToken(user, time.Hour, &ts.Config.JWT, "", "", sessionID)
+	require.NoError(ts.T(), err)
+	expired, err := generateBoundAccessToken(user, -time.Minute, &ts.Config.JWT, "", "", sessionID)
+	require.NoError(ts.T(), err)
+
+	_, resp = introspect(accessToken, secret)
+	assert.True(ts.T(), resp.Active)
+	assert.Equal(ts.T(), "access_token", resp.TokenType)
+	assert.Equal(ts.T(), "test@example.com", resp.Username)
+	assert.Equal(ts.T(), sessionID, resp.SessionID)
+
+	_, resp = introspect(expired, secret)
+	assert.False(ts.T(), resp.Active)
+	assert.Equal(ts.T(), "expired", resp.Reason)
+
+	_, resp = introspect("not-a-token", secret)
+	assert.False(ts.T(), resp.Active)
+	assert.Equal(ts.T(), "invalid", resp.Reason)
+
+	// revoking the session deactivates both tokens before they expire
+	session, err := models.FindSessionByID(ts.API.db, ts.instanceID, user.ID, ts.RefreshToken.SessionID.UUID)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), session.Revoke(ts.API.db, models.SignOutReasonUser))
+	for _, token := range []string{accessToken, ts.RefreshToken.Token} {
+		_, resp = introspect(token, secret)
+		assert.False(ts.T(), resp.Active)
+		assert.Equal(ts.T(), "revoked", resp.Reason)
+	}
+}
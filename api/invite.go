@@ -33,12 +33,13 @@ func (a *API) Invite(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	aud := a.requestAud(ctx, r)
-	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+	user, err := models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, aud)
 	if err != nil && !models.IsNotFoundError(err) {
 		return internalServerError("Database error finding user").WithInternalError(err)
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	isNewUser := user == nil
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if user != nil {
 			if user.IsConfirmed() {
 				return unprocessableEntityError(DuplicateEmailMsg)
@@ -73,6 +74,9 @@ func (a *API) Invite(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	if isNewUser {
+		a.emitLifecycleEvent(ctx, UserCreatedEvent, user)
+	}
 
 	return sendJSON(w, http.StatusOK, user)
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/sirupsen/logrus"
+)
+
+// jobBatchSize is how many records a background job loads at once.
+const jobBatchSize = 100
+
+// backgroundJob is periodic work done for the instance in ctx. Jobs may run
+// concurrently on several servers, so they have to claim the records they
+// work on.
+type backgroundJob struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func (a *API) backgroundJobs() []backgroundJob {
+	return []backgroundJob{
+		{name: "unconfirmed_users", run: a.processUnconfirmedUsers},
+		{name: "retention", run: a.applyRetention},
+		{name: "erasure", run: a.processErasureRequests},
+	}
+}
+
+// runBackgroundJobs runs the background jobs for every instance each
+// JOBS_INTERVAL until done is closed.
+func (a *API) runBackgroundJobs(done <-chan struct{}) {
+	if a.config.Jobs.Disabled || a.config.Jobs.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(a.config.Jobs.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			a.runBackgroundJobsOnce()
+		}
+	}
+}
+
+func (a *API) runBackgroundJobsOnce() {
+	log := logrus.WithField("component", "jobs")
+
+	contexts, err := a.instanceContexts()
+	if err != nil {
+		log.WithError(err).Error("Failed to load instances")
+		return
+	}
+
+	for _, ctx := range contexts {
+		for _, job := range a.backgroundJobs() {
+			jobLog := log.WithFields(logrus.Fields{
+				"job":         job.name,
+				"instance_id": getInstanceID(ctx),
+			})
+			start := time.Now()
+			if err := job.run(ctx); err != nil {
+				jobLog.WithError(err).Error("Background job failed")
+				continue
+			}
+			jobLog.WithField("duration", time.Since(start).String()).Debug("Background job finished")
+		}
+	}
+}
+
+// instanceContexts returns a context with the config of every instance, which
+// is only the base context in single instance mode.
+func (a *API) instanceContexts() ([]context.Context, error) {
+	if !a.config.MultiInstanceMode {
+		return []context.Context{a.baseContext}, nil
+	}
+
+	instances, err := models.FindInstances(a.db)
+	if err != nil {
+		return nil, err
+	}
+	contexts := make([]context.Context, 0, len(instances))
+	for _, instance := range instances {
+		config, err := instance.Config()
+		if err != nil {
+			logrus.WithField("instance_id", instance.ID).WithError(err).Error("Failed to load instance config")
+			continue
+		}
+		ctx, err := WithInstanceConfig(a.baseContext, config, instance.ID)
+		if err != nil {
+			return nil, err
+		}
+		contexts = append(contexts, ctx)
+	}
+	return contexts, nil
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+)
+
+// signingMethodEdDSA signs tokens with Ed25519 keys, which the jwt package
+// doesn't support itself.
+type signingMethodEdDSA struct{}
+
+var (
+	errEdDSAVerification = errors.New("ed25519: verification error")
+	errUnknownJWTKey     = errors.New("unknown JWT key")
+)
+
+func init() {
+	jwt.RegisterSigningMethod(conf.JWTAlgorithmEdDSA, func() jwt.SigningMethod {
+		return signingMethodEdDSA{}
+	})
+	// tokens expire by the same clock they are issued with
+	jwt.TimeFunc = clock.Now
+}
+
+func (signingMethodEdDSA) Alg() string {
+	return conf.JWTAlgorithmEdDSA
+}
+
+func (signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errEdDSAVerification
+	}
+	return nil
+}
+
+func (signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// accessTokenSigningKey returns the method and key access tokens are signed
+// with, along with the id of the key.
+func accessTokenSigningKey(config *conf.JWTConfiguration) (jwt.SigningMethod, interface{}, string, error) {
+	signing, _, _ := config.KeySchedule(time.Now())
+	return jwtKey(&signing)
+}
+
+// jwtKey returns the method and key tokens are signed with with key, along
+// with its id. Asymmetric keys without an id are identified by their public
+// key.
+func jwtKey(key *conf.JWTKeyConfiguration) (jwt.SigningMethod, interface{}, string, error) {
+	if key.Algorithm == "" || key.Algorithm == conf.JWTAlgorithmHS256 {
+		return jwt.SigningMethodHS256, []byte(key.Secret), key.ID, nil
+	}
+	signer, err := key.ParsePrivateKey()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	kid := key.ID
+	if kid == "" {
+		if kid, err = publicKeyID(signer.Public()); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	return jwt.GetSigningMethod(key.Algorithm), signer, kid, nil
+}
+
+// publicKeyID identifies a public key by the hash of its DER encoding.
+func publicKeyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// signWithAccessTokenKey signs claims with the access token key.
+func signWithAccessTokenKey(config *conf.JWTConfiguration, claims jwt.Claims) (string, error) {
+	method, key, kid, err := accessTokenSigningKey(config)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// parseAccessToken verifies an access token with the key its kid header
+// names, among the current key and the keys still in their rotation grace
+// period. Tokens signed with the secret stay valid after switching to an
+// asymmetric algorithm, until the first rotation.
+func parseAccessToken(config *conf.JWTConfiguration, tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	_, verifying, _ := config.KeySchedule(time.Now())
+	methods := []string{jwt.SigningMethodHS256.Name}
+	for _, key := range verifying {
+		if key.Algorithm != "" && key.Algorithm != conf.JWTAlgorithmHS256 {
+			methods = append(methods, key.Algorithm)
+		}
+	}
+	p := jwt.Parser{ValidMethods: methods}
+	return p.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for i := range verifying {
+			key := &verifying[i]
+			if token.Method.Alg() == jwt.SigningMethodHS256.Name {
+				if key.Secret != "" && key.ID == kid {
+					return []byte(key.Secret), nil
+				}
+				continue
+			}
+			if key.Algorithm != token.Method.Alg() {
+				continue
+			}
+			_, signer, keyID, err := jwtKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if keyID == kid {
+				return signer.(crypto.Signer).Public(), nil
+			}
+		}
+		return nil, errUnknownJWTKey
+	})
+}
+
+// okpKey is the JWK of an Ed25519 public key, see RFC 8037.
+type okpKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	KeyUsage  string `json:"use"`
+}
+
+// JWKS publishes the public keys access tokens are verified with, so other
+// services can verify them without the secret, along with the keys that will
+// be active later so they can be cached ahead of the rotation. HS256 keys are
+// never published.
+func (a *API) JWKS(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+	_, verifying, upcoming := config.JWT.KeySchedule(time.Now())
+	keys := []interface{}{}
+
+	for _, configKey := range append(verifying, upcoming...) {
+		if configKey.Algorithm == "" || configKey.Algorithm == conf.JWTAlgorithmHS256 {
+			continue
+		}
+		method, key, kid, err := jwtKey(&configKey)
+		if err != nil {
+			return internalServerError("Error loading JWT signing key").WithInternalError(err)
+		}
+		publicKey := key.(crypto.Signer).Public()
+		if edKey, ok := publicKey.(ed25519.PublicKey); ok {
+			keys = append(keys, &okpKey{
+				KeyType:   "OKP",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(edKey),
+				KeyID:     kid,
+				Algorithm: method.Alg(),
+				KeyUsage:  "sig",
+			})
+			continue
+		}
+		jwkKey, err := jwk.New(publicKey)
+		if err != nil {
+			return internalServerError("Error encoding JWT signing key").WithInternalError(err)
+		}
+		for name, value := range map[string]string{jwk.KeyIDKey: kid, jwk.AlgorithmKey: method.Alg(), jwk.KeyUsageKey: "sig"} {
+			if err := jwkKey.Set(name, value); err != nil {
+				return internalServerError("Error encoding JWT signing key").WithInternalError(err)
+			}
+		}
+		keys = append(keys, jwkKey)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=600")
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
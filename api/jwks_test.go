@@ -0,0 +1,203 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPrivateKey(t testing.TB, algorithm string) string {
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case conf.JWTAlgorithmRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case conf.JWTAlgorithmES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case conf.JWTAlgorithmEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestAsymmetricAccessTokens(t *testing.T) {
+	user := &models.User{Role: "authenticated"}
+
+	for _, algorithm := range []string{conf.JWTAlgorithmRS256, conf.JWTAlgorithmES256, conf.JWTAlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			config := &conf.JWTConfiguration{
+				Secret:     "secret",
+				Algorithm:  algorithm,
+				PrivateKey: testPrivateKey(t, algorithm),
+			}
+
+			token, err := generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+			require.NoError(t, err)
+			parsed, err := parseAccessToken(config, token, &GoTrueClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, algorithm, parsed.Method.Alg())
+			assert.NotEmpty(t, parsed.Header["kid"])
+
+			// tokens signed with the secret before the switch stay valid
+			hmacToken, err := generateAccessToken(user, time.Minute, config.Secret)
+			require.NoError(t, err)
+			_, err = parseAccessToken(config, hmacToken, &GoTrueClaims{})
+			assert.NoError(t, err)
+
+			// tokens signed with another key aren't
+			other := &conf.JWTConfiguration{Secret: "other", Algorithm: algorithm, PrivateKey: testPrivateKey(t, algorithm)}
+			otherToken, err := generateBoundAccessToken(user, time.Minute, other, "", passwordGrant, "")
+			require.NoError(t, err)
+			_, err = parseAccessToken(config, otherToken, &GoTrueClaims{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	api := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{}
+	config.JWT.Secret = "secret"
+
+	jwks := func() []map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		req = req.WithContext(withConfig(req.Context(), config))
+		w := httptest.NewRecorder()
+		require.NoError(t, api.JWKS(w, req))
+		require.Equal(t, http.StatusOK, w.Code)
+		data := struct {
+			Keys []map[string]interface{} `json:"keys"`
+		}{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&data))
+		return data.Keys
+	}
+
+	// the secret is never published
+	assert.Empty(t, jwks())
+
+	config.JWT.Algorithm = conf.JWTAlgorithmES256
+	config.JWT.PrivateKey = testPrivateKey(t, conf.JWTAlgorithmES256)
+	keys := jwks()
+	require.Len(t, keys, 1)
+	assert.Equal(t, "EC", keys[0]["kty"])
+	assert.Equal(t, "ES256", keys[0]["alg"])
+	assert.NotContains(t, keys[0], "d")
+
+	config.JWT.Algorithm = conf.JWTAlgorithmEdDSA
+	config.JWT.PrivateKey = testPrivateKey(t, conf.JWTAlgorithmEdDSA)
+	keys = jwks()
+	require.Len(t, keys, 1)
+	assert.Equal(t, "OKP", keys[0]["kty"])
+	assert.Equal(t, "Ed25519", keys[0]["crv"])
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	user := &models.User{Role: "authenticated"}
+	config := &conf.JWTConfiguration{Secret: "secret", RotationGrace: time.Hour}
+
+	oldToken, err := generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	require.NoError(t, err)
+
+	// the next key is published before it signs anything
+	config.Keys = conf.JWTKeys{{
+		ID:         "next",
+		Algorithm:  conf.JWTAlgorithmES256,
+		PrivateKey: testPrivateKey(t, conf.JWTAlgorithmES256),
+		ActiveFrom: time.Now().Add(time.Hour),
+	}}
+	_, verifying, upcoming := config.KeySchedule(time.Now())
+	assert.Len(t, verifying, 1)
+	assert.Len(t, upcoming, 1)
+	token, err := generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	require.NoError(t, err)
+	parsed, err := parseAccessToken(config, token, &GoTrueClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, conf.JWTAlgorithmHS256, parsed.Method.Alg())
+
+	// once active, tokens are signed with it and the secret still verifies
+	// the outstanding tokens during the grace period
+	config.Keys[0].ActiveFrom = time.Now().Add(-time.Minute)
+	token, err = generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	require.NoError(t, err)
+	parsed, err = parseAccessToken(config, token, &GoTrueClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "next", parsed.Header["kid"])
+	_, err = parseAccessToken(config, oldToken, &GoTrueClaims{})
+	assert.NoError(t, err)
+
+	// a token naming an unknown key isn't accepted
+	config.Keys[0].ID = "other"
+	_, err = parseAccessToken(config, token, &GoTrueClaims{})
+	assert.Error(t, err)
+	config.Keys[0].ID = "next"
+
+	// after the grace period only the current key verifies tokens
+	config.Keys[0].ActiveFrom = time.Now().Add(-2 * time.Hour)
+	_, err = parseAccessToken(config, oldToken, &GoTrueClaims{})
+	assert.Error(t, err)
+	_, err = parseAccessToken(config, token, &GoTrueClaims{})
+	assert.NoError(t, err)
+}
+
+// Baselines are recorded in hack/bench_baseline.txt, see make bench.
+func BenchmarkAccessTokenIssuance(b *testing.B) {
+	user := &models.User{Role: "authenticated", Email: "user@example.com"}
+
+	for _, algorithm := range []string{conf.JWTAlgorithmHS256, conf.JWTAlgorithmRS256, conf.JWTAlgorithmES256, conf.JWTAlgorithmEdDSA} {
+		b.Run(algorithm, func(b *testing.B) {
+			config := &conf.JWTConfiguration{Secret: "secret", Algorithm: algorithm}
+			if algorithm != conf.JWTAlgorithmHS256 {
+				config.PrivateKey = testPrivateKey(b, algorithm)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := generateBoundAccessToken(user, time.Hour, config, "", passwordGrant, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAccessTokenVerification(b *testing.B) {
+	user := &models.User{Role: "authenticated", Email: "user@example.com"}
+
+	for _, algorithm := range []string{conf.JWTAlgorithmHS256, conf.JWTAlgorithmRS256, conf.JWTAlgorithmES256, conf.JWTAlgorithmEdDSA} {
+		b.Run(algorithm, func(b *testing.B) {
+			config := &conf.JWTConfiguration{Secret: "secret", Algorithm: algorithm}
+			if algorithm != conf.JWTAlgorithmHS256 {
+				config.PrivateKey = testPrivateKey(b, algorithm)
+			}
+			token, err := generateBoundAccessToken(user, time.Hour, config, "", passwordGrant, "")
+			require.NoError(b, err)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := parseAccessToken(config, token, &GoTrueClaims{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/metering"
+)
+
+const kerberosProvider = "kerberos"
+
+func (a *API) requireKerberos(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if !a.getConfig(ctx).Kerberos.Enabled {
+		return nil, notFoundError("Kerberos sign-in is disabled")
+	}
+	return ctx, nil
+}
+
+// KerberosSignIn signs in the user of a domain-joined machine with SPNEGO.
+// Clients without a Negotiate authorization are challenged for one. The user
+// is created the first time, with the email the principal maps to.
+func (a *API) KerberosSignIn(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+
+	kt, err := keytab.Load(config.Kerberos.Keytab)
+	if err != nil {
+		return internalServerError("Error loading Kerberos keytab").WithInternalError(err)
+	}
+	settings := []func(*service.Settings){}
+	if config.Kerberos.ServicePrincipal != "" {
+		settings = append(settings, service.KeytabPrincipal(config.Kerberos.ServicePrincipal))
+	}
+
+	// the negotiation answers the challenges and rejections itself, and
+	// only calls through once the principal is authenticated
+	var signInErr error
+	spnego.SPNEGOKRB5Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signInErr = a.kerberosSession(w, r)
+	}), kt, settings...).ServeHTTP(w, r)
+	return signInErr
+}
+
+func (a *API) kerberosSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	id := goidentity.FromHTTPRequestContext(r)
+	if id == nil || !id.Authenticated() {
+		return unauthorizedError("Kerberos authentication failed")
+	}
+	if len(config.Kerberos.Realms) > 0 && !isRealmAllowed(config, id.Domain()) {
+		return forbiddenError("Kerberos realm is not allowed")
+	}
+
+	principal := id.UserName() + "@" + id.Domain()
+	email := kerberosEmail(config, id.UserName(), id.Domain())
+	identityData := map[string]interface{}{
+		"sub":      principal,
+		"email":    email,
+		"username": id.UserName(),
+		"realm":    id.Domain(),
+	}
+	user, token, err := a.signInExternalIdentity(ctx, r, kerberosProvider, principal, email, true, identityData, kerberosGrant)
+	if err != nil {
+		return err
+	}
+
+	if err := a.setCookieTokens(config, token, false, w); err != nil {
+		return internalServerError("Failed to set JWT cookie. %s", err)
+	}
+	metering.RecordLogin(kerberosProvider, user.ID, instanceID)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, kerberosGrant))
+	a.recordSignIn(r, user)
+
+	if redirectTo := getRedirectTo(r); redirectTo != "" && isRedirectURLValid(config, redirectTo) {
+		q := url.Values{}
+		q.Set("access_token", token.Token)
+		q.Set("token_type", token.TokenType)
+		q.Set("expires_in", strconv.Itoa(token.ExpiresIn))
+		q.Set("refresh_token", token.RefreshToken)
+		http.Redirect(w, r, redirectTo+"#"+q.Encode(), http.StatusFound)
+		return nil
+	}
+	return sendToken(w, r, token)
+}
+
+func isRealmAllowed(config *conf.Configuration, realm string) bool {
+	for _, allowed := range config.Kerberos.Realms {
+		if strings.EqualFold(allowed, realm) {
+			return true
+		}
+	}
+	return false
+}
+
+// kerberosEmail maps the principal username@realm to the email of its user
+// with the email template.
+func kerberosEmail(config *conf.Configuration, username, realm string) string {
+	return strings.NewReplacer(
+		"{username}", strings.ToLower(username),
+		"{realm}", strings.ToLower(realm),
+	).Replace(config.Kerberos.EmailTemplate)
+}
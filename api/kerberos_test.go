@@ -0,0 +1,63 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKerberosEmail(t *testing.T) {
+	config := &conf.Configuration{}
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, "jdoe@corp.example.com", kerberosEmail(config, "JDoe", "CORP.EXAMPLE.COM"))
+
+	config.Kerberos.EmailTemplate = "{username}@example.com"
+	assert.Equal(t, "jdoe@example.com", kerberosEmail(config, "jdoe", "CORP.EXAMPLE.COM"))
+
+	config.Kerberos.Realms = []string{"corp.example.com"}
+	assert.True(t, isRealmAllowed(config, "CORP.EXAMPLE.COM"))
+	assert.False(t, isRealmAllowed(config, "PARTNER.EXAMPLE.COM"))
+}
+
+func TestKerberosSignInChallenge(t *testing.T) {
+	kt := keytab.New()
+	require.NoError(t, kt.AddEntry("HTTP/sso.example.com", "CORP.EXAMPLE.COM", "secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96))
+	data, err := kt.Marshal()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "gotrue.keytab")
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+
+	a := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{}
+	config.Kerberos.Enabled = true
+	config.Kerberos.Keytab = path
+	require.NoError(t, config.ApplyDefaults())
+
+	signIn := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sso/kerberos", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		req = req.WithContext(withConfig(req.Context(), config))
+		w := httptest.NewRecorder()
+		require.NoError(t, a.KerberosSignIn(w, req))
+		return w
+	}
+
+	w := signIn("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Negotiate", w.Header().Get("WWW-Authenticate"))
+
+	w = signIn("Negotiate bm90IGEgdG9rZW4=")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEqual(t, "Negotiate", w.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/netlify/gotrue/directory"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const ldapProvider = "ldap"
+
+// authenticateLDAP verifies the password of email with a bind to the
+// directory, and returns the user of the directory entry. The user is
+// created the first time, and the mapped attributes are synced into the
+// user's metadata at every login.
+func (a *API) authenticateLDAP(ctx context.Context, r *http.Request, email, password, aud string) (*models.User, error) {
+	config := a.getConfig(ctx)
+
+	pool, err := directory.Get(&config.LDAP)
+	if err != nil {
+		return nil, internalServerError("Error configuring LDAP").WithInternalError(err)
+	}
+	entry, err := pool.Authenticate(email, password)
+	if err != nil {
+		if err == directory.ErrInvalidCredentials {
+			return nil, err
+		}
+		return nil, internalServerError("Error verifying LDAP credentials").WithInternalError(err)
+	}
+
+	var user *models.User
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		identity, terr := models.FindIdentityByIdAndProvider(tx, entry.ID, ldapProvider)
+		if terr == nil {
+			user, terr = models.FindUserByID(tx, identity.UserID)
+			if terr != nil {
+				return terr
+			}
+		} else if models.IsNotFoundError(terr) {
+			if user, terr = a.findOrProvisionLDAPUser(ctx, tx, r, entry, aud); terr != nil {
+				return terr
+			}
+			if _, terr = a.createNewIdentity(tx, user, ldapProvider, map[string]interface{}{
+				"sub":   entry.ID,
+				"email": entry.Email,
+				"dn":    entry.DN,
+			}); terr != nil {
+				return terr
+			}
+			if terr = user.UpdateAppMetaDataProviders(tx); terr != nil {
+				return terr
+			}
+		} else {
+			return terr
+		}
+
+		if len(entry.Metadata) > 0 {
+			if terr = user.UpdateUserMetaData(tx, entry.Metadata); terr != nil {
+				return internalServerError("Database error updating user").WithInternalError(terr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// findOrProvisionLDAPUser links the directory entry to the user with its
+// email, or signs up a confirmed user for it.
+func (a *API) findOrProvisionLDAPUser(ctx context.Context, tx *storage.Connection, r *http.Request, entry *directory.Entry, aud string) (*models.User, error) {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	user, err := models.FindUserByEmailAndAudience(tx, instanceID, entry.Email, aud)
+	if err == nil {
+		return user, nil
+	}
+	if !models.IsNotFoundError(err) {
+		return nil, internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	if config.DisableSignup {
+		return nil, forbiddenError("Signups not allowed for this instance")
+	}
+	user, err = a.signupNewUser(ctx, tx, &SignupParams{
+		Provider: ldapProvider,
+		Email:    entry.Email,
+		Aud:      aud,
+		Data:     entry.Metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserSignedUpAction, "", map[string]interface{}{
+		"provider": ldapProvider,
+	}); err != nil {
+		return nil, err
+	}
+	if err := triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); err != nil {
+		return nil, err
+	}
+	if err := user.Confirm(tx); err != nil {
+		return nil, internalServerError("Error updating user").WithInternalError(err)
+	}
+	return user, nil
+}
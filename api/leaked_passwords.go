@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/security"
+)
+
+// leakedPasswordError is returned for passwords that appeared in a data breach.
+func leakedPasswordError() *HTTPError {
+	return unprocessableEntityError("Password has appeared in a data breach and can not be used, please choose another one").WithDetails(map[string]interface{}{
+		"reason": "leaked_password",
+	})
+}
+
+// checkLeakedPassword starts checking the password against the leaked passwords
+// API in the background, so the request can be validated meanwhile, and returns
+// a function waiting for the result. The check fails open: if the API can't be
+// reached, the password is accepted.
+func (a *API) checkLeakedPassword(r *http.Request, config *conf.Configuration, password string) func() error {
+	if !config.Security.LeakedPasswords.Enabled || password == "" {
+		return func() error { return nil }
+	}
+
+	log := logger.GetLogEntry(r)
+	result := make(chan error, 1)
+	go func() {
+		client := SafeHTTPClient(&http.Client{Timeout: config.Security.LeakedPasswords.Timeout}, log)
+		pwned, err := security.IsPasswordPwned(r.Context(), client, config.Security.LeakedPasswords.URL, password)
+		if err != nil {
+			log.WithError(err).Warn("Checking for a leaked password failed, accepting the password")
+			result <- nil
+			return
+		}
+		if pwned {
+			result <- leakedPasswordError()
+			return
+		}
+		result <- nil
+	}()
+
+	return func() error { return <-result }
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLeakedPasswordFailsOpen(t *testing.T) {
+	api := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{}
+	req := httptest.NewRequest(http.MethodPost, "/signup", nil)
+
+	config.Security.LeakedPasswords.URL = "http://127.0.0.1:1"
+	config.Security.LeakedPasswords.Timeout = time.Second
+	assert.NoError(t, api.checkLeakedPassword(req, config, "password")())
+
+	// passwords are accepted when the API can't be reached
+	config.Security.LeakedPasswords.Enabled = true
+	assert.NoError(t, api.checkLeakedPassword(req, config, "password")())
+
+	err := leakedPasswordError()
+	assert.Equal(t, http.StatusUnprocessableEntity, err.Code)
+	assert.Equal(t, "leaked_password", err.Details["reason"])
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/sirupsen/logrus"
+)
+
+// User lifecycle events sent to the lifecycle events sink.
+const (
+	UserCreatedEvent      = "user.created"
+	UserUpdatedEvent      = "user.updated"
+	UserDeletedEvent      = "user.deleted"
+	UserConfirmedEvent    = "user.confirmed"
+	UserLoginEvent        = "login"
+	UserLogoutEvent       = "logout"
+	PasswordRecoveryEvent = "password.recovery"
+)
+
+// maxLifecycleEventDeliveries is how many lifecycle events are delivered at
+// once, including the ones waiting to be retried. Further events are recorded
+// as failed right away rather than queued.
+const maxLifecycleEventDeliveries = 1000
+
+// LifecycleEvent is sent to the lifecycle events sink. Its ID stays the same
+// across retries, so receivers can drop the events they already handled.
+type LifecycleEvent struct {
+	ID         uuid.UUID    `json:"id"`
+	Event      string       `json:"event"`
+	InstanceID uuid.UUID    `json:"instance_id,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	User       *models.User `json:"user"`
+}
+
+// emitLifecycleEvent sends event about user to the lifecycle events sink, if
+// one is configured and subscribed to it. The event is delivered in the
+// background, so it must only be emitted once the change was committed.
+func (a *API) emitLifecycleEvent(ctx context.Context, event string, user *models.User) {
+	config := a.getConfig(ctx)
+	eventsConfig := config.LifecycleEvents
+	if eventsConfig.WebhookURL == "" || !eventsConfig.HasEvent(event) {
+		return
+	}
+
+	eventLog := logrus.WithFields(logrus.Fields{
+		"component":   "lifecycle_events",
+		"request_id":  getRequestID(ctx),
+		"instance_id": getInstanceID(ctx),
+		"event":       event,
+	})
+	id, err := uuid.NewV4()
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to generate lifecycle event id")
+		return
+	}
+	lifecycleEvent := &LifecycleEvent{
+		ID:         id,
+		Event:      event,
+		InstanceID: getInstanceID(ctx),
+		RequestID:  getRequestID(ctx),
+		OccurredAt: time.Now(),
+		User:       user,
+	}
+	// the user is serialized now as the caller may keep changing it
+	data, err := json.Marshal(lifecycleEvent)
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to serialize lifecycle event")
+		return
+	}
+
+	select {
+	case a.lifecycleEventDeliveries <- struct{}{}:
+		go func() {
+			defer func() { <-a.lifecycleEventDeliveries }()
+			a.deliverLifecycleEvent(config, lifecycleEvent, data)
+		}()
+	default:
+		a.recordLifecycleEventFailure(lifecycleEvent, data, 0, "too many lifecycle event deliveries in flight")
+	}
+}
+
+// emitVerificationEvent emits the lifecycle event of user verifying a code or
+// link of verificationType.
+func (a *API) emitVerificationEvent(ctx context.Context, verificationType string, user *models.User) {
+	switch verificationType {
+	case signupVerification, inviteVerification, smsVerification:
+		a.emitLifecycleEvent(ctx, UserConfirmedEvent, user)
+	case emailChangeVerification, phoneChangeVerification, recoveryOtpVerification:
+		a.emitLifecycleEvent(ctx, UserUpdatedEvent, user)
+	}
+}
+
+// deliverLifecycleEvent sends the event until the sink accepts it, waiting
+// longer after each failed attempt. The event is recorded in the audit log if
+// every attempt failed.
+func (a *API) deliverLifecycleEvent(config *conf.Configuration, event *LifecycleEvent, data []byte) {
+	eventsConfig := config.LifecycleEvents
+	eventLog := logrus.WithFields(logrus.Fields{
+		"component":   "lifecycle_events",
+		"request_id":  event.RequestID,
+		"instance_id": event.InstanceID,
+		"event":       event.Event,
+		"event_id":    event.ID,
+	})
+	sha, err := checksum(data)
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to checksum lifecycle event")
+		return
+	}
+
+	attempt := 1
+	for {
+		w := Webhook{
+			WebhookConfig: &conf.WebhookConfig{URL: eventsConfig.WebhookURL, Retries: 1},
+			jwtSecret:     eventsConfig.WebhookSecret,
+			instanceID:    event.InstanceID,
+			claims: webhookClaims{
+				StandardClaims: jwt.StandardClaims{
+					IssuedAt: time.Now().Unix(),
+					Subject:  event.InstanceID.String(),
+					Issuer:   gotrueIssuer,
+				},
+				SHA256: sha,
+			},
+			payload: data,
+			headers: requestIDHeaders(event.RequestID),
+		}
+		body, err := w.trigger()
+		if body != nil {
+			body.Close()
+		}
+		if err == nil {
+			return
+		}
+		eventLog.WithError(err).WithField("attempt", attempt).Warn("Failed to send lifecycle event")
+		if attempt >= eventsConfig.MaxAttempts {
+			a.recordLifecycleEventFailure(event, data, attempt, err.Error())
+			return
+		}
+
+		select {
+		case <-time.After(lifecycleEventBackoff(&eventsConfig, attempt)):
+		case <-a.baseContext.Done():
+			a.recordLifecycleEventFailure(event, data, attempt, "shutting down before the event could be sent")
+			return
+		}
+		attempt++
+	}
+}
+
+// lifecycleEventBackoff is how long to wait after the attempt failed.
+func lifecycleEventBackoff(config *conf.LifecycleEventsConfiguration, attempt int) time.Duration {
+	backoff := config.Backoff
+	for i := 1; i < attempt && backoff < config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > config.MaxBackoff {
+		backoff = config.MaxBackoff
+	}
+	return backoff
+}
+
+// recordLifecycleEventFailure records an event that couldn't be sent in the
+// audit log along with its payload, so it can be looked into and replayed.
+func (a *API) recordLifecycleEventFailure(event *LifecycleEvent, data []byte, attempts int, reason string) {
+	eventLog := logrus.WithFields(logrus.Fields{
+		"component":   "lifecycle_events",
+		"request_id":  event.RequestID,
+		"instance_id": event.InstanceID,
+		"event":       event.Event,
+		"event_id":    event.ID,
+		"attempts":    attempts,
+	})
+	eventLog.Errorf("Giving up sending lifecycle event: %s", reason)
+
+	// the user may have been deleted since, and the payload holds it anyway
+	err := models.NewAuditLogEntry(nil, a.db, event.InstanceID, &models.User{ID: event.User.ID}, models.LifecycleEventFailedAction, "", map[string]interface{}{
+		"event":    event.Event,
+		"event_id": event.ID,
+		"attempts": attempts,
+		"error":    reason,
+		"payload":  json.RawMessage(data),
+	})
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to record failed lifecycle event")
+	}
+}
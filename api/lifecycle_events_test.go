@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestLifecycleEventBackoff(t *testing.T) {
+	config := &conf.LifecycleEventsConfiguration{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, lifecycleEventBackoff(config, 1))
+	assert.Equal(t, 2*time.Second, lifecycleEventBackoff(config, 2))
+	assert.Equal(t, 4*time.Second, lifecycleEventBackoff(config, 3))
+	assert.Equal(t, 5*time.Second, lifecycleEventBackoff(config, 4))
+	assert.Equal(t, 5*time.Second, lifecycleEventBackoff(config, 100))
+}
+
+type LifecycleEventsTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &LifecycleEventsTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *LifecycleEventsTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	ts.Config.LifecycleEvents = conf.LifecycleEventsConfiguration{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}
+}
+
+func (ts *LifecycleEventsTestSuite) emit(event string) *models.User {
+	u, err := models.NewUser(ts.instanceID, "", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+	ts.API.emitLifecycleEvent(ctx, event, u)
+	return u
+}
+
+func (ts *LifecycleEventsTestSuite) TestRetriesUntilDelivered() {
+	var attempts int32
+	received := make(chan LifecycleEvent, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event LifecycleEvent
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&event))
+		assert.NotEmpty(ts.T(), r.Header.Get(headerHookSignature))
+		received <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+	ts.Config.LifecycleEvents.WebhookURL = svr.URL
+	ts.Config.LifecycleEvents.WebhookSecret = "secret"
+
+	u := ts.emit(UserCreatedEvent)
+
+	select {
+	case event := <-received:
+		assert.Equal(ts.T(), UserCreatedEvent, event.Event)
+		assert.Equal(ts.T(), u.ID, event.User.ID)
+		assert.NotEqual(ts.T(), uuid.Nil, event.ID)
+	case <-time.After(5 * time.Second):
+		ts.T().Fatal("lifecycle event wasn't delivered")
+	}
+	assert.Equal(ts.T(), int32(3), atomic.LoadInt32(&attempts))
+}
+
+func (ts *LifecycleEventsTestSuite) TestRecordsFailedEvents() {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer svr.Close()
+	ts.Config.LifecycleEvents.WebhookURL = svr.URL
+
+	u := ts.emit(UserLogoutEvent)
+
+	var entries []*models.AuditLogEntry
+	require.Eventually(ts.T(), func() bool {
+		var err error
+		entries, err = models.FindAuditLogEntries(ts.API.db, ts.instanceID, []string{"action"}, string(models.LifecycleEventFailedAction), nil)
+		require.NoError(ts.T(), err)
+		return len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	traits := entries[0].Payload["traits"].(map[string]interface{})
+	assert.Equal(ts.T(), UserLogoutEvent, traits["event"])
+	assert.EqualValues(ts.T(), 3, traits["attempts"])
+	assert.Equal(ts.T(), u.ID.String(), entries[0].Payload["actor_id"])
+}
+
+func (ts *LifecycleEventsTestSuite) TestFiltersEvents() {
+	var attempts int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+	ts.Config.LifecycleEvents.WebhookURL = svr.URL
+	ts.Config.LifecycleEvents.Events = []string{UserDeletedEvent}
+
+	ts.emit(UserCreatedEvent)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(ts.T(), int32(0), atomic.LoadInt32(&attempts))
+}
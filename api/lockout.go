@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/mailer"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
+	"github.com/sirupsen/logrus"
+)
+
+const accountLockedMail = `<h2>Your account was locked</h2>
+
+<p>Someone failed to sign in to your account on {{ .SiteURL }} {{ .Attempts }} times, so it is locked until {{ .LockedUntil }}. If this wasn't you, consider changing your password.</p>`
+
+// accountLockedError is returned for sign-ins of locked accounts, and from IP
+// addresses with too many failed sign-ins.
+func accountLockedError(reason string) *HTTPError {
+	return tooManyRequestsError("Too many failed sign-in attempts, please try again later").WithDetails(map[string]interface{}{
+		"reason": reason,
+	})
+}
+
+// checkLockout refuses password sign-ins from IP addresses that failed
+// SECURITY_LOCKOUT_IP_MAX_ATTEMPTS times within the window, and of users
+// whose account is locked. user is nil until it's known.
+func (a *API) checkLockout(r *http.Request, config *conf.Configuration, user *models.User) error {
+	lockout := config.Security.Lockout
+	if !lockout.Enabled {
+		return nil
+	}
+
+	if user == nil {
+		since := clock.Now().Add(-lockout.Window)
+		failures, err := models.CountFailedLoginsFromIPSince(a.getDB(r.Context()), getInstanceID(r.Context()), utilities.GetIPAddress(r), since)
+		if err != nil {
+			return internalServerError("Database error counting failed sign-ins").WithInternalError(err)
+		}
+		if failures >= lockout.IPMaxAttempts {
+			return accountLockedError("ip_locked")
+		}
+		return nil
+	}
+
+	if user.IsLocked() {
+		return accountLockedError("account_locked")
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed password sign-in of user, which is nil
+// for unknown users, and locks the account once it failed
+// SECURITY_LOCKOUT_MAX_ATTEMPTS times within the window. The sign-in fails
+// anyway, so errors are only logged.
+func (a *API) recordFailedLogin(ctx context.Context, r *http.Request, config *conf.Configuration, user *models.User) {
+	lockout := config.Security.Lockout
+	if !lockout.Enabled {
+		return
+	}
+
+	instanceID := getInstanceID(ctx)
+	ipAddress := utilities.GetIPAddress(r)
+	log := logrus.WithFields(logrus.Fields{
+		"component":   "lockout",
+		"request_id":  getRequestID(ctx),
+		"instance_id": instanceID,
+	})
+
+	login, err := models.NewFailedLogin(instanceID, user, ipAddress)
+	if err == nil {
+		err = a.getDB(ctx).Create(login)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to record failed sign-in")
+		return
+	}
+	if user == nil || user.IsLocked() {
+		return
+	}
+
+	// failures before the last sign-in or the end of the last lock don't count
+	log = log.WithField("user_id", user.ID)
+	since := clock.Now().Add(-lockout.Window)
+	for _, t := range []*time.Time{user.LastSignInAt, user.LockedUntil} {
+		if t != nil && t.After(since) {
+			since = *t
+		}
+	}
+	failures, err := models.CountFailedLoginsSince(a.getDB(ctx), user, since)
+	if err != nil {
+		log.WithError(err).Error("Failed to count failed sign-ins")
+		return
+	}
+	if failures < lockout.MaxAttempts {
+		return
+	}
+
+	lockedUntil := clock.Now().Add(lockout.Duration)
+	user.LockedUntil = &lockedUntil
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := user.UpdateLockedUntil(tx); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, models.NewSystemUser(instanceID, user.Aud), models.UserLockedAction, ipAddress, map[string]interface{}{
+			"user_id":      user.ID,
+			"attempts":     failures,
+			"locked_until": lockedUntil,
+		})
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to lock user")
+		return
+	}
+	log.Info("Locked user after failed sign-ins")
+
+	if lockout.NotifyEmail && user.GetEmail() != "" {
+		// notifying must not hold up the failed sign-in
+		go func() {
+			if err := mailer.NewMailerWithLogger(config, log).Send(user, "Your account was locked", accountLockedMail, map[string]interface{}{
+				"SiteURL":     config.SiteURL,
+				"Attempts":    failures,
+				"LockedUntil": lockedUntil.UTC().Format(time.RFC1123),
+			}); err != nil {
+				log.WithError(err).Error("Failed to send account locked email")
+			}
+		}()
+	}
+}
@@ -15,20 +15,21 @@ func (a *API) Logout(w http.ResponseWriter, r *http.Request) error {
 
 	a.clearCookieTokens(config, w)
 
-	u, err := getUserFromClaims(ctx, a.db)
+	u, err := getUserFromClaims(ctx, a.getDB(ctx))
 	if err != nil {
 		return unauthorizedError("Invalid user").WithInternalError(err)
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if terr := models.NewAuditLogEntry(r, tx, instanceID, u, models.LogoutAction, "", nil); terr != nil {
 			return terr
 		}
-		return models.Logout(tx, instanceID, u.ID)
+		return models.Logout(tx, instanceID, u.ID, models.SignOutReasonUser)
 	})
 	if err != nil {
 		return internalServerError("Error logging out user").WithInternalError(err)
 	}
+	a.emitLifecycleEvent(ctx, UserLogoutEvent, u)
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
 	"github.com/sethvargo/go-password/password"
@@ -15,6 +16,7 @@ import (
 
 // MagicLinkParams holds the parameters for a magic link request
 type MagicLinkParams struct {
+	PKCEParams
 	Email    string                 `json:"email"`
 	Metadata map[string]interface{} `json:"metadata"`
 }
@@ -39,7 +41,15 @@ func (a *API) MagicLink(w http.ResponseWriter, r *http.Request) error {
 	if params.Metadata == nil {
 		params.Metadata = make(map[string]interface{})
 	}
+	isPKCE, err := params.isPKCE(config)
+	if err != nil {
+		return err
+	}
 
+	aud := a.requestAud(ctx, r)
+	if config.Sms.IsWhatsappAudience(aud) {
+		return phoneOnlyError(aud)
+	}
 	if params.Email == "" {
 		return unprocessableEntityError("Password recovery requires an email")
 	}
@@ -47,8 +57,7 @@ func (a *API) MagicLink(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	aud := a.requestAud(ctx, r)
-	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+	user, err := models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, aud)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			// User doesn't exist, sign them up with temporary password
@@ -75,9 +84,10 @@ func (a *API) MagicLink(w http.ResponseWriter, r *http.Request) error {
 				if err := a.Signup(fakeResponse, r); err != nil {
 					return err
 				}
-				newBodyContent := &SignupParams{
-					Email: params.Email,
-					Data:  params.Metadata,
+				newBodyContent := &MagicLinkParams{
+					PKCEParams: params.PKCEParams,
+					Email:      params.Email,
+					Metadata:   params.Metadata,
 				}
 				metadata, err := json.Marshal(newBodyContent)
 				if err != nil {
@@ -90,27 +100,42 @@ func (a *API) MagicLink(w http.ResponseWriter, r *http.Request) error {
 			if err := a.Signup(fakeResponse, r); err != nil {
 				return err
 			}
+			if isPKCE {
+				user, err := models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, aud)
+				if err != nil {
+					return internalServerError("Database error finding user").WithInternalError(err)
+				}
+				if err := a.createMagicLinkFlowState(ctx, a.getDB(ctx), user, &params.PKCEParams, config.Mailer.OtpExp); err != nil {
+					return err
+				}
+			}
 
 			return sendJSON(w, http.StatusOK, make(map[string]string))
 		}
 		return internalServerError("Database error finding user").WithInternalError(err)
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserRecoveryRequestedAction, "", nil); terr != nil {
 			return terr
 		}
+		if isPKCE {
+			if terr := a.createMagicLinkFlowState(ctx, tx, user, &params.PKCEParams, config.Mailer.MagicLinkExp); terr != nil {
+				return terr
+			}
+		}
 
 		mailer := a.Mailer(ctx)
-		referrer := a.getReferrer(r)
-		return a.sendMagicLink(tx, user, mailer, config.SMTP.MaxFrequency, referrer, config.Mailer.OtpLength)
+		referrer := withRedirectParams(config, r, a.getReferrer(r))
+		return a.sendMagicLink(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.MagicLinkEmail), referrer, config.Mailer.OtpLength)
 	})
 	if err != nil {
 		if errors.Is(err, MaxFrequencyLimitError) {
-			return tooManyRequestsError("For security purposes, you can only request this once every 60 seconds")
+			return frequencyLimitedError(w, err)
 		}
 		return internalServerError("Error sending magic link").WithInternalError(err)
 	}
+	a.recordAuthEvent(ctx, user.Aud, otpSentAuthEvent)
 
 	return sendJSON(w, http.StatusOK, make(map[string]string))
 }
@@ -5,9 +5,12 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/netlify/gotrue/clock"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/crypto"
 	"github.com/netlify/gotrue/mailer"
@@ -22,6 +25,49 @@ var (
 	configFile                   = ""
 )
 
+// frequencyLimitError is a MaxFrequencyLimitError telling how long until the
+// next message can be sent.
+type frequencyLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *frequencyLimitError) Error() string {
+	return MaxFrequencyLimitError.Error()
+}
+
+func (e *frequencyLimitError) Is(target error) bool {
+	return target == MaxFrequencyLimitError
+}
+
+// checkFrequency returns a frequencyLimitError if the last message was sent
+// at sentAt, less than maxFrequency ago.
+func checkFrequency(sentAt *time.Time, maxFrequency time.Duration) error {
+	if sentAt == nil {
+		return nil
+	}
+	now := clock.Now()
+	next := sentAt.Add(maxFrequency)
+	if next.Before(now) {
+		return nil
+	}
+	return &frequencyLimitError{retryAfter: next.Sub(now)}
+}
+
+// frequencyLimitedError responds to err, a MaxFrequencyLimitError, with the
+// seconds until the message can be requested again in the Retry-After header
+// and the retry_after detail.
+func frequencyLimitedError(w http.ResponseWriter, err error) *HTTPError {
+	seconds := 0
+	var ferr *frequencyLimitError
+	if errors.As(err, &ferr) {
+		seconds = int(math.Ceil(ferr.retryAfter.Seconds()))
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return tooManyRequestsError("For security purposes, you can only request this after %d seconds", seconds).WithDetails(map[string]interface{}{
+		"retry_after": seconds,
+	})
+}
+
 type GenerateLinkParams struct {
 	Type       string                 `json:"type"`
 	Email      string                 `json:"email"`
@@ -50,7 +96,7 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	aud := a.requestAud(ctx, r)
-	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+	user, err := models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, aud)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			if params.Type == magicLinkVerification {
@@ -69,13 +115,13 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 
 	var url string
 	referrer := a.getRedirectURLOrReferrer(r, params.RedirectTo)
-	now := time.Now()
+	now := clock.Now()
 	otp, err := crypto.GenerateOtp(config.Mailer.OtpLength)
 	if err != nil {
 		return err
 	}
 	hashedToken := fmt.Sprintf("%x", sha256.Sum224([]byte(params.Email+otp)))
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		switch params.Type {
 		case magicLinkVerification, recoveryVerification:
@@ -154,7 +200,7 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 			} else if exists {
 				return unprocessableEntityError(DuplicateEmailMsg)
 			}
-			now := time.Now()
+			now := clock.Now()
 			user.EmailChangeSentAt = &now
 			user.EmailChange = params.NewEmail
 			user.EmailChangeConfirmStatus = zeroConfirmation
@@ -197,13 +243,21 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 	resp["verification_type"] = params.Type
 	resp["redirect_to"] = referrer
 
+	// the link and otp expire like the ones sent by email
+	exp := config.Mailer.OtpExp
+	if params.Type == magicLinkVerification {
+		exp = config.Mailer.MagicLinkExp
+	}
+	resp["expires_in"] = exp
+	resp["expires_at"] = now.Add(time.Second * time.Duration(exp)).UTC().Format(time.RFC3339)
+
 	return sendJSON(w, http.StatusOK, resp)
 }
 
 func sendConfirmation(tx *storage.Connection, u *models.User, mailer mailer.Mailer, maxFrequency time.Duration, referrerURL string, otpLength int) error {
 	var err error
-	if u.ConfirmationSentAt != nil && !u.ConfirmationSentAt.Add(maxFrequency).Before(time.Now()) {
-		return MaxFrequencyLimitError
+	if err := checkFrequency(u.ConfirmationSentAt, maxFrequency); err != nil {
+		return err
 	}
 	oldToken := u.ConfirmationToken
 	otp, err := crypto.GenerateOtp(otpLength)
@@ -211,7 +265,7 @@ func sendConfirmation(tx *storage.Connection, u *models.User, mailer mailer.Mail
 		return err
 	}
 	u.ConfirmationToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+otp)))
-	now := time.Now()
+	now := clock.Now()
 	if err := mailer.ConfirmationMail(u, otp, referrerURL); err != nil {
 		u.ConfirmationToken = oldToken
 		return errors.Wrap(err, "Error sending confirmation email")
@@ -228,7 +282,7 @@ func sendInvite(tx *storage.Connection, u *models.User, mailer mailer.Mailer, re
 		return err
 	}
 	u.ConfirmationToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+otp)))
-	now := time.Now()
+	now := clock.Now()
 	if err := mailer.InviteMail(u, otp, referrerURL); err != nil {
 		u.ConfirmationToken = oldToken
 		return errors.Wrap(err, "Error sending invite email")
@@ -240,8 +294,8 @@ func sendInvite(tx *storage.Connection, u *models.User, mailer mailer.Mailer, re
 
 func (a *API) sendPasswordRecovery(tx *storage.Connection, u *models.User, mailer mailer.Mailer, maxFrequency time.Duration, referrerURL string, otpLength int) error {
 	var err error
-	if u.RecoverySentAt != nil && !u.RecoverySentAt.Add(maxFrequency).Before(time.Now()) {
-		return MaxFrequencyLimitError
+	if err := checkFrequency(u.RecoverySentAt, maxFrequency); err != nil {
+		return err
 	}
 
 	oldToken := u.RecoveryToken
@@ -250,7 +304,7 @@ func (a *API) sendPasswordRecovery(tx *storage.Connection, u *models.User, maile
 		return err
 	}
 	u.RecoveryToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+otp)))
-	now := time.Now()
+	now := clock.Now()
 	if err := mailer.RecoveryMail(u, otp, referrerURL); err != nil {
 		u.RecoveryToken = oldToken
 		return errors.Wrap(err, "Error sending recovery email")
@@ -259,10 +313,32 @@ func (a *API) sendPasswordRecovery(tx *storage.Connection, u *models.User, maile
 	return errors.Wrap(tx.UpdateOnly(u, "recovery_token", "recovery_sent_at"), "Database error updating user for recovery")
 }
 
+// sendPasswordRecoveryCode sends a recovery code without a link, verified
+// with the new password by POST /verify with the recovery_otp type.
+func (a *API) sendPasswordRecoveryCode(tx *storage.Connection, u *models.User, mailer mailer.Mailer, maxFrequency time.Duration, otpLength int) error {
+	if err := checkFrequency(u.RecoverySentAt, maxFrequency); err != nil {
+		return err
+	}
+
+	oldToken := u.RecoveryToken
+	otp, err := crypto.GenerateOtp(otpLength)
+	if err != nil {
+		return err
+	}
+	u.RecoveryToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+otp)))
+	now := clock.Now()
+	if err := mailer.RecoveryCodeMail(u, otp); err != nil {
+		u.RecoveryToken = oldToken
+		return errors.Wrap(err, "Error sending recovery email")
+	}
+	u.RecoverySentAt = &now
+	return errors.Wrap(tx.UpdateOnly(u, "recovery_token", "recovery_sent_at"), "Database error updating user for recovery")
+}
+
 func (a *API) sendReauthenticationOtp(tx *storage.Connection, u *models.User, mailer mailer.Mailer, maxFrequency time.Duration, otpLength int) error {
 	var err error
-	if u.ReauthenticationSentAt != nil && !u.ReauthenticationSentAt.Add(maxFrequency).Before(time.Now()) {
-		return MaxFrequencyLimitError
+	if err := checkFrequency(u.ReauthenticationSentAt, maxFrequency); err != nil {
+		return err
 	}
 
 	oldToken := u.ReauthenticationToken
@@ -274,7 +350,7 @@ func (a *API) sendReauthenticationOtp(tx *storage.Connection, u *models.User, ma
 	if err != nil {
 		return err
 	}
-	now := time.Now()
+	now := clock.Now()
 	if err := mailer.ReauthenticateMail(u, otp); err != nil {
 		u.ReauthenticationToken = oldToken
 		return errors.Wrap(err, "Error sending reauthentication email")
@@ -287,8 +363,8 @@ func (a *API) sendMagicLink(tx *storage.Connection, u *models.User, mailer maile
 	var err error
 	// since Magic Link is just a recovery with a different template and behaviour
 	// around new users we will reuse the recovery db timer to prevent potential abuse
-	if u.RecoverySentAt != nil && !u.RecoverySentAt.Add(maxFrequency).Before(time.Now()) {
-		return MaxFrequencyLimitError
+	if err := checkFrequency(u.RecoverySentAt, maxFrequency); err != nil {
+		return err
 	}
 	oldToken := u.RecoveryToken
 	otp, err := crypto.GenerateOtp(otpLength)
@@ -296,7 +372,7 @@ func (a *API) sendMagicLink(tx *storage.Connection, u *models.User, mailer maile
 		return err
 	}
 	u.RecoveryToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+otp)))
-	now := time.Now()
+	now := clock.Now()
 	if err := mailer.MagicLinkMail(u, otp, referrerURL); err != nil {
 		u.RecoveryToken = oldToken
 		return errors.Wrap(err, "Error sending magic link email")
@@ -327,7 +403,7 @@ func (a *API) sendEmailChange(tx *storage.Connection, config *conf.Configuration
 	}
 	u.EmailChange = email
 	u.EmailChangeConfirmStatus = zeroConfirmation
-	now := time.Now()
+	now := clock.Now()
 	if err := mailer.EmailChangeMail(u, otpNew, otpCurrent, referrerURL); err != nil {
 		return err
 	}
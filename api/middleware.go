@@ -10,12 +10,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/security"
 	"github.com/sirupsen/logrus"
 
-	"github.com/didip/tollbooth/v5"
-	"github.com/didip/tollbooth/v5/limiter"
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt"
 	"github.com/netlify/gotrue/models"
@@ -114,7 +113,7 @@ func (a *API) loadInstanceConfig(w http.ResponseWriter, r *http.Request) (contex
 
 	logger.LogEntrySetField(r, "instance_id", instanceID)
 	logger.LogEntrySetField(r, "netlify_id", claims.NetlifyID)
-	instance, err := models.GetInstance(a.db, instanceID)
+	instance, err := models.GetInstance(a.getDB(ctx), instanceID)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			return nil, notFoundError("Unable to locate site configuration")
@@ -143,14 +142,13 @@ func (a *API) loadInstanceConfig(w http.ResponseWriter, r *http.Request) (contex
 	return ctx, nil
 }
 
-func (a *API) limitHandler(lmt *limiter.Limiter) middlewareHandler {
+func (a *API) limitHandler(lmt *rateLimiter) middlewareHandler {
 	return func(w http.ResponseWriter, req *http.Request) (context.Context, error) {
 		c := req.Context()
 		if limitHeader := a.config.RateLimitHeader; limitHeader != "" {
 			key := req.Header.Get(a.config.RateLimitHeader)
-			err := tollbooth.LimitByKeys(lmt, []string{key})
-			if err != nil {
-				return c, httpError(http.StatusTooManyRequests, "Rate limit exceeded")
+			if err := a.rateLimit(lmt, w, req, key); err != nil {
+				return c, err
 			}
 		}
 		return c, nil
@@ -160,9 +158,7 @@ func (a *API) limitHandler(lmt *limiter.Limiter) middlewareHandler {
 func (a *API) limitEmailSentHandler() middlewareHandler {
 	// limit per hour
 	freq := a.config.RateLimitEmailSent / (60 * 60)
-	lmt := tollbooth.NewLimiter(freq, &limiter.ExpirableOptions{
-		DefaultExpirationTTL: time.Hour,
-	}).SetBurst(int(a.config.RateLimitEmailSent)).SetMethods([]string{"PUT", "POST"})
+	lmt := newRateLimiter(freq, int(a.config.RateLimitEmailSent), time.Hour)
 	return func(w http.ResponseWriter, req *http.Request) (context.Context, error) {
 		c := req.Context()
 		config := a.getConfig(c)
@@ -186,8 +182,8 @@ func (a *API) limitEmailSentHandler() middlewareHandler {
 					return c, nil
 				}
 
-				if err := tollbooth.LimitByKeys(lmt, []string{"email_functions"}); err != nil {
-					return c, httpError(http.StatusTooManyRequests, "Rate limit exceeded")
+				if err := a.rateLimit(lmt, w, req, "email_functions"); err != nil {
+					return c, err
 				}
 			}
 		}
@@ -196,16 +192,18 @@ func (a *API) limitEmailSentHandler() middlewareHandler {
 }
 
 func (a *API) requireAdminCredentials(w http.ResponseWriter, req *http.Request) (context.Context, error) {
-	ctx := req.Context()
-	t, err := a.extractBearerToken(w, req)
-	if err != nil || t == "" {
+	scheme, t, err := a.extractAccessToken(req)
+	if err != nil {
 		return nil, err
 	}
 
-	ctx, err = a.parseJWTClaims(t, req, w)
+	ctx, err := a.parseJWTClaims(t, req, w)
 	if err != nil {
 		return nil, err
 	}
+	if err := a.checkDPoPBinding(req, scheme, t, getClaims(ctx)); err != nil {
+		return nil, err
+	}
 
 	return a.requireAdmin(ctx, w, req)
 }
@@ -221,33 +219,63 @@ func (a *API) requireEmailProvider(w http.ResponseWriter, req *http.Request) (co
 	return ctx, nil
 }
 
-func (a *API) verifyCaptcha(w http.ResponseWriter, req *http.Request) (context.Context, error) {
-	ctx := req.Context()
-	config := a.getConfig(ctx)
-	if !config.Security.Captcha.Enabled {
+// noCache prevents responses carrying tokens from being stored by browsers,
+// proxies or CDNs, as required by RFC 6749 section 5.1.
+func noCache(w http.ResponseWriter, req *http.Request) (context.Context, error) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	return req.Context(), nil
+}
+
+// verifyCaptcha requires a valid captcha token in requests to the endpoint,
+// if SECURITY_CAPTCHA_ENDPOINTS includes it.
+func (a *API) verifyCaptcha(endpoint string) middlewareHandler {
+	return func(w http.ResponseWriter, req *http.Request) (context.Context, error) {
+		ctx := req.Context()
+		config := a.getConfig(ctx)
+		if !config.Security.Captcha.Requires(endpoint) {
+			return ctx, nil
+		}
+		// the other grants continue flows that started elsewhere or refresh sessions
+		if endpoint == conf.CaptchaEndpointToken && req.URL.Query().Get("grant_type") != "password" {
+			return ctx, nil
+		}
+		if err := checkCaptcha(req, config); err != nil {
+			if httpErr, ok := err.(*HTTPError); ok && httpErr.Code == http.StatusBadRequest && config.Security.AutoBans.Enabled {
+				if signals, serr := riskSignalsFromRequest(req, config); serr == nil {
+					a.recordPolicyViolation(ctx, config, a.userFromRiskSignals(ctx, config, signals), models.BanReasonCaptchaFailures, signals.IPAddress)
+				}
+			}
+			return nil, err
+		}
 		return ctx, nil
 	}
-	if config.Security.Captcha.Provider != "hcaptcha" {
-		logrus.WithField("provider", config.Security.Captcha.Provider).Warn("Unsupported captcha provider")
-		return nil, internalServerError("server misconfigured")
+}
+
+func checkCaptcha(req *http.Request, config *conf.Configuration) error {
+	provider := config.Security.Captcha.Provider
+	if !security.IsSupportedCaptchaProvider(provider) {
+		logrus.WithField("provider", provider).Warn("Unsupported captcha provider")
+		return internalServerError("server misconfigured")
 	}
 	secret := strings.TrimSpace(config.Security.Captcha.Secret)
 	if secret == "" {
-		return nil, internalServerError("server misconfigured")
+		return internalServerError("server misconfigured")
 	}
 
-	verificationResult, err := security.VerifyRequest(req, secret)
+	client := SafeHTTPClient(&http.Client{Timeout: security.Client.Timeout}, logger.GetLogEntry(req))
+	verificationResult, err := security.VerifyRequest(req, provider, secret, client)
 	if err != nil {
 		logrus.WithField("err", err).Infof("failed to validate result")
-		return nil, internalServerError("request validation failure")
+		return internalServerError("request validation failure")
 	}
 	if verificationResult == security.VerificationProcessFailure {
-		return nil, internalServerError("request validation failure")
+		return internalServerError("request validation failure")
 	} else if verificationResult == security.UserRequestFailed {
-		return nil, badRequestError("request disallowed")
+		return badRequestError("request disallowed")
 	}
 	if verificationResult == security.SuccessfullyVerified {
-		return ctx, nil
+		return nil
 	}
-	return nil, internalServerError("")
+	return internalServerError("")
 }
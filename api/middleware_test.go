@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofrs/uuid"
@@ -65,7 +66,7 @@ func (ts *MiddlewareTestSuite) TestVerifyCaptchaValid() {
 
 	w := httptest.NewRecorder()
 
-	afterCtx, err := ts.API.verifyCaptcha(w, req)
+	afterCtx, err := ts.API.verifyCaptcha(conf.CaptchaEndpointSignup)(w, req)
 	require.NoError(ts.T(), err)
 
 	body, err := ioutil.ReadAll(req.Body)
@@ -141,13 +142,40 @@ func (ts *MiddlewareTestSuite) TestVerifyCaptchaInvalid() {
 
 			w := httptest.NewRecorder()
 
-			_, err = ts.API.verifyCaptcha(w, req)
+			_, err = ts.API.verifyCaptcha(conf.CaptchaEndpointSignup)(w, req)
 			require.Equal(ts.T(), c.expectedCode, err.(*HTTPError).Code)
 			require.Equal(ts.T(), c.expectedMsg, err.(*HTTPError).Message)
 		})
 	}
 }
 
+func TestVerifyCaptchaEndpoints(t *testing.T) {
+	api := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{}
+	config.Security.Captcha = conf.CaptchaConfiguration{
+		Enabled:   true,
+		Provider:  "turnstile",
+		Endpoints: []string{conf.CaptchaEndpointSignup, conf.CaptchaEndpointToken},
+	}
+
+	verify := func(endpoint, target string) error {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("{}"))
+		req = req.WithContext(withConfig(req.Context(), config))
+		_, err := api.verifyCaptcha(endpoint)(httptest.NewRecorder(), req)
+		return err
+	}
+
+	// the secret is missing, so requests requiring a captcha fail
+	assert.Error(t, verify(conf.CaptchaEndpointSignup, "/signup"))
+	assert.Error(t, verify(conf.CaptchaEndpointToken, "/token?grant_type=password"))
+	assert.NoError(t, verify(conf.CaptchaEndpointToken, "/token?grant_type=refresh_token"))
+	assert.NoError(t, verify(conf.CaptchaEndpointToken, "/token?grant_type=pkce"))
+	assert.NoError(t, verify(conf.CaptchaEndpointRecover, "/recover"))
+
+	config.Security.Captcha.Endpoints = nil
+	assert.Error(t, verify(conf.CaptchaEndpointRecover, "/recover"))
+}
+
 func TestFunctionHooksUnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		in string
@@ -170,3 +198,77 @@ func TestFunctionHooksUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestAddRequestID(t *testing.T) {
+	tests := []struct {
+		desc     string
+		headers  map[string]string
+		expected string
+	}{
+		{
+			desc:     "Configured header",
+			headers:  map[string]string{"X-Custom-Id": "custom-id", requestIDHeader: "other-id"},
+			expected: "custom-id",
+		},
+		{
+			desc:     "X-Request-Id header",
+			headers:  map[string]string{requestIDHeader: "upstream-id"},
+			expected: "upstream-id",
+		},
+	}
+	for _, c := range tests {
+		t.Run(c.desc, func(t *testing.T) {
+			globalConfig := &conf.GlobalConfiguration{}
+			globalConfig.API.RequestIDHeader = "X-Custom-Id"
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			for name, value := range c.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			ctx, err := addRequestID(globalConfig)(w, req)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, getRequestID(ctx))
+			assert.Equal(t, c.expected, w.Header().Get(requestIDHeader))
+		})
+	}
+
+	// a new ID is generated when no upstream header is present
+	w := httptest.NewRecorder()
+	ctx, err := addRequestID(&conf.GlobalConfiguration{})(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.NoError(t, err)
+	assert.NotEmpty(t, getRequestID(ctx))
+	assert.Equal(t, getRequestID(ctx), w.Header().Get(requestIDHeader))
+
+	// invalid upstream IDs are replaced with a generated one
+	for _, id := range []string{strings.Repeat("a", maxRequestIDLength+1), "id with spaces", "id\r\nX-Injected: 1", "<script>"} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set(requestIDHeader, id)
+		ctx, err := addRequestID(&conf.GlobalConfiguration{})(httptest.NewRecorder(), req)
+		require.NoError(t, err)
+		assert.NotEqual(t, id, getRequestID(ctx))
+		assert.True(t, validRequestID(getRequestID(ctx)))
+	}
+
+	// the traceparent trace ID is kept separately from the request ID
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, err = addRequestID(&conf.GlobalConfiguration{})(httptest.NewRecorder(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", getTraceID(ctx))
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", getRequestID(ctx))
+}
+
+func TestNoCache(t *testing.T) {
+	r := newRouter()
+	r.With(noCache).Post("/token", func(w http.ResponseWriter, r *http.Request) error {
+		return oauthError("invalid_grant", InvalidLoginMessage)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/token", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "no-cache", w.Header().Get("Pragma"))
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/pkg/errors"
+)
+
+const clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionMaxLifetime bounds how long a client assertion is accepted,
+// and so how long its jti has to be remembered.
+const clientAssertionMaxLifetime = 5 * time.Minute
+
+// clientAssertionSigningMethods are the algorithms accepted for private_key_jwt client assertions.
+var clientAssertionSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// parseClientJWKS parses the public keys a client signs its assertions with.
+func parseClientJWKS(jwks map[string]interface{}) (*jwk.Set, error) {
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, err
+	}
+	set, err := jwk.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("JWKS contains no keys")
+	}
+	for _, key := range set.Keys {
+		switch key.(type) {
+		case *jwk.RSAPublicKey, *jwk.ECDSAPublicKey:
+		default:
+			// private and symmetric keys are secrets that must never be registered
+			return nil, errors.New("JWKS must only contain public keys")
+		}
+	}
+	return set, nil
+}
+
+// validateClientAuthMethod checks that a client has what it needs to authenticate with method.
+func validateClientAuthMethod(config *conf.Configuration, method string, jwks map[string]interface{}, subjectDN string) error {
+	switch method {
+	case models.TokenEndpointAuthClientSecretBasic, models.TokenEndpointAuthClientSecretPost:
+		if config.OAuthServer.RequireStrongClientAuth {
+			return errors.New("Client secrets are not allowed, use private_key_jwt or tls_client_auth")
+		}
+	case models.TokenEndpointAuthNone:
+	case models.TokenEndpointAuthPrivateKeyJWT:
+		if _, err := parseClientJWKS(jwks); err != nil {
+			return errors.Wrap(err, "private_key_jwt requires a valid jwks")
+		}
+	case models.TokenEndpointAuthTLSClientAuth:
+		if pool, _ := config.OAuthServer.ClientCertificatePool(); pool == nil {
+			return errors.New("tls_client_auth is not available")
+		}
+		if subjectDN == "" {
+			return errors.New("tls_client_auth requires tls_client_auth_subject_dn")
+		}
+	default:
+		return errors.Errorf("Unsupported token_endpoint_auth_method %q", method)
+	}
+	return nil
+}
+
+// clientCertificateChain returns the TLS client certificate of the request,
+// followed by any intermediate certificates. TLS is terminated by a proxy in
+// front of GoTrue, which passes the URL-encoded PEM certificates in the
+// configured header.
+func (a *API) clientCertificateChain(r *http.Request) []*x509.Certificate {
+	header := a.config.API.ClientCertificateHeader
+	if header == "" {
+		return nil
+	}
+	raw, err := url.QueryUnescape(r.Header.Get(header))
+	if err != nil {
+		return nil
+	}
+
+	var chain []*x509.Certificate
+	rest := []byte(raw)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return chain
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		chain = append(chain, cert)
+	}
+}
+
+// verifyClientCertificate checks that the client certificate was issued for
+// client authentication by one of the trusted CAs, and that it carries the
+// subject DN the client registered.
+func verifyClientCertificate(pool *x509.CertPool, chain []*x509.Certificate, subjectDN string) error {
+	if pool == nil {
+		return errors.New("no client certificate CA configured")
+	}
+	if len(chain) == 0 {
+		return errors.New("missing client certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return err
+	}
+	if chain[0].Subject.String() != subjectDN {
+		return errors.New("client certificate subject does not match")
+	}
+	return nil
+}
+
+// authenticateOAuthClient authenticates the client calling the token endpoint
+// with the method it registered: a shared secret, a private_key_jwt client
+// assertion (RFC 7523), a TLS client certificate (RFC 8705) or, for public
+// clients, nothing at all.
+func (a *API) authenticateOAuthClient(r *http.Request) (*models.OAuthClient, error) {
+	config := a.getConfig(r.Context())
+
+	assertionType := r.PostFormValue("client_assertion_type")
+	assertion := r.PostFormValue("client_assertion")
+	if assertionType != "" || assertion != "" {
+		if assertionType != clientAssertionTypeJWTBearer {
+			return nil, oauthError("invalid_client", "Unsupported client_assertion_type")
+		}
+		return a.authenticateClientAssertion(r, assertion)
+	}
+
+	rawClientID, secret, hasBasicAuth := r.BasicAuth()
+	if !hasBasicAuth {
+		rawClientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	client, err := a.findOAuthClient(r, rawClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch client.AuthMethod() {
+	case models.TokenEndpointAuthNone:
+		if secret != "" {
+			return nil, oauthError("invalid_client", "Public clients must not send a client secret")
+		}
+	case models.TokenEndpointAuthTLSClientAuth:
+		pool, err := config.OAuthServer.ClientCertificatePool()
+		if err != nil {
+			return nil, internalServerError("Invalid client certificate CA").WithInternalError(err)
+		}
+		if err := verifyClientCertificate(pool, a.clientCertificateChain(r), string(client.TLSClientAuthSubjectDN)); err != nil {
+			return nil, oauthError("invalid_client", "Client authentication failed").WithInternalError(err)
+		}
+	case models.TokenEndpointAuthPrivateKeyJWT:
+		return nil, oauthError("invalid_client", "Client must authenticate with a client assertion")
+	default:
+		if config.OAuthServer.RequireStrongClientAuth {
+			return nil, oauthError("invalid_client", "Client secrets are not allowed")
+		}
+		if !client.Authenticate(secret) {
+			return nil, oauthError("invalid_client", "Client authentication failed")
+		}
+	}
+	return client, nil
+}
+
+func (a *API) findOAuthClient(r *http.Request, rawClientID string) (*models.OAuthClient, error) {
+	clientID, err := uuid.FromString(rawClientID)
+	if err != nil {
+		return nil, oauthError("invalid_client", "Client authentication failed")
+	}
+	client, err := models.FindOAuthClient(a.getDB(r.Context()), getInstanceID(r.Context()), clientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, oauthError("invalid_client", "Client authentication failed")
+		}
+		return nil, internalServerError("Database error finding OAuth client").WithInternalError(err)
+	}
+	return client, nil
+}
+
+// authenticateClientAssertion verifies a private_key_jwt client assertion as described in RFC 7523 section 3.
+func (a *API) authenticateClientAssertion(r *http.Request, assertion string) (*models.OAuthClient, error) {
+	unverified := jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(assertion, &unverified); err != nil {
+		return nil, oauthError("invalid_client", "Invalid client assertion")
+	}
+	if unverified.Issuer != unverified.Subject {
+		return nil, oauthError("invalid_client", "Invalid client assertion")
+	}
+	if clientID := r.PostFormValue("client_id"); clientID != "" && clientID != unverified.Subject {
+		return nil, oauthError("invalid_client", "Invalid client assertion")
+	}
+
+	client, err := a.findOAuthClient(r, unverified.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if client.AuthMethod() != models.TokenEndpointAuthPrivateKeyJWT {
+		return nil, oauthError("invalid_client", "Client is not registered for private_key_jwt")
+	}
+	keys, err := parseClientJWKS(client.JWKS)
+	if err != nil {
+		return nil, internalServerError("Invalid JWKS for OAuth client").WithInternalError(err)
+	}
+
+	claims := jwt.StandardClaims{}
+	p := jwt.Parser{ValidMethods: clientAssertionSigningMethods}
+	_, err = p.ParseWithClaims(assertion, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range keys.Keys {
+			if kid == "" || key.KeyID() == kid {
+				return key.Materialize()
+			}
+		}
+		return nil, errors.New("no matching key")
+	})
+	if err != nil {
+		return nil, oauthError("invalid_client", "Invalid client assertion").WithInternalError(err)
+	}
+
+	issuer := a.oauthIssuer()
+	if !claims.VerifyAudience(issuer+"/oauth/token", true) && !claims.VerifyAudience(issuer, true) {
+		return nil, oauthError("invalid_client", "Client assertion has the wrong audience")
+	}
+	if claims.ExpiresAt == 0 || claims.Id == "" {
+		return nil, oauthError("invalid_client", "Client assertion requires exp and jti claims")
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if expiresAt.After(clock.Now().Add(clientAssertionMaxLifetime)) {
+		return nil, oauthError("invalid_client", "Client assertion expires too far in the future")
+	}
+
+	// the jti is stored in the database so a replayed assertion is rejected by every instance
+	ok, err := models.UseNonce(a.getDB(r.Context()), client.InstanceID, models.NonceClientAssertion, client.ID.String()+":"+claims.Id, expiresAt)
+	if err != nil {
+		return nil, internalServerError("Database error checking client assertion").WithInternalError(err)
+	}
+	if !ok {
+		return nil, oauthError("invalid_client", "Client assertion has already been used")
+	}
+	return client, nil
+}
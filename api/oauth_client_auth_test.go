@@ -0,0 +1,137 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClientJWKS(t *testing.T, key interface{}) map[string]interface{} {
+	k, err := jwk.New(key)
+	require.NoError(t, err)
+	require.NoError(t, k.Set(jwk.KeyIDKey, "test"))
+	data, err := json.Marshal(map[string]interface{}{"keys": []interface{}{k}})
+	require.NoError(t, err)
+	jwks := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &jwks))
+	return jwks
+}
+
+// testCertificate issues a certificate for subject, signed by parent (or self-signed when parent is nil).
+func testCertificate(t *testing.T, subject string, isCA bool, usage x509.ExtKeyUsage, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: subject},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func testCertificatePEM(certs ...*x509.Certificate) string {
+	var out []byte
+	for _, cert := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return string(out)
+}
+
+func TestVerifyClientCertificate(t *testing.T) {
+	ca, caKey := testCertificate(t, "Test CA", true, x509.ExtKeyUsageAny, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	client, _ := testCertificate(t, "partner", false, x509.ExtKeyUsageClientAuth, ca, caKey)
+	assert.NoError(t, verifyClientCertificate(pool, []*x509.Certificate{client}, "CN=partner"))
+	assert.Error(t, verifyClientCertificate(pool, []*x509.Certificate{client}, "CN=other"))
+	assert.Error(t, verifyClientCertificate(nil, []*x509.Certificate{client}, "CN=partner"))
+	assert.Error(t, verifyClientCertificate(pool, nil, "CN=partner"))
+
+	// anyone can issue themselves a certificate with the registered subject
+	selfSigned, _ := testCertificate(t, "partner", false, x509.ExtKeyUsageClientAuth, nil, nil)
+	assert.Error(t, verifyClientCertificate(pool, []*x509.Certificate{selfSigned}, "CN=partner"))
+
+	server, _ := testCertificate(t, "partner", false, x509.ExtKeyUsageServerAuth, ca, caKey)
+	assert.Error(t, verifyClientCertificate(pool, []*x509.Certificate{server}, "CN=partner"))
+
+	intermediate, intermediateKey := testCertificate(t, "Intermediate CA", true, x509.ExtKeyUsageAny, ca, caKey)
+	leaf, _ := testCertificate(t, "partner", false, x509.ExtKeyUsageClientAuth, intermediate, intermediateKey)
+	assert.Error(t, verifyClientCertificate(pool, []*x509.Certificate{leaf}, "CN=partner"))
+	assert.NoError(t, verifyClientCertificate(pool, []*x509.Certificate{leaf, intermediate}, "CN=partner"))
+}
+
+func TestClientCertificateChain(t *testing.T) {
+	ca, caKey := testCertificate(t, "Test CA", true, x509.ExtKeyUsageAny, nil, nil)
+	leaf, _ := testCertificate(t, "partner", false, x509.ExtKeyUsageClientAuth, ca, caKey)
+
+	globalConfig := &conf.GlobalConfiguration{}
+	a := &API{config: globalConfig}
+
+	req := httptest.NewRequest("POST", "/oauth/token", nil)
+	req.Header.Set("X-Client-Cert", url.QueryEscape(testCertificatePEM(leaf, ca)))
+	assert.Empty(t, a.clientCertificateChain(req))
+
+	globalConfig.API.ClientCertificateHeader = "X-Client-Cert"
+	chain := a.clientCertificateChain(req)
+	require.Len(t, chain, 2)
+	assert.Equal(t, leaf.Raw, chain[0].Raw)
+	assert.Equal(t, ca.Raw, chain[1].Raw)
+}
+
+func TestValidateClientAuthMethod(t *testing.T) {
+	config := &conf.Configuration{}
+	ca, _ := testCertificate(t, "Test CA", true, x509.ExtKeyUsageAny, nil, nil)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicJWKS := testClientJWKS(t, &privateKey.PublicKey)
+
+	assert.NoError(t, validateClientAuthMethod(config, models.TokenEndpointAuthClientSecretBasic, nil, ""))
+	assert.NoError(t, validateClientAuthMethod(config, models.TokenEndpointAuthNone, nil, ""))
+	assert.NoError(t, validateClientAuthMethod(config, models.TokenEndpointAuthPrivateKeyJWT, publicJWKS, ""))
+
+	// tls_client_auth needs a CA to verify certificates against
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthTLSClientAuth, nil, "CN=partner"))
+	config.OAuthServer.ClientCertificateCA = testCertificatePEM(ca)
+	assert.NoError(t, validateClientAuthMethod(config, models.TokenEndpointAuthTLSClientAuth, nil, "CN=partner"))
+
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthPrivateKeyJWT, nil, ""))
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthPrivateKeyJWT, testClientJWKS(t, []byte("shared-secret")), ""))
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthPrivateKeyJWT, testClientJWKS(t, privateKey), ""))
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthTLSClientAuth, nil, ""))
+	assert.Error(t, validateClientAuthMethod(config, "client_secret_jwt", nil, ""))
+
+	config.OAuthServer.RequireStrongClientAuth = true
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthClientSecretBasic, nil, ""))
+	assert.Error(t, validateClientAuthMethod(config, models.TokenEndpointAuthClientSecretPost, nil, ""))
+	assert.NoError(t, validateClientAuthMethod(config, models.TokenEndpointAuthPrivateKeyJWT, publicJWKS, ""))
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gobwas/glob"
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// oauthRegistrationAudience is the audience of initial access tokens, so they
+// cannot be mistaken for any other token signed with the JWT secret.
+const oauthRegistrationAudience = "gotrue:oauth_registration"
+
+// oauthInitialAccessTokenClaims are the claims of a token allowing a partner to register a client.
+// It has no subject so it cannot be used as a user token.
+type oauthInitialAccessTokenClaims struct {
+	jwt.StandardClaims
+	InstanceID string `json:"instance_id"`
+}
+
+// OAuthClientMetadata is the client metadata of RFC 7591 section 2 that GoTrue understands
+type OAuthClientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+
+	JWKS                   map[string]interface{} `json:"jwks,omitempty"`
+	TLSClientAuthSubjectDN string                 `json:"tls_client_auth_subject_dn,omitempty"`
+}
+
+// OAuthClientRegistrationResponse is the client information response of RFC 7591 section 3.2.1
+type OAuthClientRegistrationResponse struct {
+	OAuthClientMetadata
+	ClientID              string `json:"client_id"`
+	ClientSecret          string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt      int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt int64  `json:"client_secret_expires_at"`
+}
+
+// adminOAuthInitialAccessToken issues a token that allows a partner to register a single client
+func (a *API) adminOAuthInitialAccessToken(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	record, err := models.NewOAuthInitialAccessToken(instanceID, config.OAuthServer.Registration.InitialAccessTokenTTL)
+	if err != nil {
+		return internalServerError("Error generating initial access token").WithInternalError(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, oauthInitialAccessTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        record.ID.String(),
+			Audience:  oauthRegistrationAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: record.ExpiresAt.Unix(),
+		},
+		InstanceID: instanceID.String(),
+	})
+	tokenString, err := token.SignedString([]byte(config.JWT.Secret))
+	if err != nil {
+		return internalServerError("Error generating initial access token").WithInternalError(err)
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(record); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.OAuthInitialAccessTokenIssuedAction, "", map[string]interface{}{
+			"token_id":   record.ID,
+			"expires_at": record.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return internalServerError("Database error creating initial access token").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"id":                   record.ID,
+		"initial_access_token": tokenString,
+		"expires_at":           record.ExpiresAt,
+	})
+}
+
+// adminOAuthInitialAccessTokenRevoke prevents an initial access token from being used
+func (a *API) adminOAuthInitialAccessTokenRevoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	tokenID, err := uuid.FromString(chi.URLParam(r, "token_id"))
+	if err != nil {
+		return badRequestError("token_id must be an UUID")
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		record, terr := models.FindOAuthInitialAccessToken(tx, instanceID, tokenID)
+		if terr != nil {
+			return terr
+		}
+		if terr := record.Revoke(tx); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.OAuthInitialAccessTokenRevokedAction, "", map[string]interface{}{
+			"token_id": record.ID,
+		})
+	})
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("Initial access token not found")
+		}
+		return internalServerError("Database error revoking initial access token").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+// verifyInitialAccessToken checks the signature of the initial access token and
+// returns its record. Whether it is still usable is checked when it is used.
+func (a *API) verifyInitialAccessToken(r *http.Request, config *conf.Configuration) (*models.OAuthInitialAccessToken, error) {
+	matches := bearerRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+	if len(matches) != 2 {
+		return nil, unauthorizedError("Client registration requires an initial access token")
+	}
+
+	instanceID := getInstanceID(r.Context())
+	claims := oauthInitialAccessTokenClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err := p.ParseWithClaims(matches[1], &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.JWT.Secret), nil
+	})
+	if err != nil || !claims.VerifyAudience(oauthRegistrationAudience, true) || claims.InstanceID != instanceID.String() {
+		return nil, unauthorizedError("Invalid initial access token")
+	}
+	tokenID, err := uuid.FromString(claims.Id)
+	if err != nil {
+		return nil, unauthorizedError("Invalid initial access token")
+	}
+
+	record, err := models.FindOAuthInitialAccessToken(a.getDB(r.Context()), instanceID, tokenID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, unauthorizedError("Invalid initial access token")
+		}
+		return nil, internalServerError("Database error loading initial access token").WithInternalError(err)
+	}
+	return record, nil
+}
+
+// checkRegistrationRedirectURI applies the registration policy to a redirect URI
+func checkRegistrationRedirectURI(policy *conf.OAuthRegistrationConfiguration, uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		// only loopback redirects are allowed without TLS, see RFC 8252 section 7.3
+		if ip := net.ParseIP(u.Hostname()); !(u.Hostname() == "localhost" || (ip != nil && ip.IsLoopback())) {
+			return false
+		}
+		return policy.AllowPublicClients
+	default:
+		// private-use URI schemes are only meaningful for native (public) clients
+		return policy.AllowPublicClients && strings.Contains(u.Scheme, ".")
+	}
+
+	// https redirects must match a configured host, so nothing is allowed until an admin opts in
+	for _, pattern := range policy.AllowedRedirectHosts {
+		g, err := glob.Compile(pattern, '.')
+		if err == nil && g.Match(u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthRegister lets a partner register an OAuth client, as described in RFC 7591
+func (a *API) OAuthRegister(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	policy := &config.OAuthServer.Registration
+
+	if !policy.Enabled {
+		return notFoundError("Client registration is disabled")
+	}
+	initialAccessToken, err := a.verifyInitialAccessToken(r, config)
+	if err != nil {
+		return err
+	}
+
+	metadata := &OAuthClientMetadata{}
+	if err := json.NewDecoder(r.Body).Decode(metadata); err != nil {
+		return oauthError("invalid_client_metadata", "Could not read client metadata")
+	}
+
+	if err := validateRedirectURIs(metadata.RedirectURIs); err != nil {
+		return oauthError("invalid_redirect_uri", "Redirect URIs must be absolute and must not contain a fragment")
+	}
+	for _, uri := range metadata.RedirectURIs {
+		if !checkRegistrationRedirectURI(policy, uri) {
+			return oauthError("invalid_redirect_uri", "Redirect URI is not allowed: "+uri)
+		}
+	}
+
+	if metadata.ClientName == "" {
+		return oauthError("invalid_client_metadata", "client_name is required")
+	}
+
+	if metadata.TokenEndpointAuthMethod == "" {
+		metadata.TokenEndpointAuthMethod = models.TokenEndpointAuthClientSecretBasic
+	}
+	if err := validateClientAuthMethod(config, metadata.TokenEndpointAuthMethod, metadata.JWKS, metadata.TLSClientAuthSubjectDN); err != nil {
+		return oauthError("invalid_client_metadata", err.Error())
+	}
+	public := metadata.TokenEndpointAuthMethod == models.TokenEndpointAuthNone
+	if public && !policy.AllowPublicClients {
+		return oauthError("invalid_client_metadata", "Public clients are not allowed")
+	}
+	if !public {
+		for _, uri := range metadata.RedirectURIs {
+			if !strings.HasPrefix(uri, "https://") {
+				return oauthError("invalid_redirect_uri", "Confidential clients must use https redirect URIs")
+			}
+		}
+	}
+
+	if len(metadata.GrantTypes) == 0 {
+		metadata.GrantTypes = []string{"authorization_code"}
+	}
+	if len(metadata.GrantTypes) != 1 || metadata.GrantTypes[0] != "authorization_code" {
+		return oauthError("invalid_client_metadata", "Only the authorization_code grant type is supported")
+	}
+	if len(metadata.ResponseTypes) == 0 {
+		metadata.ResponseTypes = []string{"code"}
+	}
+	if len(metadata.ResponseTypes) != 1 || metadata.ResponseTypes[0] != "code" {
+		return oauthError("invalid_client_metadata", "Only the code response type is supported")
+	}
+
+	allowedScopes := policy.AllowedScopes
+	if len(allowedScopes) == 0 {
+		allowedScopes = oauthSupportedScopes
+	}
+	scopes := strings.Fields(metadata.Scope)
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	for _, scope := range scopes {
+		if !isStringInSlice(scope, allowedScopes) || !isStringInSlice(scope, oauthSupportedScopes) {
+			return oauthError("invalid_client_metadata", "Scope is not allowed: "+scope)
+		}
+	}
+	metadata.Scope = strings.Join(scopes, " ")
+
+	client, secret, err := models.NewOAuthClient(instanceID, metadata.ClientName, metadata.RedirectURIs, scopes, metadata.TokenEndpointAuthMethod)
+	if err != nil {
+		return internalServerError("Error creating OAuth client").WithInternalError(err)
+	}
+	client.JWKS = metadata.JWKS
+	client.TLSClientAuthSubjectDN = storage.NullString(metadata.TLSClientAuthSubjectDN)
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		// the token is used in the same transaction, so it registers at most one client
+		if ok, terr := initialAccessToken.Use(tx); terr != nil {
+			return internalServerError("Database error using initial access token").WithInternalError(terr)
+		} else if !ok {
+			return unauthorizedError("Invalid initial access token")
+		}
+		if terr := tx.Create(client); terr != nil {
+			return internalServerError("Database error creating OAuth client").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, models.NewSystemUser(instanceID, config.JWT.Aud), models.OAuthClientCreatedAction, "", map[string]interface{}{
+			"client_id":    client.ID,
+			"name":         client.Name,
+			"registration": "dynamic",
+			"token_id":     initialAccessToken.ID,
+		}); terr != nil {
+			return internalServerError("Database error creating OAuth client").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusCreated, &OAuthClientRegistrationResponse{
+		OAuthClientMetadata: *metadata,
+		ClientID:            client.ID.String(),
+		ClientSecret:        secret,
+		ClientIDIssuedAt:    client.CreatedAt.Unix(),
+	})
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrationRedirectURIPolicy(t *testing.T) {
+	policy := &conf.OAuthRegistrationConfiguration{
+		AllowedRedirectHosts: []string{"*.partner.com", "partner.com"},
+	}
+
+	assert.True(t, checkRegistrationRedirectURI(policy, "https://partner.com/callback"))
+	assert.True(t, checkRegistrationRedirectURI(policy, "https://app.partner.com/callback"))
+	assert.False(t, checkRegistrationRedirectURI(policy, "https://evil.com/callback"))
+	assert.False(t, checkRegistrationRedirectURI(policy, "http://partner.com/callback"))
+	assert.False(t, checkRegistrationRedirectURI(policy, "http://127.0.0.1:8080/callback"))
+	assert.False(t, checkRegistrationRedirectURI(policy, "com.partner.app:/callback"))
+
+	policy.AllowPublicClients = true
+	assert.True(t, checkRegistrationRedirectURI(policy, "http://127.0.0.1:8080/callback"))
+	assert.True(t, checkRegistrationRedirectURI(policy, "com.partner.app:/callback"))
+	assert.False(t, checkRegistrationRedirectURI(policy, "myapp:/callback"))
+
+	// https hosts are denied unless they are configured
+	policy.AllowedRedirectHosts = nil
+	assert.False(t, checkRegistrationRedirectURI(policy, "https://partner.com/callback"))
+}
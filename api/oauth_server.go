@@ -0,0 +1,557 @@
+package api
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// oauthAuthorizationRequestTTL is how long a user has to consent to an authorization request.
+const oauthAuthorizationRequestTTL = 10 * time.Minute
+
+// oauthSupportedScopes are the scopes a client can be granted.
+var oauthSupportedScopes = []string{"openid", "email", "phone", "profile"}
+
+// OAuthConsentParams are the parameters the consent endpoint accepts
+type OAuthConsentParams struct {
+	Approve bool `json:"approve"`
+}
+
+// OAuthTokenResponse is the response of the OAuth provider token endpoint
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+func (a *API) requireOAuthServer(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if !a.getConfig(ctx).OAuthServer.Enabled {
+		return nil, notFoundError("OAuth server is disabled")
+	}
+	return ctx, nil
+}
+
+// oauthIssuer is the issuer of the tokens GoTrue hands out to OAuth clients.
+func (a *API) oauthIssuer() string {
+	return strings.TrimSuffix(a.config.API.ExternalURL, "/")
+}
+
+// oauthSigningKey returns the key the tokens issued to OAuth clients are signed
+// with, along with its key id.
+func oauthSigningKey(config *conf.Configuration) (*rsa.PrivateKey, string, error) {
+	key, err := config.OAuthServer.ParseSigningKey()
+	if err != nil {
+		return nil, "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(der)
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// signOAuthToken signs a token for an OAuth client with the OAuth server key.
+func signOAuthToken(config *conf.Configuration, claims jwt.Claims) (string, error) {
+	key, kid, err := oauthSigningKey(config)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// OAuthJWKS publishes the public key clients verify ID and access tokens with
+func (a *API) OAuthJWKS(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+	key, kid, err := oauthSigningKey(config)
+	if err != nil {
+		return internalServerError("OAuth server signing key is not configured").WithInternalError(err)
+	}
+
+	publicKey, err := jwk.New(&key.PublicKey)
+	if err != nil {
+		return internalServerError("Error encoding OAuth server signing key").WithInternalError(err)
+	}
+	for name, value := range map[string]string{jwk.KeyIDKey: kid, jwk.AlgorithmKey: jwt.SigningMethodRS256.Name, jwk.KeyUsageKey: "sig"} {
+		if err := publicKey.Set(name, value); err != nil {
+			return internalServerError("Error encoding OAuth server signing key").WithInternalError(err)
+		}
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []jwk.Key{publicKey},
+	})
+}
+
+// OAuthDiscovery serves the OpenID Connect discovery document
+func (a *API) OAuthDiscovery(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+	issuer := a.oauthIssuer()
+	discovery := map[string]interface{}{
+		"issuer":                                           issuer,
+		"authorization_endpoint":                           issuer + "/oauth/authorize",
+		"token_endpoint":                                   issuer + "/oauth/token",
+		"userinfo_endpoint":                                issuer + "/oauth/userinfo",
+		"jwks_uri":                                         issuer + "/oauth/jwks",
+		"response_types_supported":                         []string{"code"},
+		"grant_types_supported":                            []string{"authorization_code"},
+		"subject_types_supported":                          []string{"public"},
+		"id_token_signing_alg_values_supported":            []string{jwt.SigningMethodRS256.Name},
+		"scopes_supported":                                 oauthSupportedScopes,
+		"token_endpoint_auth_methods_supported":            []string{models.TokenEndpointAuthClientSecretBasic, models.TokenEndpointAuthClientSecretPost, models.TokenEndpointAuthNone, models.TokenEndpointAuthPrivateKeyJWT, models.TokenEndpointAuthTLSClientAuth},
+		"token_endpoint_auth_signing_alg_values_supported": clientAssertionSigningMethods,
+		"code_challenge_methods_supported":                 []string{models.CodeChallengeMethodS256, models.CodeChallengeMethodPlain},
+		"claims_supported":                                 []string{"sub", "email", "email_verified", "phone_number", "phone_number_verified", "name"},
+	}
+	if config.OAuthServer.Registration.Enabled {
+		discovery["registration_endpoint"] = issuer + "/oauth/register"
+	}
+	return sendJSON(w, http.StatusOK, discovery)
+}
+
+// OAuthAuthorize validates an authorization request from a client and sends
+// the user to the consent screen.
+func (a *API) OAuthAuthorize(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	query := r.URL.Query()
+
+	clientID, err := uuid.FromString(query.Get("client_id"))
+	if err != nil {
+		return oauthError("invalid_request", "client_id is invalid")
+	}
+	client, err := models.FindOAuthClient(a.getDB(ctx), instanceID, clientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_client", "Unknown client")
+		}
+		return internalServerError("Database error finding OAuth client").WithInternalError(err)
+	}
+
+	// Errors before the redirect URI is known to be valid must not redirect
+	redirectURI := query.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		return oauthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	state := query.Get("state")
+	redirectError := func(code, description string) error {
+		http.Redirect(w, r, oauthRedirectURL(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+		}, state), http.StatusFound)
+		return nil
+	}
+
+	if query.Get("response_type") != "code" {
+		return redirectError("unsupported_response_type", "Only the code response type is supported")
+	}
+
+	scope := query.Get("scope")
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	}
+	if !client.AllowsScopes(strings.Fields(scope)) {
+		return redirectError("invalid_scope", "The requested scope is not allowed for this client")
+	}
+
+	codeChallenge := query.Get("code_challenge")
+	codeChallengeMethod := query.Get("code_challenge_method")
+	if codeChallenge != "" && codeChallengeMethod == "" {
+		codeChallengeMethod = models.CodeChallengeMethodPlain
+	}
+	switch {
+	case codeChallenge == "" && client.Public:
+		return redirectError("invalid_request", "PKCE is required for public clients")
+	case codeChallenge != "" && codeChallengeMethod != models.CodeChallengeMethodS256 && codeChallengeMethod != models.CodeChallengeMethodPlain:
+		return redirectError("invalid_request", "Unsupported code_challenge_method")
+	case codeChallenge != "" && codeChallengeMethod != models.CodeChallengeMethodS256 && config.Security.OAuthStrict.Enabled:
+		return redirectError("invalid_request", "code_challenge_method must be S256")
+	}
+
+	authorization, err := models.NewOAuthAuthorization(instanceID, client, redirectURI, scope, state, query.Get("nonce"), codeChallenge, codeChallengeMethod, oauthAuthorizationRequestTTL)
+	if err != nil {
+		return internalServerError("Error creating OAuth authorization").WithInternalError(err)
+	}
+	authorization.RedirectURIProvided = query.Get("redirect_uri") != ""
+	if err := a.getDB(ctx).Create(authorization); err != nil {
+		return internalServerError("Database error creating OAuth authorization").WithInternalError(err)
+	}
+
+	http.Redirect(w, r, consentURL(config, authorization), http.StatusFound)
+	return nil
+}
+
+func consentURL(config *conf.Configuration, authorization *models.OAuthAuthorization) string {
+	consent := config.OAuthServer.ConsentURL
+	if consent == "" {
+		consent = strings.TrimSuffix(config.SiteURL, "/") + "/oauth/consent"
+	}
+	u, err := url.Parse(consent)
+	if err != nil {
+		return consent
+	}
+	q := u.Query()
+	q.Set("authorization_id", authorization.ID.String())
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// oauthRedirectURL adds the response parameters and the client's state to the redirect URI.
+func oauthRedirectURL(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (a *API) loadOAuthAuthorization(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	authorizationID, err := uuid.FromString(chi.URLParam(r, "authorization_id"))
+	if err != nil {
+		return nil, badRequestError("authorization_id must be an UUID")
+	}
+
+	logger.LogEntrySetField(r, "oauth_authorization_id", authorizationID)
+	instanceID := getInstanceID(ctx)
+
+	authorization, err := models.FindOAuthAuthorization(a.getDB(ctx), instanceID, authorizationID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("OAuth authorization not found")
+		}
+		return nil, internalServerError("Database error loading OAuth authorization").WithInternalError(err)
+	}
+	if !authorization.IsPending() {
+		return nil, notFoundError("OAuth authorization not found")
+	}
+
+	client, err := models.FindOAuthClient(a.getDB(ctx), instanceID, authorization.ClientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("OAuth client not found")
+		}
+		return nil, internalServerError("Database error loading OAuth client").WithInternalError(err)
+	}
+
+	ctx = withOAuthClient(ctx, client)
+	return withOAuthAuthorization(ctx, authorization), nil
+}
+
+// OAuthAuthorizationGet returns the details the consent screen shows to the user
+func (a *API) OAuthAuthorizationGet(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	authorization := getOAuthAuthorization(ctx)
+	client := getOAuthClient(ctx)
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"authorization_id": authorization.ID,
+		"client": map[string]interface{}{
+			"client_id": client.ID,
+			"name":      client.Name,
+		},
+		"scopes":       strings.Fields(authorization.Scope),
+		"redirect_uri": authorization.RedirectURI,
+		"expires_at":   authorization.ExpiresAt,
+	})
+}
+
+// OAuthConsent records the user's decision and returns where to send the user back to
+func (a *API) OAuthConsent(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	authorization := getOAuthAuthorization(ctx)
+	client := getOAuthClient(ctx)
+
+	params := &OAuthConsentParams{}
+	jsonDecoder := json.NewDecoder(r.Body)
+	if err := jsonDecoder.Decode(params); err != nil {
+		return badRequestError("Could not read consent params: %v", err)
+	}
+
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return internalServerError("Could not read user from claims").WithInternalError(err)
+	}
+
+	state := string(authorization.State)
+	if !params.Approve {
+		if err := a.getDB(ctx).Destroy(authorization); err != nil {
+			return internalServerError("Database error removing OAuth authorization").WithInternalError(err)
+		}
+		return sendJSON(w, http.StatusOK, map[string]string{
+			"redirect_to": oauthRedirectURL(authorization.RedirectURI, url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"The user denied the request"},
+			}, state),
+		})
+	}
+
+	codeLifetime := config.OAuthServer.CodeLifetime
+	if config.Security.OAuthStrict.Enabled && config.Security.OAuthStrict.CodeLifetime < codeLifetime {
+		codeLifetime = config.Security.OAuthStrict.CodeLifetime
+	}
+
+	var code string
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if code, terr = authorization.Approve(tx, user, codeLifetime); terr != nil {
+			return internalServerError("Database error approving OAuth authorization").WithInternalError(terr)
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, user, models.OAuthConsentGrantedAction, "", map[string]interface{}{
+			"client_id": client.ID,
+			"scope":     authorization.Scope,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]string{
+		"redirect_to": oauthRedirectURL(authorization.RedirectURI, url.Values{"code": {code}}, state),
+	})
+}
+
+// OAuthToken exchanges an authorization code for tokens
+func (a *API) OAuthToken(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		return oauthError("invalid_request", "Could not read token request")
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		return oauthError("unsupported_grant_type", "")
+	}
+
+	client, err := a.authenticateOAuthClient(r)
+	if err != nil {
+		return err
+	}
+
+	code := r.PostFormValue("code")
+	if code == "" {
+		return oauthError("invalid_request", "code required")
+	}
+
+	var user *models.User
+	var authorization *models.OAuthAuthorization
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		var terr error
+		authorization, terr = models.FindOAuthAuthorizationByCode(tx, instanceID, code)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return oauthError("invalid_grant", "Invalid authorization code")
+			}
+			return internalServerError("Database error finding OAuth authorization").WithInternalError(terr)
+		}
+
+		switch {
+		case authorization.UsedAt != nil:
+			return oauthError("invalid_grant", "Authorization code has already been used")
+		case authorization.IsExpired():
+			return oauthError("invalid_grant", "Authorization code has expired")
+		case authorization.ClientID != client.ID:
+			return oauthError("invalid_grant", "Authorization code was issued to another client")
+		case !authorization.MatchesRedirectURI(r.PostFormValue("redirect_uri")):
+			return oauthError("invalid_grant", "redirect_uri does not match the authorization request")
+		case !authorization.VerifyCodeVerifier(r.PostFormValue("code_verifier")):
+			return oauthError("invalid_grant", "Invalid code verifier")
+		}
+
+		consumed, terr := authorization.Consume(tx)
+		if terr != nil {
+			return internalServerError("Database error consuming authorization code").WithInternalError(terr)
+		}
+		if !consumed {
+			return oauthError("invalid_grant", "Authorization code has already been used")
+		}
+
+		user, terr = models.FindUserByInstanceIDAndID(tx, instanceID, authorization.UserID.UUID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return oauthError("invalid_grant", "Invalid authorization code")
+			}
+			return internalServerError("Database error finding user").WithInternalError(terr)
+		}
+		if user.IsBanned() {
+			return oauthError("invalid_grant", "Invalid authorization code")
+		}
+
+		return models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
+			"provider":  "oauth",
+			"client_id": client.ID,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	scopes := strings.Fields(authorization.Scope)
+	exp := config.JWT.ExpFor(user.Aud, user.AllRoles())
+	expiresIn := time.Second * time.Duration(exp)
+
+	accessToken, err := a.generateOAuthAccessToken(config, user, client, authorization.Scope, expiresIn)
+	if err != nil {
+		return internalServerError("error generating jwt token").WithInternalError(err)
+	}
+
+	response := &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "bearer",
+		ExpiresIn:   exp,
+		Scope:       authorization.Scope,
+	}
+	if isStringInSlice("openid", scopes) {
+		response.IDToken, err = a.generateIDToken(config, user, client, scopes, string(authorization.Nonce), expiresIn)
+		if err != nil {
+			return internalServerError("error generating id token").WithInternalError(err)
+		}
+	}
+
+	a.recordTokenIssued(ctx, &TokenIssuance{
+		Subject:   user.ID.String(),
+		Audience:  client.ID.String(),
+		GrantType: authorizationCodeGrant,
+		ClientID:  client.ID.String(),
+	})
+	return sendJSON(w, http.StatusOK, response)
+}
+
+// generateOAuthAccessToken creates an access token for an OAuth client. It is
+// signed with the OAuth server key rather than the JWT secret, so neither
+// GoTrue nor services trusting the JWT secret accept it as the user's token.
+func (a *API) generateOAuthAccessToken(config *conf.Configuration, user *models.User, client *models.OAuthClient, scope string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := &GoTrueClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    a.oauthIssuer(),
+			Subject:   user.ID.String(),
+			Audience:  client.ID.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiresIn).Unix(),
+		},
+		ClientID:  client.ID.String(),
+		Scope:     scope,
+		GrantType: authorizationCodeGrant,
+	}
+	return signOAuthToken(config, claims)
+}
+
+// generateIDToken creates an OIDC ID token, signed with the OAuth server key.
+func (a *API) generateIDToken(config *conf.Configuration, user *models.User, client *models.OAuthClient, scopes []string, nonce string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := oauthUserClaims(user, scopes)
+	claims["iss"] = a.oauthIssuer()
+	claims["aud"] = client.ID.String()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(expiresIn).Unix()
+	if user.LastSignInAt != nil {
+		claims["auth_time"] = user.LastSignInAt.Unix()
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return signOAuthToken(config, claims)
+}
+
+// oauthUserClaims returns the standard OIDC claims about the user allowed by the granted scopes.
+func oauthUserClaims(user *models.User, scopes []string) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub": user.ID.String(),
+	}
+	if isStringInSlice("email", scopes) && user.GetEmail() != "" {
+		claims["email"] = user.GetEmail()
+		claims["email_verified"] = user.IsConfirmed()
+	}
+	if isStringInSlice("phone", scopes) && user.GetPhone() != "" {
+		claims["phone_number"] = user.GetPhone()
+		claims["phone_number_verified"] = user.IsPhoneConfirmed()
+	}
+	if isStringInSlice("profile", scopes) {
+		for _, key := range []string{"name", "full_name"} {
+			if name, ok := user.UserMetaData[key].(string); ok && name != "" {
+				claims["name"] = name
+				break
+			}
+		}
+	}
+	return claims
+}
+
+// requireOAuthAccessToken checks for an access token issued to an OAuth client
+func (a *API) requireOAuthAccessToken(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	bearer, err := a.extractBearerToken(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := oauthSigningKey(config)
+	if err != nil {
+		return nil, internalServerError("OAuth server signing key is not configured").WithInternalError(err)
+	}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Name}}
+	token, err := p.ParseWithClaims(bearer, &GoTrueClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, unauthorizedError("Invalid token: %v", err)
+	}
+	claims := token.Claims.(*GoTrueClaims)
+	if claims.ClientID == "" || claims.Issuer != a.oauthIssuer() || !claims.VerifyAudience(claims.ClientID, true) {
+		return nil, unauthorizedError("This endpoint requires an access token issued to an OAuth client")
+	}
+	return withToken(ctx, token), nil
+}
+
+// OAuthUserInfo returns the claims about the user the client's access token grants access to
+func (a *API) OAuthUserInfo(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	claims := getClaims(ctx)
+
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid token").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, oauthUserClaims(user, strings.Fields(claims.Scope)))
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const oauthTestRedirectURI = "https://partner.example.com/callback"
+
+// testOAuthSigningKey returns a PEM encoded RSA key for signing the tokens issued to OAuth clients.
+func testOAuthSigningKey(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+type OAuthServerTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+	user       *models.User
+	client     *models.OAuthClient
+	secret     string
+}
+
+func TestOAuthServer(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &OAuthServerTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *OAuthServerTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	ts.Config.OAuthServer.Enabled = true
+	if ts.Config.OAuthServer.SigningKey == "" {
+		ts.Config.OAuthServer.SigningKey = testOAuthSigningKey(ts.T())
+	}
+
+	u, err := models.NewUser(ts.instanceID, "", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	ts.user = u
+
+	ts.client, ts.secret, err = models.NewOAuthClient(ts.instanceID, "Partner", []string{oauthTestRedirectURI}, []string{"openid", "email"}, "")
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(ts.client))
+}
+
+// authorize runs the authorization request and consent, returning the issued code.
+func (ts *OAuthServerTestSuite) authorize(client *models.OAuthClient, extra url.Values) string {
+	q := url.Values{
+		"client_id":     {client.ID.String()},
+		"redirect_uri":  {oauthTestRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"state":         {"xyz"},
+		"nonce":         {"abc"},
+	}
+	for k, v := range extra {
+		q[k] = v
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusFound, w.Code)
+
+	consent, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	authorizationID := consent.Query().Get("authorization_id")
+	require.NotEmpty(ts.T(), authorizationID)
+
+	token, err := generateAccessToken(ts.user, time.Minute, ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/oauth/authorizations/"+authorizationID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	var body bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&body).Encode(map[string]interface{}{"approve": true}))
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/oauth/authorizations/"+authorizationID+"/consent", &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := map[string]string{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	redirect, err := url.Parse(data["redirect_to"])
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "xyz", redirect.Query().Get("state"))
+	return redirect.Query().Get("code")
+}
+
+func (ts *OAuthServerTestSuite) exchange(form url.Values, clientID, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *OAuthServerTestSuite) TestAuthorizationCodeFlow() {
+	code := ts.authorize(ts.client, nil)
+	require.NotEmpty(ts.T(), code)
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {oauthTestRedirectURI},
+	}
+	w := ts.exchange(form, ts.client.ID.String(), ts.secret)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	rsp := OAuthTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&rsp))
+	assert.NotEmpty(ts.T(), rsp.AccessToken)
+	assert.NotEmpty(ts.T(), rsp.IDToken)
+	assert.Equal(ts.T(), "openid email", rsp.Scope)
+
+	// codes are single-use
+	w = ts.exchange(form, ts.client.ID.String(), ts.secret)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	// the redirect_uri sent with the authorization request is required
+	w = ts.exchange(url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {ts.authorize(ts.client, nil)},
+	}, ts.client.ID.String(), ts.secret)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	// the access token only works at the userinfo endpoint
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/oauth/userinfo", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rsp.AccessToken))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	info := map[string]interface{}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&info))
+	assert.Equal(ts.T(), ts.user.ID.String(), info["sub"])
+	assert.Equal(ts.T(), "test@example.com", info["email"])
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rsp.AccessToken))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (ts *OAuthServerTestSuite) TestOAuthTokensAreNotUserTokens() {
+	code := ts.authorize(ts.client, nil)
+	w := ts.exchange(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {oauthTestRedirectURI},
+	}, ts.client.ID.String(), ts.secret)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	rsp := OAuthTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&rsp))
+
+	for _, token := range []string{rsp.IDToken, rsp.AccessToken} {
+		var body bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&body).Encode(map[string]interface{}{"password": "taken-over"}))
+		req := httptest.NewRequest(http.MethodPut, "http://localhost/user", &body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+	}
+
+	// clients can verify the tokens with the published key
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/oauth/jwks", nil)
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	set, err := jwk.ParseBytes(w.Body.Bytes())
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), set.Keys, 1)
+	publicKey, err := set.Keys[0].Materialize()
+	require.NoError(ts.T(), err)
+	_, err = jwt.Parse(rsp.IDToken, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(ts.T(), set.Keys[0].KeyID(), token.Header["kid"])
+		return publicKey, nil
+	})
+	assert.NoError(ts.T(), err)
+}
+
+func (ts *OAuthServerTestSuite) TestWrongClientSecret() {
+	code := ts.authorize(ts.client, nil)
+
+	w := ts.exchange(url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+	}, ts.client.ID.String(), "wrong")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *OAuthServerTestSuite) TestUnregisteredRedirectURI() {
+	q := url.Values{
+		"client_id":     {ts.client.ID.String()},
+		"redirect_uri":  {"https://evil.example.com/callback"},
+		"response_type": {"code"},
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *OAuthServerTestSuite) TestPublicClientRequiresPKCE() {
+	client, _, err := models.NewOAuthClient(ts.instanceID, "Mobile", []string{oauthTestRedirectURI}, []string{"openid", "email"}, models.TokenEndpointAuthNone)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(client))
+
+	q := url.Values{
+		"client_id":     {client.ID.String()},
+		"redirect_uri":  {oauthTestRedirectURI},
+		"response_type": {"code"},
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusFound, w.Code)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "invalid_request", redirect.Query().Get("error"))
+
+	verifier := "a-sufficiently-long-code-verifier-for-the-test-case"
+	sum := sha256.Sum256([]byte(verifier))
+	code := ts.authorize(client, url.Values{
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	})
+
+	w = ts.exchange(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthTestRedirectURI},
+		"client_id":     {client.ID.String()},
+		"code_verifier": {verifier},
+	}, "", "")
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+func (ts *OAuthServerTestSuite) TestPrivateKeyJWTClient() {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(ts.T(), err)
+
+	client, secret, err := models.NewOAuthClient(ts.instanceID, "Bank", []string{oauthTestRedirectURI}, []string{"openid", "email"}, models.TokenEndpointAuthPrivateKeyJWT)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), secret)
+	client.JWKS = testClientJWKS(ts.T(), &privateKey.PublicKey)
+	require.NoError(ts.T(), ts.API.db.Create(client))
+
+	assertion := func(id string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+			Issuer:    client.ID.String(),
+			Subject:   client.ID.String(),
+			Audience:  ts.API.oauthIssuer() + "/oauth/token",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			Id:        id,
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(privateKey)
+		require.NoError(ts.T(), err)
+		return signed
+	}
+
+	form := url.Values{
+		"grant_type":            {"authorization_code"},
+		"code":                  {ts.authorize(client, nil)},
+		"redirect_uri":          {oauthTestRedirectURI},
+		"client_assertion_type": {clientAssertionTypeJWTBearer},
+		"client_assertion":      {assertion("first")},
+	}
+	assert.Equal(ts.T(), http.StatusOK, ts.exchange(form, "", "").Code)
+
+	// assertions cannot be replayed
+	form.Set("code", ts.authorize(client, nil))
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.exchange(form, "", "").Code)
+
+	// the client cannot fall back to a secret
+	form.Del("client_assertion_type")
+	form.Del("client_assertion")
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.exchange(form, client.ID.String(), "guess").Code)
+}
+
+func (ts *OAuthServerTestSuite) TestDynamicClientRegistration() {
+	ts.Config.OAuthServer.Registration.Enabled = true
+	ts.Config.OAuthServer.Registration.AllowedRedirectHosts = []string{"*.example.com"}
+	defer func() {
+		ts.Config.OAuthServer.Registration.Enabled = false
+		ts.Config.OAuthServer.Registration.AllowedRedirectHosts = nil
+	}()
+
+	adminUser := &models.User{Role: "supabase_admin"}
+	adminToken, err := generateAccessToken(adminUser, time.Minute, ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	issue := func() (string, string) {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/admin/oauth/initial_access_tokens", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusOK, w.Code)
+		data := map[string]interface{}{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+		return data["id"].(string), data["initial_access_token"].(string)
+	}
+	_, initialAccessToken := issue()
+
+	register := func(token string, metadata map[string]interface{}) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&body).Encode(metadata))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/oauth/register", &body)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	metadata := map[string]interface{}{
+		"client_name":   "Self Registered",
+		"redirect_uris": []string{"https://partner.example.com/callback"},
+		"scope":         "openid email",
+	}
+	assert.Equal(ts.T(), http.StatusUnauthorized, register("", metadata).Code)
+
+	// hosts outside the policy are rejected before the token is used
+	metadata["redirect_uris"] = []string{"https://partner.evil.com/callback"}
+	assert.Equal(ts.T(), http.StatusBadRequest, register(initialAccessToken, metadata).Code)
+	metadata["redirect_uris"] = []string{"https://partner.example.com/callback"}
+
+	w := register(initialAccessToken, metadata)
+	require.Equal(ts.T(), http.StatusCreated, w.Code)
+	rsp := OAuthClientRegistrationResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&rsp))
+	assert.NotEmpty(ts.T(), rsp.ClientID)
+	assert.NotEmpty(ts.T(), rsp.ClientSecret)
+	assert.Equal(ts.T(), "client_secret_basic", rsp.TokenEndpointAuthMethod)
+
+	// the token registers a single client
+	assert.Equal(ts.T(), http.StatusUnauthorized, register(initialAccessToken, metadata).Code)
+
+	_, initialAccessToken = issue()
+	metadata["redirect_uris"] = []string{"http://partner.example.com/callback"}
+	assert.Equal(ts.T(), http.StatusBadRequest, register(initialAccessToken, metadata).Code)
+
+	// revoked tokens cannot be used
+	tokenID, initialAccessToken := issue()
+	req := httptest.NewRequest(http.MethodDelete, "http://localhost/admin/oauth/initial_access_tokens/"+tokenID, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	metadata["redirect_uris"] = []string{"https://partner.example.com/callback"}
+	assert.Equal(ts.T(), http.StatusUnauthorized, register(initialAccessToken, metadata).Code)
+}
+
+func TestParseJWTClaimsRejectsThirdPartyTokens(t *testing.T) {
+	globalConfig := &conf.GlobalConfiguration{}
+	globalConfig.API.ExternalURL = "https://auth.example.com"
+	api := &API{config: globalConfig}
+	config := &conf.Configuration{}
+	config.JWT.Secret = "secret"
+
+	sign := func(claims *GoTrueClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.JWT.Secret))
+		require.NoError(t, err)
+		return token
+	}
+	parse := func(token string) error {
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req = req.WithContext(withConfig(req.Context(), config))
+		_, err := api.parseJWTClaims(token, req, httptest.NewRecorder())
+		return err
+	}
+
+	user := &GoTrueClaims{StandardClaims: jwt.StandardClaims{Subject: "user-id", Audience: "authenticated"}}
+	assert.NoError(t, parse(sign(user)))
+
+	idToken := &GoTrueClaims{StandardClaims: jwt.StandardClaims{Subject: "user-id", Audience: "client-id", Issuer: "https://auth.example.com"}}
+	assert.Error(t, parse(sign(idToken)))
+
+	accessToken := &GoTrueClaims{StandardClaims: jwt.StandardClaims{Subject: "user-id", Audience: "client-id"}, ClientID: "client-id"}
+	assert.Error(t, parse(sign(accessToken)))
+
+	registration := &GoTrueClaims{StandardClaims: jwt.StandardClaims{Audience: oauthRegistrationAudience}}
+	assert.Error(t, parse(sign(registration)))
+
+	delegated := &GoTrueClaims{StandardClaims: jwt.StandardClaims{Subject: "user-id", Audience: "authenticated"}, Actor: &tokenActor{Role: "service_role"}}
+	assert.Error(t, parse(sign(delegated)))
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictRedirectURLMatching(t *testing.T) {
+	config := &conf.Configuration{
+		SiteURL:      "https://example.com",
+		URIAllowList: []string{"https://app.example.com/callback", "https://*.example.com/**"},
+	}
+	assert.NoError(t, config.ApplyDefaults())
+
+	assert.True(t, isRedirectURLValid(config, "https://example.com/some/page"))
+	assert.True(t, isRedirectURLValid(config, "https://preview.example.com/any"))
+
+	config.Security.OAuthStrict.Enabled = true
+	assert.True(t, isRedirectURLValid(config, "https://example.com"))
+	assert.True(t, isRedirectURLValid(config, "https://app.example.com/callback"))
+	assert.False(t, isRedirectURLValid(config, "https://example.com/some/page"))
+	assert.False(t, isRedirectURLValid(config, "https://preview.example.com/any"))
+	assert.False(t, isRedirectURLValid(config, "https://app.example.com/callback?next=/admin"))
+}
+
+func TestLocalhostRedirects(t *testing.T) {
+	config := &conf.Configuration{SiteURL: "https://example.com"}
+	assert.NoError(t, config.ApplyDefaults())
+	assert.False(t, isRedirectURLValid(config, "http://localhost:3000/callback"))
+
+	config.URIAllowLocalhost = true
+	assert.True(t, isRedirectURLValid(config, "http://localhost:3000/callback"))
+	assert.True(t, isRedirectURLValid(config, "http://127.0.0.1:8080"))
+	assert.False(t, isRedirectURLValid(config, "http://localhost.evil.com"))
+	assert.False(t, isRedirectURLValid(config, "javascript://localhost/%0aalert(1)"))
+}
@@ -47,6 +47,9 @@ func (a *API) Otp(w http.ResponseWriter, r *http.Request) error {
 	if params.Email != "" && params.Phone != "" {
 		return badRequestError("Only an email address or phone number should be provided")
 	}
+	if aud := a.requestAud(r.Context(), r); params.Email != "" && a.getConfig(r.Context()).Sms.IsWhatsappAudience(aud) {
+		return phoneOnlyError(aud)
+	}
 
 	r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
 
@@ -92,7 +95,7 @@ func (a *API) SmsOtp(w http.ResponseWriter, r *http.Request) error {
 
 	aud := a.requestAud(ctx, r)
 
-	user, uerr := models.FindUserByPhoneAndAudience(a.db, instanceID, params.Phone, aud)
+	user, uerr := models.FindUserByPhoneAndAudience(a.getDB(ctx), instanceID, params.Phone, aud)
 	if uerr != nil {
 		// if user does not exists, sign up the user
 		if models.IsNotFoundError(uerr) {
@@ -139,7 +142,7 @@ func (a *API) SmsOtp(w http.ResponseWriter, r *http.Request) error {
 		return internalServerError("Database error finding user").WithInternalError(uerr)
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if err := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserRecoveryRequestedAction, "", nil); err != nil {
 			return err
 		}
@@ -148,6 +151,9 @@ func (a *API) SmsOtp(w http.ResponseWriter, r *http.Request) error {
 			return badRequestError("Error sending sms: %v", terr)
 		}
 		if err := a.sendPhoneConfirmation(ctx, tx, user, params.Phone, phoneConfirmationOtp, smsProvider); err != nil {
+			if herr, ok := err.(*HTTPError); ok {
+				return herr
+			}
 			return badRequestError("Error sending sms otp: %v", err)
 		}
 		return nil
@@ -170,13 +176,13 @@ func (a *API) shouldCreateUser(r *http.Request, params *OtpParams) (bool, error)
 			if err := a.validateEmail(ctx, params.Email); err != nil {
 				return false, err
 			}
-			_, err = models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+			_, err = models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, aud)
 		} else if params.Phone != "" {
 			params.Phone, err = a.validatePhone(params.Phone)
 			if err != nil {
 				return false, err
 			}
-			_, err = models.FindUserByPhoneAndAudience(a.db, instanceID, params.Phone, aud)
+			_, err = models.FindUserByPhoneAndAudience(a.getDB(ctx), instanceID, params.Phone, aud)
 		}
 
 		if err != nil && models.IsNotFoundError(err) {
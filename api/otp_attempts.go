@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/sirupsen/logrus"
+)
+
+// otpChallenge returns which code a verification of verifyType checks and
+// when that code was sent.
+func otpChallenge(user *models.User, verifyType string) (string, *time.Time) {
+	switch verifyType {
+	case signupVerification, inviteVerification, smsVerification:
+		return models.ConfirmationChallenge, user.ConfirmationSentAt
+	case recoveryVerification, recoveryOtpVerification, magicLinkVerification:
+		return models.RecoveryChallenge, user.RecoverySentAt
+	case emailChangeVerification:
+		return models.EmailChangeChallenge, user.EmailChangeSentAt
+	case phoneChangeVerification:
+		return models.PhoneChangeChallenge, user.PhoneChangeSentAt
+	}
+	return "", nil
+}
+
+func otpLockedError() *HTTPError {
+	return tooManyRequestsError("Too many failed attempts, please request a new code").WithDetails(map[string]interface{}{
+		"reason": "otp_locked",
+	})
+}
+
+// checkOtpLocked fails once the code of challenge sent at sentAt failed
+// SECURITY_OTP_MAX_ATTEMPTS times, so it can't be guessed within its validity
+// window. Sending a new code unlocks it.
+func (a *API) checkOtpLocked(ctx context.Context, config *conf.Configuration, user *models.User, challenge string, sentAt *time.Time) error {
+	if challenge == "" || sentAt == nil {
+		return nil
+	}
+	attempts, err := models.CountFailedOtpAttempts(a.getDB(ctx), user, challenge, *sentAt)
+	if err != nil {
+		return internalServerError("Database error checking verification attempts").WithInternalError(err)
+	}
+	if attempts >= config.Security.OtpMaxAttempts {
+		return otpLockedError()
+	}
+	return nil
+}
+
+// recordFailedOtp counts a failed verification of the code and records the
+// lock once the code failed too often. The verification runs in a transaction
+// that is rolled back when it fails, so this uses its own connection.
+func (a *API) recordFailedOtp(ctx context.Context, config *conf.Configuration, user *models.User, challenge string, sentAt *time.Time) {
+	if challenge == "" || sentAt == nil {
+		return
+	}
+	log := logrus.WithFields(logrus.Fields{
+		"component":   "otp_attempts",
+		"instance_id": user.InstanceID,
+		"user_id":     user.ID,
+		"challenge":   challenge,
+	})
+
+	attempts, err := models.RecordFailedOtpAttempt(a.getDB(ctx), user, challenge, *sentAt)
+	if err != nil {
+		log.WithError(err).Error("Failed to record failed verification")
+		return
+	}
+	if attempts != config.Security.OtpMaxAttempts {
+		return
+	}
+
+	metering.RecordOtpLocked(challenge, user.ID, user.InstanceID)
+	if err := models.NewAuditLogEntry(nil, a.getDB(ctx), user.InstanceID, user, models.OtpLockedAction, "", map[string]interface{}{
+		"challenge":       challenge,
+		"failed_attempts": attempts,
+	}); err != nil {
+		log.WithError(err).Error("Failed to record locked verification")
+	}
+	a.recordPolicyViolation(context.Background(), config, user, models.BanReasonOtpBruteForce, "")
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/security"
+)
+
+// weakPasswordError is returned for passwords that don't meet the password
+// policy. The reasons are the missing character classes, "denied" or "score".
+func weakPasswordError(reasons []string) *HTTPError {
+	return unprocessableEntityError("Password is too weak: %s", strings.Join(reasons, ", ")).WithDetails(map[string]interface{}{
+		"reason":  "weak_password",
+		"reasons": reasons,
+	})
+}
+
+// checkPasswordPolicy checks a password against the password policy of the
+// configuration, the minimum length is checked separately.
+func checkPasswordPolicy(config *conf.Configuration, password string) error {
+	policy := config.PasswordPolicy
+	reasons := []string{}
+
+	classes := security.PasswordClasses(password)
+	for _, class := range policy.RequiredCharacters {
+		if !classes[class] {
+			reasons = append(reasons, class)
+		}
+	}
+	if security.IsDeniedPassword(password, policy.Denylist) {
+		reasons = append(reasons, "denied")
+	} else if policy.MinScore > 0 && security.PasswordScore(password, policy.Denylist) < policy.MinScore {
+		reasons = append(reasons, "score")
+	}
+
+	if len(reasons) > 0 {
+		return weakPasswordError(reasons)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	config := &conf.Configuration{}
+	assert.NoError(t, checkPasswordPolicy(config, "password"))
+
+	config.PasswordPolicy.RequiredCharacters = []string{"uppercase", "digits"}
+	config.PasswordPolicy.MinScore = 3
+	config.PasswordPolicy.Denylist = []string{"acme"}
+	assert.NoError(t, checkPasswordPolicy(config, "Tr0ub4dor&3"))
+
+	err := checkPasswordPolicy(config, "abcdefgh")
+	require.Error(t, err)
+	httpErr := err.(*HTTPError)
+	assert.Equal(t, http.StatusUnprocessableEntity, httpErr.Code)
+	assert.Equal(t, "weak_password", httpErr.Details["reason"])
+	assert.Equal(t, []string{"uppercase", "digits", "score"}, httpErr.Details["reasons"])
+
+	err = checkPasswordPolicy(config, "Acme2022!")
+	require.Error(t, err)
+	assert.Equal(t, []string{"denied"}, err.(*HTTPError).Details["reasons"])
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const passwordVerificationHookEvent = "password_verification"
+
+// PasswordVerificationHookInput is sent to the password verification hook.
+type PasswordVerificationHookInput struct {
+	Event    string       `json:"event"`
+	User     *models.User `json:"user"`
+	Password string       `json:"password"`
+}
+
+// PasswordVerificationHookOutput is what the password verification hook
+// returns.
+type PasswordVerificationHookOutput struct {
+	Valid bool `json:"valid"`
+}
+
+// verifyLegacyPassword asks the legacy auth system to verify the password of
+// a user who has no password in GoTrue yet, and stores it once accepted so
+// the next sign ins are checked locally. Users with a password are never
+// checked, so the legacy system can't undo a password changed in GoTrue.
+func (a *API) verifyLegacyPassword(r *http.Request, conn *storage.Connection, user *models.User, password string) (bool, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	hookConfig := config.PasswordVerificationHook
+	if hookConfig.URL == "" || user.EncryptedPassword != "" || password == "" {
+		return false, nil
+	}
+	instanceID := getInstanceID(ctx)
+
+	data, err := json.Marshal(&PasswordVerificationHookInput{
+		Event:    passwordVerificationHookEvent,
+		User:     user,
+		Password: password,
+	})
+	if err != nil {
+		return false, internalServerError("Error verifying password").WithInternalError(err)
+	}
+	sha, err := checksum(data)
+	if err != nil {
+		return false, internalServerError("Error verifying password").WithInternalError(err)
+	}
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{URL: hookConfig.URL, Retries: 1, TimeoutSec: hookConfig.TimeoutSec},
+		jwtSecret:     hookConfig.Secret,
+		instanceID:    instanceID,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  instanceID.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: data,
+		headers: requestIDHeaders(getRequestID(ctx)),
+	}
+	body, err := w.trigger()
+	if err != nil {
+		return false, internalServerError("Error verifying password").WithInternalError(err)
+	}
+	if body == nil {
+		return false, nil
+	}
+	defer body.Close()
+
+	output := &PasswordVerificationHookOutput{}
+	if err := json.NewDecoder(body).Decode(output); err != nil {
+		return false, internalServerError("Error verifying password").WithInternalError(err)
+	}
+	if !output.Valid {
+		return false, nil
+	}
+
+	err = conn.Transaction(func(tx *storage.Connection) error {
+		if terr := user.UpdatePassword(tx, password); terr != nil {
+			return internalServerError("Database error updating password").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserModifiedAction, "", map[string]interface{}{
+			"legacy_password_migrated": true,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PasswordVerificationHookTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+	calls      int32
+}
+
+func TestPasswordVerificationHook(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &PasswordVerificationHookTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *PasswordVerificationHookTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	atomic.StoreInt32(&ts.calls, 0)
+	ts.Config.PasswordVerificationHook = conf.PasswordVerificationHookConfiguration{}
+}
+
+func (ts *PasswordVerificationHookTestSuite) createUser(passwordHash string) *models.User {
+	u, err := models.NewUserWithPasswordHash(ts.instanceID, "", "legacy@example.com", passwordHash, ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.EmailConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	return u
+}
+
+// legacyServer accepts the password "legacy-password" only.
+func (ts *PasswordVerificationHookTestSuite) legacyServer() *httptest.Server {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ts.calls, 1)
+		input := PasswordVerificationHookInput{}
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&input))
+		assert.Equal(ts.T(), passwordVerificationHookEvent, input.Event)
+		assert.Equal(ts.T(), "legacy@example.com", input.User.GetEmail())
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(ts.T(), json.NewEncoder(w).Encode(&PasswordVerificationHookOutput{
+			Valid: input.Password == "legacy-password",
+		}))
+	}))
+	ts.Config.PasswordVerificationHook.URL = svr.URL
+	return svr
+}
+
+func (ts *PasswordVerificationHookTestSuite) signIn(password string) int {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "legacy@example.com",
+		"password": password,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (ts *PasswordVerificationHookTestSuite) TestMigratesAcceptedPassword() {
+	svr := ts.legacyServer()
+	defer svr.Close()
+	u := ts.createUser("")
+
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.signIn("wrong-password"))
+	assert.Equal(ts.T(), http.StatusOK, ts.signIn("legacy-password"))
+	assert.EqualValues(ts.T(), 2, atomic.LoadInt32(&ts.calls))
+
+	u, err := models.FindUserByID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), u.Authenticate("legacy-password"))
+
+	// the password is checked locally from now on
+	assert.Equal(ts.T(), http.StatusOK, ts.signIn("legacy-password"))
+	assert.EqualValues(ts.T(), 2, atomic.LoadInt32(&ts.calls))
+}
+
+func (ts *PasswordVerificationHookTestSuite) TestSkipsUsersWithPassword() {
+	svr := ts.legacyServer()
+	defer svr.Close()
+	u, err := models.NewUser(ts.instanceID, "", "legacy@example.com", "new-password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.EmailConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.signIn("legacy-password"))
+	assert.EqualValues(ts.T(), 0, atomic.LoadInt32(&ts.calls))
+}
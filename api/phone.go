@@ -4,14 +4,20 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/netlify/gotrue/api/sms_provider"
+	"github.com/netlify/gotrue/clock"
 	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/metering"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/pkg/errors"
 )
 
@@ -21,6 +27,7 @@ const defaultSmsMessage = "Your code is %v"
 const (
 	phoneConfirmationOtp     = "confirmation"
 	phoneReauthenticationOtp = "reauthentication"
+	phoneRecoveryOtp         = "recovery"
 )
 
 func (a *API) validatePhone(phone string) (string, error) {
@@ -43,6 +50,56 @@ func (a *API) formatPhoneNumber(phone string) string {
 	return strings.ReplaceAll(strings.Trim(phone, "+"), " ", "")
 }
 
+// phoneOnlyError is returned when a user of a WhatsApp audience signs up or
+// verifies with anything but their phone number.
+func phoneOnlyError(aud string) *HTTPError {
+	return unprocessableEntityError("Only phone numbers can be used for this audience").WithDetails(map[string]interface{}{
+		"reason":  "phone_only_audience",
+		"aud":     aud,
+		"channel": "whatsapp",
+	})
+}
+
+// phoneBlockedError is returned for phone numbers in blocked ranges.
+func phoneBlockedError() *HTTPError {
+	return unprocessableEntityError("Unable to send a code to this phone number").WithDetails(map[string]interface{}{
+		"reason": "phone_prefix_blocked",
+	})
+}
+
+// smsLimitError is returned when the instance sent its daily limit of SMS.
+func smsLimitError() *HTTPError {
+	return tooManyRequestsError("SMS limit reached, please try again later").WithDetails(map[string]interface{}{
+		"reason": "sms_limit_reached",
+	})
+}
+
+// checkSmsLimit counts an SMS about to be sent against the daily limit of the
+// instance. Once the limit is reached no SMS is sent until the next day and
+// admins are alerted, so toll fraud can't run up the bill.
+func (a *API) checkSmsLimit(ctx context.Context, user *models.User, phone string) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	// counted outside of the caller's transaction, so it's kept when the
+	// send fails
+	usage, err := models.RecordSmsSend(a.getDB(ctx), instanceID, config.Sms.DailyLimit)
+	if err != nil {
+		return internalServerError("Database error recording sms").WithInternalError(err)
+	}
+	metering.RecordSmsSend(instanceID, usage.Sent, usage.Blocked, usage.LastAllowed)
+	if usage.LastAllowed {
+		return nil
+	}
+	a.reportSuspiciousActivity(ctx, SmsLimitReachedActivity, "", map[string]interface{}{
+		"user_id": user.ID,
+		"phone":   phone,
+		"limit":   config.Sms.DailyLimit,
+		"blocked": usage.Blocked,
+	})
+	return smsLimitError()
+}
+
 // sendPhoneConfirmation sends an otp to the user's phone number
 func (a *API) sendPhoneConfirmation(ctx context.Context, tx *storage.Connection, user *models.User, phone, otpType string, smsProvider sms_provider.SmsProvider) error {
 	config := a.getConfig(ctx)
@@ -65,12 +122,24 @@ func (a *API) sendPhoneConfirmation(ctx context.Context, tx *storage.Connection,
 		token = &user.ReauthenticationToken
 		sentAt = user.ReauthenticationSentAt
 		includeFields = append(includeFields, "reauthentication_token", "reauthentication_sent_at")
+	case phoneRecoveryOtp:
+		token = &user.RecoveryToken
+		sentAt = user.RecoverySentAt
+		includeFields = append(includeFields, "recovery_token", "recovery_sent_at")
 	default:
 		return internalServerError("invalid otp type")
 	}
 
-	if sentAt != nil && !sentAt.Add(config.Sms.MaxFrequency).Before(time.Now()) {
-		return MaxFrequencyLimitError
+	if err := checkFrequency(sentAt, config.Sms.MaxFrequency); err != nil {
+		return err
+	}
+
+	// blocked numbers don't count against the limit, nor reach the provider
+	if config.Sms.IsPhoneBlocked(phone) {
+		return phoneBlockedError()
+	}
+	if err := a.checkSmsLimit(ctx, user, phone); err != nil {
+		return err
 	}
 
 	oldToken := *token
@@ -87,12 +156,31 @@ func (a *API) sendPhoneConfirmation(ctx context.Context, tx *storage.Connection,
 		message = strings.Replace(config.Sms.Template, "{{ .Code }}", otp, -1)
 	}
 
-	if serr := smsProvider.SendSms(phone, message); serr != nil {
+	var serr error
+	span, _ := opentracing.StartSpanFromContext(ctx, "sms.send", ext.SpanKindRPCClient)
+	span.SetTag("sms.provider", config.Sms.Provider)
+	if config.Sms.IsWhatsappAudience(user.Aud) {
+		// phone-only audiences are never sent an SMS
+		whatsappProvider, ok := smsProvider.(sms_provider.WhatsappProvider)
+		if !ok {
+			span.Finish()
+			*token = oldToken
+			return internalServerError("SMS provider can't send WhatsApp messages")
+		}
+		span.SetTag("sms.channel", "whatsapp")
+		serr = whatsappProvider.SendWhatsapp(phone, message)
+	} else {
+		span.SetTag("sms.channel", "sms")
+		serr = smsProvider.SendSms(phone, message)
+	}
+	finishSpan(span, serr)
+	if serr != nil {
 		*token = oldToken
 		return serr
 	}
 
-	now := time.Now()
+	a.recordAuthEvent(ctx, user.Aud, otpSentAuthEvent)
+	now := clock.Now()
 
 	switch otpType {
 	case phoneConfirmationOtp:
@@ -101,7 +189,35 @@ func (a *API) sendPhoneConfirmation(ctx context.Context, tx *storage.Connection,
 		user.PhoneChangeSentAt = &now
 	case phoneReauthenticationOtp:
 		user.ReauthenticationSentAt = &now
+	case phoneRecoveryOtp:
+		user.RecoverySentAt = &now
 	}
 
 	return errors.Wrap(tx.UpdateOnly(user, includeFields...), "Database error updating user for confirmation")
 }
+
+// adminSmsUsage returns the SMS sent and blocked per day over the last days
+// (30 by default), with the daily limit.
+func (a *API) adminSmsUsage(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 366 {
+			return badRequestError("days must be a number between 1 and 366")
+		}
+		days = n
+	}
+
+	usage, err := models.FindSmsUsage(a.getDB(ctx), instanceID, time.Now().AddDate(0, 0, 1-days))
+	if err != nil {
+		return internalServerError("Database error finding sms usage").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"daily_limit": config.Sms.DailyLimit,
+		"usage":       usage,
+	})
+}
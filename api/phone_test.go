@@ -36,6 +36,22 @@ func (t *TestSmsProvider) SendSms(phone string, message string) error {
 	return nil
 }
 
+// TestWhatsappProvider records the messages sent over each channel.
+type TestWhatsappProvider struct {
+	sms      []string
+	whatsapp []string
+}
+
+func (t *TestWhatsappProvider) SendSms(phone string, message string) error {
+	t.sms = append(t.sms, phone)
+	return nil
+}
+
+func (t *TestWhatsappProvider) SendWhatsapp(phone string, message string) error {
+	t.whatsapp = append(t.whatsapp, phone)
+	return nil
+}
+
 func TestPhone(t *testing.T) {
 	api, config, instanceID, err := setupAPIForTestForInstance()
 	require.NoError(t, err)
@@ -94,6 +110,11 @@ func (ts *PhoneTestSuite) TestSendPhoneConfirmation() {
 			phoneReauthenticationOtp,
 			nil,
 		},
+		{
+			"send password recovery otp",
+			phoneRecoveryOtp,
+			nil,
+		},
 		{
 			"send invalid otp type ",
 			"invalid otp type",
@@ -118,12 +139,107 @@ func (ts *PhoneTestSuite) TestSendPhoneConfirmation() {
 			case phoneReauthenticationOtp:
 				require.NotEmpty(ts.T(), u.ReauthenticationToken)
 				require.NotEmpty(ts.T(), u.ReauthenticationSentAt)
+			case phoneRecoveryOtp:
+				require.NotEmpty(ts.T(), u.RecoveryToken)
+				require.NotEmpty(ts.T(), u.RecoverySentAt)
 			default:
 			}
 		})
 	}
 }
 
+func (ts *PhoneTestSuite) TestSendPhoneConfirmationWhatsapp() {
+	u, err := models.FindUserByPhoneAndAudience(ts.API.db, ts.instanceID, "123456789", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+
+	ts.Config.Sms.WhatsappAudiences = []string{ts.Config.JWT.Aud}
+	defer func() { ts.Config.Sms.WhatsappAudiences = nil }()
+
+	provider := &TestWhatsappProvider{}
+	require.NoError(ts.T(), ts.API.sendPhoneConfirmation(ctx, ts.API.db, u, "123456789", phoneConfirmationOtp, provider))
+	assert.Equal(ts.T(), []string{"123456789"}, provider.whatsapp)
+	assert.Empty(ts.T(), provider.sms)
+
+	// a provider without WhatsApp support doesn't fall back to SMS
+	u.ConfirmationSentAt = nil
+	err = ts.API.sendPhoneConfirmation(ctx, ts.API.db, u, "123456789", phoneReauthenticationOtp, &TestSmsProvider{})
+	assert.Error(ts.T(), err)
+}
+
+func (ts *PhoneTestSuite) TestSendPhoneConfirmationBlockedPrefix() {
+	u, err := models.FindUserByPhoneAndAudience(ts.API.db, ts.instanceID, "123456789", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+
+	provider := &TestWhatsappProvider{}
+	err = ts.API.sendPhoneConfirmation(ctx, ts.API.db, u, "8821234567", phoneChangeVerification, provider)
+	require.Equal(ts.T(), phoneBlockedError(), err)
+	assert.Empty(ts.T(), provider.sms)
+}
+
+func (ts *PhoneTestSuite) TestSmsDailyLimit() {
+	u, err := models.FindUserByPhoneAndAudience(ts.API.db, ts.instanceID, "123456789", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+
+	ts.Config.Sms.DailyLimit = 1
+	defer func() { ts.Config.Sms.DailyLimit = 0 }()
+
+	provider := &TestWhatsappProvider{}
+	require.NoError(ts.T(), ts.API.sendPhoneConfirmation(ctx, ts.API.db, u, "123456789", phoneConfirmationOtp, provider))
+	err = ts.API.sendPhoneConfirmation(ctx, ts.API.db, u, "123456789", phoneReauthenticationOtp, provider)
+	require.Equal(ts.T(), smsLimitError(), err)
+	assert.Len(ts.T(), provider.sms, 1)
+
+	usage, err := models.FindSmsUsage(ts.API.db, ts.instanceID, time.Now())
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), usage, 1)
+	assert.Equal(ts.T(), 1, usage[0].Sent)
+	assert.Equal(ts.T(), 1, usage[0].Blocked)
+
+	// raising the limit lets SMS through again the same day
+	ts.Config.Sms.DailyLimit = 2
+	require.NoError(ts.T(), ts.API.sendPhoneConfirmation(ctx, ts.API.db, u, "123456789", phoneReauthenticationOtp, provider))
+	assert.Len(ts.T(), provider.sms, 2)
+}
+
+func (ts *PhoneTestSuite) TestWhatsappAudienceRejectsEmail() {
+	ts.Config.Sms.WhatsappAudiences = []string{ts.Config.JWT.Aud}
+	defer func() { ts.Config.Sms.WhatsappAudiences = nil }()
+
+	cases := []struct {
+		desc     string
+		endpoint string
+		body     map[string]interface{}
+	}{
+		{"signup", "/signup", map[string]interface{}{"email": "test@example.com", "password": "test123"}},
+		{"otp", "/otp", map[string]interface{}{"email": "test@example.com"}},
+		{"magiclink", "/magiclink", map[string]interface{}{"email": "test@example.com"}},
+		{"recover", "/recover", map[string]interface{}{"email": "test@example.com"}},
+		{"verify", "/verify", map[string]interface{}{"type": "signup", "token": "123456", "email": "test@example.com"}},
+	}
+	for _, c := range cases {
+		ts.Run(c.desc, func() {
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(c.body))
+			req := httptest.NewRequest(http.MethodPost, "http://localhost"+c.endpoint, &buffer)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+			data := HTTPError{}
+			require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+			assert.Equal(ts.T(), "phone_only_audience", data.Details["reason"])
+			assert.Equal(ts.T(), "whatsapp", data.Details["channel"])
+		})
+	}
+}
+
 func (ts *PhoneTestSuite) TestMissingSmsProviderConfig() {
 	u, err := models.FindUserByPhoneAndAudience(ts.API.db, ts.instanceID, "123456789", ts.Config.JWT.Aud)
 	require.NoError(ts.T(), err)
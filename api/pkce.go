@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const (
+	implicitFlow = "implicit"
+	pkceFlow     = "pkce"
+
+	// pkceAuthCodeTTL is how long the authorization code of a PKCE sign-in
+	// can be exchanged for tokens.
+	pkceAuthCodeTTL = 5 * time.Minute
+)
+
+// PKCEParams are the parameters starting a sign-in with the PKCE flow
+type PKCEParams struct {
+	FlowType            string `json:"flow_type"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// PKCEGrantParams are the parameters the PKCEGrant method accepts
+type PKCEGrantParams struct {
+	AuthCode     string `json:"auth_code"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// isPKCE validates the flow parameters and returns true when the sign-in
+// uses the PKCE flow.
+func (p *PKCEParams) isPKCE(config *conf.Configuration) (bool, error) {
+	switch p.FlowType {
+	case "", implicitFlow:
+		return false, nil
+	case pkceFlow:
+	default:
+		return false, badRequestError("Unsupported flow_type, must be %s or %s", implicitFlow, pkceFlow)
+	}
+
+	if p.CodeChallengeMethod == "" {
+		p.CodeChallengeMethod = models.CodeChallengeMethodPlain
+	}
+	switch {
+	case p.CodeChallenge == "":
+		return false, badRequestError("The PKCE flow requires a code_challenge")
+	case len(p.CodeChallenge) < 43 || len(p.CodeChallenge) > 128:
+		return false, badRequestError("code_challenge must be between 43 and 128 characters")
+	case p.CodeChallengeMethod != models.CodeChallengeMethodS256 && p.CodeChallengeMethod != models.CodeChallengeMethodPlain:
+		return false, badRequestError("Unsupported code_challenge_method")
+	case p.CodeChallengeMethod != models.CodeChallengeMethodS256 && config.Security.OAuthStrict.Enabled:
+		return false, badRequestError("code_challenge_method must be S256")
+	}
+	return true, nil
+}
+
+// pkceRedirectURL adds the authorization code to the query of the redirect
+// URL, where the client picks it up to exchange it.
+func pkceRedirectURL(rurl, code string) string {
+	return appendRedirectParams(rurl, url.Values{"code": {code}})
+}
+
+// createMagicLinkFlowState starts the PKCE sign-in of the user's magic link,
+// which verifyGet issues the authorization code for.
+func (a *API) createMagicLinkFlowState(ctx context.Context, tx *storage.Connection, user *models.User, params *PKCEParams, ttl uint) error {
+	flowState, err := models.NewFlowState(getInstanceID(ctx), user, "email", magicLinkVerification, params.CodeChallenge, params.CodeChallengeMethod, time.Second*time.Duration(ttl))
+	if err != nil {
+		return internalServerError("Error creating flow state").WithInternalError(err)
+	}
+	if err := tx.Create(flowState); err != nil {
+		return internalServerError("Database error creating flow state").WithInternalError(err)
+	}
+	return nil
+}
+
+// issueMagicLinkAuthCode issues the authorization code of the user's pending
+// PKCE sign-in with a magic link, and returns an empty code without one.
+func (a *API) issueMagicLinkAuthCode(ctx context.Context, tx *storage.Connection, user *models.User) (string, error) {
+	flowState, err := models.FindPendingFlowState(tx, getInstanceID(ctx), user.ID, magicLinkVerification)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return "", nil
+		}
+		return "", internalServerError("Database error finding flow state").WithInternalError(err)
+	}
+	code, err := flowState.IssueAuthCode(tx, user, pkceAuthCodeTTL)
+	if err != nil {
+		return "", internalServerError("Database error issuing authorization code").WithInternalError(err)
+	}
+	return code, nil
+}
+
+// issueExternalAuthCode issues the authorization code of the PKCE sign-in
+// started by the external provider redirect.
+func (a *API) issueExternalAuthCode(ctx context.Context, tx *storage.Connection, user *models.User, providerType string) (string, error) {
+	id, err := uuid.FromString(getFlowStateID(ctx))
+	if err != nil {
+		return "", badRequestError("OAuth state is invalid: invalid flow state")
+	}
+	flowState, err := models.FindFlowState(tx, getInstanceID(ctx), id)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return "", badRequestError("OAuth state is invalid: flow state not found")
+		}
+		return "", internalServerError("Database error finding flow state").WithInternalError(err)
+	}
+	if flowState.ProviderType != providerType || flowState.UserID.Valid || flowState.IsExpired() {
+		return "", badRequestError("OAuth state is invalid: flow state has expired or was already used")
+	}
+
+	code, err := flowState.IssueAuthCode(tx, user, pkceAuthCodeTTL)
+	if err != nil {
+		return "", internalServerError("Database error issuing authorization code").WithInternalError(err)
+	}
+	return code, nil
+}
+
+// PKCEGrant implements the pkce grant type flow, exchanging the authorization
+// code of a sign-in for tokens with the code verifier of its challenge.
+func (a *API) PKCEGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	params := &PKCEGrantParams{}
+	jsonDecoder := json.NewDecoder(r.Body)
+	if err := jsonDecoder.Decode(params); err != nil {
+		return badRequestError("Could not read pkce grant params: %v", err)
+	}
+	if params.AuthCode == "" || params.CodeVerifier == "" {
+		return oauthError("invalid_request", "auth_code and code_verifier required")
+	}
+
+	var user *models.User
+	var token *AccessTokenResponse
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		flowState, terr := models.FindFlowStateByAuthCode(tx, instanceID, params.AuthCode)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return oauthError("invalid_grant", "Invalid authorization code")
+			}
+			return internalServerError("Database error finding flow state").WithInternalError(terr)
+		}
+
+		switch {
+		case flowState.UsedAt != nil:
+			return oauthError("invalid_grant", "Authorization code has already been used")
+		case flowState.IsExpired():
+			return oauthError("invalid_grant", "Authorization code has expired")
+		case !flowState.VerifyCodeVerifier(params.CodeVerifier):
+			return oauthError("invalid_grant", "Invalid code verifier")
+		}
+
+		consumed, terr := flowState.Consume(tx)
+		if terr != nil {
+			return internalServerError("Database error consuming authorization code").WithInternalError(terr)
+		}
+		if !consumed {
+			return oauthError("invalid_grant", "Authorization code has already been used")
+		}
+
+		user, terr = models.FindUserByInstanceIDAndID(tx, instanceID, flowState.UserID.UUID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return oauthError("invalid_grant", "Invalid authorization code")
+			}
+			return internalServerError("Database error finding user").WithInternalError(terr)
+		}
+		if user.IsBanned() {
+			return oauthError("invalid_grant", "Invalid authorization code")
+		}
+
+		token, terr = a.issueRefreshToken(ctx, r, tx, user, pkceGrant)
+		if terr != nil {
+			return terr
+		}
+
+		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
+			return internalServerError("Failed to set JWT cookie. %s", terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.recordTokenIssued(ctx, userTokenIssuance(user, pkceGrant))
+	a.recordSignIn(r, user)
+	return sendToken(w, r, token)
+}
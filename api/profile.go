@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	sortpkg "sort"
+	"strings"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// UserProfile is the progress of a user completing their profile.
+type UserProfile struct {
+	RequiredFields []string     `json:"required_fields"`
+	MissingFields  []string     `json:"missing_fields"`
+	User           *models.User `json:"user,omitempty"`
+}
+
+// missingProfileFields returns the fields of PROFILE_REQUIRED_FIELDS the user
+// hasn't filled in yet, in the configured order, or nil if none are missing.
+func missingProfileFields(config *conf.Configuration, user *models.User) []string {
+	if user == nil {
+		return nil
+	}
+	var missing []string
+	for _, field := range config.Profile.RequiredFieldsFor(user.Aud) {
+		if isProfileFieldEmpty(user.UserMetaData[field]) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+func isProfileFieldEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	}
+	return false
+}
+
+func newUserProfile(config *conf.Configuration, user *models.User) *UserProfile {
+	profile := &UserProfile{
+		RequiredFields: config.Profile.RequiredFieldsFor(user.Aud),
+		MissingFields:  missingProfileFields(config, user),
+	}
+	if profile.RequiredFields == nil {
+		profile.RequiredFields = []string{}
+	}
+	if profile.MissingFields == nil {
+		profile.MissingFields = []string{}
+	}
+	return profile
+}
+
+// UserProfileGet returns the profile fields the user has to fill in.
+func (a *API) UserProfileGet(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, newUserProfile(a.getConfig(ctx), user))
+}
+
+// UserProfileUpdate fills in the required profile fields of the user, which
+// are set in their user_metadata. Only required fields may be set.
+func (a *API) UserProfileUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		return badRequestError("Could not read profile fields: %v", err)
+	}
+	if len(fields) == 0 {
+		return unprocessableEntityError("No profile fields provided")
+	}
+
+	required := config.Profile.RequiredFieldsFor(user.Aud)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sortpkg.Strings(keys)
+	errs := fieldErrors{}
+	for _, key := range keys {
+		if !isStringInSlice(key, required) {
+			errs.add(key, "%s is not a required profile field", key)
+		} else if isProfileFieldEmpty(fields[key]) {
+			errs.add(key, "%s can't be empty", key)
+		}
+	}
+	if err := errs.toError(); err != nil {
+		return err
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := user.UpdateUserMetaData(tx, fields); terr != nil {
+			return internalServerError("Database error updating profile").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserModifiedAction, "", map[string]interface{}{
+			"profile_fields": keys,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	profile := newUserProfile(config, user)
+	profile.User = user
+	return sendJSON(w, http.StatusOK, profile)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingProfileFields(t *testing.T) {
+	config := &conf.Configuration{}
+	config.Profile.RequiredFields = conf.RequiredProfileFields{"app": {"first_name", "company", "age"}}
+
+	user := &models.User{Aud: "app", UserMetaData: map[string]interface{}{
+		"first_name": "Ada",
+		"company":    "  ",
+		"age":        0,
+	}}
+	assert.Equal(t, []string{"company"}, missingProfileFields(config, user))
+
+	user.UserMetaData = nil
+	assert.Equal(t, []string{"first_name", "company", "age"}, missingProfileFields(config, user))
+
+	user.Aud = "other"
+	assert.Nil(t, missingProfileFields(config, user))
+}
+
+func (ts *UserTestSuite) TestUserProfileUpdate() {
+	ts.Config.Profile.RequiredFields = conf.RequiredProfileFields{ts.Config.JWT.Aud: {"first_name", "company"}}
+	defer func() { ts.Config.Profile.RequiredFields = nil }()
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	token, err := generateAccessToken(u, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	update := func(fields map[string]interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(fields))
+		req := httptest.NewRequest(http.MethodPut, "http://localhost/user/profile", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// only required fields may be set
+	w := update(map[string]interface{}{"first_name": "Ada", "role": "admin"})
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = update(map[string]interface{}{"first_name": "Ada"})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	profile := UserProfile{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&profile))
+	assert.Equal(ts.T(), []string{"company"}, profile.MissingFields)
+
+	// the token response hints the missing fields until they are filled in
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "password",
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	tokenResponse := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&tokenResponse))
+	assert.Equal(ts.T(), []string{"company"}, tokenResponse.MissingFields)
+
+	w = update(map[string]interface{}{"company": "Netlify"})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	profile = UserProfile{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&profile))
+	assert.Empty(ts.T(), profile.MissingFields)
+	assert.Equal(ts.T(), "Netlify", profile.User.UserMetaData["company"])
+}
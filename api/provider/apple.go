@@ -7,12 +7,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/golang-jwt/jwt"
-	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/netlify/gotrue/conf"
 	"golang.org/x/oauth2"
 )
@@ -136,7 +134,7 @@ func (p AppleProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*Use
 			}
 
 			// get the public key for verifying the identity token signature
-			set, err := jwk.FetchHTTP(p.UserInfoURL, jwk.WithHTTPClient(http.DefaultClient))
+			set, err := getJWKS(ctx, p.UserInfoURL, kid)
 			if err != nil {
 				return nil, err
 			}
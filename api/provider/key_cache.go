@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/metering"
+)
+
+const (
+	defaultKeyCacheTTL = time.Hour
+	// keyRefetchInterval limits how often an unknown key ID can make the
+	// keys be fetched again, so that tokens with made up key IDs don't turn
+	// into requests to the provider.
+	keyRefetchInterval = 10 * time.Second
+)
+
+var (
+	jwksCache = newKeyCache("jwks")
+	oidcCache = newKeyCache("oidc_provider")
+)
+
+// SetKeyCacheTTL sets how long the key sets and discovery documents of
+// providers are used before they are refreshed in the background.
+func SetKeyCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultKeyCacheTTL
+	}
+	jwksCache.setTTL(ttl)
+	oidcCache.setTTL(ttl)
+}
+
+// getJWKS returns the cached JSON Web Key Set at url. The set is fetched
+// again right away when it lacks the key kid.
+func getJWKS(ctx context.Context, url, kid string) (*jwk.Set, error) {
+	set, err := jwksCache.get(ctx, url, func(v interface{}) bool {
+		return hasKey(v.(*jwk.Set), kid)
+	}, func(ctx context.Context) (interface{}, error) {
+		return fetchJWKS(ctx, url)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set.(*jwk.Set), nil
+}
+
+func hasKey(set *jwk.Set, kid string) bool {
+	if kid == "" {
+		return len(set.Keys) > 0
+	}
+	return len(set.LookupKeyID(kid)) > 0
+}
+
+// OIDCProvider returns the cached OpenID Connect provider of issuer. The
+// provider fetches its keys again by itself when it meets an unknown key ID.
+func OIDCProvider(issuer string) (*oidc.Provider, error) {
+	provider, err := oidcCache.get(context.Background(), issuer, nil, func(ctx context.Context) (interface{}, error) {
+		// the provider keeps this context to fetch its keys later on, so it
+		// can't be the one of the request
+		return oidc.NewProvider(oidc.ClientContext(ctx, retryingClient()), issuer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return provider.(*oidc.Provider), nil
+}
+
+var remoteKeySets sync.Map
+
+// RemoteKeySet returns the key set at url, for issuers that don't publish a
+// discovery document. It fetches the keys again when it meets an unknown
+// key ID.
+func RemoteKeySet(url string) oidc.KeySet {
+	if keySet, ok := remoteKeySets.Load(url); ok {
+		return keySet.(oidc.KeySet)
+	}
+	keySet, _ := remoteKeySets.LoadOrStore(url, oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), retryingClient()), url))
+	return keySet.(oidc.KeySet)
+}
+
+// keyCache keeps what is fetched from providers to validate their tokens.
+// Entries older than the TTL are still used while they are refreshed in the
+// background.
+type keyCache struct {
+	name string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*keyCacheEntry
+}
+
+type keyCacheEntry struct {
+	// fetching serializes the fetches of the entry
+	fetching sync.Mutex
+
+	value       interface{}
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	refreshing  bool
+	hits        int
+}
+
+func newKeyCache(name string) *keyCache {
+	return &keyCache{
+		name:    name,
+		now:     time.Now,
+		ttl:     defaultKeyCacheTTL,
+		entries: make(map[string]*keyCacheEntry),
+	}
+}
+
+func (c *keyCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+func (c *keyCache) entry(key string) *keyCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &keyCacheEntry{}
+		c.entries[key] = e
+	}
+	return e
+}
+
+// get returns the value of key, fetching it when it isn't cached or when
+// valid rejects the cached one.
+func (c *keyCache) get(ctx context.Context, key string, valid func(interface{}) bool, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	e := c.entry(key)
+	if v, ok := c.cached(key, e, valid, fetch); ok {
+		return v, nil
+	}
+
+	e.fetching.Lock()
+	defer e.fetching.Unlock()
+	// a concurrent request may have fetched it in the meantime
+	if v, ok := c.cached(key, e, valid, fetch); ok {
+		return v, nil
+	}
+
+	c.mu.Lock()
+	stale, attemptedAt := e.value, e.attemptedAt
+	c.mu.Unlock()
+	reason := "miss"
+	if stale != nil {
+		if c.now().Sub(attemptedAt) < keyRefetchInterval {
+			return stale, nil
+		}
+		reason = "unknown_kid"
+	}
+	v, err := c.fetch(ctx, key, e, reason, fetch)
+	if err != nil && stale == nil {
+		// don't keep entries for keys that could never be fetched
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	return v, err
+}
+
+// cached returns the cached value if it's valid, and starts refreshing it
+// when it has expired.
+func (c *keyCache) cached(key string, e *keyCacheEntry, valid func(interface{}) bool, fetch func(context.Context) (interface{}, error)) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.value == nil || (valid != nil && !valid(e.value)) {
+		return nil, false
+	}
+	e.hits++
+	now := c.now()
+	if now.Sub(e.fetchedAt) >= c.ttl && now.Sub(e.attemptedAt) >= keyRefetchInterval && !e.refreshing {
+		e.refreshing = true
+		go c.refresh(key, e, fetch)
+	}
+	return e.value, true
+}
+
+func (c *keyCache) refresh(key string, e *keyCacheEntry, fetch func(context.Context) (interface{}, error)) {
+	e.fetching.Lock()
+	defer e.fetching.Unlock()
+	// the stale value is kept when the refresh fails, and a later request
+	// tries again
+	_, _ = c.fetch(context.Background(), key, e, "expired", fetch)
+	c.mu.Lock()
+	e.refreshing = false
+	c.mu.Unlock()
+}
+
+func (c *keyCache) fetch(ctx context.Context, key string, e *keyCacheEntry, reason string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	v, err := fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	metering.RecordKeyCacheFetch(c.name, key, reason, e.hits, err)
+	e.attemptedAt = c.now()
+	if err != nil {
+		return nil, err
+	}
+	e.value = v
+	e.fetchedAt = c.now()
+	e.hits = 0
+	return v, nil
+}
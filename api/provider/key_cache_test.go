@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves a key set with the key IDs in kids, counting requests.
+func jwksServer(t *testing.T, kids *atomic.Value, requests *int32) *httptest.Server {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		set := jwk.Set{}
+		for _, kid := range kids.Load().([]string) {
+			key, err := jwk.New(&priv.PublicKey)
+			require.NoError(t, err)
+			require.NoError(t, key.Set(jwk.KeyIDKey, kid))
+			set.Keys = append(set.Keys, key)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(set))
+	}))
+}
+
+func TestKeyCacheUnknownKid(t *testing.T) {
+	kids := &atomic.Value{}
+	kids.Store([]string{"one"})
+	var requests int32
+	server := jwksServer(t, kids, &requests)
+	defer server.Close()
+
+	now := time.Now()
+	cache := newKeyCache("test")
+	cache.now = func() time.Time { return now }
+	get := func(kid string) (*jwk.Set, error) {
+		v, err := cache.get(context.Background(), server.URL, func(v interface{}) bool {
+			return hasKey(v.(*jwk.Set), kid)
+		}, func(ctx context.Context) (interface{}, error) {
+			return fetchJWKS(ctx, server.URL)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.(*jwk.Set), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		set, err := get("one")
+		require.NoError(t, err)
+		assert.True(t, hasKey(set, "one"))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// rotated keys are only fetched again after the refetch interval
+	kids.Store([]string{"one", "two"})
+	set, err := get("two")
+	require.NoError(t, err)
+	assert.False(t, hasKey(set, "two"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	now = now.Add(keyRefetchInterval)
+	set, err = get("two")
+	require.NoError(t, err)
+	assert.True(t, hasKey(set, "two"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestKeyCacheRefreshesExpiredEntries(t *testing.T) {
+	kids := &atomic.Value{}
+	kids.Store([]string{"one"})
+	var requests int32
+	server := jwksServer(t, kids, &requests)
+	defer server.Close()
+
+	now := time.Now()
+	cache := newKeyCache("test")
+	cache.now = func() time.Time { return now }
+	cache.setTTL(time.Minute)
+	fetches := make(chan struct{}, 2)
+	get := func() (*jwk.Set, error) {
+		v, err := cache.get(context.Background(), server.URL, nil, func(ctx context.Context) (interface{}, error) {
+			defer func() { fetches <- struct{}{} }()
+			return fetchJWKS(ctx, server.URL)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.(*jwk.Set), nil
+	}
+
+	_, err := get()
+	require.NoError(t, err)
+	<-fetches
+
+	// the expired set is still served while it is refreshed
+	kids.Store([]string{"two"})
+	now = now.Add(time.Minute)
+	set, err := get()
+	require.NoError(t, err)
+	assert.True(t, hasKey(set, "one"))
+
+	select {
+	case <-fetches:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expired entry wasn't refreshed")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Eventually(t, func() bool {
+		set, err := get()
+		return err == nil && hasKey(set, "two")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestKeyCacheDropsFailedEntries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	cache := newKeyCache("test")
+	_, err := cache.get(context.Background(), server.URL, nil, func(ctx context.Context) (interface{}, error) {
+		return fetchJWKS(ctx, server.URL)
+	})
+	require.Error(t, err)
+	assert.Empty(t, cache.entries)
+}
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/netlify/gotrue/utilities"
 	"golang.org/x/oauth2"
 )
 
@@ -65,6 +68,27 @@ type Claims struct {
 	UserNameKey string `json:"user_name,omitempty"`
 }
 
+// fetchJWKS fetches the JSON Web Key Set of a provider.
+func fetchJWKS(ctx context.Context, url string) (*jwk.Set, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := retryingClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s (status = %d)", url, res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return jwk.ParseBytes(body)
+}
+
 // ToMap converts the Claims struct to a map[string]interface{}
 func (c *Claims) ToMap() (map[string]interface{}, error) {
 	m := make(map[string]interface{})
@@ -117,10 +141,20 @@ func chooseHost(base, defaultHost string) string {
 	return base
 }
 
+// retryingClient retries the idempotent requests to providers that fail
+// transiently, giving every attempt the default timeout. Every attempt is
+// traced.
+func retryingClient() *http.Client {
+	return &http.Client{Transport: utilities.NewRetryTransport(utilities.NewTracingTransport(nil), defaultTimeout)}
+}
+
 func makeRequest(ctx context.Context, tok *oauth2.Token, g *oauth2.Config, url string, dst interface{}) error {
-	client := g.Client(ctx, tok)
-	client.Timeout = defaultTimeout
-	res, err := client.Get(url)
+	client := g.Client(context.WithValue(ctx, oauth2.HTTPClient, retryingClient()), tok)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -38,11 +38,13 @@ type ConfigX509KeyStore struct {
 	Conf       conf.SamlProviderConfiguration
 }
 
-func getMetadata(url string) (*types.EntityDescriptor, error) {
+// FetchSamlMetadata fetches and parses the metadata of an identity provider.
+func FetchSamlMetadata(url string) (*types.EntityDescriptor, error) {
 	res, err := http.Get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode >= 300 {
 		return nil, fmt.Errorf("Request failed with status %s", res.Status)
@@ -53,17 +55,39 @@ func getMetadata(url string) (*types.EntityDescriptor, error) {
 		return nil, err
 	}
 
+	// TODO: cache in memory
+
+	return ParseSamlMetadata(rawMetadata)
+}
+
+// ParseSamlMetadata parses the metadata of an identity provider and checks
+// that it can be signed in with.
+func ParseSamlMetadata(rawMetadata []byte) (*types.EntityDescriptor, error) {
 	metadata := &types.EntityDescriptor{}
-	err = xml.Unmarshal(rawMetadata, metadata)
-	if err != nil {
+	if err := xml.Unmarshal(rawMetadata, metadata); err != nil {
+		return nil, err
+	}
+	if metadata.EntityID == "" {
+		return nil, errors.New("Metadata has no entity ID")
+	}
+	if metadata.IDPSSODescriptor == nil {
+		return nil, errors.New("Metadata has no IDPSSODescriptor")
+	}
+	if _, err := redirectSSOService(metadata); err != nil {
 		return nil, err
 	}
-
-	// TODO: cache in memory
-
 	return metadata, nil
 }
 
+func redirectSSOService(meta *types.EntityDescriptor) (*types.SingleSignOnService, error) {
+	for _, service := range meta.IDPSSODescriptor.SingleSignOnServices {
+		if service.Binding == "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" {
+			return &service, nil
+		}
+	}
+	return nil, errors.New("No valid SSO service found in IDP metadata")
+}
+
 // NewSamlProvider creates a Saml account provider.
 func NewSamlProvider(ext conf.SamlProviderConfiguration, db *storage.Connection, instanceId uuid.UUID) (*SamlProvider, error) {
 	if !ext.Enabled {
@@ -74,27 +98,29 @@ func NewSamlProvider(ext conf.SamlProviderConfiguration, db *storage.Connection,
 		return nil, fmt.Errorf("Metadata URL is invalid: %+v", err)
 	}
 
-	meta, err := getMetadata(ext.MetadataURL)
+	meta, err := FetchSamlMetadata(ext.MetadataURL)
 	if err != nil {
 		return nil, fmt.Errorf("Fetching metadata failed: %+v", err)
 	}
 
+	return NewSamlProviderWithMetadata(ext, meta, db, instanceId)
+}
+
+// NewSamlProviderWithMetadata creates a Saml account provider for the
+// identity provider described by meta. The service provider settings are
+// taken from ext.
+func NewSamlProviderWithMetadata(ext conf.SamlProviderConfiguration, meta *types.EntityDescriptor, db *storage.Connection, instanceId uuid.UUID) (*SamlProvider, error) {
 	baseURI, err := url.Parse(strings.Trim(ext.APIBase, "/"))
 	if err != nil || ext.APIBase == "" {
 		return nil, fmt.Errorf("Invalid API base URI: %s", ext.APIBase)
 	}
 
-	var ssoService types.SingleSignOnService
-	foundService := false
-	for _, service := range meta.IDPSSODescriptor.SingleSignOnServices {
-		if service.Binding == "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" {
-			ssoService = service
-			foundService = true
-			break
-		}
+	if meta.IDPSSODescriptor == nil {
+		return nil, errors.New("Metadata has no IDPSSODescriptor")
 	}
-	if !foundService {
-		return nil, errors.New("No valid SSO service found in IDP metadata")
+	ssoService, err := redirectSSOService(meta)
+	if err != nil {
+		return nil, err
 	}
 
 	certStore := dsig.MemoryX509CertificateStore{
@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcSSOProvider signs users in at an OIDC provider added with the admin API.
+type oidcSSOProvider struct {
+	*oauth2.Config
+	Issuer           string
+	Provider         *oidc.Provider
+	AttributeMapping map[string]interface{}
+}
+
+// NewOIDCSSOProvider creates an account provider for the OIDC provider at
+// issuer, which is discovered from its well-known configuration.
+func NewOIDCSSOProvider(issuer, clientID, clientSecret, redirectURI, scopes string, mapping map[string]interface{}) (OAuthProvider, error) {
+	if issuer == "" || clientID == "" {
+		return nil, errors.New("Missing issuer or client ID of the OIDC provider")
+	}
+
+	p, err := OIDCProvider(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("Discovering OIDC provider failed: %+v", err)
+	}
+
+	oauthScopes := []string{
+		oidc.ScopeOpenID,
+		"profile",
+		"email",
+	}
+	if scopes != "" {
+		oauthScopes = append(oauthScopes, strings.Split(scopes, ",")...)
+	}
+
+	return &oidcSSOProvider{
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     p.Endpoint(),
+			RedirectURL:  redirectURI,
+			Scopes:       oauthScopes,
+		},
+		Issuer:           issuer,
+		Provider:         p,
+		AttributeMapping: mapping,
+	}, nil
+}
+
+func (g oidcSSOProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	return g.Exchange(oauth2.NoContext, code)
+}
+
+func (g oidcSSOProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	userInfo, err := g.Provider.UserInfo(oidc.ClientContext(ctx, retryingClient()), oauth2.StaticTokenSource(tok))
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]interface{}{}
+	if err := userInfo.Claims(&attributes); err != nil {
+		return nil, err
+	}
+
+	claims, err := MapAttributes(g.AttributeMapping, attributes)
+	if err != nil {
+		return nil, err
+	}
+	claims.Issuer = g.Issuer
+	if claims.Subject == "" {
+		claims.Subject = userInfo.Subject
+	}
+	if claims.Email == "" {
+		return nil, errors.New("Unable to find email with OIDC provider")
+	}
+
+	return &UserProvidedData{
+		Metadata: claims,
+		Emails: []Email{{
+			Email:    claims.Email,
+			Verified: claims.EmailVerified,
+			Primary:  true,
+		}},
+	}, nil
+}
+
+// MapAttributes turns the attributes of a user at an SSO provider into claims.
+// The mapping names the attribute each claim is taken from, claims that are
+// not mapped are taken from the attribute of the same name.
+func MapAttributes(mapping map[string]interface{}, attributes map[string]interface{}) (*Claims, error) {
+	mapped := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		mapped[name] = value
+	}
+	for claim, attribute := range mapping {
+		name, ok := attribute.(string)
+		if !ok {
+			return nil, fmt.Errorf("Attribute mapping of %s is not a string", claim)
+		}
+		if value, ok := attributes[name]; ok {
+			mapped[claim] = value
+		}
+	}
+
+	data, err := json.Marshal(mapped)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, fmt.Errorf("Mapping attributes failed: %+v", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	rateLimitClientKeyHeader = "X-Client-Api-Key"
+)
+
+// rateLimiter is a keyed token bucket limiter. It replaces tollbooth because
+// neither tollbooth nor the golang.org/x/time/rate version it pins expose the
+// tokens left in a bucket, which the RateLimit-Remaining and RateLimit-Reset
+// headers are computed from. It keeps tollbooth's behaviour otherwise: buckets
+// start full and are dropped after not being used for ttl.
+type rateLimiter struct {
+	rate  float64 // tokens added per second
+	burst int
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitResult describes the state of a bucket after a request was counted.
+type rateLimitResult struct {
+	allowed   bool
+	limit     int
+	remaining int
+	reset     time.Duration
+}
+
+func newRateLimiter(rate float64, burst int, ttl time.Duration) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     burst,
+		ttl:       ttl,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take consumes a token for key. The multiplier scales both the rate and the
+// burst, so trusted clients can be given a larger quota.
+func (l *rateLimiter) take(key string, multiplier float64) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	rate := l.rate * multiplier
+	burst := float64(l.burst) * multiplier
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := rateLimitResult{limit: int(burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	}
+	result.remaining = int(b.tokens)
+	if rate > 0 {
+		if result.allowed {
+			// time until the bucket is full again
+			result.reset = time.Duration((burst - b.tokens) / rate * float64(time.Second))
+		} else {
+			// time until the next request is allowed
+			result.reset = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		}
+	}
+
+	if now.Sub(l.lastSweep) > l.ttl {
+		for k, other := range l.buckets {
+			if now.Sub(other.last) > l.ttl {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	return result
+}
+
+// setHeaders adds the RateLimit-* headers describing the result to the response.
+func (r rateLimitResult) setHeaders(w http.ResponseWriter) {
+	w.Header().Set(rateLimitLimitHeader, strconv.Itoa(r.limit))
+	w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(r.remaining))
+	w.Header().Set(rateLimitResetHeader, strconv.Itoa(int(math.Ceil(r.reset.Seconds()))))
+	if !r.allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(r.reset.Seconds()))))
+	}
+}
+
+// rateLimitClient returns the bucket key prefix and quota multiplier for
+// trusted server-side callers identified by their API key.
+func (a *API) rateLimitClient(req *http.Request) (string, float64, bool) {
+	key := req.Header.Get(rateLimitClientKeyHeader)
+	if key == "" {
+		return "", 0, false
+	}
+	for name, client := range a.config.RateLimitClients {
+		if subtle.ConstantTimeCompare([]byte(client.Key), []byte(key)) == 1 {
+			return name, client.Multiplier, true
+		}
+	}
+	return "", 0, false
+}
+
+// rateLimit counts the request against lmt and sets the rate limit headers.
+func (a *API) rateLimit(lmt *rateLimiter, w http.ResponseWriter, req *http.Request, key string) error {
+	multiplier := 1.0
+	if name, clientMultiplier, ok := a.rateLimitClient(req); ok {
+		if clientMultiplier == 0 {
+			// unlimited client, negative multipliers are rejected when loading the config
+			return nil
+		}
+		key = "client:" + name
+		multiplier = clientMultiplier
+	}
+
+	result := lmt.take(key, multiplier)
+	result.setHeaders(w)
+	if !result.allowed {
+		return tooManyRequestsError("Rate limit exceeded")
+	}
+	return nil
+}
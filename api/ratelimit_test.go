@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	a := &API{config: &conf.GlobalConfiguration{}}
+	lmt := newRateLimiter(1, 2, time.Hour)
+
+	for i := 1; i >= 0; i-- {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/token", nil)
+		require.NoError(t, a.rateLimit(lmt, w, req, "1.2.3.4"))
+		assert.Equal(t, "2", w.Header().Get(rateLimitLimitHeader))
+		assert.Equal(t, strconv.Itoa(i), w.Header().Get(rateLimitRemainingHeader))
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	err := a.rateLimit(lmt, w, req, "1.2.3.4")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, err.(*HTTPError).Code)
+	assert.Equal(t, "0", w.Header().Get(rateLimitRemainingHeader))
+	assert.Equal(t, "1", w.Header().Get(rateLimitResetHeader))
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimitClientOverrides(t *testing.T) {
+	a := &API{config: &conf.GlobalConfiguration{
+		RateLimitClients: conf.RateLimitClients{
+			"billing": {Key: "billing-key", Multiplier: 10},
+			"jobs":    {Key: "jobs-key", Multiplier: 0},
+		},
+	}}
+	lmt := newRateLimiter(1, 2, time.Hour)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	req.Header.Set(rateLimitClientKeyHeader, "billing-key")
+	require.NoError(t, a.rateLimit(lmt, w, req, "1.2.3.4"))
+	assert.Equal(t, "20", w.Header().Get(rateLimitLimitHeader))
+
+	for i := 0; i < 50; i++ {
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, "/token", nil)
+		req.Header.Set(rateLimitClientKeyHeader, "jobs-key")
+		require.NoError(t, a.rateLimit(lmt, w, req, "1.2.3.4"))
+	}
+
+	// an unknown key is limited like any other caller
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/token", nil)
+	req.Header.Set(rateLimitClientKeyHeader, "unknown")
+	require.NoError(t, a.rateLimit(lmt, w, req, "1.2.3.4"))
+	assert.Equal(t, "2", w.Header().Get(rateLimitLimitHeader))
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -26,7 +27,7 @@ func (a *API) Reauthenticate(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return badRequestError("Could not read User ID claim")
 	}
-	user, err := models.FindUserByID(a.db, userID)
+	user, err := models.FindUserByID(a.getDB(ctx), userID)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			return notFoundError(err.Error())
@@ -50,13 +51,13 @@ func (a *API) Reauthenticate(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserReauthenticateAction, "", nil); terr != nil {
 			return terr
 		}
 		if email != "" {
 			mailer := a.Mailer(ctx)
-			return a.sendReauthenticationOtp(tx, user, mailer, config.SMTP.MaxFrequency, config.Mailer.OtpLength)
+			return a.sendReauthenticationOtp(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.ReauthenticationEmail), config.Mailer.OtpLength)
 		} else if phone != "" {
 			smsProvider, terr := sms_provider.GetSmsProvider(*config)
 			if terr != nil {
@@ -68,7 +69,7 @@ func (a *API) Reauthenticate(w http.ResponseWriter, r *http.Request) error {
 	})
 	if err != nil {
 		if errors.Is(err, MaxFrequencyLimitError) {
-			return tooManyRequestsError("For security purposes, you can only request this once every 60 seconds")
+			return frequencyLimitedError(w, err)
 		}
 		return err
 	}
@@ -77,10 +78,13 @@ func (a *API) Reauthenticate(w http.ResponseWriter, r *http.Request) error {
 }
 
 // verifyReauthentication checks if the nonce provided is valid
-func (a *API) verifyReauthentication(nonce string, tx *storage.Connection, config *conf.Configuration, user *models.User) error {
+func (a *API) verifyReauthentication(ctx context.Context, nonce string, tx *storage.Connection, config *conf.Configuration, user *models.User) error {
 	if user.ReauthenticationToken == "" || user.ReauthenticationSentAt == nil {
 		return badRequestError(InvalidNonceMessage)
 	}
+	if err := a.checkOtpLocked(ctx, config, user, models.ReauthenticationChallenge, user.ReauthenticationSentAt); err != nil {
+		return err
+	}
 	var isValid bool
 	if user.GetEmail() != "" {
 		tokenHash := fmt.Sprintf("%x", sha256.Sum224([]byte(user.GetEmail()+nonce)))
@@ -92,6 +96,7 @@ func (a *API) verifyReauthentication(nonce string, tx *storage.Connection, confi
 		return unprocessableEntityError("Reauthentication requires an email or a phone number")
 	}
 	if !isValid {
+		a.recordFailedOtp(ctx, config, user, models.ReauthenticationChallenge, user.ReauthenticationSentAt)
 		return badRequestError(InvalidNonceMessage)
 	}
 	if err := user.ConfirmReauthentication(tx); err != nil {
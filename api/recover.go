@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/netlify/gotrue/api/sms_provider"
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
 )
@@ -12,9 +14,12 @@ import (
 // RecoverParams holds the parameters for a password recovery request
 type RecoverParams struct {
 	Email string `json:"email"`
+	Phone string `json:"phone"`
+	// Type recovery_otp emails a code instead of a link
+	Type string `json:"type"`
 }
 
-// Recover sends a recovery email
+// Recover sends a recovery email, or a recovery otp by sms to a phone number
 func (a *API) Recover(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	config := a.getConfig(ctx)
@@ -26,17 +31,28 @@ func (a *API) Recover(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Could not read verification params: %v", err)
 	}
 
+	var user *models.User
+	aud := a.requestAud(ctx, r)
+	if params.Email != "" && params.Phone != "" {
+		return unprocessableEntityError("Only an email address or phone number should be provided")
+	}
+	if params.Phone != "" {
+		return a.recoverPhone(w, r, params, aud)
+	}
+	if config.Sms.IsWhatsappAudience(aud) {
+		return phoneOnlyError(aud)
+	}
 	if params.Email == "" {
 		return unprocessableEntityError("Password recovery requires an email")
 	}
-
-	var user *models.User
-	aud := a.requestAud(ctx, r)
+	if params.Type != "" && params.Type != recoveryOtpVerification {
+		return unprocessableEntityError("Unsupported recovery type")
+	}
 
 	if err := a.validateEmail(ctx, params.Email); err != nil {
 		return err
 	}
-	user, err = models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+	user, err = models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, aud)
 
 	if err != nil {
 		if models.IsNotFoundError(err) {
@@ -45,20 +61,72 @@ func (a *API) Recover(w http.ResponseWriter, r *http.Request) error {
 		return internalServerError("Unable to process request").WithInternalError(err)
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserRecoveryRequestedAction, "", nil); terr != nil {
 			return terr
 		}
 		mailer := a.Mailer(ctx)
+		if params.Type == recoveryOtpVerification {
+			return a.sendPasswordRecoveryCode(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.RecoveryEmail), config.Mailer.OtpLength)
+		}
 		referrer := a.getReferrer(r)
-		return a.sendPasswordRecovery(tx, user, mailer, config.SMTP.MaxFrequency, referrer, config.Mailer.OtpLength)
+		return a.sendPasswordRecovery(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.RecoveryEmail), referrer, config.Mailer.OtpLength)
 	})
 	if err != nil {
 		if errors.Is(err, MaxFrequencyLimitError) {
-			return tooManyRequestsError("For security purposes, you can only request this once every 60 seconds")
+			return frequencyLimitedError(w, err)
+		}
+		return internalServerError("Unable to process request").WithInternalError(err)
+	}
+	a.emitLifecycleEvent(ctx, PasswordRecoveryEvent, user)
+
+	return sendJSON(w, http.StatusOK, map[string]string{})
+}
+
+// recoverPhone sends a recovery otp to the phone number of the user, which
+// signs them in with POST /verify so they can set a new password.
+func (a *API) recoverPhone(w http.ResponseWriter, r *http.Request, params *RecoverParams, aud string) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.External.Phone.Enabled {
+		return badRequestError("Phone logins are disabled")
+	}
+	phone, err := a.validatePhone(params.Phone)
+	if err != nil {
+		return err
+	}
+	user, err := models.FindUserByPhoneAndAudience(a.getDB(ctx), instanceID, phone, aud)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return sendJSON(w, http.StatusOK, map[string]string{})
 		}
 		return internalServerError("Unable to process request").WithInternalError(err)
 	}
 
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserRecoveryRequestedAction, "", map[string]interface{}{
+			"provider": "phone",
+		}); terr != nil {
+			return terr
+		}
+		smsProvider, terr := sms_provider.GetSmsProvider(*config)
+		if terr != nil {
+			return badRequestError("Error sending recovery sms: %v", terr)
+		}
+		return a.sendPhoneConfirmation(ctx, tx, user, phone, phoneRecoveryOtp, smsProvider)
+	})
+	if err != nil {
+		if errors.Is(err, MaxFrequencyLimitError) {
+			return frequencyLimitedError(w, err)
+		}
+		if _, ok := err.(*HTTPError); ok {
+			return err
+		}
+		return badRequestError("Error sending recovery sms: %v", err)
+	}
+	a.emitLifecycleEvent(ctx, PasswordRecoveryEvent, user)
+
 	return sendJSON(w, http.StatusOK, map[string]string{})
 }
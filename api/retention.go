@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// applyRetention deletes the audit log entries, email records, security
+// events and sessions older than the RETENTION_* days of the instance.
+func (a *API) applyRetention(ctx context.Context) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	retention := config.Retention
+
+	categories := []struct {
+		name   string
+		days   int
+		delete func(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error)
+	}{
+		{"audit_log", retention.AuditLogDays, func(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error) {
+			return models.DeleteAuditLogEntriesBefore(tx, instanceID, cutoff, false, limit)
+		}},
+		{"email_records", retention.EmailRecordDays, func(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error) {
+			return models.DeleteAuditLogEntriesBefore(tx, instanceID, cutoff, true, limit)
+		}},
+		{"security_events", retention.SecurityEventDays, models.DeleteSecurityEventsBefore},
+		{"sessions", retention.SessionDays, models.DeleteSessionsBefore},
+		// refresh tokens issued before sessions have none
+		{"refresh_tokens", retention.SessionDays, models.DeleteRefreshTokensBefore},
+		{"signed_out_tokens", retention.SessionDays, models.DeleteSignedOutTokensBefore},
+	}
+
+	for _, category := range categories {
+		if category.days <= 0 {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -category.days)
+		total := 0
+		for {
+			count, err := category.delete(a.db, instanceID, cutoff, jobBatchSize)
+			if err != nil {
+				return err
+			}
+			total += count
+			if count < jobBatchSize {
+				break
+			}
+		}
+		if total > 0 {
+			logrus.WithFields(logrus.Fields{
+				"component":   "retention",
+				"instance_id": instanceID,
+				"category":    category.name,
+				"deleted":     total,
+			}).Info("Deleted records past their retention")
+		}
+	}
+	return nil
+}
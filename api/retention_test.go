@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetentionTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestRetention(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &RetentionTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *RetentionTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+}
+
+func (ts *RetentionTestSuite) TestApplyRetention() {
+	ts.Config.Retention = conf.RetentionConfiguration{AuditLogDays: 30, EmailRecordDays: 90, SecurityEventDays: 7}
+	defer func() {
+		ts.Config.Retention = conf.RetentionConfiguration{}
+	}()
+
+	u, err := models.NewUser(ts.instanceID, "", "test@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	_, err = models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
+	require.NoError(ts.T(), err)
+
+	age := func(table string, days int) {
+		require.NoError(ts.T(), ts.API.db.RawQuery("UPDATE "+table+" SET created_at = ? WHERE instance_id = ?", time.Now().AddDate(0, 0, -days), ts.instanceID).Exec())
+	}
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, u, models.LoginAction, "", nil))
+	require.NoError(ts.T(), models.NewAuditLogEntry(nil, ts.API.db, ts.instanceID, u, models.UserRecoveryRequestedAction, "", nil))
+	age("audit_log_entries", 60)
+	event, err := models.NewSecurityEvent(u, models.SignInSecurityEvent, "", "", nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(event))
+	age("security_events", 10)
+
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.applyRetention(ctx))
+
+	// the email record is kept for longer than the rest of the audit log
+	entries, err := models.FindAuditLogEntries(ts.API.db, ts.instanceID, nil, "", nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), entries, 1)
+	assert.Equal(ts.T(), string(models.UserRecoveryRequestedAction), entries[0].Payload["action"])
+
+	count, err := ts.API.db.Q().Where("user_id = ?", u.ID).Count(&models.SecurityEvent{})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 0, count)
+
+	// sessions are kept when their retention isn't set
+	count, err = ts.API.db.Q().Where("user_id = ?", u.ID).Count(&models.RefreshToken{})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 1, count)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
+)
+
+// Revoke revokes a refresh token as in RFC 7009, ending the session it belongs
+// to. Holding the refresh token is enough, so a leaked one can be revoked
+// after its access token was lost. Unknown tokens are not an error.
+func (a *API) Revoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		return oauthError("invalid_request", "token required")
+	}
+	// access tokens are JWTs and expire on their own
+	if strings.Count(token, ".") == 2 {
+		return oauthError("unsupported_token_type", "Access tokens can not be revoked, revoke their refresh token instead")
+	}
+
+	user, refreshToken, err := models.FindUserWithRefreshToken(a.getDB(ctx), token)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}
+		return internalServerError("Database error finding refresh token").WithInternalError(err)
+	}
+	if refreshToken.InstanceID != instanceID {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if refreshToken.SessionID.Valid {
+			session, terr := models.FindSessionByID(tx, instanceID, user.ID, refreshToken.SessionID.UUID)
+			if terr == nil {
+				terr = session.Revoke(tx, models.SignOutReasonRevoked)
+			} else if models.IsNotFoundError(terr) {
+				terr = nil
+			}
+			if terr != nil {
+				return terr
+			}
+		} else {
+			refreshToken.Revoked = true
+			if terr := tx.UpdateOnly(refreshToken, "revoked"); terr != nil {
+				return terr
+			}
+			if terr := models.RevokeTokenFamily(tx, refreshToken); terr != nil {
+				return terr
+			}
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, user, models.TokenRevokedAction, utilities.GetIPAddress(r), nil)
+	})
+	if err != nil {
+		return internalServerError("Error revoking refresh token").WithInternalError(err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *TokenTestSuite) TestRevoke() {
+	revoke := func(token string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}, "token_type_hint": {"refresh_token"}}
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// unknown tokens are not an error
+	assert.Equal(ts.T(), http.StatusOK, revoke("unknown").Code)
+	assert.Equal(ts.T(), http.StatusBadRequest, revoke("").Code)
+	assert.Equal(ts.T(), http.StatusBadRequest, revoke("header.payload.signature").Code)
+
+	require.Equal(ts.T(), http.StatusOK, revoke(ts.RefreshToken.Token).Code)
+
+	exists, err := models.SessionExists(ts.API.db, ts.instanceID, ts.RefreshToken.SessionID.UUID)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), exists)
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"refresh_token": ts.RefreshToken.Token,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	// revoking twice is fine
+	assert.Equal(ts.T(), http.StatusOK, revoke(ts.RefreshToken.Token).Code)
+}
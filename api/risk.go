@@ -0,0 +1,211 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/security"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
+	"github.com/sirupsen/logrus"
+)
+
+const RiskAssessmentEvent = "risk_assessment"
+
+// assessRisk scores signup and sign-in requests and enforces the resulting decision.
+func (a *API) assessRisk(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	if !config.Security.Risk.Enabled {
+		return ctx, nil
+	}
+	if r.URL.Query().Get("grant_type") == "refresh_token" {
+		// refreshing a session is not a new sign-in
+		return ctx, nil
+	}
+
+	signals, err := riskSignalsFromRequest(r, config)
+	if err != nil {
+		return nil, err
+	}
+
+	assessment := a.scoreRisk(ctx, config, signals)
+	enforced := enforceableRiskDecision(config, assessment.Decision)
+
+	// the email and phone are supplied by the client, so they are recorded
+	// as traits rather than as the actor of the entry
+	instanceID := getInstanceID(ctx)
+	actor := models.NewSystemUser(instanceID, config.JWT.Aud)
+	if terr := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		return models.NewAuditLogEntry(r, tx, instanceID, actor, models.RiskAssessedAction, signals.IPAddress, map[string]interface{}{
+			"endpoint":          signals.Endpoint,
+			"email":             signals.Email,
+			"phone":             signals.Phone,
+			"score":             assessment.Score,
+			"decision":          assessment.Decision,
+			"enforced_decision": enforced,
+			"reasons":           assessment.Reasons,
+		})
+	}); terr != nil {
+		return nil, internalServerError("Error recording audit log entry").WithInternalError(terr)
+	}
+
+	if enforced == security.RiskBlock {
+		if config.Security.AutoBans.Enabled {
+			a.recordPolicyViolation(ctx, config, a.userFromRiskSignals(ctx, config, signals), models.BanReasonRiskScore, signals.IPAddress)
+		}
+		return nil, forbiddenError("Request blocked")
+	}
+	return ctx, nil
+}
+
+// enforceableRiskDecision maps a decision to one GoTrue can enforce. Multi-factor
+// authentication is not available, so it falls back to a captcha, and a captcha
+// is only required when one is configured, in which case the captcha middleware
+// has already verified the request. Otherwise the request is allowed and the
+// original decision is left in the audit log.
+func enforceableRiskDecision(config *conf.Configuration, decision security.RiskDecision) security.RiskDecision {
+	switch decision {
+	case security.RiskRequireMFA, security.RiskRequireCaptcha:
+		if config.Security.Captcha.Enabled {
+			return security.RiskRequireCaptcha
+		}
+		return security.RiskAllow
+	}
+	return decision
+}
+
+func riskSignalsFromRequest(r *http.Request, config *conf.Configuration) (security.RiskSignals, error) {
+	signals := security.RiskSignals{
+		IPAddress: utilities.GetIPAddress(r),
+		UserAgent: r.UserAgent(),
+		Endpoint:  r.URL.Path,
+	}
+	if config.Security.Risk.ASNHeader != "" {
+		signals.ASN = r.Header.Get(config.Security.Risk.ASNHeader)
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return signals, nil
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return signals, internalServerError("Error invalid request body").WithInternalError(err)
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	params := struct {
+		Email string `json:"email"`
+		Phone string `json:"phone"`
+	}{}
+	// the handler reports malformed bodies, so decoding errors are ignored here
+	_ = json.Unmarshal(bodyBytes, &params)
+	signals.Email = params.Email
+	signals.Phone = params.Phone
+
+	return signals, nil
+}
+
+// scoreRisk asks the configured risk hook for an assessment, falling back to
+// the built-in heuristics when no hook is configured or the hook fails.
+func (a *API) scoreRisk(ctx context.Context, config *conf.Configuration, signals security.RiskSignals) *security.RiskAssessment {
+	riskConfig := config.Security.Risk
+	thresholds := security.RiskThresholds{
+		Captcha: riskConfig.CaptchaThreshold,
+		MFA:     riskConfig.MFAThreshold,
+		Block:   riskConfig.BlockThreshold,
+	}
+
+	if riskConfig.URL != "" {
+		assessment, err := triggerRiskHook(ctx, config, signals)
+		if err == nil {
+			if assessment.Decision == "" {
+				assessment.Decision = thresholds.Decide(assessment.Score)
+			}
+			return assessment
+		}
+		logrus.WithError(err).WithField("url", riskConfig.URL).Warn("Risk hook failed, falling back to built-in heuristics")
+	}
+
+	scorer := &security.HeuristicScorer{
+		DisposableEmailDomains: riskConfig.DisposableEmailDomains,
+		BlockedASNs:            riskConfig.BlockedASNs,
+		VelocityLimit:          riskConfig.VelocityLimit,
+		VelocityWindow:         riskConfig.VelocityWindow,
+		Velocity:               a.riskVelocity,
+	}
+	score, reasons := scorer.Score(signals)
+	return &security.RiskAssessment{
+		Score:    score,
+		Decision: thresholds.Decide(score),
+		Reasons:  reasons,
+	}
+}
+
+func triggerRiskHook(ctx context.Context, config *conf.Configuration, signals security.RiskSignals) (*security.RiskAssessment, error) {
+	instanceID := getInstanceID(ctx)
+	riskConfig := config.Security.Risk
+
+	payload := struct {
+		Event      string               `json:"event"`
+		InstanceID uuid.UUID            `json:"instance_id,omitempty"`
+		Signals    security.RiskSignals `json:"signals"`
+	}{
+		Event:      RiskAssessmentEvent,
+		InstanceID: instanceID,
+		Signals:    signals,
+	}
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return nil, internalServerError("Failed to serialize the data for risk hook").WithInternalError(err)
+	}
+
+	sha, err := checksum(data)
+	if err != nil {
+		return nil, internalServerError("Failed to checksum the data for risk hook").WithInternalError(err)
+	}
+
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{
+			URL:        riskConfig.URL,
+			Retries:    1,
+			TimeoutSec: riskConfig.TimeoutSec,
+		},
+		jwtSecret:  riskConfig.Secret,
+		instanceID: instanceID,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  instanceID.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: data,
+		headers: requestIDHeaders(getRequestID(ctx)),
+	}
+
+	body, err := w.trigger()
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, internalServerError("Risk hook returned an empty response")
+	}
+	defer body.Close()
+
+	assessment := &security.RiskAssessment{}
+	if err := json.NewDecoder(body).Decode(assessment); err != nil {
+		return nil, internalServerError("Risk hook returned malformed JSON: %v", err).WithInternalError(err)
+	}
+	return assessment, nil
+}
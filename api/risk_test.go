@@ -0,0 +1,20 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/security"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceableRiskDecision(t *testing.T) {
+	config := &conf.Configuration{}
+	assert.Equal(t, security.RiskAllow, enforceableRiskDecision(config, security.RiskRequireCaptcha))
+	assert.Equal(t, security.RiskAllow, enforceableRiskDecision(config, security.RiskRequireMFA))
+	assert.Equal(t, security.RiskBlock, enforceableRiskDecision(config, security.RiskBlock))
+
+	config.Security.Captcha.Enabled = true
+	assert.Equal(t, security.RiskRequireCaptcha, enforceableRiskDecision(config, security.RiskRequireCaptcha))
+	assert.Equal(t, security.RiskRequireCaptcha, enforceableRiskDecision(config, security.RiskRequireMFA))
+}
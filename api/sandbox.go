@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/netlify/gotrue/sandbox"
+)
+
+// adminSandboxMessages returns the emails and SMS kept in sandbox mode, only
+// those to the `to` recipient if given, and forgets them.
+func (a *API) adminSandboxMessages(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+	if !config.Sandbox {
+		return notFoundError("Sandbox mode is disabled")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"messages": sandbox.Take(r.URL.Query().Get("to")),
+	})
+}
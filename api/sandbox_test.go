@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/api/sms_provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/sandbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminSandboxMessages(t *testing.T) {
+	config := &conf.Configuration{}
+	api := &API{config: &conf.GlobalConfiguration{}}
+	messages := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/admin/sandbox/messages"+query, nil)
+		req = req.WithContext(withConfig(req.Context(), config))
+		w := httptest.NewRecorder()
+		require.NoError(t, api.adminSandboxMessages(w, req))
+		return w
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/admin/sandbox/messages", nil)
+	req = req.WithContext(withConfig(req.Context(), config))
+	err := api.adminSandboxMessages(httptest.NewRecorder(), req)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(*HTTPError).Code)
+
+	config.Sandbox = true
+	sandbox.Take("")
+	smsProvider, err := sms_provider.GetSmsProvider(*config)
+	require.NoError(t, err)
+	require.NoError(t, smsProvider.SendSms("15555550100", "Your code is 123456"))
+	require.NoError(t, smsProvider.SendSms("15555550199", "Your code is 654321"))
+
+	data := struct {
+		Messages []sandbox.Message `json:"messages"`
+	}{}
+	w := messages("?to=15555550100")
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&data))
+	require.Len(t, data.Messages, 1)
+	assert.Equal(t, sandbox.ChannelSms, data.Messages[0].Channel)
+	assert.Equal(t, "Your code is 123456", data.Messages[0].Body)
+
+	// messages are cleared on read
+	require.NoError(t, json.NewDecoder(messages("?to=15555550100").Body).Decode(&data))
+	assert.Empty(t, data.Messages)
+	require.NoError(t, json.NewDecoder(messages("").Body).Decode(&data))
+	require.Len(t, data.Messages, 1)
+	assert.Equal(t, "15555550199", data.Messages[0].To)
+}
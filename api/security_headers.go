@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/netlify/gotrue/conf"
+)
+
+// defaultHTMLContentSecurityPolicy only lets the HTML pages run their own
+// inline script and call the GoTrue API they are served by.
+const defaultHTMLContentSecurityPolicy = "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; img-src https: http:; connect-src 'self'; form-action 'none'; frame-ancestors 'none'; base-uri 'none'"
+
+// setSecurityHeaders adds the security headers of the instance to responses.
+func (a *API) setSecurityHeaders(w http.ResponseWriter, req *http.Request) (context.Context, error) {
+	ctx := req.Context()
+	config := a.getConfig(ctx)
+	if config == nil || !config.Security.Headers.Enabled {
+		return ctx, nil
+	}
+	headers := config.Security.Headers
+	if headers.HSTSMaxAge > 0 {
+		w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int64(headers.HSTSMaxAge.Seconds())))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", headers.ReferrerPolicy)
+	return ctx, nil
+}
+
+// setHTMLHeaders sets the headers of the HTML pages GoTrue serves. They are
+// never cached and always get a content security policy, as they handle the
+// tokens and passwords of users.
+func setHTMLHeaders(w http.ResponseWriter, config *conf.Configuration) {
+	csp := config.Security.Headers.ContentSecurityPolicy
+	if csp == "" {
+		csp = defaultHTMLContentSecurityPolicy
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", csp)
+	w.Header().Set("Cache-Control", "no-store")
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSecurityHeaders(t *testing.T) {
+	api := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{SiteURL: "https://example.com"}
+	require.NoError(t, config.ApplyDefaults())
+
+	r := newRouter()
+	r.Use(func(w http.ResponseWriter, req *http.Request) (context.Context, error) {
+		return withConfig(req.Context(), config), nil
+	})
+	r.Use(api.setSecurityHeaders)
+	r.Get("/settings", func(w http.ResponseWriter, r *http.Request) error {
+		return sendJSON(w, http.StatusOK, map[string]string{})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+
+	config.Security.Headers.Enabled = true
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+
+	config.Security.Headers.HSTSMaxAge = time.Hour
+	config.Security.Headers.ReferrerPolicy = "same-origin"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	assert.Equal(t, "max-age=3600; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "same-origin", w.Header().Get("Referrer-Policy"))
+}
+
+func TestSetHTMLHeaders(t *testing.T) {
+	config := &conf.Configuration{}
+	w := httptest.NewRecorder()
+	setHTMLHeaders(w, config)
+	assert.Equal(t, defaultHTMLContentSecurityPolicy, w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	config.Security.Headers.ContentSecurityPolicy = "default-src 'self'"
+	w = httptest.NewRecorder()
+	setHTMLHeaders(w, config)
+	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+}
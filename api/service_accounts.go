@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/logger"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const serviceAccountProvider = "service_account"
+
+type adminServiceAccountParams struct {
+	Name             string `json:"name"`
+	Role             string `json:"role"`
+	RegenerateSecret bool   `json:"regenerate_secret"`
+}
+
+// adminServiceAccountResponse includes the secret, which is only returned when it is generated
+type adminServiceAccountResponse struct {
+	*models.ServiceAccount
+	Secret string `json:"secret,omitempty"`
+}
+
+// ClientCredentialsGrantParams are the parameters the ClientCredentialsGrant method accepts
+type ClientCredentialsGrantParams struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// serviceAccountActor is how a service account appears in the audit log.
+func serviceAccountActor(account *models.ServiceAccount) *models.User {
+	return &models.User{
+		InstanceID: account.InstanceID,
+		ID:         account.ID,
+		Role:       account.Role,
+		Email:      storage.NullString(account.Name),
+	}
+}
+
+func validateServiceAccountRole(config *conf.Configuration, role string) error {
+	if role == "" {
+		return unprocessableEntityError("Service accounts require a role")
+	}
+	allowed := config.ServiceAccounts.AllowedRoles
+	if len(allowed) > 0 && !isStringInSlice(role, allowed) {
+		return unprocessableEntityError("Role %q is not allowed for service accounts", role)
+	}
+	return nil
+}
+
+func (a *API) loadServiceAccount(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	accountID, err := uuid.FromString(chi.URLParam(r, "service_account_id"))
+	if err != nil {
+		return nil, badRequestError("service_account_id must be an UUID")
+	}
+
+	logger.LogEntrySetField(r, "service_account_id", accountID)
+	instanceID := getInstanceID(r.Context())
+
+	account, err := models.FindServiceAccount(a.getDB(r.Context()), instanceID, accountID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Service account not found")
+		}
+		return nil, internalServerError("Database error loading service account").WithInternalError(err)
+	}
+
+	return withServiceAccount(r.Context(), account), nil
+}
+
+func (a *API) getAdminServiceAccountParams(r *http.Request) (*adminServiceAccountParams, error) {
+	params := adminServiceAccountParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return nil, badRequestError("Could not decode service account params: %v", err)
+	}
+	return &params, nil
+}
+
+// adminServiceAccounts responds with the service accounts of the instance
+func (a *API) adminServiceAccounts(w http.ResponseWriter, r *http.Request) error {
+	instanceID := getInstanceID(r.Context())
+
+	accounts, err := models.FindServiceAccounts(a.getDB(r.Context()), instanceID)
+	if err != nil {
+		return internalServerError("Database error finding service accounts").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"service_accounts": accounts,
+	})
+}
+
+// adminServiceAccountCreate creates a service account and returns its secret
+func (a *API) adminServiceAccountCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params, err := a.getAdminServiceAccountParams(r)
+	if err != nil {
+		return err
+	}
+	if params.Name == "" {
+		return unprocessableEntityError("Service accounts require a name")
+	}
+	if err := validateServiceAccountRole(config, params.Role); err != nil {
+		return err
+	}
+
+	account, secret, err := models.NewServiceAccount(instanceID, params.Name, params.Role)
+	if err != nil {
+		return internalServerError("Error creating service account").WithInternalError(err)
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.ServiceAccountCreatedAction, "", map[string]interface{}{
+			"service_account_id": account.ID,
+			"name":               account.Name,
+			"role":               account.Role,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Create(account)
+	})
+	if err != nil {
+		return internalServerError("Database error creating service account").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &adminServiceAccountResponse{ServiceAccount: account, Secret: secret})
+}
+
+// adminServiceAccountGet returns a single service account
+func (a *API) adminServiceAccountGet(w http.ResponseWriter, r *http.Request) error {
+	return sendJSON(w, http.StatusOK, getServiceAccount(r.Context()))
+}
+
+// adminServiceAccountUpdate updates the name or role of a service account, and optionally rotates its secret
+func (a *API) adminServiceAccountUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	account := getServiceAccount(ctx)
+
+	params, err := a.getAdminServiceAccountParams(r)
+	if err != nil {
+		return err
+	}
+
+	if params.Name != "" {
+		account.Name = params.Name
+	}
+	if params.Role != "" {
+		if err := validateServiceAccountRole(config, params.Role); err != nil {
+			return err
+		}
+		account.Role = params.Role
+	}
+
+	var secret string
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := tx.UpdateOnly(account, "name", "role", "updated_at"); terr != nil {
+			return terr
+		}
+		if params.RegenerateSecret {
+			var terr error
+			if secret, terr = account.RegenerateSecret(tx); terr != nil {
+				return terr
+			}
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.ServiceAccountUpdatedAction, "", map[string]interface{}{
+			"service_account_id": account.ID,
+			"role":               account.Role,
+			"secret_regenerated": params.RegenerateSecret,
+		})
+	})
+	if err != nil {
+		return internalServerError("Database error updating service account").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &adminServiceAccountResponse{ServiceAccount: account, Secret: secret})
+}
+
+// adminServiceAccountDelete removes a service account. Tokens already issued
+// to it stay valid until they expire.
+func (a *API) adminServiceAccountDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	account := getServiceAccount(ctx)
+
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.ServiceAccountDeletedAction, "", map[string]interface{}{
+			"service_account_id": account.ID,
+			"name":               account.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Destroy(account)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting service account").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+// ClientCredentialsGrant issues an access token to a service account
+// authenticating with its id and secret. No refresh token is issued, the
+// service simply asks for a new token when it expires.
+func (a *API) ClientCredentialsGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.ServiceAccounts.Enabled {
+		return oauthError("unsupported_grant_type", "")
+	}
+
+	params := &ClientCredentialsGrantParams{}
+	if clientID, secret, ok := r.BasicAuth(); ok {
+		params.ClientID, params.ClientSecret = clientID, secret
+	} else if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read client credentials grant params: %v", err)
+	}
+
+	accountID, err := uuid.FromString(params.ClientID)
+	if err != nil {
+		return oauthError("invalid_client", "Client authentication failed")
+	}
+	account, err := models.FindServiceAccount(a.getDB(ctx), instanceID, accountID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_client", "Client authentication failed")
+		}
+		return internalServerError("Database error finding service account").WithInternalError(err)
+	}
+	if !account.Authenticate(params.ClientSecret) {
+		return oauthError("invalid_client", "Client authentication failed")
+	}
+
+	exp := config.JWT.ExpFor(config.JWT.Aud, []string{account.Role})
+	expiresIn := time.Second * time.Duration(exp)
+	claims := &GoTrueClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   account.ID.String(),
+			Audience:  config.JWT.Aud,
+			ExpiresAt: clock.Now().Add(expiresIn).Unix(),
+		},
+		AppMetaData: map[string]interface{}{
+			"provider": serviceAccountProvider,
+			"name":     account.Name,
+		},
+		Role:      account.Role,
+		GrantType: clientCredentialsGrant,
+	}
+	tokenString, err := signWithAccessTokenKey(&config.JWT, claims)
+	if err != nil {
+		return internalServerError("error generating jwt token").WithInternalError(err)
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		if terr := account.UpdateLastUsedAt(tx); terr != nil {
+			return terr
+		}
+		return models.NewAuditLogEntry(r, tx, instanceID, serviceAccountActor(account), models.ServiceAccountTokenIssuedAction, "", map[string]interface{}{
+			"role": account.Role,
+		})
+	})
+	if err != nil {
+		return internalServerError("Database error issuing token").WithInternalError(err)
+	}
+	a.recordTokenIssued(ctx, claimsTokenIssuance(claims))
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": tokenString,
+		"token_type":   "bearer",
+		"expires_in":   exp,
+	})
+}
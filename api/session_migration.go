@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// sessionMigrationAudience is the audience of session migration codes, so
+// they cannot be mistaken for any other token signed with the JWT secret.
+const sessionMigrationAudience = "gotrue:session_migration"
+
+const (
+	maxSessionMigrationUsers       = 1000
+	defaultSessionMigrationCodeTTL = 24 * time.Hour
+	maxSessionMigrationCodeTTL     = 7 * 24 * time.Hour
+)
+
+// sessionMigrationClaims are the claims of a code exchanged once for a
+// session issued by an admin. It has no subject so it cannot be used as a
+// user token.
+type sessionMigrationClaims struct {
+	jwt.StandardClaims
+	InstanceID     string `json:"instance_id"`
+	UserID         string `json:"user_id"`
+	RefreshTokenID int64  `json:"refresh_token_id"`
+}
+
+type adminSessionMigrationParams struct {
+	UserIDs   []uuid.UUID `json:"user_ids"`
+	ExpiresIn int         `json:"expires_in"`
+}
+
+// sessionMigrationCode is the code the client of a user exchanges for their
+// new session.
+type sessionMigrationCode struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type adminSessionMigrationResponse struct {
+	Codes []sessionMigrationCode `json:"codes"`
+	// Skipped are the users that weren't found or are banned.
+	Skipped []uuid.UUID `json:"skipped"`
+}
+
+// SessionMigrationGrantParams are the parameters the SessionMigrationGrant
+// method accepts.
+type SessionMigrationGrantParams struct {
+	Code string `json:"code"`
+}
+
+// adminSessionMigrate issues new sessions to users, after their sessions were
+// invalidated by a signing key migration or an instance move. Every session
+// is handed out as a signed code that the user's client exchanges once at
+// /token with grant_type=session_migration, so users don't have to sign in
+// again.
+func (a *API) adminSessionMigrate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params := &adminSessionMigrationParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read session migration params: %v", err)
+	}
+	if len(params.UserIDs) == 0 || len(params.UserIDs) > maxSessionMigrationUsers {
+		return unprocessableEntityError("user_ids must list between 1 and %d users", maxSessionMigrationUsers)
+	}
+	ttl := defaultSessionMigrationCodeTTL
+	if params.ExpiresIn != 0 {
+		ttl = time.Duration(params.ExpiresIn) * time.Second
+		if ttl <= 0 || ttl > maxSessionMigrationCodeTTL {
+			return unprocessableEntityError("expires_in must be between 1 and %d seconds", int(maxSessionMigrationCodeTTL.Seconds()))
+		}
+	}
+	expiresAt := clock.Now().Add(ttl)
+
+	response := &adminSessionMigrationResponse{
+		Codes:   []sessionMigrationCode{},
+		Skipped: []uuid.UUID{},
+	}
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		seen := map[uuid.UUID]bool{}
+		for _, userID := range params.UserIDs {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
+
+			user, terr := models.FindUserByInstanceIDAndID(tx, instanceID, userID)
+			if terr != nil && !models.IsNotFoundError(terr) {
+				return internalServerError("Database error finding user").WithInternalError(terr)
+			}
+			if user == nil || user.IsBanned() {
+				response.Skipped = append(response.Skipped, userID)
+				continue
+			}
+
+			refreshToken, terr := models.GrantAuthenticatedUser(r, tx, user)
+			if terr != nil {
+				return internalServerError("Database error granting user").WithInternalError(terr)
+			}
+			code, terr := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionMigrationClaims{
+				StandardClaims: jwt.StandardClaims{
+					Id:        refreshToken.SessionID.UUID.String(),
+					Audience:  sessionMigrationAudience,
+					IssuedAt:  clock.Now().Unix(),
+					ExpiresAt: expiresAt.Unix(),
+				},
+				InstanceID:     instanceID.String(),
+				UserID:         user.ID.String(),
+				RefreshTokenID: refreshToken.ID,
+			}).SignedString([]byte(config.JWT.Secret))
+			if terr != nil {
+				return internalServerError("Error generating session migration code").WithInternalError(terr)
+			}
+			response.Codes = append(response.Codes, sessionMigrationCode{
+				UserID:    user.ID,
+				Code:      code,
+				ExpiresAt: expiresAt,
+			})
+		}
+
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, adminUser, models.SessionsMigratedAction, "", map[string]interface{}{
+			"issued":     len(response.Codes),
+			"skipped":    len(response.Skipped),
+			"expires_at": expiresAt,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, response)
+}
+
+// SessionMigrationGrant exchanges a session migration code for the session
+// it was issued with. Each code is only accepted once.
+func (a *API) SessionMigrationGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	params := &SessionMigrationGrantParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read session migration grant params: %v", err)
+	}
+	if params.Code == "" {
+		return oauthError("invalid_request", "code required")
+	}
+
+	claims := sessionMigrationClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err := p.ParseWithClaims(params.Code, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.JWT.Secret), nil
+	})
+	if err != nil || !claims.VerifyAudience(sessionMigrationAudience, true) || claims.InstanceID != instanceID.String() {
+		return oauthError("invalid_grant", "Invalid session migration code")
+	}
+	userID, err := uuid.FromString(claims.UserID)
+	if err != nil {
+		return oauthError("invalid_grant", "Invalid session migration code")
+	}
+
+	var user *models.User
+	var token *AccessTokenResponse
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		used, terr := models.UseNonce(tx, instanceID, models.NonceSessionMigration, claims.Id, time.Unix(claims.ExpiresAt, 0))
+		if terr != nil {
+			return internalServerError("Database error using session migration code").WithInternalError(terr)
+		}
+		if !used {
+			return oauthError("invalid_grant", "Session migration code already used")
+		}
+
+		refreshToken, terr := models.FindRefreshTokenByID(tx, instanceID, claims.RefreshTokenID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return oauthError("invalid_grant", "Invalid session migration code")
+			}
+			return internalServerError("Database error finding session").WithInternalError(terr)
+		}
+		if refreshToken.Revoked || refreshToken.UserID != userID {
+			return oauthError("invalid_grant", "Session was revoked")
+		}
+		user, terr = models.FindUserByInstanceIDAndID(tx, instanceID, userID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return oauthError("invalid_grant", "Invalid session migration code")
+			}
+			return internalServerError("Database error finding user").WithInternalError(terr)
+		}
+		if user.IsBanned() {
+			return oauthError("invalid_grant", "Session was revoked")
+		}
+
+		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
+			"provider": sessionMigrationGrant,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+
+		tokenString, expiresIn, terr := a.generateHookedAccessToken(ctx, tx, user, "", sessionMigrationGrant, sessionClaim(refreshToken))
+		if terr != nil {
+			return internalServerError("error generating jwt token").WithInternalError(terr)
+		}
+		token = &AccessTokenResponse{
+			Token:        tokenString,
+			TokenType:    "bearer",
+			ExpiresIn:    expiresIn,
+			RefreshToken: refreshToken.Token,
+			User:         user,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := a.setCookieTokens(config, token, false, w); err != nil {
+		return internalServerError("Failed to set JWT cookie. %s", err)
+	}
+	metering.RecordLogin(sessionMigrationGrant, user.ID, instanceID)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, sessionMigrationGrant))
+	a.recordSignIn(r, user)
+	return sendToken(w, r, token)
+}
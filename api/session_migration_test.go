@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *AdminTestSuite) TestAdminSessionMigrate() {
+	u, err := models.NewUser(ts.instanceID, "", "migrated@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	missing := uuid.Must(uuid.NewV4())
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"user_ids": []uuid.UUID{u.ID, missing},
+	}))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/sessions/migrate", &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	migration := adminSessionMigrationResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&migration))
+	require.Len(ts.T(), migration.Codes, 1)
+	assert.Equal(ts.T(), u.ID, migration.Codes[0].UserID)
+	assert.Equal(ts.T(), []uuid.UUID{missing}, migration.Skipped)
+
+	// the code isn't accepted as an access token
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", migration.Codes[0].Code))
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+
+	exchange := func() *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"code": migration.Codes[0].Code,
+		}))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/token?grant_type=session_migration", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w = exchange()
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	assert.NotEmpty(ts.T(), token.Token)
+	assert.NotEmpty(ts.T(), token.RefreshToken)
+	assert.Equal(ts.T(), u.ID, token.User.ID)
+
+	// codes are only exchanged once
+	w = exchange()
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// sessionClaim is the session_id claim of the access tokens issued with the
+// refresh token.
+func sessionClaim(token *models.RefreshToken) string {
+	if !token.SessionID.Valid {
+		return ""
+	}
+	return token.SessionID.UUID.String()
+}
+
+// userSession is a session as listed to its user.
+type userSession struct {
+	*models.Session
+	// Current is true for the session of the access token of the request.
+	Current bool `json:"current"`
+}
+
+// UserSessions lists the active sessions of the user, most recently used
+// first.
+func (a *API) UserSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	claims := getClaims(ctx)
+
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	sessions, err := models.FindActiveSessions(a.getDB(ctx), user)
+	if err != nil {
+		return internalServerError("Database error finding sessions").WithInternalError(err)
+	}
+	listed := make([]userSession, 0, len(sessions))
+	for _, session := range sessions {
+		listed = append(listed, userSession{Session: session, Current: session.ID.String() == claims.SessionID})
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": listed,
+	})
+}
+
+// UserSessionRevoke signs the user out of one of their sessions.
+func (a *API) UserSessionRevoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+
+	user, err := getUserFromClaims(ctx, a.getDB(ctx))
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+	sessionID, err := uuid.FromString(chi.URLParam(r, "session_id"))
+	if err != nil {
+		return badRequestError("session_id must be a UUID")
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		session, terr := models.FindSessionByID(tx, instanceID, user.ID, sessionID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return notFoundError(terr.Error())
+			}
+			return internalServerError("Database error finding session").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.SessionRevokedAction, "", map[string]interface{}{
+			"session_id": session.ID,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+		if terr := session.Revoke(tx, models.SignOutReasonUser); terr != nil {
+			return internalServerError("Database error revoking session").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -23,6 +23,8 @@ type ProviderSettings struct {
 	Phone     bool `json:"phone"`
 	SAML      bool `json:"saml"`
 	Zoom      bool `json:"zoom"`
+	Kerberos  bool `json:"kerberos"`
+	Anonymous bool `json:"anonymous_users"`
 }
 
 type ProviderLabels struct {
@@ -63,6 +65,8 @@ func (a *API) Settings(w http.ResponseWriter, r *http.Request) error {
 			Phone:     config.External.Phone.Enabled,
 			SAML:      config.External.Saml.Enabled,
 			Zoom:      config.External.Zoom.Enabled,
+			Kerberos:  config.Kerberos.Enabled,
+			Anonymous: config.External.AnonymousUsers.Enabled,
 		},
 		ExternalLabels: ProviderLabels{
 			SAML: config.External.Saml.Name,
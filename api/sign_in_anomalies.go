@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/utilities"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SignInAnomalyEvent = "sign_in_anomaly"
+
+	newCountryAnomaly       = "new_country"
+	impossibleTravelAnomaly = "impossible_travel"
+	signInBurstAnomaly      = "sign_in_burst"
+)
+
+// SignInAnomaly describes a sign-in that looks unusual for the user and is
+// sent to the sign-in anomalies webhook.
+type SignInAnomaly struct {
+	Event      string    `json:"event"`
+	InstanceID uuid.UUID `json:"instance_id,omitempty"`
+	UserID     uuid.UUID `json:"user_id"`
+	IPAddress  string    `json:"ip_address"`
+	Country    string    `json:"country,omitempty"`
+	Anomalies  []string  `json:"anomalies"`
+	SignedInAt time.Time `json:"signed_in_at"`
+}
+
+// signInAnomalies compares a sign-in from country with the user's recent
+// sign-ins, newest first, and the countries the user signed in from before.
+func signInAnomalies(config *conf.SignInAnomaliesConfiguration, country string, now time.Time, recent []*models.SecurityEvent, countries []string) []string {
+	anomalies := []string{}
+
+	if country != "" && len(countries) > 0 && !isStringInSlice(country, countries) {
+		anomalies = append(anomalies, newCountryAnomaly)
+	}
+
+	burst := 1
+	travelled := false
+	for _, event := range recent {
+		since := now.Sub(event.CreatedAt)
+		if since <= config.BurstWindow {
+			burst++
+		}
+		if since <= config.TravelWindow && country != "" && event.Country != "" && string(event.Country) != country {
+			travelled = true
+		}
+	}
+	if travelled {
+		anomalies = append(anomalies, impossibleTravelAnomaly)
+	}
+	if burst > config.BurstLimit {
+		anomalies = append(anomalies, signInBurstAnomaly)
+	}
+	return anomalies
+}
+
+// recordSignIn counts a sign-in of user, emits its login lifecycle event and
+// records it as a security event along with the anomalies detected for it,
+// meters the anomalies and sends them to the sign-in anomalies webhook. Anomalies are signals for downstream
+// fraud systems and never fail the sign-in, so errors are only logged.
+func (a *API) recordSignIn(r *http.Request, user *models.User) {
+	ctx := r.Context()
+	a.recordAuthEvent(ctx, user.Aud, loginAuthEvent)
+	a.emitLifecycleEvent(ctx, UserLoginEvent, user)
+	config := a.getConfig(ctx)
+	anomaliesConfig := config.Security.SignInAnomalies
+	if !anomaliesConfig.Enabled {
+		return
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"component":  "sign_in_anomalies",
+		"request_id": getRequestID(ctx),
+		"user_id":    user.ID,
+	})
+	country := ""
+	if anomaliesConfig.CountryHeader != "" {
+		country = strings.ToUpper(strings.TrimSpace(r.Header.Get(anomaliesConfig.CountryHeader)))
+	}
+	ipAddress := utilities.GetIPAddress(r)
+	now := time.Now()
+
+	window := anomaliesConfig.TravelWindow
+	if anomaliesConfig.BurstWindow > window {
+		window = anomaliesConfig.BurstWindow
+	}
+	recent, err := models.FindSecurityEventsSince(a.getDB(ctx), user, models.SignInSecurityEvent, now.Add(-window))
+	if err != nil {
+		log.WithError(err).Error("Failed to load recent sign-ins")
+		return
+	}
+	countries, err := models.FindSecurityEventCountries(a.getDB(ctx), user, models.SignInSecurityEvent)
+	if err != nil {
+		log.WithError(err).Error("Failed to load sign-in countries")
+		return
+	}
+	anomalies := signInAnomalies(&anomaliesConfig, country, now, recent, countries)
+
+	event, err := models.NewSecurityEvent(user, models.SignInSecurityEvent, ipAddress, country, map[string]interface{}{
+		"user_agent": r.UserAgent(),
+		"anomalies":  anomalies,
+	})
+	if err == nil {
+		err = a.getDB(ctx).Create(event)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to record sign-in")
+	}
+
+	if len(anomalies) == 0 {
+		return
+	}
+	instanceID := getInstanceID(ctx)
+	for _, anomaly := range anomalies {
+		metering.RecordSignInAnomaly(anomaly, user.ID, instanceID)
+	}
+	if anomaliesConfig.WebhookURL != "" {
+		// the webhook must not hold up the sign-in, nor be cancelled with it,
+		// so it only keeps the request ID
+		go a.sendSignInAnomaly(getRequestID(ctx), config, &SignInAnomaly{
+			Event:      SignInAnomalyEvent,
+			InstanceID: instanceID,
+			UserID:     user.ID,
+			IPAddress:  ipAddress,
+			Country:    country,
+			Anomalies:  anomalies,
+			SignedInAt: now,
+		})
+	}
+}
+
+func (a *API) sendSignInAnomaly(requestID string, config *conf.Configuration, anomaly *SignInAnomaly) {
+	anomaliesConfig := config.Security.SignInAnomalies
+	anomalyLog := logrus.WithFields(logrus.Fields{
+		"component":   "sign_in_anomalies",
+		"request_id":  requestID,
+		"instance_id": anomaly.InstanceID,
+		"user_id":     anomaly.UserID,
+	})
+
+	data, err := json.Marshal(anomaly)
+	if err != nil {
+		anomalyLog.WithError(err).Error("Failed to serialize sign-in anomaly")
+		return
+	}
+	sha, err := checksum(data)
+	if err != nil {
+		anomalyLog.WithError(err).Error("Failed to checksum sign-in anomaly")
+		return
+	}
+
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{URL: anomaliesConfig.WebhookURL, Retries: 1},
+		jwtSecret:     anomaliesConfig.WebhookSecret,
+		instanceID:    anomaly.InstanceID,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  anomaly.InstanceID.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: data,
+		headers: requestIDHeaders(requestID),
+	}
+	body, err := w.trigger()
+	if body != nil {
+		body.Close()
+	}
+	if err != nil {
+		anomalyLog.WithError(err).Error("Failed to send sign-in anomaly")
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignInAnomalies(t *testing.T) {
+	config := &conf.SignInAnomaliesConfiguration{
+		TravelWindow: 2 * time.Hour,
+		BurstLimit:   3,
+		BurstWindow:  10 * time.Minute,
+	}
+	now := time.Now()
+	signIn := func(ago time.Duration, country string) *models.SecurityEvent {
+		return &models.SecurityEvent{CreatedAt: now.Add(-ago), Country: storage.NullString(country)}
+	}
+
+	// the first sign-in of a user is never anomalous
+	assert.Empty(t, signInAnomalies(config, "DE", now, nil, nil))
+	assert.Empty(t, signInAnomalies(config, "DE", now, []*models.SecurityEvent{signIn(time.Hour, "DE")}, []string{"DE"}))
+
+	assert.Equal(t, []string{newCountryAnomaly}, signInAnomalies(config, "FR", now, nil, []string{"DE"}))
+	assert.Equal(t, []string{newCountryAnomaly, impossibleTravelAnomaly}, signInAnomalies(config, "FR", now, []*models.SecurityEvent{signIn(time.Hour, "DE")}, []string{"DE"}))
+	assert.Equal(t, []string{impossibleTravelAnomaly}, signInAnomalies(config, "FR", now, []*models.SecurityEvent{signIn(time.Hour, "DE")}, []string{"DE", "FR"}))
+
+	// without a country only bursts are detected
+	burst := []*models.SecurityEvent{signIn(time.Minute, "DE"), signIn(2*time.Minute, "DE"), signIn(3*time.Minute, "DE")}
+	assert.Equal(t, []string{signInBurstAnomaly}, signInAnomalies(config, "", now, burst, []string{"DE"}))
+	assert.Empty(t, signInAnomalies(config, "", now, burst[:2], []string{"DE"}))
+}
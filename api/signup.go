@@ -3,15 +3,18 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	sortpkg "sort"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/api/sms_provider"
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/metering"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
 	"github.com/pkg/errors"
 )
 
@@ -41,14 +44,31 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Could not read Signup params: %v", err)
 	}
 
-	if params.Password == "" {
-		return unprocessableEntityError("Signup requires a valid password")
+	var user *models.User
+	instanceID := getInstanceID(ctx)
+	params.Aud = a.requestAud(ctx, r)
+	if r.URL.Query().Get("grant_type") == anonymousGrant {
+		return a.signupAnonymous(w, r, params)
 	}
-	if len(params.Password) < config.PasswordMinLength {
-		return unprocessableEntityError(fmt.Sprintf("Password should be at least %d characters", config.PasswordMinLength))
+
+	// users of WhatsApp audiences sign up with their phone number only and
+	// sign in with codes, so they don't need a password
+	passwordless := config.Sms.IsWhatsappAudience(params.Aud)
+	if passwordless && params.Email != "" {
+		return phoneOnlyError(params.Aud)
+	}
+
+	errs := fieldErrors{}
+	leaked := a.checkLeakedPassword(r, config, params.Password)
+	if params.Password == "" {
+		if !passwordless {
+			errs.add("password", "Signup requires a valid password")
+		}
+	} else if len(params.Password) < config.PasswordMinLength {
+		errs.add("password", "Password should be at least %d characters", config.PasswordMinLength)
 	}
 	if params.Email != "" && params.Phone != "" {
-		return unprocessableEntityError("Only an email address or phone number should be provided on signup.")
+		errs.add("phone", "Only an email address or phone number should be provided on signup.")
 	}
 	if params.Email != "" {
 		params.Provider = "email"
@@ -58,10 +78,9 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 	if params.Data == nil {
 		params.Data = make(map[string]interface{})
 	}
-
-	var user *models.User
-	instanceID := getInstanceID(ctx)
-	params.Aud = a.requestAud(ctx, r)
+	if rejected := restrictUserMetaData(config, params.Data); len(rejected) > 0 {
+		errs.add("data", "User metadata keys are not allowed: %s", strings.Join(rejected, ", "))
+	}
 
 	switch params.Provider {
 	case "email":
@@ -69,34 +88,52 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 			return badRequestError("Email signups are disabled")
 		}
 		if err := a.validateEmail(ctx, params.Email); err != nil {
-			return err
+			errs.addError("email", err)
 		}
-		user, err = models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, params.Aud)
 	case "phone":
 		if !config.External.Phone.Enabled {
 			return badRequestError("Phone signups are disabled")
 		}
 		params.Phone, err = a.validatePhone(params.Phone)
 		if err != nil {
-			return err
+			errs.addError("phone", err)
 		}
-		user, err = models.FindUserByPhoneAndAudience(a.db, instanceID, params.Phone, params.Aud)
 	default:
-		return invalidSignupError(config)
+		errs.addError("email", invalidSignupError(config))
+	}
+	if err := errs.toError(); err != nil {
+		return err
+	}
+	if params.Password != "" {
+		if err := checkPasswordPolicy(config, params.Password); err != nil {
+			return err
+		}
+	}
+	if err := leaked(); err != nil {
+		return err
+	}
+
+	if params.Provider == "email" {
+		user, err = models.FindUserByEmailAndAudience(a.getDB(ctx), instanceID, params.Email, params.Aud)
+	} else {
+		user, err = models.FindUserByPhoneAndAudience(a.getDB(ctx), instanceID, params.Phone, params.Aud)
 	}
 
 	if err != nil && !models.IsNotFoundError(err) {
 		return internalServerError("Database error finding user").WithInternalError(err)
 	}
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	isNewUser := false
+	isDuplicate := false
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if user != nil {
 			if (params.Provider == "email" && user.IsConfirmed()) || (params.Provider == "phone" && user.IsPhoneConfirmed()) {
 				return UserExistsError
 			}
 
-			if err := user.UpdateUserMetaData(tx, params.Data); err != nil {
+			isDuplicate = true
+			if err := updateDuplicateSignupMetaData(tx, config, user, params.Data); err != nil {
 				return internalServerError("Database error updating user").WithInternalError(err)
 			}
 		} else {
@@ -109,6 +146,7 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 				return terr
 			}
 			user.Identities = []models.Identity{*identity}
+			isNewUser = true
 		}
 
 		if params.Provider == "email" && !user.IsConfirmed() {
@@ -126,17 +164,19 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 				}
 			} else {
 				mailer := a.Mailer(ctx)
-				referrer := a.getReferrer(r)
+				referrer := withRedirectParams(config, r, a.getReferrer(r))
 				if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.UserConfirmationRequestedAction, "", map[string]interface{}{
 					"provider": params.Provider,
 				}); terr != nil {
 					return terr
 				}
-				if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequency, referrer, config.Mailer.OtpLength); terr != nil {
+				if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.ConfirmationEmail), referrer, config.Mailer.OtpLength); terr != nil {
+					if errors.Is(terr, MaxFrequencyLimitError) && isDuplicate && config.DuplicateSignup.Resend {
+						// the confirmation was sent recently, the user only has to find it
+						return nil
+					}
 					if errors.Is(terr, MaxFrequencyLimitError) {
-						now := time.Now()
-						left := user.ConfirmationSentAt.Add(config.SMTP.MaxFrequency).Sub(now) / time.Second
-						return tooManyRequestsError(fmt.Sprintf("For security purposes, you can only request this after %d seconds.", left))
+						return frequencyLimitedError(w, terr)
 					}
 					return internalServerError("Error sending confirmation mail").WithInternalError(terr)
 				}
@@ -165,6 +205,12 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 					return badRequestError("Error sending confirmation sms: %v", terr)
 				}
 				if terr = a.sendPhoneConfirmation(ctx, tx, user, params.Phone, phoneConfirmationOtp, smsProvider); terr != nil {
+					if errors.Is(terr, MaxFrequencyLimitError) && isDuplicate && config.DuplicateSignup.Resend {
+						return nil
+					}
+					if herr, ok := terr.(*HTTPError); ok {
+						return herr
+					}
 					return badRequestError("Error sending confirmation sms: %v", terr)
 				}
 			}
@@ -175,10 +221,10 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 
 	if err != nil {
 		if errors.Is(err, MaxFrequencyLimitError) {
-			return tooManyRequestsError("For security purposes, you can only request this once every minute")
+			return frequencyLimitedError(w, err)
 		}
 		if errors.Is(err, UserExistsError) {
-			err = a.db.Transaction(func(tx *storage.Connection) error {
+			err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 				if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserRepeatedSignUpAction, "", map[string]interface{}{
 					"provider": params.Provider,
 				}); terr != nil {
@@ -201,10 +247,35 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	isConfirmed := (params.Provider == "email" && user.IsConfirmed()) || (params.Provider == "phone" && user.IsPhoneConfirmed())
+	if isDuplicate && config.DuplicateSignup.Resend && !isConfirmed {
+		// respond exactly like to a new signup, so it doesn't reveal that the user exists
+		sanitizedUser, err := sanitizeUser(user, params)
+		if err != nil {
+			return err
+		}
+		return sendJSON(w, http.StatusOK, sanitizedUser)
+	}
+
+	if isNewUser {
+		a.recordAuthEvent(ctx, user.Aud, signupAuthEvent)
+		a.emitLifecycleEvent(ctx, UserCreatedEvent, user)
+		if isConfirmed {
+			a.emitLifecycleEvent(ctx, UserConfirmedEvent, user)
+		}
+		ipAddress := utilities.GetIPAddress(r)
+		a.reportSuspiciousActivity(ctx, MassSignupActivity, ipAddress, map[string]interface{}{
+			"user_id":    user.ID,
+			"email":      user.GetEmail(),
+			"phone":      user.GetPhone(),
+			"ip_address": ipAddress,
+		})
+	}
+
 	// handles case where Mailer.Autoconfirm is true or Phone.Autoconfirm is true
 	if user.IsConfirmed() || user.IsPhoneConfirmed() {
 		var token *AccessTokenResponse
-		err = a.db.Transaction(func(tx *storage.Connection) error {
+		err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 			var terr error
 			if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
 				"provider": params.Provider,
@@ -215,7 +286,7 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 				return terr
 			}
 
-			token, terr = a.issueRefreshToken(ctx, tx, user)
+			token, terr = a.issueRefreshToken(ctx, r, tx, user, passwordGrant)
 			if terr != nil {
 				return terr
 			}
@@ -229,12 +300,28 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 			return err
 		}
 		metering.RecordLogin("password", user.ID, instanceID)
-		return sendJSON(w, http.StatusOK, token)
+		a.recordTokenIssued(ctx, userTokenIssuance(user, passwordGrant))
+		a.recordSignIn(r, user)
+		return sendToken(w, r, token)
 	}
 
 	return sendJSON(w, http.StatusOK, user)
 }
 
+// updateDuplicateSignupMetaData applies the user_metadata sent with a repeated
+// signup of an unconfirmed user according to the configured strategy.
+func updateDuplicateSignupMetaData(tx *storage.Connection, config *conf.Configuration, user *models.User, data map[string]interface{}) error {
+	switch config.DuplicateSignup.MetadataStrategy {
+	case conf.DuplicateSignupKeepMetadata:
+		return nil
+	case conf.DuplicateSignupReplaceMetadata:
+		user.UserMetaData = data
+		return tx.UpdateOnly(user, "raw_user_meta_data")
+	default:
+		return user.UpdateUserMetaData(tx, data)
+	}
+}
+
 // sanitizeUser removes all user sensitive information from the user object
 // Should be used whenever we want to prevent information about whether a user is registered or not from leaking
 func sanitizeUser(u *models.User, params *SignupParams) (*models.User, error) {
@@ -299,6 +386,7 @@ func (a *API) signupNewUser(ctx context.Context, conn *storage.Connection, param
 	user.AppMetaData["provider"] = params.Provider
 
 	user.AppMetaData["providers"] = []string{params.Provider}
+	user.IsAnonymous = params.Provider == anonymousProvider
 	if params.Password == "" {
 		user.EncryptedPassword = ""
 	}
@@ -322,3 +410,26 @@ func (a *API) signupNewUser(ctx context.Context, conn *storage.Connection, param
 
 	return user, nil
 }
+
+// restrictUserMetaData applies the allowlist of SIGNUP_METADATA_ALLOWED_KEYS
+// to the user_metadata set by users themselves, which downstream systems may
+// trust. Keys that aren't allowed are stripped from data, or returned, sorted,
+// when they must be rejected.
+func restrictUserMetaData(config *conf.Configuration, data map[string]interface{}) []string {
+	if !config.SignupMetadata.Enabled {
+		return nil
+	}
+	rejected := []string{}
+	for key := range data {
+		if isStringInSlice(key, config.SignupMetadata.AllowedKeys) {
+			continue
+		}
+		if config.SignupMetadata.Action == conf.SignupMetadataReject {
+			rejected = append(rejected, key)
+		} else {
+			delete(data, key)
+		}
+	}
+	sortpkg.Strings(rejected)
+	return rejected
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -79,6 +80,66 @@ func (ts *SignupTestSuite) TestSignup() {
 	assert.Equal(ts.T(), []interface{}{"email"}, data.AppMetaData["providers"])
 }
 
+func (ts *SignupTestSuite) TestSignupMetadataAllowlist() {
+	ts.Config.SignupMetadata = conf.SignupMetadataConfiguration{
+		Enabled:     true,
+		AllowedKeys: []string{"full_name"},
+		Action:      conf.SignupMetadataStrip,
+	}
+	defer func() { ts.Config.SignupMetadata = conf.SignupMetadataConfiguration{Action: conf.SignupMetadataStrip} }()
+
+	signup := func(email string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    email,
+			"password": "test123",
+			"data": map[string]interface{}{
+				"full_name": "Test User",
+				"plan":      "enterprise",
+			},
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/signup", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := signup("strip@example.com")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), map[string]interface{}{"full_name": "Test User"}, map[string]interface{}(data.UserMetaData))
+
+	ts.Config.SignupMetadata.Action = conf.SignupMetadataReject
+	w = signup("reject@example.com")
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(ts.T(), w.Body.String(), "plan")
+}
+
+// TestSignupValidationErrors tests that every invalid field is reported at once
+func (ts *SignupTestSuite) TestSignupValidationErrors() {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "not-an-email",
+		"password": "a",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/signup", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	e := &HTTPError{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(e))
+	require.Len(ts.T(), e.Errors, 2)
+	assert.Equal(ts.T(), "password", e.Errors[0].Field)
+	assert.Equal(ts.T(), "email", e.Errors[1].Field)
+	// clients that only read msg still get the first error
+	assert.Equal(ts.T(), e.Errors[0].Message, e.Message)
+}
+
 func (ts *SignupTestSuite) TestWebhookTriggered() {
 	var callCount int
 	require := ts.Require()
@@ -234,6 +295,89 @@ func (ts *SignupTestSuite) TestSignupTwice() {
 	assert.Equal(ts.T(), []interface{}{"email"}, data.AppMetaData["providers"])
 }
 
+func (ts *SignupTestSuite) TestSignupTwiceUnconfirmed() {
+	ts.Config.DuplicateSignup.Resend = true
+	ts.Config.DuplicateSignup.MetadataStrategy = conf.DuplicateSignupKeepMetadata
+	defer func() {
+		ts.Config.DuplicateSignup.Resend = false
+		ts.Config.DuplicateSignup.MetadataStrategy = conf.DuplicateSignupMergeMetadata
+	}()
+
+	signup := func(data map[string]interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    "test1@example.com",
+			"password": "test123",
+			"data":     data,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/signup", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(ts.T(), http.StatusOK, signup(map[string]interface{}{"a": 1}).Code)
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test1@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	// the confirmation was just sent, but the repeated signup still succeeds
+	w := signup(map[string]interface{}{"b": 2})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.NotEqual(ts.T(), u.ID, data.ID)
+	assert.Equal(ts.T(), "test1@example.com", data.GetEmail())
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test1@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), map[string]interface{}{"a": 1.0}, u.UserMetaData)
+}
+
+func (ts *SignupTestSuite) TestUnconfirmedUsersPolicy() {
+	ts.Config.UnconfirmedUsers = conf.UnconfirmedUsersConfiguration{ReminderDays: 3, ExpiryDays: 7, ExpiryAction: conf.UnconfirmedUsersFlag}
+	defer func() {
+		ts.Config.UnconfirmedUsers = conf.UnconfirmedUsersConfiguration{ExpiryAction: conf.UnconfirmedUsersFlag}
+	}()
+
+	createUser := func(email string, age time.Duration) *models.User {
+		u, err := models.NewUser(ts.instanceID, "", email, "test123", ts.Config.JWT.Aud, nil)
+		require.NoError(ts.T(), err)
+		require.NoError(ts.T(), ts.API.db.Create(u))
+		require.NoError(ts.T(), ts.API.db.RawQuery("UPDATE users SET created_at = ? WHERE id = ?", time.Now().Add(-age), u.ID).Exec())
+		return u
+	}
+	recent := createUser("recent@example.com", 24*time.Hour)
+	pending := createUser("pending@example.com", 5*24*time.Hour)
+	expired := createUser("expired@example.com", 10*24*time.Hour)
+
+	ctx, err := WithInstanceConfig(context.Background(), ts.Config, ts.instanceID)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.processUnconfirmedUsers(ctx))
+
+	recent, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, recent.ID)
+	require.NoError(ts.T(), err)
+	assert.Nil(ts.T(), recent.ConfirmationReminderSentAt)
+	assert.Nil(ts.T(), recent.UnconfirmedExpiredAt)
+
+	pending, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, pending.ID)
+	require.NoError(ts.T(), err)
+	assert.NotNil(ts.T(), pending.ConfirmationReminderSentAt)
+	assert.NotNil(ts.T(), pending.ConfirmationSentAt)
+	assert.Nil(ts.T(), pending.UnconfirmedExpiredAt)
+
+	expired, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, expired.ID)
+	require.NoError(ts.T(), err)
+	assert.Nil(ts.T(), expired.ConfirmationReminderSentAt)
+	assert.NotNil(ts.T(), expired.UnconfirmedExpiredAt)
+
+	// expired users are deleted once the policy says so
+	ts.Config.UnconfirmedUsers.ExpiryAction = conf.UnconfirmedUsersDelete
+	require.NoError(ts.T(), ts.API.processUnconfirmedUsers(ctx))
+	_, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, expired.ID)
+	assert.True(ts.T(), models.IsNotFoundError(err))
+}
+
 func (ts *SignupTestSuite) TestVerifySignup() {
 	user, err := models.NewUser(ts.instanceID, "123456789", "test@example.com", "testing", ts.Config.JWT.Aud, nil)
 	user.ConfirmationToken = "asdf3"
@@ -263,3 +407,77 @@ func (ts *SignupTestSuite) TestVerifySignup() {
 	require.NotEmpty(ts.T(), v.Get("expires_in"))
 	require.NotEmpty(ts.T(), v.Get("refresh_token"))
 }
+
+func (ts *SignupTestSuite) TestSignupAnonymous() {
+	signup := func() *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"cart": "cart-1"},
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/signup?grant_type=anonymous", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// anonymous sign-ins must be enabled
+	assert.Equal(ts.T(), http.StatusBadRequest, signup().Code)
+
+	ts.Config.External.AnonymousUsers.Enabled = true
+	defer func() {
+		ts.Config.External.AnonymousUsers.Enabled = false
+	}()
+
+	w := signup()
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	require.NotEmpty(ts.T(), token.RefreshToken)
+	claims := &GoTrueClaims{}
+	_, err := parseAccessToken(&ts.Config.JWT, token.Token, claims)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), claims.IsAnonymous)
+	assert.Equal(ts.T(), anonymousGrant, claims.GrantType)
+
+	userID := uuid.FromStringOrNil(claims.Subject)
+	user, err := models.FindUserByID(ts.API.db, userID)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), user.IsAnonymous)
+	assert.Empty(ts.T(), user.GetEmail())
+	assert.Equal(ts.T(), "cart-1", user.UserMetaData["cart"])
+
+	// anonymous users aren't expired as unconfirmed users
+	users, err := models.FindExpiredUnconfirmedUsers(ts.API.db, ts.instanceID, time.Now().Add(time.Hour), true, 10)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), users)
+
+	// the user keeps its id once it confirmed an email address
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email": "guest@example.com",
+	}))
+	req := httptest.NewRequest(http.MethodPut, "/user", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	user, err = models.FindUserByID(ts.API.db, userID)
+	require.NoError(ts.T(), err)
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost/verify?type=%s&token=%s", emailChangeVerification, user.EmailChangeTokenNew), nil)
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusSeeOther, w.Code)
+
+	user, err = models.FindUserByID(ts.API.db, userID)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), user.IsAnonymous)
+	assert.Equal(ts.T(), "guest@example.com", user.GetEmail())
+	assert.True(ts.T(), user.IsConfirmed())
+	assert.Equal(ts.T(), "email", user.AppMetaData["provider"])
+	assert.Equal(ts.T(), []interface{}{"email"}, user.AppMetaData["providers"])
+	_, err = models.FindIdentityByIdAndProvider(ts.API.db, userID.String(), "email")
+	assert.NoError(ts.T(), err)
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/netlify/gotrue/breaker"
 	"github.com/netlify/gotrue/conf"
 )
 
@@ -64,7 +65,7 @@ func (t *MessagebirdProvider) SendSms(phone string, message string) error {
 		"datacoding": {"unicode"},
 	}
 
-	client := &http.Client{Timeout: defaultTimeout}
+	client := &http.Client{Timeout: defaultTimeout, Transport: &breaker.Transport{Prefix: "sms "}}
 	r, err := http.NewRequest("POST", t.APIPath, strings.NewReader(body.Encode()))
 	if err != nil {
 		return err
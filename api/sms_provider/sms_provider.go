@@ -26,7 +26,19 @@ type SmsProvider interface {
 	SendSms(phone, message string) error
 }
 
+// WhatsappProvider is an SmsProvider that can also deliver messages over
+// WhatsApp.
+type WhatsappProvider interface {
+	SendWhatsapp(phone, message string) error
+}
+
 func GetSmsProvider(config conf.Configuration) (SmsProvider, error) {
+	if config.Sandbox {
+		return &sandboxProvider{}, nil
+	}
+	if config.LoadTest {
+		return &noopProvider{}, nil
+	}
 	switch name := config.Sms.Provider; name {
 	case "twilio":
 		return NewTwilioProvider(config.Sms.Twilio)
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/netlify/gotrue/breaker"
 	"github.com/netlify/gotrue/conf"
 )
 
@@ -52,7 +53,7 @@ func (t *TextlocalProvider) SendSms(phone string, message string) error {
 		"numbers": {phone},
 	}
 
-	client := &http.Client{Timeout: defaultTimeout}
+	client := &http.Client{Timeout: defaultTimeout, Transport: &breaker.Transport{Prefix: "sms "}}
 	r, err := http.NewRequest("POST", t.APIPath, strings.NewReader(body.Encode()))
 	if err != nil {
 		return err
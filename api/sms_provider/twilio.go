@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/netlify/gotrue/breaker"
 	"github.com/netlify/gotrue/conf"
 )
 
@@ -55,14 +56,29 @@ func NewTwilioProvider(config conf.TwilioProviderConfiguration) (SmsProvider, er
 
 // Send an SMS containing the OTP with Twilio's API
 func (t *TwilioProvider) SendSms(phone string, message string) error {
-	body := url.Values{
+	return t.send(url.Values{
 		"To":      {"+" + phone}, // twilio api requires "+" extension to be included
 		"Channel": {"sms"},
 		"From":    {t.Config.MessageServiceSid},
 		"Body":    {message},
+	})
+}
+
+// Send a WhatsApp message containing the OTP with Twilio's API
+func (t *TwilioProvider) SendWhatsapp(phone string, message string) error {
+	from := t.Config.MessageServiceSid
+	if t.Config.WhatsappSender != "" {
+		from = "whatsapp:+" + strings.TrimPrefix(t.Config.WhatsappSender, "+")
 	}
+	return t.send(url.Values{
+		"To":   {"whatsapp:+" + phone},
+		"From": {from},
+		"Body": {message},
+	})
+}
 
-	client := &http.Client{Timeout: defaultTimeout}
+func (t *TwilioProvider) send(body url.Values) error {
+	client := &http.Client{Timeout: defaultTimeout, Transport: &breaker.Transport{Prefix: "sms "}}
 	r, err := http.NewRequest("POST", t.APIPath, strings.NewReader(body.Encode()))
 	if err != nil {
 		return err
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/netlify/gotrue/clock"
+)
+
+// TestClockParams move the test clock, to Now if set and then by Advance.
+type TestClockParams struct {
+	Now     *time.Time `json:"now"`
+	Advance string     `json:"advance"`
+}
+
+// adminTestClock returns the time of the clock that tokens, bans and OTPs
+// expire by.
+func (a *API) adminTestClock(w http.ResponseWriter, r *http.Request) error {
+	if !a.config.TestClock {
+		return notFoundError("The test clock is disabled")
+	}
+	return sendTestClock(w)
+}
+
+// adminTestClockUpdate moves the clock, which keeps running from the new time.
+func (a *API) adminTestClockUpdate(w http.ResponseWriter, r *http.Request) error {
+	if !a.config.TestClock {
+		return notFoundError("The test clock is disabled")
+	}
+
+	params := &TestClockParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read test clock params: %v", err)
+	}
+	if params.Now == nil && params.Advance == "" {
+		return unprocessableEntityError("now or advance is required")
+	}
+
+	now := clock.Now()
+	if params.Now != nil {
+		now = *params.Now
+	}
+	if params.Advance != "" {
+		d, err := time.ParseDuration(params.Advance)
+		if err != nil {
+			return badRequestError("Invalid format for advance: %v", err)
+		}
+		now = now.Add(d)
+	}
+	clock.Set(clock.Offset(time.Until(now)))
+	return sendTestClock(w)
+}
+
+// adminTestClockReset restores the system clock.
+func (a *API) adminTestClockReset(w http.ResponseWriter, r *http.Request) error {
+	if !a.config.TestClock {
+		return notFoundError("The test clock is disabled")
+	}
+	clock.Set(nil)
+	return sendTestClock(w)
+}
+
+func sendTestClock(w http.ResponseWriter) error {
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"now":    clock.Now(),
+		"offset": clock.Now().Sub(time.Now()).Round(time.Second).String(),
+	})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestClock(t *testing.T) {
+	defer clock.Set(nil)
+	api := &API{config: &conf.GlobalConfiguration{}}
+	update := func(body string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPut, "http://localhost/admin/test/clock", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		return w, api.adminTestClockUpdate(w, req)
+	}
+
+	_, err := update(`{"advance":"2h"}`)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(*HTTPError).Code)
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+
+	api.config.TestClock = true
+	user, err := models.NewUser(uuid.Nil, "", "test@example.com", "", "", nil)
+	require.NoError(t, err)
+	jwtConfig := &conf.JWTConfiguration{Secret: "secret"}
+	token, err := generateBoundAccessToken(user, time.Hour, jwtConfig, "", "", "")
+	require.NoError(t, err)
+	sentAt := clock.Now()
+	bannedUntil := clock.Now().Add(90 * time.Minute)
+	user.BannedUntil = &bannedUntil
+	assert.True(t, user.IsBanned())
+
+	w, err := update(`{"advance":"2h"}`)
+	require.NoError(t, err)
+	data := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(t, "2h0m0s", data["offset"])
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), clock.Now(), time.Second)
+
+	// tokens, bans and OTPs expire by the test clock
+	_, err = parseAccessToken(jwtConfig, token, &GoTrueClaims{})
+	assert.Error(t, err)
+	assert.False(t, user.IsBanned())
+	assert.True(t, isOtpExpired(&sentAt, 3600))
+
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = update(`{"now":"2030-01-01T00:00:00Z","advance":"1m"}`)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Minute), clock.Now(), time.Second)
+
+	_, err = update(`{}`)
+	assert.Error(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "http://localhost/admin/test/clock", nil)
+	require.NoError(t, api.adminTestClockReset(httptest.NewRecorder(), req))
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+}
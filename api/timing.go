@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+// secureCompare compares a secret supplied by the client with the expected
+// one in constant time, so response times don't tell how much of a guess was
+// right.
+func secureCompare(actual, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) == 1
+}
+
+// padAuthFailures holds back failed responses until
+// SECURITY_AUTH_FAILURE_MIN_DURATION after the request started, so failures
+// take the same time whichever check failed.
+func (a *API) padAuthFailures(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	if config == nil || config.Security.AuthFailureMinDuration <= 0 {
+		return ctx, nil
+	}
+	return withAuthFailureDeadline(ctx, time.Now().Add(config.Security.AuthFailureMinDuration)), nil
+}
+
+// padAuthFailure waits for the deadline set by padAuthFailures, if any.
+func padAuthFailure(ctx context.Context) {
+	if deadline, ok := getAuthFailureDeadline(ctx); ok {
+		time.Sleep(time.Until(deadline))
+	}
+}
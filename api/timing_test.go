@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureCompare(t *testing.T) {
+	assert.True(t, secureCompare("123456", "123456"))
+	assert.False(t, secureCompare("123455", "123456"))
+	assert.False(t, secureCompare("12345", "123456"))
+	assert.False(t, secureCompare("", "123456"))
+}
+
+func TestPadAuthFailures(t *testing.T) {
+	api := &API{config: &conf.GlobalConfiguration{}}
+	config := &conf.Configuration{}
+	config.Security.AuthFailureMinDuration = 100 * time.Millisecond
+
+	serve := func(fn apiHandler) time.Duration {
+		req := httptest.NewRequest(http.MethodPost, "/token", nil)
+		req = req.WithContext(withConfig(req.Context(), config))
+		ctx, err := api.padAuthFailures(httptest.NewRecorder(), req)
+		require.NoError(t, err)
+
+		start := time.Now()
+		fn.serve(httptest.NewRecorder(), req.WithContext(ctx))
+		return time.Since(start)
+	}
+
+	failure := serve(func(w http.ResponseWriter, r *http.Request) error {
+		return oauthError("invalid_grant", InvalidLoginMessage)
+	})
+	assert.GreaterOrEqual(t, int64(failure), int64(90*time.Millisecond))
+
+	success := serve(func(w http.ResponseWriter, r *http.Request) error {
+		return sendJSON(w, http.StatusOK, map[string]string{})
+	})
+	assert.Less(t, int64(success), int64(90*time.Millisecond))
+
+	config.Security.AuthFailureMinDuration = 0
+	failure = serve(func(w http.ResponseWriter, r *http.Request) error {
+		return oauthError("invalid_grant", InvalidLoginMessage)
+	})
+	assert.Less(t, int64(failure), int64(90*time.Millisecond))
+}
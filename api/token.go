@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,10 +13,15 @@ import (
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/clock"
 	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/directory"
 	"github.com/netlify/gotrue/metering"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
+	"github.com/sirupsen/logrus"
 )
 
 // GoTrueClaims is a struct thats used for JWT claims
@@ -26,15 +32,52 @@ type GoTrueClaims struct {
 	AppMetaData  map[string]interface{} `json:"app_metadata"`
 	UserMetaData map[string]interface{} `json:"user_metadata"`
 	Role         string                 `json:"role"`
+	Roles        []string               `json:"roles,omitempty"`
+	ClientID     string                 `json:"client_id,omitempty"`
+	Scope        string                 `json:"scope,omitempty"`
+	Confirmation *tokenConfirmation     `json:"cnf,omitempty"`
+	Actor        *tokenActor            `json:"act,omitempty"`
+	GrantType    string                 `json:"gty,omitempty"`
+	SessionID    string                 `json:"session_id,omitempty"`
+	IsAnonymous  bool                   `json:"is_anonymous,omitempty"`
+	ShadowBanned bool                   `json:"shadow_banned,omitempty"`
+	// ClaimsReference stands in for the metadata claims of tokens that
+	// would be too large, the claims are served at /userinfo.
+	ClaimsReference string `json:"claims_ref,omitempty"`
+
+	// CustomClaims are added next to the other claims, without replacing any.
+	CustomClaims map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the custom claims to the JSON of the claims.
+func (c GoTrueClaims) MarshalJSON() ([]byte, error) {
+	type claims GoTrueClaims
+	data, err := json.Marshal(claims(c))
+	if err != nil || len(c.CustomClaims) == 0 {
+		return data, err
+	}
+
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range c.CustomClaims {
+		if _, ok := merged[key]; !ok {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
 }
 
 // AccessTokenResponse represents an OAuth2 success response
 type AccessTokenResponse struct {
 	Token        string       `json:"access_token"`
-	TokenType    string       `json:"token_type"` // Bearer
+	TokenType    string       `json:"token_type"` // Bearer or DPoP
 	ExpiresIn    int          `json:"expires_in"`
 	RefreshToken string       `json:"refresh_token"`
 	User         *models.User `json:"user"`
+	// MissingFields are the required profile fields the user hasn't filled in
+	MissingFields []string `json:"missing_fields,omitempty"`
 }
 
 // PasswordGrantParams are the parameters the ResourceOwnerPasswordGrant method accepts
@@ -72,61 +115,79 @@ const useCookieHeader = "x-use-cookie"
 const useSessionCookie = "session"
 const InvalidLoginMessage = "Invalid login credentials"
 
-func (p *IdTokenGrantParams) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
+// getVerifier returns the verifier of the ID tokens of the provider and the
+// client IDs they may be issued to: the provider's client ID and the client
+// IDs of its native apps.
+func (p *IdTokenGrantParams) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, []string, error) {
 	config := getConfig(ctx)
 
-	var provider *oidc.Provider
-	var err error
 	var oAuthProvider conf.OAuthProviderConfiguration
-	var oAuthProviderClientId string
+	var clientIDs []string
+	var issuer string
 	switch p.Provider {
 	case "apple":
 		oAuthProvider = config.External.Apple
-		oAuthProviderClientId = config.External.IosBundleId
-		provider, err = oidc.NewProvider(ctx, "https://appleid.apple.com")
+		clientIDs = []string{config.External.IosBundleId, oAuthProvider.ClientID}
+		issuer = "https://appleid.apple.com"
 	case "azure":
 		oAuthProvider = config.External.Azure
-		oAuthProviderClientId = oAuthProvider.ClientID
+		clientIDs = []string{oAuthProvider.ClientID}
 		url := oAuthProvider.URL
 		if url == "" {
 			url = "https://login.microsoftonline.com/common"
 		}
-		provider, err = oidc.NewProvider(ctx, url+"/v2.0")
+		issuer = url + "/v2.0"
 	case "facebook":
 		oAuthProvider = config.External.Facebook
-		oAuthProviderClientId = oAuthProvider.ClientID
-		provider, err = oidc.NewProvider(ctx, "https://www.facebook.com")
+		clientIDs = []string{oAuthProvider.ClientID}
+		issuer = "https://www.facebook.com"
 	case "google":
 		oAuthProvider = config.External.Google
-		oAuthProviderClientId = oAuthProvider.ClientID
-		provider, err = oidc.NewProvider(ctx, "https://accounts.google.com")
+		clientIDs = []string{oAuthProvider.ClientID}
+		issuer = "https://accounts.google.com"
 	case "keycloak":
 		oAuthProvider = config.External.Keycloak
-		oAuthProviderClientId = oAuthProvider.ClientID
-		provider, err = oidc.NewProvider(ctx, oAuthProvider.URL)
+		clientIDs = []string{oAuthProvider.ClientID}
+		issuer = oAuthProvider.URL
 	default:
-		return nil, fmt.Errorf("Provider %s doesn't support the id_token grant flow", p.Provider)
-	}
-
-	if err != nil {
-		return nil, err
+		return nil, nil, badRequestError("Provider %s doesn't support the id_token grant flow", p.Provider)
 	}
 
 	if !oAuthProvider.Enabled {
-		return nil, badRequestError("Provider is not enabled")
+		return nil, nil, badRequestError("Provider is not enabled")
 	}
 
-	return provider.Verifier(&oidc.Config{ClientID: oAuthProviderClientId}), nil
+	oidcProvider, err := provider.OIDCProvider(issuer)
+	if err != nil {
+		return nil, nil, internalServerError("Error discovering the provider %s", p.Provider).WithInternalError(err)
+	}
+	clientIDs = append(clientIDs, oAuthProvider.AdditionalClientIDs...)
+	// the audience is checked against all client IDs at once by
+	// checkIdTokenAudience
+	return oidcProvider.Verifier(&oidc.Config{SkipClientIDCheck: true}), clientIDs, nil
 }
 
-func (p *IdTokenGrantParams) getVerifierFromClientIDandIssuer(ctx context.Context) (*oidc.IDTokenVerifier, error) {
-	var provider *oidc.Provider
+func (p *IdTokenGrantParams) getVerifierFromClientIDandIssuer(ctx context.Context) (*oidc.IDTokenVerifier, []string, error) {
+	var oidcProvider *oidc.Provider
 	var err error
-	provider, err = oidc.NewProvider(ctx, p.Issuer)
+	oidcProvider, err = provider.OIDCProvider(p.Issuer)
 	if err != nil {
-		return nil, fmt.Errorf("Issuer %s doesn't support the id_token grant flow", p.Issuer)
+		return nil, nil, badRequestError("Issuer %s doesn't support the id_token grant flow", p.Issuer)
 	}
-	return provider.Verifier(&oidc.Config{ClientID: p.ClientID}), nil
+	return oidcProvider.Verifier(&oidc.Config{SkipClientIDCheck: true}), []string{p.ClientID}, nil
+}
+
+// checkIdTokenAudience fails unless the ID token was issued to one of
+// clientIDs.
+func checkIdTokenAudience(idToken *oidc.IDToken, clientIDs []string) error {
+	for _, aud := range idToken.Audience {
+		for _, clientID := range clientIDs {
+			if clientID != "" && aud == clientID {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("oidc: expected audience in %q got %q", clientIDs, idToken.Audience)
 }
 
 func getEmailVerified(v interface{}) bool {
@@ -158,6 +219,16 @@ func (a *API) Token(w http.ResponseWriter, r *http.Request) error {
 		return a.RefreshTokenGrant(ctx, w, r)
 	case "id_token":
 		return a.IdTokenGrant(ctx, w, r)
+	case "client_credentials":
+		return a.ClientCredentialsGrant(ctx, w, r)
+	case tokenExchangeGrantType, "token-exchange":
+		return a.TokenExchangeGrant(ctx, w, r)
+	case jwtBearerGrant, "jwt-bearer":
+		return a.JWTBearerGrant(ctx, w, r)
+	case pkceGrant:
+		return a.PKCEGrant(ctx, w, r)
+	case sessionMigrationGrant:
+		return a.SessionMigrationGrant(ctx, w, r)
 	default:
 		return oauthError("unsupported_grant_type", "")
 	}
@@ -175,10 +246,14 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 	aud := a.requestAud(ctx, r)
 	instanceID := getInstanceID(ctx)
 	config := a.getConfig(ctx)
+	db := a.getDB(ctx)
 
 	if params.Email != "" && params.Phone != "" {
 		return unprocessableEntityError("Only an email address or phone number should be provided on login.")
 	}
+	if err := a.checkLockout(r, config, nil); err != nil {
+		return err
+	}
 	var user *models.User
 	var provider string
 	var err error
@@ -187,26 +262,59 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		if !config.External.Email.Enabled {
 			return badRequestError("Email logins are disabled")
 		}
-		user, err = models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+		if config.LDAP.Enabled {
+			provider = ldapProvider
+			user, err = a.authenticateLDAP(ctx, r, params.Email, params.Password, aud)
+		} else {
+			user, err = models.FindUserByEmailAndAudience(db, instanceID, params.Email, aud)
+		}
 	} else if params.Phone != "" {
 		provider = "phone"
 		if !config.External.Phone.Enabled {
 			return badRequestError("Phone logins are disabled")
 		}
 		params.Phone = a.formatPhoneNumber(params.Phone)
-		user, err = models.FindUserByPhoneAndAudience(a.db, instanceID, params.Phone, aud)
+		user, err = models.FindUserByPhoneAndAudience(db, instanceID, params.Phone, aud)
 	} else {
 		return oauthError("invalid_grant", InvalidLoginMessage)
 	}
 
 	if err != nil {
 		if models.IsNotFoundError(err) {
+			// take as long as a wrong password, so unknown users can't be told apart
+			models.AuthenticateUnknownUser(params.Password)
+			a.reportFailedLogin(ctx, r, params)
+			a.recordFailedLogin(ctx, r, config, nil)
 			return oauthError("invalid_grant", InvalidLoginMessage)
 		}
+		if err == directory.ErrInvalidCredentials {
+			a.reportFailedLogin(ctx, r, params)
+			a.recordFailedLogin(ctx, r, config, nil)
+			return oauthError("invalid_grant", InvalidLoginMessage)
+		}
+		if _, ok := err.(*HTTPError); ok {
+			return err
+		}
 		return internalServerError("Database error querying schema").WithInternalError(err)
 	}
 
-	if user.IsBanned() || !user.Authenticate(params.Password) {
+	if err := a.checkLockout(r, config, user); err != nil {
+		return err
+	}
+
+	// the directory has verified the password of LDAP logins already
+	authenticated := provider == ldapProvider || user.Authenticate(params.Password)
+	if !authenticated && !user.IsBanned() {
+		authenticated, err = a.verifyLegacyPassword(r, db, user, params.Password)
+		if err != nil {
+			return err
+		}
+	}
+	if user.IsBanned() || !authenticated {
+		a.reportFailedLogin(ctx, r, params)
+		if !authenticated {
+			a.recordFailedLogin(ctx, r, config, user)
+		}
 		return oauthError("invalid_grant", InvalidLoginMessage)
 	}
 
@@ -217,18 +325,24 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 	}
 
 	var token *AccessTokenResponse
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = db.Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
 			"provider": provider,
 		}); terr != nil {
 			return terr
 		}
+		// rehash imported passwords now that the password is known
+		if config.Security.UpgradePasswordHashes && provider != ldapProvider && user.PasswordNeedsRehash() {
+			if terr = user.UpdatePassword(tx, params.Password); terr != nil {
+				return internalServerError("Database error updating password").WithInternalError(terr)
+			}
+		}
 		if terr = triggerEventHooks(ctx, tx, LoginEvent, user, instanceID, config); terr != nil {
 			return terr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		token, terr = a.issueRefreshToken(ctx, r, tx, user, passwordGrant)
 		if terr != nil {
 			return terr
 		}
@@ -242,12 +356,24 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		return err
 	}
 	metering.RecordLogin("password", user.ID, instanceID)
-	return sendJSON(w, http.StatusOK, token)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, passwordGrant))
+	a.recordSignIn(r, user)
+	return sendToken(w, r, token)
+}
+
+func (a *API) reportFailedLogin(ctx context.Context, r *http.Request, params *PasswordGrantParams) {
+	a.recordAuthEvent(ctx, a.requestAud(ctx, r), loginFailedAuthEvent)
+	a.reportSuspiciousActivity(ctx, FailedLoginSpikeActivity, "", map[string]interface{}{
+		"email":      params.Email,
+		"phone":      params.Phone,
+		"ip_address": utilities.GetIPAddress(r),
+	})
 }
 
 // RefreshTokenGrant implements the refresh_token grant type flow
 func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	config := a.getConfig(ctx)
+	db := a.getDB(ctx)
 	instanceID := getInstanceID(ctx)
 
 	params := &RefreshTokenGrantParams{}
@@ -261,22 +387,37 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		return oauthError("invalid_request", "refresh_token required")
 	}
 
-	user, token, err := models.FindUserWithRefreshToken(a.db, params.RefreshToken)
+	user, token, err := models.FindUserWithRefreshToken(db, params.RefreshToken)
 	if err != nil {
 		if models.IsNotFoundError(err) {
-			return oauthError("invalid_grant", "Invalid Refresh Token")
+			reason, terr := models.FindSignOutReason(db, params.RefreshToken)
+			if terr != nil {
+				return internalServerError("Database error finding refresh token").WithInternalError(terr)
+			}
+			if reason == "" {
+				reason = refreshTokenNotFoundReason
+			}
+			return invalidRefreshTokenError(reason)
 		}
 		return internalServerError(err.Error())
 	}
 
 	if user.IsBanned() {
-		return oauthError("invalid_grant", "Invalid Refresh Token")
+		return invalidRefreshTokenError(userBannedReason)
+	}
+
+	jkt := getDPoPThumbprint(ctx)
+	if token.DPoPJKT != "" && string(token.DPoPJKT) != jkt {
+		return oauthError("invalid_grant", "Refresh token is bound to a DPoP key")
+	}
+	if err := a.checkClientBinding(r, token); err != nil {
+		return err
 	}
 
 	var newToken *models.RefreshToken
 	if token.Revoked {
 		a.clearCookieTokens(config, w)
-		err = a.db.Transaction(func(tx *storage.Connection) error {
+		err = db.Transaction(func(tx *storage.Connection) error {
 			validToken, terr := models.GetValidChildToken(tx, token)
 			if terr != nil {
 				if errors.Is(terr, models.RefreshTokenNotFoundError{}) {
@@ -288,7 +429,7 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 			// check if token is the last previous revoked token
 			if validToken.Parent == storage.NullString(token.Token) {
 				refreshTokenReuseWindow := token.UpdatedAt.Add(time.Second * time.Duration(config.Security.RefreshTokenReuseInterval))
-				if time.Now().Before(refreshTokenReuseWindow) {
+				if clock.Now().Before(refreshTokenReuseWindow) {
 					newToken = validToken
 				}
 			}
@@ -299,27 +440,33 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		}
 
 		if newToken == nil {
-			if config.Security.RefreshTokenRotationEnabled {
-				// Revoke all tokens in token family
-				err = a.db.Transaction(func(tx *storage.Connection) error {
-					var terr error
-					if terr = models.RevokeTokenFamily(tx, token); terr != nil {
-						return terr
-					}
-					return nil
-				})
-				if err != nil {
-					return internalServerError(err.Error())
+			err = db.Transaction(func(tx *storage.Connection) error {
+				if terr := token.MarkReused(tx); terr != nil {
+					return terr
+				}
+				if config.Security.RefreshTokenRotationEnabled {
+					// Revoke all tokens in token family
+					return models.RevokeTokenFamily(tx, token)
 				}
+				return nil
+			})
+			if err != nil {
+				return internalServerError(err.Error())
 			}
-			return oauthError("invalid_grant", "Invalid Refresh Token").WithInternalMessage("Possible abuse attempt: %v", r)
+			a.reportSuspiciousActivity(ctx, RefreshTokenReuseActivity, "", map[string]interface{}{
+				"user_id":    user.ID,
+				"token_id":   token.ID,
+				"ip_address": utilities.GetIPAddress(r),
+			})
+			return invalidRefreshTokenError(refreshTokenReusedReason).WithInternalMessage("Possible abuse attempt: %v", r)
 		}
 	}
 
 	var tokenString string
+	var expiresIn int
 	var newTokenResponse *AccessTokenResponse
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = db.Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.TokenRefreshedAction, "", nil); terr != nil {
 			return terr
@@ -332,15 +479,15 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 			}
 		}
 
-		tokenString, terr = generateAccessToken(user, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret)
+		tokenString, expiresIn, terr = a.generateHookedAccessToken(ctx, tx, user, jkt, refreshTokenGrant, sessionClaim(newToken))
 		if terr != nil {
 			return internalServerError("error generating jwt token").WithInternalError(terr)
 		}
 
 		newTokenResponse = &AccessTokenResponse{
 			Token:        tokenString,
-			TokenType:    "bearer",
-			ExpiresIn:    config.JWT.Exp,
+			TokenType:    accessTokenType(jkt),
+			ExpiresIn:    expiresIn,
 			RefreshToken: newToken.Token,
 			User:         user,
 		}
@@ -354,7 +501,8 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		return err
 	}
 	metering.RecordLogin("token", user.ID, instanceID)
-	return sendJSON(w, http.StatusOK, newTokenResponse)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, refreshTokenGrant))
+	return sendToken(w, r, newTokenResponse)
 }
 
 // IdTokenGrant implements the id_token grant type flow
@@ -378,13 +526,16 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 	}
 
 	var verifier *oidc.IDTokenVerifier
+	var clientIDs []string
 	var err error
+	providerType := params.Provider
 	if params.Provider != "" {
-		verifier, err = params.getVerifier(ctx)
-	} else if params.ClientID != "" && params.Issuer != "" {
-		verifier, err = params.getVerifierFromClientIDandIssuer(ctx)
+		verifier, clientIDs, err = params.getVerifier(ctx)
 	} else {
-		return badRequestError("%v", err)
+		// identities are kept per issuer, so that issuers can't sign in as
+		// the users of each other
+		providerType = params.Issuer
+		verifier, clientIDs, err = params.getVerifierFromClientIDandIssuer(ctx)
 	}
 	if err != nil {
 		return err
@@ -394,6 +545,9 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 	if err != nil {
 		return badRequestError("%v", err)
 	}
+	if err := checkIdTokenAudience(idToken, clientIDs); err != nil {
+		return badRequestError("%v", err)
+	}
 
 	claims := make(map[string]interface{})
 	if err := idToken.Claims(&claims); err != nil {
@@ -408,7 +562,7 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 	if ok && params.Nonce != "" {
 		// verify nonce to mitigate replay attacks
 		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(params.Nonce)))
-		if hash != hashedNonce.(string) {
+		if expected, ok := hashedNonce.(string); !ok || !secureCompare(hash, expected) {
 			return oauthError("invalid nonce", "").WithInternalMessage("Possible abuse attempt: %v", r)
 		}
 	}
@@ -423,13 +577,39 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 		email = ""
 	}
 
+	emailVerified := false
+	if v, ok := claims["email_verified"]; ok {
+		emailVerified = getEmailVerified(v)
+	}
+
+	user, token, err := a.signInExternalIdentity(ctx, r, providerType, sub, email, emailVerified, claims, idTokenGrant)
+	if err != nil {
+		return err
+	}
+
+	if err := a.setCookieTokens(config, token, false, w); err != nil {
+		return internalServerError("Failed to set JWT cookie. %s", err)
+	}
+
+	metering.RecordLogin("id_token", user.ID, instanceID)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, idTokenGrant))
+	a.recordSignIn(r, user)
+	return sendToken(w, r, token)
+}
+
+// signInExternalIdentity signs in the user of the identity sub of
+// providerType, signing the user up with identityData the first time.
+func (a *API) signInExternalIdentity(ctx context.Context, r *http.Request, providerType, sub, email string, emailVerified bool, identityData map[string]interface{}, grantType string) (*models.User, *AccessTokenResponse, error) {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
 	var user *models.User
 	var token *AccessTokenResponse
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err := a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		var identity *models.Identity
 
-		if identity, terr = models.FindIdentityByIdAndProvider(tx, sub, params.Provider); terr != nil {
+		if identity, terr = models.FindIdentityByIdAndProvider(tx, sub, providerType); terr != nil {
 			// create new identity & user if identity is not found
 			if models.IsNotFoundError(terr) {
 				if config.DisableSignup {
@@ -437,17 +617,17 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 				}
 				aud := a.requestAud(ctx, r)
 				signupParams := &SignupParams{
-					Provider: params.Provider,
+					Provider: providerType,
 					Email:    email,
 					Aud:      aud,
-					Data:     claims,
+					Data:     identityData,
 				}
 
 				user, terr = a.signupNewUser(ctx, tx, signupParams)
 				if terr != nil {
 					return terr
 				}
-				if identity, terr = a.createNewIdentity(tx, user, params.Provider, claims); terr != nil {
+				if identity, terr = a.createNewIdentity(tx, user, providerType, identityData); terr != nil {
 					return terr
 				}
 			} else {
@@ -462,7 +642,7 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 				identity.IdentityData["email"] = email
 			}
 			if user.IsBanned() {
-				return oauthError("invalid_grant", "invalid id token grant")
+				return oauthError("invalid_grant", "Invalid grant")
 			}
 			if terr = tx.UpdateOnly(identity, "identity_data", "last_sign_in_at"); terr != nil {
 				return terr
@@ -473,23 +653,18 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 		}
 
 		if !user.IsConfirmed() {
-			isEmailVerified := false
-			emailVerified, ok := claims["email_verified"]
-			if ok {
-				isEmailVerified = getEmailVerified(emailVerified)
-			}
-			if (!ok || !isEmailVerified) && !config.Mailer.Autoconfirm {
+			if !emailVerified && !config.Mailer.Autoconfirm {
 
 				mailer := a.Mailer(ctx)
 				referrer := a.getReferrer(r)
-				if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequency, referrer, config.Mailer.OtpLength); terr != nil {
+				if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequencyFor(conf.ConfirmationEmail), referrer, config.Mailer.OtpLength); terr != nil {
 					return internalServerError("Error sending confirmation mail").WithInternalError(terr)
 				}
 				return unauthorizedError("Error unverified email")
 			}
 
 			if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.UserSignedUpAction, "", map[string]interface{}{
-				"provider": params.Provider,
+				"provider": providerType,
 			}); terr != nil {
 				return terr
 			}
@@ -503,7 +678,7 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 			}
 		} else {
 			if terr := models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
-				"provider": params.Provider,
+				"provider": providerType,
 			}); terr != nil {
 				return terr
 			}
@@ -512,7 +687,7 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 			}
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		token, terr = a.issueRefreshToken(ctx, r, tx, user, grantType)
 		if terr != nil {
 			return oauthError("server_error", terr.Error())
 		}
@@ -520,52 +695,163 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 	})
 
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	return user, token, nil
+}
 
-	if err := a.setCookieTokens(config, token, false, w); err != nil {
-		return internalServerError("Failed to set JWT cookie. %s", err)
+func generateAccessToken(user *models.User, expiresIn time.Duration, secret string) (string, error) {
+	return generateBoundAccessToken(user, expiresIn, &conf.JWTConfiguration{Secret: secret}, "", "", "")
+}
+
+// appMetadataClaims returns the app_metadata of user and the custom claims
+// for an access token. Once JWT_APP_METADATA_CLAIMS is set only those keys
+// make it into the token, as claims prefixed with JWT_CLAIMS_NAMESPACE.
+func appMetadataClaims(config *conf.JWTConfiguration, user *models.User) (map[string]interface{}, map[string]interface{}) {
+	if len(config.AppMetadataClaims) == 0 {
+		return user.AppMetaData, nil
 	}
 
-	metering.RecordLogin("id_token", user.ID, instanceID)
-	return sendJSON(w, http.StatusOK, token)
+	custom := make(map[string]interface{}, len(config.AppMetadataClaims))
+	for _, key := range config.AppMetadataClaims {
+		if value, ok := user.AppMetaData[key]; ok {
+			custom[config.ClaimsNamespace+key] = value
+		}
+	}
+	return map[string]interface{}{}, custom
 }
 
-func generateAccessToken(user *models.User, expiresIn time.Duration, secret string) (string, error) {
+// generateBoundAccessToken generates an access token of the session sessionID
+// issued with grantType that is bound to the DPoP key with thumbprint jkt, or
+// a bearer token if jkt is empty.
+func generateBoundAccessToken(user *models.User, expiresIn time.Duration, config *conf.JWTConfiguration, jkt, grantType, sessionID string) (string, error) {
+	return signAccessToken(accessTokenClaims(user, expiresIn, config, jkt, grantType, sessionID), config)
+}
+
+// accessTokenClaims returns the claims of an access token of user.
+func accessTokenClaims(user *models.User, expiresIn time.Duration, config *conf.JWTConfiguration, jkt, grantType, sessionID string) *GoTrueClaims {
+	appMetaData, customClaims := appMetadataClaims(config, user)
 	claims := &GoTrueClaims{
 		StandardClaims: jwt.StandardClaims{
 			Subject:   user.ID.String(),
 			Audience:  user.Aud,
-			ExpiresAt: time.Now().Add(expiresIn).Unix(),
+			ExpiresAt: clock.Now().Add(expiresIn).Unix(),
 		},
 		Email:        user.GetEmail(),
 		Phone:        user.GetPhone(),
-		AppMetaData:  user.AppMetaData,
+		AppMetaData:  appMetaData,
 		UserMetaData: user.UserMetaData,
 		Role:         user.Role,
+		Roles:        user.AllRoles(),
+		GrantType:    grantType,
+		SessionID:    sessionID,
+		IsAnonymous:  user.IsAnonymous,
+		ShadowBanned: user.IsShadowBanned(),
+		CustomClaims: customClaims,
+	}
+	if jkt != "" {
+		claims.Confirmation = &tokenConfirmation{JKT: jkt}
+	}
+	return claims
+}
+
+// signAccessToken signs claims. Tokens larger than JWT_MAX_SIZE get their
+// metadata claims replaced by a claims reference if JWT_CLAIMS_REFERENCE is
+// enabled, and are logged or refused if that doesn't help.
+func signAccessToken(claims *GoTrueClaims, config *conf.JWTConfiguration) (string, error) {
+	token, err := signWithAccessTokenKey(config, claims)
+	if err != nil || config.MaxSize <= 0 || len(token) <= config.MaxSize {
+		return token, err
+	}
+
+	if config.ClaimsReference {
+		ref, err := claimsReference(userInfoClaims(claims.AppMetaData, claims.UserMetaData, claims.CustomClaims))
+		if err != nil {
+			return "", err
+		}
+		claims.AppMetaData = map[string]interface{}{}
+		claims.UserMetaData = map[string]interface{}{}
+		claims.CustomClaims = nil
+		claims.ClaimsReference = ref
+
+		token, err = signWithAccessTokenKey(config, claims)
+		if err != nil || len(token) <= config.MaxSize {
+			return token, err
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	if config.MaxSizeAction == conf.JWTMaxSizeFail {
+		return "", fmt.Errorf("access token of %d bytes is larger than JWT_MAX_SIZE of %d bytes", len(token), config.MaxSize)
+	}
+	logrus.WithFields(logrus.Fields{
+		"user_id":  claims.Subject,
+		"size":     len(token),
+		"max_size": config.MaxSize,
+	}).Warn("Access token is larger than JWT_MAX_SIZE")
+	return token, nil
 }
 
-func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, user *models.User) (*AccessTokenResponse, error) {
-	config := a.getConfig(ctx)
+// userInfoClaims are the claims a claims reference stands in for.
+func userInfoClaims(appMetaData, userMetaData, customClaims map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"app_metadata":  appMetaData,
+		"user_metadata": userMetaData,
+	}
+	for key, value := range customClaims {
+		if _, ok := claims[key]; !ok {
+			claims[key] = value
+		}
+	}
+	return claims
+}
 
-	now := time.Now()
+// claimsReference identifies a set of claims, so clients can tell whether the
+// claims served at /userinfo changed since the token was issued.
+func claimsReference(claims map[string]interface{}) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// accessTokenType is the token_type of an access token bound to jkt.
+func accessTokenType(jkt string) string {
+	if jkt != "" {
+		return dpopTokenType
+	}
+	return "bearer"
+}
+
+func (a *API) issueRefreshToken(ctx context.Context, r *http.Request, conn *storage.Connection, user *models.User, grantType string) (*AccessTokenResponse, error) {
+	jkt := getDPoPThumbprint(ctx)
+
+	now := clock.Now()
 	user.LastSignInAt = &now
 
 	var tokenString string
+	var expiresIn int
 	var refreshToken *models.RefreshToken
 
 	err := conn.Transaction(func(tx *storage.Connection) error {
 		var terr error
-		refreshToken, terr = models.GrantAuthenticatedUser(tx, user)
+		refreshToken, terr = models.GrantAuthenticatedUser(r, tx, user)
 		if terr != nil {
 			return internalServerError("Database error granting user").WithInternalError(terr)
 		}
+		if jkt != "" {
+			if terr = refreshToken.BindDPoP(tx, jkt); terr != nil {
+				return internalServerError("Database error granting user").WithInternalError(terr)
+			}
+		}
+		if fingerprint := getClientFingerprint(ctx); fingerprint != "" {
+			if terr = refreshToken.BindClient(tx, fingerprint); terr != nil {
+				return internalServerError("Database error granting user").WithInternalError(terr)
+			}
+		}
 
-		tokenString, terr = generateAccessToken(user, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret)
+		tokenString, expiresIn, terr = a.generateHookedAccessToken(ctx, tx, user, jkt, grantType, sessionClaim(refreshToken))
 		if terr != nil {
 			return internalServerError("error generating jwt token").WithInternalError(terr)
 		}
@@ -574,11 +860,14 @@ func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, u
 	if err != nil {
 		return nil, err
 	}
+	if user.IsShadowBanned() {
+		a.notifyShadowBannedSignIn(ctx, r, conn, user)
+	}
 
 	return &AccessTokenResponse{
 		Token:        tokenString,
-		TokenType:    "bearer",
-		ExpiresIn:    config.JWT.Exp,
+		TokenType:    accessTokenType(jkt),
+		ExpiresIn:    expiresIn,
 		RefreshToken: refreshToken.Token,
 		User:         user,
 	}, nil
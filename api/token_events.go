@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TokenIssuedEvent = "token_issued"
+
+	// GoTrue has no second factor yet, so every token is issued at aal1
+	aal1 = "aal1"
+
+	// maxTokenEventDeliveries is how many token events are sent to the sink at
+	// once. Events are dropped rather than queued when the sink can't keep up.
+	maxTokenEventDeliveries = 100
+)
+
+// Grant types access tokens are tagged with in their gty claim, besides the
+// verification types for tokens issued by /verify.
+const (
+	passwordGrant          = "password"
+	refreshTokenGrant      = "refresh_token"
+	idTokenGrant           = "id_token"
+	externalGrant          = "external"
+	authorizationCodeGrant = "authorization_code"
+	clientCredentialsGrant = "client_credentials"
+	jwtBearerGrant         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	kerberosGrant          = "kerberos"
+	pkceGrant              = "pkce"
+	anonymousGrant         = "anonymous"
+	sessionMigrationGrant  = "session_migration"
+)
+
+// TokenIssuance describes an issued access token and is sent to the token events sink.
+type TokenIssuance struct {
+	Event      string    `json:"event"`
+	InstanceID uuid.UUID `json:"instance_id,omitempty"`
+	Subject    string    `json:"sub"`
+	Audience   string    `json:"aud"`
+	GrantType  string    `json:"grant_type"`
+	AAL        string    `json:"aal"`
+	ClientID   string    `json:"client_id,omitempty"`
+	IssuedAt   time.Time `json:"issued_at"`
+}
+
+// userTokenIssuance describes an access token issued to user with grantType.
+func userTokenIssuance(user *models.User, grantType string) *TokenIssuance {
+	return &TokenIssuance{
+		Subject:   user.ID.String(),
+		Audience:  user.Aud,
+		GrantType: grantType,
+	}
+}
+
+// claimsTokenIssuance describes the access token with claims.
+func claimsTokenIssuance(claims *GoTrueClaims) *TokenIssuance {
+	return &TokenIssuance{
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		GrantType: claims.GrantType,
+		ClientID:  claims.ClientID,
+	}
+}
+
+// recordTokenIssued meters an issued access token and sends it to the token
+// events sink, if one is configured, so anomalous issuance patterns can be
+// detected. It must only be called once the token was handed out.
+func (a *API) recordTokenIssued(ctx context.Context, issuance *TokenIssuance) {
+	issuance.Event = TokenIssuedEvent
+	issuance.InstanceID = getInstanceID(ctx)
+	issuance.AAL = aal1
+	issuance.IssuedAt = time.Now()
+
+	metering.RecordTokenIssued(issuance.GrantType, issuance.AAL, issuance.ClientID, issuance.Audience, issuance.Subject, issuance.InstanceID)
+
+	config := a.getConfig(ctx)
+	if config.Security.TokenEvents.WebhookURL == "" {
+		return
+	}
+
+	select {
+	case a.tokenEventDeliveries <- struct{}{}:
+		// the event must not hold up the request that issued the token, nor be
+		// cancelled with it, so it only keeps the request ID
+		go func() {
+			defer func() { <-a.tokenEventDeliveries }()
+			a.sendTokenIssuance(getRequestID(ctx), config, issuance)
+		}()
+	default:
+		logrus.WithFields(logrus.Fields{
+			"component":   "token_events",
+			"request_id":  getRequestID(ctx),
+			"instance_id": issuance.InstanceID,
+		}).Warn("Dropped token issuance event, too many deliveries in flight")
+	}
+}
+
+func (a *API) sendTokenIssuance(requestID string, config *conf.Configuration, issuance *TokenIssuance) {
+	eventsConfig := config.Security.TokenEvents
+	eventLog := logrus.WithFields(logrus.Fields{
+		"component":   "token_events",
+		"request_id":  requestID,
+		"instance_id": issuance.InstanceID,
+		"grant_type":  issuance.GrantType,
+	})
+
+	data, err := json.Marshal(issuance)
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to serialize token issuance event")
+		return
+	}
+	sha, err := checksum(data)
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to checksum token issuance event")
+		return
+	}
+
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{URL: eventsConfig.WebhookURL, Retries: 1},
+		jwtSecret:     eventsConfig.WebhookSecret,
+		instanceID:    issuance.InstanceID,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  issuance.InstanceID.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: data,
+		headers: requestIDHeaders(requestID),
+	}
+	body, err := w.trigger()
+	if body != nil {
+		body.Close()
+	}
+	if err != nil {
+		eventLog.WithError(err).Error("Failed to send token issuance event")
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenTokenType   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// TokenExchangeGrantParams are the parameters the TokenExchangeGrant method accepts, see RFC 8693 section 2.1
+type TokenExchangeGrantParams struct {
+	SubjectToken     string `json:"subject_token"`
+	SubjectTokenType string `json:"subject_token_type"`
+	ActorToken       string `json:"actor_token"`
+	ActorTokenType   string `json:"actor_token_type"`
+	Audience         string `json:"audience"`
+	Scope            string `json:"scope"`
+}
+
+// TokenExchangeResponse is the response of a token exchange, see RFC 8693 section 2.2.1
+type TokenExchangeResponse struct {
+	Token           string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// tokenActor is the act claim identifying the service a token was delegated to, see RFC 8693 section 4.1
+type tokenActor struct {
+	Subject string `json:"sub,omitempty"`
+	Role    string `json:"role"`
+}
+
+// parseExchangedToken parses a first-party token presented for a token exchange.
+func (a *API) parseExchangedToken(config *conf.Configuration, tokenType, tokenString string) (*GoTrueClaims, error) {
+	if tokenType != accessTokenTokenType {
+		return nil, oauthError("invalid_request", "Only access tokens can be exchanged")
+	}
+	claims := &GoTrueClaims{}
+	_, err := parseAccessToken(&config.JWT, tokenString, claims)
+	if err != nil || !a.isFirstPartyToken(claims) {
+		return nil, oauthError("invalid_grant", "Invalid token")
+	}
+	return claims, nil
+}
+
+// TokenExchangeGrant lets a trusted service exchange a user's access token for
+// a narrowed token it can act on the user's behalf with: a shorter lifetime,
+// optionally fewer scopes and another audience, and an act claim naming the
+// service. Delegated tokens are not accepted by GoTrue itself.
+func (a *API) TokenExchangeGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.TokenExchange.Enabled {
+		return oauthError("unsupported_grant_type", "")
+	}
+
+	params := &TokenExchangeGrantParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read token exchange params: %v", err)
+	}
+	if params.SubjectToken == "" || params.ActorToken == "" {
+		return oauthError("invalid_request", "subject_token and actor_token required")
+	}
+
+	actor, err := a.parseExchangedToken(config, params.ActorTokenType, params.ActorToken)
+	if err != nil {
+		return err
+	}
+	if !isStringInSlice(actor.Role, config.TokenExchange.ActorRoles) {
+		return oauthError("unauthorized_client", "Actor is not allowed to exchange tokens")
+	}
+
+	subject, err := a.parseExchangedToken(config, params.SubjectTokenType, params.SubjectToken)
+	if err != nil {
+		return err
+	}
+	if subject.Confirmation != nil {
+		return oauthError("invalid_grant", "DPoP-bound tokens cannot be exchanged")
+	}
+	userID, err := uuid.FromString(subject.Subject)
+	if err != nil {
+		return oauthError("invalid_grant", "Invalid token")
+	}
+	user, err := models.FindUserByInstanceIDAndID(a.getDB(ctx), instanceID, userID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_grant", "Invalid token")
+		}
+		return internalServerError("Database error finding user").WithInternalError(err)
+	}
+	if user.IsBanned() {
+		return oauthError("invalid_grant", "Invalid token")
+	}
+
+	audience := subject.Audience
+	if params.Audience != "" && params.Audience != subject.Audience {
+		if !isStringInSlice(params.Audience, config.TokenExchange.AllowedAudiences) {
+			return oauthError("invalid_target", "Audience is not allowed")
+		}
+		audience = params.Audience
+	}
+
+	// scopes can only be narrowed, never added to a token that already has them
+	scope := subject.Scope
+	if params.Scope != "" {
+		for _, s := range strings.Fields(params.Scope) {
+			if subject.Scope != "" && !isStringInSlice(s, strings.Fields(subject.Scope)) {
+				return oauthError("invalid_scope", "Scope is not granted to the subject token: "+s)
+			}
+		}
+		scope = strings.Join(strings.Fields(params.Scope), " ")
+	}
+
+	expiresAt := clock.Now().Add(config.TokenExchange.MaxLifetime)
+	if subject.ExpiresAt < expiresAt.Unix() {
+		expiresAt = time.Unix(subject.ExpiresAt, 0)
+	}
+
+	appMetaData, customClaims := appMetadataClaims(&config.JWT, user)
+	claims := &GoTrueClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   user.ID.String(),
+			Audience:  audience,
+			ExpiresAt: expiresAt.Unix(),
+		},
+		Email:        user.GetEmail(),
+		Phone:        user.GetPhone(),
+		AppMetaData:  appMetaData,
+		Role:         user.Role,
+		Roles:        user.AllRoles(),
+		Scope:        scope,
+		Actor:        &tokenActor{Subject: actor.Subject, Role: actor.Role},
+		GrantType:    tokenExchangeGrantType,
+		CustomClaims: customClaims,
+	}
+	tokenString, err := signWithAccessTokenKey(&config.JWT, claims)
+	if err != nil {
+		return internalServerError("error generating jwt token").WithInternalError(err)
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
+		return models.NewAuditLogEntry(r, tx, instanceID, user, models.TokenExchangedAction, "", map[string]interface{}{
+			"actor_sub":  actor.Subject,
+			"actor_role": actor.Role,
+			"audience":   audience,
+			"scope":      scope,
+		})
+	})
+	if err != nil {
+		return internalServerError("Database error exchanging token").WithInternalError(err)
+	}
+	a.recordTokenIssued(ctx, claimsTokenIssuance(claims))
+
+	return sendJSON(w, http.StatusOK, &TokenExchangeResponse{
+		Token:           tokenString,
+		IssuedTokenType: accessTokenTokenType,
+		TokenType:       "bearer",
+		ExpiresIn:       int(time.Until(expiresAt).Seconds()),
+		Scope:           scope,
+	})
+}
@@ -2,14 +2,23 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/models"
 	"github.com/stretchr/testify/assert"
@@ -53,7 +62,7 @@ func (ts *TokenTestSuite) SetupTest() {
 	u.BannedUntil = nil
 	require.NoError(ts.T(), ts.API.db.Create(u), "Error saving new test user")
 
-	ts.RefreshToken, err = models.GrantAuthenticatedUser(ts.API.db, u)
+	ts.RefreshToken, err = models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
 	require.NoError(ts.T(), err, "Error creating refresh token")
 }
 
@@ -100,7 +109,45 @@ func (ts *TokenTestSuite) TestTokenPasswordGrantSuccess() {
 
 	w := httptest.NewRecorder()
 	ts.API.handler.ServeHTTP(w, req)
-	assert.Equal(ts.T(), http.StatusOK, w.Code)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	// the access token is tagged with the grant it was issued with
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	claims := &GoTrueClaims{}
+	_, err := jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), passwordGrant, claims.GrantType)
+}
+
+func (ts *TokenTestSuite) TestTokenExpiryByAudience() {
+	ts.Config.JWT.ExpByAud = map[string]int{ts.Config.JWT.Aud: 300}
+	defer func() { ts.Config.JWT.ExpByAud = nil }()
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "password",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	assert.Equal(ts.T(), 300, token.ExpiresIn)
+	claims := &GoTrueClaims{}
+	_, err := jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.InDelta(ts.T(), time.Now().Add(300*time.Second).Unix(), claims.ExpiresAt, 5)
 }
 
 func (ts *TokenTestSuite) TestTokenRefreshTokenGrantSuccess() {
@@ -134,6 +181,47 @@ func (ts *TokenTestSuite) TestTokenPasswordGrantFailure() {
 	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
 }
 
+func (ts *TokenTestSuite) TestTokenPasswordGrantLockout() {
+	ts.Config.Security.Lockout = conf.LockoutConfiguration{Enabled: true, MaxAttempts: 3, IPMaxAttempts: 5, Window: time.Minute, Duration: time.Minute}
+	defer func() { ts.Config.Security.Lockout = conf.LockoutConfiguration{} }()
+
+	signIn := func(email, password string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    email,
+			"password": password,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(ts.T(), http.StatusBadRequest, signIn("test@example.com", "wrong").Code)
+	}
+	// the right password doesn't help while the account is locked
+	w := signIn("test@example.com", "password")
+	require.Equal(ts.T(), http.StatusTooManyRequests, w.Code)
+	e := &HTTPError{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(e))
+	assert.Equal(ts.T(), "account_locked", e.Details["reason"])
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), u.IsLocked())
+
+	// failures of unknown users count towards the IP address
+	for i := 0; i < 2; i++ {
+		assert.Equal(ts.T(), http.StatusBadRequest, signIn("unknown@example.com", "wrong").Code)
+	}
+	w = signIn("unknown@example.com", "wrong")
+	require.Equal(ts.T(), http.StatusTooManyRequests, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(e))
+	assert.Equal(ts.T(), "ip_locked", e.Details["reason"])
+}
+
 func (ts *TokenTestSuite) TestTokenRefreshTokenGrantFailure() {
 	_ = ts.createBannedUser()
 
@@ -150,13 +238,47 @@ func (ts *TokenTestSuite) TestTokenRefreshTokenGrantFailure() {
 	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
 }
 
+func (ts *TokenTestSuite) TestTokenRefreshSignOutReasons() {
+	refresh := func(token string) string {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"refresh_token": token,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+		data := OAuthError{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+		require.Equal(ts.T(), "invalid_grant", data.Err)
+		return data.Details["reason"].(string)
+	}
+
+	assert.Equal(ts.T(), "refresh_token_not_found", refresh("unknown"))
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	require.NoError(ts.T(), models.Logout(ts.API.db, ts.instanceID, u.ID, models.SignOutReasonAdmin))
+	assert.Equal(ts.T(), models.SignOutReasonAdmin, refresh(ts.RefreshToken.Token))
+
+	token, err := models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
+	require.NoError(ts.T(), err)
+	until := time.Now().Add(time.Hour)
+	u.BannedUntil = &until
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(u, "banned_until"))
+	assert.Equal(ts.T(), "user_banned", refresh(token.Token))
+}
+
 func (ts *TokenTestSuite) TestTokenRefreshTokenRotation() {
 	u, err := models.NewUser(ts.instanceID, "", "foo@example.com", "password", ts.Config.JWT.Aud, nil)
 	require.NoError(ts.T(), err, "Error creating test user model")
 	t := time.Now()
 	u.EmailConfirmedAt = &t
 	require.NoError(ts.T(), ts.API.db.Create(u), "Error saving foo user")
-	first, err := models.GrantAuthenticatedUser(ts.API.db, u)
+	first, err := models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
 	require.NoError(ts.T(), err)
 	second, err := models.GrantRefreshTokenSwap(&http.Request{}, ts.API.db, u, first)
 	require.NoError(ts.T(), err)
@@ -190,6 +312,7 @@ func (ts *TokenTestSuite) TestTokenRefreshTokenRotation() {
 			map[string]interface{}{
 				"error":             "invalid_grant",
 				"error_description": "Invalid Refresh Token",
+				"details":           map[string]interface{}{"reason": "refresh_token_reused"},
 			},
 		},
 		{
@@ -201,6 +324,7 @@ func (ts *TokenTestSuite) TestTokenRefreshTokenRotation() {
 			map[string]interface{}{
 				"error":             "invalid_grant",
 				"error_description": "Invalid Refresh Token",
+				"details":           map[string]interface{}{"reason": "refresh_token_reused"},
 			},
 		},
 		{
@@ -212,6 +336,7 @@ func (ts *TokenTestSuite) TestTokenRefreshTokenRotation() {
 			map[string]interface{}{
 				"error":             "invalid_grant",
 				"error_description": "Invalid Refresh Token",
+				"details":           map[string]interface{}{"reason": "refresh_token_reused"},
 			},
 		},
 	}
@@ -239,6 +364,200 @@ func (ts *TokenTestSuite) TestTokenRefreshTokenRotation() {
 	}
 }
 
+func (ts *TokenTestSuite) TestDPoPBoundTokens() {
+	ts.Config.Security.DPoP.Enabled = true
+	defer func() { ts.Config.Security.DPoP.Enabled = false }()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(ts.T(), err)
+	baseURL := strings.TrimSuffix(ts.API.config.API.ExternalURL, "/")
+
+	grant := func(grantType string, params map[string]interface{}, proof string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(params))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type="+grantType, &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		if proof != "" {
+			req.Header.Set(dpopHeader, proof)
+		}
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+	getUser := func(scheme, token, proof string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+		req.Header.Set("Authorization", scheme+" "+token)
+		if proof != "" {
+			req.Header.Set(dpopHeader, proof)
+		}
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	w := grant("password", map[string]interface{}{"email": "test@example.com", "password": "password"},
+		testDPoPProof(ts.T(), key, &key.PublicKey, http.MethodPost, baseURL+"/token", "", time.Now()))
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	assert.Equal(ts.T(), "DPoP", token.TokenType)
+
+	// a stolen token is useless without the private key
+	assert.Equal(ts.T(), http.StatusUnauthorized, getUser("Bearer", token.Token, ""))
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), http.StatusUnauthorized, getUser("DPoP", token.Token, testDPoPProof(ts.T(), other, &other.PublicKey, http.MethodGet, baseURL+"/user", token.Token, time.Now())))
+
+	proof := testDPoPProof(ts.T(), key, &key.PublicKey, http.MethodGet, baseURL+"/user", token.Token, time.Now())
+	assert.Equal(ts.T(), http.StatusOK, getUser("DPoP", token.Token, proof))
+	assert.Equal(ts.T(), http.StatusUnauthorized, getUser("DPoP", token.Token, proof), "proofs can only be used once")
+
+	// the refresh token is bound to the same key
+	refresh := map[string]interface{}{"refresh_token": token.RefreshToken}
+	assert.Equal(ts.T(), http.StatusBadRequest, grant("refresh_token", refresh, "").Code)
+	assert.Equal(ts.T(), http.StatusBadRequest, grant("refresh_token", refresh, testDPoPProof(ts.T(), other, &other.PublicKey, http.MethodPost, baseURL+"/token", "", time.Now())).Code)
+	w = grant("refresh_token", refresh, testDPoPProof(ts.T(), key, &key.PublicKey, http.MethodPost, baseURL+"/token", "", time.Now()))
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	assert.Equal(ts.T(), "DPoP", token.TokenType)
+}
+
+func (ts *TokenTestSuite) TestTokenExchangeGrant() {
+	ts.Config.TokenExchange.Enabled = true
+	ts.Config.TokenExchange.AllowedAudiences = []string{"billing"}
+	defer func() {
+		ts.Config.TokenExchange.Enabled = false
+		ts.Config.TokenExchange.AllowedAudiences = nil
+	}()
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	userToken, err := generateAccessToken(u, time.Hour, ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+	serviceToken, err := generateAccessToken(&models.User{Role: "service_role"}, time.Hour, ts.Config.JWT.Secret)
+	require.NoError(ts.T(), err)
+
+	exchange := func(params map[string]interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(params))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type="+tokenExchangeGrantType, &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+	params := func(actorToken, audience string) map[string]interface{} {
+		return map[string]interface{}{
+			"subject_token":      userToken,
+			"subject_token_type": accessTokenTokenType,
+			"actor_token":        actorToken,
+			"actor_token_type":   accessTokenTokenType,
+			"audience":           audience,
+			"scope":              "invoices:read",
+		}
+	}
+
+	// only trusted services can act on behalf of a user
+	assert.Equal(ts.T(), http.StatusBadRequest, exchange(params(userToken, "billing")).Code)
+	assert.Equal(ts.T(), http.StatusBadRequest, exchange(params(serviceToken, "admin")).Code)
+
+	w := exchange(params(serviceToken, "billing"))
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	rsp := TokenExchangeResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&rsp))
+	assert.Equal(ts.T(), accessTokenTokenType, rsp.IssuedTokenType)
+	assert.LessOrEqual(ts.T(), rsp.ExpiresIn, int(ts.Config.TokenExchange.MaxLifetime.Seconds()))
+
+	claims := &GoTrueClaims{}
+	_, err = jwt.ParseWithClaims(rsp.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), u.ID.String(), claims.Subject)
+	assert.Equal(ts.T(), "billing", claims.Audience)
+	assert.Equal(ts.T(), "invoices:read", claims.Scope)
+	require.NotNil(ts.T(), claims.Actor)
+	assert.Equal(ts.T(), "service_role", claims.Actor.Role)
+
+	// the delegated token can't be used at GoTrue's own endpoints or exchanged again
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+	req.Header.Set("Authorization", "Bearer "+rsp.Token)
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+
+	userToken = rsp.Token
+	assert.Equal(ts.T(), http.StatusBadRequest, exchange(params(serviceToken, "billing")).Code)
+}
+
+func (ts *TokenTestSuite) TestJWTBearerGrant() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(ts.T(), err)
+	publicKey, err := jwk.New(&key.PublicKey)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), publicKey.Set(jwk.KeyIDKey, "trusted"))
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(ts.T(), json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{publicKey}}))
+	}))
+	defer jwks.Close()
+
+	ts.Config.TrustedIssuers = conf.TrustedIssuers{{
+		Name:     "corp",
+		Issuer:   "https://idp.example.com",
+		Audience: "gotrue",
+		JWKSURL:  jwks.URL,
+		Claims:   map[string]string{"department": "dept"},
+	}}
+	defer func() { ts.Config.TrustedIssuers = nil }()
+
+	assertion := func(iss string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            iss,
+			"aud":            "gotrue",
+			"sub":            "employee-1",
+			"email":          "employee@example.com",
+			"email_verified": true,
+			"dept":           "finance",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "trusted"
+		signed, err := token.SignedString(key)
+		require.NoError(ts.T(), err)
+		return signed
+	}
+	grant := func(assertion string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{"assertion": assertion}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type="+jwtBearerGrant, &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(ts.T(), http.StatusBadRequest, grant(assertion("https://evil.example.com")).Code)
+
+	// the user is provisioned on first use and signed in afterwards
+	var userID uuid.UUID
+	for i := 0; i < 2; i++ {
+		w := grant(assertion("https://idp.example.com"))
+		require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+		token := AccessTokenResponse{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+		assert.NotEmpty(ts.T(), token.RefreshToken)
+		assert.Equal(ts.T(), "employee@example.com", token.User.GetEmail())
+		assert.Equal(ts.T(), "finance", token.User.UserMetaData["department"])
+		if i == 0 {
+			userID = token.User.ID
+		}
+		assert.Equal(ts.T(), userID, token.User.ID)
+	}
+
+	identity, err := models.FindIdentityByIdAndProvider(ts.API.db, "employee-1", "corp")
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), userID, identity.UserID)
+}
+
 func (ts *TokenTestSuite) createBannedUser() *models.User {
 	u, err := models.NewUser(ts.instanceID, "", "banned@example.com", "password", ts.Config.JWT.Aud, nil)
 	require.NoError(ts.T(), err, "Error creating test user model")
@@ -248,8 +567,226 @@ func (ts *TokenTestSuite) createBannedUser() *models.User {
 	u.BannedUntil = &t
 	require.NoError(ts.T(), ts.API.db.Create(u), "Error saving new test banned user")
 
-	ts.RefreshToken, err = models.GrantAuthenticatedUser(ts.API.db, u)
+	ts.RefreshToken, err = models.GrantAuthenticatedUser(&http.Request{}, ts.API.db, u)
 	require.NoError(ts.T(), err, "Error creating refresh token")
 
 	return u
 }
+
+func TestGenerateAccessTokenAppMetadataClaims(t *testing.T) {
+	user := &models.User{
+		Role: "authenticated",
+		AppMetaData: map[string]interface{}{
+			"provider":    "email",
+			"plan":        "pro",
+			"internal_id": "1234",
+		},
+	}
+	config := &conf.JWTConfiguration{
+		Secret:            "secret",
+		AppMetadataClaims: []string{"plan", "tier"},
+		ClaimsNamespace:   "https://example.com/",
+	}
+
+	token, err := generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.Secret), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pro", claims["https://example.com/plan"])
+	assert.NotContains(t, claims, "https://example.com/tier")
+	assert.Equal(t, map[string]interface{}{}, claims["app_metadata"])
+	assert.Equal(t, "authenticated", claims["role"])
+}
+
+func TestGenerateAccessTokenMaxSize(t *testing.T) {
+	groups := make([]interface{}, 0, 100)
+	for i := 0; i < 100; i++ {
+		groups = append(groups, fmt.Sprintf("group-%d", i))
+	}
+	user := &models.User{
+		Role:         "authenticated",
+		AppMetaData:  map[string]interface{}{"groups": groups},
+		UserMetaData: map[string]interface{}{"full_name": "Test User"},
+	}
+	config := &conf.JWTConfiguration{
+		Secret:          "secret",
+		MaxSize:         1024,
+		MaxSizeAction:   conf.JWTMaxSizeFail,
+		ClaimsReference: true,
+	}
+
+	token, err := generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(token), config.MaxSize)
+
+	claims := &GoTrueClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.Secret), nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, claims.AppMetaData)
+	assert.Empty(t, claims.UserMetaData)
+	ref, err := claimsReference(userInfoClaims(user.AppMetaData, user.UserMetaData, nil))
+	require.NoError(t, err)
+	assert.Equal(t, ref, claims.ClaimsReference)
+
+	config.ClaimsReference = false
+	_, err = generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	assert.Error(t, err)
+
+	config.MaxSizeAction = conf.JWTMaxSizeWarn
+	_, err = generateBoundAccessToken(user, time.Minute, config, "", passwordGrant, "")
+	assert.NoError(t, err)
+}
+
+func (ts *TokenTestSuite) TestSessions() {
+	signIn := func(userAgent string) *AccessTokenResponse {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    "test@example.com",
+			"password": "password",
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusOK, w.Code)
+		token := &AccessTokenResponse{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+		return token
+	}
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	laptop := signIn("laptop")
+	phone := signIn("phone")
+
+	w := request(http.MethodGet, "/sessions", laptop.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := struct {
+		Sessions []struct {
+			ID        string `json:"id"`
+			UserAgent string `json:"user_agent"`
+			Current   bool   `json:"current"`
+		} `json:"sessions"`
+	}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	// the session of the SetupTest refresh token is listed too
+	require.Len(ts.T(), data.Sessions, 3)
+	var phoneSession string
+	for _, session := range data.Sessions {
+		assert.Equal(ts.T(), session.UserAgent == "laptop", session.Current)
+		if session.UserAgent == "phone" {
+			phoneSession = session.ID
+		}
+	}
+	require.NotEmpty(ts.T(), phoneSession)
+
+	// unknown sessions aren't found
+	w = request(http.MethodDelete, "/sessions/"+ts.RefreshToken.SessionID.UUID.String(), laptop.Token)
+	assert.Equal(ts.T(), http.StatusNoContent, w.Code)
+	w = request(http.MethodDelete, "/sessions/"+uuid.Must(uuid.NewV4()).String(), laptop.Token)
+	assert.Equal(ts.T(), http.StatusNotFound, w.Code)
+
+	w = request(http.MethodDelete, "/sessions/"+phoneSession, laptop.Token)
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	// the revoked session can't be refreshed, the other one can
+	refresh := func(refreshToken string) int {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"refresh_token": refreshToken,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(ts.T(), http.StatusBadRequest, refresh(phone.RefreshToken))
+	assert.Equal(ts.T(), http.StatusOK, refresh(laptop.RefreshToken))
+
+	w = request(http.MethodGet, "/sessions", laptop.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Sessions, 1)
+	assert.Equal(ts.T(), "laptop", data.Sessions[0].UserAgent)
+}
+
+func TestIdTokenVerifier(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var issuer string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":                                issuer,
+				"jwks_uri":                              issuer + "/jwks",
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			}))
+		case "/jwks":
+			key, err := jwk.New(&priv.PublicKey)
+			require.NoError(t, err)
+			require.NoError(t, key.Set(jwk.KeyIDKey, "key"))
+			require.NoError(t, json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{key}}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	issuer = server.URL
+
+	config := &conf.Configuration{}
+	config.External.Keycloak = conf.OAuthProviderConfiguration{
+		URL:                 issuer,
+		ClientID:            "web-client",
+		AdditionalClientIDs: []string{"ios-client"},
+	}
+	ctx := withConfig(context.Background(), config)
+	idToken := func(aud string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+			Issuer:    issuer,
+			Subject:   "123",
+			Audience:  aud,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(priv)
+		require.NoError(t, err)
+		return signed
+	}
+
+	params := &IdTokenGrantParams{Provider: "keycloak"}
+	_, _, err = params.getVerifier(ctx)
+	assert.Error(t, err, "disabled providers are rejected")
+
+	config.External.Keycloak.Enabled = true
+	verifier, clientIDs, err := params.getVerifier(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web-client", "ios-client"}, clientIDs)
+
+	// tokens of native apps are accepted next to those of the web client
+	for _, aud := range []string{"web-client", "ios-client"} {
+		token, err := verifier.Verify(ctx, idToken(aud))
+		require.NoError(t, err)
+		assert.NoError(t, checkIdTokenAudience(token, clientIDs))
+	}
+	token, err := verifier.Verify(ctx, idToken("other-client"))
+	require.NoError(t, err)
+	assert.Error(t, checkIdTokenAudience(token, clientIDs))
+
+	_, _, err = (&IdTokenGrantParams{Provider: "github"}).getVerifier(ctx)
+	assert.Error(t, err)
+}
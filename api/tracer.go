@@ -63,3 +63,13 @@ func tracer(next http.Handler) http.Handler {
 		}
 	})
 }
+
+// finishSpan finishes a span of a call to another service, marking it failed
+// if err is set.
+func finishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "message", err.Error())
+	}
+	span.Finish()
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/storage/test"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/stretchr/testify/assert"
@@ -61,3 +65,46 @@ func (ts *TracerTestSuite) TestTracer_Spans() {
 		assert.NotEmpty(ts.T(), spans[1].Tag("http.request_id"))
 	}
 }
+
+func TestTracer_DatabaseSpans(t *testing.T) {
+	globalConfig, err := conf.LoadGlobal(apiTestConfig)
+	require.NoError(t, err)
+	globalConfig.Tracing.Enabled = true
+	conn, err := test.SetupDBConnection(globalConfig)
+	require.NoError(t, err)
+	defer conn.Close()
+	config, err := conf.LoadConfig(apiTestConfig)
+	require.NoError(t, err)
+	ctx, err := WithInstanceConfig(context.Background(), config, uuid.Nil)
+	require.NoError(t, err)
+	api := NewAPIWithVersion(ctx, globalConfig, conn, apiTestVersion)
+
+	mt := mocktracer.New()
+	opentracing.SetGlobalTracer(mt)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	var buffer bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"type":  signupVerification,
+		"token": "unknown-token",
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/verify", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	api.handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the queries of endpoints other than /token are traced as part of the request too
+	var requestSpan *mocktracer.MockSpan
+	var querySpans []*mocktracer.MockSpan
+	for _, span := range mt.FinishedSpans() {
+		if span.Tag("http.url") == "/verify" {
+			requestSpan = span
+		} else if span.Tag("db.type") == "sql" {
+			querySpans = append(querySpans, span)
+		}
+	}
+	require.NotNil(t, requestSpan)
+	require.NotEmpty(t, querySpans)
+	for _, span := range querySpans {
+		assert.Equal(t, requestSpan.SpanContext.TraceID, span.SpanContext.TraceID)
+	}
+}
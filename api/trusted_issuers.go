@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/metering"
+)
+
+// JWTBearerGrantParams are the parameters the JWTBearerGrant method accepts, see RFC 7523 section 2.1
+type JWTBearerGrantParams struct {
+	Assertion string `json:"assertion"`
+}
+
+// trustedIdentity is the user a trusted issuer's token was issued to.
+type trustedIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Data          map[string]interface{}
+}
+
+// JWTBearerGrant exchanges a token of a trusted issuer for a session of the
+// user it was issued to. The user is created the first time.
+func (a *API) JWTBearerGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if len(config.TrustedIssuers) == 0 {
+		return oauthError("unsupported_grant_type", "")
+	}
+
+	params := &JWTBearerGrantParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read jwt bearer grant params: %v", err)
+	}
+	if params.Assertion == "" {
+		return oauthError("invalid_request", "assertion required")
+	}
+
+	issuer, err := findTrustedIssuer(config, params.Assertion)
+	if err != nil {
+		return err
+	}
+	verifier, err := trustedIssuerVerifier(issuer)
+	if err != nil {
+		return internalServerError("Error loading trusted issuer keys").WithInternalError(err)
+	}
+	token, err := verifier.Verify(ctx, params.Assertion)
+	if err != nil {
+		return oauthError("invalid_grant", "Invalid assertion").WithInternalError(err)
+	}
+	claims := make(map[string]interface{})
+	if err := token.Claims(&claims); err != nil {
+		return oauthError("invalid_grant", "Invalid assertion").WithInternalError(err)
+	}
+	identity, err := mapTrustedIdentity(issuer, claims)
+	if err != nil {
+		return err
+	}
+
+	user, session, err := a.signInExternalIdentity(ctx, r, issuer.Name, identity.Subject, identity.Email, identity.EmailVerified, identity.Data, jwtBearerGrant)
+	if err != nil {
+		return err
+	}
+
+	if err := a.setCookieTokens(config, session, false, w); err != nil {
+		return internalServerError("Failed to set JWT cookie. %s", err)
+	}
+
+	metering.RecordLogin("jwt_bearer", user.ID, instanceID)
+	a.recordTokenIssued(ctx, userTokenIssuance(user, jwtBearerGrant))
+	a.recordSignIn(r, user)
+	return sendToken(w, r, session)
+}
+
+// findTrustedIssuer returns the trusted issuer named by the iss claim of the
+// token, which is only verified later with the keys of that issuer.
+func findTrustedIssuer(config *conf.Configuration, tokenString string) (*conf.TrustedIssuerConfiguration, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return nil, oauthError("invalid_grant", "Invalid assertion")
+	}
+	iss, _ := claims["iss"].(string)
+	issuer := config.TrustedIssuers.Find(iss)
+	if issuer == nil {
+		return nil, oauthError("invalid_grant", "Assertion issuer is not trusted")
+	}
+	return issuer, nil
+}
+
+func trustedIssuerVerifier(issuer *conf.TrustedIssuerConfiguration) (*oidc.IDTokenVerifier, error) {
+	config := &oidc.Config{ClientID: issuer.Audience}
+	if issuer.JWKSURL != "" {
+		return oidc.NewVerifier(issuer.Issuer, provider.RemoteKeySet(issuer.JWKSURL), config), nil
+	}
+	oidcProvider, err := provider.OIDCProvider(issuer.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return oidcProvider.Verifier(config), nil
+}
+
+// mapTrustedIdentity reads the user out of the claims of a trusted issuer's
+// token, as mapped by the issuer's configuration.
+func mapTrustedIdentity(issuer *conf.TrustedIssuerConfiguration, claims map[string]interface{}) (*trustedIdentity, error) {
+	sub, _ := claims[issuer.Claim(conf.TrustedClaimSubject)].(string)
+	if sub == "" {
+		return nil, oauthError("invalid_grant", "Assertion has no subject")
+	}
+	identity := &trustedIdentity{
+		Subject: sub,
+		Data:    map[string]interface{}{"sub": sub},
+	}
+	if email, ok := claims[issuer.Claim(conf.TrustedClaimEmail)].(string); ok && email != "" {
+		identity.Email = email
+		identity.Data["email"] = email
+	}
+	if verified, ok := claims[issuer.Claim(conf.TrustedClaimEmailVerified)]; ok {
+		identity.EmailVerified = getEmailVerified(verified)
+	}
+	for field, claim := range issuer.Claims {
+		switch field {
+		case conf.TrustedClaimSubject, conf.TrustedClaimEmail, conf.TrustedClaimEmailVerified:
+			continue
+		}
+		if value, ok := claims[claim]; ok {
+			identity.Data[field] = value
+		}
+	}
+	return identity, nil
+}
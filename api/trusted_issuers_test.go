@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapTrustedIdentity(t *testing.T) {
+	issuer := &conf.TrustedIssuerConfiguration{
+		Name:   "firebase",
+		Claims: map[string]string{"sub": "user_id", "team": "org", "missing": "nope"},
+	}
+
+	identity, err := mapTrustedIdentity(issuer, map[string]interface{}{
+		"sub":            "ignored",
+		"user_id":        "abc",
+		"email":          "someone@example.com",
+		"email_verified": "true",
+		"org":            "acme",
+		"admin":          true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", identity.Subject)
+	assert.Equal(t, "someone@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+	// only mapped claims end up in the user's metadata
+	assert.Equal(t, map[string]interface{}{"sub": "abc", "email": "someone@example.com", "team": "acme"}, identity.Data)
+
+	_, err = mapTrustedIdentity(issuer, map[string]interface{}{"sub": "abc"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// processUnconfirmedUsers reminds users who haven't confirmed their email
+// UNCONFIRMED_USERS_REMINDER_DAYS after signing up, and flags or deletes
+// users who haven't confirmed UNCONFIRMED_USERS_EXPIRY_DAYS after signing up.
+func (a *API) processUnconfirmedUsers(ctx context.Context) error {
+	config := a.getConfig(ctx)
+	policy := config.UnconfirmedUsers
+
+	// expired users are handled first, so they aren't reminded right before
+	if policy.ExpiryDays > 0 {
+		if err := a.expireUnconfirmedUsers(ctx, config); err != nil {
+			return err
+		}
+	}
+	if policy.ReminderDays > 0 && config.External.Email.Enabled && !config.Mailer.Autoconfirm {
+		return a.remindUnconfirmedUsers(ctx, config)
+	}
+	return nil
+}
+
+func (a *API) remindUnconfirmedUsers(ctx context.Context, config *conf.Configuration) error {
+	instanceID := getInstanceID(ctx)
+	cutoff := time.Now().AddDate(0, 0, -config.UnconfirmedUsers.ReminderDays)
+	mailer := a.Mailer(ctx)
+
+	for {
+		users, err := models.FindUnconfirmedUsersToRemind(a.db, instanceID, cutoff, jobBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			err := a.db.Transaction(func(tx *storage.Connection) error {
+				claimed, terr := user.ClaimConfirmationReminder(tx)
+				if terr != nil || !claimed {
+					return terr
+				}
+				// the first confirmation link may have expired, so the reminder is a fresh confirmation
+				return sendConfirmation(tx, user, mailer, 0, config.SiteURL, config.Mailer.OtpLength)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(users) < jobBatchSize {
+			return nil
+		}
+	}
+}
+
+func (a *API) expireUnconfirmedUsers(ctx context.Context, config *conf.Configuration) error {
+	instanceID := getInstanceID(ctx)
+	cutoff := time.Now().AddDate(0, 0, -config.UnconfirmedUsers.ExpiryDays)
+	action := config.UnconfirmedUsers.ExpiryAction
+
+	for {
+		users, err := models.FindExpiredUnconfirmedUsers(a.db, instanceID, cutoff, action == conf.UnconfirmedUsersDelete, jobBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			err := a.db.Transaction(func(tx *storage.Connection) error {
+				if terr := models.NewAuditLogEntry(nil, tx, instanceID, user, models.UnconfirmedUserExpiredAction, "", map[string]interface{}{
+					"user_id":    user.ID,
+					"user_email": user.Email,
+					"user_phone": user.Phone,
+					"action":     action,
+				}); terr != nil {
+					return terr
+				}
+				if action == conf.UnconfirmedUsersDelete {
+					return tx.Destroy(user)
+				}
+				return user.FlagUnconfirmedExpired(tx)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(users) < jobBatchSize {
+			return nil
+		}
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/api/sms_provider"
@@ -39,7 +40,7 @@ func (a *API) UserGet(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Token audience doesn't match request audience")
 	}
 
-	user, err := models.FindUserByID(a.db, userID)
+	user, err := models.FindUserByID(a.getDB(ctx), userID)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			return notFoundError(err.Error())
@@ -50,6 +51,41 @@ func (a *API) UserGet(w http.ResponseWriter, r *http.Request) error {
 	return sendJSON(w, http.StatusOK, user)
 }
 
+// UserInfo returns the claims of the user that access tokens may carry by
+// reference only, see JWT_CLAIMS_REFERENCE.
+func (a *API) UserInfo(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	claims := getClaims(ctx)
+	if claims == nil {
+		return badRequestError("Could not read claims")
+	}
+
+	userID, err := uuid.FromString(claims.Subject)
+	if err != nil {
+		return badRequestError("Could not read User ID claim")
+	}
+
+	user, err := models.FindUserByID(a.getDB(ctx), userID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError(err.Error())
+		}
+		return internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	appMetaData, customClaims := appMetadataClaims(&config.JWT, user)
+	info := userInfoClaims(appMetaData, user.UserMetaData, customClaims)
+	ref, err := claimsReference(info)
+	if err != nil {
+		return internalServerError("Error computing claims reference").WithInternalError(err)
+	}
+	info["sub"] = user.ID.String()
+	info["claims_ref"] = ref
+
+	return sendJSON(w, http.StatusOK, info)
+}
+
 // UserUpdate updates fields on a user
 func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -69,7 +105,7 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Could not read User ID claim")
 	}
 
-	user, err := models.FindUserByID(a.db, userID)
+	user, err := models.FindUserByID(a.getDB(ctx), userID)
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			return notFoundError(err.Error())
@@ -80,13 +116,21 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 	log := logger.GetLogEntry(r)
 	log.Debugf("Checking params for token %v", params)
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	if params.Password != nil {
+		if len(*params.Password) < config.PasswordMinLength {
+			return invalidPasswordLengthError(config)
+		}
+		if err := checkPasswordPolicy(config, *params.Password); err != nil {
+			return err
+		}
+		if err := a.checkLeakedPassword(r, config, *params.Password)(); err != nil {
+			return err
+		}
+	}
+
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if params.Password != nil {
-			if len(*params.Password) < config.PasswordMinLength {
-				return invalidPasswordLengthError(config)
-			}
-
 			if !config.Security.UpdatePasswordRequireReauthentication {
 				if terr = user.UpdatePassword(tx, *params.Password); terr != nil {
 					return internalServerError("Error during password storage").WithInternalError(terr)
@@ -94,7 +138,7 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 			} else if params.Nonce == "" {
 				return unauthorizedError("Password update requires reauthentication.")
 			} else {
-				if terr = a.verifyReauthentication(params.Nonce, tx, config, user); terr != nil {
+				if terr = a.verifyReauthentication(ctx, params.Nonce, tx, config, user); terr != nil {
 					return terr
 				}
 				if terr = user.UpdatePassword(tx, *params.Password); terr != nil {
@@ -104,11 +148,16 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		if params.Data != nil {
+			if rejected := restrictUserMetaData(config, params.Data); len(rejected) > 0 {
+				return unprocessableEntityError("User metadata keys are not allowed: %s", strings.Join(rejected, ", "))
+			}
 			if terr = user.UpdateUserMetaData(tx, params.Data); terr != nil {
 				return internalServerError("Error updating user").WithInternalError(terr)
 			}
 		}
 
+		// app_metadata is only updated by admins, or by the delegated roles
+		// at /users/<user_id>/app_metadata
 		if params.AppData != nil {
 			if !a.isAdmin(ctx, user, config.JWT.Aud) {
 				return unauthorizedError("Updating app_metadata requires admin privileges")
@@ -120,6 +169,9 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		if params.Email != "" && params.Email != user.GetEmail() {
+			if config.Sms.IsWhatsappAudience(user.Aud) {
+				return phoneOnlyError(user.Aud)
+			}
 			if terr = a.validateEmail(ctx, params.Email); terr != nil {
 				return terr
 			}
@@ -150,6 +202,15 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 				return unprocessableEntityError(DuplicatePhoneMsg)
 			}
 			if config.Sms.Autoconfirm {
+				if user.IsAnonymous {
+					if terr = user.UpdatePhone(tx, params.Phone); terr != nil {
+						return internalServerError("Error updating user").WithInternalError(terr)
+					}
+					if terr = user.ConfirmPhone(tx); terr != nil {
+						return internalServerError("Error updating user").WithInternalError(terr)
+					}
+					return a.upgradeAnonymousUser(r, tx, user, "phone")
+				}
 				return user.UpdatePhone(tx, params.Phone)
 			} else {
 				smsProvider, terr := sms_provider.GetSmsProvider(*config)
@@ -157,6 +218,9 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 					return badRequestError("Error sending sms: %v", terr)
 				}
 				if terr := a.sendPhoneConfirmation(ctx, tx, user, params.Phone, phoneChangeVerification, smsProvider); terr != nil {
+					if herr, ok := terr.(*HTTPError); ok {
+						return herr
+					}
 					return internalServerError("Error sending phone change otp").WithInternalError(terr)
 				}
 			}
@@ -171,6 +235,7 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	a.emitLifecycleEvent(ctx, UserUpdatedEvent, user)
 
 	return sendJSON(w, http.StatusOK, user)
 }
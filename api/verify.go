@@ -12,6 +12,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/netlify/gotrue/clock"
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
@@ -26,6 +28,7 @@ var (
 const (
 	signupVerification      = "signup"
 	recoveryVerification    = "recovery"
+	recoveryOtpVerification = "recovery_otp"
 	inviteVerification      = "invite"
 	magicLinkVerification   = "magiclink"
 	emailChangeVerification = "email_change"
@@ -54,6 +57,8 @@ type VerifyParams struct {
 	Email      string `json:"email"`
 	Phone      string `json:"phone"`
 	RedirectTo string `json:"redirect_to"`
+	// Password is the new password of the recovery_otp type
+	Password string `json:"password"`
 }
 
 // Verify exchanges a confirmation or recovery token to a refresh token
@@ -74,15 +79,18 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 	params := &VerifyParams{}
 	params.Token = r.FormValue("token")
 	params.Type = r.FormValue("type")
-	params.RedirectTo = a.getRedirectURLOrReferrer(r, r.FormValue("redirect_to"))
+	redirectTo, passthrough := splitRedirectParams(config, r, r.FormValue("redirect_to"))
+	params.RedirectTo = appendRedirectParams(a.getRedirectURLOrReferrer(r, redirectTo), passthrough)
+	hosted := useHostedPages(config, params.RedirectTo)
 
 	var (
-		user  *models.User
-		err   error
-		token *AccessTokenResponse
+		user     *models.User
+		err      error
+		token    *AccessTokenResponse
+		authCode string
 	)
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if params.Token == "" {
 			return badRequestError("Verify requires a token")
@@ -95,6 +103,9 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 			return badRequestError("Verify requires a verification type")
 		}
 		aud := a.requestAud(ctx, r)
+		if config.Sms.IsWhatsappAudience(aud) {
+			return phoneOnlyError(aud)
+		}
 		user, terr = a.verifyEmailLink(ctx, tx, params, aud)
 		if terr != nil {
 			return terr
@@ -104,13 +115,16 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 		case signupVerification, inviteVerification:
 			user, terr = a.signupVerify(r, ctx, tx, user)
 		case recoveryVerification, magicLinkVerification:
-			user, terr = a.recoverVerify(r, ctx, tx, user)
+			user, terr = a.recoverVerify(r, ctx, tx, user, params.Type)
 		case emailChangeVerification:
 			user, terr = a.emailChangeVerify(r, ctx, tx, params, user)
 			if user == nil && terr == nil {
 				// when double confirmation is required
 				rurl := a.prepRedirectURL(singleConfirmationAccepted, params.RedirectTo)
-				http.Redirect(w, r, rurl, http.StatusSeeOther)
+				if hosted {
+					rurl = a.prepRedirectURL(singleConfirmationAccepted, a.hostedPageURL(landingPage))
+				}
+				a.redirect(w, r, rurl)
 				return nil
 			}
 		default:
@@ -121,7 +135,15 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 			return terr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		if params.Type == signupVerification || params.Type == magicLinkVerification {
+			// magic links requested with the PKCE flow return an
+			// authorization code rather than tokens
+			if authCode, terr = a.issueMagicLinkAuthCode(ctx, tx, user); terr != nil || authCode != "" {
+				return terr
+			}
+		}
+
+		token, terr = a.issueRefreshToken(ctx, r, tx, user, params.Type)
 		if terr != nil {
 			return terr
 		}
@@ -135,14 +157,32 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		var herr *HTTPError
 		if errors.As(err, &herr) {
-			rurl := a.prepErrorRedirectURL(herr, r, params.RedirectTo)
-			http.Redirect(w, r, rurl, http.StatusSeeOther)
+			rurl := params.RedirectTo
+			if hosted {
+				rurl = a.hostedPageURL(expiredLinkPage)
+			}
+			padAuthFailure(ctx)
+			a.redirect(w, r, a.prepErrorRedirectURL(herr, r, rurl))
 			return nil
 		}
+	} else if user != nil {
+		a.emitVerificationEvent(ctx, params.Type, user)
 	}
 
 	rurl := params.RedirectTo
-	if token != nil {
+	if hosted {
+		switch params.Type {
+		case recoveryVerification, inviteVerification:
+			rurl = a.hostedPageURL(resetPasswordPage)
+		default:
+			rurl = a.hostedPageURL(landingPage)
+		}
+	}
+	if authCode != "" {
+		rurl = pkceRedirectURL(rurl, authCode)
+	} else if token != nil {
+		a.recordTokenIssued(ctx, userTokenIssuance(user, params.Type))
+		a.recordSignIn(r, user)
 		q := url.Values{}
 		q.Set("access_token", token.Token)
 		q.Set("token_type", token.TokenType)
@@ -151,7 +191,7 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 		q.Set("type", params.Type)
 		rurl += "#" + q.Encode()
 	}
-	http.Redirect(w, r, rurl, http.StatusSeeOther)
+	a.redirect(w, r, rurl)
 	return nil
 }
 
@@ -175,6 +215,11 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 	if params.Type == "" {
 		return badRequestError("Verify requires a verification type")
 	}
+	if params.Type == recoveryOtpVerification {
+		if err := a.validateRecoveryOtpParams(r, config, params); err != nil {
+			return err
+		}
+	}
 
 	var (
 		user  *models.User
@@ -182,10 +227,19 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 		token *AccessTokenResponse
 	)
 
-	err = a.db.Transaction(func(tx *storage.Connection) error {
+	err = a.getDB(ctx).Transaction(func(tx *storage.Connection) error {
 		var terr error
 		aud := a.requestAud(ctx, r)
-		user, terr = a.verifyUserAndToken(ctx, tx, params, aud)
+		if config.Sms.IsWhatsappAudience(aud) && !isPhoneVerificationType(params) {
+			return phoneOnlyError(aud)
+		}
+		if params.Email == "" && params.Phone == "" {
+			// the token from an email link, posted by an app that handles
+			// the link itself instead of following the redirect
+			user, terr = a.verifyEmailLink(ctx, tx, params, aud)
+		} else {
+			user, terr = a.verifyUserAndToken(ctx, tx, params, aud)
+		}
 		if terr != nil {
 			return terr
 		}
@@ -194,7 +248,13 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 		case signupVerification, inviteVerification:
 			user, terr = a.signupVerify(r, ctx, tx, user)
 		case recoveryVerification, magicLinkVerification:
-			user, terr = a.recoverVerify(r, ctx, tx, user)
+			if isPhoneOtpVerification(params) {
+				user, terr = a.phoneRecoverVerify(r, ctx, tx, user)
+			} else {
+				user, terr = a.recoverVerify(r, ctx, tx, user, params.Type)
+			}
+		case recoveryOtpVerification:
+			user, terr = a.recoverOtpVerify(r, ctx, tx, user, params.Password)
 		case emailChangeVerification:
 			user, terr = a.emailChangeVerify(r, ctx, tx, params, user)
 			if user == nil && terr == nil {
@@ -213,7 +273,7 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 			return terr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		token, terr = a.issueRefreshToken(ctx, r, tx, user, params.Type)
 		if terr != nil {
 			return terr
 		}
@@ -227,7 +287,14 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	return sendJSON(w, http.StatusOK, token)
+	if user != nil {
+		a.emitVerificationEvent(ctx, params.Type, user)
+	}
+	if token != nil {
+		a.recordTokenIssued(ctx, userTokenIssuance(user, params.Type))
+		a.recordSignIn(r, user)
+	}
+	return sendToken(w, r, token)
 }
 
 func (a *API) signupVerify(r *http.Request, ctx context.Context, conn *storage.Connection, user *models.User) (*models.User, error) {
@@ -269,14 +336,17 @@ func (a *API) signupVerify(r *http.Request, ctx context.Context, conn *storage.C
 	return user, nil
 }
 
-func (a *API) recoverVerify(r *http.Request, ctx context.Context, conn *storage.Connection, user *models.User) (*models.User, error) {
+func (a *API) recoverVerify(r *http.Request, ctx context.Context, conn *storage.Connection, user *models.User, verifyType string) (*models.User, error) {
 	instanceID := getInstanceID(ctx)
 	config := a.getConfig(ctx)
 
 	err := conn.Transaction(func(tx *storage.Connection) error {
 		var terr error
-		if terr = user.Recover(tx); terr != nil {
-			return terr
+		// reusable magic links stay valid until they expire or a new one is sent
+		if verifyType != magicLinkVerification || config.Mailer.MagicLinkSingleUse {
+			if terr = user.Recover(tx); terr != nil {
+				return terr
+			}
 		}
 		if !user.IsConfirmed() {
 			if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.UserSignedUpAction, "", nil); terr != nil {
@@ -306,6 +376,92 @@ func (a *API) recoverVerify(r *http.Request, ctx context.Context, conn *storage.
 	return user, nil
 }
 
+// validateRecoveryOtpParams checks that a recovery code is verified with the
+// email it was sent to and a new password meeting the password policy.
+func (a *API) validateRecoveryOtpParams(r *http.Request, config *conf.Configuration, params *VerifyParams) error {
+	if !isEmailOtpVerification(params) {
+		return unprocessableEntityError("Verifying a recovery code requires the email it was sent to")
+	}
+	if params.Password == "" {
+		return unprocessableEntityError("Verifying a recovery code requires a new password")
+	}
+	if len(params.Password) < config.PasswordMinLength {
+		return invalidPasswordLengthError(config)
+	}
+	if err := checkPasswordPolicy(config, params.Password); err != nil {
+		return err
+	}
+	return a.checkLeakedPassword(r, config, params.Password)()
+}
+
+// recoverOtpVerify sets the new password of the user who entered the recovery
+// code emailed to them, and signs them in.
+func (a *API) recoverOtpVerify(r *http.Request, ctx context.Context, conn *storage.Connection, user *models.User, password string) (*models.User, error) {
+	instanceID := getInstanceID(ctx)
+	config := a.getConfig(ctx)
+
+	err := conn.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = user.Recover(tx); terr != nil {
+			return terr
+		}
+		if terr = user.UpdatePassword(tx, password); terr != nil {
+			return terr
+		}
+		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.UserModifiedAction, "", nil); terr != nil {
+			return terr
+		}
+		if !user.IsConfirmed() {
+			// the code proves the user owns the email
+			if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.UserSignedUpAction, "", nil); terr != nil {
+				return terr
+			}
+			if terr = triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); terr != nil {
+				return terr
+			}
+			return user.Confirm(tx)
+		}
+		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", nil); terr != nil {
+			return terr
+		}
+		return triggerEventHooks(ctx, tx, LoginEvent, user, instanceID, config)
+	})
+	if err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return user, nil
+}
+
+// phoneRecoverVerify signs in the user with the recovery otp sent to their
+// phone, so they can set a new password.
+func (a *API) phoneRecoverVerify(r *http.Request, ctx context.Context, conn *storage.Connection, user *models.User) (*models.User, error) {
+	instanceID := getInstanceID(ctx)
+	config := a.getConfig(ctx)
+
+	err := conn.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = user.Recover(tx); terr != nil {
+			return terr
+		}
+		if terr = models.NewAuditLogEntry(r, tx, instanceID, user, models.LoginAction, "", map[string]interface{}{
+			"provider": "phone",
+		}); terr != nil {
+			return terr
+		}
+		if terr = triggerEventHooks(ctx, tx, LoginEvent, user, instanceID, config); terr != nil {
+			return terr
+		}
+		if !user.IsPhoneConfirmed() {
+			return user.ConfirmPhone(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return user, nil
+}
+
 func (a *API) smsVerify(r *http.Request, ctx context.Context, conn *storage.Connection, user *models.User, otpType string) (*models.User, error) {
 	instanceID := getInstanceID(ctx)
 	config := a.getConfig(ctx)
@@ -328,6 +484,9 @@ func (a *API) smsVerify(r *http.Request, ctx context.Context, conn *storage.Conn
 			if terr = user.ConfirmPhoneChange(tx); terr != nil {
 				return internalServerError("Error confirming user").WithInternalError(terr)
 			}
+			if terr = a.upgradeAnonymousUser(r, tx, user, "phone"); terr != nil {
+				return terr
+			}
 		}
 		return nil
 	})
@@ -348,6 +507,9 @@ func (a *API) prepErrorRedirectURL(err *HTTPError, r *http.Request, rurl string)
 	}
 	q.Set("error_code", strconv.Itoa(err.Code))
 	q.Set("error_description", err.Message)
+	for key, value := range err.Details {
+		q.Set(key, fmt.Sprint(value))
+	}
 	return rurl + "#" + q.Encode()
 }
 
@@ -364,9 +526,9 @@ func (a *API) emailChangeVerify(r *http.Request, ctx context.Context, conn *stor
 	if config.Mailer.SecureEmailChangeEnabled && user.EmailChangeConfirmStatus == zeroConfirmation && user.GetEmail() != "" {
 		err := conn.Transaction(func(tx *storage.Connection) error {
 			user.EmailChangeConfirmStatus = singleConfirmation
-			if params.Token == user.EmailChangeTokenCurrent {
+			if secureCompare(params.Token, user.EmailChangeTokenCurrent) {
 				user.EmailChangeTokenCurrent = ""
-			} else if params.Token == user.EmailChangeTokenNew {
+			} else if secureCompare(params.Token, user.EmailChangeTokenNew) {
 				user.EmailChangeTokenNew = ""
 			}
 			if terr := tx.UpdateOnly(user, "email_change_confirm_status", "email_change_token_current", "email_change_token_new"); terr != nil {
@@ -395,6 +557,15 @@ func (a *API) emailChangeVerify(r *http.Request, ctx context.Context, conn *stor
 		if terr = user.ConfirmEmailChange(tx, zeroConfirmation); terr != nil {
 			return internalServerError("Error confirm email").WithInternalError(terr)
 		}
+		if user.IsAnonymous {
+			// anonymous users had no email to confirm before
+			if terr = user.Confirm(tx); terr != nil {
+				return internalServerError("Error confirm email").WithInternalError(terr)
+			}
+			if terr = a.upgradeAnonymousUser(r, tx, user, "email"); terr != nil {
+				return terr
+			}
+		}
 
 		return nil
 	})
@@ -437,8 +608,12 @@ func (a *API) verifyEmailLink(ctx context.Context, conn *storage.Connection, par
 	switch params.Type {
 	case signupVerification, inviteVerification:
 		isExpired = isOtpExpired(user.ConfirmationSentAt, config.Mailer.OtpExp)
-	case recoveryVerification, magicLinkVerification:
+	case recoveryVerification:
 		isExpired = isOtpExpired(user.RecoverySentAt, config.Mailer.OtpExp)
+	case magicLinkVerification:
+		if isOtpExpired(user.RecoverySentAt, config.Mailer.MagicLinkExp) {
+			return nil, magicLinkExpiredError(config, user.RecoverySentAt).WithInternalError(redirectWithQueryError)
+		}
 	case emailChangeVerification:
 		isExpired = isOtpExpired(user.EmailChangeSentAt, config.Mailer.OtpExp)
 	}
@@ -466,7 +641,7 @@ func (a *API) verifyUserAndToken(ctx context.Context, conn *storage.Connection,
 		switch params.Type {
 		case phoneChangeVerification:
 			user, err = models.FindUserByPhoneChangeAndAudience(conn, instanceID, params.Phone, aud)
-		case smsVerification:
+		case smsVerification, recoveryVerification:
 			user, err = models.FindUserByPhoneAndAudience(conn, instanceID, params.Phone, aud)
 		default:
 			return nil, badRequestError("Invalid sms verification type")
@@ -497,6 +672,11 @@ func (a *API) verifyUserAndToken(ctx context.Context, conn *storage.Connection,
 		return nil, unauthorizedError("Error confirming user").WithInternalError(redirectWithQueryError)
 	}
 
+	challenge, sentAt := otpChallenge(user, params.Type)
+	if err := a.checkOtpLocked(ctx, config, user, challenge, sentAt); err != nil {
+		return nil, err
+	}
+
 	var isValid bool
 	switch params.Type {
 	case signupVerification, inviteVerification:
@@ -507,12 +687,25 @@ func (a *API) verifyUserAndToken(ctx context.Context, conn *storage.Connection,
 			tokenHash = params.Token
 		}
 		isValid = isOtpValid(tokenHash, user.ConfirmationToken, user.ConfirmationSentAt, config.Mailer.OtpExp)
-	case recoveryVerification, magicLinkVerification:
+	case recoveryVerification, recoveryOtpVerification:
 		// TODO(km): remove when old token format is deprecated
 		if len(user.RecoveryToken) < sum224HashLength {
 			tokenHash = params.Token
 		}
-		isValid = isOtpValid(tokenHash, user.RecoveryToken, user.RecoverySentAt, config.Mailer.OtpExp)
+		otpExp := config.Mailer.OtpExp
+		if isPhoneOtpVerification(params) {
+			otpExp = config.Sms.OtpExp
+		}
+		isValid = isOtpValid(tokenHash, user.RecoveryToken, user.RecoverySentAt, otpExp)
+	case magicLinkVerification:
+		// TODO(km): remove when old token format is deprecated
+		if len(user.RecoveryToken) < sum224HashLength {
+			tokenHash = params.Token
+		}
+		if err == nil && secureCompare(tokenHash, user.RecoveryToken) && user.RecoverySentAt != nil && isOtpExpired(user.RecoverySentAt, config.Mailer.MagicLinkExp) {
+			return nil, magicLinkExpiredError(config, user.RecoverySentAt).WithInternalError(redirectWithQueryError)
+		}
+		isValid = isOtpValid(tokenHash, user.RecoveryToken, user.RecoverySentAt, config.Mailer.MagicLinkExp)
 	case emailChangeVerification:
 		// TODO(km): remove when old token format is deprecated
 		if len(user.EmailChangeTokenCurrent) < sum224HashLength && len(user.EmailChangeTokenNew) < sum224HashLength {
@@ -535,6 +728,7 @@ func (a *API) verifyUserAndToken(ctx context.Context, conn *storage.Connection,
 	}
 
 	if !isValid || err != nil {
+		a.recordFailedOtp(ctx, config, user, challenge, sentAt)
 		return nil, expiredTokenError("Token has expired or is invalid").WithInternalError(redirectWithQueryError)
 	}
 	return user, nil
@@ -545,11 +739,38 @@ func isOtpValid(actual, expected string, sentAt *time.Time, otpExp uint) bool {
 	if expected == "" || sentAt == nil {
 		return false
 	}
-	return !isOtpExpired(sentAt, otpExp) && (actual == expected)
+	return !isOtpExpired(sentAt, otpExp) && secureCompare(actual, expected)
 }
 
 func isOtpExpired(sentAt *time.Time, otpExp uint) bool {
-	return time.Now().After(sentAt.Add(time.Second * time.Duration(otpExp)))
+	return clock.Now().After(sentAt.Add(time.Second * time.Duration(otpExp)))
+}
+
+// magicLinkExpiredError tells clients when the magic link sent at sentAt
+// expired and in how many seconds a new one can be requested, so they can
+// offer to resend it right away.
+func magicLinkExpiredError(config *conf.Configuration, sentAt *time.Time) *HTTPError {
+	expiredAt := sentAt.Add(time.Second * time.Duration(config.Mailer.MagicLinkExp))
+	resendIn := time.Until(sentAt.Add(config.SMTP.MaxFrequencyFor(conf.MagicLinkEmail))) / time.Second
+	if resendIn < 0 {
+		resendIn = 0
+	}
+	return expiredTokenError("Email link is invalid or has expired").WithDetails(map[string]interface{}{
+		"expired_at": expiredAt.UTC().Format(time.RFC3339),
+		"resend_in":  int(resendIn),
+	})
+}
+
+// isPhoneVerificationType checks if the verification is of a code sent to a
+// phone number, the only kind WhatsApp audiences accept
+func isPhoneVerificationType(params *VerifyParams) bool {
+	switch params.Type {
+	case smsVerification, phoneChangeVerification:
+		return params.Email == ""
+	case recoveryVerification:
+		return isPhoneOtpVerification(params)
+	}
+	return false
 }
 
 // isPhoneOtpVerification checks if the verification came from a phone otp
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -310,6 +311,139 @@ func (ts *VerifyTestSuite) TestExpiredRecoveryToken() {
 	assert.Equal(ts.T(), http.StatusSeeOther, w.Code, w.Body.String())
 }
 
+func (ts *VerifyTestSuite) TestExpiredMagicLink() {
+	defer func(exp uint) { ts.Config.Mailer.MagicLinkExp = exp }(ts.Config.Mailer.MagicLinkExp)
+	ts.Config.Mailer.MagicLinkExp = 3600
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	u.RecoveryToken = "asdf3"
+	sentTime := time.Now().Add(-2 * time.Hour)
+	u.RecoverySentAt = &sentTime
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	reqURL := fmt.Sprintf("http://localhost/verify?type=%s&token=%s", magicLinkVerification, u.RecoveryToken)
+	req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusSeeOther, w.Code)
+
+	rurl, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err, "redirect url parse failed")
+	f, err := url.ParseQuery(rurl.Fragment)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "401", f.Get("error_code"))
+	assert.Equal(ts.T(), sentTime.Add(time.Hour).UTC().Format(time.RFC3339), f.Get("expired_at"))
+	assert.Equal(ts.T(), "0", f.Get("resend_in"))
+}
+
+func (ts *VerifyTestSuite) TestReusableMagicLink() {
+	defer func() { ts.Config.Mailer.MagicLinkSingleUse = true }()
+	ts.Config.Mailer.MagicLinkSingleUse = false
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	u.RecoveryToken = "asdf3"
+	sentTime := time.Now()
+	u.RecoverySentAt = &sentTime
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	for i := 0; i < 2; i++ {
+		reqURL := fmt.Sprintf("http://localhost/verify?type=%s&token=%s", magicLinkVerification, u.RecoveryToken)
+		req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		assert.Equal(ts.T(), http.StatusSeeOther, w.Code)
+
+		rurl, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(ts.T(), err, "redirect url parse failed")
+		f, err := url.ParseQuery(rurl.Fragment)
+		require.NoError(ts.T(), err)
+		assert.NotEmpty(ts.T(), f.Get("access_token"))
+	}
+}
+
+func (ts *VerifyTestSuite) TestVerifyPKCEMagicLink() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	u.RecoveryToken = "asdf3"
+	sentTime := time.Now()
+	u.RecoverySentAt = &sentTime
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	flowState, err := models.NewFlowState(ts.instanceID, u, "email", magicLinkVerification, base64.RawURLEncoding.EncodeToString(sum[:]), models.CodeChallengeMethodS256, time.Hour)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(flowState))
+
+	reqURL := fmt.Sprintf("http://localhost/verify?type=%s&token=%s", magicLinkVerification, u.RecoveryToken)
+	req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusSeeOther, w.Code)
+
+	rurl, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err, "redirect url parse failed")
+	assert.Empty(ts.T(), rurl.Fragment)
+	code := rurl.Query().Get("code")
+	require.NotEmpty(ts.T(), code)
+
+	exchange := func(verifier string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"auth_code":     code,
+			"code_verifier": verifier,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=pkce", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w = exchange("wrong-verifier")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = exchange(verifier)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	assert.NotEmpty(ts.T(), token.Token)
+	assert.NotEmpty(ts.T(), token.RefreshToken)
+
+	// codes can only be exchanged once
+	w = exchange(verifier)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *VerifyTestSuite) TestVerifyPostEmailLink() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	u.RecoveryToken = "asdf3"
+	sentTime := time.Now()
+	u.RecoverySentAt = &sentTime
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"type":  magicLinkVerification,
+		"token": u.RecoveryToken,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/verify", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	token := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&token))
+	assert.NotEmpty(ts.T(), token.Token)
+	assert.NotEmpty(ts.T(), token.RefreshToken)
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), u.RecoveryToken)
+}
+
 func (ts *VerifyTestSuite) TestVerifyPermitedCustomUri() {
 	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
 	require.NoError(ts.T(), err)
@@ -631,6 +765,99 @@ func (ts *VerifyTestSuite) TestVerifyBannedUser() {
 	}
 }
 
+func (ts *VerifyTestSuite) TestVerifyOtpLockedAfterFailedAttempts() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.RecoveryToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+"123456")))
+	u.RecoverySentAt = &now
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"type":  recoveryVerification,
+			"token": token,
+			"email": u.GetEmail(),
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/verify", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < ts.Config.Security.OtpMaxAttempts; i++ {
+		require.Equal(ts.T(), http.StatusUnauthorized, verify("000000").Code)
+	}
+	// the right code is rejected too until a new one is sent
+	w := verify("123456")
+	require.Equal(ts.T(), http.StatusTooManyRequests, w.Code)
+
+	entries, err := models.FindAuditLogEntries(ts.API.db, ts.instanceID, []string{"action"}, string(models.OtpLockedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), entries, 1)
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	sentAgain := now.Add(time.Second)
+	u.RecoverySentAt = &sentAgain
+	require.NoError(ts.T(), ts.API.db.Update(u))
+	require.Equal(ts.T(), http.StatusOK, verify("123456").Code)
+}
+
+func (ts *VerifyTestSuite) TestVerifyRecoveryOtpSetsPassword() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.RecoveryToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetEmail()+"123456")))
+	u.RecoverySentAt = &now
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	verify := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/verify", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// the password is required
+	w := verify(map[string]interface{}{
+		"type":  recoveryOtpVerification,
+		"token": "123456",
+		"email": u.GetEmail(),
+	})
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = verify(map[string]interface{}{
+		"type":     recoveryOtpVerification,
+		"token":    "123456",
+		"email":    u.GetEmail(),
+		"password": "newpassword",
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	data := AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.NotEmpty(ts.T(), data.Token)
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), u.Authenticate("newpassword"))
+	assert.Empty(ts.T(), u.RecoveryToken)
+
+	// the code can't be used twice
+	w = verify(map[string]interface{}{
+		"type":     recoveryOtpVerification,
+		"token":    "123456",
+		"email":    u.GetEmail(),
+		"password": "otherpassword",
+	})
+	assert.NotEqual(ts.T(), http.StatusOK, w.Code)
+}
+
 func (ts *VerifyTestSuite) TestVerifyValidOtp() {
 	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
 	require.NoError(ts.T(), err)
@@ -686,6 +913,17 @@ func (ts *VerifyTestSuite) TestVerifyValidOtp() {
 			},
 			expected: expectedResponse,
 		},
+		{
+			desc:     "Valid Phone Recovery OTP",
+			sentTime: time.Now(),
+			body: map[string]interface{}{
+				"type":      recoveryVerification,
+				"tokenHash": fmt.Sprintf("%x", sha256.Sum224([]byte(u.GetPhone()+"123456"))),
+				"token":     "123456",
+				"phone":     u.GetPhone(),
+			},
+			expected: expectedResponse,
+		},
 		{
 			desc:     "Valid Email Change OTP",
 			sentTime: time.Now(),
@@ -737,3 +975,24 @@ func (ts *VerifyTestSuite) TestVerifyValidOtp() {
 		})
 	}
 }
+
+func TestRedirectPassthroughParams(t *testing.T) {
+	config := &conf.Configuration{
+		RedirectPassthroughParams: []string{"utm_source", "utm_campaign"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/signup?utm_source=news&utm_campaign=spring&other=1", nil)
+	referrer := withRedirectParams(config, req, "https://example.com/welcome")
+	assert.Equal(t, "https://example.com/welcome?utm_campaign=spring&utm_source=news", referrer)
+
+	// the unescaped redirect URL in the email splits its query parameters
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/verify?token=asdf&type=signup&redirect_to=https://example.com/welcome?utm_campaign=spring&utm_source=news", nil)
+	redirectTo, passthrough := splitRedirectParams(config, req, req.FormValue("redirect_to"))
+	assert.Equal(t, "https://example.com/welcome", redirectTo)
+	assert.Equal(t, "spring", passthrough.Get("utm_campaign"))
+	assert.Equal(t, "news", passthrough.Get("utm_source"))
+	assert.Equal(t, "https://example.com/welcome?utm_campaign=spring&utm_source=news#access_token=a", appendRedirectParams(redirectTo, passthrough)+"#access_token=a")
+
+	config.RedirectPassthroughParams = nil
+	assert.Equal(t, "https://example.com/welcome", withRedirectParams(config, req, "https://example.com/welcome"))
+}
@@ -0,0 +1,193 @@
+// Package breaker stops calling outbound dependencies that keep failing, so
+// requests fail fast instead of waiting on a dead dependency.
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/netlify/gotrue/metering"
+)
+
+// ErrOpen is returned instead of calling a dependency whose breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// The states of a breaker. A closed breaker lets calls through, an open one
+// rejects them, and a half-open one lets probes through to find out whether
+// the dependency has recovered.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Settings are the thresholds of all breakers.
+type Settings struct {
+	Enabled bool
+	// FailureThreshold is the number of failures in a row that opens a breaker.
+	FailureThreshold int
+	// OpenDuration is how long an open breaker rejects calls before probing.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of calls let through at once to probe.
+	HalfOpenProbes int
+}
+
+var (
+	mu       sync.Mutex
+	settings Settings
+	breakers = map[string]*Breaker{}
+)
+
+// Configure sets the thresholds of the breakers and resets their state.
+func Configure(s Settings) {
+	mu.Lock()
+	defer mu.Unlock()
+	settings = s
+	breakers = map[string]*Breaker{}
+}
+
+// Get returns the breaker of the named dependency.
+func Get(name string) *Breaker {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = &Breaker{name: name, settings: settings, state: StateClosed}
+		breakers[name] = b
+	}
+	return b
+}
+
+// Breaker tracks the failures of one dependency.
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	rejected int
+	openedAt time.Time
+	probes   int
+	now      func() time.Time
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && !b.clock().Before(b.openedAt.Add(b.settings.OpenDuration)) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn unless the breaker is open. failed tells whether an error of
+// fn means the dependency is failing, rather than that it rejected the call;
+// when it is nil every error counts.
+func (b *Breaker) Do(fn func() error, failed func(error) bool) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.done(err != nil && (failed == nil || failed(err)))
+	return err
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+func (b *Breaker) allow() error {
+	if !b.settings.Enabled {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if b.clock().Before(b.openedAt.Add(b.settings.OpenDuration)) {
+			b.rejected++
+			return ErrOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.probes >= b.settings.HalfOpenProbes {
+			b.rejected++
+			return ErrOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+func (b *Breaker) done(failed bool) {
+	if !b.settings.Enabled {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probes--
+	}
+	if !failed {
+		if b.state != StateClosed {
+			b.setState(StateClosed)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.settings.FailureThreshold) {
+		b.openedAt = b.clock()
+		b.setState(StateOpen)
+	}
+}
+
+func (b *Breaker) setState(state string) {
+	b.state = state
+	metering.RecordCircuitBreakerState(b.name, state, b.failures, b.rejected)
+	if state == StateClosed {
+		b.rejected = 0
+		b.probes = 0
+	}
+}
+
+// Transport is an http.RoundTripper with a breaker per host, which counts
+// failed connections and 5xx responses as failures.
+type Transport struct {
+	// Prefix tells apart the breakers of different kinds of dependencies.
+	Prefix string
+	Inner  http.RoundTripper
+}
+
+// RoundTrip sends the request unless the breaker of its host is open.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	inner := t.Inner
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	var rsp *http.Response
+	err := Get(t.Prefix+req.URL.Host).Do(func() error {
+		var err error
+		rsp, err = inner.RoundTrip(req)
+		if err == nil && rsp.StatusCode >= http.StatusInternalServerError {
+			return errServerError
+		}
+		return err
+	}, nil)
+	if err == errServerError {
+		return rsp, nil
+	}
+	return rsp, err
+}
+
+var errServerError = errors.New("server error")
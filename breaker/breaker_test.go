@@ -0,0 +1,109 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("down")
+
+func testBreaker(now *time.Time) *Breaker {
+	Configure(Settings{Enabled: true, FailureThreshold: 3, OpenDuration: time.Minute, HalfOpenProbes: 1})
+	b := Get("test")
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Now()
+	b := testBreaker(&now)
+	calls := 0
+	fail := func() error { calls++; return errDown }
+	succeed := func() error { calls++; return nil }
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, errDown, b.Do(fail, nil))
+	}
+	assert.Equal(t, StateOpen, b.State())
+
+	// open breakers fail fast
+	assert.Equal(t, ErrOpen, b.Do(succeed, nil))
+	assert.Equal(t, 3, calls)
+
+	// a failed probe opens the breaker again
+	now = now.Add(time.Minute)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.Equal(t, errDown, b.Do(fail, nil))
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, ErrOpen, b.Do(succeed, nil))
+
+	// a successful probe closes it
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Do(succeed, nil))
+	assert.Equal(t, StateClosed, b.State())
+	require.NoError(t, b.Do(succeed, nil))
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	now := time.Now()
+	b := testBreaker(&now)
+	for i := 0; i < 3; i++ {
+		_ = b.Do(func() error { return errDown }, nil)
+	}
+	now = now.Add(time.Minute)
+
+	// only one probe is let through while it is in flight
+	err := b.Do(func() error {
+		assert.Equal(t, ErrOpen, b.Do(func() error { return nil }, nil))
+		return nil
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerIgnoresRejections(t *testing.T) {
+	now := time.Now()
+	b := testBreaker(&now)
+	rejected := errors.New("rejected")
+	for i := 0; i < 5; i++ {
+		_ = b.Do(func() error { return rejected }, func(err error) bool { return err != rejected })
+	}
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	Configure(Settings{FailureThreshold: 1, OpenDuration: time.Minute, HalfOpenProbes: 1})
+	b := Get("test")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, errDown, b.Do(func() error { return errDown }, nil))
+	}
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestTransport(t *testing.T) {
+	Configure(Settings{Enabled: true, FailureThreshold: 2, OpenDuration: time.Minute, HalfOpenProbes: 1})
+	calls := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer svr.Close()
+
+	client := &http.Client{Transport: &Transport{Prefix: "test "}}
+	for i := 0; i < 2; i++ {
+		rsp, err := client.Get(svr.URL)
+		require.NoError(t, err)
+		rsp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, rsp.StatusCode)
+	}
+
+	_, err := client.Get(svr.URL)
+	assert.True(t, errors.Is(err, ErrOpen))
+	assert.Equal(t, 2, calls)
+}
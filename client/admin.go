@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// AdminListUsers returns a page of the users of the audience, newest first.
+func (c *Client) AdminListUsers(ctx context.Context, req ListUsersRequest) (*ListUsersResponse, error) {
+	query := url.Values{}
+	if req.Page > 0 {
+		query.Set("page", strconv.Itoa(req.Page))
+	}
+	if req.PerPage > 0 {
+		query.Set("per_page", strconv.Itoa(req.PerPage))
+	}
+	if req.Filter != "" {
+		query.Set("filter", req.Filter)
+	}
+	rsp := &ListUsersResponse{}
+	if err := c.admin(ctx, http.MethodGet, "/users", query, nil, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// AdminGetUser returns the user with the id. IsNotFound tells if there is none.
+func (c *Client) AdminGetUser(ctx context.Context, id string) (*User, error) {
+	user := &User{}
+	if err := c.admin(ctx, http.MethodGet, "/users/"+url.PathEscape(id), nil, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminCreateUser creates a user.
+func (c *Client) AdminCreateUser(ctx context.Context, req AdminUserRequest) (*User, error) {
+	user := &User{}
+	if err := c.admin(ctx, http.MethodPost, "/users", nil, req, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminUpdateUser updates the user with the id.
+func (c *Client) AdminUpdateUser(ctx context.Context, id string, req AdminUserRequest) (*User, error) {
+	user := &User{}
+	if err := c.admin(ctx, http.MethodPut, "/users/"+url.PathEscape(id), nil, req, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminDeleteUser deletes the user with the id.
+func (c *Client) AdminDeleteUser(ctx context.Context, id string) error {
+	return c.admin(ctx, http.MethodDelete, "/users/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// AdminRevokeUserSessions signs the user with the id out everywhere, its access
+// tokens are rejected right away.
+func (c *Client) AdminRevokeUserSessions(ctx context.Context, id string) error {
+	return c.admin(ctx, http.MethodDelete, "/users/"+url.PathEscape(id)+"/sessions", nil, nil, nil)
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Settings returns the public settings of the server.
+func (c *Client) Settings(ctx context.Context) (*Settings, error) {
+	settings := &Settings{}
+	if err := c.do(ctx, http.MethodGet, "/settings", nil, "", nil, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Signup signs a user up with an email address or phone number.
+func (c *Client) Signup(ctx context.Context, req SignupRequest) (*SignupResponse, error) {
+	var data json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/signup", nil, "", req, &data); err != nil {
+		return nil, err
+	}
+	return decodeSignup(data)
+}
+
+// SignupAnonymously signs a guest in without credentials, if the server
+// allows anonymous users.
+func (c *Client) SignupAnonymously(ctx context.Context, data map[string]interface{}) (*SessionResponse, error) {
+	rsp := &SessionResponse{}
+	query := url.Values{"grant_type": {"anonymous"}}
+	if err := c.do(ctx, http.MethodPost, "/signup", query, "", SignupRequest{Data: data}, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// decodeSignup decodes the user, or the session of a user signed in right
+// away.
+func decodeSignup(data json.RawMessage) (*SignupResponse, error) {
+	signedIn := &SessionResponse{}
+	if err := json.Unmarshal(data, signedIn); err != nil {
+		return nil, fmt.Errorf("gotrue: decoding response of POST /signup: %v", err)
+	}
+	if signedIn.Session != nil {
+		return &SignupResponse{User: signedIn.User, Session: signedIn.Session}, nil
+	}
+	user := &User{}
+	if err := json.Unmarshal(data, user); err != nil {
+		return nil, fmt.Errorf("gotrue: decoding response of POST /signup: %v", err)
+	}
+	return &SignupResponse{User: user}, nil
+}
+
+// SignInWithPassword signs a user in with a password.
+func (c *Client) SignInWithPassword(ctx context.Context, credentials PasswordCredentials) (*SessionResponse, error) {
+	rsp := &SessionResponse{}
+	query := url.Values{"grant_type": {"password"}}
+	if err := c.do(ctx, http.MethodPost, "/token", query, "", credentials, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// SignInWithIDToken signs a user in with the ID token a native app got from
+// the SDK of an external provider.
+func (c *Client) SignInWithIDToken(ctx context.Context, credentials IDTokenCredentials) (*SessionResponse, error) {
+	rsp := &SessionResponse{}
+	query := url.Values{"grant_type": {"id_token"}}
+	if err := c.do(ctx, http.MethodPost, "/token", query, "", credentials, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// RefreshSession exchanges a refresh token for a new session. The refresh
+// token can't be used again afterwards.
+func (c *Client) RefreshSession(ctx context.Context, refreshToken string) (*SessionResponse, error) {
+	rsp := &SessionResponse{}
+	query := url.Values{"grant_type": {"refresh_token"}}
+	body := map[string]string{"refresh_token": refreshToken}
+	if err := c.do(ctx, http.MethodPost, "/token", query, "", body, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Logout revokes the refresh tokens of the user with accessToken.
+func (c *Client) Logout(ctx context.Context, accessToken string) error {
+	return c.do(ctx, http.MethodPost, "/logout", nil, accessToken, nil, nil)
+}
+
+// Recover sends a recovery email to the user with the email address, if any.
+func (c *Client) Recover(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/recover", nil, "", map[string]string{"email": email}, nil)
+}
+
+// User returns the user with accessToken.
+func (c *Client) User(ctx context.Context, accessToken string) (*User, error) {
+	user := &User{}
+	if err := c.do(ctx, http.MethodGet, "/user", nil, accessToken, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateUser updates the user with accessToken. Changes of the email address
+// or phone number only take effect once confirmed.
+func (c *Client) UpdateUser(ctx context.Context, accessToken string, req UpdateUserRequest) (*User, error) {
+	user := &User{}
+	if err := c.do(ctx, http.MethodPut, "/user", nil, accessToken, req, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UserIdentities returns the identities the user with accessToken signs in
+// with.
+func (c *Client) UserIdentities(ctx context.Context, accessToken string) ([]Identity, error) {
+	rsp := struct {
+		Identities []Identity `json:"identities"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, "/user/identities", nil, accessToken, nil, &rsp); err != nil {
+		return nil, err
+	}
+	return rsp.Identities, nil
+}
+
+// LinkIdentity returns the URL of the provider to send the user with
+// accessToken to, so it links an identity at the provider.
+func (c *Client) LinkIdentity(ctx context.Context, accessToken string, req LinkIdentityRequest) (string, error) {
+	rsp := struct {
+		URL string `json:"url"`
+	}{}
+	if err := c.do(ctx, http.MethodPost, "/user/identities", nil, accessToken, req, &rsp); err != nil {
+		return "", err
+	}
+	return rsp.URL, nil
+}
+
+// UnlinkIdentity removes an identity of the user with accessToken. The last
+// identity of a user can't be removed.
+func (c *Client) UnlinkIdentity(ctx context.Context, accessToken string, identity Identity) error {
+	query := url.Values{"provider": {identity.Provider}}
+	return c.do(ctx, http.MethodDelete, "/user/identities/"+url.PathEscape(identity.ID), query, accessToken, nil, nil)
+}
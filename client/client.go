@@ -0,0 +1,185 @@
+// Package client is a Go client of the public and admin HTTP APIs of GoTrue.
+//
+// The client speaks version 2 of the API, see the X-API-Version header, so the
+// shapes of its requests and responses don't change with the defaults of the
+// server. Requests that read are retried on network errors, 5xx and 429
+// responses; requests that write are sent once.
+//
+//	c, err := client.New("https://auth.example.com")
+//	if err != nil {
+//		return err
+//	}
+//	session, err := c.SignInWithPassword(ctx, client.PasswordCredentials{
+//		Email:    "user@example.com",
+//		Password: "secret",
+//	})
+//
+// Errors returned by the server are *Error values.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netlify/gotrue/utilities"
+)
+
+const (
+	apiVersion       = "2"
+	apiVersionHeader = "X-API-Version"
+	audHeader        = "X-JWT-AUD"
+
+	// defaultAttemptTimeout bounds each attempt of the default HTTP client.
+	defaultAttemptTimeout = 10 * time.Second
+	// maxErrorBodySize bounds the error responses read.
+	maxErrorBodySize = 64 << 10
+)
+
+// Client calls the APIs of a GoTrue server. Its fields must not be changed
+// while requests are in flight.
+type Client struct {
+	// BaseURL is the URL GoTrue is served at.
+	BaseURL *url.URL
+	// Audience is sent with every request when set, instead of the default
+	// audience of the server.
+	Audience string
+	// AdminToken authenticates the calls of the admin API.
+	AdminToken string
+	// HTTPClient sends the requests. New sets it to a client that retries
+	// reads.
+	HTTPClient *http.Client
+}
+
+// New returns a client of the GoTrue server at baseURL.
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("gotrue: invalid base URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("gotrue: invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	return &Client{
+		BaseURL: u,
+		HTTPClient: &http.Client{
+			Transport: utilities.NewRetryTransport(http.DefaultTransport, defaultAttemptTimeout),
+		},
+	}, nil
+}
+
+// FieldError describes an invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"msg"`
+}
+
+// Error is an error response of the server.
+type Error struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int `json:"-"`
+	// Code classifies the error, e.g. "validation_failed" or "not_found".
+	Code    string `json:"error_code"`
+	Message string `json:"msg"`
+	// Errors lists every invalid field of the request, if any.
+	Errors []FieldError `json:"errors,omitempty"`
+	// OAuthError and OAuthErrorDescription are set by the OAuth endpoints,
+	// such as the token endpoint, instead of Code and Message.
+	OAuthError            string `json:"error"`
+	OAuthErrorDescription string `json:"error_description"`
+	// ErrorID identifies the error in the logs of the server.
+	ErrorID string `json:"error_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = e.OAuthErrorDescription
+	}
+	if message == "" {
+		message = e.OAuthError
+	}
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("gotrue: %d: %s", e.StatusCode, message)
+}
+
+// IsNotFound tells if err is a 404 response.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// do sends a request with body encoded as JSON and the access token, if any,
+// and decodes the response into out, if set.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, token string, body, out interface{}) error {
+	u := *c.BaseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("gotrue: encoding request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return fmt.Errorf("gotrue: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(apiVersionHeader, apiVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.Audience != "" {
+		req.Header.Set(audHeader, c.Audience)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("gotrue: %s %s: %v", method, path, err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: rsp.StatusCode}
+		data, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, maxErrorBodySize))
+		// bodies that aren't JSON leave only the status
+		_ = json.Unmarshal(data, apiErr)
+		return apiErr
+	}
+	if out == nil || rsp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(ioutil.Discard, rsp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gotrue: decoding response of %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+// admin sends a request of the admin API.
+func (c *Client) admin(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	if c.AdminToken == "" {
+		return fmt.Errorf("gotrue: %s %s requires an admin token", method, path)
+	}
+	return c.do(ctx, method, "/admin"+path, query, c.AdminToken, body, out)
+}
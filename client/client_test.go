@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClient(t *testing.T, handler http.HandlerFunc) (*Client, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	c, err := New(server.URL)
+	require.NoError(t, err)
+	c.Audience = "app"
+	c.AdminToken = "admin-token"
+	return c, server
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("ftp://auth.example.com")
+	assert.Error(t, err)
+	c, err := New("https://auth.example.com/auth/")
+	require.NoError(t, err)
+	assert.Equal(t, "/auth", c.BaseURL.Path)
+}
+
+func TestSignInWithPassword(t *testing.T) {
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/token", r.URL.Path)
+		assert.Equal(t, "password", r.URL.Query().Get("grant_type"))
+		assert.Equal(t, "2", r.Header.Get("X-API-Version"))
+		assert.Equal(t, "app", r.Header.Get("X-JWT-AUD"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		credentials := PasswordCredentials{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&credentials))
+		assert.Equal(t, PasswordCredentials{Email: "user@example.com", Password: "secret"}, credentials)
+
+		w.Write([]byte(`{"session":{"access_token":"access","token_type":"bearer","expires_in":3600,"expires_at":1658142000,"refresh_token":"refresh"},"user":{"id":"11111111-2222-3333-4444-555555555555","email":"user@example.com"}}`))
+	})
+	defer server.Close()
+
+	rsp, err := c.SignInWithPassword(context.Background(), PasswordCredentials{Email: "user@example.com", Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "access", rsp.Session.AccessToken)
+	assert.Equal(t, "refresh", rsp.Session.RefreshToken)
+	assert.Equal(t, int64(1658142000), rsp.Session.ExpiresAt)
+	assert.Equal(t, "user@example.com", rsp.User.Email)
+}
+
+func TestSignInWithIDToken(t *testing.T) {
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/token", r.URL.Path)
+		assert.Equal(t, "id_token", r.URL.Query().Get("grant_type"))
+		credentials := IDTokenCredentials{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&credentials))
+		assert.Equal(t, IDTokenCredentials{Provider: "google", IDToken: "id-token", Nonce: "nonce"}, credentials)
+
+		w.Write([]byte(`{"session":{"access_token":"access"},"user":{"email":"user@example.com"}}`))
+	})
+	defer server.Close()
+
+	rsp, err := c.SignInWithIDToken(context.Background(), IDTokenCredentials{Provider: "google", IDToken: "id-token", Nonce: "nonce"})
+	require.NoError(t, err)
+	assert.Equal(t, "access", rsp.Session.AccessToken)
+}
+
+func TestSignup(t *testing.T) {
+	body := `{"id":"11111111-2222-3333-4444-555555555555","email":"user@example.com"}`
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	defer server.Close()
+
+	// users who have to confirm their email aren't signed in
+	rsp, err := c.Signup(context.Background(), SignupRequest{Email: "user@example.com", Password: "secret"})
+	require.NoError(t, err)
+	assert.Nil(t, rsp.Session)
+	assert.Equal(t, "user@example.com", rsp.User.Email)
+
+	body = `{"session":{"access_token":"access"},"user":{"email":"user@example.com"}}`
+	rsp, err = c.Signup(context.Background(), SignupRequest{Email: "user@example.com", Password: "secret"})
+	require.NoError(t, err)
+	require.NotNil(t, rsp.Session)
+	assert.Equal(t, "access", rsp.Session.AccessToken)
+	assert.Equal(t, "user@example.com", rsp.User.Email)
+}
+
+func TestErrors(t *testing.T) {
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/signup":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"code":422,"error_code":"validation_failed","msg":"Password should be at least 6 characters","errors":[{"field":"password","msg":"Password should be at least 6 characters"}]}`))
+		case "/token":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"Invalid login credentials"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`not json`))
+		}
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	_, err := c.Signup(ctx, SignupRequest{Email: "user@example.com", Password: "123"})
+	apiErr, ok := err.(*Error)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, "validation_failed", apiErr.Code)
+	assert.Equal(t, []FieldError{{Field: "password", Message: "Password should be at least 6 characters"}}, apiErr.Errors)
+
+	_, err = c.SignInWithPassword(ctx, PasswordCredentials{Email: "user@example.com", Password: "wrong"})
+	assert.EqualError(t, err, "gotrue: 400: Invalid login credentials")
+
+	_, err = c.AdminGetUser(ctx, "11111111-2222-3333-4444-555555555555")
+	assert.True(t, IsNotFound(err))
+	assert.EqualError(t, err, "gotrue: 404: Not Found")
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"external":{"github":true}}`))
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	// reads are retried
+	settings, err := c.Settings(ctx)
+	require.NoError(t, err)
+	assert.True(t, settings.External["github"])
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// writes aren't
+	atomic.StoreInt32(&calls, 0)
+	err = c.Recover(ctx, "user@example.com")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestAdmin(t *testing.T) {
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer admin-token", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/admin/users":
+			assert.Equal(t, "2", r.URL.Query().Get("page"))
+			assert.Equal(t, "example.com", r.URL.Query().Get("filter"))
+			w.Write([]byte(`{"users":[{"id":"11111111-2222-3333-4444-555555555555"}],"aud":"app"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/admin/users/11111111-2222-3333-4444-555555555555/sessions":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	users, err := c.AdminListUsers(ctx, ListUsersRequest{Page: 2, Filter: "example.com"})
+	require.NoError(t, err)
+	require.Len(t, users.Users, 1)
+	assert.Equal(t, "app", users.Aud)
+
+	assert.NoError(t, c.AdminRevokeUserSessions(ctx, "11111111-2222-3333-4444-555555555555"))
+
+	// the admin API isn't called without an admin token
+	c.AdminToken = ""
+	_, err = c.AdminGetUser(ctx, "11111111-2222-3333-4444-555555555555")
+	assert.Error(t, err)
+}
+
+func TestIdentities(t *testing.T) {
+	c, server := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/user/identities":
+			w.Write([]byte(`{"identities":[{"id":"123","provider":"github"}]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/user/identities":
+			req := LinkIdentityRequest{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "google", req.Provider)
+			w.Write([]byte(`{"url":"https://accounts.google.com/o/oauth2/auth?state=state"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/user/identities/123":
+			assert.Equal(t, "github", r.URL.Query().Get("provider"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	identities, err := c.UserIdentities(ctx, "access")
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "github", identities[0].Provider)
+
+	authURL, err := c.LinkIdentity(ctx, "access", LinkIdentityRequest{Provider: "google"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://accounts.google.com/o/oauth2/auth?state=state", authURL)
+
+	assert.NoError(t, c.UnlinkIdentity(ctx, "access", identities[0]))
+}
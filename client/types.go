@@ -0,0 +1,141 @@
+package client
+
+import "time"
+
+// User is a user of GoTrue.
+type User struct {
+	ID               string                 `json:"id"`
+	Aud              string                 `json:"aud"`
+	Role             string                 `json:"role"`
+	Roles            []string               `json:"roles,omitempty"`
+	Email            string                 `json:"email"`
+	EmailConfirmedAt *time.Time             `json:"email_confirmed_at,omitempty"`
+	Phone            string                 `json:"phone"`
+	PhoneConfirmedAt *time.Time             `json:"phone_confirmed_at,omitempty"`
+	ExternalID       string                 `json:"external_id,omitempty"`
+	IsAnonymous      bool                   `json:"is_anonymous"`
+	NewEmail         string                 `json:"new_email,omitempty"`
+	NewPhone         string                 `json:"new_phone,omitempty"`
+	InvitedAt        *time.Time             `json:"invited_at,omitempty"`
+	LastSignInAt     *time.Time             `json:"last_sign_in_at,omitempty"`
+	BannedUntil      *time.Time             `json:"banned_until,omitempty"`
+	AppMetadata      map[string]interface{} `json:"app_metadata"`
+	UserMetadata     map[string]interface{} `json:"user_metadata"`
+	Identities       []Identity             `json:"identities"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+}
+
+// Identity is an identity of a user at a provider.
+type Identity struct {
+	ID           string                 `json:"id"`
+	UserID       string                 `json:"user_id"`
+	Provider     string                 `json:"provider"`
+	IdentityData map[string]interface{} `json:"identity_data,omitempty"`
+	LastSignInAt *time.Time             `json:"last_sign_in_at,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+// Session holds the tokens of a signed in user.
+type Session struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	ExpiresAt    int64  `json:"expires_at"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SessionResponse is returned by the requests that sign users in.
+type SessionResponse struct {
+	Session *Session `json:"session"`
+	User    *User    `json:"user"`
+}
+
+// Settings are the public settings of the server.
+type Settings struct {
+	External          map[string]bool `json:"external"`
+	DisableSignup     bool            `json:"disable_signup"`
+	MailerAutoconfirm bool            `json:"mailer_autoconfirm"`
+	PhoneAutoconfirm  bool            `json:"phone_autoconfirm"`
+	SmsProvider       string          `json:"sms_provider"`
+}
+
+// SignupRequest signs a user up with an email address or phone number.
+type SignupRequest struct {
+	Email    string                 `json:"email,omitempty"`
+	Phone    string                 `json:"phone,omitempty"`
+	Password string                 `json:"password,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// SignupResponse is the result of a signup. Session is only set if the user
+// is signed in right away, which requires autoconfirmation.
+type SignupResponse struct {
+	User    *User
+	Session *Session
+}
+
+// PasswordCredentials sign a user in with an email address or phone number.
+type PasswordCredentials struct {
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Password string `json:"password"`
+}
+
+// IDTokenCredentials sign a user in with an ID token of Provider. Nonce is
+// the nonce whose SHA-256 was passed to the provider, if any.
+type IDTokenCredentials struct {
+	Provider string `json:"provider"`
+	IDToken  string `json:"id_token"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+// UpdateUserRequest updates the signed in user. Empty fields are left as is.
+type UpdateUserRequest struct {
+	Email    string                 `json:"email,omitempty"`
+	Phone    string                 `json:"phone,omitempty"`
+	Password *string                `json:"password,omitempty"`
+	Nonce    string                 `json:"nonce,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// LinkIdentityRequest links an identity at Provider to the signed in user.
+type LinkIdentityRequest struct {
+	Provider   string `json:"provider"`
+	Scopes     string `json:"scopes,omitempty"`
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// AdminUserRequest creates or updates a user with the admin API. Empty
+// fields are left as is on updates.
+type AdminUserRequest struct {
+	Aud          string                 `json:"aud,omitempty"`
+	Role         string                 `json:"role,omitempty"`
+	Email        string                 `json:"email,omitempty"`
+	Phone        string                 `json:"phone,omitempty"`
+	Password     *string                `json:"password,omitempty"`
+	EmailConfirm bool                   `json:"email_confirm,omitempty"`
+	PhoneConfirm bool                   `json:"phone_confirm,omitempty"`
+	UserMetadata map[string]interface{} `json:"user_metadata,omitempty"`
+	AppMetadata  map[string]interface{} `json:"app_metadata,omitempty"`
+	// BanDuration bans the user for a duration such as "24h", "none" lifts
+	// the ban.
+	BanDuration string  `json:"ban_duration,omitempty"`
+	ExternalID  *string `json:"external_id,omitempty"`
+}
+
+// ListUsersRequest pages through the users of the audience of the client.
+type ListUsersRequest struct {
+	// Page starts at 1, it and PerPage default to the server's defaults.
+	Page    int
+	PerPage int
+	// Filter matches the email, full name or external id of the users.
+	Filter string
+}
+
+// ListUsersResponse is a page of users.
+type ListUsersResponse struct {
+	Users []User `json:"users"`
+	Aud   string `json:"aud"`
+}
@@ -0,0 +1,26 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	defer Set(nil)
+
+	start := time.Date(2022, 7, 25, 9, 30, 0, 0, time.UTC)
+	fake := NewFake(start)
+	Set(fake)
+	assert.Equal(t, start, Now())
+	fake.Advance(time.Hour)
+	assert.Equal(t, start.Add(time.Hour), Now())
+
+	Set(Offset(24 * time.Hour))
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), Now(), time.Second)
+
+	Set(nil)
+	assert.Equal(t, System{}, Get())
+	assert.WithinDuration(t, time.Now(), Now(), time.Second)
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"text/tabwriter"
 
 	"github.com/gobuffalo/pop/v5"
 	"github.com/gobuffalo/pop/v5/logging"
 	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/storage"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -19,6 +21,50 @@ var migrateCmd = cobra.Command{
 	Run:  migrate,
 }
 
+var migrateStatusCmd = cobra.Command{
+	Use:  "status",
+	Long: "Show the applied and pending migrations. Exits with 1 when the database schema doesn't match the migrations.",
+	Run:  migrateStatus,
+}
+
+func init() {
+	migrateCmd.AddCommand(&migrateStatusCmd)
+}
+
+func migrateStatus(cmd *cobra.Command, args []string) {
+	globalConfig, err := conf.LoadGlobal(configFile)
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %+v", err)
+	}
+	db, err := storage.Dial(globalConfig)
+	if err != nil {
+		logrus.Fatalf("Error opening database: %+v", err)
+	}
+	defer db.Close()
+
+	status, err := storage.GetMigrationStatus(db, globalConfig.DB.MigrationsPath)
+	if err != nil {
+		logrus.Fatalf("Error reading migration status: %+v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "Version\tName\tStatus")
+	for _, migration := range status.Applied {
+		fmt.Fprintf(w, "%s\t%s\tApplied\n", migration.Version, migration.Name)
+	}
+	for _, migration := range status.Pending {
+		fmt.Fprintf(w, "%s\t%s\tPending\n", migration.Version, migration.Name)
+	}
+	for _, version := range status.Unknown {
+		fmt.Fprintf(w, "%s\t\tUnknown\n", version)
+	}
+	w.Flush()
+
+	if !status.UpToDate() {
+		os.Exit(1)
+	}
+}
+
 func migrate(cmd *cobra.Command, args []string) {
 	globalConfig, err := conf.LoadGlobal(configFile)
 	if err != nil {
@@ -66,7 +112,7 @@ func migrate(cmd *cobra.Command, args []string) {
 		URL:     processedUrl,
 	}
 	deets.Options = map[string]string{
-		"migration_table_name": "schema_migrations",
+		"migration_table_name": storage.MigrationTableName,
 	}
 
 	db, err := pop.NewConnection(deets)
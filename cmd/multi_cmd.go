@@ -26,6 +26,7 @@ func multi(cmd *cobra.Command, args []string) {
 	if globalConfig.OperatorToken == "" {
 		logrus.Fatal("Operator token secret is required")
 	}
+	checkUnsafeSettings(globalConfig, nil)
 
 	var db *storage.Connection
 	// try a couple times to connect to the database
@@ -41,6 +42,7 @@ func multi(cmd *cobra.Command, args []string) {
 		logrus.Fatalf("Error opening database: %+v", err)
 	}
 	defer db.Close()
+	checkSchema(globalConfig, db)
 
 	globalConfig.MultiInstanceMode = true
 	api := api.NewAPIWithVersion(context.Background(), globalConfig, db, Version)
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var seedUsers, seedBatchSize int
+var seedPassword, seedEmailDomain string
+
+var seedCmd = cobra.Command{
+	Use:  "seed",
+	Long: "Create confirmed users with email identities, to benchmark the database against realistic data volumes. Never run it against a production database.",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, seed)
+	},
+}
+
+func init() {
+	seedCmd.Flags().IntVar(&seedUsers, "users", 1000, "Number of users to create")
+	seedCmd.Flags().IntVar(&seedBatchSize, "batch-size", 1000, "Number of users created per transaction")
+	seedCmd.Flags().StringVar(&seedPassword, "password", "password", "Password of every user")
+	seedCmd.Flags().StringVar(&seedEmailDomain, "email-domain", "example.com", "Domain of the users' email addresses")
+	seedCmd.Flags().StringVarP(&audience, "aud", "a", "", "Set the users' audience")
+	seedCmd.Flags().StringVarP(&instanceID, "instance_id", "i", "", "Set the instance ID to create the users in")
+}
+
+func seed(globalConfig *conf.GlobalConfiguration, config *conf.Configuration) {
+	if seedUsers <= 0 || seedBatchSize <= 0 {
+		logrus.Fatal("--users and --batch-size must be positive")
+	}
+	iid := uuid.Nil
+	if instanceID != "" {
+		iid = uuid.Must(uuid.FromString(instanceID))
+	}
+
+	db, err := storage.Dial(globalConfig)
+	if err != nil {
+		logrus.Fatalf("Error opening database: %+v", err)
+	}
+	defer db.Close()
+
+	// hashing once keeps seeding fast, users can still sign in with the password
+	hash, err := bcrypt.GenerateFromPassword([]byte(seedPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logrus.Fatalf("Error hashing password: %+v", err)
+	}
+	aud := getAudience(config)
+	// a run id keeps the emails of repeated runs apart
+	run := uuid.Must(uuid.NewV4()).String()[:8]
+
+	start := time.Now()
+	for created := 0; created < seedUsers; {
+		batch := seedBatchSize
+		if remaining := seedUsers - created; remaining < batch {
+			batch = remaining
+		}
+		err := db.Transaction(func(tx *storage.Connection) error {
+			for i := created; i < created+batch; i++ {
+				if terr := seedUser(tx, config, iid, aud, fmt.Sprintf("seed-%s-%d@%s", run, i, seedEmailDomain), string(hash)); terr != nil {
+					return terr
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.Fatalf("Error seeding users: %+v", err)
+		}
+		created += batch
+		logrus.Infof("Seeded %d of %d users (%s)", created, seedUsers, time.Since(start).Round(time.Second))
+	}
+}
+
+func seedUser(tx *storage.Connection, config *conf.Configuration, instanceID uuid.UUID, aud, email, passwordHash string) error {
+	user, err := models.NewUserWithPasswordHash(instanceID, "", email, passwordHash, aud, nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.Role = config.JWT.DefaultGroupName
+	user.EmailConfirmedAt = &now
+	user.AppMetaData = map[string]interface{}{
+		"provider":  "email",
+		"providers": []string{"email"},
+	}
+	if err := tx.Create(user); err != nil {
+		return err
+	}
+
+	identity, err := models.NewIdentity(user, "email", map[string]interface{}{
+		"sub":   user.ID.String(),
+		"email": email,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Create(identity)
+}
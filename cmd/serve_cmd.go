@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/api"
@@ -21,11 +22,14 @@ var serveCmd = cobra.Command{
 }
 
 func serve(globalConfig *conf.GlobalConfiguration, config *conf.Configuration) {
+	checkUnsafeSettings(globalConfig, config)
+
 	db, err := storage.Dial(globalConfig)
 	if err != nil {
 		logrus.Fatalf("Error opening database: %+v", err)
 	}
 	defer db.Close()
+	checkSchema(globalConfig, db)
 
 	ctx, err := api.WithInstanceConfig(context.Background(), config, uuid.Nil)
 	if err != nil {
@@ -37,3 +41,49 @@ func serve(globalConfig *conf.GlobalConfiguration, config *conf.Configuration) {
 	logrus.Infof("GoTrue API started on: %s", l)
 	api.ListenAndServe(l)
 }
+
+// checkSchema refuses to start when the migrations applied to the database
+// don't match the ones of this release, as with deploys racing migrations,
+// unless DB_SCHEMA_CHECK allows it.
+func checkSchema(globalConfig *conf.GlobalConfiguration, db *storage.Connection) {
+	if globalConfig.DB.SchemaCheck == conf.SchemaCheckOff {
+		return
+	}
+	status, err := storage.GetMigrationStatus(db, globalConfig.DB.MigrationsPath)
+	if err != nil {
+		if globalConfig.DB.SchemaCheck == conf.SchemaCheckFail {
+			logrus.Fatalf("Error checking the database schema, set GOTRUE_DB_SCHEMA_CHECK to warn to start anyway: %+v", err)
+		}
+		logrus.WithError(err).Warn("Error checking the database schema")
+		return
+	}
+	if status.UpToDate() {
+		return
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"database_version": status.DatabaseVersion,
+		"latest_version":   status.LatestVersion,
+		"pending":          len(status.Pending),
+		"unknown":          len(status.Unknown),
+	})
+	if globalConfig.DB.SchemaCheck == conf.SchemaCheckFail {
+		log.Fatal("Refusing to start as the database schema doesn't match the migrations, run gotrue migrate or set GOTRUE_DB_SCHEMA_CHECK to warn to start anyway")
+	}
+	log.Warn("The database schema doesn't match the migrations")
+}
+
+// checkUnsafeSettings refuses to start in production with unsafe settings,
+// unless they are explicitly allowed, and warns about them otherwise.
+func checkUnsafeSettings(globalConfig *conf.GlobalConfiguration, config *conf.Configuration) {
+	unsafe := conf.UnsafeSettings(globalConfig, config)
+	if len(unsafe) == 0 {
+		return
+	}
+	if globalConfig.IsProduction() && !globalConfig.AllowUnsafeSettings {
+		logrus.Fatalf("Refusing to start in production with unsafe settings, set GOTRUE_ALLOW_UNSAFE_SETTINGS to start anyway: %s", strings.Join(unsafe, "; "))
+	}
+	for _, setting := range unsafe {
+		logrus.Warnf("Unsafe setting: %s", setting)
+	}
+}
@@ -1,16 +1,26 @@
 package conf
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql/driver"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/netlify/gotrue/breaker"
+	"github.com/netlify/gotrue/security"
 )
 
 const defaultMinPasswordLength int = 6
@@ -23,12 +33,20 @@ type OAuthProviderConfiguration struct {
 	URL         string `json:"url"`
 	ApiURL      string `json:"api_url" split_words:"true"`
 	Enabled     bool   `json:"enabled"`
+	// AdditionalClientIDs are the client IDs of native apps, whose ID tokens
+	// the id_token grant accepts next to those issued to ClientID.
+	AdditionalClientIDs []string `json:"additional_client_ids" envconfig:"ADDITIONAL_CLIENT_IDS"`
 }
 
 type EmailProviderConfiguration struct {
 	Enabled bool `json:"enabled" default:"true"`
 }
 
+// AnonymousProviderConfiguration enables sign-ins without credentials.
+type AnonymousProviderConfiguration struct {
+	Enabled bool `json:"enabled"`
+}
+
 type SamlProviderConfiguration struct {
 	Enabled     bool   `json:"enabled"`
 	MetadataURL string `json:"metadata_url" envconfig:"METADATA_URL"`
@@ -46,8 +64,19 @@ type DBConfiguration struct {
 	// MaxPoolSize defaults to 0 (unlimited).
 	MaxPoolSize    int    `json:"max_pool_size" split_words:"true"`
 	MigrationsPath string `json:"migrations_path" split_words:"true" default:"./migrations"`
+
+	// SchemaCheck is what the server does when the migrations applied to the
+	// database don't match the ones in MigrationsPath.
+	SchemaCheck string `json:"schema_check" split_words:"true" default:"fail"`
 }
 
+// What the server does when the database schema doesn't match its migrations.
+const (
+	SchemaCheckFail = "fail"
+	SchemaCheckWarn = "warn"
+	SchemaCheckOff  = "off"
+)
+
 // JWTConfiguration holds all the JWT related configuration.
 type JWTConfiguration struct {
 	Secret           string   `json:"secret" required:"true"`
@@ -56,28 +85,211 @@ type JWTConfiguration struct {
 	AdminGroupName   string   `json:"admin_group_name" split_words:"true"`
 	AdminRoles       []string `json:"admin_roles" split_words:"true"`
 	DefaultGroupName string   `json:"default_group_name" split_words:"true"`
+
+	// ExpByAud and ExpByRole override Exp, in seconds, for the access tokens
+	// of an audience or a role. See ExpFor.
+	ExpByAud  map[string]int `json:"exp_by_aud" split_words:"true"`
+	ExpByRole map[string]int `json:"exp_by_role" split_words:"true"`
+
+	// AdminMaskedRoles are admin roles, like a support role, that only see
+	// users with their email addresses and phone numbers masked.
+	AdminMaskedRoles []string `json:"admin_masked_roles" split_words:"true"`
+
+	// AppMetadataClaims are the app_metadata keys copied into access tokens as
+	// claims prefixed with ClaimsNamespace. The rest of app_metadata is left
+	// out of the token once any are configured.
+	AppMetadataClaims []string `json:"app_metadata_claims" split_words:"true"`
+	ClaimsNamespace   string   `json:"claims_namespace" split_words:"true"`
+
+	// MaxSize is the size in bytes access tokens should stay within. Larger
+	// tokens are logged or, with MaxSizeAction fail, not issued at all.
+	MaxSize       int    `json:"max_size" split_words:"true"`
+	MaxSizeAction string `json:"max_size_action" split_words:"true"`
+	// ClaimsReference replaces the metadata claims of tokens larger than
+	// MaxSize with a reference to the claims served at /userinfo.
+	ClaimsReference bool `json:"claims_reference" split_words:"true"`
+
+	// Algorithm is the algorithm access tokens are signed with. Tokens are
+	// signed with the secret with HS256, and with PrivateKey otherwise so
+	// other services verify them with the public key served as a JWKS.
+	Algorithm  string `json:"algorithm"`
+	PrivateKey string `json:"private_key" split_words:"true"`
+
+	// Keys replace the key above on their schedule, so access tokens can be
+	// signed with a new key without invalidating the outstanding ones. A key
+	// keeps verifying tokens for RotationGrace after the next key replaced it.
+	Keys          JWTKeys       `json:"keys"`
+	RotationGrace time.Duration `json:"rotation_grace" split_words:"true"`
 }
 
+// ExpFor returns the expiry in seconds of the access tokens of aud with
+// roles. The shortest expiry configured for any of the roles wins, then the
+// one configured for the audience, then Exp.
+func (c *JWTConfiguration) ExpFor(aud string, roles []string) int {
+	exp := 0
+	for _, role := range roles {
+		if roleExp, ok := c.ExpByRole[role]; ok && (exp == 0 || roleExp < exp) {
+			exp = roleExp
+		}
+	}
+	if exp > 0 {
+		return exp
+	}
+	if audExp, ok := c.ExpByAud[aud]; ok {
+		return audExp
+	}
+	return c.Exp
+}
+
+// MaxExp returns the longest expiry in seconds of any access token.
+func (c *JWTConfiguration) MaxExp() int {
+	exp := c.Exp
+	for _, overrides := range []map[string]int{c.ExpByAud, c.ExpByRole} {
+		for _, override := range overrides {
+			if override > exp {
+				exp = override
+			}
+		}
+	}
+	return exp
+}
+
+// What happens when an access token is larger than JWT_MAX_SIZE.
+const (
+	JWTMaxSizeWarn = "warn"
+	JWTMaxSizeFail = "fail"
+)
+
+// Algorithms access tokens can be signed with.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
 // GlobalConfiguration holds all the configuration that applies to all instances.
 type GlobalConfiguration struct {
 	API struct {
-		Host            string
-		Port            int `envconfig:"PORT" default:"8081"`
-		Endpoint        string
-		RequestIDHeader string `envconfig:"REQUEST_ID_HEADER"`
-		ExternalURL     string `json:"external_url" envconfig:"API_EXTERNAL_URL"`
-	}
-	DB                    DBConfiguration
-	External              ProviderConfiguration
-	Logging               LoggingConfig `envconfig:"LOG"`
-	OperatorToken         string        `split_words:"true" required:"false"`
-	MultiInstanceMode     bool
-	Tracing               TracingConfig
+		Host                    string
+		Port                    int `envconfig:"PORT" default:"8081"`
+		Endpoint                string
+		RequestIDHeader         string `envconfig:"REQUEST_ID_HEADER"`
+		ClientCertificateHeader string `envconfig:"CLIENT_CERTIFICATE_HEADER"`
+		ExternalURL             string `json:"external_url" envconfig:"API_EXTERNAL_URL"`
+		CORSMaxAge              int    `json:"cors_max_age" envconfig:"CORS_MAX_AGE" default:"300"`
+	}
+	DB                DBConfiguration
+	External          ProviderConfiguration
+	Logging           LoggingConfig `envconfig:"LOG"`
+	OperatorToken     string        `split_words:"true" required:"false"`
+	MultiInstanceMode bool
+	Tracing           TracingConfig
+	Proxy             ProxyConfig
+	CircuitBreaker    CircuitBreakerConfiguration `split_words:"true"`
+	// JWKSCacheTTL is how long the keys of external providers are used
+	// before they are refreshed in the background.
+	JWKSCacheTTL          time.Duration `envconfig:"JWKS_CACHE_TTL" default:"1h"`
 	SMTP                  SMTPConfiguration
-	RateLimitHeader       string  `split_words:"true"`
-	RateLimitEmailSent    float64 `split_words:"true" default:"30"`
-	RateLimitVerify       float64 `split_words:"true" default:"30"`
-	RateLimitTokenRefresh float64 `split_words:"true" default:"30"`
+	RateLimitHeader       string           `split_words:"true"`
+	RateLimitEmailSent    float64          `split_words:"true" default:"30"`
+	RateLimitVerify       float64          `split_words:"true" default:"30"`
+	RateLimitTokenRefresh float64          `split_words:"true" default:"30"`
+	RateLimitClients      RateLimitClients `split_words:"true"`
+	Blocklist             BlocklistConfiguration
+	Jobs                  JobsConfiguration
+
+	// Env is the deployment profile GoTrue runs with. In production it
+	// refuses to start with unsafe settings unless AllowUnsafeSettings is set.
+	Env                 string `envconfig:"ENV"`
+	AllowUnsafeSettings bool   `split_words:"true"`
+
+	// TestClock lets admins move the clock that tokens, bans and OTPs expire
+	// by, so integration tests can fast-forward time instead of sleeping.
+	TestClock bool `split_words:"true"`
+}
+
+// CircuitBreakerConfiguration stops calls to webhooks, SMS providers, SMTP
+// servers and OAuth token endpoints that keep failing.
+type CircuitBreakerConfiguration struct {
+	Enabled          bool
+	FailureThreshold int           `split_words:"true" default:"5"`
+	OpenDuration     time.Duration `split_words:"true" default:"30s"`
+	HalfOpenProbes   int           `split_words:"true" default:"1"`
+}
+
+// JobsConfiguration controls the background jobs the API server runs for every instance.
+type JobsConfiguration struct {
+	Disabled bool
+	Interval time.Duration `default:"1h"`
+}
+
+// BlocklistConfiguration holds the user agents and header fingerprints of
+// automated clients whose requests are rejected before any other work is done.
+type BlocklistConfiguration struct {
+	UserAgents         []string    `split_words:"true"`
+	HeaderFingerprints []string    `split_words:"true"`
+	UserAgentGlobs     []glob.Glob `ignored:"true"`
+}
+
+// Compile compiles the user agent patterns, which are matched case-insensitively.
+func (b *BlocklistConfiguration) Compile() error {
+	b.UserAgentGlobs = nil
+	for _, pattern := range b.UserAgents {
+		g, err := glob.Compile(strings.ToLower(pattern))
+		if err != nil {
+			return fmt.Errorf("invalid blocklist user agent %q: %w", pattern, err)
+		}
+		b.UserAgentGlobs = append(b.UserAgentGlobs, g)
+	}
+	return nil
+}
+
+// BlocksUserAgent returns true if userAgent matches one of the blocked patterns.
+func (b *BlocklistConfiguration) BlocksUserAgent(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, g := range b.UserAgentGlobs {
+		if g.Match(userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitClient is a trusted server-side caller whose rate limits are
+// scaled by Multiplier. A multiplier of 0 disables rate limiting for it.
+type RateLimitClient struct {
+	Key        string
+	Multiplier float64
+}
+
+// RateLimitClients maps client names to their configuration. It is read from
+// a comma-separated list of name:key:multiplier entries.
+type RateLimitClients map[string]RateLimitClient
+
+// Decode implements envconfig.Decoder
+func (c *RateLimitClients) Decode(value string) error {
+	clients := RateLimitClients{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid rate limit client %q, expected name:key:multiplier", entry)
+		}
+		multiplier, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return fmt.Errorf("invalid multiplier for rate limit client %q: %v", parts[0], err)
+		}
+		if multiplier < 0 || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+			return fmt.Errorf("invalid multiplier for rate limit client %q: must be 0 or a positive number", parts[0])
+		}
+		clients[parts[0]] = RateLimitClient{Key: parts[1], Multiplier: multiplier}
+	}
+	*c = clients
+	return nil
 }
 
 // EmailContentConfiguration holds the configuration for emails, both subjects and template URLs.
@@ -88,41 +300,80 @@ type EmailContentConfiguration struct {
 	EmailChange      string `json:"email_change" split_words:"true"`
 	MagicLink        string `json:"magic_link" split_words:"true"`
 	Reauthentication string `json:"reauthentication"`
+	RecoveryCode     string `json:"recovery_code" split_words:"true"`
 }
 
 type ProviderConfiguration struct {
-	Apple       OAuthProviderConfiguration `json:"apple"`
-	Azure       OAuthProviderConfiguration `json:"azure"`
-	Bitbucket   OAuthProviderConfiguration `json:"bitbucket"`
-	Discord     OAuthProviderConfiguration `json:"discord"`
-	Facebook    OAuthProviderConfiguration `json:"facebook"`
-	Github      OAuthProviderConfiguration `json:"github"`
-	Gitlab      OAuthProviderConfiguration `json:"gitlab"`
-	Google      OAuthProviderConfiguration `json:"google"`
-	Notion      OAuthProviderConfiguration `json:"notion"`
-	Keycloak    OAuthProviderConfiguration `json:"keycloak"`
-	Linkedin    OAuthProviderConfiguration `json:"linkedin"`
-	Spotify     OAuthProviderConfiguration `json:"spotify"`
-	Slack       OAuthProviderConfiguration `json:"slack"`
-	Twitter     OAuthProviderConfiguration `json:"twitter"`
-	Twitch      OAuthProviderConfiguration `json:"twitch"`
-	WorkOS      OAuthProviderConfiguration `json:"workos"`
-	Email       EmailProviderConfiguration `json:"email"`
-	Phone       PhoneProviderConfiguration `json:"phone"`
-	Saml        SamlProviderConfiguration  `json:"saml"`
-	Zoom        OAuthProviderConfiguration `json:"zoom"`
-	IosBundleId string                     `json:"ios_bundle_id" split_words:"true"`
-	RedirectURL string                     `json:"redirect_url"`
+	Apple          OAuthProviderConfiguration     `json:"apple"`
+	Azure          OAuthProviderConfiguration     `json:"azure"`
+	Bitbucket      OAuthProviderConfiguration     `json:"bitbucket"`
+	Discord        OAuthProviderConfiguration     `json:"discord"`
+	Facebook       OAuthProviderConfiguration     `json:"facebook"`
+	Github         OAuthProviderConfiguration     `json:"github"`
+	Gitlab         OAuthProviderConfiguration     `json:"gitlab"`
+	Google         OAuthProviderConfiguration     `json:"google"`
+	Notion         OAuthProviderConfiguration     `json:"notion"`
+	Keycloak       OAuthProviderConfiguration     `json:"keycloak"`
+	Linkedin       OAuthProviderConfiguration     `json:"linkedin"`
+	Spotify        OAuthProviderConfiguration     `json:"spotify"`
+	Slack          OAuthProviderConfiguration     `json:"slack"`
+	Twitter        OAuthProviderConfiguration     `json:"twitter"`
+	Twitch         OAuthProviderConfiguration     `json:"twitch"`
+	WorkOS         OAuthProviderConfiguration     `json:"workos"`
+	Email          EmailProviderConfiguration     `json:"email"`
+	Phone          PhoneProviderConfiguration     `json:"phone"`
+	AnonymousUsers AnonymousProviderConfiguration `json:"anonymous_users" split_words:"true"`
+	Saml           SamlProviderConfiguration      `json:"saml"`
+	Zoom           OAuthProviderConfiguration     `json:"zoom"`
+	IosBundleId    string                         `json:"ios_bundle_id" split_words:"true"`
+	RedirectURL    string                         `json:"redirect_url"`
 }
 
 type SMTPConfiguration struct {
-	MaxFrequency time.Duration `json:"max_frequency" split_words:"true"`
-	Host         string        `json:"host"`
-	Port         int           `json:"port,omitempty" default:"587"`
-	User         string        `json:"user"`
-	Pass         string        `json:"pass,omitempty"`
-	AdminEmail   string        `json:"admin_email" split_words:"true"`
-	SenderName   string        `json:"sender_name" split_words:"true"`
+	MaxFrequency   time.Duration               `json:"max_frequency" split_words:"true"`
+	MaxFrequencies EmailFrequencyConfiguration `json:"max_frequencies" split_words:"true"`
+	Host           string                      `json:"host"`
+	Port           int                         `json:"port,omitempty" default:"587"`
+	User           string                      `json:"user"`
+	Pass           string                      `json:"pass,omitempty"`
+	AdminEmail     string                      `json:"admin_email" split_words:"true"`
+	SenderName     string                      `json:"sender_name" split_words:"true"`
+}
+
+// Kinds of emails whose frequency can be limited apart from MaxFrequency.
+const (
+	ConfirmationEmail     = "confirmation"
+	RecoveryEmail         = "recovery"
+	MagicLinkEmail        = "magic_link"
+	ReauthenticationEmail = "reauthentication"
+)
+
+// EmailFrequencyConfiguration holds how often each kind of email can be sent
+// to a user. Kinds left at zero are limited by MaxFrequency.
+type EmailFrequencyConfiguration struct {
+	Confirmation     time.Duration `json:"confirmation"`
+	Recovery         time.Duration `json:"recovery"`
+	MagicLink        time.Duration `json:"magic_link" split_words:"true"`
+	Reauthentication time.Duration `json:"reauthentication"`
+}
+
+// MaxFrequencyFor returns how often emails of kind can be sent to a user.
+func (c *SMTPConfiguration) MaxFrequencyFor(kind string) time.Duration {
+	var frequency time.Duration
+	switch kind {
+	case ConfirmationEmail:
+		frequency = c.MaxFrequencies.Confirmation
+	case RecoveryEmail:
+		frequency = c.MaxFrequencies.Recovery
+	case MagicLinkEmail:
+		frequency = c.MaxFrequencies.MagicLink
+	case ReauthenticationEmail:
+		frequency = c.MaxFrequencies.Reauthentication
+	}
+	if frequency == 0 {
+		return c.MaxFrequency
+	}
+	return frequency
 }
 
 type MailerConfiguration struct {
@@ -133,6 +384,8 @@ type MailerConfiguration struct {
 	SecureEmailChangeEnabled bool                      `json:"secure_email_change_enabled" split_words:"true" default:"true"`
 	OtpExp                   uint                      `json:"otp_exp" split_words:"true"`
 	OtpLength                int                       `json:"otp_length" split_words:"true"`
+	MagicLinkExp             uint                      `json:"magic_link_exp" split_words:"true"`
+	MagicLinkSingleUse       bool                      `json:"magic_link_single_use" split_words:"true" default:"true"`
 }
 
 type PhoneProviderConfiguration struct {
@@ -150,12 +403,72 @@ type SmsProviderConfiguration struct {
 	Messagebird  MessagebirdProviderConfiguration `json:"messagebird"`
 	Textlocal    TextlocalProviderConfiguration   `json:"textlocal"`
 	Vonage       VonageProviderConfiguration      `json:"vonage"`
+	// BlockedPrefixes are phone number prefixes, like country calling codes,
+	// no otp is sent to, besides DefaultBlockedPhonePrefixes.
+	BlockedPrefixes []string `json:"blocked_prefixes" split_words:"true"`
+	// AllowedPrefixes are prefixes otps are sent to even though they're
+	// blocked, when they're longer than the blocked prefix.
+	AllowedPrefixes []string `json:"allowed_prefixes" split_words:"true"`
+	// DailyLimit caps the SMS sent by the instance per day (UTC), any
+	// number when 0.
+	DailyLimit int `json:"daily_limit" split_words:"true"`
+	// WhatsappAudiences are the audiences whose users only sign up and sign
+	// in with their phone number, receiving their codes over WhatsApp.
+	WhatsappAudiences []string `json:"whatsapp_audiences" split_words:"true"`
+}
+
+// DefaultBlockedPhonePrefixes are the non-geographic satellite, international
+// network and premium-rate calling codes, which real users rarely have and
+// toll fraud often targets.
+var DefaultBlockedPhonePrefixes = []string{"870", "871", "872", "873", "874", "878", "881", "882", "883", "888", "979", "991"}
+
+// IsPhoneBlocked reports whether no otp may be sent to phone, an E.164
+// number without the +. The longest blocked or allowed prefix phone starts
+// with decides.
+func (s *SmsProviderConfiguration) IsPhoneBlocked(phone string) bool {
+	blocked := longestPrefix(phone, DefaultBlockedPhonePrefixes)
+	if n := longestPrefix(phone, s.BlockedPrefixes); n > blocked {
+		blocked = n
+	}
+	return blocked > longestPrefix(phone, s.AllowedPrefixes)
+}
+
+func longestPrefix(phone string, prefixes []string) int {
+	longest := 0
+	for _, prefix := range prefixes {
+		if len(prefix) > longest && strings.HasPrefix(phone, prefix) {
+			longest = len(prefix)
+		}
+	}
+	return longest
+}
+
+func validatePhonePrefixes(prefixes []string) error {
+	for _, prefix := range prefixes {
+		if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+			return fmt.Errorf("invalid phone prefix %q, expected digits without the +", prefix)
+		}
+	}
+	return nil
+}
+
+// IsWhatsappAudience reports whether aud is phone-only with WhatsApp delivery.
+func (s *SmsProviderConfiguration) IsWhatsappAudience(aud string) bool {
+	for _, whatsappAud := range s.WhatsappAudiences {
+		if whatsappAud == aud {
+			return true
+		}
+	}
+	return false
 }
 
 type TwilioProviderConfiguration struct {
 	AccountSid        string `json:"account_sid" split_words:"true"`
 	AuthToken         string `json:"auth_token" split_words:"true"`
 	MessageServiceSid string `json:"message_service_sid" split_words:"true"`
+	// WhatsappSender is the WhatsApp sender number, the message service
+	// sends WhatsApp messages when it's empty.
+	WhatsappSender string `json:"whatsapp_sender" split_words:"true"`
 }
 
 type MessagebirdProviderConfiguration struct {
@@ -178,34 +491,652 @@ type CaptchaConfiguration struct {
 	Enabled  bool   `json:"enabled" default:"false"`
 	Provider string `json:"provider" default:"hcaptcha"`
 	Secret   string `json:"provider_secret"`
+
+	// Endpoints are the endpoints requiring a captcha, all of them if empty.
+	Endpoints []string `json:"endpoints"`
+}
+
+// The endpoints a captcha can be required for. The token endpoint only
+// requires one for the password grant.
+const (
+	CaptchaEndpointSignup    = "signup"
+	CaptchaEndpointToken     = "token"
+	CaptchaEndpointRecover   = "recover"
+	CaptchaEndpointMagicLink = "magiclink"
+	CaptchaEndpointOtp       = "otp"
+	CaptchaEndpointVerify    = "verify"
+)
+
+var captchaEndpoints = []string{
+	CaptchaEndpointSignup,
+	CaptchaEndpointToken,
+	CaptchaEndpointRecover,
+	CaptchaEndpointMagicLink,
+	CaptchaEndpointOtp,
+	CaptchaEndpointVerify,
+}
+
+// Requires returns true if requests to the endpoint require a captcha.
+func (c *CaptchaConfiguration) Requires(endpoint string) bool {
+	if !c.Enabled {
+		return false
+	}
+	if len(c.Endpoints) == 0 {
+		return true
+	}
+	for _, e := range c.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the captcha endpoints exist.
+func (c *CaptchaConfiguration) Validate() error {
+	for _, endpoint := range c.Endpoints {
+		known := false
+		for _, e := range captchaEndpoints {
+			known = known || e == endpoint
+		}
+		if !known {
+			return fmt.Errorf("invalid captcha endpoint %q, expected one of %s", endpoint, strings.Join(captchaEndpoints, ", "))
+		}
+	}
+	return nil
+}
+
+// AdminApprovalsConfiguration controls whether destructive admin actions need a second admin's approval.
+type AdminApprovalsConfiguration struct {
+	Enabled bool          `json:"enabled"`
+	TTL     time.Duration `json:"ttl"`
+}
+
+// OAuthServerConfiguration holds the configuration for acting as an OAuth 2.0 / OIDC provider for third-party clients.
+type OAuthServerConfiguration struct {
+	Enabled                 bool                           `json:"enabled"`
+	ConsentURL              string                         `json:"consent_url" split_words:"true"`
+	CodeLifetime            time.Duration                  `json:"code_lifetime" split_words:"true"`
+	SigningKey              string                         `json:"signing_key" split_words:"true"`
+	RequireStrongClientAuth bool                           `json:"require_strong_client_auth" split_words:"true"`
+	ClientCertificateCA     string                         `json:"client_certificate_ca" split_words:"true"`
+	Registration            OAuthRegistrationConfiguration `json:"registration"`
+}
+
+// TokenExchangeConfiguration controls which services may exchange a user's
+// token for a narrowed, delegated token (RFC 8693).
+type TokenExchangeConfiguration struct {
+	Enabled          bool          `json:"enabled"`
+	ActorRoles       []string      `json:"actor_roles" split_words:"true"`
+	AllowedAudiences []string      `json:"allowed_audiences" split_words:"true"`
+	MaxLifetime      time.Duration `json:"max_lifetime" split_words:"true"`
+}
+
+// KerberosConfiguration lets domain-joined machines sign in with SPNEGO,
+// without typing a password.
+type KerberosConfiguration struct {
+	Enabled bool `json:"enabled"`
+	// Keytab is the path of the keytab with the keys of the service principal.
+	Keytab           string `json:"keytab"`
+	ServicePrincipal string `json:"service_principal" split_words:"true"`
+	// Realms are the realms users may sign in from, any when empty.
+	Realms []string `json:"realms"`
+	// EmailTemplate maps a principal to the email of its user, with the
+	// {username} and {realm} placeholders.
+	EmailTemplate string `json:"email_template" split_words:"true"`
+}
+
+// LDAPConfiguration verifies email logins with a bind to an LDAP directory,
+// like Active Directory, instead of with GoTrue's password hashes.
+type LDAPConfiguration struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	// StartTLS upgrades ldap:// connections to TLS, which ldaps:// URLs don't need.
+	StartTLS bool `json:"start_tls" split_words:"true"`
+	// TLSCACert is the PEM encoded CA certificate the directory's certificate
+	// is verified with, instead of the system's roots.
+	TLSCACert    string `json:"tls_ca_cert" envconfig:"TLS_CA_CERT"`
+	BindDN       string `json:"bind_dn" envconfig:"BIND_DN"`
+	BindPassword string `json:"bind_password" split_words:"true"`
+	BaseDN       string `json:"base_dn" envconfig:"BASE_DN"`
+	// UserFilter finds the entry of the user, with the {email} placeholder.
+	UserFilter string `json:"user_filter" split_words:"true"`
+	// IDAttribute identifies a user across renames, the DN when empty.
+	IDAttribute string `json:"id_attribute" envconfig:"ID_ATTRIBUTE"`
+	// Attributes maps user metadata fields to the attributes synced into them
+	// at every login.
+	Attributes map[string]string `json:"attributes"`
+	PoolSize   int               `json:"pool_size" split_words:"true"`
+	Timeout    time.Duration     `json:"timeout"`
+}
+
+// Validate checks that the directory is reached over TLS and that users can
+// be searched for.
+func (l *LDAPConfiguration) Validate() error {
+	u, err := url.Parse(l.URL)
+	if err != nil || (u.Scheme != "ldaps" && (u.Scheme != "ldap" || !l.StartTLS)) {
+		return fmt.Errorf("invalid LDAP URL %q, expected an ldaps:// URL or an ldap:// URL with StartTLS", l.URL)
+	}
+	if l.BaseDN == "" {
+		return errors.New("LDAP login requires a base DN")
+	}
+	if !strings.Contains(l.UserFilter, "{email}") {
+		return errors.New("LDAP user filter must contain {email}")
+	}
+	return nil
+}
+
+// ServiceAccountsConfiguration controls machine users authenticating with client credentials.
+type ServiceAccountsConfiguration struct {
+	Enabled      bool     `json:"enabled"`
+	AllowedRoles []string `json:"allowed_roles" split_words:"true"`
+}
+
+// Strategies for the user_metadata sent with a duplicate signup of an unconfirmed user.
+const (
+	DuplicateSignupMergeMetadata   = "merge"
+	DuplicateSignupReplaceMetadata = "replace"
+	DuplicateSignupKeepMetadata    = "keep"
+)
+
+// DuplicateSignupConfiguration controls how a signup for an existing but unconfirmed user is handled.
+type DuplicateSignupConfiguration struct {
+	Resend           bool   `json:"resend"`
+	MetadataStrategy string `json:"metadata_strategy" split_words:"true"`
+}
+
+// What happens to the user_metadata keys a signup sets that aren't allowed.
+const (
+	SignupMetadataStrip  = "strip"
+	SignupMetadataReject = "reject"
+)
+
+// SignupMetadataConfiguration restricts the user_metadata keys users may set
+// themselves, when signing up or updating their user.
+type SignupMetadataConfiguration struct {
+	Enabled     bool     `json:"enabled"`
+	AllowedKeys []string `json:"allowed_keys" split_words:"true"`
+	Action      string   `json:"action"`
+}
+
+// AppMetadataConfiguration delegates the updates of some app_metadata keys to
+// tokens of trusted roles, like a billing service setting a subscription
+// tier, without giving them admin rights.
+type AppMetadataConfiguration struct {
+	DelegatedRoles []string `json:"delegated_roles" split_words:"true"`
+	DelegatedKeys  []string `json:"delegated_keys" split_words:"true"`
+}
+
+// IsDelegatedRole returns true if tokens with the role may update the delegated keys.
+func (c *AppMetadataConfiguration) IsDelegatedRole(role string) bool {
+	for _, delegated := range c.DelegatedRoles {
+		if role == delegated {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDelegatedKey returns true if the app_metadata key may be updated by the delegated roles.
+func (c *AppMetadataConfiguration) IsDelegatedKey(key string) bool {
+	for _, delegated := range c.DelegatedKeys {
+		if key == delegated {
+			return true
+		}
+	}
+	return false
+}
+
+// What happens to users who never confirm once they expire.
+const (
+	UnconfirmedUsersFlag   = "flag"
+	UnconfirmedUsersDelete = "delete"
+)
+
+// UnconfirmedUsersConfiguration is the policy for users who never confirm their email or phone.
+type UnconfirmedUsersConfiguration struct {
+	ReminderDays int    `json:"reminder_days" split_words:"true"`
+	ExpiryDays   int    `json:"expiry_days" split_words:"true"`
+	ExpiryAction string `json:"expiry_action" split_words:"true"`
+}
+
+// DeepLinkConfiguration configures redirects into mobile apps. AppLinks are
+// https URL patterns opened by an app as Android App Links or iOS Universal
+// Links, which are permitted redirect destinations like URI_ALLOW_LIST.
+type DeepLinkConfiguration struct {
+	AppLinks     []string    `json:"app_links" split_words:"true"`
+	AppLinkGlobs []glob.Glob `json:"-" ignored:"true"`
+	Interstitial bool        `json:"interstitial"`
+	FallbackURL  string      `json:"fallback_url" split_words:"true"`
+}
+
+// unsafeURISchemes can run code or read local data when redirected to.
+var unsafeURISchemes = []string{"javascript", "vbscript", "data", "file", "blob", "about"}
+
+// Compile validates the fallback URL and compiles the app link patterns. App
+// links are only opened by the app for exactly the verified host, so only
+// paths can have wildcards.
+func (d *DeepLinkConfiguration) Compile() error {
+	d.AppLinkGlobs = nil
+	for _, pattern := range d.AppLinks {
+		pattern = strings.TrimSuffix(pattern, "/")
+		u, err := url.Parse(pattern)
+		if err != nil || u.Scheme != "https" || u.Host == "" || strings.ContainsAny(u.Host, "*?[]{}") {
+			return fmt.Errorf("invalid app link %q, expected an https URL with a fixed host", pattern)
+		}
+		g, err := glob.Compile(pattern, '.', '/')
+		if err != nil {
+			return fmt.Errorf("invalid app link %q: %w", pattern, err)
+		}
+		d.AppLinkGlobs = append(d.AppLinkGlobs, g)
+	}
+	if d.FallbackURL != "" {
+		if u, err := url.Parse(d.FallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid deep link fallback URL %q, expected an http(s) URL", d.FallbackURL)
+		}
+	}
+	return nil
+}
+
+// validateAllowListURI checks an URI_ALLOW_LIST entry. Entries with a custom
+// scheme are mobile app redirects: the scheme has to be fixed and safe to
+// redirect to, while the rest can have wildcards like http(s) entries.
+func validateAllowListURI(uri string) error {
+	i := strings.Index(uri, ":")
+	if i <= 0 {
+		return nil
+	}
+	scheme := strings.ToLower(uri[:i])
+	if scheme == "http" || scheme == "https" {
+		return nil
+	}
+	if strings.ContainsAny(scheme, "*?[]{}") {
+		return fmt.Errorf("invalid redirect URI %q, the scheme can't have wildcards", uri)
+	}
+	for _, unsafe := range unsafeURISchemes {
+		if scheme == unsafe {
+			return fmt.Errorf("invalid redirect URI %q, the %s scheme is not allowed", uri, scheme)
+		}
+	}
+	return nil
+}
+
+// ValidateRedirectURI checks an entry of the redirect allow list, which must
+// be a valid glob and can't allow an unsafe scheme.
+func ValidateRedirectURI(uri string) error {
+	if err := validateAllowListURI(uri); err != nil {
+		return err
+	}
+	if _, err := glob.Compile(uri, '.', '/'); err != nil {
+		return fmt.Errorf("invalid redirect URI %q: %v", uri, err)
+	}
+	return nil
+}
+
+// HostedPagesConfiguration configures the pages GoTrue serves for email links
+// redirecting to SITE_URL, for deployments without a frontend for them yet.
+type HostedPagesConfiguration struct {
+	Enabled      bool   `json:"enabled"`
+	ProductName  string `json:"product_name" split_words:"true"`
+	LogoURL      string `json:"logo_url" split_words:"true"`
+	PrimaryColor string `json:"primary_color" split_words:"true"`
+}
+
+var colorRegexp = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Validate checks the branding of the hosted pages.
+func (h *HostedPagesConfiguration) Validate() error {
+	if h.PrimaryColor != "" && !colorRegexp.MatchString(h.PrimaryColor) {
+		return fmt.Errorf("invalid hosted pages primary color %q, expected a hex color like #1a73e8", h.PrimaryColor)
+	}
+	if h.LogoURL != "" {
+		if u, err := url.Parse(h.LogoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid hosted pages logo URL %q, expected an http(s) URL", h.LogoURL)
+		}
+	}
+	return nil
+}
+
+// AuditConfiguration is what is recorded in the audit log besides changes.
+// AdminReads records admins viewing users, for compliance frameworks that
+// require logging who viewed personal data.
+type AuditConfiguration struct {
+	AdminReads bool `json:"admin_reads" split_words:"true"`
+}
+
+// RetentionConfiguration is for how many days records are kept, per kind of
+// record. Records are kept forever when 0.
+type RetentionConfiguration struct {
+	AuditLogDays      int `json:"audit_log_days" split_words:"true"`
+	SecurityEventDays int `json:"security_event_days" split_words:"true"`
+	SessionDays       int `json:"session_days" split_words:"true"`
+	EmailRecordDays   int `json:"email_record_days" split_words:"true"`
+}
+
+const (
+	ErasureAnonymize = "anonymize"
+	ErasureDelete    = "delete"
+)
+
+// ErasureConfiguration is how users erase their own account. Erasures are
+// carried out WaitingPeriod after they are requested, once WebhookURL was
+// notified.
+type ErasureConfiguration struct {
+	Enabled       bool          `json:"enabled"`
+	WaitingPeriod time.Duration `json:"waiting_period" split_words:"true"`
+	Action        string        `json:"action"`
+	WebhookURL    string        `json:"webhook_url" split_words:"true"`
+	WebhookSecret string        `json:"webhook_secret" split_words:"true"`
+}
+
+// OAuthRegistrationConfiguration holds the policy for OAuth clients registering themselves (RFC 7591).
+type OAuthRegistrationConfiguration struct {
+	Enabled               bool          `json:"enabled"`
+	AllowedRedirectHosts  []string      `json:"allowed_redirect_hosts" split_words:"true"`
+	AllowedScopes         []string      `json:"allowed_scopes" split_words:"true"`
+	AllowPublicClients    bool          `json:"allow_public_clients" split_words:"true"`
+	InitialAccessTokenTTL time.Duration `json:"initial_access_token_ttl" envconfig:"INITIAL_ACCESS_TOKEN_TTL"`
+}
+
+// DPoPConfiguration controls binding tokens to a client key with DPoP proofs (RFC 9449).
+type DPoPConfiguration struct {
+	Enabled       bool          `json:"enabled"`
+	Required      bool          `json:"required"`
+	ProofLifetime time.Duration `json:"proof_lifetime" split_words:"true"`
+}
+
+// ClientBindingConfiguration controls binding refresh tokens to the device id and user agent of the client they were issued to.
+type ClientBindingConfiguration struct {
+	Enabled    bool `json:"enabled"`
+	ReportOnly bool `json:"report_only" split_words:"true"`
+}
+
+// OAuthStrictConfiguration hardens the OAuth flows to follow the OAuth 2.0 Security Best Current Practice.
+type OAuthStrictConfiguration struct {
+	Enabled      bool          `json:"enabled"`
+	CodeLifetime time.Duration `json:"code_lifetime" split_words:"true"`
+}
+
+// RiskConfiguration holds the configuration for scoring requests before signups and sign-ins.
+type RiskConfiguration struct {
+	Enabled                bool          `json:"enabled"`
+	URL                    string        `json:"url"`
+	Secret                 string        `json:"secret"`
+	TimeoutSec             int           `json:"timeout_sec" split_words:"true"`
+	CaptchaThreshold       int           `json:"captcha_threshold" split_words:"true"`
+	MFAThreshold           int           `json:"mfa_threshold" envconfig:"MFA_THRESHOLD"`
+	BlockThreshold         int           `json:"block_threshold" split_words:"true"`
+	DisposableEmailDomains []string      `json:"disposable_email_domains" split_words:"true"`
+	ASNHeader              string        `json:"asn_header" envconfig:"ASN_HEADER"`
+	BlockedASNs            []string      `json:"blocked_asns" envconfig:"BLOCKED_ASNS"`
+	VelocityLimit          int           `json:"velocity_limit" split_words:"true"`
+	VelocityWindow         time.Duration `json:"velocity_window" split_words:"true"`
+}
+
+// AlertsConfiguration holds the destinations and thresholds for suspicious activity notifications.
+type AlertsConfiguration struct {
+	Email                      string        `json:"email"`
+	WebhookURL                 string        `json:"webhook_url" split_words:"true"`
+	WebhookSecret              string        `json:"webhook_secret" split_words:"true"`
+	SlackURL                   string        `json:"slack_url" split_words:"true"`
+	Window                     time.Duration `json:"window"`
+	FailedLoginThreshold       int           `json:"failed_login_threshold" split_words:"true"`
+	SignupThreshold            int           `json:"signup_threshold" split_words:"true"`
+	RefreshTokenReuseThreshold int           `json:"refresh_token_reuse_threshold" split_words:"true"`
+}
+
+// SignInAnomaliesConfiguration controls the anomaly signals computed for every sign-in.
+type SignInAnomaliesConfiguration struct {
+	Enabled       bool          `json:"enabled"`
+	CountryHeader string        `json:"country_header" split_words:"true"`
+	TravelWindow  time.Duration `json:"travel_window" split_words:"true"`
+	BurstLimit    int           `json:"burst_limit" split_words:"true"`
+	BurstWindow   time.Duration `json:"burst_window" split_words:"true"`
+	WebhookURL    string        `json:"webhook_url" split_words:"true"`
+	WebhookSecret string        `json:"webhook_secret" split_words:"true"`
+}
+
+// AutoBansConfiguration bans users for escalating durations once they
+// violated policies, such as failing captchas, brute forcing codes or being
+// blocked by the risk assessment, Violations times within Window.
+type AutoBansConfiguration struct {
+	Enabled    bool            `json:"enabled"`
+	Violations int             `json:"violations"`
+	Window     time.Duration   `json:"window"`
+	Durations  []time.Duration `json:"durations"`
+}
+
+// Duration returns how long a user who was banned automatically bans times
+// before is banned for. Bans beyond the configured durations get the last one.
+func (a *AutoBansConfiguration) Duration(bans int) time.Duration {
+	if bans >= len(a.Durations) {
+		bans = len(a.Durations) - 1
+	}
+	return a.Durations[bans]
+}
+
+// LeakedPasswordsConfiguration rejects passwords that appeared in a data
+// breach according to the Have I Been Pwned range API at URL.
+type LeakedPasswordsConfiguration struct {
+	Enabled bool          `json:"enabled"`
+	URL     string        `json:"url"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// LockoutConfiguration locks accounts for Duration after MaxAttempts failed
+// password sign-ins within Window, and refuses sign-ins from IP addresses
+// with IPMaxAttempts failed sign-ins within Window.
+type LockoutConfiguration struct {
+	Enabled       bool          `json:"enabled"`
+	MaxAttempts   int           `json:"max_attempts" split_words:"true"`
+	IPMaxAttempts int           `json:"ip_max_attempts" split_words:"true"`
+	Window        time.Duration `json:"window"`
+	Duration      time.Duration `json:"duration"`
+	NotifyEmail   bool          `json:"notify_email" split_words:"true"`
+}
+
+// LifecycleEventsConfiguration holds the sink user lifecycle events are sent
+// to. Only the listed Events are sent, or all of them if none are listed.
+// Failed deliveries are retried MaxAttempts times in all, waiting Backoff
+// before the first retry and twice as long before each further one, up to
+// MaxBackoff.
+type LifecycleEventsConfiguration struct {
+	WebhookURL    string        `json:"webhook_url" split_words:"true"`
+	WebhookSecret string        `json:"webhook_secret" split_words:"true"`
+	Events        []string      `json:"events"`
+	MaxAttempts   int           `json:"max_attempts" split_words:"true"`
+	Backoff       time.Duration `json:"backoff"`
+	MaxBackoff    time.Duration `json:"max_backoff" split_words:"true"`
+}
+
+// HasEvent tells if event is sent to the sink.
+func (c *LifecycleEventsConfiguration) HasEvent(event string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, name := range c.Events {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTokenHookConfiguration holds the hook called before an access token
+// is signed, which may add or override its claims. The hook is either an HTTP
+// endpoint at URL, whose requests are signed with Secret, or a Postgres
+// Function taking and returning jsonb. HTTP hooks time out after TimeoutSec
+// seconds. Tokens are refused if the hook fails, unless FailOpen is set, in
+// which case they're issued without its claims.
+type AccessTokenHookConfiguration struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	Function   string `json:"function"`
+	TimeoutSec int    `json:"timeout_sec" split_words:"true"`
+	FailOpen   bool   `json:"fail_open" split_words:"true"`
+}
+
+var sqlFunctionRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Enabled tells if an access token hook is configured.
+func (c *AccessTokenHookConfiguration) Enabled() bool {
+	return c.URL != "" || c.Function != ""
+}
+
+// Validate checks that a single hook is configured and that the function
+// name is safe to put in a query.
+func (c *AccessTokenHookConfiguration) Validate() error {
+	if c.URL != "" && c.Function != "" {
+		return errors.New("Access token hook can either be a URL or a function, not both")
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid access token hook URL %q, expected an http(s) URL", c.URL)
+		}
+	}
+	if c.Function != "" && !sqlFunctionRegexp.MatchString(c.Function) {
+		return fmt.Errorf("invalid access token hook function %q, expected a name like schema.function", c.Function)
+	}
+	if c.TimeoutSec < 0 {
+		return errors.New("Access token hook timeout must be 0 or a positive number of seconds")
+	}
+	return nil
+}
+
+// PasswordVerificationHookConfiguration holds the legacy auth system that
+// verifies the passwords of users without a password in GoTrue yet, such as
+// users imported without their password hashes. Requests are signed with
+// Secret and time out after TimeoutSec seconds.
+type PasswordVerificationHookConfiguration struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	TimeoutSec int    `json:"timeout_sec" split_words:"true"`
+}
+
+// Validate checks the URL of the hook.
+func (c *PasswordVerificationHookConfiguration) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid password verification hook URL %q, expected an http(s) URL", c.URL)
+	}
+	if c.TimeoutSec < 0 {
+		return errors.New("Password verification hook timeout must be 0 or a positive number of seconds")
+	}
+	return nil
+}
+
+// TokenEventsConfiguration holds the optional sink token issuance events are sent to.
+type TokenEventsConfiguration struct {
+	WebhookURL    string `json:"webhook_url" split_words:"true"`
+	WebhookSecret string `json:"webhook_secret" split_words:"true"`
 }
 
 type SecurityConfiguration struct {
-	Captcha                               CaptchaConfiguration `json:"captcha"`
-	RefreshTokenRotationEnabled           bool                 `json:"refresh_token_rotation_enabled" split_words:"true" default:"true"`
-	RefreshTokenReuseInterval             int                  `json:"refresh_token_reuse_interval" split_words:"true"`
-	UpdatePasswordRequireReauthentication bool                 `json:"update_password_require_reauthentication" split_words:"true"`
+	Captcha                               CaptchaConfiguration         `json:"captcha"`
+	RefreshTokenRotationEnabled           bool                         `json:"refresh_token_rotation_enabled" split_words:"true" default:"true"`
+	RefreshTokenReuseInterval             int                          `json:"refresh_token_reuse_interval" split_words:"true"`
+	UpdatePasswordRequireReauthentication bool                         `json:"update_password_require_reauthentication" split_words:"true"`
+	UpgradePasswordHashes                 bool                         `json:"upgrade_password_hashes" split_words:"true"`
+	AdminApprovals                        AdminApprovalsConfiguration  `json:"admin_approvals" split_words:"true"`
+	OAuthStrict                           OAuthStrictConfiguration     `json:"oauth_strict" envconfig:"OAUTH_STRICT"`
+	Risk                                  RiskConfiguration            `json:"risk"`
+	Alerts                                AlertsConfiguration          `json:"alerts"`
+	TokenEvents                           TokenEventsConfiguration     `json:"token_events" split_words:"true"`
+	DPoP                                  DPoPConfiguration            `json:"dpop" envconfig:"DPOP"`
+	ClientBinding                         ClientBindingConfiguration   `json:"client_binding" split_words:"true"`
+	SignInAnomalies                       SignInAnomaliesConfiguration `json:"sign_in_anomalies" split_words:"true"`
+	AutoBans                              AutoBansConfiguration        `json:"auto_bans" split_words:"true"`
+	LeakedPasswords                       LeakedPasswordsConfiguration `json:"leaked_passwords" split_words:"true"`
+	Lockout                               LockoutConfiguration         `json:"lockout"`
+	OtpMaxAttempts                        int                          `json:"otp_max_attempts" split_words:"true"`
+	AuthFailureMinDuration                time.Duration                `json:"auth_failure_min_duration" split_words:"true"`
+	Headers                               SecurityHeadersConfiguration `json:"headers"`
+}
+
+// SecurityHeadersConfiguration adds security headers, such as HSTS, to responses.
+type SecurityHeadersConfiguration struct {
+	Enabled        bool          `json:"enabled"`
+	HSTSMaxAge     time.Duration `json:"hsts_max_age" envconfig:"HSTS_MAX_AGE"`
+	ReferrerPolicy string        `json:"referrer_policy" split_words:"true"`
+
+	// ContentSecurityPolicy replaces the default policy of the HTML pages.
+	ContentSecurityPolicy string `json:"content_security_policy" split_words:"true"`
+}
+
+// PasswordPolicyConfiguration holds the requirements passwords have to meet
+// besides PasswordMinLength: the character classes they contain, a minimum
+// strength score from 0 to 4 and passwords that are not allowed.
+type PasswordPolicyConfiguration struct {
+	RequiredCharacters []string `json:"required_characters" split_words:"true"`
+	MinScore           int      `json:"min_score" split_words:"true"`
+	Denylist           []string `json:"denylist"`
+}
+
+// Validate checks the required character classes and the score.
+func (p *PasswordPolicyConfiguration) Validate() error {
+	for _, class := range p.RequiredCharacters {
+		if !security.IsPasswordClass(class) {
+			return fmt.Errorf("Unknown password character class %s", class)
+		}
+	}
+	if p.MinScore < 0 || p.MinScore > 4 {
+		return errors.New("Password minimum score must be between 0 and 4")
+	}
+	return nil
 }
 
 // Configuration holds all the per-instance configuration.
 type Configuration struct {
-	SiteURL           string   `json:"site_url" split_words:"true" required:"true"`
-	URIAllowList      []string `json:"uri_allow_list" split_words:"true"`
-	URIAllowListMap   map[string]glob.Glob
-	PasswordMinLength int                      `json:"password_min_length" split_words:"true"`
-	JWT               JWTConfiguration         `json:"jwt"`
-	SMTP              SMTPConfiguration        `json:"smtp"`
-	Mailer            MailerConfiguration      `json:"mailer"`
-	External          ProviderConfiguration    `json:"external"`
-	Sms               SmsProviderConfiguration `json:"sms"`
-	DisableSignup     bool                     `json:"disable_signup" split_words:"true"`
-	Webhook           WebhookConfig            `json:"webhook" split_words:"true"`
-	Security          SecurityConfiguration    `json:"security"`
+	SiteURL           string                        `json:"site_url" split_words:"true" required:"true"`
+	URIAllowList      []string                      `json:"uri_allow_list" split_words:"true"`
+	URIAllowListMap   map[string]glob.Glob          `ignored:"true"`
+	URIAllowLocalhost bool                          `json:"uri_allow_localhost" split_words:"true"`
+	PasswordMinLength int                           `json:"password_min_length" split_words:"true"`
+	PasswordPolicy    PasswordPolicyConfiguration   `json:"password_policy" split_words:"true"`
+	JWT               JWTConfiguration              `json:"jwt"`
+	SMTP              SMTPConfiguration             `json:"smtp"`
+	Mailer            MailerConfiguration           `json:"mailer"`
+	External          ProviderConfiguration         `json:"external"`
+	Sms               SmsProviderConfiguration      `json:"sms"`
+	DisableSignup     bool                          `json:"disable_signup" split_words:"true"`
+	Webhook           WebhookConfig                 `json:"webhook" split_words:"true"`
+	LifecycleEvents   LifecycleEventsConfiguration  `json:"lifecycle_events" split_words:"true"`
+	AccessTokenHook   AccessTokenHookConfiguration  `json:"access_token_hook" split_words:"true"`
+	Security          SecurityConfiguration         `json:"security"`
+	OAuthServer       OAuthServerConfiguration      `json:"oauth_server" envconfig:"OAUTH_SERVER"`
+	TokenExchange     TokenExchangeConfiguration    `json:"token_exchange" split_words:"true"`
+	TrustedIssuers    TrustedIssuers                `json:"trusted_issuers" split_words:"true"`
+	ServiceAccounts   ServiceAccountsConfiguration  `json:"service_accounts" split_words:"true"`
+	Kerberos          KerberosConfiguration         `json:"kerberos"`
+	LDAP              LDAPConfiguration             `json:"ldap"`
+	DuplicateSignup   DuplicateSignupConfiguration  `json:"duplicate_signup" split_words:"true"`
+	SignupMetadata    SignupMetadataConfiguration   `json:"signup_metadata" split_words:"true"`
+	Profile           ProfileConfiguration          `json:"profile"`
+	AppMetadata       AppMetadataConfiguration      `json:"app_metadata" split_words:"true"`
+	UnconfirmedUsers  UnconfirmedUsersConfiguration `json:"unconfirmed_users" split_words:"true"`
 	Cookie            struct {
 		Key      string `json:"key"`
 		Domain   string `json:"domain"`
 		Duration int    `json:"duration"`
 	} `json:"cookies"`
+	RedirectPassthroughParams []string                 `json:"redirect_passthrough_params" split_words:"true"`
+	DeepLinks                 DeepLinkConfiguration    `json:"deep_links" split_words:"true"`
+	HostedPages               HostedPagesConfiguration `json:"hosted_pages" split_words:"true"`
+	Retention                 RetentionConfiguration   `json:"retention"`
+	Erasure                   ErasureConfiguration     `json:"erasure"`
+	Audit                     AuditConfiguration       `json:"audit"`
+
+	PasswordVerificationHook PasswordVerificationHookConfiguration `json:"password_verification_hook" split_words:"true"`
+
+	// LoadTest replaces the mail client and SMS provider with ones that send
+	// nothing, so load tests don't reach real inboxes and phones.
+	LoadTest bool `json:"load_test" split_words:"true"`
+
+	// Sandbox keeps emails and SMS in memory instead of sending them, so
+	// end-to-end tests can read them with the admin API.
+	Sandbox bool `json:"sandbox"`
 }
 
 func loadEnvironment(filename string) error {
@@ -254,7 +1185,41 @@ func LoadGlobal(filename string) (*GlobalConfiguration, error) {
 		return nil, err
 	}
 
-	ConfigureTracing(&config.Tracing)
+	if err := ConfigureTracing(&config.Tracing); err != nil {
+		return nil, err
+	}
+
+	if err := ConfigureProxy(&config.Proxy); err != nil {
+		return nil, err
+	}
+
+	if config.CircuitBreaker.FailureThreshold <= 0 || config.CircuitBreaker.HalfOpenProbes <= 0 {
+		return nil, errors.New("Circuit breaker failure threshold and half open probes must be positive numbers")
+	}
+	breaker.Configure(breaker.Settings{
+		Enabled:          config.CircuitBreaker.Enabled,
+		FailureThreshold: config.CircuitBreaker.FailureThreshold,
+		OpenDuration:     config.CircuitBreaker.OpenDuration,
+		HalfOpenProbes:   config.CircuitBreaker.HalfOpenProbes,
+	})
+
+	if config.JWKSCacheTTL <= 0 {
+		return nil, errors.New("JWKS cache TTL must be a positive duration")
+	}
+
+	if err := config.Blocklist.Compile(); err != nil {
+		return nil, err
+	}
+
+	if err := validateEnv(config.Env); err != nil {
+		return nil, err
+	}
+
+	switch config.DB.SchemaCheck {
+	case SchemaCheckFail, SchemaCheckWarn, SchemaCheckOff:
+	default:
+		return nil, fmt.Errorf("invalid DB schema check %q, expected fail, warn or off", config.DB.SchemaCheck)
+	}
 
 	if config.SMTP.MaxFrequency == 0 {
 		config.SMTP.MaxFrequency = 1 * time.Minute
@@ -269,6 +1234,12 @@ func LoadConfig(filename string) (*Configuration, error) {
 	}
 
 	config := new(Configuration)
+	// the profile only sets defaults, the environment overrides them
+	env := os.Getenv("GOTRUE_ENV")
+	if err := validateEnv(env); err != nil {
+		return nil, err
+	}
+	config.applyEnvDefaults(env)
 	if err := envconfig.Process("gotrue", config); err != nil {
 		return nil, err
 	}
@@ -292,6 +1263,40 @@ func (config *Configuration) ApplyDefaults() error {
 	if config.JWT.Exp == 0 {
 		config.JWT.Exp = 3600
 	}
+	for _, overrides := range []map[string]int{config.JWT.ExpByAud, config.JWT.ExpByRole} {
+		for name, exp := range overrides {
+			if exp <= 0 {
+				return fmt.Errorf("invalid JWT expiry of %q, expected a positive number of seconds", name)
+			}
+		}
+	}
+
+	switch config.JWT.Algorithm {
+	case "":
+		config.JWT.Algorithm = JWTAlgorithmHS256
+	case JWTAlgorithmHS256:
+	case JWTAlgorithmRS256, JWTAlgorithmES256, JWTAlgorithmEdDSA:
+		if _, err := config.JWT.ParsePrivateKey(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid JWT algorithm %q, expected HS256, RS256, ES256 or EdDSA", config.JWT.Algorithm)
+	}
+	if err := config.JWT.Keys.Validate(); err != nil {
+		return err
+	}
+	if config.JWT.RotationGrace == 0 {
+		// until the tokens signed with the previous key expire
+		config.JWT.RotationGrace = time.Duration(config.JWT.MaxExp()) * time.Second
+	}
+
+	switch config.JWT.MaxSizeAction {
+	case "":
+		config.JWT.MaxSizeAction = JWTMaxSizeWarn
+	case JWTMaxSizeWarn, JWTMaxSizeFail:
+	default:
+		return fmt.Errorf("invalid JWT max size action %q, expected warn or fail", config.JWT.MaxSizeAction)
+	}
 
 	if config.Mailer.URLPaths.Invite == "" {
 		config.Mailer.URLPaths.Invite = "/"
@@ -313,6 +1318,10 @@ func (config *Configuration) ApplyDefaults() error {
 		config.Mailer.OtpExp = 86400 // 1 day
 	}
 
+	if config.Mailer.MagicLinkExp == 0 {
+		config.Mailer.MagicLinkExp = config.Mailer.OtpExp
+	}
+
 	if config.Mailer.OtpLength == 0 || config.Mailer.OtpLength < 6 || config.Mailer.OtpLength > 10 {
 		// 6-digit otp by default
 		config.Mailer.OtpLength = 6
@@ -321,6 +1330,11 @@ func (config *Configuration) ApplyDefaults() error {
 	if config.SMTP.MaxFrequency == 0 {
 		config.SMTP.MaxFrequency = 1 * time.Minute
 	}
+	for _, frequency := range []time.Duration{config.SMTP.MaxFrequencies.Confirmation, config.SMTP.MaxFrequencies.Recovery, config.SMTP.MaxFrequencies.MagicLink, config.SMTP.MaxFrequencies.Reauthentication} {
+		if frequency < 0 {
+			return errors.New("SMTP max frequencies must be 0 or a positive duration")
+		}
+	}
 
 	if config.Sms.MaxFrequency == 0 {
 		config.Sms.MaxFrequency = 1 * time.Minute
@@ -363,13 +1377,296 @@ func (config *Configuration) ApplyDefaults() error {
 
 		config.URIAllowListMap = make(map[string]glob.Glob)
 		for _, uri := range config.URIAllowList {
+			if err := ValidateRedirectURI(uri); err != nil {
+				return err
+			}
 			g := glob.MustCompile(uri, '.', '/')
 			config.URIAllowListMap[uri] = g
 		}
 	}
+	if err := config.DeepLinks.Compile(); err != nil {
+		return err
+	}
+	if config.HostedPages.PrimaryColor == "" {
+		config.HostedPages.PrimaryColor = "#1a73e8"
+	}
+	if err := config.HostedPages.Validate(); err != nil {
+		return err
+	}
+	if config.Security.AdminApprovals.TTL == 0 {
+		config.Security.AdminApprovals.TTL = 1 * time.Hour
+	}
+
+	if config.OAuthServer.CodeLifetime == 0 {
+		config.OAuthServer.CodeLifetime = 10 * time.Minute
+	}
+
+	if config.OAuthServer.Enabled {
+		if _, err := config.OAuthServer.ParseSigningKey(); err != nil {
+			return err
+		}
+		if _, err := config.OAuthServer.ClientCertificatePool(); err != nil {
+			return err
+		}
+	}
+
+	if config.OAuthServer.Registration.InitialAccessTokenTTL == 0 {
+		config.OAuthServer.Registration.InitialAccessTokenTTL = 24 * time.Hour
+	}
+
+	if len(config.TokenExchange.ActorRoles) == 0 {
+		config.TokenExchange.ActorRoles = []string{"service_role"}
+	}
+
+	if config.TokenExchange.MaxLifetime == 0 {
+		config.TokenExchange.MaxLifetime = 5 * time.Minute
+	}
+
+	if err := config.TrustedIssuers.Validate(); err != nil {
+		return err
+	}
+
+	for i, prefix := range config.Sms.BlockedPrefixes {
+		config.Sms.BlockedPrefixes[i] = strings.TrimPrefix(strings.TrimSpace(prefix), "+")
+	}
+	for i, prefix := range config.Sms.AllowedPrefixes {
+		config.Sms.AllowedPrefixes[i] = strings.TrimPrefix(strings.TrimSpace(prefix), "+")
+	}
+	if err := validatePhonePrefixes(config.Sms.BlockedPrefixes); err != nil {
+		return err
+	}
+	if err := validatePhonePrefixes(config.Sms.AllowedPrefixes); err != nil {
+		return err
+	}
+	if config.Sms.DailyLimit < 0 {
+		return errors.New("SMS daily limit must be 0 or a positive number")
+	}
+	if len(config.Sms.WhatsappAudiences) > 0 && config.Sms.Provider != "twilio" {
+		return fmt.Errorf("WhatsApp audiences require the twilio SMS provider, not %q", config.Sms.Provider)
+	}
+
+	if config.Kerberos.EmailTemplate == "" {
+		config.Kerberos.EmailTemplate = "{username}@{realm}"
+	}
+	if config.Kerberos.Enabled && config.Kerberos.Keytab == "" {
+		return errors.New("Kerberos sign-in requires a keytab")
+	}
+	if !strings.Contains(config.Kerberos.EmailTemplate, "{username}") {
+		return errors.New("Kerberos email template must contain {username}")
+	}
+
+	if config.LDAP.UserFilter == "" {
+		config.LDAP.UserFilter = "(mail={email})"
+	}
+	if config.LDAP.PoolSize <= 0 {
+		config.LDAP.PoolSize = 5
+	}
+	if config.LDAP.Timeout == 0 {
+		config.LDAP.Timeout = 5 * time.Second
+	}
+	if config.LDAP.Enabled {
+		if err := config.LDAP.Validate(); err != nil {
+			return err
+		}
+	}
+
+	switch config.DuplicateSignup.MetadataStrategy {
+	case "":
+		config.DuplicateSignup.MetadataStrategy = DuplicateSignupMergeMetadata
+	case DuplicateSignupMergeMetadata, DuplicateSignupReplaceMetadata, DuplicateSignupKeepMetadata:
+	default:
+		return fmt.Errorf("invalid duplicate signup metadata strategy %q, expected merge, replace or keep", config.DuplicateSignup.MetadataStrategy)
+	}
+
+	switch config.SignupMetadata.Action {
+	case "":
+		config.SignupMetadata.Action = SignupMetadataStrip
+	case SignupMetadataStrip, SignupMetadataReject:
+	default:
+		return fmt.Errorf("invalid signup metadata action %q, expected strip or reject", config.SignupMetadata.Action)
+	}
+
+	if err := config.Profile.Validate(&config.SignupMetadata); err != nil {
+		return err
+	}
+
+	if len(config.AppMetadata.DelegatedRoles) > 0 && len(config.AppMetadata.DelegatedKeys) == 0 {
+		return errors.New("app_metadata delegated roles require delegated keys")
+	}
+	for _, key := range config.AppMetadata.DelegatedKeys {
+		if key == "provider" || key == "providers" {
+			return fmt.Errorf("app_metadata key %q is managed by GoTrue and cannot be delegated", key)
+		}
+	}
+
+	switch config.UnconfirmedUsers.ExpiryAction {
+	case "":
+		config.UnconfirmedUsers.ExpiryAction = UnconfirmedUsersFlag
+	case UnconfirmedUsersFlag, UnconfirmedUsersDelete:
+	default:
+		return fmt.Errorf("invalid unconfirmed users expiry action %q, expected flag or delete", config.UnconfirmedUsers.ExpiryAction)
+	}
+	if reminder, expiry := config.UnconfirmedUsers.ReminderDays, config.UnconfirmedUsers.ExpiryDays; reminder > 0 && expiry > 0 && reminder >= expiry {
+		return errors.New("Unconfirmed users must be reminded before they expire")
+	}
+
+	if config.Retention.EmailRecordDays == 0 {
+		config.Retention.EmailRecordDays = config.Retention.AuditLogDays
+	}
+	for _, days := range []int{config.Retention.AuditLogDays, config.Retention.SecurityEventDays, config.Retention.SessionDays, config.Retention.EmailRecordDays} {
+		if days < 0 {
+			return errors.New("Retention days must be 0 or a positive number")
+		}
+	}
+
+	if config.LifecycleEvents.MaxAttempts <= 0 {
+		config.LifecycleEvents.MaxAttempts = 5
+	}
+	if config.LifecycleEvents.Backoff == 0 {
+		config.LifecycleEvents.Backoff = time.Second
+	}
+	if config.LifecycleEvents.MaxBackoff == 0 {
+		config.LifecycleEvents.MaxBackoff = 5 * time.Minute
+	}
+
+	if config.AccessTokenHook.TimeoutSec == 0 {
+		config.AccessTokenHook.TimeoutSec = 2
+	}
+	if err := config.AccessTokenHook.Validate(); err != nil {
+		return err
+	}
+	if config.PasswordVerificationHook.TimeoutSec == 0 {
+		config.PasswordVerificationHook.TimeoutSec = 2
+	}
+	if err := config.PasswordVerificationHook.Validate(); err != nil {
+		return err
+	}
+
+	if config.Security.OtpMaxAttempts <= 0 {
+		config.Security.OtpMaxAttempts = 5
+	}
+	if config.Security.Headers.HSTSMaxAge == 0 {
+		config.Security.Headers.HSTSMaxAge = 365 * 24 * time.Hour
+	}
+	if config.Security.Headers.ReferrerPolicy == "" {
+		config.Security.Headers.ReferrerPolicy = "no-referrer"
+	}
+	if config.Security.AuthFailureMinDuration < 0 {
+		return errors.New("Auth failure min duration must be 0 or a positive duration")
+	}
+
+	if config.Erasure.WaitingPeriod == 0 {
+		config.Erasure.WaitingPeriod = 7 * 24 * time.Hour
+	}
+	switch config.Erasure.Action {
+	case "":
+		config.Erasure.Action = ErasureAnonymize
+	case ErasureAnonymize, ErasureDelete:
+	default:
+		return fmt.Errorf("invalid erasure action %q, expected anonymize or delete", config.Erasure.Action)
+	}
+
+	if config.Security.SignInAnomalies.TravelWindow == 0 {
+		config.Security.SignInAnomalies.TravelWindow = 2 * time.Hour
+	}
+	if config.Security.SignInAnomalies.BurstLimit == 0 {
+		config.Security.SignInAnomalies.BurstLimit = 5
+	}
+	if config.Security.SignInAnomalies.BurstWindow == 0 {
+		config.Security.SignInAnomalies.BurstWindow = 10 * time.Minute
+	}
+
+	if err := config.Security.Captcha.Validate(); err != nil {
+		return err
+	}
+
+	if config.Security.AutoBans.Violations == 0 {
+		config.Security.AutoBans.Violations = 5
+	}
+	if config.Security.AutoBans.Window == 0 {
+		config.Security.AutoBans.Window = 1 * time.Hour
+	}
+	if len(config.Security.AutoBans.Durations) == 0 {
+		config.Security.AutoBans.Durations = []time.Duration{15 * time.Minute, 1 * time.Hour, 24 * time.Hour}
+	}
+	for _, d := range config.Security.AutoBans.Durations {
+		if d <= 0 {
+			return errors.New("Automatic ban durations must be positive")
+		}
+	}
+
+	if config.Security.Lockout.MaxAttempts == 0 {
+		config.Security.Lockout.MaxAttempts = 5
+	}
+	if config.Security.Lockout.IPMaxAttempts == 0 {
+		config.Security.Lockout.IPMaxAttempts = 50
+	}
+	if config.Security.Lockout.Window == 0 {
+		config.Security.Lockout.Window = 15 * time.Minute
+	}
+	if config.Security.Lockout.Duration == 0 {
+		config.Security.Lockout.Duration = 15 * time.Minute
+	}
+
+	if config.Security.LeakedPasswords.URL == "" {
+		config.Security.LeakedPasswords.URL = "https://api.pwnedpasswords.com"
+	}
+	if config.Security.LeakedPasswords.Timeout == 0 {
+		config.Security.LeakedPasswords.Timeout = 2 * time.Second
+	}
+
+	if config.Security.DPoP.ProofLifetime == 0 {
+		config.Security.DPoP.ProofLifetime = 1 * time.Minute
+	}
+
+	if config.Security.OAuthStrict.CodeLifetime == 0 {
+		config.Security.OAuthStrict.CodeLifetime = 1 * time.Minute
+	}
+
+	if config.Security.Risk.CaptchaThreshold == 0 {
+		config.Security.Risk.CaptchaThreshold = 50
+	}
+
+	if config.Security.Risk.MFAThreshold == 0 {
+		config.Security.Risk.MFAThreshold = 70
+	}
+
+	if config.Security.Risk.BlockThreshold == 0 {
+		config.Security.Risk.BlockThreshold = 90
+	}
+
+	if config.Security.Risk.VelocityWindow == 0 {
+		config.Security.Risk.VelocityWindow = 1 * time.Minute
+	}
+
+	if config.Security.Alerts.Window == 0 {
+		config.Security.Alerts.Window = 10 * time.Minute
+	}
+
+	if config.Security.Alerts.FailedLoginThreshold == 0 {
+		config.Security.Alerts.FailedLoginThreshold = 50
+	}
+
+	if config.Security.Alerts.SignupThreshold == 0 {
+		config.Security.Alerts.SignupThreshold = 20
+	}
+
+	if config.Security.Alerts.RefreshTokenReuseThreshold == 0 {
+		config.Security.Alerts.RefreshTokenReuseThreshold = 1
+	}
+
 	if config.PasswordMinLength < defaultMinPasswordLength {
 		config.PasswordMinLength = defaultMinPasswordLength
 	}
+	if err := config.PasswordPolicy.Validate(); err != nil {
+		return err
+	}
+
+	if config.Security.Risk.Enabled {
+		if err := config.Security.Risk.Validate(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -415,6 +1712,62 @@ func (o *OAuthProviderConfiguration) Validate() error {
 	return nil
 }
 
+// Validate checks that the risk thresholds are scores between 0 and 100 which
+// get stricter with the decision, and that a risk hook can be authenticated.
+func (r *RiskConfiguration) Validate() error {
+	for _, threshold := range []int{r.CaptchaThreshold, r.MFAThreshold, r.BlockThreshold} {
+		if threshold < 0 || threshold > 100 {
+			return errors.New("Risk thresholds must be between 0 and 100")
+		}
+	}
+	if r.CaptchaThreshold > r.MFAThreshold || r.MFAThreshold > r.BlockThreshold {
+		return errors.New("Risk thresholds must increase from captcha to MFA to block")
+	}
+	if r.URL != "" && r.Secret == "" {
+		return errors.New("Missing risk hook secret")
+	}
+	return nil
+}
+
+// ParseSigningKey parses the PEM encoded RSA private key the tokens issued to
+// OAuth clients are signed with. It is deliberately separate from the JWT
+// secret, so these tokens can't be mistaken for first-party tokens.
+func (o *OAuthServerConfiguration) ParseSigningKey() (*rsa.PrivateKey, error) {
+	if o.SigningKey == "" {
+		return nil, errors.New("Missing OAuth server signing key")
+	}
+	block, _ := pem.Decode([]byte(o.SigningKey))
+	if block == nil {
+		return nil, errors.New("OAuth server signing key must be PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Invalid OAuth server signing key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("OAuth server signing key must be an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// ClientCertificatePool parses the PEM encoded CA certificates that issue the
+// certificates of tls_client_auth clients. It returns nil when none are
+// configured, in which case tls_client_auth is not available.
+func (o *OAuthServerConfiguration) ClientCertificatePool() (*x509.CertPool, error) {
+	if o.ClientCertificateCA == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(o.ClientCertificateCA)) {
+		return nil, errors.New("Invalid OAuth server client certificate CA")
+	}
+	return pool, nil
+}
+
 func (t *TwilioProviderConfiguration) Validate() error {
 	if t.AccountSid == "" {
 		return errors.New("Missing Twilio account SID")
@@ -1,12 +1,22 @@
 package conf
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/kelseyhightower/envconfig"
 	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
 )
 
 func TestMain(m *testing.M) {
@@ -44,3 +54,507 @@ func TestTracing(t *testing.T) {
 	assert.Equal(t, "127.0.0.1", gc.Tracing.Host)
 	assert.Equal(t, map[string]string{"tag1": "value1", "tag2": "value2"}, gc.Tracing.Tags)
 }
+
+func TestTracingOpenTelemetry(t *testing.T) {
+	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
+	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
+	os.Setenv("GOTRUE_OPERATOR_TOKEN", "token")
+	os.Setenv("GOTRUE_TRACING_ENABLED", "true")
+	os.Setenv("GOTRUE_TRACING_EXPORTER", "opentelemetry")
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:4318")
+	defer func() {
+		os.Unsetenv("GOTRUE_TRACING_ENABLED")
+		os.Unsetenv("GOTRUE_TRACING_EXPORTER")
+		os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	}()
+
+	gc, err := LoadGlobal("")
+	require.NoError(t, err)
+	assert.Equal(t, TracingExporterOpenTelemetry, gc.Tracing.Exporter)
+	assert.IsType(t, &otbridge.BridgeTracer{}, opentracing.GlobalTracer())
+
+	os.Setenv("GOTRUE_TRACING_EXPORTER", "zipkin")
+	_, err = LoadGlobal("")
+	require.Error(t, err)
+}
+
+func TestRequiredProfileFields(t *testing.T) {
+	fields := RequiredProfileFields{}
+	require.NoError(t, fields.Decode(`{"app":["first_name","company"]}`))
+	c := ProfileConfiguration{RequiredFields: fields}
+	assert.Equal(t, []string{"first_name", "company"}, c.RequiredFieldsFor("app"))
+	assert.Nil(t, c.RequiredFieldsFor("other"))
+	require.Error(t, fields.Decode(`["first_name"]`))
+
+	signupMetadata := &SignupMetadataConfiguration{Enabled: true, AllowedKeys: []string{"first_name"}}
+	require.Error(t, c.Validate(signupMetadata))
+	signupMetadata.AllowedKeys = append(signupMetadata.AllowedKeys, "company")
+	require.NoError(t, c.Validate(signupMetadata))
+}
+
+func TestRateLimitClients(t *testing.T) {
+	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
+	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
+	os.Setenv("GOTRUE_RATE_LIMIT_CLIENTS", "billing:secret-key:10,jobs:other-key:0")
+
+	gc, err := LoadGlobal("")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitClients{
+		"billing": {Key: "secret-key", Multiplier: 10},
+		"jobs":    {Key: "other-key", Multiplier: 0},
+	}, gc.RateLimitClients)
+
+	os.Setenv("GOTRUE_RATE_LIMIT_CLIENTS", "billing:secret-key")
+	_, err = LoadGlobal("")
+	require.Error(t, err)
+
+	os.Setenv("GOTRUE_RATE_LIMIT_CLIENTS", "billing:secret-key:-1")
+	_, err = LoadGlobal("")
+	require.Error(t, err)
+	os.Unsetenv("GOTRUE_RATE_LIMIT_CLIENTS")
+}
+
+func TestAdditionalClientIDs(t *testing.T) {
+	os.Setenv("GOTRUE_EXTERNAL_GOOGLE_ADDITIONAL_CLIENT_IDS", "ios-client,android-client")
+	defer os.Unsetenv("GOTRUE_EXTERNAL_GOOGLE_ADDITIONAL_CLIENT_IDS")
+
+	c := OAuthProviderConfiguration{}
+	require.NoError(t, envconfig.Process("gotrue_external_google", &c))
+	assert.Equal(t, []string{"ios-client", "android-client"}, c.AdditionalClientIDs)
+}
+
+func TestRiskConfigurationValidate(t *testing.T) {
+	config := &Configuration{}
+	config.Security.Risk.Enabled = true
+	require.NoError(t, config.ApplyDefaults())
+
+	config.Security.Risk.MFAThreshold = 95
+	assert.Error(t, config.ApplyDefaults())
+
+	config.Security.Risk.MFAThreshold = 70
+	config.Security.Risk.BlockThreshold = 120
+	assert.Error(t, config.ApplyDefaults())
+
+	config.Security.Risk.BlockThreshold = 90
+	config.Security.Risk.URL = "https://risk.example.com"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestDeepLinkConfigurationValidate(t *testing.T) {
+	config := &Configuration{
+		URIAllowList: []string{"myapp://auth/*", "https://example.com/*"},
+	}
+	config.DeepLinks.AppLinks = []string{"https://links.example.com/auth/*"}
+	require.NoError(t, config.ApplyDefaults())
+	assert.Len(t, config.DeepLinks.AppLinkGlobs, 1)
+
+	config.URIAllowList = []string{"javascript:alert(1)"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.URIAllowList = []string{"my*app://auth"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.URIAllowList = nil
+	config.DeepLinks.AppLinks = []string{"myapp://auth"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.DeepLinks.AppLinks = []string{"https://*.example.com/auth"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.DeepLinks.AppLinks = nil
+	config.DeepLinks.FallbackURL = "myapp://install"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestHostedPagesConfigurationValidate(t *testing.T) {
+	config := &Configuration{}
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, "#1a73e8", config.HostedPages.PrimaryColor)
+
+	config.HostedPages.PrimaryColor = "red; background: url(x)"
+	assert.Error(t, config.ApplyDefaults())
+
+	config.HostedPages.PrimaryColor = "#fff"
+	config.HostedPages.LogoURL = "javascript:alert(1)"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestRetentionConfiguration(t *testing.T) {
+	config := &Configuration{}
+	config.Retention.AuditLogDays = 30
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, 30, config.Retention.EmailRecordDays)
+
+	config.Retention.SessionDays = -1
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestErasureConfiguration(t *testing.T) {
+	config := &Configuration{}
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, 7*24*time.Hour, config.Erasure.WaitingPeriod)
+	assert.Equal(t, ErasureAnonymize, config.Erasure.Action)
+
+	config.Erasure.Action = "archive"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestCaptchaConfiguration(t *testing.T) {
+	config := &Configuration{}
+	config.Security.Captcha.Endpoints = []string{CaptchaEndpointSignup, "login"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.Security.Captcha.Endpoints = []string{CaptchaEndpointSignup}
+	require.NoError(t, config.ApplyDefaults())
+	assert.False(t, config.Security.Captcha.Requires(CaptchaEndpointSignup), "captchas are disabled")
+	config.Security.Captcha.Enabled = true
+	assert.True(t, config.Security.Captcha.Requires(CaptchaEndpointSignup))
+	assert.False(t, config.Security.Captcha.Requires(CaptchaEndpointToken))
+}
+
+func TestAutoBansConfiguration(t *testing.T) {
+	config := &Configuration{}
+	require.NoError(t, config.ApplyDefaults())
+	autoBans := config.Security.AutoBans
+	assert.Equal(t, 5, autoBans.Violations)
+	assert.Equal(t, 15*time.Minute, autoBans.Duration(0))
+	assert.Equal(t, 24*time.Hour, autoBans.Duration(2))
+	assert.Equal(t, 24*time.Hour, autoBans.Duration(10))
+
+	config.Security.AutoBans.Durations = []time.Duration{time.Hour, -time.Hour}
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestTrustedIssuers(t *testing.T) {
+	issuers := TrustedIssuers{}
+	require.NoError(t, issuers.Decode(`[{"name":"firebase","issuer":"https://securetoken.google.com/app","audience":"app","claims":{"sub":"user_id","team":"org"}}]`))
+	require.Len(t, issuers, 1)
+	issuer := issuers.Find("https://securetoken.google.com/app")
+	require.NotNil(t, issuer)
+	assert.Equal(t, "user_id", issuer.Claim(TrustedClaimSubject))
+	assert.Equal(t, "email", issuer.Claim(TrustedClaimEmail))
+	assert.Nil(t, issuers.Find("https://evil.example.com"))
+
+	config := &Configuration{TrustedIssuers: issuers}
+	require.NoError(t, config.ApplyDefaults())
+
+	config.TrustedIssuers = append(config.TrustedIssuers, TrustedIssuerConfiguration{Name: "corp", Issuer: "http://idp.example.com", Audience: "gotrue"})
+	assert.Error(t, config.ApplyDefaults())
+	config.TrustedIssuers[1].Issuer = "https://securetoken.google.com/app"
+	assert.Error(t, config.ApplyDefaults())
+	config.TrustedIssuers[1].Issuer = "https://idp.example.com"
+	config.TrustedIssuers[1].Audience = ""
+	assert.Error(t, config.ApplyDefaults())
+
+	assert.Error(t, issuers.Decode("firebase"))
+	require.NoError(t, issuers.Decode(""))
+	assert.Empty(t, issuers)
+}
+
+func TestKerberosConfiguration(t *testing.T) {
+	config := &Configuration{}
+	config.Kerberos.Enabled = true
+	assert.Error(t, config.ApplyDefaults())
+
+	config.Kerberos.Keytab = "/etc/gotrue.keytab"
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, "{username}@{realm}", config.Kerberos.EmailTemplate)
+
+	config.Kerberos.EmailTemplate = "jdoe@example.com"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestLDAPConfiguration(t *testing.T) {
+	config := &Configuration{}
+	config.LDAP.Enabled = true
+	config.LDAP.URL = "ldap://ad.example.com"
+	config.LDAP.BaseDN = "dc=example,dc=com"
+	assert.Error(t, config.ApplyDefaults())
+
+	config.LDAP.StartTLS = true
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, "(mail={email})", config.LDAP.UserFilter)
+	assert.Equal(t, 5, config.LDAP.PoolSize)
+
+	config.LDAP.UserFilter = "(uid=jdoe)"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestWhatsappAudiences(t *testing.T) {
+	config := &Configuration{}
+	config.Sms.Provider = "messagebird"
+	config.Sms.WhatsappAudiences = []string{"mobile"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.Sms.Provider = "twilio"
+	require.NoError(t, config.ApplyDefaults())
+	assert.True(t, config.Sms.IsWhatsappAudience("mobile"))
+	assert.False(t, config.Sms.IsWhatsappAudience("authenticated"))
+
+	config.Sms.DailyLimit = -1
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestPhonePrefixes(t *testing.T) {
+	config := &Configuration{}
+	config.Sms.BlockedPrefixes = []string{"+371", "4470"}
+	config.Sms.AllowedPrefixes = []string{"88234", "3712"}
+	require.NoError(t, config.ApplyDefaults())
+
+	assert.True(t, config.Sms.IsPhoneBlocked("8821234567"))
+	assert.False(t, config.Sms.IsPhoneBlocked("8823456789"))
+	assert.True(t, config.Sms.IsPhoneBlocked("37161234567"))
+	assert.False(t, config.Sms.IsPhoneBlocked("37121234567"))
+	assert.True(t, config.Sms.IsPhoneBlocked("447012345678"))
+	assert.False(t, config.Sms.IsPhoneBlocked("447712345678"))
+
+	config.Sms.BlockedPrefixes = []string{"44-70"}
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestAppMetadataDelegation(t *testing.T) {
+	config := &Configuration{}
+	config.AppMetadata.DelegatedRoles = []string{"billing"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.AppMetadata.DelegatedKeys = []string{"tier", "providers"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.AppMetadata.DelegatedKeys = []string{"tier"}
+	require.NoError(t, config.ApplyDefaults())
+	assert.True(t, config.AppMetadata.IsDelegatedRole("billing"))
+	assert.False(t, config.AppMetadata.IsDelegatedRole("service_role"))
+	assert.True(t, config.AppMetadata.IsDelegatedKey("tier"))
+	assert.False(t, config.AppMetadata.IsDelegatedKey("roles"))
+}
+
+func TestJWTAlgorithm(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	config := &Configuration{}
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, JWTAlgorithmHS256, config.JWT.Algorithm)
+
+	config.JWT.Algorithm = JWTAlgorithmES256
+	assert.Error(t, config.ApplyDefaults())
+
+	config.JWT.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	require.NoError(t, config.ApplyDefaults())
+
+	// the key must match the algorithm
+	config.JWT.Algorithm = JWTAlgorithmRS256
+	assert.Error(t, config.ApplyDefaults())
+
+	config.JWT.Algorithm = "none"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestUnsafeSettings(t *testing.T) {
+	globalConfig := &GlobalConfiguration{OperatorToken: "unused-operator-token"}
+	config := &Configuration{}
+	config.JWT.Secret = "CHANGE-THIS! VERY IMPORTANT!"
+	config.SMTP.Host = "smtp.example.com"
+	assert.Len(t, UnsafeSettings(globalConfig, config), 3)
+
+	// multi-instance mode only checks the global configuration
+	assert.Len(t, UnsafeSettings(globalConfig, nil), 1)
+
+	globalConfig.OperatorToken = "a-real-operator-token"
+	config.JWT.Secret = "a-real-jwt-secret"
+	config.SMTP.Pass = "a-real-smtp-password"
+	assert.Empty(t, UnsafeSettings(globalConfig, config))
+
+	config.LoadTest = true
+	assert.Len(t, UnsafeSettings(globalConfig, config), 1)
+	config.Sandbox = true
+	assert.Len(t, UnsafeSettings(globalConfig, config), 2)
+	globalConfig.TestClock = true
+	assert.Len(t, UnsafeSettings(globalConfig, nil), 1)
+
+	assert.False(t, globalConfig.IsProduction())
+	globalConfig.Env = EnvProduction
+	assert.True(t, globalConfig.IsProduction())
+}
+
+func TestEnvProfiles(t *testing.T) {
+	os.Setenv("GOTRUE_SITE_URL", "https://example.com")
+	os.Setenv("GOTRUE_JWT_SECRET", "secret")
+	defer os.Unsetenv("GOTRUE_ENV")
+
+	os.Setenv("GOTRUE_ENV", EnvDevelopment)
+	config, err := LoadConfig("")
+	require.NoError(t, err)
+	assert.True(t, config.Mailer.Autoconfirm)
+	assert.True(t, config.URIAllowLocalhost)
+	assert.False(t, config.Security.OAuthStrict.Enabled)
+
+	os.Setenv("GOTRUE_ENV", EnvProduction)
+	os.Setenv("GOTRUE_SECURITY_OAUTH_STRICT_ENABLED", "false")
+	defer os.Unsetenv("GOTRUE_SECURITY_OAUTH_STRICT_ENABLED")
+	config, err = LoadConfig("")
+	require.NoError(t, err)
+	assert.False(t, config.Mailer.Autoconfirm)
+	assert.True(t, config.Security.Headers.Enabled)
+	// settings in the environment override the profile
+	assert.False(t, config.Security.OAuthStrict.Enabled)
+
+	os.Setenv("GOTRUE_ENV", "prod")
+	_, err = LoadConfig("")
+	assert.Error(t, err)
+}
+
+func TestProxyFunc(t *testing.T) {
+	pc := &ProxyConfig{
+		HTTPSURL: "http://egress.internal:3128",
+		NoProxy:  []string{"internal.example.com"},
+	}
+	proxy := pc.ProxyFunc()
+
+	req := httptest.NewRequest(http.MethodGet, "https://api.twilio.com/2010-04-01", nil)
+	u, err := proxy(req)
+	require.NoError(t, err)
+	require.NotNil(t, u)
+	assert.Equal(t, "egress.internal:3128", u.Host)
+
+	// plain HTTP has no proxy configured
+	req = httptest.NewRequest(http.MethodGet, "http://api.twilio.com/", nil)
+	u, err = proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, u)
+
+	req = httptest.NewRequest(http.MethodGet, "https://hooks.internal.example.com/", nil)
+	u, err = proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestJWTKeys(t *testing.T) {
+	config := &Configuration{}
+	config.JWT.Secret = "secret"
+	require.NoError(t, config.JWT.Keys.Decode(`[{"kid":"2022-07","algorithm":"HS256","secret":"next-secret","active_from":"2022-07-01T00:00:00Z"}]`))
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, time.Hour, config.JWT.RotationGrace)
+
+	signing, verifying, upcoming := config.JWT.KeySchedule(time.Date(2022, 6, 30, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, "secret", signing.Secret)
+	assert.Len(t, verifying, 1)
+	assert.Len(t, upcoming, 1)
+
+	signing, verifying, upcoming = config.JWT.KeySchedule(time.Date(2022, 7, 1, 0, 30, 0, 0, time.UTC))
+	assert.Equal(t, "2022-07", signing.ID)
+	assert.Len(t, verifying, 2)
+	assert.Empty(t, upcoming)
+
+	_, verifying, _ = config.JWT.KeySchedule(time.Date(2022, 7, 1, 1, 0, 0, 0, time.UTC))
+	assert.Len(t, verifying, 1)
+
+	for _, keys := range []string{
+		`[{"algorithm":"HS256","secret":"s"}]`,
+		`[{"kid":"a","algorithm":"HS256","secret":"s"},{"kid":"a","algorithm":"HS256","secret":"t"}]`,
+		`[{"kid":"a","algorithm":"HS256"}]`,
+		`[{"kid":"a","algorithm":"ES256","secret":"s"}]`,
+		`[{"kid":"a","algorithm":"none","secret":"s"}]`,
+	} {
+		config := &Configuration{}
+		require.NoError(t, config.JWT.Keys.Decode(keys))
+		assert.Error(t, config.ApplyDefaults(), keys)
+	}
+}
+
+func TestPasswordPolicyConfiguration(t *testing.T) {
+	config := &Configuration{}
+	config.PasswordPolicy.RequiredCharacters = []string{"lowercase", "digits"}
+	config.PasswordPolicy.MinScore = 3
+	require.NoError(t, config.ApplyDefaults())
+
+	config.PasswordPolicy.RequiredCharacters = []string{"emoji"}
+	assert.Error(t, config.ApplyDefaults())
+
+	config.PasswordPolicy.RequiredCharacters = nil
+	config.PasswordPolicy.MinScore = 5
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestLockoutConfiguration(t *testing.T) {
+	config := &Configuration{}
+	require.NoError(t, config.ApplyDefaults())
+	lockout := config.Security.Lockout
+	assert.Equal(t, 5, lockout.MaxAttempts)
+	assert.Equal(t, 50, lockout.IPMaxAttempts)
+	assert.Equal(t, 15*time.Minute, lockout.Window)
+	assert.Equal(t, 15*time.Minute, lockout.Duration)
+}
+
+func TestSMTPMaxFrequencies(t *testing.T) {
+	config := &Configuration{}
+	config.SMTP.MaxFrequencies.Recovery = 5 * time.Minute
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, 5*time.Minute, config.SMTP.MaxFrequencyFor(RecoveryEmail))
+	assert.Equal(t, time.Minute, config.SMTP.MaxFrequencyFor(MagicLinkEmail))
+	assert.Equal(t, time.Minute, config.SMTP.MaxFrequencyFor(ConfirmationEmail))
+
+	config.SMTP.MaxFrequencies.Confirmation = -time.Second
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestAccessTokenHookValidation(t *testing.T) {
+	config := &Configuration{}
+	config.AccessTokenHook.Function = "auth.custom_claims"
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, 2, config.AccessTokenHook.TimeoutSec)
+
+	config.AccessTokenHook.Function = "custom_claims(); drop table users"
+	assert.Error(t, config.ApplyDefaults())
+
+	config.AccessTokenHook.Function = "auth.custom_claims"
+	config.AccessTokenHook.URL = "https://hooks.example.com/claims"
+	assert.Error(t, config.ApplyDefaults())
+
+	config.AccessTokenHook.Function = ""
+	config.AccessTokenHook.URL = "ftp://hooks.example.com/claims"
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestJWTExpFor(t *testing.T) {
+	config := &Configuration{}
+	config.JWT.ExpByAud = map[string]int{"mobile": 86400}
+	config.JWT.ExpByRole = map[string]int{"admin": 300, "support": 600}
+	require.NoError(t, config.ApplyDefaults())
+
+	assert.Equal(t, 3600, config.JWT.ExpFor("web", []string{"authenticated"}))
+	assert.Equal(t, 86400, config.JWT.ExpFor("mobile", []string{"authenticated"}))
+	assert.Equal(t, 600, config.JWT.ExpFor("mobile", []string{"support"}))
+	assert.Equal(t, 300, config.JWT.ExpFor("web", []string{"support", "admin"}))
+	assert.Equal(t, 86400*time.Second, config.JWT.RotationGrace)
+
+	config.JWT.ExpByRole["admin"] = 0
+	assert.Error(t, config.ApplyDefaults())
+}
+
+func TestDBSchemaCheck(t *testing.T) {
+	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
+	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
+
+	gc, err := LoadGlobal("")
+	require.NoError(t, err)
+	assert.Equal(t, SchemaCheckFail, gc.DB.SchemaCheck)
+
+	os.Setenv("GOTRUE_DB_SCHEMA_CHECK", "sometimes")
+	defer os.Unsetenv("GOTRUE_DB_SCHEMA_CHECK")
+	_, err = LoadGlobal("")
+	require.Error(t, err)
+}
+
+func TestPasswordVerificationHookValidation(t *testing.T) {
+	config := &Configuration{}
+	config.PasswordVerificationHook.URL = "https://legacy.example.com/verify"
+	require.NoError(t, config.ApplyDefaults())
+	assert.Equal(t, 2, config.PasswordVerificationHook.TimeoutSec)
+
+	config.PasswordVerificationHook.URL = "legacy.example.com/verify"
+	assert.Error(t, config.ApplyDefaults())
+}
@@ -0,0 +1,232 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The sources a setting can come from.
+const (
+	SourceEnv      = "env"
+	SourceProfile  = "profile"
+	SourceInstance = "instance"
+	SourceDefault  = "default"
+)
+
+// Redacted replaces the values of secrets in described settings.
+const Redacted = "[redacted]"
+
+// Setting is a configuration value, the environment variable it is read from
+// and where the value came from.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// secretKeyRegexp matches the environment variables that hold secrets.
+var secretKeyRegexp = regexp.MustCompile(`(SECRET|PASSWORD$|_PASS$|_KEY$|_TOKEN$|JWT_KEYS$|RATE_LIMIT_CLIENTS$|DATABASE_URL$)`)
+
+// notSecretKeys are matched by secretKeyRegexp but hold no secret.
+var notSecretKeys = map[string]bool{
+	"GOTRUE_COOKIE_KEY": true,
+}
+
+func isSecretKey(key string) bool {
+	return secretKeyRegexp.MatchString(key) && !notSecretKeys[key]
+}
+
+// Same as envconfig, which splits the camel cased names of split_words fields.
+var (
+	gatherRegexp  = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+	acronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+)
+
+// DescribeGlobal lists the global settings. A setting comes from the
+// environment if its variable is set.
+func DescribeGlobal(config *GlobalConfiguration) []Setting {
+	return describe(reflect.ValueOf(config).Elem(), reflect.Value{}, "GOTRUE", func(key, alt string, value, base reflect.Value) string {
+		if isEnvSet(key, alt) {
+			return SourceEnv
+		}
+		return SourceDefault
+	})
+}
+
+// DescribeInstance lists the settings of an instance. In multi-instance mode
+// base is the configuration stored for the instance, and settings come from it
+// if it sets them. Otherwise settings come from the environment or from the
+// defaults of the env profile.
+func DescribeInstance(config *Configuration, base *Configuration, env string) []Setting {
+	if base != nil {
+		return describe(reflect.ValueOf(config).Elem(), reflect.ValueOf(base).Elem(), "GOTRUE", func(key, alt string, value, base reflect.Value) string {
+			if base.IsValid() && !base.IsZero() {
+				return SourceInstance
+			}
+			return SourceDefault
+		})
+	}
+
+	profile := &Configuration{}
+	profile.applyEnvDefaults(env)
+	return describe(reflect.ValueOf(config).Elem(), reflect.ValueOf(profile).Elem(), "GOTRUE", func(key, alt string, value, profile reflect.Value) string {
+		if isEnvSet(key, alt) {
+			return SourceEnv
+		}
+		if profile.IsValid() && !profile.IsZero() && reflect.DeepEqual(value.Interface(), profile.Interface()) {
+			return SourceProfile
+		}
+		return SourceDefault
+	})
+}
+
+func isEnvSet(key, alt string) bool {
+	if _, ok := os.LookupEnv(key); ok {
+		return true
+	}
+	if alt != "" {
+		_, ok := os.LookupEnv(alt)
+		return ok
+	}
+	return false
+}
+
+type sourceFunc func(key, alt string, value, base reflect.Value) string
+
+// describe walks the fields of s the way envconfig does, base is the same
+// field of another configuration that sourceOf compares against.
+func describe(s, base reflect.Value, prefix string, sourceOf sourceFunc) []Setting {
+	settings := []Setting{}
+	t := s.Type()
+	for i := 0; i < s.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("ignored") == "true" {
+			continue
+		}
+		f := s.Field(i)
+		var b reflect.Value
+		if base.IsValid() {
+			b = base.Field(i)
+		}
+
+		alt := strings.ToUpper(field.Tag.Get("envconfig"))
+		key := envKey(field)
+		if alt != "" {
+			key = alt
+		}
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		key = strings.ToUpper(key)
+		if _, ok := os.LookupEnv(key); !ok && alt != "" {
+			// envconfig falls back to the unprefixed name of the tag
+			if _, ok := os.LookupEnv(alt); ok {
+				key = alt
+			}
+		}
+
+		for f.Kind() == reflect.Ptr && !f.IsNil() && f.Elem().Kind() == reflect.Struct {
+			f = f.Elem()
+			if b.IsValid() {
+				if b.IsNil() {
+					b = reflect.Value{}
+				} else {
+					b = b.Elem()
+				}
+			}
+		}
+
+		if f.Kind() == reflect.Struct && !isLeaf(f) {
+			inner := key
+			if field.Anonymous {
+				inner = prefix
+			}
+			settings = append(settings, describe(f, b, inner, sourceOf)...)
+			continue
+		}
+
+		settings = append(settings, Setting{
+			Key:    key,
+			Value:  settingValue(key, f),
+			Source: sourceOf(key, alt, f, b),
+		})
+	}
+	return settings
+}
+
+// envKey is the name of the variable of a field, without prefix.
+func envKey(field reflect.StructField) string {
+	if field.Tag.Get("split_words") != "true" {
+		return field.Name
+	}
+	words := gatherRegexp.FindAllStringSubmatch(field.Name, -1)
+	if len(words) == 0 {
+		return field.Name
+	}
+	name := []string{}
+	for _, word := range words {
+		if m := acronymRegexp.FindStringSubmatch(word[0]); len(m) == 3 {
+			name = append(name, m[1], m[2])
+		} else {
+			name = append(name, word[0])
+		}
+	}
+	return strings.Join(name, "_")
+}
+
+// isLeaf tells whether a struct is decoded from a single variable.
+func isLeaf(v reflect.Value) bool {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	if !v.CanAddr() {
+		return false
+	}
+	switch v.Addr().Interface().(type) {
+	case interface{ Decode(string) error }, interface{ Set(string) error }:
+		return true
+	}
+	return false
+}
+
+func settingValue(key string, v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	if isSecretKey(key) {
+		if v.IsZero() {
+			return v.Interface()
+		}
+		return Redacted
+	}
+	switch value := v.Interface().(type) {
+	case string:
+		return redactURLPassword(value)
+	case time.Duration:
+		return value.String()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v.Interface()
+}
+
+// redactURLPassword redacts the password of URLs such as proxy URLs.
+func redactURLPassword(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	u.User = url.UserPassword(u.User.Username(), "redacted")
+	return u.String()
+}
@@ -0,0 +1,161 @@
+package conf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	sortpkg "sort"
+	"strings"
+	"time"
+)
+
+// JWTKeyConfiguration is a key access tokens are signed with from ActiveFrom
+// on, until the next key is active. HS256 keys have a secret, the others a
+// private key.
+type JWTKeyConfiguration struct {
+	ID         string    `json:"kid"`
+	Algorithm  string    `json:"algorithm"`
+	Secret     string    `json:"secret"`
+	PrivateKey string    `json:"private_key"`
+	ActiveFrom time.Time `json:"active_from"`
+}
+
+// JWTKeys is read from a JSON array of keys.
+type JWTKeys []JWTKeyConfiguration
+
+// Decode implements envconfig.Decoder
+func (k *JWTKeys) Decode(value string) error {
+	keys := []JWTKeyConfiguration{}
+	if strings.TrimSpace(value) == "" {
+		*k = keys
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), &keys); err != nil {
+		return fmt.Errorf("invalid JWT keys, expected a JSON array: %v", err)
+	}
+	*k = keys
+	return nil
+}
+
+// Validate checks that every key has a unique id and the secret or private key
+// of its algorithm.
+func (k JWTKeys) Validate() error {
+	ids := map[string]bool{}
+	for i := range k {
+		key := &k[i]
+		if key.ID == "" {
+			return errors.New("JWT keys require a kid")
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("JWT key %q is configured twice", key.ID)
+		}
+		ids[key.ID] = true
+
+		switch key.Algorithm {
+		case JWTAlgorithmHS256:
+			if key.Secret == "" || key.PrivateKey != "" {
+				return fmt.Errorf("JWT key %q requires a secret and no private key", key.ID)
+			}
+		case JWTAlgorithmRS256, JWTAlgorithmES256, JWTAlgorithmEdDSA:
+			if key.Secret != "" {
+				return fmt.Errorf("JWT key %q requires a private key and no secret", key.ID)
+			}
+			if _, err := key.ParsePrivateKey(); err != nil {
+				return fmt.Errorf("JWT key %q: %v", key.ID, err)
+			}
+		default:
+			return fmt.Errorf("invalid algorithm %q of JWT key %q, expected HS256, RS256, ES256 or EdDSA", key.Algorithm, key.ID)
+		}
+	}
+	return nil
+}
+
+// ParsePrivateKey parses the PEM encoded private key of the key, which must
+// be an RSA key for RS256, a P-256 key for ES256 and an Ed25519 key for EdDSA.
+func (k *JWTKeyConfiguration) ParsePrivateKey() (crypto.Signer, error) {
+	if k.PrivateKey == "" {
+		return nil, fmt.Errorf("Missing JWT private key for the %s algorithm", k.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return nil, errors.New("JWT private key must be PEM encoded")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.New("Invalid JWT private key")
+	}
+
+	switch pk := key.(type) {
+	case *rsa.PrivateKey:
+		if k.Algorithm == JWTAlgorithmRS256 {
+			return pk, nil
+		}
+	case *ecdsa.PrivateKey:
+		if k.Algorithm == JWTAlgorithmES256 && pk.Curve == elliptic.P256() {
+			return pk, nil
+		}
+	case ed25519.PrivateKey:
+		if k.Algorithm == JWTAlgorithmEdDSA {
+			return pk, nil
+		}
+	}
+	return nil, fmt.Errorf("JWT private key doesn't match the %s algorithm", k.Algorithm)
+}
+
+// ParsePrivateKey parses the PEM encoded private key access tokens are signed
+// with before any of Keys is active.
+func (j *JWTConfiguration) ParsePrivateKey() (crypto.Signer, error) {
+	key := j.initialKey()
+	return key.ParsePrivateKey()
+}
+
+// initialKey is the key access tokens are signed with before any of Keys is
+// active. It has no id, and its secret also verifies the tokens signed with
+// HS256 before switching to another algorithm.
+func (j *JWTConfiguration) initialKey() JWTKeyConfiguration {
+	return JWTKeyConfiguration{Algorithm: j.Algorithm, Secret: j.Secret, PrivateKey: j.PrivateKey}
+}
+
+// KeySchedule returns the key access tokens are signed with at now, the keys
+// they are verified with, starting with the signing key, and the keys that
+// will be active later, which are published ahead of time.
+func (j *JWTConfiguration) KeySchedule(now time.Time) (signing JWTKeyConfiguration, verifying, upcoming []JWTKeyConfiguration) {
+	keys := append([]JWTKeyConfiguration{j.initialKey()}, j.Keys...)
+	sortpkg.SliceStable(keys, func(a, b int) bool {
+		return keys[a].ActiveFrom.Before(keys[b].ActiveFrom)
+	})
+
+	current := 0
+	for i := range keys {
+		if keys[i].ActiveFrom.After(now) {
+			upcoming = append(upcoming, keys[i])
+		} else {
+			current = i
+		}
+	}
+
+	verifying = []JWTKeyConfiguration{keys[current]}
+	for i := current - 1; i >= 0; i-- {
+		if now.Before(keys[i+1].ActiveFrom.Add(j.RotationGrace)) {
+			verifying = append(verifying, keys[i])
+		}
+	}
+	return keys[current], verifying, upcoming
+}
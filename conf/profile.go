@@ -0,0 +1,38 @@
+package conf
+
+import "fmt"
+
+// The deployment profiles of GOTRUE_ENV. Each one sets defaults suited to the
+// deployment, which settings in the environment still override.
+const (
+	EnvDevelopment = "dev"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+func validateEnv(env string) error {
+	switch env {
+	case "", EnvDevelopment, EnvStaging, EnvProduction:
+		return nil
+	}
+	return fmt.Errorf("GOTRUE_ENV must be %s, %s or %s, got %q", EnvDevelopment, EnvStaging, EnvProduction, env)
+}
+
+// IsProduction reports whether GoTrue runs with the production profile.
+func (c *GlobalConfiguration) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// applyEnvDefaults sets the defaults of the profile, before the environment is
+// loaded over them.
+func (config *Configuration) applyEnvDefaults(env string) {
+	switch env {
+	case EnvDevelopment:
+		// sign ups can be tried without a mail server and a local frontend
+		config.Mailer.Autoconfirm = true
+		config.URIAllowLocalhost = true
+	case EnvStaging, EnvProduction:
+		config.Security.OAuthStrict.Enabled = true
+		config.Security.Headers.Enabled = true
+	}
+}
@@ -0,0 +1,62 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RequiredProfileFields are the user_metadata fields the users of each
+// audience have to fill in, by audience. Users may sign up without them and
+// complete their profile later.
+type RequiredProfileFields map[string][]string
+
+// Decode implements envconfig.Decoder
+func (p *RequiredProfileFields) Decode(value string) error {
+	fields := RequiredProfileFields{}
+	if strings.TrimSpace(value) == "" {
+		*p = fields
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return fmt.Errorf("invalid required profile fields, expected a JSON object of audiences to fields: %v", err)
+	}
+	*p = fields
+	return nil
+}
+
+// ProfileConfiguration is for progressive profiling, where users complete
+// their profile after signing up.
+type ProfileConfiguration struct {
+	RequiredFields RequiredProfileFields `json:"required_fields" split_words:"true"`
+}
+
+// RequiredFieldsFor returns the fields the users of aud have to fill in.
+func (c *ProfileConfiguration) RequiredFieldsFor(aud string) []string {
+	return c.RequiredFields[aud]
+}
+
+// Validate checks that the required fields are named, and may be set by
+// users when SIGNUP_METADATA_ENABLED restricts the user_metadata keys.
+func (c *ProfileConfiguration) Validate(signupMetadata *SignupMetadataConfiguration) error {
+	for aud, fields := range c.RequiredFields {
+		for _, field := range fields {
+			if field == "" {
+				return fmt.Errorf("required profile fields of audience %q can't be empty", aud)
+			}
+			if signupMetadata.Enabled && !isAllowedKey(field, signupMetadata.AllowedKeys) {
+				return fmt.Errorf("required profile field %q must be one of SIGNUP_METADATA_ALLOWED_KEYS", field)
+			}
+		}
+	}
+	return nil
+}
+
+func isAllowedKey(key string, allowed []string) bool {
+	for _, k := range allowed {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
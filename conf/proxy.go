@@ -0,0 +1,50 @@
+package conf
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig routes outbound HTTP calls, to OAuth providers, webhooks, SMS
+// providers and captcha verification, through an egress proxy. Without it,
+// the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables are used.
+type ProxyConfig struct {
+	HTTPURL  string   `envconfig:"HTTP_URL"`
+	HTTPSURL string   `envconfig:"HTTPS_URL"`
+	NoProxy  []string `split_words:"true"`
+}
+
+// ProxyFunc returns the proxy of a request, or nil when it goes out directly.
+func (pc *ProxyConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if pc.HTTPURL == "" && pc.HTTPSURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  pc.HTTPURL,
+		HTTPSProxy: pc.HTTPSURL,
+		NoProxy:    strings.Join(pc.NoProxy, ","),
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// ConfigureProxy makes every HTTP client that uses the default transport go
+// through the configured proxy.
+func ConfigureProxy(pc *ProxyConfig) error {
+	for _, rawURL := range []string{pc.HTTPURL, pc.HTTPSURL} {
+		if rawURL == "" {
+			continue
+		}
+		if _, err := url.Parse(rawURL); err != nil {
+			return err
+		}
+	}
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.Proxy = pc.ProxyFunc()
+	}
+	return nil
+}
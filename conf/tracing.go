@@ -1,15 +1,31 @@
 package conf
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/opentracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
+// Tracing exporters.
+const (
+	TracingExporterDatadog       = "datadog"
+	TracingExporterOpenTelemetry = "opentelemetry"
+)
+
 type TracingConfig struct {
-	Enabled     bool `default:"false"`
+	Enabled     bool   `default:"false"`
+	Exporter    string `default:"datadog"`
 	Host        string
 	Port        string
 	ServiceName string `default:"gotrue" split_words:"true"`
@@ -20,19 +36,69 @@ func (tc *TracingConfig) tracingAddr() string {
 	return fmt.Sprintf("%s:%s", tc.Host, tc.Port)
 }
 
-func ConfigureTracing(tc *TracingConfig) {
+func ConfigureTracing(tc *TracingConfig) error {
 	var t opentracing.Tracer = opentracing.NoopTracer{}
 	if tc.Enabled {
-		tracerOps := []tracer.StartOption{
-			tracer.WithServiceName(tc.ServiceName),
-			tracer.WithAgentAddr(tc.tracingAddr()),
-		}
+		switch tc.Exporter {
+		case TracingExporterDatadog:
+			tracerOps := []tracer.StartOption{
+				tracer.WithServiceName(tc.ServiceName),
+				tracer.WithAgentAddr(tc.tracingAddr()),
+			}
 
-		for k, v := range tc.Tags {
-			tracerOps = append(tracerOps, tracer.WithGlobalTag(k, v))
-		}
+			for k, v := range tc.Tags {
+				tracerOps = append(tracerOps, tracer.WithGlobalTag(k, v))
+			}
 
-		t = opentracer.New(tracerOps...)
+			t = opentracer.New(tracerOps...)
+		case TracingExporterOpenTelemetry:
+			ot, err := newOpenTelemetryTracer(tc)
+			if err != nil {
+				return err
+			}
+			t = ot
+		default:
+			return fmt.Errorf("Unknown tracing exporter %q", tc.Exporter)
+		}
 	}
 	opentracing.SetGlobalTracer(t)
+	return nil
+}
+
+// newOpenTelemetryTracer exports the spans over OTLP, bridged to opentracing
+// so the spans of GoTrue don't depend on the exporter. The exporter, sampler
+// and resource are configured by the standard OTEL_* environment variables,
+// e.g. OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_TRACES_SAMPLER. Trace context is
+// propagated in the W3C traceparent and baggage headers.
+func newOpenTelemetryTracer(tc *TracingConfig) (opentracing.Tracer, error) {
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating OTLP exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String(tc.ServiceName)}
+	for k, v := range tc.Tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attrs...),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating OpenTelemetry resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	bridge, wrapper := otbridge.NewTracerPair(provider.Tracer("github.com/netlify/gotrue"))
+	bridge.SetTextMapPropagator(propagator)
+	otel.SetTracerProvider(wrapper)
+	otel.SetTextMapPropagator(propagator)
+	return bridge, nil
 }
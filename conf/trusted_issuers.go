@@ -0,0 +1,91 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Fields of a trusted issuer's tokens that aren't user metadata.
+const (
+	TrustedClaimSubject       = "sub"
+	TrustedClaimEmail         = "email"
+	TrustedClaimEmailVerified = "email_verified"
+)
+
+// TrustedIssuerConfiguration lets the tokens of an external issuer, like
+// Firebase or a corporate identity provider, be exchanged for a session.
+type TrustedIssuerConfiguration struct {
+	// Name is the provider of the identities created for the issuer's users.
+	Name     string `json:"name"`
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// JWKSURL is where the signing keys are, for issuers that don't publish
+	// an OpenID Connect discovery document.
+	JWKSURL string `json:"jwks_url"`
+	// Claims maps sub, email, email_verified and user metadata fields to the
+	// token claims that hold them. The first three default to the claims of
+	// the same name.
+	Claims map[string]string `json:"claims"`
+}
+
+// Claim returns the token claim holding field.
+func (t *TrustedIssuerConfiguration) Claim(field string) string {
+	if claim, ok := t.Claims[field]; ok && claim != "" {
+		return claim
+	}
+	return field
+}
+
+// TrustedIssuers is read from a JSON array of trusted issuers.
+type TrustedIssuers []TrustedIssuerConfiguration
+
+// Decode implements envconfig.Decoder
+func (t *TrustedIssuers) Decode(value string) error {
+	issuers := []TrustedIssuerConfiguration{}
+	if strings.TrimSpace(value) == "" {
+		*t = issuers
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), &issuers); err != nil {
+		return fmt.Errorf("invalid trusted issuers, expected a JSON array: %v", err)
+	}
+	*t = issuers
+	return nil
+}
+
+// Find returns the trusted issuer with the issuer URL iss.
+func (t TrustedIssuers) Find(iss string) *TrustedIssuerConfiguration {
+	for i := range t {
+		if t[i].Issuer == iss {
+			return &t[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks that every issuer has a name, an issuer URL and an
+// audience, and that names and issuers are unique.
+func (t TrustedIssuers) Validate() error {
+	names := map[string]bool{}
+	issuers := map[string]bool{}
+	for _, issuer := range t {
+		if issuer.Name == "" || issuer.Issuer == "" || issuer.Audience == "" {
+			return fmt.Errorf("trusted issuer %q requires a name, an issuer and an audience", issuer.Issuer)
+		}
+		if names[issuer.Name] || issuers[issuer.Issuer] {
+			return fmt.Errorf("trusted issuer %q is configured twice", issuer.Issuer)
+		}
+		names[issuer.Name], issuers[issuer.Issuer] = true, true
+		for _, u := range []string{issuer.Issuer, issuer.JWKSURL} {
+			if u == "" {
+				continue
+			}
+			if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" {
+				return fmt.Errorf("invalid trusted issuer URL %q, expected an https URL", u)
+			}
+		}
+	}
+	return nil
+}
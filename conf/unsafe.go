@@ -0,0 +1,45 @@
+package conf
+
+import "fmt"
+
+// exampleSecrets are the secrets of the docs, example.env and hack/test.env,
+// which anyone can look up.
+var exampleSecrets = map[string]bool{
+	"CHANGE-THIS! VERY IMPORTANT!": true,
+	"supersecretvalue":             true,
+	"testsecret":                   true,
+	"unused-operator-token":        true,
+	"foobar":                       true,
+}
+
+// UnsafeSettings returns the settings that are obviously unsafe to run with:
+// secrets copied from the docs, SMTP without a password, load test mode,
+// sandbox mode and the test clock. config is nil in multi-instance mode, where
+// only the global configuration is checked.
+func UnsafeSettings(globalConfig *GlobalConfiguration, config *Configuration) []string {
+	unsafe := []string{}
+	if exampleSecrets[globalConfig.OperatorToken] {
+		unsafe = append(unsafe, "OPERATOR_TOKEN is an example value from the docs")
+	}
+	if globalConfig.TestClock {
+		unsafe = append(unsafe, "TEST_CLOCK is enabled, admins can move the clock tokens and OTPs expire by")
+	}
+
+	smtp := globalConfig.SMTP
+	if config != nil {
+		if config.JWT.Secret == "" || exampleSecrets[config.JWT.Secret] {
+			unsafe = append(unsafe, "JWT_SECRET is empty or an example value from the docs")
+		}
+		if config.LoadTest {
+			unsafe = append(unsafe, "LOAD_TEST is enabled, no emails or SMS are sent")
+		}
+		if config.Sandbox {
+			unsafe = append(unsafe, "SANDBOX is enabled, emails and SMS are kept for the admin API instead of being sent")
+		}
+		smtp = config.SMTP
+	}
+	if smtp.Host != "" && smtp.Pass == "" {
+		unsafe = append(unsafe, fmt.Sprintf("SMTP_PASS is empty while mail is sent through SMTP_HOST %q", smtp.Host))
+	}
+	return unsafe
+}
@@ -0,0 +1,219 @@
+package directory
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/netlify/gotrue/conf"
+)
+
+// ErrInvalidCredentials is returned when the directory has no single user
+// with the email, or the password doesn't bind as that user.
+var ErrInvalidCredentials = errors.New("invalid LDAP credentials")
+
+// Entry is the directory entry of an authenticated user.
+type Entry struct {
+	DN    string
+	ID    string
+	Email string
+	// Metadata holds the mapped attributes, by user metadata field.
+	Metadata map[string]interface{}
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[string]*Pool{}
+)
+
+// Get returns the connection pool of the directory of config, which is
+// shared by every request with the same configuration.
+func Get(config *conf.LDAPConfiguration) (*Pool, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	key := string(sum[:])
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if pool, ok := pools[key]; ok {
+		return pool, nil
+	}
+	pool, err := NewPool(config)
+	if err != nil {
+		return nil, err
+	}
+	pools[key] = pool
+	return pool, nil
+}
+
+// Pool keeps up to PoolSize idle connections to the directory.
+type Pool struct {
+	config *conf.LDAPConfiguration
+	tls    *tls.Config
+	idle   chan ldap.Client
+	dial   func() (ldap.Client, error)
+}
+
+// NewPool creates a pool of connections to the directory of config.
+func NewPool(config *conf.LDAPConfiguration) (*Pool, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	if config.TLSCACert != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(config.TLSCACert)) {
+			return nil, errors.New("invalid LDAP CA certificate")
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	p := &Pool{
+		config: config,
+		tls:    tlsConfig,
+		idle:   make(chan ldap.Client, config.PoolSize),
+	}
+	p.dial = p.dialDirectory
+	return p, nil
+}
+
+func (p *Pool) dialDirectory() (ldap.Client, error) {
+	conn, err := ldap.DialURL(p.config.URL, ldap.DialWithTLSConfig(p.tls), ldap.DialWithDialer(&net.Dialer{Timeout: p.config.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	if p.config.StartTLS {
+		if err := conn.StartTLS(p.tls); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	conn.SetTimeout(p.config.Timeout)
+	return conn, nil
+}
+
+// get returns an idle connection, or a new one, bound as the service account.
+func (p *Pool) get() (ldap.Client, error) {
+	var conn ldap.Client
+	for conn == nil {
+		select {
+		case idle := <-p.idle:
+			if idle.IsClosing() {
+				continue
+			}
+			conn = idle
+		default:
+			dialed, err := p.dial()
+			if err != nil {
+				return nil, err
+			}
+			conn = dialed
+		}
+	}
+
+	var err error
+	if p.config.BindDN != "" {
+		err = conn.Bind(p.config.BindDN, p.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns a connection that still works to the pool.
+func (p *Pool) put(conn ldap.Client) {
+	if conn.IsClosing() {
+		return
+	}
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Authenticate finds the user with email in the directory and binds as that
+// user with password.
+func (p *Pool) Authenticate(email, password string) (*Entry, error) {
+	// an empty password would make an unauthenticated bind, which succeeds
+	if email == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := []string{"mail"}
+	if p.config.IDAttribute != "" {
+		attributes = append(attributes, p.config.IDAttribute)
+	}
+	for _, attribute := range p.config.Attributes {
+		attributes = append(attributes, attribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		strings.Replace(p.config.UserFilter, "{email}", ldap.EscapeFilter(email), -1),
+		attributes, nil,
+	))
+	if err != nil {
+		conn.Close()
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		p.put(conn)
+		return nil, ErrInvalidCredentials
+	}
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			p.put(conn)
+			return nil, ErrInvalidCredentials
+		}
+		conn.Close()
+		return nil, err
+	}
+	// the connection is bound as the service account again when reused
+	p.put(conn)
+
+	entry := &Entry{
+		DN:       found.DN,
+		ID:       found.DN,
+		Email:    found.GetAttributeValue("mail"),
+		Metadata: map[string]interface{}{},
+	}
+	if p.config.IDAttribute != "" {
+		if id := found.GetAttributeValue(p.config.IDAttribute); id != "" {
+			entry.ID = id
+		}
+	}
+	if entry.Email == "" {
+		entry.Email = email
+	}
+	for field, attribute := range p.config.Attributes {
+		if value := found.GetAttributeValue(attribute); value != "" {
+			entry.Metadata[field] = value
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,102 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDirectory answers binds and searches for a single user.
+type fakeDirectory struct {
+	ldap.Client
+	passwords map[string]string
+	entries   []*ldap.Entry
+	filters   []string
+	bound     string
+	closed    bool
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if d.passwords[username] != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+	d.bound = username
+	return nil
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.filters = append(d.filters, req.Filter)
+	if d.bound != "cn=gotrue,dc=example,dc=com" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, nil)
+	}
+	return &ldap.SearchResult{Entries: d.entries}, nil
+}
+
+func (d *fakeDirectory) IsClosing() bool { return d.closed }
+func (d *fakeDirectory) Close()          { d.closed = true }
+
+func testPool(t *testing.T, dir *fakeDirectory) (*Pool, *int) {
+	config := &conf.LDAPConfiguration{
+		URL:          "ldaps://ad.example.com",
+		BindDN:       "cn=gotrue,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(&(objectClass=person)(mail={email}))",
+		IDAttribute:  "entryUUID",
+		Attributes:   map[string]string{"full_name": "displayName"},
+		PoolSize:     1,
+	}
+	pool, err := NewPool(config)
+	require.NoError(t, err)
+	dials := 0
+	pool.dial = func() (ldap.Client, error) {
+		dials++
+		return dir, nil
+	}
+	return pool, &dials
+}
+
+func TestAuthenticate(t *testing.T) {
+	dn := "cn=Jane Doe,ou=people,dc=example,dc=com"
+	dir := &fakeDirectory{
+		passwords: map[string]string{"cn=gotrue,dc=example,dc=com": "service", dn: "secret"},
+		entries: []*ldap.Entry{ldap.NewEntry(dn, map[string][]string{
+			"mail":        {"jane@example.com"},
+			"entryUUID":   {"5f0c7e4a"},
+			"displayName": {"Jane Doe"},
+		})},
+	}
+	pool, dials := testPool(t, dir)
+
+	entry, err := pool.Authenticate("jane@example.com", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, dn, entry.DN)
+	assert.Equal(t, "5f0c7e4a", entry.ID)
+	assert.Equal(t, "jane@example.com", entry.Email)
+	assert.Equal(t, map[string]interface{}{"full_name": "Jane Doe"}, entry.Metadata)
+
+	// the pooled connection is reused, bound as the service account again
+	_, err = pool.Authenticate("jane@example.com", "wrong")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = pool.Authenticate("jane@example.com", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, 1, *dials)
+
+	_, err = pool.Authenticate("jane@example.com", "")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	_, err = pool.Authenticate("*)(mail=*", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, `(&(objectClass=person)(mail=\2a\29\28mail=\2a))`, dir.filters[len(dir.filters)-1])
+}
+
+func TestAuthenticateUnknownUser(t *testing.T) {
+	dir := &fakeDirectory{passwords: map[string]string{"cn=gotrue,dc=example,dc=com": "service"}}
+	pool, _ := testPool(t, dir)
+
+	_, err := pool.Authenticate("nobody@example.com", "secret")
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
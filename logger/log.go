@@ -9,6 +9,14 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+type contextKey string
+
+// RequestIDKey is the context key under which the request ID is stored.
+const RequestIDKey = contextKey("request_id")
+
+// TraceIDKey is the context key under which the W3C trace ID of the request is stored.
+const TraceIDKey = contextKey("trace_id")
+
 func NewStructuredLogger(logger *logrus.Logger) func(next http.Handler) http.Handler {
 	logger.Formatter = &logrus.JSONFormatter{
 		DisableTimestamp: true,
@@ -31,9 +39,12 @@ func (l *structuredLogger) NewLogEntry(r *http.Request) chimiddleware.LogEntry {
 		"timestamp":   time.Now().UTC().Format(time.RFC3339),
 	}
 
-	if reqID := r.Context().Value("request_id"); reqID != nil {
+	if reqID := r.Context().Value(RequestIDKey); reqID != nil {
 		logFields["request_id"] = reqID.(string)
 	}
+	if traceID := r.Context().Value(TraceIDKey); traceID != nil {
+		logFields["trace_id"] = traceID.(string)
+	}
 
 	entry.Logger = entry.Logger.WithFields(logFields)
 	entry.Logger.Infoln("request started")
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"errors"
+	"net/textproto"
+
+	"github.com/netlify/gotrue/breaker"
+)
+
+// breakerMailClient stops sending mail through an SMTP server that keeps
+// failing.
+type breakerMailClient struct {
+	name  string
+	inner MailClient
+}
+
+func (m *breakerMailClient) Mail(to, subjectTemplate, templateURL, defaultTemplate string, templateData map[string]interface{}) error {
+	return breaker.Get(m.name).Do(func() error {
+		return m.inner.Mail(to, subjectTemplate, templateURL, defaultTemplate, templateData)
+	}, isSMTPFailure)
+}
+
+// isSMTPFailure tells apart a failing SMTP server from one that rejected a
+// single message, e.g. for an unknown recipient. 421 means the server is
+// shutting down the connection.
+func isSMTPFailure(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code == 421
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package mailer
 
 import (
+	"context"
 	"net/url"
 	"regexp"
 
@@ -17,6 +18,7 @@ type Mailer interface {
 	InviteMail(user *models.User, otp, referrerURL string) error
 	ConfirmationMail(user *models.User, otp, referrerURL string) error
 	RecoveryMail(user *models.User, otp, referrerURL string) error
+	RecoveryCodeMail(user *models.User, otp string) error
 	MagicLinkMail(user *models.User, otp, referrerURL string) error
 	EmailChangeMail(user *models.User, otpNew, otpCurrent, referrerURL string) error
 	ReauthenticateMail(user *models.User, otp string) error
@@ -26,22 +28,47 @@ type Mailer interface {
 
 // NewMailer returns a new gotrue mailer
 func NewMailer(instanceConfig *conf.Configuration) Mailer {
+	return NewMailerWithLogger(instanceConfig, logrus.New())
+}
+
+// NewMailerWithLogger returns a new gotrue mailer which logs to the given logger
+func NewMailerWithLogger(instanceConfig *conf.Configuration, log logrus.FieldLogger) Mailer {
+	return NewMailerWithContext(context.Background(), instanceConfig, log)
+}
+
+// NewMailerWithContext returns a new gotrue mailer which logs to the given
+// logger, and traces the mail it sends as part of the span of ctx
+func NewMailerWithContext(ctx context.Context, instanceConfig *conf.Configuration, log logrus.FieldLogger) Mailer {
 	mail := gomail.NewMessage()
 	from := mail.FormatAddress(instanceConfig.SMTP.AdminEmail, instanceConfig.SMTP.SenderName)
 
 	var mailClient MailClient
-	if instanceConfig.SMTP.Host == "" {
+	if instanceConfig.Sandbox {
+		mailClient = &sandboxMailClient{
+			renderer: &mailme.Mailer{
+				BaseURL: instanceConfig.SiteURL,
+				Logger:  log,
+			},
+		}
+	} else if instanceConfig.SMTP.Host == "" || instanceConfig.LoadTest {
 		logrus.Infof("Noop mail client being used for %v", instanceConfig.SiteURL)
 		mailClient = &noopMailClient{}
 	} else {
-		mailClient = &mailme.Mailer{
-			Host:    instanceConfig.SMTP.Host,
-			Port:    instanceConfig.SMTP.Port,
-			User:    instanceConfig.SMTP.User,
-			Pass:    instanceConfig.SMTP.Pass,
-			From:    from,
-			BaseURL: instanceConfig.SiteURL,
-			Logger:  logrus.New(),
+		mailClient = &tracingMailClient{
+			ctx:  ctx,
+			host: instanceConfig.SMTP.Host,
+			inner: &breakerMailClient{
+				name: "smtp " + instanceConfig.SMTP.Host,
+				inner: &mailme.Mailer{
+					Host:    instanceConfig.SMTP.Host,
+					Port:    instanceConfig.SMTP.Port,
+					User:    instanceConfig.SMTP.User,
+					Pass:    instanceConfig.SMTP.Pass,
+					From:    from,
+					BaseURL: instanceConfig.SiteURL,
+					Logger:  log,
+				},
+			},
 		}
 	}
 
@@ -3,7 +3,10 @@ package mailer
 import (
 	"testing"
 
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/sandbox"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetSiteURL(t *testing.T) {
@@ -46,3 +49,20 @@ func TestRelativeURL(t *testing.T) {
 		assert.Equal(t, c.Expected, res, c.URL)
 	}
 }
+
+func TestSandboxMailClient(t *testing.T) {
+	m := NewMailer(&conf.Configuration{SiteURL: "https://example.com", Sandbox: true}).(*TemplateMailer)
+	sandbox.Take("")
+
+	require.NoError(t, m.Mailer.Mail("user@example.com", "Confirm {{ .Email }}", "", defaultConfirmationMail, map[string]interface{}{
+		"Email":           "user@example.com",
+		"Token":           "123456",
+		"ConfirmationURL": "https://example.com/verify?token=abc",
+	}))
+	messages := sandbox.Take("user@example.com")
+	require.Len(t, messages, 1)
+	assert.Equal(t, sandbox.ChannelEmail, messages[0].Channel)
+	assert.Equal(t, "Confirm user@example.com", messages[0].Subject)
+	assert.Contains(t, messages[0].Body, "Alternatively, enter the code: 123456")
+	assert.Equal(t, "123456", messages[0].Data["Token"])
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+
+	"github.com/netlify/gotrue/sandbox"
+	"github.com/netlify/mailme"
+)
+
+// sandboxMailClient renders mail like the SMTP client, but keeps it in the
+// sandbox instead of sending it.
+type sandboxMailClient struct {
+	renderer *mailme.Mailer
+}
+
+func (m *sandboxMailClient) Mail(to, subjectTemplate, templateURL, defaultTemplate string, templateData map[string]interface{}) error {
+	if to == "" {
+		return errors.New("to field cannot be empty")
+	}
+
+	tmp, err := template.New("Subject").Parse(subjectTemplate)
+	if err != nil {
+		return err
+	}
+	subject := &bytes.Buffer{}
+	if err := tmp.Execute(subject, templateData); err != nil {
+		return err
+	}
+	body, err := m.renderer.MailBody(templateURL, defaultTemplate, templateData)
+	if err != nil {
+		return err
+	}
+
+	sandbox.Store(sandbox.Message{
+		Channel: sandbox.ChannelEmail,
+		To:      to,
+		Subject: subject.String(),
+		Body:    body,
+		Data:    templateData,
+	})
+	return nil
+}
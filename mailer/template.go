@@ -41,6 +41,10 @@ const defaultRecoveryMail = `<h2>Reset password</h2>
 <p><a href="{{ .ConfirmationURL }}">Reset password</a></p>
 <p>Alternatively, enter the code: {{ .Token }}</p>`
 
+const defaultRecoveryCodeMail = `<h2>Reset password</h2>
+
+<p>Enter the code to reset the password for your user: {{ .Token }}</p>`
+
 const defaultMagicLinkMail = `<h2>Magic Link</h2>
 
 <p>Follow this link to login:</p>
@@ -124,6 +128,25 @@ func (m *TemplateMailer) ConfirmationMail(user *models.User, otp, referrerURL st
 	)
 }
 
+// RecoveryCodeMail sends a password recovery mail with only a code, for apps
+// that can't handle the recovery link
+func (m *TemplateMailer) RecoveryCodeMail(user *models.User, otp string) error {
+	data := map[string]interface{}{
+		"SiteURL": m.Config.SiteURL,
+		"Email":   user.Email,
+		"Token":   otp,
+		"Data":    user.UserMetaData,
+	}
+
+	return m.Mailer.Mail(
+		user.GetEmail(),
+		string(withDefault(m.Config.Mailer.Subjects.RecoveryCode, "Reset Your Password")),
+		m.Config.Mailer.Templates.RecoveryCode,
+		defaultRecoveryCodeMail,
+		data,
+	)
+}
+
 // ReauthenticateMail sends a reauthentication mail to an authenticated user
 func (m *TemplateMailer) ReauthenticateMail(user *models.User, otp string) error {
 	data := map[string]interface{}{
@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// tracingMailClient traces the mail sent through an SMTP server as part of
+// the span of ctx.
+type tracingMailClient struct {
+	ctx   context.Context
+	host  string
+	inner MailClient
+}
+
+func (m *tracingMailClient) Mail(to, subjectTemplate, templateURL, defaultTemplate string, templateData map[string]interface{}) error {
+	span, _ := opentracing.StartSpanFromContext(m.ctx, "smtp.send", ext.SpanKindRPCClient)
+	defer span.Finish()
+	ext.PeerHostname.Set(span, m.host)
+
+	err := m.inner.Mail(to, subjectTemplate, templateURL, defaultTemplate, templateData)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "message", err.Error())
+	}
+	return err
+}
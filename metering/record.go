@@ -15,3 +15,88 @@ func RecordLogin(loginType string, userID, instanceID uuid.UUID) {
 		"user_id":      userID.String(),
 	}).Info("Login")
 }
+
+func RecordTokenIssued(grantType, aal, clientID, audience, subject string, instanceID uuid.UUID) {
+	logger.WithFields(logrus.Fields{
+		"action":      "token_issued",
+		"grant_type":  grantType,
+		"aal":         aal,
+		"client_id":   clientID,
+		"aud":         audience,
+		"instance_id": instanceID.String(),
+		"user_id":     subject,
+	}).Info("Token issued")
+}
+
+func RecordBlockedRequest(reason, path, ipAddress string) {
+	logger.WithFields(logrus.Fields{
+		"action":     "request_blocked",
+		"reason":     reason,
+		"path":       path,
+		"ip_address": ipAddress,
+	}).Info("Request blocked")
+}
+
+func RecordSignInAnomaly(anomaly string, userID, instanceID uuid.UUID) {
+	logger.WithFields(logrus.Fields{
+		"action":      "sign_in_anomaly",
+		"anomaly":     anomaly,
+		"instance_id": instanceID.String(),
+		"user_id":     userID.String(),
+	}).Info("Sign-in anomaly")
+}
+
+func RecordOtpLocked(challenge string, userID, instanceID uuid.UUID) {
+	logger.WithFields(logrus.Fields{
+		"action":      "otp_locked",
+		"challenge":   challenge,
+		"instance_id": instanceID.String(),
+		"user_id":     userID.String(),
+	}).Info("OTP locked")
+}
+
+func RecordCircuitBreakerState(name, state string, failures, rejected int) {
+	logger.WithFields(logrus.Fields{
+		"action":   "circuit_breaker",
+		"name":     name,
+		"state":    state,
+		"failures": failures,
+		"rejected": rejected,
+	}).Info("Circuit breaker state changed")
+}
+
+func RecordKeyCacheFetch(cache, key, reason string, hits int, err error) {
+	fields := logrus.Fields{
+		"action": "key_cache_fetch",
+		"cache":  cache,
+		"key":    key,
+		"reason": reason,
+		"hits":   hits,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	logger.WithFields(fields).Info("Provider keys fetched")
+}
+
+func RecordSmsSend(instanceID uuid.UUID, sent, blocked int, allowed bool) {
+	action := "sms_sent"
+	if !allowed {
+		action = "sms_blocked"
+	}
+	logger.WithFields(logrus.Fields{
+		"action":      action,
+		"instance_id": instanceID.String(),
+		"sent_today":  sent,
+		"blocked":     blocked,
+	}).Info("SMS send")
+}
+
+func RecordAuthEvent(event, audience string, instanceID uuid.UUID) {
+	logger.WithFields(logrus.Fields{
+		"action":      "auth_event",
+		"event":       event,
+		"aud":         audience,
+		"instance_id": instanceID.String(),
+	}).Info("Auth event")
+}
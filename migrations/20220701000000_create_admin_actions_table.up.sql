@@ -0,0 +1,16 @@
+-- adds admin_actions table for actions awaiting a second admin's approval
+
+CREATE TABLE IF NOT EXISTS auth.admin_actions (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    action varchar(64) NOT NULL,
+    target_id uuid NOT NULL,
+    requested_by varchar(255) NOT NULL,
+    approved_by varchar(255) NULL,
+    created_at timestamptz NULL,
+    expires_at timestamptz NOT NULL,
+    approved_at timestamptz NULL,
+    CONSTRAINT admin_actions_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS admin_actions_instance_id_idx ON auth.admin_actions USING btree (instance_id);
+COMMENT ON TABLE auth.admin_actions is 'Auth: Stores destructive admin actions awaiting approval.';
@@ -0,0 +1,38 @@
+-- adds oauth_clients and oauth_authorizations tables for acting as an OAuth 2.0 / OIDC provider
+
+CREATE TABLE IF NOT EXISTS auth.oauth_clients (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    client_secret_hash varchar(255) NULL,
+    name varchar(255) NOT NULL,
+    redirect_uris jsonb NOT NULL,
+    scopes jsonb NOT NULL,
+    public boolean NOT NULL DEFAULT false,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    CONSTRAINT oauth_clients_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS oauth_clients_instance_id_idx ON auth.oauth_clients USING btree (instance_id);
+COMMENT ON TABLE auth.oauth_clients is 'Auth: Stores third-party applications allowed to sign users in.';
+
+CREATE TABLE IF NOT EXISTS auth.oauth_authorizations (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    client_id uuid NOT NULL REFERENCES auth.oauth_clients (id) ON DELETE CASCADE,
+    user_id uuid NULL,
+    redirect_uri text NOT NULL,
+    scope text NOT NULL,
+    state text NULL,
+    nonce text NULL,
+    code_challenge varchar(128) NULL,
+    code_challenge_method varchar(10) NULL,
+    code_hash varchar(64) NULL,
+    created_at timestamptz NULL,
+    expires_at timestamptz NOT NULL,
+    approved_at timestamptz NULL,
+    used_at timestamptz NULL,
+    CONSTRAINT oauth_authorizations_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS oauth_authorizations_instance_id_idx ON auth.oauth_authorizations USING btree (instance_id);
+CREATE UNIQUE INDEX IF NOT EXISTS oauth_authorizations_code_hash_idx ON auth.oauth_authorizations USING btree (code_hash);
+COMMENT ON TABLE auth.oauth_authorizations is 'Auth: Stores authorization requests and the codes issued for them.';
@@ -0,0 +1,5 @@
+-- adds token endpoint authentication methods to oauth_clients
+
+ALTER TABLE auth.oauth_clients ADD COLUMN IF NOT EXISTS token_endpoint_auth_method varchar(64) NULL;
+ALTER TABLE auth.oauth_clients ADD COLUMN IF NOT EXISTS jwks jsonb NULL;
+ALTER TABLE auth.oauth_clients ADD COLUMN IF NOT EXISTS tls_client_auth_subject_dn text NULL;
@@ -0,0 +1,12 @@
+-- adds used_nonces table for single-use values shared by all GoTrue instances
+
+CREATE TABLE IF NOT EXISTS auth.used_nonces (
+    instance_id uuid NOT NULL,
+    kind varchar(64) NOT NULL,
+    nonce varchar(255) NOT NULL,
+    created_at timestamptz NULL,
+    expires_at timestamptz NOT NULL,
+    CONSTRAINT used_nonces_pkey PRIMARY KEY (instance_id, kind, nonce)
+);
+CREATE INDEX IF NOT EXISTS used_nonces_expires_at_idx ON auth.used_nonces USING btree (expires_at);
+COMMENT ON TABLE auth.used_nonces is 'Auth: Stores consumed single-use values, such as OAuth states, until they expire.';
@@ -0,0 +1,3 @@
+-- records whether the client sent the redirect_uri with the authorization request
+
+ALTER TABLE auth.oauth_authorizations ADD COLUMN IF NOT EXISTS redirect_uri_provided boolean NOT NULL DEFAULT false;
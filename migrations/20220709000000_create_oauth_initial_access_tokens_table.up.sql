@@ -0,0 +1,13 @@
+-- adds oauth_initial_access_tokens table so initial access tokens can be revoked and used only once
+
+CREATE TABLE IF NOT EXISTS auth.oauth_initial_access_tokens (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    created_at timestamptz NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz NULL,
+    revoked_at timestamptz NULL,
+    CONSTRAINT oauth_initial_access_tokens_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS oauth_initial_access_tokens_instance_id_idx ON auth.oauth_initial_access_tokens USING btree (instance_id);
+COMMENT ON TABLE auth.oauth_initial_access_tokens is 'Auth: Stores the initial access tokens issued for OAuth client registration.';
@@ -0,0 +1,3 @@
+-- adds the thumbprint of the DPoP key a refresh token is bound to
+
+ALTER TABLE auth.refresh_tokens ADD COLUMN IF NOT EXISTS dpop_jkt varchar(255) NULL;
@@ -0,0 +1,15 @@
+-- adds service_accounts table for machine users authenticating with client credentials
+
+CREATE TABLE IF NOT EXISTS auth.service_accounts (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    name varchar(255) NOT NULL,
+    role varchar(255) NOT NULL,
+    secret_hash varchar(255) NOT NULL,
+    last_used_at timestamptz NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    CONSTRAINT service_accounts_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS service_accounts_instance_id_idx ON auth.service_accounts USING btree (instance_id);
+COMMENT ON TABLE auth.service_accounts is 'Auth: Stores machine users used by backend jobs and services.';
@@ -0,0 +1,7 @@
+-- adds when an unconfirmed user was reminded to confirm and when it was flagged as expired
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS confirmation_reminder_sent_at timestamptz NULL,
+ADD COLUMN IF NOT EXISTS unconfirmed_expired_at timestamptz NULL;
+
+CREATE INDEX IF NOT EXISTS users_instance_id_created_at_idx ON auth.users USING btree (instance_id, created_at);
@@ -0,0 +1,4 @@
+-- adds the parameters of admin actions that need more than a target, like the source user of a merge
+
+ALTER TABLE auth.admin_actions
+ADD COLUMN IF NOT EXISTS params jsonb NULL;
@@ -0,0 +1,6 @@
+-- adds an id of the user in another system, unique per instance
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS external_id varchar(255) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_instance_id_external_id_idx ON auth.users USING btree (instance_id, external_id) WHERE external_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- adds the fingerprint of the client a refresh token is bound to
+
+ALTER TABLE auth.refresh_tokens ADD COLUMN IF NOT EXISTS client_fingerprint varchar(64) NULL;
@@ -0,0 +1,15 @@
+-- adds security_events table for sign-ins and the anomalies detected with them
+
+CREATE TABLE IF NOT EXISTS auth.security_events (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    type varchar(64) NOT NULL,
+    ip_address varchar(64) NOT NULL DEFAULT '',
+    country varchar(8) NULL,
+    payload jsonb NULL,
+    created_at timestamptz NULL,
+    CONSTRAINT security_events_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS security_events_instance_id_user_id_idx ON auth.security_events USING btree (instance_id, user_id, created_at);
+COMMENT ON TABLE auth.security_events is 'Auth: Stores sign-ins and the anomalies detected with them.';
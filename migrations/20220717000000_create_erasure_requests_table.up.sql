@@ -0,0 +1,18 @@
+-- adds erasure_requests table for users asking to have their account erased
+
+CREATE TABLE IF NOT EXISTS auth.erasure_requests (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    status varchar(32) NOT NULL,
+    action varchar(32) NULL,
+    scheduled_for timestamptz NOT NULL,
+    completed_at timestamptz NULL,
+    cancelled_at timestamptz NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    CONSTRAINT erasure_requests_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS erasure_requests_instance_id_status_idx ON auth.erasure_requests USING btree (instance_id, status, scheduled_for);
+CREATE INDEX IF NOT EXISTS erasure_requests_user_id_idx ON auth.erasure_requests USING btree (user_id);
+COMMENT ON TABLE auth.erasure_requests is 'Auth: Stores requests of users to erase their account and their status.';
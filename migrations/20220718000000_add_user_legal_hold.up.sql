@@ -0,0 +1,4 @@
+-- adds when a user was placed on legal hold, which blocks deleting or anonymizing the user
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS legal_hold_at timestamptz NULL;
@@ -0,0 +1,12 @@
+-- adds otp_attempts table counting failed verifications of the codes sent to users
+
+CREATE TABLE IF NOT EXISTS auth.otp_attempts (
+    instance_id uuid NULL,
+    user_id uuid NOT NULL,
+    challenge varchar(32) NOT NULL,
+    sent_at timestamptz NOT NULL,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    updated_at timestamptz NULL,
+    CONSTRAINT otp_attempts_pkey PRIMARY KEY (user_id, challenge)
+);
+COMMENT ON TABLE auth.otp_attempts is 'Auth: Counts failed verifications of the codes sent to users.';
@@ -0,0 +1,12 @@
+-- adds sms_usage table counting the SMS sent by each instance per day
+
+CREATE TABLE IF NOT EXISTS auth.sms_usage (
+    instance_id uuid NOT NULL,
+    day date NOT NULL,
+    sent integer NOT NULL DEFAULT 0,
+    blocked integer NOT NULL DEFAULT 0,
+    last_allowed boolean NOT NULL DEFAULT true,
+    updated_at timestamptz NULL,
+    CONSTRAINT sms_usage_pkey PRIMARY KEY (instance_id, day)
+);
+COMMENT ON TABLE auth.sms_usage is 'Auth: Counts the SMS sent, and blocked by the daily limit, per instance and day.';
@@ -0,0 +1,19 @@
+-- adds flow_states table for the PKCE flow of external providers and magic links
+
+CREATE TABLE IF NOT EXISTS auth.flow_states (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    user_id uuid NULL,
+    auth_code_hash varchar(64) NULL,
+    code_challenge varchar(128) NOT NULL,
+    code_challenge_method varchar(10) NOT NULL,
+    provider_type text NOT NULL,
+    authentication_method text NOT NULL,
+    created_at timestamptz NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz NULL,
+    CONSTRAINT flow_states_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS flow_states_instance_id_user_id_idx ON auth.flow_states USING btree (instance_id, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS flow_states_auth_code_hash_idx ON auth.flow_states USING btree (auth_code_hash);
+COMMENT ON TABLE auth.flow_states is 'Auth: Stores the code challenges of PKCE sign-ins and the authorization codes issued for them.';
@@ -0,0 +1,4 @@
+-- adds the roles granted to a user on top of its role
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS roles jsonb NOT NULL DEFAULT '[]'::jsonb;
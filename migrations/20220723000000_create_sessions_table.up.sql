@@ -0,0 +1,20 @@
+-- adds sessions table grouping the refresh tokens of a sign-in, so users can list and revoke their sessions
+
+CREATE TABLE IF NOT EXISTS auth.sessions (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    user_agent text NULL,
+    ip_address varchar(64) NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    last_used_at timestamptz NULL,
+    CONSTRAINT sessions_pkey PRIMARY KEY (id),
+    CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES auth.users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS sessions_instance_id_user_id_idx ON auth.sessions USING btree (instance_id, user_id);
+COMMENT ON TABLE auth.sessions is 'Auth: Stores the sign-ins of users, with the device and address they were last used from.';
+
+ALTER TABLE auth.refresh_tokens ADD COLUMN IF NOT EXISTS session_id uuid NULL;
+ALTER TABLE auth.refresh_tokens ADD CONSTRAINT refresh_tokens_session_id_fkey FOREIGN KEY (session_id) REFERENCES auth.sessions(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON auth.refresh_tokens USING btree (session_id);
@@ -0,0 +1,4 @@
+-- adds anonymous users, who signed in without credentials
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS is_anonymous boolean NOT NULL DEFAULT false;
@@ -0,0 +1,34 @@
+-- adds sso_providers and sso_domains tables for SAML and OIDC enterprise connections managed with the admin API
+
+CREATE TABLE IF NOT EXISTS auth.sso_providers (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    type varchar(16) NOT NULL,
+    name varchar(255) NOT NULL,
+    metadata_xml text NULL,
+    metadata_url text NULL,
+    entity_id text NULL,
+    issuer text NULL,
+    client_id text NULL,
+    client_secret text NULL,
+    attribute_mapping jsonb NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    CONSTRAINT sso_providers_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS sso_providers_instance_id_idx ON auth.sso_providers USING btree (instance_id);
+COMMENT ON TABLE auth.sso_providers is 'Auth: Stores the SAML and OIDC identity providers users can sign in with.';
+
+CREATE TABLE IF NOT EXISTS auth.sso_domains (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    sso_provider_id uuid NOT NULL,
+    domain varchar(255) NOT NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    CONSTRAINT sso_domains_pkey PRIMARY KEY (id),
+    CONSTRAINT sso_domains_sso_provider_id_fkey FOREIGN KEY (sso_provider_id) REFERENCES auth.sso_providers(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS sso_domains_sso_provider_id_idx ON auth.sso_domains USING btree (sso_provider_id);
+CREATE UNIQUE INDEX IF NOT EXISTS sso_domains_instance_id_domain_idx ON auth.sso_domains USING btree (coalesce(instance_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(domain));
+COMMENT ON TABLE auth.sso_domains is 'Auth: Maps the email domains of users to the SSO provider they sign in with.';
@@ -0,0 +1,4 @@
+-- records why a user is banned, by an admin or automatically after policy violations
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS ban_reason varchar(255) NULL DEFAULT NULL;
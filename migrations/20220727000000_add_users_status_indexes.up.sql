@@ -0,0 +1,5 @@
+-- adds indexes listing banned, locked and unconfirmed users
+
+CREATE INDEX IF NOT EXISTS users_instance_id_banned_until_idx ON auth.users USING btree (instance_id, banned_until) WHERE banned_until IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_instance_id_unconfirmed_idx ON auth.users USING btree (instance_id) WHERE email_confirmed_at IS NULL AND phone_confirmed_at IS NULL;
+CREATE INDEX IF NOT EXISTS otp_attempts_instance_id_failed_attempts_idx ON auth.otp_attempts USING btree (instance_id, failed_attempts);
@@ -0,0 +1,4 @@
+-- records when a user was shadow banned, which marks the tokens issued to the user
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS shadow_banned_at timestamptz NULL DEFAULT NULL;
@@ -0,0 +1,16 @@
+-- adds failed_logins table counting sign-ins with wrong passwords per user and IP address
+
+CREATE TABLE IF NOT EXISTS auth.failed_logins (
+    instance_id uuid NULL,
+    id uuid NOT NULL,
+    user_id uuid NULL,
+    ip_address varchar(64) NOT NULL DEFAULT '',
+    created_at timestamptz NULL,
+    CONSTRAINT failed_logins_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS failed_logins_instance_id_user_id_idx ON auth.failed_logins USING btree (instance_id, user_id, created_at);
+CREATE INDEX IF NOT EXISTS failed_logins_instance_id_ip_address_idx ON auth.failed_logins USING btree (instance_id, ip_address, created_at);
+COMMENT ON TABLE auth.failed_logins is 'Auth: Counts sign-ins with wrong passwords to lock accounts.';
+
+ALTER TABLE auth.users
+ADD COLUMN IF NOT EXISTS locked_until timestamptz NULL DEFAULT NULL;
@@ -0,0 +1,4 @@
+-- records when a refresh token was reused after it was swapped for another
+
+ALTER TABLE auth.refresh_tokens
+ADD COLUMN IF NOT EXISTS reused_at timestamptz NULL DEFAULT NULL;
@@ -0,0 +1,11 @@
+-- adds signed_out_tokens table keeping why the refresh tokens of ended sessions stopped working
+
+CREATE TABLE IF NOT EXISTS auth.signed_out_tokens (
+    instance_id uuid NULL,
+    token varchar(255) NOT NULL,
+    reason varchar(64) NOT NULL,
+    created_at timestamptz NULL,
+    CONSTRAINT signed_out_tokens_pkey PRIMARY KEY (token)
+);
+CREATE INDEX IF NOT EXISTS signed_out_tokens_instance_id_created_at_idx ON auth.signed_out_tokens USING btree (instance_id, created_at);
+COMMENT ON TABLE auth.signed_out_tokens is 'Auth: Tells clients refreshing the tokens of ended sessions why they were signed out.';
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+type AdminActionType string
+
+const (
+	AdminActionUserDelete    AdminActionType = "user_delete"
+	AdminActionUserAnonymize AdminActionType = "user_anonymize"
+	// AdminActionLogoutAll signs out every user of the instance, it has no target.
+	AdminActionLogoutAll AdminActionType = "logout_all"
+	// AdminActionUserMerge merges the user in params onto the target user.
+	AdminActionUserMerge AdminActionType = "user_merge"
+)
+
+// AdminAction is a destructive admin action that needs a second admin's approval before it is carried out.
+type AdminAction struct {
+	InstanceID  uuid.UUID          `json:"-" db:"instance_id"`
+	ID          uuid.UUID          `json:"id" db:"id"`
+	Action      AdminActionType    `json:"action" db:"action"`
+	TargetID    uuid.UUID          `json:"target_id" db:"target_id"`
+	Params      JSONMap            `json:"params,omitempty" db:"params"`
+	RequestedBy string             `json:"requested_by" db:"requested_by"`
+	ApprovedBy  storage.NullString `json:"approved_by,omitempty" db:"approved_by"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time          `json:"expires_at" db:"expires_at"`
+	ApprovedAt  *time.Time         `json:"approved_at,omitempty" db:"approved_at"`
+}
+
+func (AdminAction) TableName() string {
+	tableName := "admin_actions"
+	return tableName
+}
+
+// NewAdminAction creates a pending admin action which expires after ttl.
+func NewAdminAction(instanceID uuid.UUID, action AdminActionType, targetID uuid.UUID, params map[string]interface{}, requestedBy string, ttl time.Duration) (*AdminAction, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &AdminAction{
+		InstanceID:  instanceID,
+		ID:          id,
+		Action:      action,
+		TargetID:    targetID,
+		Params:      params,
+		RequestedBy: requestedBy,
+		ExpiresAt:   time.Now().Add(ttl),
+	}, nil
+}
+
+// IsPending returns true if the action has neither been approved nor expired.
+func (a *AdminAction) IsPending() bool {
+	return a.ApprovedAt == nil && time.Now().Before(a.ExpiresAt)
+}
+
+// Approve marks the action as approved by the given admin. It returns false
+// if the action was approved concurrently or has expired in the meantime.
+func (a *AdminAction) Approve(tx *storage.Connection, approvedBy string) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: AdminAction{}}).TableName()+" SET approved_by = ?, approved_at = ? WHERE id = ? AND approved_at IS NULL AND expires_at > ?", approvedBy, now, a.ID, now).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error approving admin action")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	a.ApprovedBy = storage.NullString(approvedBy)
+	a.ApprovedAt = &now
+	return true, nil
+}
+
+// FindAdminAction finds an admin action by its id.
+func FindAdminAction(tx *storage.Connection, instanceID, id uuid.UUID) (*AdminAction, error) {
+	action := &AdminAction{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(action); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, AdminActionNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding admin action")
+	}
+	return action, nil
+}
+
+// FindPendingAdminActions returns all admin actions that are still awaiting approval.
+func FindPendingAdminActions(tx *storage.Connection, instanceID uuid.UUID) ([]*AdminAction, error) {
+	actions := []*AdminAction{}
+	if err := tx.Q().Where("instance_id = ? AND approved_at IS NULL AND expires_at > ?", instanceID, time.Now()).Order("created_at desc").All(&actions); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return actions, nil
+		}
+		return nil, errors.Wrap(err, "error finding admin actions")
+	}
+	return actions, nil
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gobuffalo/pop/v5"
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/logger"
 	"github.com/netlify/gotrue/storage"
@@ -17,19 +19,62 @@ type AuditAction string
 type auditLogType string
 
 const (
-	LoginAction                     AuditAction = "login"
-	LogoutAction                    AuditAction = "logout"
-	InviteAcceptedAction            AuditAction = "invite_accepted"
-	UserSignedUpAction              AuditAction = "user_signedup"
-	UserInvitedAction               AuditAction = "user_invited"
-	UserDeletedAction               AuditAction = "user_deleted"
-	UserModifiedAction              AuditAction = "user_modified"
-	UserRecoveryRequestedAction     AuditAction = "user_recovery_requested"
-	UserReauthenticateAction        AuditAction = "user_reauthenticate_requested"
-	UserConfirmationRequestedAction AuditAction = "user_confirmation_requested"
-	UserRepeatedSignUpAction        AuditAction = "user_repeated_signup"
-	TokenRevokedAction              AuditAction = "token_revoked"
-	TokenRefreshedAction            AuditAction = "token_refreshed"
+	LoginAction                          AuditAction = "login"
+	LogoutAction                         AuditAction = "logout"
+	InviteAcceptedAction                 AuditAction = "invite_accepted"
+	UserSignedUpAction                   AuditAction = "user_signedup"
+	UserInvitedAction                    AuditAction = "user_invited"
+	UserDeletedAction                    AuditAction = "user_deleted"
+	UserAnonymizedAction                 AuditAction = "user_anonymized"
+	UsersMergedAction                    AuditAction = "users_merged"
+	UsersImportedAction                  AuditAction = "users_imported"
+	UserErasureRequestedAction           AuditAction = "user_erasure_requested"
+	UserErasureCancelledAction           AuditAction = "user_erasure_cancelled"
+	UserErasedAction                     AuditAction = "user_erased"
+	UserLegalHoldPlacedAction            AuditAction = "user_legal_hold_placed"
+	UserLegalHoldReleasedAction          AuditAction = "user_legal_hold_released"
+	UserShadowBannedAction               AuditAction = "user_shadow_banned"
+	UserShadowBanLiftedAction            AuditAction = "user_shadow_ban_lifted"
+	UserViewedAction                     AuditAction = "user_viewed"
+	UsersListedAction                    AuditAction = "users_listed"
+	OtpLockedAction                      AuditAction = "otp_locked"
+	UserAutoBannedAction                 AuditAction = "user_auto_banned"
+	UserLockedAction                     AuditAction = "user_locked"
+	AllUsersSignedOutAction              AuditAction = "all_users_signed_out"
+	UserModifiedAction                   AuditAction = "user_modified"
+	UserUpgradedAction                   AuditAction = "user_upgraded"
+	IdentityLinkedAction                 AuditAction = "identity_linked"
+	IdentityUnlinkedAction               AuditAction = "identity_unlinked"
+	UserRolesGrantedAction               AuditAction = "user_roles_granted"
+	UserRolesRevokedAction               AuditAction = "user_roles_revoked"
+	UserRecoveryRequestedAction          AuditAction = "user_recovery_requested"
+	UserReauthenticateAction             AuditAction = "user_reauthenticate_requested"
+	UserConfirmationRequestedAction      AuditAction = "user_confirmation_requested"
+	UserRepeatedSignUpAction             AuditAction = "user_repeated_signup"
+	UnconfirmedUserExpiredAction         AuditAction = "user_unconfirmed_expired"
+	TokenRevokedAction                   AuditAction = "token_revoked"
+	TokenRefreshedAction                 AuditAction = "token_refreshed"
+	TokenExchangedAction                 AuditAction = "token_exchanged"
+	SessionRevokedAction                 AuditAction = "session_revoked"
+	UserSignedOutAction                  AuditAction = "user_signed_out"
+	AdminActionRequestedAction           AuditAction = "admin_action_requested"
+	AdminActionApprovedAction            AuditAction = "admin_action_approved"
+	RiskAssessedAction                   AuditAction = "risk_assessed"
+	OAuthClientCreatedAction             AuditAction = "oauth_client_created"
+	OAuthClientUpdatedAction             AuditAction = "oauth_client_updated"
+	OAuthClientDeletedAction             AuditAction = "oauth_client_deleted"
+	OAuthInitialAccessTokenIssuedAction  AuditAction = "oauth_initial_access_token_issued"
+	OAuthInitialAccessTokenRevokedAction AuditAction = "oauth_initial_access_token_revoked"
+	OAuthConsentGrantedAction            AuditAction = "oauth_consent_granted"
+	ServiceAccountCreatedAction          AuditAction = "service_account_created"
+	ServiceAccountUpdatedAction          AuditAction = "service_account_updated"
+	ServiceAccountDeletedAction          AuditAction = "service_account_deleted"
+	ServiceAccountTokenIssuedAction      AuditAction = "service_account_token_issued"
+	SSOProviderCreatedAction             AuditAction = "sso_provider_created"
+	SSOProviderUpdatedAction             AuditAction = "sso_provider_updated"
+	SSOProviderDeletedAction             AuditAction = "sso_provider_deleted"
+	LifecycleEventFailedAction           AuditAction = "lifecycle_event_failed"
+	SessionsMigratedAction               AuditAction = "sessions_migrated"
 
 	account auditLogType = "account"
 	team    auditLogType = "team"
@@ -38,18 +83,70 @@ const (
 )
 
 var ActionLogTypeMap = map[AuditAction]auditLogType{
-	LoginAction:                     account,
-	LogoutAction:                    account,
-	InviteAcceptedAction:            account,
-	UserSignedUpAction:              team,
-	UserInvitedAction:               team,
-	UserDeletedAction:               team,
-	TokenRevokedAction:              token,
-	TokenRefreshedAction:            token,
-	UserModifiedAction:              user,
-	UserRecoveryRequestedAction:     user,
-	UserConfirmationRequestedAction: user,
-	UserRepeatedSignUpAction:        user,
+	LoginAction:                          account,
+	LogoutAction:                         account,
+	InviteAcceptedAction:                 account,
+	UserSignedUpAction:                   team,
+	UserInvitedAction:                    team,
+	UserDeletedAction:                    team,
+	UserAnonymizedAction:                 team,
+	UsersMergedAction:                    team,
+	UsersImportedAction:                  team,
+	UserErasureRequestedAction:           account,
+	UserErasureCancelledAction:           account,
+	UserErasedAction:                     team,
+	UserLegalHoldPlacedAction:            team,
+	UserLegalHoldReleasedAction:          team,
+	UserShadowBannedAction:               team,
+	UserShadowBanLiftedAction:            team,
+	UserViewedAction:                     team,
+	UsersListedAction:                    team,
+	OtpLockedAction:                      account,
+	UserAutoBannedAction:                 account,
+	UserLockedAction:                     account,
+	AllUsersSignedOutAction:              team,
+	AdminActionRequestedAction:           team,
+	AdminActionApprovedAction:            team,
+	TokenRevokedAction:                   token,
+	TokenRefreshedAction:                 token,
+	TokenExchangedAction:                 token,
+	SessionRevokedAction:                 token,
+	UserSignedOutAction:                  account,
+	UserModifiedAction:                   user,
+	UserUpgradedAction:                   account,
+	IdentityLinkedAction:                 account,
+	IdentityUnlinkedAction:               account,
+	UserRolesGrantedAction:               user,
+	UserRolesRevokedAction:               user,
+	UserRecoveryRequestedAction:          user,
+	UserConfirmationRequestedAction:      user,
+	UserRepeatedSignUpAction:             user,
+	UnconfirmedUserExpiredAction:         user,
+	RiskAssessedAction:                   account,
+	OAuthClientCreatedAction:             team,
+	OAuthClientUpdatedAction:             team,
+	OAuthClientDeletedAction:             team,
+	OAuthInitialAccessTokenIssuedAction:  team,
+	OAuthInitialAccessTokenRevokedAction: team,
+	OAuthConsentGrantedAction:            account,
+	ServiceAccountCreatedAction:          team,
+	ServiceAccountUpdatedAction:          team,
+	ServiceAccountDeletedAction:          team,
+	ServiceAccountTokenIssuedAction:      token,
+	SSOProviderCreatedAction:             team,
+	SSOProviderUpdatedAction:             team,
+	SSOProviderDeletedAction:             team,
+	LifecycleEventFailedAction:           team,
+	SessionsMigratedAction:               team,
+}
+
+// EmailAuditActions are the actions recorded when an email is sent to the
+// user, which are kept for RETENTION_EMAIL_RECORD_DAYS.
+var EmailAuditActions = []AuditAction{
+	UserInvitedAction,
+	UserRecoveryRequestedAction,
+	UserConfirmationRequestedAction,
+	UserReauthenticateAction,
 }
 
 // AuditLogEntry is the database model for audit log entries.
@@ -91,10 +188,6 @@ func NewAuditLogEntry(r *http.Request, tx *storage.Connection, instanceID uuid.U
 		IPAddress:  ipAddress,
 	}
 
-	logger.LogEntrySetFields(r, logrus.Fields{
-		"auth_event": logrus.Fields(payload),
-	})
-
 	if name, ok := actor.UserMetaData["full_name"]; ok {
 		l.Payload["actor_name"] = name
 	}
@@ -103,6 +196,19 @@ func NewAuditLogEntry(r *http.Request, tx *storage.Connection, instanceID uuid.U
 		l.Payload["traits"] = traits
 	}
 
+	// background jobs record entries outside of a request
+	if r != nil {
+		logger.LogEntrySetFields(r, logrus.Fields{
+			"auth_event": logrus.Fields(payload),
+		})
+		if requestID, ok := r.Context().Value(logger.RequestIDKey).(string); ok && requestID != "" {
+			l.Payload["request_id"] = requestID
+		}
+		if traceID, ok := r.Context().Value(logger.TraceIDKey).(string); ok && traceID != "" {
+			l.Payload["trace_id"] = traceID
+		}
+	}
+
 	if err := tx.Create(&l); err != nil {
 		return errors.Wrap(err, "Database error creating audit log entry")
 	}
@@ -143,3 +249,66 @@ func FindAuditLogEntries(tx *storage.Connection, instanceID uuid.UUID, filterCol
 
 	return logs, err
 }
+
+// AuditLogFilter narrows down the audit log entries of a user. Zero fields
+// don't filter.
+type AuditLogFilter struct {
+	Action  string
+	LogType string
+	Since   time.Time
+	Until   time.Time
+}
+
+// FindUserAuditLogEntries returns the audit log entries where user is the
+// actor or the target, newest first.
+func FindUserAuditLogEntries(tx *storage.Connection, user *User, filter AuditLogFilter, pageParams *Pagination) ([]*AuditLogEntry, error) {
+	userID := user.ID.String()
+	q := tx.Q().Order("created_at desc").
+		Where("instance_id = ?", user.InstanceID).
+		Where("(payload->>'actor_id' = ? OR payload->'traits'->>'user_id' = ?)", userID, userID)
+
+	if filter.Action != "" {
+		q = q.Where("payload->>'action' = ?", filter.Action)
+	}
+	if filter.LogType != "" {
+		q = q.Where("payload->>'log_type' = ?", filter.LogType)
+	}
+	if !filter.Since.IsZero() {
+		q = q.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		q = q.Where("created_at < ?", filter.Until)
+	}
+
+	logs := []*AuditLogEntry{}
+	var err error
+	if pageParams != nil {
+		err = q.Paginate(int(pageParams.Page), int(pageParams.PerPage)).All(&logs)
+		pageParams.Count = uint64(q.Paginator.TotalEntriesSize)
+	} else {
+		err = q.All(&logs)
+	}
+
+	return logs, errors.Wrap(err, "error finding user audit log entries")
+}
+
+// DeleteAuditLogEntriesBefore deletes up to limit entries created before
+// cutoff, either only the ones recording emails or all others.
+func DeleteAuditLogEntriesBefore(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, emails bool, limit int) (int, error) {
+	placeholders := make([]string, len(EmailAuditActions))
+	args := []interface{}{instanceID, cutoff}
+	for i, action := range EmailAuditActions {
+		placeholders[i] = "?"
+		args = append(args, string(action))
+	}
+	in := "IN"
+	if !emails {
+		in = "NOT IN"
+	}
+	args = append(args, limit)
+
+	table := (&pop.Model{Value: AuditLogEntry{}}).TableName()
+	count, err := tx.RawQuery("DELETE FROM "+table+" WHERE id IN (SELECT id FROM "+table+
+		" WHERE instance_id = ? AND created_at < ? AND coalesce(payload->>'action', '') "+in+" ("+strings.Join(placeholders, ", ")+") LIMIT ?)", args...).ExecWithCount()
+	return count, errors.Wrap(err, "error deleting audit log entries")
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// CallClaimsFunction calls the Postgres function with input as its jsonb
+// argument and returns the JSON object it returned. The function name must
+// already be validated, as it can't be passed as a query parameter.
+func CallClaimsFunction(tx *storage.Connection, function string, input interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing claims function input")
+	}
+
+	result := struct {
+		Output JSONMap `db:"output"`
+	}{Output: JSONMap{}}
+	if err := tx.RawQuery("SELECT "+function+"(?::jsonb) AS output", string(data)).First(&result); err != nil {
+		return nil, errors.Wrap(err, "error calling claims function")
+	}
+	return result.Output, nil
+}
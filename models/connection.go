@@ -41,6 +41,54 @@ func TruncateAll(conn *storage.Connection) error {
 		if err := tx.RawQuery("delete from " + (&pop.Model{Value: AuditLogEntry{}}).TableName()).Exec(); err != nil {
 			return err
 		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: AdminAction{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: OAuthAuthorization{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: OAuthClient{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: OAuthInitialAccessToken{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: ServiceAccount{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: UsedNonce{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: SecurityEvent{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: ErasureRequest{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: OtpAttempt{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: FailedLogin{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: SignedOutToken{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: SmsUsage{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: FlowState{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: Session{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: SSODomain{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("delete from " + (&pop.Model{Value: SSOProvider{}}).TableName()).Exec(); err != nil {
+			return err
+		}
 		return tx.RawQuery("delete from " + (&pop.Model{Value: Instance{}}).TableName()).Exec()
 	})
 }
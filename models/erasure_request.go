@@ -0,0 +1,140 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+type ErasureStatus string
+
+const (
+	// ErasureScheduled requests are carried out once their waiting period is over.
+	ErasureScheduled ErasureStatus = "scheduled"
+	ErasureCompleted ErasureStatus = "completed"
+	ErasureCancelled ErasureStatus = "cancelled"
+)
+
+// ErasureRequest is a request of a user to erase their account. It is kept
+// after the user is erased, so admins can tell the erasure was carried out.
+type ErasureRequest struct {
+	InstanceID   uuid.UUID          `json:"-" db:"instance_id"`
+	ID           uuid.UUID          `json:"id" db:"id"`
+	UserID       uuid.UUID          `json:"user_id" db:"user_id"`
+	Status       ErasureStatus      `json:"status" db:"status"`
+	Action       storage.NullString `json:"action,omitempty" db:"action"`
+	ScheduledFor time.Time          `json:"scheduled_for" db:"scheduled_for"`
+	CompletedAt  *time.Time         `json:"completed_at,omitempty" db:"completed_at"`
+	CancelledAt  *time.Time         `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CreatedAt    time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+func (ErasureRequest) TableName() string {
+	tableName := "erasure_requests"
+	return tableName
+}
+
+// NewErasureRequest creates an erasure request of user that is carried out
+// after waitingPeriod.
+func NewErasureRequest(user *User, waitingPeriod time.Duration) (*ErasureRequest, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &ErasureRequest{
+		InstanceID:   user.InstanceID,
+		ID:           id,
+		UserID:       user.ID,
+		Status:       ErasureScheduled,
+		ScheduledFor: time.Now().Add(waitingPeriod),
+	}, nil
+}
+
+// Complete marks the request as carried out with action. It returns false if
+// the request was completed or cancelled concurrently.
+func (e *ErasureRequest) Complete(tx *storage.Connection, action string) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: ErasureRequest{}}).TableName()+" SET status = ?, action = ?, completed_at = ?, updated_at = ? WHERE id = ? AND status = ?", ErasureCompleted, action, now, now, e.ID, ErasureScheduled).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error completing erasure request")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	e.Status = ErasureCompleted
+	e.Action = storage.NullString(action)
+	e.CompletedAt = &now
+	return true, nil
+}
+
+// Cancel cancels the request. It returns false if the request was completed
+// or cancelled concurrently.
+func (e *ErasureRequest) Cancel(tx *storage.Connection) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: ErasureRequest{}}).TableName()+" SET status = ?, cancelled_at = ?, updated_at = ? WHERE id = ? AND status = ?", ErasureCancelled, now, now, e.ID, ErasureScheduled).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error cancelling erasure request")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	e.Status = ErasureCancelled
+	e.CancelledAt = &now
+	return true, nil
+}
+
+// FindScheduledErasureRequest finds the scheduled erasure request of user.
+func FindScheduledErasureRequest(tx *storage.Connection, user *User) (*ErasureRequest, error) {
+	request := &ErasureRequest{}
+	if err := tx.Q().Where("instance_id = ? AND user_id = ? AND status = ?", user.InstanceID, user.ID, ErasureScheduled).First(request); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErasureRequestNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding erasure request")
+	}
+	return request, nil
+}
+
+// FindDueErasureRequests finds up to limit scheduled requests whose waiting
+// period is over. Requests of users on legal hold stay scheduled until the
+// hold is released.
+func FindDueErasureRequests(tx *storage.Connection, instanceID uuid.UUID, limit int) ([]*ErasureRequest, error) {
+	requests := []*ErasureRequest{}
+	usersTable := (&pop.Model{Value: User{}}).TableName()
+	err := tx.Q().Where("instance_id = ? AND status = ? AND scheduled_for <= ?", instanceID, ErasureScheduled, time.Now()).
+		Where("NOT EXISTS (SELECT 1 FROM " + usersTable + " u WHERE u.id = erasure_requests.user_id AND u.legal_hold_at IS NOT NULL)").
+		Order("scheduled_for asc").Limit(limit).All(&requests)
+	return requests, errors.Wrap(err, "error finding due erasure requests")
+}
+
+// FindErasureRequests returns the erasure requests of an instance, newest
+// first, optionally only the ones of a user or with a status.
+func FindErasureRequests(tx *storage.Connection, instanceID uuid.UUID, userID uuid.UUID, status ErasureStatus, pageParams *Pagination) ([]*ErasureRequest, error) {
+	q := tx.Q().Where("instance_id = ?", instanceID)
+	if userID != uuid.Nil {
+		q = q.Where("user_id = ?", userID)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	q = q.Order("created_at desc")
+
+	requests := []*ErasureRequest{}
+	var err error
+	if pageParams != nil {
+		err = q.Paginate(int(pageParams.Page), int(pageParams.PerPage)).All(&requests)
+		pageParams.Count = uint64(q.Paginator.TotalEntriesSize)
+	} else {
+		err = q.All(&requests)
+	}
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "error finding erasure requests")
+	}
+	return requests, nil
+}
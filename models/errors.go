@@ -15,6 +15,24 @@ func IsNotFoundError(err error) bool {
 		return true
 	case IdentityNotFoundError:
 		return true
+	case AdminActionNotFoundError:
+		return true
+	case OAuthClientNotFoundError:
+		return true
+	case OAuthAuthorizationNotFoundError:
+		return true
+	case OAuthInitialAccessTokenNotFoundError:
+		return true
+	case ServiceAccountNotFoundError:
+		return true
+	case ErasureRequestNotFoundError:
+		return true
+	case FlowStateNotFoundError:
+		return true
+	case SessionNotFoundError:
+		return true
+	case SSOProviderNotFoundError:
+		return true
 	}
 	return false
 }
@@ -59,3 +77,73 @@ type TotpSecretNotFoundError struct{}
 func (e TotpSecretNotFoundError) Error() string {
 	return "Totp Secret not found"
 }
+
+// AdminActionNotFoundError represents when an admin action is not found.
+type AdminActionNotFoundError struct{}
+
+func (e AdminActionNotFoundError) Error() string {
+	return "Admin action not found"
+}
+
+// OAuthClientNotFoundError represents when an OAuth client is not found.
+type OAuthClientNotFoundError struct{}
+
+func (e OAuthClientNotFoundError) Error() string {
+	return "OAuth client not found"
+}
+
+// OAuthAuthorizationNotFoundError represents when an OAuth authorization is not found.
+type OAuthAuthorizationNotFoundError struct{}
+
+func (e OAuthAuthorizationNotFoundError) Error() string {
+	return "OAuth authorization not found"
+}
+
+// OAuthInitialAccessTokenNotFoundError represents when an initial access token is not found.
+type OAuthInitialAccessTokenNotFoundError struct{}
+
+func (e OAuthInitialAccessTokenNotFoundError) Error() string {
+	return "OAuth initial access token not found"
+}
+
+// ServiceAccountNotFoundError represents when a service account is not found.
+type ServiceAccountNotFoundError struct{}
+
+func (e ServiceAccountNotFoundError) Error() string {
+	return "Service account not found"
+}
+
+// ErasureRequestNotFoundError represents when an erasure request is not found.
+type ErasureRequestNotFoundError struct{}
+
+func (e ErasureRequestNotFoundError) Error() string {
+	return "Erasure request not found"
+}
+
+// FlowStateNotFoundError represents when a PKCE flow state is not found.
+type FlowStateNotFoundError struct{}
+
+func (e FlowStateNotFoundError) Error() string {
+	return "Flow state not found"
+}
+
+// SessionNotFoundError represents when a session is not found.
+type SessionNotFoundError struct{}
+
+func (e SessionNotFoundError) Error() string {
+	return "Session not found"
+}
+
+// SSOProviderNotFoundError represents when an SSO provider is not found.
+type SSOProviderNotFoundError struct{}
+
+func (e SSOProviderNotFoundError) Error() string {
+	return "SSO provider not found"
+}
+
+// LastIdentityError represents an attempt to unlink the last identity of a user.
+type LastIdentityError struct{}
+
+func (e LastIdentityError) Error() string {
+	return "User must keep at least one identity to sign in with"
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// FailedLogin is a sign-in with a wrong password, from IPAddress. UserID is
+// null for sign-ins of unknown users.
+type FailedLogin struct {
+	InstanceID uuid.UUID     `json:"-" db:"instance_id"`
+	ID         uuid.UUID     `json:"id" db:"id"`
+	UserID     uuid.NullUUID `json:"user_id" db:"user_id"`
+	IPAddress  string        `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
+}
+
+func (FailedLogin) TableName() string {
+	tableName := "failed_logins"
+	return tableName
+}
+
+// NewFailedLogin creates a failed sign-in of user, which is nil if the user
+// is unknown.
+func NewFailedLogin(instanceID uuid.UUID, user *User, ipAddress string) (*FailedLogin, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	login := &FailedLogin{
+		InstanceID: instanceID,
+		ID:         id,
+		IPAddress:  ipAddress,
+	}
+	if user != nil {
+		login.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	}
+	return login, nil
+}
+
+// CountFailedLoginsSince counts the failed sign-ins of user since the given time.
+func CountFailedLoginsSince(tx *storage.Connection, user *User, since time.Time) (int, error) {
+	count, err := tx.Q().Where("instance_id = ? AND user_id = ? AND created_at > ?", user.InstanceID, user.ID, since).Count(&FailedLogin{})
+	return count, errors.Wrap(err, "error counting failed logins")
+}
+
+// CountFailedLoginsFromIPSince counts the failed sign-ins from an IP address
+// since the given time, of any user.
+func CountFailedLoginsFromIPSince(tx *storage.Connection, instanceID uuid.UUID, ipAddress string, since time.Time) (int, error) {
+	count, err := tx.Q().Where("instance_id = ? AND ip_address = ? AND created_at > ?", instanceID, ipAddress, since).Count(&FailedLogin{})
+	return count, errors.Wrap(err, "error counting failed logins")
+}
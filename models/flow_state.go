@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// FlowState is a sign-in started with the PKCE flow. Once the user signs in
+// it carries the authorization code the client exchanges, with the code
+// verifier of the challenge, for tokens.
+type FlowState struct {
+	InstanceID           uuid.UUID          `json:"-" db:"instance_id"`
+	ID                   uuid.UUID          `json:"id" db:"id"`
+	UserID               uuid.NullUUID      `json:"-" db:"user_id"`
+	AuthCodeHash         storage.NullString `json:"-" db:"auth_code_hash"`
+	CodeChallenge        string             `json:"-" db:"code_challenge"`
+	CodeChallengeMethod  string             `json:"-" db:"code_challenge_method"`
+	ProviderType         string             `json:"provider_type" db:"provider_type"`
+	AuthenticationMethod string             `json:"authentication_method" db:"authentication_method"`
+	CreatedAt            time.Time          `json:"created_at" db:"created_at"`
+	ExpiresAt            time.Time          `json:"expires_at" db:"expires_at"`
+	UsedAt               *time.Time         `json:"-" db:"used_at"`
+}
+
+func (FlowState) TableName() string {
+	tableName := "flow_states"
+	return tableName
+}
+
+// NewFlowState creates a pending sign-in with the code challenge, which
+// expires after ttl. The user is only known up front for magic links.
+func NewFlowState(instanceID uuid.UUID, user *User, providerType, authenticationMethod, codeChallenge, codeChallengeMethod string, ttl time.Duration) (*FlowState, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	flowState := &FlowState{
+		InstanceID:           instanceID,
+		ID:                   id,
+		CodeChallenge:        codeChallenge,
+		CodeChallengeMethod:  codeChallengeMethod,
+		ProviderType:         providerType,
+		AuthenticationMethod: authenticationMethod,
+		ExpiresAt:            time.Now().Add(ttl),
+	}
+	if user != nil {
+		flowState.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	}
+	return flowState, nil
+}
+
+// IsExpired returns true if the sign-in or its code can no longer be used.
+func (f *FlowState) IsExpired() bool {
+	return time.Now().After(f.ExpiresAt)
+}
+
+// IssueAuthCode binds the sign-in to the user and issues an authorization
+// code valid for ttl.
+func (f *FlowState) IssueAuthCode(tx *storage.Connection, user *User, ttl time.Duration) (string, error) {
+	code := crypto.SecureToken()
+
+	f.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	f.AuthCodeHash = storage.NullString(hashAuthorizationCode(code))
+	f.ExpiresAt = time.Now().Add(ttl)
+	return code, tx.UpdateOnly(f, "user_id", "auth_code_hash", "expires_at")
+}
+
+// Consume marks the authorization code as used. Codes can only be exchanged
+// once, so it returns false if another request consumed the code first.
+func (f *FlowState) Consume(tx *storage.Connection) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: FlowState{}}).TableName()+" SET used_at = ? WHERE id = ? AND used_at IS NULL", now, f.ID).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error consuming flow state")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	f.UsedAt = &now
+	return true, nil
+}
+
+// VerifyCodeVerifier checks the PKCE code verifier against the stored challenge.
+func (f *FlowState) VerifyCodeVerifier(verifier string) bool {
+	return verifyCodeChallenge(f.CodeChallenge, f.CodeChallengeMethod, verifier)
+}
+
+// FindFlowState finds a sign-in by its id.
+func FindFlowState(tx *storage.Connection, instanceID, id uuid.UUID) (*FlowState, error) {
+	flowState := &FlowState{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(flowState); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, FlowStateNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding flow state")
+	}
+	return flowState, nil
+}
+
+// FindFlowStateByAuthCode finds a sign-in by the authorization code issued for it.
+func FindFlowStateByAuthCode(tx *storage.Connection, instanceID uuid.UUID, code string) (*FlowState, error) {
+	flowState := &FlowState{}
+	if err := tx.Q().Where("instance_id = ? AND auth_code_hash = ?", instanceID, hashAuthorizationCode(code)).First(flowState); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, FlowStateNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding flow state")
+	}
+	return flowState, nil
+}
+
+// FindPendingFlowState finds the latest sign-in of the user with the
+// authentication method that has no authorization code yet.
+func FindPendingFlowState(tx *storage.Connection, instanceID, userID uuid.UUID, authenticationMethod string) (*FlowState, error) {
+	flowState := &FlowState{}
+	q := tx.Q().Where("instance_id = ? AND user_id = ? AND authentication_method = ? AND auth_code_hash IS NULL AND expires_at > ?", instanceID, userID, authenticationMethod, time.Now())
+	if err := q.Order("created_at desc").First(flowState); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, FlowStateNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding flow state")
+	}
+	return flowState, nil
+}
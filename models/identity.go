@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/gobuffalo/pop/v5"
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/storage"
 	"github.com/pkg/errors"
@@ -67,6 +68,16 @@ func FindIdentitiesByUser(tx *storage.Connection, user *User) ([]*Identity, erro
 	return identities, nil
 }
 
+// FindUserIdentitiesByID returns the identities of the user with the provider
+// id, which identities of different providers may share.
+func FindUserIdentitiesByID(tx *storage.Connection, user *User, id string) ([]*Identity, error) {
+	identities := []*Identity{}
+	if err := tx.Q().Where("user_id = ? AND id = ?", user.ID, id).All(&identities); err != nil {
+		return nil, errors.Wrap(err, "error finding identities")
+	}
+	return identities, nil
+}
+
 // FindProvidersByUser returns all providers associated to a user
 func FindProvidersByUser(tx *storage.Connection, user *User) ([]string, error) {
 	identities := []Identity{}
@@ -82,3 +93,14 @@ func FindProvidersByUser(tx *storage.Connection, user *User) ([]string, error) {
 	}
 	return providers, nil
 }
+
+// TransferIdentities moves the identities of one user to another. The email
+// and phone identities only stand for the user's own email and phone, so they
+// stay behind and are removed along with the user.
+func TransferIdentities(tx *storage.Connection, from, to *User) (int, error) {
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: Identity{}}).TableName()+" SET user_id = ?, updated_at = ? WHERE user_id = ? AND provider NOT IN ('email', 'phone')", to.ID, time.Now(), from.ID).ExecWithCount()
+	if err != nil {
+		return 0, errors.Wrap(err, "error transferring identities")
+	}
+	return count, nil
+}
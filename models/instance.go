@@ -87,3 +87,10 @@ func DeleteInstance(conn *storage.Connection, instance *Instance) error {
 		return errors.Wrap(tx.Destroy(instance), "Error deleting instance record")
 	})
 }
+
+// FindInstances finds all instances
+func FindInstances(tx *storage.Connection) ([]*Instance, error) {
+	instances := []*Instance{}
+	err := tx.Q().Order("created_at asc").All(&instances)
+	return instances, errors.Wrap(err, "error finding instances")
+}
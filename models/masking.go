@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/netlify/gotrue/storage"
+)
+
+// Masked returns a copy of the user for admins who may not see personal data
+// in full: the local part of email addresses and the middle digits of phone
+// numbers are masked, also in the identity data of the user's identities.
+func (u *User) Masked() *User {
+	masked := *u
+	masked.Email = storage.NullString(maskEmail(u.GetEmail()))
+	masked.Phone = storage.NullString(maskPhone(u.GetPhone()))
+	masked.EmailChange = maskEmail(u.EmailChange)
+	masked.PhoneChange = maskPhone(u.PhoneChange)
+
+	masked.Identities = make([]Identity, len(u.Identities))
+	for i, identity := range u.Identities {
+		data := JSONMap{}
+		for key, value := range identity.IdentityData {
+			if s, ok := value.(string); ok {
+				switch key {
+				case "email":
+					value = maskEmail(s)
+				case "phone":
+					value = maskPhone(s)
+				}
+			}
+			data[key] = value
+		}
+		identity.IdentityData = data
+		masked.Identities[i] = identity
+	}
+	return &masked
+}
+
+// maskEmail keeps the first character of the local part and the domain, so
+// support can still tell addresses apart: j***@example.com.
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return maskPhone(email)
+	}
+	if at == 0 {
+		return email
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// maskPhone keeps the first three and the last two digits: 155*****67.
+func maskPhone(phone string) string {
+	if len(phone) <= 5 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:3] + strings.Repeat("*", len(phone)-5) + phone[len(phone)-2:]
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskedUser(t *testing.T) {
+	u := &User{
+		Email:       "john.doe@example.com",
+		Phone:       "15551234567",
+		EmailChange: "jd@example.org",
+		Identities: []Identity{{
+			Provider:     "github",
+			IdentityData: JSONMap{"email": "john.doe@example.com", "sub": "123"},
+		}},
+	}
+
+	masked := u.Masked()
+	assert.Equal(t, "j***@example.com", masked.GetEmail())
+	assert.Equal(t, "155******67", masked.GetPhone())
+	assert.Equal(t, "j***@example.org", masked.EmailChange)
+	assert.Equal(t, "j***@example.com", masked.Identities[0].IdentityData["email"])
+	assert.Equal(t, "123", masked.Identities[0].IdentityData["sub"])
+
+	// the user itself is left alone
+	assert.Equal(t, "john.doe@example.com", u.GetEmail())
+	assert.Equal(t, "john.doe@example.com", u.Identities[0].IdentityData["email"])
+
+	assert.Equal(t, "", maskEmail(""))
+	assert.Equal(t, "****", maskPhone("1234"))
+}
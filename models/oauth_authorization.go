@@ -0,0 +1,167 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	CodeChallengeMethodPlain = "plain"
+	CodeChallengeMethodS256  = "S256"
+)
+
+// OAuthAuthorization is an authorization request made by an OAuth client on
+// behalf of a user. Once the user consents it carries the authorization code
+// the client exchanges for tokens.
+type OAuthAuthorization struct {
+	InstanceID          uuid.UUID          `json:"-" db:"instance_id"`
+	ID                  uuid.UUID          `json:"id" db:"id"`
+	ClientID            uuid.UUID          `json:"client_id" db:"client_id"`
+	UserID              uuid.NullUUID      `json:"-" db:"user_id"`
+	RedirectURI         string             `json:"redirect_uri" db:"redirect_uri"`
+	RedirectURIProvided bool               `json:"-" db:"redirect_uri_provided"`
+	Scope               string             `json:"scope" db:"scope"`
+	State               storage.NullString `json:"-" db:"state"`
+	Nonce               storage.NullString `json:"-" db:"nonce"`
+	CodeChallenge       storage.NullString `json:"-" db:"code_challenge"`
+	CodeChallengeMethod storage.NullString `json:"-" db:"code_challenge_method"`
+	CodeHash            storage.NullString `json:"-" db:"code_hash"`
+	CreatedAt           time.Time          `json:"created_at" db:"created_at"`
+	ExpiresAt           time.Time          `json:"expires_at" db:"expires_at"`
+	ApprovedAt          *time.Time         `json:"-" db:"approved_at"`
+	UsedAt              *time.Time         `json:"-" db:"used_at"`
+}
+
+func (OAuthAuthorization) TableName() string {
+	tableName := "oauth_authorizations"
+	return tableName
+}
+
+// NewOAuthAuthorization creates a pending authorization request which expires after ttl.
+func NewOAuthAuthorization(instanceID uuid.UUID, client *OAuthClient, redirectURI, scope, state, nonce, codeChallenge, codeChallengeMethod string, ttl time.Duration) (*OAuthAuthorization, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &OAuthAuthorization{
+		InstanceID:          instanceID,
+		ID:                  id,
+		ClientID:            client.ID,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		State:               storage.NullString(state),
+		Nonce:               storage.NullString(nonce),
+		CodeChallenge:       storage.NullString(codeChallenge),
+		CodeChallengeMethod: storage.NullString(codeChallengeMethod),
+		ExpiresAt:           time.Now().Add(ttl),
+	}, nil
+}
+
+// IsExpired returns true if the request or its code can no longer be used.
+func (a *OAuthAuthorization) IsExpired() bool {
+	return time.Now().After(a.ExpiresAt)
+}
+
+// MatchesRedirectURI checks the redirect_uri of a token request. It must be
+// identical to the one of the authorization request if the client sent one
+// there, as required by RFC 6749 section 4.1.3.
+func (a *OAuthAuthorization) MatchesRedirectURI(uri string) bool {
+	if a.RedirectURIProvided {
+		return uri == a.RedirectURI
+	}
+	return uri == "" || uri == a.RedirectURI
+}
+
+// IsPending returns true if the user has not yet consented to the request.
+func (a *OAuthAuthorization) IsPending() bool {
+	return a.ApprovedAt == nil && !a.IsExpired()
+}
+
+// Approve binds the request to the user and issues an authorization code valid for ttl.
+func (a *OAuthAuthorization) Approve(tx *storage.Connection, user *User, ttl time.Duration) (string, error) {
+	code := crypto.SecureToken()
+	now := time.Now()
+
+	a.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	a.CodeHash = storage.NullString(hashAuthorizationCode(code))
+	a.ApprovedAt = &now
+	a.ExpiresAt = now.Add(ttl)
+	return code, tx.UpdateOnly(a, "user_id", "code_hash", "approved_at", "expires_at")
+}
+
+// Consume marks the authorization code as used. Codes can only be exchanged
+// once, so it returns false if another request consumed the code first.
+func (a *OAuthAuthorization) Consume(tx *storage.Connection) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: OAuthAuthorization{}}).TableName()+" SET used_at = ? WHERE id = ? AND used_at IS NULL", now, a.ID).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error consuming oauth authorization")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	a.UsedAt = &now
+	return true, nil
+}
+
+// VerifyCodeVerifier checks the PKCE code verifier against the stored challenge.
+func (a *OAuthAuthorization) VerifyCodeVerifier(verifier string) bool {
+	return verifyCodeChallenge(string(a.CodeChallenge), string(a.CodeChallengeMethod), verifier)
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its challenge. An
+// empty challenge only accepts an empty verifier.
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+	if verifier == "" {
+		return false
+	}
+
+	if method == CodeChallengeMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(verifier)) == 1
+}
+
+func hashAuthorizationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindOAuthAuthorization finds an authorization request by its id.
+func FindOAuthAuthorization(tx *storage.Connection, instanceID, id uuid.UUID) (*OAuthAuthorization, error) {
+	authorization := &OAuthAuthorization{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(authorization); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, OAuthAuthorizationNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding oauth authorization")
+	}
+	return authorization, nil
+}
+
+// FindOAuthAuthorizationByCode finds an approved authorization by its code.
+func FindOAuthAuthorizationByCode(tx *storage.Connection, instanceID uuid.UUID, code string) (*OAuthAuthorization, error) {
+	authorization := &OAuthAuthorization{}
+	if err := tx.Q().Where("instance_id = ? AND code_hash = ?", instanceID, hashAuthorizationCode(code)).First(authorization); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, OAuthAuthorizationNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding oauth authorization")
+	}
+	return authorization, nil
+}
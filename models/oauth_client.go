@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Token endpoint authentication methods, see RFC 7591 section 2 and RFC 8705 section 2.
+const (
+	TokenEndpointAuthClientSecretBasic = "client_secret_basic"
+	TokenEndpointAuthClientSecretPost  = "client_secret_post"
+	TokenEndpointAuthNone              = "none"
+	TokenEndpointAuthPrivateKeyJWT     = "private_key_jwt"
+	TokenEndpointAuthTLSClientAuth     = "tls_client_auth"
+)
+
+// OAuthClient is a third-party application that can sign users in through GoTrue.
+type OAuthClient struct {
+	InstanceID              uuid.UUID          `json:"-" db:"instance_id"`
+	ID                      uuid.UUID          `json:"client_id" db:"id"`
+	ClientSecretHash        string             `json:"-" db:"client_secret_hash"`
+	Name                    string             `json:"name" db:"name"`
+	RedirectURIs            StringList         `json:"redirect_uris" db:"redirect_uris"`
+	Scopes                  StringList         `json:"scopes" db:"scopes"`
+	Public                  bool               `json:"public" db:"public"`
+	TokenEndpointAuthMethod storage.NullString `json:"token_endpoint_auth_method" db:"token_endpoint_auth_method"`
+	JWKS                    JSONMap            `json:"jwks,omitempty" db:"jwks"`
+	TLSClientAuthSubjectDN  storage.NullString `json:"tls_client_auth_subject_dn,omitempty" db:"tls_client_auth_subject_dn"`
+	CreatedAt               time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt               time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+func (OAuthClient) TableName() string {
+	tableName := "oauth_clients"
+	return tableName
+}
+
+// NewOAuthClient creates a client authenticating with authMethod. Clients
+// using a secret get one which is returned once and only stored hashed.
+func NewOAuthClient(instanceID uuid.UUID, name string, redirectURIs, scopes []string, authMethod string) (*OAuthClient, string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating unique id")
+	}
+
+	if authMethod == "" {
+		authMethod = TokenEndpointAuthClientSecretBasic
+	}
+	client := &OAuthClient{
+		InstanceID:              instanceID,
+		ID:                      id,
+		Name:                    name,
+		RedirectURIs:            redirectURIs,
+		Scopes:                  scopes,
+		Public:                  authMethod == TokenEndpointAuthNone,
+		TokenEndpointAuthMethod: storage.NullString(authMethod),
+	}
+	if !client.UsesSecret() {
+		return client, "", nil
+	}
+
+	secret, err := client.generateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (c *OAuthClient) generateSecret() (string, error) {
+	secret := crypto.SecureToken() + crypto.SecureToken()
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), PasswordHashCost)
+	if err != nil {
+		return "", errors.Wrap(err, "Error hashing client secret")
+	}
+	c.ClientSecretHash = string(hash)
+	return secret, nil
+}
+
+// RegenerateSecret replaces the secret of a confidential client.
+func (c *OAuthClient) RegenerateSecret(tx *storage.Connection) (string, error) {
+	secret, err := c.generateSecret()
+	if err != nil {
+		return "", err
+	}
+	return secret, tx.UpdateOnly(c, "client_secret_hash")
+}
+
+// AuthMethod returns how the client authenticates at the token endpoint.
+func (c *OAuthClient) AuthMethod() string {
+	if c.Public {
+		return TokenEndpointAuthNone
+	}
+	if c.TokenEndpointAuthMethod == "" {
+		return TokenEndpointAuthClientSecretBasic
+	}
+	return string(c.TokenEndpointAuthMethod)
+}
+
+// UsesSecret returns true if the client authenticates with a shared secret.
+func (c *OAuthClient) UsesSecret() bool {
+	method := c.AuthMethod()
+	return method == TokenEndpointAuthClientSecretBasic || method == TokenEndpointAuthClientSecretPost
+}
+
+// Authenticate checks the client secret of a confidential client.
+func (c *OAuthClient) Authenticate(secret string) bool {
+	if !c.UsesSecret() || c.ClientSecretHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.ClientSecretHash), []byte(secret)) == nil
+}
+
+// HasRedirectURI returns true if uri exactly matches one of the registered redirect URIs.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return c.RedirectURIs.Contains(uri)
+}
+
+// AllowsScopes returns true if every requested scope is allowed for the client.
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, s := range scopes {
+		if !c.Scopes.Contains(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindOAuthClient finds a client by its client id.
+func FindOAuthClient(tx *storage.Connection, instanceID, id uuid.UUID) (*OAuthClient, error) {
+	client := &OAuthClient{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(client); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, OAuthClientNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding oauth client")
+	}
+	return client, nil
+}
+
+// FindOAuthClients returns all the clients registered for an instance.
+func FindOAuthClients(tx *storage.Connection, instanceID uuid.UUID) ([]*OAuthClient, error) {
+	clients := []*OAuthClient{}
+	if err := tx.Q().Where("instance_id = ?", instanceID).Order("created_at asc").All(&clients); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return clients, nil
+		}
+		return nil, errors.Wrap(err, "error finding oauth clients")
+	}
+	return clients, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// OAuthInitialAccessToken is a token allowing a partner to register a single
+// OAuth client. The token itself is a JWT with the id as jti, the record lets
+// it be revoked and used only once.
+type OAuthInitialAccessToken struct {
+	InstanceID uuid.UUID  `json:"-" db:"instance_id"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty" db:"used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+func (OAuthInitialAccessToken) TableName() string {
+	tableName := "oauth_initial_access_tokens"
+	return tableName
+}
+
+// NewOAuthInitialAccessToken creates an initial access token which expires after ttl.
+func NewOAuthInitialAccessToken(instanceID uuid.UUID, ttl time.Duration) (*OAuthInitialAccessToken, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &OAuthInitialAccessToken{
+		InstanceID: instanceID,
+		ID:         id,
+		ExpiresAt:  time.Now().Add(ttl),
+	}, nil
+}
+
+// Use marks the token as used. It returns false if the token has already been
+// used, revoked or has expired.
+func (t *OAuthInitialAccessToken) Use(tx *storage.Connection) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: OAuthInitialAccessToken{}}).TableName()+" SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now, t.ID, now).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error using initial access token")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	t.UsedAt = &now
+	return true, nil
+}
+
+// Revoke prevents the token from being used.
+func (t *OAuthInitialAccessToken) Revoke(tx *storage.Connection) error {
+	now := time.Now()
+	t.RevokedAt = &now
+	return tx.UpdateOnly(t, "revoked_at")
+}
+
+// FindOAuthInitialAccessToken finds an initial access token by its id.
+func FindOAuthInitialAccessToken(tx *storage.Connection, instanceID, id uuid.UUID) (*OAuthInitialAccessToken, error) {
+	token := &OAuthInitialAccessToken{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(token); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, OAuthInitialAccessTokenNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding initial access token")
+	}
+	return token, nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// Kinds of codes sent to users. Each kind is a challenge of its own, whose
+// failed attempts are counted until a new code of the kind is sent.
+const (
+	ConfirmationChallenge     = "confirmation"
+	RecoveryChallenge         = "recovery"
+	EmailChangeChallenge      = "email_change"
+	PhoneChangeChallenge      = "phone_change"
+	ReauthenticationChallenge = "reauthentication"
+)
+
+// OtpAttempt counts the failed verifications of the code of a challenge that
+// was sent at SentAt.
+type OtpAttempt struct {
+	InstanceID     uuid.UUID `json:"-" db:"instance_id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	Challenge      string    `json:"challenge" db:"challenge"`
+	SentAt         time.Time `json:"sent_at" db:"sent_at"`
+	FailedAttempts int       `json:"failed_attempts" db:"failed_attempts"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (OtpAttempt) TableName() string {
+	tableName := "otp_attempts"
+	return tableName
+}
+
+// CountFailedOtpAttempts returns how often the code of challenge sent to user
+// at sentAt failed to verify.
+func CountFailedOtpAttempts(tx *storage.Connection, user *User, challenge string, sentAt time.Time) (int, error) {
+	attempt := &OtpAttempt{}
+	if err := tx.Q().Where("user_id = ? AND challenge = ? AND sent_at = ?", user.ID, challenge, sentAt).First(attempt); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "error finding otp attempts")
+	}
+	return attempt.FailedAttempts, nil
+}
+
+// RecordFailedOtpAttempt counts a failed verification of the code of
+// challenge sent to user at sentAt and returns the failed attempts so far.
+// The count starts over once a new code is sent.
+func RecordFailedOtpAttempt(tx *storage.Connection, user *User, challenge string, sentAt time.Time) (int, error) {
+	table := (&pop.Model{Value: OtpAttempt{}}).TableName()
+	attempt := &OtpAttempt{}
+	err := tx.RawQuery("INSERT INTO "+table+" (instance_id, user_id, challenge, sent_at, failed_attempts, updated_at) VALUES (?, ?, ?, ?, 1, ?) "+
+		"ON CONFLICT (user_id, challenge) DO UPDATE SET "+
+		"failed_attempts = CASE WHEN "+table+".sent_at = EXCLUDED.sent_at THEN "+table+".failed_attempts + 1 ELSE 1 END, "+
+		"sent_at = EXCLUDED.sent_at, updated_at = EXCLUDED.updated_at RETURNING *",
+		user.InstanceID, user.ID, challenge, sentAt, time.Now()).First(attempt)
+	return attempt.FailedAttempts, errors.Wrap(err, "error recording failed otp attempt")
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Password hash algorithms of imported users. Passwords set in GoTrue are
+// always hashed with bcrypt.
+const (
+	PasswordHashBcrypt = "bcrypt"
+	PasswordHashArgon2 = "argon2"
+	PasswordHashScrypt = "scrypt"
+)
+
+// Imported hashes are recomputed on every sign in, so their cost is bounded to
+// keep a single sign in from exhausting the memory or CPU of the server.
+const (
+	maxPasswordHashMemory = 1 << 30 // bytes
+	maxArgon2Time         = 10
+	maxArgon2Threads      = 255
+	maxScryptLogN         = 20
+	maxScryptParallelism  = 16
+	maxPasswordHashLength = 128 // bytes of salt or hash
+)
+
+// passwordHash is a parsed argon2 or scrypt hash in the PHC string format,
+// like $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash> or
+// $scrypt$ln=15,r=8,p=1$<salt>$<hash>, with the salt and hash base64 encoded.
+type passwordHash struct {
+	algorithm string
+	variant   string
+	params    map[string]int
+	salt      []byte
+	hash      []byte
+}
+
+func decodeHashBase64(value string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+func parsePHCHash(hash string) (*passwordHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return nil, errors.New("Invalid password hash format")
+	}
+	h := &passwordHash{variant: parts[1], params: map[string]int{}}
+	switch h.variant {
+	case "argon2i", "argon2id":
+		h.algorithm = PasswordHashArgon2
+	case "scrypt":
+		h.algorithm = PasswordHashScrypt
+	default:
+		return nil, errors.Errorf("Unsupported password hash algorithm %s", h.variant)
+	}
+
+	params := parts[2:]
+	if h.algorithm == PasswordHashArgon2 {
+		// the version is optional, 19 (0x13) is the only one supported
+		if strings.HasPrefix(params[0], "v=") {
+			if params[0] != fmt.Sprintf("v=%d", argon2.Version) {
+				return nil, errors.Errorf("Unsupported argon2 version %s", params[0])
+			}
+			params = params[1:]
+		}
+	}
+	if len(params) != 3 {
+		return nil, errors.New("Invalid password hash format")
+	}
+	for _, param := range strings.Split(params[0], ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("Invalid password hash parameter %s", param)
+		}
+		value, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil || value == 0 {
+			return nil, errors.Errorf("Invalid password hash parameter %s", param)
+		}
+		h.params[kv[0]] = int(value)
+	}
+
+	var err error
+	if h.salt, err = decodeHashBase64(params[1]); err != nil {
+		return nil, errors.Wrap(err, "Invalid password hash salt")
+	}
+	if h.hash, err = decodeHashBase64(params[2]); err != nil {
+		return nil, errors.Wrap(err, "Invalid password hash")
+	}
+	if len(h.hash) == 0 || len(h.hash) > maxPasswordHashLength || len(h.salt) > maxPasswordHashLength {
+		return nil, errors.New("Invalid password hash")
+	}
+
+	var required []string
+	if h.algorithm == PasswordHashArgon2 {
+		required = []string{"m", "t", "p"}
+	} else {
+		required = []string{"ln", "r", "p"}
+	}
+	for _, name := range required {
+		if _, ok := h.params[name]; !ok {
+			return nil, errors.Errorf("Password hash is missing the %s parameter", name)
+		}
+	}
+	if err := h.checkCost(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// checkCost rejects hashes too expensive to compute on sign in.
+func (h *passwordHash) checkCost() error {
+	if h.algorithm == PasswordHashArgon2 {
+		// m is in KiB
+		if h.params["m"] > maxPasswordHashMemory/1024 {
+			return errors.Errorf("Password hash memory cost m can be at most %d", maxPasswordHashMemory/1024)
+		}
+		if h.params["t"] > maxArgon2Time {
+			return errors.Errorf("Password hash time cost t can be at most %d", maxArgon2Time)
+		}
+		if h.params["p"] > maxArgon2Threads {
+			return errors.Errorf("Password hash parallelism p can be at most %d", maxArgon2Threads)
+		}
+		return nil
+	}
+
+	ln, r, p := h.params["ln"], h.params["r"], h.params["p"]
+	if ln > maxScryptLogN {
+		return errors.Errorf("Password hash cost ln can be at most %d", maxScryptLogN)
+	}
+	if p > maxScryptParallelism {
+		return errors.Errorf("Password hash parallelism p can be at most %d", maxScryptParallelism)
+	}
+	if uint64(r)*uint64(p) >= 1<<30 || 128*uint64(r)<<uint(ln) > maxPasswordHashMemory {
+		return errors.Errorf("Password hash memory cost can be at most %d bytes", maxPasswordHashMemory)
+	}
+	return nil
+}
+
+func (h *passwordHash) compare(password string) bool {
+	var derived []byte
+	switch h.variant {
+	case "argon2i":
+		derived = argon2.Key([]byte(password), h.salt, uint32(h.params["t"]), uint32(h.params["m"]), uint8(h.params["p"]), uint32(len(h.hash)))
+	case "argon2id":
+		derived = argon2.IDKey([]byte(password), h.salt, uint32(h.params["t"]), uint32(h.params["m"]), uint8(h.params["p"]), uint32(len(h.hash)))
+	case "scrypt":
+		var err error
+		derived, err = scrypt.Key([]byte(password), h.salt, 1<<uint(h.params["ln"]), h.params["r"], h.params["p"], len(h.hash))
+		if err != nil {
+			return false
+		}
+	}
+	return subtle.ConstantTimeCompare(derived, h.hash) == 1
+}
+
+// ParsePasswordHash validates a password hash and returns its algorithm:
+// bcrypt hashes, or argon2 and scrypt hashes in the PHC string format. When
+// algorithm is set the hash has to use it.
+func ParsePasswordHash(hash, algorithm string) (string, error) {
+	switch algorithm {
+	case "", PasswordHashBcrypt, PasswordHashArgon2, PasswordHashScrypt:
+	default:
+		return "", errors.Errorf("Unsupported password hash algorithm %s", algorithm)
+	}
+
+	detected := PasswordHashBcrypt
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		h, perr := parsePHCHash(hash)
+		if perr != nil {
+			if strings.HasPrefix(hash, "$2") {
+				return "", errors.Wrap(err, "Invalid bcrypt password hash")
+			}
+			return "", perr
+		}
+		detected = h.algorithm
+	}
+	if algorithm != "" && algorithm != detected {
+		return "", errors.Errorf("Password hash isn't a %s hash", algorithm)
+	}
+	return detected, nil
+}
+
+// comparePasswordHash tells if password matches a hash in any of the
+// supported algorithms.
+func comparePasswordHash(hash, password string) bool {
+	if strings.HasPrefix(hash, "$argon2") || strings.HasPrefix(hash, "$scrypt$") {
+		h, err := parsePHCHash(hash)
+		if err != nil {
+			return false
+		}
+		return h.compare(password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestPasswordHashes(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	b64 := base64.RawStdEncoding.EncodeToString
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	argon2idKey := argon2.IDKey([]byte("secret"), salt, 1, 1024, 1, 32)
+	argon2iKey := argon2.Key([]byte("secret"), salt, 1, 1024, 1, 32)
+	scryptKey, err := scrypt.Key([]byte("secret"), salt, 1<<4, 8, 1, 32)
+	require.NoError(t, err)
+
+	cases := []struct {
+		desc      string
+		hash      string
+		algorithm string
+	}{
+		{"bcrypt", string(bcryptHash), PasswordHashBcrypt},
+		{"argon2id", fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=1$%s$%s", b64(salt), b64(argon2idKey)), PasswordHashArgon2},
+		{"argon2i without version", fmt.Sprintf("$argon2i$m=1024,t=1,p=1$%s$%s", b64(salt), b64(argon2iKey)), PasswordHashArgon2},
+		{"scrypt", fmt.Sprintf("$scrypt$ln=4,r=8,p=1$%s$%s==", b64(salt), b64(scryptKey)), PasswordHashScrypt},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			algorithm, err := ParsePasswordHash(c.hash, "")
+			require.NoError(t, err)
+			assert.Equal(t, c.algorithm, algorithm)
+
+			_, err = ParsePasswordHash(c.hash, c.algorithm)
+			assert.NoError(t, err)
+
+			u := &User{EncryptedPassword: c.hash}
+			assert.True(t, u.Authenticate("secret"))
+			assert.False(t, u.Authenticate("not secret"))
+			assert.Equal(t, c.algorithm != PasswordHashBcrypt, u.PasswordNeedsRehash())
+		})
+	}
+
+	_, err = ParsePasswordHash(string(bcryptHash), PasswordHashArgon2)
+	assert.Error(t, err)
+	_, err = ParsePasswordHash(string(bcryptHash), "md5")
+	assert.Error(t, err)
+
+	for _, hash := range []string{
+		"not a hash",
+		"$2a$10$invalid",
+		"$argon2d$v=19$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=4,r=8,p=0$c2FsdA$aGFzaA",
+		"$scrypt$ln=4,r=8,p=1$c2FsdA$",
+		// too expensive to compute on sign in
+		"$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1048577,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=4294967295,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=11,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=256$c2FsdA$aGFzaA",
+		"$scrypt$ln=30,r=8,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=21,r=1,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=20,r=9,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=4,r=4294967295,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=4,r=8,p=17$c2FsdA$aGFzaA",
+	} {
+		_, err := ParsePasswordHash(hash, "")
+		assert.Error(t, err, hash)
+		assert.False(t, (&User{EncryptedPassword: hash}).Authenticate("secret"), hash)
+	}
+
+	// the most expensive hashes accepted
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1048576,t=10,p=255$c2FsdA$aGFzaA",
+		"$scrypt$ln=20,r=8,p=16$c2FsdA$aGFzaA",
+	} {
+		_, err := ParsePasswordHash(hash, "")
+		assert.NoError(t, err, hash)
+	}
+
+	assert.False(t, (&User{}).PasswordNeedsRehash())
+
+	// bcrypt hashes below the configured cost are upgraded too
+	cost := PasswordHashCost
+	defer func() { PasswordHashCost = cost }()
+	PasswordHashCost = bcrypt.MinCost + 1
+	assert.True(t, (&User{EncryptedPassword: string(bcryptHash)}).PasswordNeedsRehash())
+}
@@ -23,7 +23,22 @@ type RefreshToken struct {
 
 	Parent storage.NullString `db:"parent"`
 
-	Revoked   bool      `db:"revoked"`
+	// SessionID is the session the token belongs to. Tokens issued before
+	// sessions were introduced have none.
+	SessionID uuid.NullUUID `db:"session_id"`
+
+	// DPoPJKT is the thumbprint of the DPoP key the token is bound to, if any.
+	DPoPJKT storage.NullString `db:"dpop_jkt"`
+
+	// ClientFingerprint is the fingerprint of the client the token is bound to, if any.
+	ClientFingerprint storage.NullString `db:"client_fingerprint"`
+
+	Revoked bool `db:"revoked"`
+
+	// ReusedAt is when the token was used again after it was swapped for
+	// another, which revokes its family.
+	ReusedAt *time.Time `db:"reused_at"`
+
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 }
@@ -33,9 +48,14 @@ func (RefreshToken) TableName() string {
 	return tableName
 }
 
-// GrantAuthenticatedUser creates a refresh token for the provided user.
-func GrantAuthenticatedUser(tx *storage.Connection, user *User) (*RefreshToken, error) {
-	return createRefreshToken(tx, user, nil)
+// GrantAuthenticatedUser starts a session for the provided user signing in
+// with r and creates its first refresh token.
+func GrantAuthenticatedUser(r *http.Request, tx *storage.Connection, user *User) (*RefreshToken, error) {
+	session, err := newSession(tx, r, user)
+	if err != nil {
+		return nil, err
+	}
+	return createRefreshToken(tx, user, nil, uuid.NullUUID{UUID: session.ID, Valid: true})
 }
 
 // GrantRefreshTokenSwap swaps a refresh token for a new one, revoking the provided token.
@@ -51,12 +71,32 @@ func GrantRefreshTokenSwap(r *http.Request, tx *storage.Connection, user *User,
 		if terr = tx.UpdateOnly(token, "revoked"); terr != nil {
 			return terr
 		}
-		newToken, terr = createRefreshToken(rtx, user, token)
+		if token.SessionID.Valid {
+			session := &Session{ID: token.SessionID.UUID}
+			if terr = session.touch(rtx, r); terr != nil {
+				return errors.Wrap(terr, "error updating session")
+			}
+		}
+		newToken, terr = createRefreshToken(rtx, user, token, token.SessionID)
 		return terr
 	})
 	return newToken, err
 }
 
+// BindDPoP binds the token to the DPoP key with thumbprint jkt. Tokens swapped
+// for it stay bound to the same key.
+func (r *RefreshToken) BindDPoP(tx *storage.Connection, jkt string) error {
+	r.DPoPJKT = storage.NullString(jkt)
+	return tx.UpdateOnly(r, "dpop_jkt")
+}
+
+// BindClient binds the token to the client with the given fingerprint. Tokens
+// swapped for it stay bound to the same client.
+func (r *RefreshToken) BindClient(tx *storage.Connection, fingerprint string) error {
+	r.ClientFingerprint = storage.NullString(fingerprint)
+	return tx.UpdateOnly(r, "client_fingerprint")
+}
+
 // RevokeTokenFamily revokes all refresh tokens that descended from the provided token.
 func RevokeTokenFamily(tx *storage.Connection, token *RefreshToken) error {
 	tablename := (&pop.Model{Value: RefreshToken{}}).TableName()
@@ -73,6 +113,45 @@ func RevokeTokenFamily(tx *storage.Connection, token *RefreshToken) error {
 	return nil
 }
 
+// MarkReused records that the token was used again after it was swapped.
+func (r *RefreshToken) MarkReused(tx *storage.Connection) error {
+	now := time.Now()
+	r.ReusedAt = &now
+	return tx.UpdateOnly(r, "reused_at")
+}
+
+// FindRefreshTokenByID finds a refresh token by its id.
+func FindRefreshTokenByID(tx *storage.Connection, instanceID uuid.UUID, id int64) (*RefreshToken, error) {
+	token := &RefreshToken{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(token); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, RefreshTokenNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding refresh token")
+	}
+	return token, nil
+}
+
+// FindRefreshTokenFamily returns the family of a refresh token in the order
+// they were issued: the token the family was started with at sign-in and
+// every token swapped for one of the family since.
+func FindRefreshTokenFamily(tx *storage.Connection, token *RefreshToken) ([]*RefreshToken, error) {
+	tablename := (&pop.Model{Value: RefreshToken{}}).TableName()
+	tokens := []*RefreshToken{}
+	err := tx.RawQuery(`
+	with recursive ancestors as (
+		select * from `+tablename+` where instance_id = ? and id = ?
+		union
+		select p.* from `+tablename+` p inner join ancestors a on a.parent = p.token where p.instance_id = ?
+	), family as (
+		select * from `+tablename+` where id = (select id from ancestors order by id asc limit 1)
+		union
+		select c.* from `+tablename+` c inner join family f on c.parent = f.token where c.instance_id = ?
+	)
+	select * from family order by id asc;`, token.InstanceID, token.ID, token.InstanceID, token.InstanceID).All(&tokens)
+	return tokens, errors.Wrap(err, "error finding refresh token family")
+}
+
 // GetValidChildToken returns the child token of the token provided if the child is not revoked.
 func GetValidChildToken(tx *storage.Connection, token *RefreshToken) (*RefreshToken, error) {
 	refreshToken := &RefreshToken{}
@@ -86,20 +165,71 @@ func GetValidChildToken(tx *storage.Connection, token *RefreshToken) (*RefreshTo
 	return refreshToken, nil
 }
 
-// Logout deletes all refresh tokens for a user.
-func Logout(tx *storage.Connection, instanceID uuid.UUID, id uuid.UUID) error {
+// Logout deletes all sessions and refresh tokens for a user, recording the
+// reason for clients refreshing them.
+func Logout(tx *storage.Connection, instanceID uuid.UUID, id uuid.UUID, reason string) error {
+	if err := recordSignOut(tx, reason, "instance_id = ? AND user_id = ?", instanceID, id); err != nil {
+		return err
+	}
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Session{}}).TableName()+" WHERE instance_id = ? AND user_id = ?", instanceID, id).Exec(); err != nil {
+		return err
+	}
 	return tx.RawQuery("DELETE FROM "+(&pop.Model{Value: RefreshToken{}}).TableName()+" WHERE instance_id = ? AND user_id = ?", instanceID, id).Exec()
 }
 
-func createRefreshToken(tx *storage.Connection, user *User, oldToken *RefreshToken) (*RefreshToken, error) {
+// TransferRefreshTokens moves the sessions and refresh tokens of one user to
+// another, so their sessions carry on as the other user. Revoked tokens are
+// moved too, so reuse of a revoked token is still detected.
+func TransferRefreshTokens(tx *storage.Connection, instanceID uuid.UUID, fromID, toID uuid.UUID) (int, error) {
+	if err := tx.RawQuery("UPDATE "+(&pop.Model{Value: Session{}}).TableName()+" SET user_id = ?, updated_at = ? WHERE instance_id = ? AND user_id = ?", toID, time.Now(), instanceID, fromID).Exec(); err != nil {
+		return 0, errors.Wrap(err, "error transferring sessions")
+	}
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: RefreshToken{}}).TableName()+" SET user_id = ?, updated_at = ? WHERE instance_id = ? AND user_id = ?", toID, time.Now(), instanceID, fromID).ExecWithCount()
+	if err != nil {
+		return 0, errors.Wrap(err, "error transferring refresh tokens")
+	}
+	return count, nil
+}
+
+// DeleteRefreshTokensBefore deletes up to limit refresh tokens last updated
+// before cutoff. Sessions that weren't refreshed since then end, and the valid
+// tokens are recorded as expired.
+func DeleteRefreshTokensBefore(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error) {
+	table := (&pop.Model{Value: RefreshToken{}}).TableName()
+	count, err := tx.RawQuery("WITH expired AS (SELECT id, instance_id, token, revoked FROM "+table+" WHERE instance_id = ? AND updated_at < ? LIMIT ?), "+
+		"recorded AS (INSERT INTO "+(&pop.Model{Value: SignedOutToken{}}).TableName()+" (instance_id, token, reason, created_at) "+
+		"SELECT instance_id, token, ?, ? FROM expired WHERE revoked = false ON CONFLICT (token) DO NOTHING) "+
+		"DELETE FROM "+table+" WHERE id IN (SELECT id FROM expired)", instanceID, cutoff, limit, SignOutReasonExpired, time.Now()).ExecWithCount()
+	if err != nil {
+		return 0, errors.Wrap(err, "error deleting refresh tokens")
+	}
+	return count, nil
+}
+
+// LogoutAll deletes all sessions and refresh tokens of an instance, signing
+// every user out.
+func LogoutAll(tx *storage.Connection, instanceID uuid.UUID, reason string) error {
+	if err := recordSignOut(tx, reason, "instance_id = ?", instanceID); err != nil {
+		return err
+	}
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Session{}}).TableName()+" WHERE instance_id = ?", instanceID).Exec(); err != nil {
+		return err
+	}
+	return tx.RawQuery("DELETE FROM "+(&pop.Model{Value: RefreshToken{}}).TableName()+" WHERE instance_id = ?", instanceID).Exec()
+}
+
+func createRefreshToken(tx *storage.Connection, user *User, oldToken *RefreshToken, sessionID uuid.NullUUID) (*RefreshToken, error) {
 	token := &RefreshToken{
 		InstanceID: user.InstanceID,
 		UserID:     user.ID,
 		Token:      crypto.SecureToken(),
 		Parent:     "",
+		SessionID:  sessionID,
 	}
 	if oldToken != nil {
 		token.Parent = storage.NullString(oldToken.Token)
+		token.DPoPJKT = oldToken.DPoPJKT
+		token.ClientFingerprint = oldToken.ClientFingerprint
 	}
 
 	if err := tx.Create(token); err != nil {
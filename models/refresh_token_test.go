@@ -3,6 +3,7 @@ package models
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/conf"
@@ -38,7 +39,7 @@ func TestRefreshToken(t *testing.T) {
 
 func (ts *RefreshTokenTestSuite) TestGrantAuthenticatedUser() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(&http.Request{}, ts.db, u)
 	require.NoError(ts.T(), err)
 
 	require.NotEmpty(ts.T(), r.Token)
@@ -47,7 +48,7 @@ func (ts *RefreshTokenTestSuite) TestGrantAuthenticatedUser() {
 
 func (ts *RefreshTokenTestSuite) TestGrantRefreshTokenSwap() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(&http.Request{}, ts.db, u)
 	require.NoError(ts.T(), err)
 
 	s, err := GrantRefreshTokenSwap(&http.Request{}, ts.db, u, r)
@@ -65,14 +66,33 @@ func (ts *RefreshTokenTestSuite) TestGrantRefreshTokenSwap() {
 
 func (ts *RefreshTokenTestSuite) TestLogout() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(&http.Request{}, ts.db, u)
 	require.NoError(ts.T(), err)
 
-	require.NoError(ts.T(), Logout(ts.db, uuid.Nil, u.ID))
-	u, r, err = FindUserWithRefreshToken(ts.db, r.Token)
+	require.NoError(ts.T(), Logout(ts.db, uuid.Nil, u.ID, SignOutReasonUser))
+	token := r.Token
+	u, r, err = FindUserWithRefreshToken(ts.db, token)
 	require.Errorf(ts.T(), err, "expected error when there are no refresh tokens to authenticate. user: %v token: %v", u, r)
 
 	require.True(ts.T(), IsNotFoundError(err), "expected NotFoundError")
+
+	reason, err := FindSignOutReason(ts.db, token)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), SignOutReasonUser, reason)
+}
+
+func (ts *RefreshTokenTestSuite) TestDeleteSessionsBeforeRecordsExpiry() {
+	u := ts.createUser()
+	r, err := GrantAuthenticatedUser(&http.Request{}, ts.db, u)
+	require.NoError(ts.T(), err)
+
+	count, err := DeleteSessionsBefore(ts.db, uuid.Nil, time.Now().Add(time.Minute), 10)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 1, count)
+
+	reason, err := FindSignOutReason(ts.db, r.Token)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), SignOutReasonExpired, reason)
 }
 
 func (ts *RefreshTokenTestSuite) createUser() *User {
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+type SecurityEventType string
+
+const (
+	// SignInSecurityEvent is a sign-in, with the anomalies detected for it in the payload.
+	SignInSecurityEvent SecurityEventType = "sign_in"
+	// PolicyViolationSecurityEvent is a violation of a policy counted towards automatic bans.
+	PolicyViolationSecurityEvent SecurityEventType = "policy_violation"
+	// AutoBanSecurityEvent is an automatic ban, counted to escalate the next one.
+	AutoBanSecurityEvent SecurityEventType = "auto_ban"
+)
+
+// SecurityEvent is a security relevant event of a user, kept so later events
+// can be compared with the user's history.
+type SecurityEvent struct {
+	InstanceID uuid.UUID          `json:"-" db:"instance_id"`
+	ID         uuid.UUID          `json:"id" db:"id"`
+	UserID     uuid.UUID          `json:"user_id" db:"user_id"`
+	Type       SecurityEventType  `json:"type" db:"type"`
+	IPAddress  string             `json:"ip_address" db:"ip_address"`
+	Country    storage.NullString `json:"country,omitempty" db:"country"`
+	Payload    JSONMap            `json:"payload" db:"payload"`
+	CreatedAt  time.Time          `json:"created_at" db:"created_at"`
+}
+
+func (SecurityEvent) TableName() string {
+	tableName := "security_events"
+	return tableName
+}
+
+// NewSecurityEvent creates a security event of user.
+func NewSecurityEvent(user *User, eventType SecurityEventType, ipAddress, country string, payload map[string]interface{}) (*SecurityEvent, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &SecurityEvent{
+		InstanceID: user.InstanceID,
+		ID:         id,
+		UserID:     user.ID,
+		Type:       eventType,
+		IPAddress:  ipAddress,
+		Country:    storage.NullString(country),
+		Payload:    payload,
+	}, nil
+}
+
+// FindSecurityEventsSince returns the events of a type of the user since the given time, newest first.
+func FindSecurityEventsSince(tx *storage.Connection, user *User, eventType SecurityEventType, since time.Time) ([]*SecurityEvent, error) {
+	events := []*SecurityEvent{}
+	if err := tx.Q().Where("instance_id = ? AND user_id = ? AND type = ? AND created_at > ?", user.InstanceID, user.ID, eventType, since).Order("created_at desc").All(&events); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return events, nil
+		}
+		return nil, errors.Wrap(err, "error finding security events")
+	}
+	return events, nil
+}
+
+// FindSecurityEventCountries returns the countries the events of a type of the user came from.
+func FindSecurityEventCountries(tx *storage.Connection, user *User, eventType SecurityEventType) ([]string, error) {
+	events := []*SecurityEvent{}
+	if err := tx.Q().Select("country").Where("instance_id = ? AND user_id = ? AND type = ? AND country IS NOT NULL", user.InstanceID, user.ID, eventType).All(&events); err != nil {
+		if errors.Cause(err) != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "error finding security event countries")
+		}
+	}
+
+	seen := map[string]bool{}
+	countries := []string{}
+	for _, event := range events {
+		if country := string(event.Country); !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+	return countries, nil
+}
+
+// DeleteSecurityEventsBefore deletes up to limit events created before cutoff.
+func DeleteSecurityEventsBefore(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error) {
+	table := (&pop.Model{Value: SecurityEvent{}}).TableName()
+	count, err := tx.RawQuery("DELETE FROM "+table+" WHERE id IN (SELECT id FROM "+table+" WHERE instance_id = ? AND created_at < ? LIMIT ?)", instanceID, cutoff, limit).ExecWithCount()
+	return count, errors.Wrap(err, "error deleting security events")
+}
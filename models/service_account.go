@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ServiceAccount is a machine user for backend jobs and services. It has no
+// email, phone or password and gets its tokens with client credentials.
+type ServiceAccount struct {
+	InstanceID uuid.UUID  `json:"-" db:"instance_id"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Role       string     `json:"role" db:"role"`
+	SecretHash string     `json:"-" db:"secret_hash"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+func (ServiceAccount) TableName() string {
+	tableName := "service_accounts"
+	return tableName
+}
+
+// NewServiceAccount creates a service account with role. The secret is
+// returned once and only stored hashed.
+func NewServiceAccount(instanceID uuid.UUID, name, role string) (*ServiceAccount, string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating unique id")
+	}
+
+	account := &ServiceAccount{
+		InstanceID: instanceID,
+		ID:         id,
+		Name:       name,
+		Role:       role,
+	}
+	secret, err := account.generateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	return account, secret, nil
+}
+
+func (s *ServiceAccount) generateSecret() (string, error) {
+	secret := crypto.SecureToken() + crypto.SecureToken()
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), PasswordHashCost)
+	if err != nil {
+		return "", errors.Wrap(err, "Error hashing service account secret")
+	}
+	s.SecretHash = string(hash)
+	return secret, nil
+}
+
+// RegenerateSecret replaces the secret of the service account.
+func (s *ServiceAccount) RegenerateSecret(tx *storage.Connection) (string, error) {
+	secret, err := s.generateSecret()
+	if err != nil {
+		return "", err
+	}
+	return secret, tx.UpdateOnly(s, "secret_hash")
+}
+
+// Authenticate checks the secret of the service account.
+func (s *ServiceAccount) Authenticate(secret string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(s.SecretHash), []byte(secret)) == nil
+}
+
+// UpdateLastUsedAt records that a token was issued to the service account.
+func (s *ServiceAccount) UpdateLastUsedAt(tx *storage.Connection) error {
+	now := time.Now()
+	s.LastUsedAt = &now
+	return tx.UpdateOnly(s, "last_used_at")
+}
+
+// FindServiceAccount finds a service account by its id.
+func FindServiceAccount(tx *storage.Connection, instanceID, id uuid.UUID) (*ServiceAccount, error) {
+	account := &ServiceAccount{}
+	if err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).First(account); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ServiceAccountNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding service account")
+	}
+	return account, nil
+}
+
+// FindServiceAccounts returns all the service accounts of an instance.
+func FindServiceAccounts(tx *storage.Connection, instanceID uuid.UUID) ([]*ServiceAccount, error) {
+	accounts := []*ServiceAccount{}
+	if err := tx.Q().Where("instance_id = ?", instanceID).Order("created_at asc").All(&accounts); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return accounts, nil
+		}
+		return nil, errors.Wrap(err, "error finding service accounts")
+	}
+	return accounts, nil
+}
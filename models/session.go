@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/utilities"
+	"github.com/pkg/errors"
+)
+
+// maxSessionUserAgentLength bounds the user agents stored with sessions, as
+// clients choose them.
+const maxSessionUserAgentLength = 512
+
+// Session is a sign-in of a user. The refresh tokens swapped for each other
+// since the sign-in belong to the same session, and revoking the session
+// deletes them.
+type Session struct {
+	InstanceID uuid.UUID          `json:"-" db:"instance_id"`
+	ID         uuid.UUID          `json:"id" db:"id"`
+	UserID     uuid.UUID          `json:"-" db:"user_id"`
+	UserAgent  storage.NullString `json:"user_agent" db:"user_agent"`
+	IPAddress  storage.NullString `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time          `json:"-" db:"updated_at"`
+	LastUsedAt time.Time          `json:"last_used_at" db:"last_used_at"`
+}
+
+func (Session) TableName() string {
+	tableName := "sessions"
+	return tableName
+}
+
+// newSession creates a session of user signing in with r.
+func newSession(tx *storage.Connection, r *http.Request, user *User) (*Session, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+	session := &Session{
+		InstanceID: user.InstanceID,
+		ID:         id,
+		UserID:     user.ID,
+		LastUsedAt: time.Now(),
+	}
+	session.setDevice(r)
+	if err := tx.Create(session); err != nil {
+		return nil, errors.Wrap(err, "error creating session")
+	}
+	return session, nil
+}
+
+func (s *Session) setDevice(r *http.Request) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxSessionUserAgentLength {
+		userAgent = userAgent[:maxSessionUserAgentLength]
+	}
+	s.UserAgent = storage.NullString(userAgent)
+	if r.RemoteAddr != "" {
+		s.IPAddress = storage.NullString(utilities.GetIPAddress(r))
+	}
+}
+
+// touch records that the session was used by r.
+func (s *Session) touch(tx *storage.Connection, r *http.Request) error {
+	s.setDevice(r)
+	s.LastUsedAt = time.Now()
+	return tx.UpdateOnly(s, "user_agent", "ip_address", "last_used_at")
+}
+
+// Revoke ends the session by deleting it along with its refresh tokens.
+// GoTrue rejects the access tokens issued for it from then on, other services
+// verifying them accept them until they expire. The reason is recorded for
+// clients refreshing its tokens.
+func (s *Session) Revoke(tx *storage.Connection, reason string) error {
+	if err := recordSignOut(tx, reason, "session_id = ?", s.ID); err != nil {
+		return err
+	}
+	return tx.Destroy(s)
+}
+
+// FindSessionByID finds the session of a user by its id.
+func FindSessionByID(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*Session, error) {
+	session := &Session{}
+	if err := tx.Q().Where("instance_id = ? AND user_id = ? AND id = ?", instanceID, userID, id).First(session); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, SessionNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding session")
+	}
+	return session, nil
+}
+
+// SessionExists returns true if the session with the id wasn't revoked.
+func SessionExists(tx *storage.Connection, instanceID, id uuid.UUID) (bool, error) {
+	exists, err := tx.Q().Where("instance_id = ? AND id = ?", instanceID, id).Exists(&Session{})
+	if err != nil {
+		return false, errors.Wrap(err, "error finding session")
+	}
+	return exists, nil
+}
+
+// FindActiveSessions returns the sessions of a user that still have a valid
+// refresh token, most recently used first.
+func FindActiveSessions(tx *storage.Connection, user *User) ([]*Session, error) {
+	sessions := []*Session{}
+	table := (&pop.Model{Value: Session{}}).TableName()
+	tokens := (&pop.Model{Value: RefreshToken{}}).TableName()
+	err := tx.Q().Where("instance_id = ? AND user_id = ?", user.InstanceID, user.ID).
+		Where("EXISTS (SELECT 1 FROM " + tokens + " t WHERE t.session_id = " + table + ".id AND t.revoked = false)").
+		Order("last_used_at desc").All(&sessions)
+	if err != nil {
+		return nil, errors.Wrap(err, "error finding sessions")
+	}
+	return sessions, nil
+}
+
+// DeleteSessionsBefore deletes up to limit sessions last used before cutoff,
+// along with their refresh tokens. The valid tokens are recorded as expired.
+func DeleteSessionsBefore(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error) {
+	table := (&pop.Model{Value: Session{}}).TableName()
+	tokens := (&pop.Model{Value: RefreshToken{}}).TableName()
+	count, err := tx.RawQuery("WITH expired AS (SELECT id FROM "+table+" WHERE instance_id = ? AND last_used_at < ? LIMIT ?), "+
+		"recorded AS (INSERT INTO "+(&pop.Model{Value: SignedOutToken{}}).TableName()+" (instance_id, token, reason, created_at) "+
+		"SELECT instance_id, token, ?, ? FROM "+tokens+" WHERE session_id IN (SELECT id FROM expired) AND revoked = false ON CONFLICT (token) DO NOTHING) "+
+		"DELETE FROM "+table+" WHERE id IN (SELECT id FROM expired)", instanceID, cutoff, limit, SignOutReasonExpired, time.Now()).ExecWithCount()
+	if err != nil {
+		return 0, errors.Wrap(err, "error deleting sessions")
+	}
+	return count, nil
+}
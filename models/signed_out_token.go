@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// Reasons why the refresh tokens of a session stopped working, told to
+// clients refreshing them afterwards.
+const (
+	SignOutReasonUser    = "signed_out"
+	SignOutReasonAdmin   = "revoked_by_admin"
+	SignOutReasonRevoked = "token_revoked"
+	SignOutReasonExpired = "session_expired"
+)
+
+// SignedOutToken is a refresh token that was deleted along with its session,
+// kept so that refreshing it tells the client why it was signed out.
+type SignedOutToken struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	Token      string    `json:"-" db:"token"`
+	Reason     string    `json:"reason" db:"reason"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+func (SignedOutToken) TableName() string {
+	tableName := "signed_out_tokens"
+	return tableName
+}
+
+// recordSignOut records the reason for the valid refresh tokens matching the
+// condition, before they are deleted.
+func recordSignOut(tx *storage.Connection, reason string, condition string, args ...interface{}) error {
+	args = append([]interface{}{reason, time.Now()}, args...)
+	err := tx.RawQuery("INSERT INTO "+(&pop.Model{Value: SignedOutToken{}}).TableName()+" (instance_id, token, reason, created_at) "+
+		"SELECT instance_id, token, ?, ? FROM "+(&pop.Model{Value: RefreshToken{}}).TableName()+" WHERE revoked = false AND "+condition+
+		" ON CONFLICT (token) DO NOTHING", args...).Exec()
+	return errors.Wrap(err, "error recording sign out")
+}
+
+// FindSignOutReason returns why the refresh token stopped working, or an
+// empty reason if it isn't known.
+func FindSignOutReason(tx *storage.Connection, token string) (string, error) {
+	signedOut := &SignedOutToken{}
+	if err := tx.Q().Where("token = ?", token).First(signedOut); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "error finding signed out token")
+	}
+	return signedOut.Reason, nil
+}
+
+// DeleteSignedOutTokensBefore deletes up to limit sign out reasons recorded
+// before cutoff.
+func DeleteSignedOutTokensBefore(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) (int, error) {
+	table := (&pop.Model{Value: SignedOutToken{}}).TableName()
+	count, err := tx.RawQuery("DELETE FROM "+table+" WHERE token IN (SELECT token FROM "+table+" WHERE instance_id = ? AND created_at < ? LIMIT ?)", instanceID, cutoff, limit).ExecWithCount()
+	if err != nil {
+		return 0, errors.Wrap(err, "error deleting signed out tokens")
+	}
+	return count, nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// SmsUsage counts the SMS an instance sent on a day, and the ones its daily
+// limit stopped from being sent.
+type SmsUsage struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	Day        time.Time `json:"day" db:"day"`
+	Sent       int       `json:"sent" db:"sent"`
+	Blocked    int       `json:"blocked" db:"blocked"`
+	// LastAllowed is whether the last SMS recorded was within the limit.
+	LastAllowed bool      `json:"-" db:"last_allowed"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (SmsUsage) TableName() string {
+	tableName := "sms_usage"
+	return tableName
+}
+
+// RecordSmsSend counts an SMS about to be sent by the instance today, as
+// blocked once limit SMS were sent already. A limit of 0 allows any number.
+// LastAllowed of the returned usage tells if the SMS may be sent.
+func RecordSmsSend(tx *storage.Connection, instanceID uuid.UUID, limit int) (*SmsUsage, error) {
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	table := (&pop.Model{Value: SmsUsage{}}).TableName()
+	now := time.Now().UTC()
+	usage := &SmsUsage{}
+	err := tx.RawQuery("INSERT INTO "+table+" (instance_id, day, sent, blocked, last_allowed, updated_at) VALUES (?, ?, 1, 0, true, ?) "+
+		"ON CONFLICT (instance_id, day) DO UPDATE SET "+
+		"sent = "+table+".sent + CASE WHEN "+table+".sent < ? THEN 1 ELSE 0 END, "+
+		"blocked = "+table+".blocked + CASE WHEN "+table+".sent < ? THEN 0 ELSE 1 END, "+
+		"last_allowed = "+table+".sent < ?, updated_at = EXCLUDED.updated_at RETURNING *",
+		instanceID, now.Format("2006-01-02"), now, limit, limit, limit).First(usage)
+	return usage, errors.Wrap(err, "error recording sms send")
+}
+
+// FindSmsUsage returns the daily SMS usage of the instance since the day of
+// since, newest first.
+func FindSmsUsage(tx *storage.Connection, instanceID uuid.UUID, since time.Time) ([]*SmsUsage, error) {
+	usage := []*SmsUsage{}
+	err := tx.Q().Where("instance_id = ? AND day >= ?", instanceID, since.UTC().Format("2006-01-02")).Order("day desc").All(&usage)
+	return usage, errors.Wrap(err, "error finding sms usage")
+}
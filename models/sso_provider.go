@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// The types of SSO providers.
+const (
+	SSOProviderTypeSAML = "saml"
+	SSOProviderTypeOIDC = "oidc"
+)
+
+// SSOProvider is an enterprise identity provider users of an instance sign
+// in with. SAML providers are described by their metadata, OIDC providers by
+// their issuer and client credentials.
+type SSOProvider struct {
+	InstanceID       uuid.UUID   `json:"-" db:"instance_id"`
+	ID               uuid.UUID   `json:"id" db:"id"`
+	Type             string      `json:"type" db:"type"`
+	Name             string      `json:"name" db:"name"`
+	MetadataXML      string      `json:"metadata_xml,omitempty" db:"metadata_xml"`
+	MetadataURL      string      `json:"metadata_url,omitempty" db:"metadata_url"`
+	EntityID         string      `json:"entity_id,omitempty" db:"entity_id"`
+	Issuer           string      `json:"issuer,omitempty" db:"issuer"`
+	ClientID         string      `json:"client_id,omitempty" db:"client_id"`
+	ClientSecret     string      `json:"-" db:"client_secret"`
+	AttributeMapping JSONMap     `json:"attribute_mapping" db:"attribute_mapping"`
+	Domains          []SSODomain `json:"domains" has_many:"sso_domains" fk_id:"sso_provider_id"`
+	CreatedAt        time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+func (SSOProvider) TableName() string {
+	tableName := "sso_providers"
+	return tableName
+}
+
+// SSODomain maps the users with emails at a domain to an SSO provider.
+type SSODomain struct {
+	InstanceID    uuid.UUID `json:"-" db:"instance_id"`
+	ID            uuid.UUID `json:"-" db:"id"`
+	SSOProviderID uuid.UUID `json:"-" db:"sso_provider_id"`
+	Domain        string    `json:"domain" db:"domain"`
+	CreatedAt     time.Time `json:"-" db:"created_at"`
+	UpdatedAt     time.Time `json:"-" db:"updated_at"`
+}
+
+func (SSODomain) TableName() string {
+	tableName := "sso_domains"
+	return tableName
+}
+
+// NewSSOProvider creates an SSO provider of type.
+func NewSSOProvider(instanceID uuid.UUID, providerType, name string) (*SSOProvider, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &SSOProvider{
+		InstanceID:       instanceID,
+		ID:               id,
+		Type:             providerType,
+		Name:             name,
+		AttributeMapping: JSONMap{},
+	}, nil
+}
+
+// DomainNames returns the email domains mapped to the provider.
+func (p *SSOProvider) DomainNames() []string {
+	domains := make([]string, 0, len(p.Domains))
+	for _, d := range p.Domains {
+		domains = append(domains, d.Domain)
+	}
+	return domains
+}
+
+// SetDomains replaces the email domains mapped to the provider.
+func (p *SSOProvider) SetDomains(tx *storage.Connection, domains []string) error {
+	if err := tx.RawQuery("DELETE FROM "+SSODomain{}.TableName()+" WHERE sso_provider_id = ?", p.ID).Exec(); err != nil {
+		return errors.Wrap(err, "error removing sso domains")
+	}
+
+	p.Domains = []SSODomain{}
+	for _, domain := range domains {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return errors.Wrap(err, "Error generating unique id")
+		}
+		d := SSODomain{
+			InstanceID:    p.InstanceID,
+			ID:            id,
+			SSOProviderID: p.ID,
+			Domain:        strings.ToLower(domain),
+		}
+		if err := tx.Create(&d); err != nil {
+			return errors.Wrap(err, "error creating sso domain")
+		}
+		p.Domains = append(p.Domains, d)
+	}
+	return nil
+}
+
+// FindSSOProvider finds an SSO provider by its id.
+func FindSSOProvider(tx *storage.Connection, instanceID, id uuid.UUID) (*SSOProvider, error) {
+	p := &SSOProvider{}
+	if err := tx.Eager().Q().Where("instance_id = ? AND id = ?", instanceID, id).First(p); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, SSOProviderNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding sso provider")
+	}
+	return p, nil
+}
+
+// FindSSOProviderByDomain finds the SSO provider the domain is mapped to.
+func FindSSOProviderByDomain(tx *storage.Connection, instanceID uuid.UUID, domain string) (*SSOProvider, error) {
+	d := &SSODomain{}
+	if err := tx.Q().Where("instance_id = ? AND domain = ?", instanceID, strings.ToLower(domain)).First(d); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, SSOProviderNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding sso domain")
+	}
+	return FindSSOProvider(tx, instanceID, d.SSOProviderID)
+}
+
+// FindSSOProviders returns all the SSO providers of an instance.
+func FindSSOProviders(tx *storage.Connection, instanceID uuid.UUID) ([]*SSOProvider, error) {
+	providers := []*SSOProvider{}
+	if err := tx.Eager().Q().Where("instance_id = ?", instanceID).Order("created_at asc").All(&providers); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return providers, nil
+		}
+		return nil, errors.Wrap(err, "error finding sso providers")
+	}
+	return providers, nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	AuditLogTimelineSource      = "audit_log"
+	SecurityEventTimelineSource = "security_event"
+	AdminActionTimelineSource   = "admin_action"
+)
+
+// TimelineEvent is an event of a user's auth timeline: an audit log entry
+// with the user as the actor or target, a security event of the user or an
+// admin action targeting the user.
+type TimelineEvent struct {
+	Source    string    `json:"source" db:"source"`
+	ID        uuid.UUID `json:"id" db:"id"`
+	Action    string    `json:"action" db:"action"`
+	IPAddress string    `json:"ip_address,omitempty" db:"ip_address"`
+	Payload   JSONMap   `json:"payload" db:"payload"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// FindUserTimeline returns the timeline of user, newest first.
+func FindUserTimeline(tx *storage.Connection, user *User, pageParams *Pagination) ([]*TimelineEvent, error) {
+	auditLogTable := (&pop.Model{Value: AuditLogEntry{}}).TableName()
+	securityEventTable := (&pop.Model{Value: SecurityEvent{}}).TableName()
+	adminActionTable := (&pop.Model{Value: AdminAction{}}).TableName()
+	userID := user.ID.String()
+
+	q := tx.RawQuery(`SELECT * FROM (
+		SELECT '`+AuditLogTimelineSource+`' AS source, id, payload->>'action' AS action, ip_address, payload::jsonb AS payload, created_at
+		FROM `+auditLogTable+`
+		WHERE instance_id = ? AND (payload->>'actor_id' = ? OR payload->'traits'->>'user_id' = ?)
+		UNION ALL
+		SELECT '`+SecurityEventTimelineSource+`', id, type, ip_address, payload, created_at
+		FROM `+securityEventTable+`
+		WHERE instance_id = ? AND user_id = ?
+		UNION ALL
+		SELECT '`+AdminActionTimelineSource+`', id, action, '', jsonb_build_object('requested_by', requested_by, 'approved_by', approved_by, 'approved_at', approved_at, 'expires_at', expires_at, 'params', params), created_at
+		FROM `+adminActionTable+`
+		WHERE instance_id = ? AND target_id = ?
+	) AS timeline ORDER BY created_at DESC, id`,
+		user.InstanceID, userID, userID,
+		user.InstanceID, user.ID,
+		user.InstanceID, user.ID,
+	)
+
+	events := []*TimelineEvent{}
+	var err error
+	if pageParams != nil {
+		err = q.Paginate(int(pageParams.Page), int(pageParams.PerPage)).All(&events)
+		if err == nil {
+			pageParams.Count = uint64(q.Paginator.TotalEntriesSize)
+		}
+	} else {
+		err = q.All(&events)
+	}
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "error finding user timeline")
+	}
+	return events, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// Kinds of single-use values.
+const (
+	NonceOAuthState       = "oauth_state"
+	NonceClientAssertion  = "client_assertion"
+	NonceDPoPProof        = "dpop_proof"
+	NonceSessionMigration = "session_migration"
+)
+
+// UsedNonce is a single-use value that has been consumed. It is kept until it
+// expires, so it is rejected by every GoTrue instance sharing the database.
+type UsedNonce struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	Kind       string    `json:"kind" db:"kind"`
+	Nonce      string    `json:"nonce" db:"nonce"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+}
+
+func (UsedNonce) TableName() string {
+	tableName := "used_nonces"
+	return tableName
+}
+
+// UseNonce marks a value as consumed and returns false if it was already used.
+// Expired values are removed along the way, as they are rejected anyway.
+func UseNonce(tx *storage.Connection, instanceID uuid.UUID, kind, nonce string, expiresAt time.Time) (bool, error) {
+	table := (&pop.Model{Value: UsedNonce{}}).TableName()
+	now := time.Now()
+	if err := tx.RawQuery("DELETE FROM "+table+" WHERE expires_at < ?", now).Exec(); err != nil {
+		return false, errors.Wrap(err, "error deleting expired nonces")
+	}
+
+	count, err := tx.RawQuery("INSERT INTO "+table+" (instance_id, kind, nonce, created_at, expires_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING", instanceID, kind, nonce, now, expiresAt).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error using nonce")
+	}
+	return count > 0, nil
+}
@@ -4,10 +4,12 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gobuffalo/pop/v5"
 	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/clock"
 	"github.com/netlify/gotrue/storage"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
@@ -24,7 +26,9 @@ type User struct {
 	ID         uuid.UUID `json:"id" db:"id"`
 
 	Aud               string             `json:"aud" db:"aud"`
+	ExternalID        storage.NullString `json:"external_id,omitempty" db:"external_id"`
 	Role              string             `json:"role" db:"role"`
+	Roles             StringList         `json:"roles" db:"roles"`
 	Email             storage.NullString `json:"email" db:"email"`
 	EncryptedPassword string             `json:"-" db:"encrypted_password"`
 	EmailConfirmedAt  *time.Time         `json:"email_confirmed_at,omitempty" db:"email_confirmed_at"`
@@ -33,8 +37,10 @@ type User struct {
 	Phone            storage.NullString `json:"phone" db:"phone"`
 	PhoneConfirmedAt *time.Time         `json:"phone_confirmed_at,omitempty" db:"phone_confirmed_at"`
 
-	ConfirmationToken  string     `json:"-" db:"confirmation_token"`
-	ConfirmationSentAt *time.Time `json:"confirmation_sent_at,omitempty" db:"confirmation_sent_at"`
+	ConfirmationToken          string     `json:"-" db:"confirmation_token"`
+	ConfirmationSentAt         *time.Time `json:"confirmation_sent_at,omitempty" db:"confirmation_sent_at"`
+	ConfirmationReminderSentAt *time.Time `json:"confirmation_reminder_sent_at,omitempty" db:"confirmation_reminder_sent_at"`
+	UnconfirmedExpiredAt       *time.Time `json:"unconfirmed_expired_at,omitempty" db:"unconfirmed_expired_at"`
 
 	// For backward compatibility only. Use EmailConfirmedAt or PhoneConfirmedAt instead.
 	ConfirmedAt *time.Time `json:"confirmed_at,omitempty" db:"confirmed_at" rw:"r"`
@@ -61,13 +67,27 @@ type User struct {
 	UserMetaData JSONMap `json:"user_metadata" db:"raw_user_meta_data"`
 
 	IsSuperAdmin bool       `json:"-" db:"is_super_admin"`
+	IsAnonymous  bool       `json:"is_anonymous" db:"is_anonymous"`
 	Identities   []Identity `json:"identities" has_many:"identities"`
 
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
-	BannedUntil *time.Time `json:"banned_until,omitempty" db:"banned_until"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" db:"updated_at"`
+	BannedUntil *time.Time         `json:"banned_until,omitempty" db:"banned_until"`
+	BanReason   storage.NullString `json:"ban_reason,omitempty" db:"ban_reason"`
+	LegalHoldAt *time.Time         `json:"legal_hold_at,omitempty" db:"legal_hold_at"`
+
+	ShadowBannedAt *time.Time `json:"shadow_banned_at,omitempty" db:"shadow_banned_at"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty" db:"locked_until"`
 }
 
+// Reasons users are banned for.
+const (
+	BanReasonAdmin           = "admin"
+	BanReasonCaptchaFailures = "captcha_failures"
+	BanReasonOtpBruteForce   = "otp_brute_force"
+	BanReasonRiskScore       = "risk_score"
+)
+
 // NewUser initializes a new user from an email, password and user data.
 func NewUser(instanceID uuid.UUID, phone, email, password, aud string, userData map[string]interface{}) (*User, error) {
 	id, err := uuid.NewV4()
@@ -93,6 +113,34 @@ func NewUser(instanceID uuid.UUID, phone, email, password, aud string, userData
 	return user, nil
 }
 
+// NewUserWithPasswordHash returns a user whose password is already hashed
+// with bcrypt, argon2 or scrypt, like the hashes exported by other auth
+// providers. The user has no password when the hash is empty.
+func NewUserWithPasswordHash(instanceID uuid.UUID, phone, email, passwordHash, aud string, userData map[string]interface{}) (*User, error) {
+	if passwordHash != "" {
+		if _, err := ParsePasswordHash(passwordHash, ""); err != nil {
+			return nil, err
+		}
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+	if userData == nil {
+		userData = make(map[string]interface{})
+	}
+	user := &User{
+		InstanceID:        instanceID,
+		ID:                id,
+		Aud:               aud,
+		Email:             storage.NullString(strings.ToLower(email)),
+		Phone:             storage.NullString(phone),
+		UserMetaData:      userData,
+		EncryptedPassword: passwordHash,
+	}
+	return user, nil
+}
+
 // NewSystemUser returns a user with the id as SystemUserUUID
 func NewSystemUser(instanceID uuid.UUID, aud string) *User {
 	return &User{
@@ -174,15 +222,140 @@ func (u *User) IsPhoneConfirmed() bool {
 	return u.PhoneConfirmedAt != nil
 }
 
-// SetRole sets the users Role to roleName
+// SetRole sets the users Role to roleName, leaving the roles granted on top
+// of it as they are.
 func (u *User) SetRole(tx *storage.Connection, roleName string) error {
+	if err := u.lockRoles(tx); err != nil {
+		return err
+	}
 	u.Role = strings.TrimSpace(roleName)
 	return tx.UpdateOnly(u, "role")
 }
 
-// HasRole returns true when the users role is set to roleName
+// GrantRoles adds roles to the roles granted on top of the users Role.
+func (u *User) GrantRoles(tx *storage.Connection, roles []string) error {
+	if err := u.lockRoles(tx); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if !u.HasRole(role) {
+			u.Roles = append(u.Roles, role)
+		}
+	}
+	return tx.UpdateOnly(u, "roles")
+}
+
+// RevokeRoles removes roles from the roles granted on top of the users Role.
+func (u *User) RevokeRoles(tx *storage.Connection, roles []string) error {
+	if err := u.lockRoles(tx); err != nil {
+		return err
+	}
+	kept := StringList{}
+	for _, granted := range u.Roles {
+		revoked := false
+		for _, role := range roles {
+			revoked = revoked || granted == role
+		}
+		if !revoked {
+			kept = append(kept, granted)
+		}
+	}
+	u.Roles = kept
+	return tx.UpdateOnly(u, "roles")
+}
+
+// UnlinkIdentity removes an identity of the user, unless it is the user's
+// last one. The user's row is locked until the transaction ends, so
+// concurrent unlinks can't remove every identity. Unlinking the email or
+// phone identity removes the email or phone too, and the password once the
+// user has neither left.
+func (u *User) UnlinkIdentity(tx *storage.Connection, identity *Identity) error {
+	locked := &User{}
+	if err := tx.RawQuery("SELECT * FROM "+(&pop.Model{Value: User{}}).TableName()+" WHERE id = ? FOR UPDATE", u.ID).First(locked); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return UserNotFoundError{}
+		}
+		return errors.Wrap(err, "error locking user")
+	}
+	identities, err := FindIdentitiesByUser(tx, u)
+	if err != nil {
+		return err
+	}
+	if len(identities) < 2 {
+		return LastIdentityError{}
+	}
+
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Identity{}}).TableName()+" WHERE user_id = ? AND id = ? AND provider = ?", u.ID, identity.ID, identity.Provider).Exec(); err != nil {
+		return errors.Wrap(err, "error deleting identity")
+	}
+
+	columns := []string{}
+	switch identity.Provider {
+	case "email":
+		u.Email = ""
+		u.EmailConfirmedAt = nil
+		columns = append(columns, "email", "email_confirmed_at")
+	case "phone":
+		u.Phone = ""
+		u.PhoneConfirmedAt = nil
+		columns = append(columns, "phone", "phone_confirmed_at")
+	}
+	if len(columns) > 0 {
+		hasCredentials := false
+		for _, other := range identities {
+			if other.Provider != identity.Provider && (other.Provider == "email" || other.Provider == "phone") {
+				hasCredentials = true
+			}
+		}
+		if !hasCredentials {
+			u.EncryptedPassword = ""
+			columns = append(columns, "encrypted_password")
+		}
+		if err := tx.UpdateOnly(u, columns...); err != nil {
+			return errors.Wrap(err, "error updating user")
+		}
+	}
+	return u.UpdateAppMetaDataProviders(tx)
+}
+
+// lockRoles reloads the roles of the user with its row locked until the
+// transaction ends, so concurrent role updates can't overwrite each other.
+func (u *User) lockRoles(tx *storage.Connection) error {
+	locked := &User{}
+	if err := tx.RawQuery("SELECT * FROM "+(&pop.Model{Value: User{}}).TableName()+" WHERE id = ? FOR UPDATE", u.ID).First(locked); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return UserNotFoundError{}
+		}
+		return errors.Wrap(err, "error locking user")
+	}
+	u.Role = locked.Role
+	u.Roles = locked.Roles
+	return nil
+}
+
+// AllRoles returns the users Role followed by the roles granted on top of it.
+func (u *User) AllRoles() []string {
+	roles := []string{}
+	if u.Role != "" {
+		roles = append(roles, u.Role)
+	}
+	for _, role := range u.Roles {
+		if role != u.Role {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// HasRole returns true when the users role is set to roleName, or roleName
+// was granted to the user
 func (u *User) HasRole(roleName string) bool {
-	return u.Role == roleName
+	for _, role := range u.AllRoles() {
+		if role == roleName {
+			return true
+		}
+	}
+	return false
 }
 
 // GetEmail returns the user's email as a string
@@ -252,6 +425,12 @@ func (u *User) SetPhone(tx *storage.Connection, phone string) error {
 	return tx.UpdateOnly(u, "phone")
 }
 
+// SetExternalID sets the id of the user in another system, an empty id removes it
+func (u *User) SetExternalID(tx *storage.Connection, externalID string) error {
+	u.ExternalID = storage.NullString(externalID)
+	return tx.UpdateOnly(u, "external_id")
+}
+
 // hashPassword generates a hashed password from a plaintext string
 func hashPassword(password string) (string, error) {
 	pw, err := bcrypt.GenerateFromPassword([]byte(password), PasswordHashCost)
@@ -277,10 +456,42 @@ func (u *User) UpdatePhone(tx *storage.Connection, phone string) error {
 	return tx.UpdateOnly(u, "phone")
 }
 
+// SetPasswordHash replaces the user's password with an already hashed one
+func (u *User) SetPasswordHash(tx *storage.Connection, passwordHash string) error {
+	if _, err := ParsePasswordHash(passwordHash, ""); err != nil {
+		return err
+	}
+	u.EncryptedPassword = passwordHash
+	return tx.UpdateOnly(u, "encrypted_password")
+}
+
 // Authenticate a user from a password
 func (u *User) Authenticate(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.EncryptedPassword), []byte(password))
-	return err == nil
+	return comparePasswordHash(u.EncryptedPassword, password)
+}
+
+// PasswordNeedsRehash tells if the user's password isn't hashed with bcrypt
+// at the current PasswordHashCost, like the imported argon2 and scrypt hashes.
+func (u *User) PasswordNeedsRehash() bool {
+	if u.EncryptedPassword == "" {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(u.EncryptedPassword))
+	return err != nil || cost < PasswordHashCost
+}
+
+var (
+	unknownUserPasswordHash     []byte
+	unknownUserPasswordHashOnce sync.Once
+)
+
+// AuthenticateUnknownUser compares the password against a throwaway hash, so
+// a sign in for a user that doesn't exist takes as long as a wrong password.
+func AuthenticateUnknownUser(password string) {
+	unknownUserPasswordHashOnce.Do(func() {
+		unknownUserPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), PasswordHashCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(unknownUserPasswordHash, []byte(password))
 }
 
 // ConfirmReauthentication resets the reauthentication token
@@ -297,6 +508,13 @@ func (u *User) Confirm(tx *storage.Connection) error {
 	return tx.UpdateOnly(u, "confirmation_token", "email_confirmed_at")
 }
 
+// UpgradeAnonymous turns an anonymous user into a regular user, once it has
+// an email address, phone number or identity to sign in with.
+func (u *User) UpgradeAnonymous(tx *storage.Connection) error {
+	u.IsAnonymous = false
+	return tx.UpdateOnly(u, "is_anonymous")
+}
+
 // ConfirmPhone resets the confimation token and sets the confirm timestamp
 func (u *User) ConfirmPhone(tx *storage.Connection) error {
 	u.ConfirmationToken = ""
@@ -343,6 +561,56 @@ func (u *User) Recover(tx *storage.Connection) error {
 	return tx.UpdateOnly(u, "recovery_token")
 }
 
+// Anonymize removes the personal data of the user and its identities while
+// keeping the user's id, so references to it stay valid. The user can no
+// longer sign in afterwards.
+func (u *User) Anonymize(tx *storage.Connection) error {
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Identity{}}).TableName()+" WHERE user_id = ?", u.ID).Exec(); err != nil {
+		return errors.Wrap(err, "error deleting identities")
+	}
+
+	u.Email = ""
+	u.Phone = ""
+	u.EncryptedPassword = ""
+	u.ConfirmationToken = ""
+	u.RecoveryToken = ""
+	u.EmailChangeTokenCurrent = ""
+	u.EmailChangeTokenNew = ""
+	u.EmailChange = ""
+	u.PhoneChangeToken = ""
+	u.PhoneChange = ""
+	u.ReauthenticationToken = ""
+	u.AppMetaData = JSONMap{}
+	u.UserMetaData = JSONMap{}
+	u.Identities = nil
+	return tx.UpdateOnly(u, "email", "phone", "encrypted_password", "confirmation_token", "recovery_token",
+		"email_change_token_current", "email_change_token_new", "email_change", "phone_change_token", "phone_change",
+		"reauthentication_token", "raw_app_meta_data", "raw_user_meta_data", "updated_at")
+}
+
+// ClaimConfirmationReminder marks that a reminder to confirm the email is sent
+// to the user. It returns false if it has already been sent, so concurrent
+// background jobs remind every user only once.
+func (u *User) ClaimConfirmationReminder(tx *storage.Connection) (bool, error) {
+	now := time.Now()
+	count, err := tx.RawQuery("UPDATE "+(&pop.Model{Value: User{}}).TableName()+" SET confirmation_reminder_sent_at = ? WHERE id = ? AND confirmation_reminder_sent_at IS NULL", now, u.ID).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error claiming confirmation reminder")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	u.ConfirmationReminderSentAt = &now
+	return true, nil
+}
+
+// FlagUnconfirmedExpired flags a user who never confirmed as expired.
+func (u *User) FlagUnconfirmedExpired(tx *storage.Connection) error {
+	now := time.Now()
+	u.UnconfirmedExpiredAt = &now
+	return tx.UpdateOnly(u, "unconfirmed_expired_at")
+}
+
 // CountOtherUsers counts how many other users exist besides the one provided
 func CountOtherUsers(tx *storage.Connection, instanceID, id uuid.UUID) (int, error) {
 	userCount, err := tx.Q().Where("instance_id = ? and id != ?", instanceID, id).Count(&User{})
@@ -424,15 +692,84 @@ func FindUserWithRefreshToken(tx *storage.Connection, token string) (*User, *Ref
 	return user, refreshToken, nil
 }
 
+// FindUnconfirmedUsersToRemind finds up to limit users who signed up with an
+// email before cutoff, never confirmed it and haven't been reminded yet.
+// Invited users are left alone.
+func FindUnconfirmedUsersToRemind(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, limit int) ([]*User, error) {
+	users := []*User{}
+	err := tx.Q().Where("instance_id = ? and email != '' and email_confirmed_at is null and invited_at is null and confirmation_reminder_sent_at is null and unconfirmed_expired_at is null and created_at < ?", instanceID, cutoff).
+		Order("created_at asc").Limit(limit).All(&users)
+	return users, errors.Wrap(err, "error finding unconfirmed users")
+}
+
+// FindExpiredUnconfirmedUsers finds up to limit users who signed up before
+// cutoff and never confirmed their email or phone. Users already flagged as
+// expired are only included if includeFlagged is set. Invited users, anonymous
+// users and users on legal hold are left alone.
+func FindExpiredUnconfirmedUsers(tx *storage.Connection, instanceID uuid.UUID, cutoff time.Time, includeFlagged bool, limit int) ([]*User, error) {
+	users := []*User{}
+	q := tx.Q().Where("instance_id = ? and email_confirmed_at is null and phone_confirmed_at is null and invited_at is null and is_anonymous = false and legal_hold_at is null and created_at < ?", instanceID, cutoff)
+	if !includeFlagged {
+		q = q.Where("unconfirmed_expired_at is null")
+	}
+	err := q.Order("created_at asc").Limit(limit).All(&users)
+	return users, errors.Wrap(err, "error finding expired unconfirmed users")
+}
+
 // FindUsersInAudience finds users with the matching audience.
 func FindUsersInAudience(tx *storage.Connection, instanceID uuid.UUID, aud string, pageParams *Pagination, sortParams *SortParams, filter string) ([]*User, error) {
-	users := []*User{}
+	return findUsersInAudience(tx.Q().Where("instance_id = ? and aud = ?", instanceID, aud), pageParams, sortParams, filter)
+}
+
+// The statuses users can be listed by.
+const (
+	UserStatusBanned      = "banned"
+	UserStatusLocked      = "locked"
+	UserStatusUnconfirmed = "unconfirmed"
+)
+
+// IsUserStatus tells whether status is one users can be listed by.
+func IsUserStatus(status string) bool {
+	switch status {
+	case UserStatusBanned, UserStatusLocked, UserStatusUnconfirmed:
+		return true
+	}
+	return false
+}
+
+// FindUsersWithStatusInAudience finds the users in an audience that have a
+// status at now: banned, locked out of the code last sent to them by
+// otpMaxAttempts failed verifications, or with neither email nor phone
+// confirmed.
+func FindUsersWithStatusInAudience(tx *storage.Connection, instanceID uuid.UUID, aud, status string, now time.Time, otpMaxAttempts int, pageParams *Pagination, sortParams *SortParams, filter string) ([]*User, error) {
 	q := tx.Q().Where("instance_id = ? and aud = ?", instanceID, aud)
 
+	switch status {
+	case UserStatusBanned:
+		q = q.Where("banned_until > ?", now)
+	case UserStatusLocked:
+		// a code is locked until a new one is sent, which changes its sent_at
+		q = q.Where("EXISTS (SELECT 1 FROM "+(&pop.Model{Value: OtpAttempt{}}).TableName()+" a WHERE a.user_id = users.id AND a.failed_attempts >= ? AND a.sent_at = "+
+			"CASE a.challenge WHEN ? THEN users.confirmation_sent_at WHEN ? THEN users.recovery_sent_at WHEN ? THEN users.email_change_sent_at "+
+			"WHEN ? THEN users.phone_change_sent_at WHEN ? THEN users.reauthentication_sent_at END)",
+			otpMaxAttempts, ConfirmationChallenge, RecoveryChallenge, EmailChangeChallenge, PhoneChangeChallenge, ReauthenticationChallenge)
+	case UserStatusUnconfirmed:
+		q = q.Where("email_confirmed_at is null and phone_confirmed_at is null")
+	default:
+		return nil, errors.Errorf("unknown user status %s", status)
+	}
+
+	users, err := findUsersInAudience(q, pageParams, sortParams, filter)
+	return users, errors.Wrap(err, "error finding users with status")
+}
+
+func findUsersInAudience(q *pop.Query, pageParams *Pagination, sortParams *SortParams, filter string) ([]*User, error) {
+	users := []*User{}
+
 	if filter != "" {
 		lf := "%" + filter + "%"
 		// we must specify the collation in order to get case insensitive search for the JSON column
-		q = q.Where("(email LIKE ? OR raw_user_meta_data->>'full_name' ILIKE ?)", lf, lf)
+		q = q.Where("(email LIKE ? OR raw_user_meta_data->>'full_name' ILIKE ? OR external_id = ?)", lf, lf, filter)
 	}
 
 	if sortParams != nil && len(sortParams.Fields) > 0 {
@@ -452,6 +789,23 @@ func FindUsersInAudience(tx *storage.Connection, instanceID uuid.UUID, aud strin
 	return users, err
 }
 
+// FindBannedUsers returns the users in an audience that are banned at now,
+// those whose ban ends last first.
+func FindBannedUsers(tx *storage.Connection, instanceID uuid.UUID, aud string, now time.Time, pageParams *Pagination) ([]*User, error) {
+	users := []*User{}
+	q := tx.Q().Where("instance_id = ? and aud = ? and banned_until > ?", instanceID, aud, now).Order("banned_until desc")
+
+	var err error
+	if pageParams != nil {
+		err = q.Paginate(int(pageParams.Page), int(pageParams.PerPage)).All(&users)
+		pageParams.Count = uint64(q.Paginator.TotalEntriesSize)
+	} else {
+		err = q.All(&users)
+	}
+
+	return users, errors.Wrap(err, "error finding banned users")
+}
+
 // FindUserByEmailChangeCurrentAndAudience finds a user with the matching email change and audience.
 func FindUserByEmailChangeCurrentAndAudience(tx *storage.Connection, instanceID uuid.UUID, email, token, aud string) (*User, error) {
 	return findUser(
@@ -499,6 +853,18 @@ func IsDuplicatedEmail(tx *storage.Connection, instanceID uuid.UUID, email, aud
 	return true, nil
 }
 
+// IsDuplicatedExternalID checks if another user of the instance already has the external id
+func IsDuplicatedExternalID(tx *storage.Connection, instanceID uuid.UUID, externalID string, userID uuid.UUID) (bool, error) {
+	_, err := findUser(tx, "instance_id = ? and external_id = ? and id != ?", instanceID, externalID, userID)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // IsDuplicatedPhone checks if the phone number already exists in the users table
 func IsDuplicatedPhone(tx *storage.Connection, instanceID uuid.UUID, phone, aud string) (bool, error) {
 	_, err := FindUserByPhoneAndAudience(tx, instanceID, phone, aud)
@@ -516,11 +882,59 @@ func (u *User) IsBanned() bool {
 	if u.BannedUntil == nil {
 		return false
 	}
-	return time.Now().Before(*u.BannedUntil)
+	return clock.Now().Before(*u.BannedUntil)
 }
 
 func (u *User) UpdateBannedUntil(tx *storage.Connection) error {
-	return tx.UpdateOnly(u, "banned_until")
+	return tx.UpdateOnly(u, "banned_until", "ban_reason")
+}
+
+// IsOnLegalHold returns whether the user is on legal hold, which blocks
+// deleting or anonymizing the user until the hold is released.
+func (u *User) IsOnLegalHold() bool {
+	return u.LegalHoldAt != nil
+}
+
+// SetLegalHold places the user on legal hold or releases the hold.
+func (u *User) SetLegalHold(tx *storage.Connection, hold bool) error {
+	if hold {
+		now := time.Now()
+		u.LegalHoldAt = &now
+	} else {
+		u.LegalHoldAt = nil
+	}
+	return tx.UpdateOnly(u, "legal_hold_at")
+}
+
+// IsLocked returns whether the user's account is locked after too many failed
+// sign-ins.
+func (u *User) IsLocked() bool {
+	if u.LockedUntil == nil {
+		return false
+	}
+	return clock.Now().Before(*u.LockedUntil)
+}
+
+// UpdateLockedUntil updates the end of the user's account lock.
+func (u *User) UpdateLockedUntil(tx *storage.Connection) error {
+	return tx.UpdateOnly(u, "locked_until")
+}
+
+// IsShadowBanned returns whether the user is shadow banned: unlike a ban, the
+// user can still sign in, but the tokens issued are marked.
+func (u *User) IsShadowBanned() bool {
+	return u.ShadowBannedAt != nil
+}
+
+// SetShadowBanned shadow bans the user or lifts the shadow ban.
+func (u *User) SetShadowBanned(tx *storage.Connection, banned bool) error {
+	if banned {
+		now := time.Now()
+		u.ShadowBannedAt = &now
+	} else {
+		u.ShadowBannedAt = nil
+	}
+	return tx.UpdateOnly(u, "shadow_banned_at")
 }
 
 // RemoveUnconfirmedIdentities removes potentially malicious unconfirmed identities from a user (if any)
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/conf"
@@ -126,6 +129,52 @@ func (ts *UserTestSuite) TestFindUsersInAudience() {
 	require.Len(ts.T(), n, 1)
 }
 
+func (ts *UserTestSuite) TestFindUsersWithStatusInAudience() {
+	banned := ts.createUserWithEmail("banned@example.com")
+	locked := ts.createUserWithEmail("locked@example.com")
+	now := time.Now()
+
+	require.NoError(ts.T(), banned.Confirm(ts.db))
+	until := now.Add(time.Hour)
+	banned.BannedUntil = &until
+	require.NoError(ts.T(), banned.UpdateBannedUntil(ts.db))
+
+	sentAt := now.Add(-time.Minute).Round(time.Microsecond)
+	locked.ConfirmationSentAt = &sentAt
+	require.NoError(ts.T(), ts.db.UpdateOnly(locked, "confirmation_sent_at"))
+	for i := 0; i < 3; i++ {
+		_, err := RecordFailedOtpAttempt(ts.db, locked, ConfirmationChallenge, sentAt)
+		require.NoError(ts.T(), err)
+	}
+
+	find := func(status string, otpMaxAttempts int) []*User {
+		users, err := FindUsersWithStatusInAudience(ts.db, uuid.Nil, "test", status, now, otpMaxAttempts, nil, nil, "")
+		require.NoError(ts.T(), err)
+		return users
+	}
+
+	users := find(UserStatusBanned, 3)
+	require.Len(ts.T(), users, 1)
+	assert.Equal(ts.T(), banned.ID, users[0].ID)
+
+	users = find(UserStatusLocked, 3)
+	require.Len(ts.T(), users, 1)
+	assert.Equal(ts.T(), locked.ID, users[0].ID)
+	assert.Len(ts.T(), find(UserStatusLocked, 4), 0)
+
+	users = find(UserStatusUnconfirmed, 3)
+	require.Len(ts.T(), users, 1)
+	assert.Equal(ts.T(), locked.ID, users[0].ID)
+
+	// the ban ended
+	users, err := FindUsersWithStatusInAudience(ts.db, uuid.Nil, "test", UserStatusBanned, until.Add(time.Second), 3, nil, nil, "")
+	require.NoError(ts.T(), err)
+	assert.Len(ts.T(), users, 0)
+
+	_, err = FindUsersWithStatusInAudience(ts.db, uuid.Nil, "test", "deleted", now, 3, nil, nil, "")
+	assert.Error(ts.T(), err)
+}
+
 func (ts *UserTestSuite) TestFindUserByID() {
 	u := ts.createUser()
 
@@ -157,7 +206,7 @@ func (ts *UserTestSuite) TestFindUserByRecoveryToken() {
 
 func (ts *UserTestSuite) TestFindUserWithRefreshToken() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(&http.Request{}, ts.db, u)
 	require.NoError(ts.T(), err)
 
 	n, nr, err := FindUserWithRefreshToken(ts.db, r.Token)
@@ -255,3 +304,56 @@ func (ts *UserTestSuite) TestRemoveUnconfirmedIdentities() {
 	require.Equal(ts.T(), user.AppMetaData["provider"], "phone")
 	require.Equal(ts.T(), user.AppMetaData["providers"], []string{"phone", "twitter"})
 }
+
+// Baselines are recorded in hack/bench_baseline.txt, see make bench.
+func BenchmarkUserAuthenticate(b *testing.B) {
+	// the tests hash with the minimum cost, verify against the default one
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	require.NoError(b, err)
+	user := &User{EncryptedPassword: string(hash)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !user.Authenticate("password") {
+			b.Fatal("password not accepted")
+		}
+	}
+}
+
+func BenchmarkFindUserByEmailAndAudience(b *testing.B) {
+	const users = 10000
+
+	globalConfig, err := conf.LoadGlobal(modelsTestConfig)
+	require.NoError(b, err)
+	conn, err := test.SetupDBConnection(globalConfig)
+	if err != nil {
+		b.Skipf("database unavailable: %v", err)
+	}
+	defer conn.Close()
+	if err := TruncateAll(conn); err != nil {
+		b.Skipf("database unavailable: %v", err)
+	}
+
+	err = conn.Transaction(func(tx *storage.Connection) error {
+		for i := 0; i < users; i++ {
+			user, terr := NewUserWithPasswordHash(uuid.Nil, "", fmt.Sprintf("user-%d@example.com", i), "", "authenticated", nil)
+			if terr != nil {
+				return terr
+			}
+			if terr := tx.Create(user); terr != nil {
+				return terr
+			}
+		}
+		return nil
+	})
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := FindUserByEmailAndAudience(conn, uuid.Nil, fmt.Sprintf("User-%d@example.com", i%users), "authenticated"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
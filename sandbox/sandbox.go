@@ -0,0 +1,71 @@
+// Package sandbox keeps the emails and SMS of sandbox mode in memory instead
+// of sending them, so end-to-end tests can read confirmation links and codes.
+package sandbox
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// The channels messages are sent over.
+const (
+	ChannelEmail    = "email"
+	ChannelSms      = "sms"
+	ChannelWhatsapp = "whatsapp"
+)
+
+// MaxMessages is the number of messages kept. Older messages are dropped
+// once it is reached.
+const MaxMessages = 1000
+
+// Message is an email or SMS that wasn't sent.
+type Message struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+	// Data holds the template data of emails, like the Token and
+	// ConfirmationURL.
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+var (
+	mu       sync.Mutex
+	messages []Message
+)
+
+// Store keeps the message.
+func Store(m Message) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(messages) >= MaxMessages {
+		messages = messages[len(messages)-MaxMessages+1:]
+	}
+	messages = append(messages, m)
+}
+
+// Take returns the messages to the recipient, oldest first, and forgets them.
+// An empty recipient takes all messages. Emails are matched regardless of
+// case.
+func Take(to string) []Message {
+	mu.Lock()
+	defer mu.Unlock()
+
+	taken := []Message{}
+	kept := messages[:0]
+	for _, m := range messages {
+		if to == "" || strings.EqualFold(m.To, to) {
+			taken = append(taken, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	messages = kept
+	return taken
+}
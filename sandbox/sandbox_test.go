@@ -0,0 +1,39 @@
+package sandbox
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTake(t *testing.T) {
+	Take("")
+	Store(Message{Channel: ChannelEmail, To: "User@example.com", Body: "first"})
+	Store(Message{Channel: ChannelSms, To: "+15555550100", Body: "code"})
+	Store(Message{Channel: ChannelEmail, To: "user@example.com", Body: "second"})
+
+	taken := Take("user@example.com")
+	require.Len(t, taken, 2)
+	assert.Equal(t, "first", taken[0].Body)
+	assert.Equal(t, "second", taken[1].Body)
+	assert.False(t, taken[0].CreatedAt.IsZero())
+	assert.Empty(t, Take("user@example.com"))
+
+	taken = Take("")
+	require.Len(t, taken, 1)
+	assert.Equal(t, ChannelSms, taken[0].Channel)
+	assert.Empty(t, Take(""))
+}
+
+func TestStoreDropsOldest(t *testing.T) {
+	Take("")
+	for i := 0; i < MaxMessages+10; i++ {
+		Store(Message{Channel: ChannelSms, To: "+15555550100", Body: fmt.Sprint(i)})
+	}
+
+	taken := Take("")
+	require.Len(t, taken, MaxMessages)
+	assert.Equal(t, "10", taken[0].Body)
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/netlify/gotrue/utilities"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -39,6 +40,21 @@ const (
 	SuccessfullyVerified
 )
 
+// captchaVerifyURLs are where the tokens of the supported captcha providers
+// are verified. They all take the same parameters and respond alike.
+var captchaVerifyURLs = map[string]string{
+	"hcaptcha":  "https://hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// IsSupportedCaptchaProvider returns true if tokens of the captcha provider
+// can be verified.
+func IsSupportedCaptchaProvider(provider string) bool {
+	_, ok := captchaVerifyURLs[provider]
+	return ok
+}
+
 var Client *http.Client
 
 func init() {
@@ -55,11 +71,14 @@ func init() {
 	Client = &http.Client{Timeout: defaultTimeout}
 }
 
-func VerifyRequest(r *http.Request, secretKey string) (VerificationResult, error) {
-	if r.FormValue("grant_type") == "refresh_token" {
-		// captcha shouldn't be enabled on requests to refresh the token
-		return SuccessfullyVerified, nil
+// VerifyRequest verifies the captcha token in the gotrue_meta_security field
+// of the request body with the provider, using client for the call.
+func VerifyRequest(r *http.Request, provider, secretKey string, client *http.Client) (VerificationResult, error) {
+	verifyURL, ok := captchaVerifyURLs[provider]
+	if !ok {
+		return VerificationProcessFailure, fmt.Errorf("unsupported captcha provider %q", provider)
 	}
+
 	res := GotrueRequest{}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -74,37 +93,36 @@ func VerifyRequest(r *http.Request, secretKey string) (VerificationResult, error
 	if err != nil || strings.TrimSpace(res.Security.Token) == "" {
 		return UserRequestFailed, errors.Wrap(err, "couldn't decode captcha info")
 	}
-	clientIP := strings.Split(r.RemoteAddr, ":")[0]
-	return verifyCaptchaCode(res.Security.Token, secretKey, clientIP)
+	return verifyCaptchaCode(client, provider, verifyURL, res.Security.Token, secretKey, utilities.GetIPAddress(r))
 }
 
-func verifyCaptchaCode(token string, secretKey string, clientIP string) (VerificationResult, error) {
+func verifyCaptchaCode(client *http.Client, provider, verifyURL, token, secretKey, clientIP string) (VerificationResult, error) {
 	data := url.Values{}
 	data.Set("secret", secretKey)
 	data.Set("response", token)
 	data.Set("remoteip", clientIP)
 	// TODO (darora): pipe through sitekey
 
-	r, err := http.NewRequest("POST", "https://hcaptcha.com/siteverify", strings.NewReader(data.Encode()))
+	r, err := http.NewRequest("POST", verifyURL, strings.NewReader(data.Encode()))
 	if err != nil {
-		return VerificationProcessFailure, errors.Wrap(err, "couldn't initialize request object for hcaptcha check")
+		return VerificationProcessFailure, errors.Wrapf(err, "couldn't initialize request object for %s check", provider)
 	}
 	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
-	res, err := Client.Do(r)
+	res, err := client.Do(r)
 	if err != nil {
-		return VerificationProcessFailure, errors.Wrap(err, "failed to verify hcaptcha token")
+		return VerificationProcessFailure, errors.Wrapf(err, "failed to verify %s token", provider)
 	}
 	verResult := VerificationResponse{}
 	defer res.Body.Close()
 	decoder := json.NewDecoder(res.Body)
 	err = decoder.Decode(&verResult)
 	if err != nil {
-		return VerificationProcessFailure, errors.Wrap(err, "failed to decode hcaptcha response")
+		return VerificationProcessFailure, errors.Wrapf(err, "failed to decode %s response", provider)
 	}
-	logrus.WithField("result", verResult).Info("obtained hcaptcha verification result")
+	logrus.WithField("result", verResult).Infof("obtained %s verification result", provider)
 	if !verResult.Success {
-		return UserRequestFailed, fmt.Errorf("user request suppressed by hcaptcha")
+		return UserRequestFailed, fmt.Errorf("user request suppressed by %s", provider)
 	}
 	return SuccessfullyVerified, nil
 }
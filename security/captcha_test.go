@@ -0,0 +1,43 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCaptchaCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret", r.PostForm.Get("secret"))
+		assert.Equal(t, "10.0.0.1", r.PostForm.Get("remoteip"))
+		if r.PostForm.Get("response") == "valid" {
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	result, err := verifyCaptchaCode(server.Client(), "turnstile", server.URL, "valid", "secret", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, SuccessfullyVerified, result)
+
+	result, err = verifyCaptchaCode(server.Client(), "turnstile", server.URL, "invalid", "secret", "10.0.0.1")
+	assert.Error(t, err)
+	assert.Equal(t, UserRequestFailed, result)
+}
+
+func TestVerifyRequestUnsupportedProvider(t *testing.T) {
+	for _, provider := range []string{"hcaptcha", "recaptcha", "turnstile"} {
+		assert.True(t, IsSupportedCaptchaProvider(provider))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`{"gotrue_meta_security":{"captcha_token":"token"}}`))
+	result, err := VerifyRequest(req, "captcha", "secret", http.DefaultClient)
+	assert.Error(t, err)
+	assert.Equal(t, VerificationProcessFailure, result)
+}
@@ -0,0 +1,133 @@
+package security
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// The character classes a password policy can require.
+const (
+	PasswordLowercase = "lowercase"
+	PasswordUppercase = "uppercase"
+	PasswordDigits    = "digits"
+	PasswordSymbols   = "symbols"
+)
+
+var passwordClassSizes = map[string]float64{
+	PasswordLowercase: 26,
+	PasswordUppercase: 26,
+	PasswordDigits:    10,
+	PasswordSymbols:   33,
+}
+
+// IsPasswordClass tells whether class is a character class passwords can be
+// required to contain.
+func IsPasswordClass(class string) bool {
+	_, ok := passwordClassSizes[class]
+	return ok
+}
+
+// PasswordClasses returns the character classes of a password.
+func PasswordClasses(password string) map[string]bool {
+	classes := map[string]bool{}
+	for _, r := range password {
+		classes[passwordClass(r)] = true
+	}
+	return classes
+}
+
+func passwordClass(r rune) string {
+	switch {
+	case unicode.IsLower(r):
+		return PasswordLowercase
+	case unicode.IsUpper(r):
+		return PasswordUppercase
+	case unicode.IsDigit(r):
+		return PasswordDigits
+	default:
+		return PasswordSymbols
+	}
+}
+
+// commonPasswords are among the most used passwords in breaches. They are
+// guessed first, so any password based on them scores 0.
+var commonPasswords = map[string]bool{}
+
+func init() {
+	for _, p := range strings.Fields(`
+		123456 123456789 12345678 1234567 12345 1234567890 111111 000000 123123 654321
+		password passw0rd p@ssword p@ssw0rd qwerty qwertyuiop qwerty123 asdfgh asdfghjkl zxcvbnm
+		abc123 iloveyou admin administrator welcome letmein monkey dragon master login
+		sunshine princess football baseball shadow superman batman trustno1 whatever starwars
+		secret changeme default hello freedom michael jennifer charlie donald mustang
+		access flower hottie loveme zaq1zaq1 1q2w3e4r 1qaz2wsx qazwsx ashley bailey`) {
+		commonPasswords[p] = true
+	}
+}
+
+// IsDeniedPassword tells whether password, ignoring case and trailing digits
+// and symbols, is in denylist.
+func IsDeniedPassword(password string, denylist []string) bool {
+	lower, base := passwordBase(password)
+	for _, denied := range denylist {
+		denied = strings.ToLower(denied)
+		if denied != "" && (lower == denied || base == denied) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCommonPassword(password string) bool {
+	lower, base := passwordBase(password)
+	return commonPasswords[lower] || commonPasswords[base]
+}
+
+// passwordBase returns the password in lower case, and without the digits
+// and symbols usually appended to meet password policies.
+func passwordBase(password string) (string, string) {
+	lower := strings.ToLower(password)
+	return lower, strings.TrimRightFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// PasswordScore estimates how hard a password is to guess on the 0 to 4 scale
+// of zxcvbn: 0 is guessed within 10^3 attempts, 1 within 10^6, 2 within 10^8,
+// 3 within 10^10 and 4 takes longer. Passwords based on common or denied ones
+// score 0, repeated characters and sequences like "abc" or "321" add little to
+// the estimate.
+func PasswordScore(password string, denylist []string) int {
+	if isCommonPassword(password) || IsDeniedPassword(password, denylist) {
+		return 0
+	}
+
+	alphabet := 0.0
+	for class := range PasswordClasses(password) {
+		alphabet += passwordClassSizes[class]
+	}
+
+	bits := 0.0
+	var prev rune
+	for i, r := range password {
+		delta := r - prev
+		if i > 0 && (delta >= -1 && delta <= 1) {
+			// repeating or continuing a sequence is guessed right away
+			bits++
+		} else {
+			bits += math.Log2(alphabet)
+		}
+		prev = r
+	}
+
+	switch {
+	case bits < 3*math.Log2(10):
+		return 0
+	case bits < 6*math.Log2(10):
+		return 1
+	case bits < 8*math.Log2(10):
+		return 2
+	case bits < 10*math.Log2(10):
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,33 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordClasses(t *testing.T) {
+	assert.Equal(t, map[string]bool{PasswordLowercase: true, PasswordUppercase: true, PasswordDigits: true, PasswordSymbols: true}, PasswordClasses("aB3$"))
+	assert.Equal(t, map[string]bool{PasswordLowercase: true}, PasswordClasses("abc"))
+	assert.True(t, IsPasswordClass(PasswordSymbols))
+	assert.False(t, IsPasswordClass("emoji"))
+}
+
+func TestPasswordScore(t *testing.T) {
+	cases := map[string]int{
+		"password":             0,
+		"Password123!":         0,
+		"aaaaaa":               0,
+		"abcdefgh":             1,
+		"x7Kq":                 2,
+		"x7Kqz":                3,
+		"correct horse staple": 4,
+	}
+	for password, score := range cases {
+		assert.Equal(t, score, PasswordScore(password, nil), password)
+	}
+
+	assert.True(t, IsDeniedPassword("Acme2022!", []string{"acme"}))
+	assert.False(t, IsDeniedPassword("acmecorp", []string{"acme"}))
+	assert.Equal(t, 0, PasswordScore("Acme2022!", []string{"ACME"}))
+}
@@ -0,0 +1,48 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" // #nosec G505 -- the range API is keyed by SHA-1
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IsPasswordPwned checks whether the password appeared in a data breach with
+// the k-anonymity range API at baseURL. Only the first 5 characters of the
+// password's SHA-1 hash are sent, and the response is padded so its size
+// doesn't give away the prefix either.
+func IsPasswordPwned(ctx context.Context, client *http.Client, baseURL, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password)) // #nosec G401
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Add-Padding", "true")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("pwned passwords range API returned status %d", res.StatusCode)
+	}
+
+	// every line is the suffix of a hash and how often it was seen, padding
+	// lines are seen 0 times
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) == 2 && parts[0] == suffix && parts[1] != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,40 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPasswordPwned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the SHA-1 hash of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+		assert.Equal(t, "/range/5BAA6", r.URL.Path)
+		assert.Equal(t, "true", r.Header.Get("Add-Padding"))
+		w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n"))
+	}))
+	defer server.Close()
+
+	pwned, err := IsPasswordPwned(context.Background(), server.Client(), server.URL, "password")
+	require.NoError(t, err)
+	assert.True(t, pwned)
+
+	padded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:0\r\n"))
+	}))
+	defer padded.Close()
+	pwned, err = IsPasswordPwned(context.Background(), padded.Client(), padded.URL, "password")
+	require.NoError(t, err)
+	assert.False(t, pwned)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	_, err = IsPasswordPwned(context.Background(), failing.Client(), failing.URL, "password")
+	assert.Error(t, err)
+}
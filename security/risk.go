@@ -0,0 +1,147 @@
+package security
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// RiskDecision is the action taken for a request based on its risk score.
+type RiskDecision string
+
+const (
+	RiskAllow          RiskDecision = "allow"
+	RiskRequireCaptcha RiskDecision = "require_captcha"
+	RiskRequireMFA     RiskDecision = "require_mfa"
+	RiskBlock          RiskDecision = "block"
+)
+
+// RiskSignals are the request attributes a risk assessment is based on.
+type RiskSignals struct {
+	IPAddress string `json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+	Email     string `json:"email,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	ASN       string `json:"asn,omitempty"`
+	Endpoint  string `json:"endpoint"`
+}
+
+// RiskAssessment is the outcome of scoring a request.
+type RiskAssessment struct {
+	Score    int          `json:"score"`
+	Decision RiskDecision `json:"decision"`
+	Reasons  []string     `json:"reasons,omitempty"`
+}
+
+// RiskThresholds map a score to a decision. A zero threshold is ignored.
+type RiskThresholds struct {
+	Captcha int
+	MFA     int
+	Block   int
+}
+
+// Decide returns the strictest decision whose threshold the score reaches.
+func (t RiskThresholds) Decide(score int) RiskDecision {
+	switch {
+	case t.Block > 0 && score >= t.Block:
+		return RiskBlock
+	case t.MFA > 0 && score >= t.MFA:
+		return RiskRequireMFA
+	case t.Captcha > 0 && score >= t.Captcha:
+		return RiskRequireCaptcha
+	}
+	return RiskAllow
+}
+
+// HeuristicScorer scores requests using simple built-in signals: request
+// velocity per IP address, blocked ASNs and disposable email domains.
+type HeuristicScorer struct {
+	DisposableEmailDomains []string
+	BlockedASNs            []string
+	VelocityLimit          int
+	VelocityWindow         time.Duration
+	Velocity               *VelocityTracker
+}
+
+// Score computes a risk score between 0 and 100 for the given signals.
+func (s *HeuristicScorer) Score(signals RiskSignals) (int, []string) {
+	score := 0
+	reasons := []string{}
+
+	if signals.ASN != "" {
+		for _, asn := range s.BlockedASNs {
+			if strings.EqualFold(strings.TrimPrefix(strings.ToUpper(asn), "AS"), strings.TrimPrefix(strings.ToUpper(signals.ASN), "AS")) {
+				score += 100
+				reasons = append(reasons, "blocked_asn")
+				break
+			}
+		}
+	}
+
+	if at := strings.LastIndex(signals.Email, "@"); at != -1 {
+		domain := strings.ToLower(signals.Email[at+1:])
+		for _, d := range s.DisposableEmailDomains {
+			if domain == strings.ToLower(d) {
+				score += 50
+				reasons = append(reasons, "disposable_email")
+				break
+			}
+		}
+	}
+
+	if s.Velocity != nil && s.VelocityLimit > 0 && signals.IPAddress != "" {
+		if s.Velocity.Add(signals.IPAddress, s.VelocityWindow) > s.VelocityLimit {
+			score += 40
+			reasons = append(reasons, "velocity")
+		}
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	return score, reasons
+}
+
+// VelocityTracker counts events per key within a sliding window.
+type VelocityTracker struct {
+	mu        sync.Mutex
+	events    map[string][]time.Time
+	lastSweep time.Time
+}
+
+// NewVelocityTracker creates an empty tracker.
+func NewVelocityTracker() *VelocityTracker {
+	return &VelocityTracker{
+		events:    make(map[string][]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Add records an event for key and returns the number of events seen for it within window.
+func (v *VelocityTracker) Add(key string, window time.Duration) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+	kept := v.events[key][:0]
+	for _, t := range v.events[key] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	v.events[key] = kept
+
+	// periodically drop stale keys so the map doesn't grow unbounded
+	if v.lastSweep.Before(cutoff) {
+		for k, times := range v.events {
+			if times[len(times)-1].Before(cutoff) {
+				delete(v.events, k)
+			}
+		}
+		v.lastSweep = now
+	}
+
+	return len(kept)
+}
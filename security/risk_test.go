@@ -0,0 +1,46 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRiskThresholdsDecide(t *testing.T) {
+	thresholds := RiskThresholds{Captcha: 50, MFA: 70, Block: 90}
+
+	assert.Equal(t, RiskAllow, thresholds.Decide(0))
+	assert.Equal(t, RiskRequireCaptcha, thresholds.Decide(50))
+	assert.Equal(t, RiskRequireMFA, thresholds.Decide(75))
+	assert.Equal(t, RiskBlock, thresholds.Decide(100))
+}
+
+func TestHeuristicScorer(t *testing.T) {
+	scorer := &HeuristicScorer{
+		DisposableEmailDomains: []string{"mailinator.com"},
+		BlockedASNs:            []string{"AS64500"},
+		VelocityLimit:          2,
+		VelocityWindow:         time.Minute,
+		Velocity:               NewVelocityTracker(),
+	}
+
+	score, reasons := scorer.Score(RiskSignals{IPAddress: "192.0.2.1", Email: "test@example.com"})
+	assert.Equal(t, 0, score)
+	assert.Empty(t, reasons)
+
+	score, reasons = scorer.Score(RiskSignals{IPAddress: "192.0.2.2", Email: "test@Mailinator.com"})
+	assert.Equal(t, 50, score)
+	assert.Equal(t, []string{"disposable_email"}, reasons)
+
+	score, reasons = scorer.Score(RiskSignals{IPAddress: "192.0.2.3", ASN: "64500"})
+	assert.Equal(t, 100, score)
+	assert.Equal(t, []string{"blocked_asn"}, reasons)
+
+	// third request from the same IP exceeds the velocity limit
+	score, _ = scorer.Score(RiskSignals{IPAddress: "192.0.2.1"})
+	assert.Equal(t, 0, score)
+	score, reasons = scorer.Score(RiskSignals{IPAddress: "192.0.2.1"})
+	assert.Equal(t, 40, score)
+	assert.Equal(t, []string{"velocity"}, reasons)
+}
@@ -8,6 +8,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gobuffalo/pop/v5"
 	"github.com/gobuffalo/pop/v5/columns"
+	"github.com/luna-duclos/instrumentedsql"
 	"github.com/netlify/gotrue/conf"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -28,11 +29,19 @@ func Dial(config *conf.GlobalConfiguration) (*Connection, error) {
 		config.DB.Driver = u.Scheme
 	}
 
-	db, err := pop.NewConnection(&pop.ConnectionDetails{
+	details := &pop.ConnectionDetails{
 		Dialect: config.DB.Driver,
 		URL:     config.DB.URL,
 		Pool:    config.DB.MaxPoolSize,
-	})
+	}
+	if config.Tracing.Enabled {
+		details.UseInstrumentedDriver = true
+		details.InstrumentedDriverOptions = []instrumentedsql.Opt{
+			instrumentedsql.WithTracer(queryTracer{}),
+			instrumentedsql.WithOmitArgs(),
+		}
+	}
+	db, err := pop.NewConnection(details)
 	if err != nil {
 		return nil, errors.Wrap(err, "opening database connection")
 	}
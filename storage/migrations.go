@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"os"
+	sortpkg "sort"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+)
+
+// MigrationTableName is the table the applied migrations are recorded in.
+const MigrationTableName = "schema_migrations"
+
+// Migration is a migration in the migrations directory.
+type Migration struct {
+	Version string `json:"version"`
+	Name    string `json:"name"`
+}
+
+// MigrationStatus compares the migrations applied to the database with the
+// ones in the migrations directory.
+type MigrationStatus struct {
+	Applied []Migration `json:"applied"`
+	Pending []Migration `json:"pending"`
+	// Unknown are the versions applied to the database that aren't in the
+	// migrations directory, usually by a newer release.
+	Unknown []string `json:"unknown"`
+
+	DatabaseVersion string `json:"database_version"`
+	LatestVersion   string `json:"latest_version"`
+}
+
+// UpToDate tells if every migration was applied, and nothing else.
+func (s *MigrationStatus) UpToDate() bool {
+	return len(s.Pending) == 0 && len(s.Unknown) == 0
+}
+
+// GetMigrationStatus compares the migrations applied to the database with
+// the migrations in path, without changing the database.
+func GetMigrationStatus(c *Connection, path string) (*MigrationStatus, error) {
+	// the migrator reads a missing directory as having no migrations
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil, errors.Errorf("migrations directory %s not found", path)
+	}
+	migrator, err := pop.NewFileMigrator(path, c.Connection)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading migrations")
+	}
+
+	var applied []string
+	tables := struct {
+		Count int `db:"count"`
+	}{}
+	if err := c.RawQuery("SELECT COUNT(*) AS count FROM information_schema.tables WHERE table_name = ?", MigrationTableName).First(&tables); err != nil {
+		return nil, errors.Wrap(err, "error finding migrations table")
+	}
+	// the table is only created by the first migration
+	if tables.Count > 0 {
+		if err := c.Store.Select(&applied, "SELECT version FROM "+MigrationTableName); err != nil {
+			return nil, errors.Wrap(err, "error reading applied migrations")
+		}
+	}
+	isApplied := make(map[string]bool, len(applied))
+	for _, version := range applied {
+		isApplied[version] = true
+	}
+
+	status := &MigrationStatus{
+		Applied: []Migration{},
+		Pending: []Migration{},
+		Unknown: []string{},
+	}
+	known := map[string]bool{}
+	dialect := c.Dialect.Name()
+	for _, mf := range migrator.Migrations["up"] {
+		if mf.DBType != "all" && mf.DBType != dialect {
+			continue
+		}
+		known[mf.Version] = true
+		migration := Migration{Version: mf.Version, Name: mf.Name}
+		if isApplied[mf.Version] {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+		if mf.Version > status.LatestVersion {
+			status.LatestVersion = mf.Version
+		}
+	}
+	for _, version := range applied {
+		if !known[version] {
+			status.Unknown = append(status.Unknown, version)
+		}
+		if version > status.DatabaseVersion {
+			status.DatabaseVersion = version
+		}
+	}
+	sortpkg.Strings(status.Unknown)
+	return status, nil
+}
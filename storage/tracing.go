@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/luna-duclos/instrumentedsql"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// queryTracer traces the queries of connections with a span in their context,
+// as children of the span.
+type queryTracer struct{}
+
+type querySpan struct {
+	parent opentracing.SpanContext
+	span   opentracing.Span
+}
+
+func (queryTracer) GetSpan(ctx context.Context) instrumentedsql.Span {
+	if ctx == nil {
+		return querySpan{}
+	}
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return querySpan{}
+	}
+	return querySpan{parent: parent.Context()}
+}
+
+func (s querySpan) NewChild(name string) instrumentedsql.Span {
+	if s.parent == nil {
+		return querySpan{}
+	}
+	var parent opentracing.SpanContext = s.parent
+	if s.span != nil {
+		parent = s.span.Context()
+	}
+	span := opentracing.GlobalTracer().StartSpan(name, opentracing.ChildOf(parent), ext.SpanKindRPCClient)
+	ext.DBType.Set(span, "sql")
+	return querySpan{parent: parent, span: span}
+}
+
+func (s querySpan) SetLabel(k, v string) {
+	if s.span != nil {
+		s.span.SetTag(k, v)
+	}
+}
+
+func (s querySpan) SetError(err error) {
+	if s.span != nil && err != nil {
+		ext.Error.Set(s.span, true)
+		s.span.LogKV("event", "error", "message", err.Error())
+	}
+}
+
+func (s querySpan) Finish() {
+	if s.span != nil {
+		s.span.Finish()
+	}
+}
+
+// WithContext returns the connection running its queries in ctx, which traces
+// them as part of the span of ctx.
+func (c *Connection) WithContext(ctx context.Context) *Connection {
+	return &Connection{c.Connection.WithContext(ctx)}
+}
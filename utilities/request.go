@@ -0,0 +1,18 @@
+package utilities
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// GetIPAddress returns the client IP address of the request. The xff
+// middleware has already rewritten RemoteAddr from any trusted
+// X-Forwarded-For header by the time handlers run.
+func GetIPAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return strings.TrimSpace(r.RemoteAddr)
+	}
+	return host
+}
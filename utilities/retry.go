@@ -0,0 +1,118 @@
+package utilities
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryTransport retries idempotent requests that failed with a network
+// error, a 5xx or a 429 response, after an exponential backoff with full
+// jitter. Every attempt gets its own deadline, within the deadline of the
+// request context, and no retry is made that couldn't finish before it.
+type RetryTransport struct {
+	Inner http.RoundTripper
+	// MaxAttempts is the number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff after the first attempt, which doubles after
+	// every attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// AttemptTimeout bounds each attempt, when set.
+	AttemptTimeout time.Duration
+}
+
+// NewRetryTransport returns a RetryTransport with 3 attempts, backing off
+// from 100ms up to 1s.
+func NewRetryTransport(inner http.RoundTripper, attemptTimeout time.Duration) *RetryTransport {
+	return &RetryTransport{
+		Inner:          inner,
+		MaxAttempts:    3,
+		BaseDelay:      100 * time.Millisecond,
+		MaxDelay:       time.Second,
+		AttemptTimeout: attemptTimeout,
+	}
+}
+
+// RoundTrip sends the request, retrying it when it is idempotent.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	inner := t.Inner
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	attempts := t.MaxAttempts
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		attempts = 1
+	}
+
+	parent := req.Context()
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := parent, context.CancelFunc(func() {})
+		if t.AttemptTimeout > 0 {
+			ctx, cancel = context.WithTimeout(parent, t.AttemptTimeout)
+		}
+		rsp, err := inner.RoundTrip(req.Clone(ctx))
+
+		delay := t.backoff(attempt)
+		if attempt >= attempts || !isRetryable(rsp, err) || parent.Err() != nil || !fitsDeadline(parent, delay+t.AttemptTimeout) {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// the attempt's context has to outlive reading the body
+			rsp.Body = &cancelOnClose{ReadCloser: rsp.Body, cancel: cancel}
+			return rsp, nil
+		}
+		if rsp != nil {
+			_, _ = io.Copy(ioutil.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+		cancel()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-parent.Done():
+			timer.Stop()
+			return nil, parent.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	max := t.BaseDelay << uint(attempt-1)
+	if max > t.MaxDelay || max <= 0 {
+		max = t.MaxDelay
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+func isRetryable(rsp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return rsp.StatusCode >= http.StatusInternalServerError || rsp.StatusCode == http.StatusTooManyRequests
+}
+
+// fitsDeadline tells if d is left before the deadline of ctx, if any.
+func fitsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > d
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,93 @@
+package utilities
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retryServer(failures int, status int) (*httptest.Server, *int) {
+	calls := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	return svr, &calls
+}
+
+func TestRetryTransportRetriesTransientErrors(t *testing.T) {
+	svr, calls := retryServer(2, http.StatusServiceUnavailable)
+	defer svr.Close()
+
+	client := &http.Client{Transport: &RetryTransport{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, AttemptTimeout: time.Second}}
+	rsp, err := client.Get(svr.URL)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, 3, *calls)
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	svr, calls := retryServer(5, http.StatusBadGateway)
+	defer svr.Close()
+
+	client := &http.Client{Transport: &RetryTransport{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}}
+	rsp, err := client.Get(svr.URL)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, rsp.StatusCode)
+	assert.Equal(t, 3, *calls)
+}
+
+func TestRetryTransportSkipsPermanentErrors(t *testing.T) {
+	svr, calls := retryServer(5, http.StatusUnauthorized)
+	defer svr.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil, time.Second)}
+	rsp, err := client.Get(svr.URL)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, 1, *calls)
+}
+
+func TestRetryTransportSkipsNonIdempotentRequests(t *testing.T) {
+	svr, calls := retryServer(5, http.StatusServiceUnavailable)
+	defer svr.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil, time.Second)}
+	rsp, err := client.Post(svr.URL, "text/plain", strings.NewReader("body"))
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, 1, *calls)
+}
+
+func TestRetryTransportRespectsDeadline(t *testing.T) {
+	svr, calls := retryServer(5, http.StatusServiceUnavailable)
+	defer svr.Close()
+
+	// another attempt couldn't finish before the deadline of the request
+	client := &http.Client{Transport: &RetryTransport{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, AttemptTimeout: 2 * time.Second}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, svr.URL, nil)
+	require.NoError(t, err)
+
+	rsp, err := client.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, rsp.StatusCode)
+	assert.Equal(t, 1, *calls)
+}
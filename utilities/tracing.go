@@ -0,0 +1,57 @@
+package utilities
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// TracingTransport traces requests whose context has a span, as children of
+// the span, and propagates the trace to the server in the request headers.
+type TracingTransport struct {
+	Inner http.RoundTripper
+}
+
+// NewTracingTransport returns a TracingTransport sending requests with inner,
+// or with the default transport if nil.
+func NewTracingTransport(inner http.RoundTripper) *TracingTransport {
+	return &TracingTransport{Inner: inner}
+}
+
+// RoundTrip sends the request in a span.
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	inner := t.Inner
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	parent := opentracing.SpanFromContext(req.Context())
+	if parent == nil {
+		return inner.RoundTrip(req)
+	}
+
+	span := opentracing.GlobalTracer().StartSpan("http.request", opentracing.ChildOf(parent.Context()), ext.SpanKindRPCClient)
+	defer span.Finish()
+	ext.HTTPMethod.Set(span, req.Method)
+	ext.HTTPUrl.Set(span, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	span.SetTag("resource.name", req.Method+" "+req.URL.Host)
+
+	req = req.Clone(req.Context())
+	if err := span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header)); err != nil {
+		span.LogKV("event", "error", "message", err.Error())
+	}
+
+	rsp, err := inner.RoundTrip(req)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "message", err.Error())
+		return nil, err
+	}
+	// Setting the status as an int doesn't propagate to datadog dashboards
+	span.SetTag(string(ext.HTTPStatusCode), strconv.Itoa(rsp.StatusCode))
+	if rsp.StatusCode >= http.StatusInternalServerError {
+		ext.Error.Set(span, true)
+	}
+	return rsp, nil
+}
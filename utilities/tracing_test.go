@@ -0,0 +1,64 @@
+package utilities
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingTransportPropagatesSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	var traceHeader string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceHeader = r.Header.Get("Mockpfx-Ids-Traceid")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	parent := tracer.StartSpan("http.handler")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, svr.URL+"/userinfo", nil)
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: NewTracingTransport(nil)}
+	rsp, err := client.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "http.request", span.OperationName)
+	assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, span.ParentID)
+	assert.Equal(t, "200", span.Tag("http.status_code"))
+	assert.Equal(t, svr.URL+"/userinfo", span.Tag("http.url"))
+	assert.NotEmpty(t, traceHeader)
+}
+
+func TestTracingTransportSkipsRequestsWithoutSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	client := &http.Client{Transport: NewTracingTransport(nil)}
+	rsp, err := client.Get(svr.URL)
+	require.NoError(t, err)
+	rsp.Body.Close()
+
+	assert.Empty(t, tracer.FinishedSpans())
+}